@@ -0,0 +1,123 @@
+package api
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/auth"
+	"userprofile-api/config"
+	"userprofile-api/recovery"
+	"userprofile-api/repository"
+)
+
+// Options configure the routes of the users API, both for the standalone
+// server and for programs mounting the API in an engine of their own
+type Options struct {
+	// Config holds the settings the routes are built with
+	Config *config.Config
+	// Repository is where the users are kept
+	Repository repository.UserRepository
+	// Services are the other components the routes are built on
+	Services Services
+	// BasePath prefixes every route of the API, such as /users-service;
+	// empty serves them at the root. The OpenAPI document describes the API
+	// at the root, so requests are only validated against it without one.
+	BasePath string
+	// Middlewares run on every request, after the built-in middleware such
+	// as request IDs, logging and CORS, and before authentication
+	Middlewares []gin.HandlerFunc
+	// RouteMiddlewares run on the requests of single routes, named by their
+	// method and their path below BasePath as gin registers it, such as
+	// "DELETE /api/v1/users/:id". They run after authentication and role
+	// checks, just before the handler. Naming a route that does not exist
+	// panics, as a typo would otherwise leave it unprotected.
+	RouteMiddlewares map[string][]gin.HandlerFunc
+	// AuthProvider, when set, authenticates callers ahead of the configured
+	// API keys and JWTs, for embedders with credentials of their own. It must
+	// return auth.ErrNoCredentials for requests without its credentials.
+	AuthProvider auth.Authenticator
+	// Reporter, when set, is told of every panic recovered in a handler,
+	// with its stack trace and request, such as to send it to an error
+	// tracker. Panics are logged either way.
+	Reporter recovery.Reporter
+}
+
+// routeGroup registers routes on a gin group, inserting the middleware
+// Options.RouteMiddlewares names them with just before their handler
+type routeGroup struct {
+	group *gin.RouterGroup
+	// root is the path the route names are relative to
+	root  string
+	extra map[string][]gin.HandlerFunc
+	// used collects the names of the routes that got extra middleware
+	used map[string]bool
+}
+
+func newRouteGroup(group *gin.RouterGroup, extra map[string][]gin.HandlerFunc) *routeGroup {
+	return &routeGroup{group: group, root: group.BasePath(), extra: extra, used: map[string]bool{}}
+}
+
+// Group creates a group of routes under path, running the given middleware
+func (g *routeGroup) Group(path string, handlers ...gin.HandlerFunc) *routeGroup {
+	sub := *g
+	sub.group = g.group.Group(path, handlers...)
+	return &sub
+}
+
+// Use adds middleware to the group's routes registered from now on
+func (g *routeGroup) Use(middleware ...gin.HandlerFunc) {
+	g.group.Use(middleware...)
+}
+
+func (g *routeGroup) GET(path string, handlers ...gin.HandlerFunc) {
+	g.handle("GET", path, handlers)
+}
+
+func (g *routeGroup) POST(path string, handlers ...gin.HandlerFunc) {
+	g.handle("POST", path, handlers)
+}
+
+func (g *routeGroup) PUT(path string, handlers ...gin.HandlerFunc) {
+	g.handle("PUT", path, handlers)
+}
+
+func (g *routeGroup) DELETE(path string, handlers ...gin.HandlerFunc) {
+	g.handle("DELETE", path, handlers)
+}
+
+func (g *routeGroup) handle(method, path string, handlers []gin.HandlerFunc) {
+	name := method + " " + g.routePath(path)
+	if extra, ok := g.extra[name]; ok {
+		g.used[name] = true
+		last := len(handlers) - 1
+		handlers = append(append(slices.Clip(handlers[:last]), extra...), handlers[last])
+	}
+	g.group.Handle(method, path, handlers...)
+}
+
+// routePath returns the path of a route of the group relative to the root
+func (g *routeGroup) routePath(path string) string {
+	full := strings.TrimSuffix(g.group.BasePath(), "/") + path
+	relative := strings.TrimPrefix(full, strings.TrimSuffix(g.root, "/"))
+	if relative == "" {
+		return "/"
+	}
+	return relative
+}
+
+// checkUsed panics when Options.RouteMiddlewares names routes that were not
+// registered
+func (g *routeGroup) checkUsed() {
+	var unknown []string
+	for name := range g.extra {
+		if !g.used[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		slices.Sort(unknown)
+		panic(fmt.Sprintf("api: RouteMiddlewares names unknown routes: %s", strings.Join(unknown, ", ")))
+	}
+}
@@ -1,38 +1,495 @@
 package api
 
 import (
+	"html/template"
+	"log/slog"
+	"net/http"
 	"path/filepath"
 	"runtime"
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"userprofile-api/apierror"
+	"userprofile-api/apiversion"
+	"userprofile-api/auth"
+	"userprofile-api/avatar"
+	"userprofile-api/backup"
+	"userprofile-api/cache"
+	"userprofile-api/config"
+	"userprofile-api/contract"
 	"userprofile-api/controllers"
+	"userprofile-api/cors"
+	"userprofile-api/credentials"
+	"userprofile-api/csrf"
+	"userprofile-api/cursor"
+	"userprofile-api/docs"
+	"userprofile-api/errortracking"
+	"userprofile-api/events"
+	"userprofile-api/expiry"
+	"userprofile-api/fields"
+	"userprofile-api/follow"
+	"userprofile-api/i18n"
+	"userprofile-api/jobs"
+	"userprofile-api/ldapsync"
+	"userprofile-api/links"
+	"userprofile-api/logging"
+	"userprofile-api/metadata"
+	"userprofile-api/metrics"
+	"userprofile-api/moderation"
+	"userprofile-api/profiling"
+	"userprofile-api/quota"
+	"userprofile-api/recovery"
+	"userprofile-api/replica"
+	"userprofile-api/repository"
+	"userprofile-api/requestid"
+	"userprofile-api/service"
+	"userprofile-api/session"
+	"userprofile-api/sharing"
+	"userprofile-api/signing"
+	"userprofile-api/static"
+	"userprofile-api/tenant"
+	"userprofile-api/tracing"
+	"userprofile-api/webhook"
+	"userprofile-api/ws"
 )
 
-// SetupRouter configures the API routes
-func SetupRouter() *gin.Engine {
-	router := gin.Default()
-	
-	// Get the absolute path to the templates directory
-	_, b, _, _ := runtime.Caller(0)
-	basePath := filepath.Dir(filepath.Dir(b))
-	templatesPath := filepath.Join(basePath, "templates/*")
-	
-	// Setup template rendering
-	router.LoadHTMLGlob(templatesPath)
-	
-	// Root handler shows a nice HTML table of all users
-	router.GET("/", controllers.HomePageHandler)
-	
-	// API version group
-	v1 := router.Group("/api/v1")
-	{
-		users := v1.Group("/users")
+// Services are the long-lived components the routes are built on. The
+// server package creates them so it can also manage their lifecycle.
+type Services struct {
+	Events   *events.Bus
+	Webhooks *webhook.Registry
+	Hub      *ws.Hub
+	Backups  *backup.Manager
+	CORS     *cors.Policy
+	// Tenants holds the tenants' repositories and TenantRegistry the tenants
+	// themselves when tenancy is enabled
+	Tenants        *tenant.Repositories
+	TenantRegistry *tenant.Registry
+	// Contract validates v1 requests against the OpenAPI document when
+	// OPENAPI_VALIDATION is enabled
+	Contract *contract.Validator
+	// Syncer applies the primary's events on replicas receiving them
+	Syncer *replica.Syncer
+	// Follows holds the relationships of users following each other
+	Follows *follow.Store
+	// Groups holds the groups of each tenant's users
+	Groups *repository.Groups
+	// Metadata holds the schemas user metadata is checked against
+	Metadata *metadata.Schemas
+	// Credentials holds the passwords of users with password-based accounts
+	// and Sessions their logins when PASSWORD_AUTH is enabled
+	Credentials *credentials.Store
+	Sessions    *credentials.Sessions
+	// Catalog holds the translations of error messages and the HTML pages;
+	// nil serves the built-in ones
+	Catalog *i18n.Catalog
+	// Moderator checks the full names and bios of users created and updated;
+	// nil leaves them unmoderated
+	Moderator moderation.Moderator
+	// Expiry soft-deletes users past their expiry time; its metrics are
+	// exported when set
+	Expiry *expiry.Janitor
+	// Jobs runs background work such as webhook deliveries; the admin API
+	// lists its jobs, and its metrics are exported, when set
+	Jobs *jobs.Runner
+	// Tracker reports the panics and server errors of requests, and the
+	// unexpected errors of the changes made to users, to an error tracker;
+	// nil reports none
+	Tracker *errortracking.Tracker
+	// SigningKeys holds the keys partners sign their requests with, when
+	// SIGNED_REQUESTS is enabled
+	SigningKeys *signing.Registry
+	// LDAP syncs users from a directory on demand when LDAP_URL is set; its
+	// metrics are exported when set
+	LDAP *ldapsync.Syncer
+}
+
+// SetupRouter creates the engine of the standalone server, serving the API
+// as configured by opts along with the HTML pages, which are always served at
+// the root. Unknown routes and methods are answered with the API's errors.
+func SetupRouter(opts Options) *gin.Engine {
+	router := gin.New()
+	// Unknown routes and methods use the same error envelope as the handlers
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(apierror.NoRoute)
+	router.NoMethod(apierror.NoMethod)
+	register(router, opts, true)
+	return router
+}
+
+// Mount registers the routes of the API as configured by opts on an engine
+// of the caller's, under opts.BasePath, with the middleware they need. The
+// HTML pages are not served, and unknown routes and CORS preflights are left
+// to the engine.
+func Mount(router *gin.Engine, opts Options) {
+	register(router, opts, false)
+}
+
+// register adds the routes of the API to router, and the HTML pages for the
+// standalone server, whose middleware also runs on unknown routes
+func register(router *gin.Engine, opts Options, standalone bool) {
+	cfg, services, repo := opts.Config, opts.Services, opts.Repository
+
+	var collectors []prometheus.Collector
+	if services.Expiry != nil {
+		collectors = append(collectors, services.Expiry)
+	}
+	if services.Jobs != nil {
+		collectors = append(collectors, services.Jobs)
+	}
+	if services.LDAP != nil {
+		collectors = append(collectors, services.LDAP)
+	}
+	appMetrics := metrics.New(repo, collectors...)
+	middleware := []gin.HandlerFunc{
+		requestid.Middleware(),
+		otelgin.Middleware(tracing.ServiceName),
+		logging.Middleware(slog.Default()),
+	}
+	var reporters []recovery.Reporter
+	if opts.Reporter != nil {
+		reporters = append(reporters, opts.Reporter)
+	}
+	// Panics are answered with the API's errors and passed to the reporters
+	middleware = append(middleware, recovery.Middleware(slog.Default(), reporters...))
+	if services.Tracker != nil {
+		// Errors captured while handling a request are reported with it,
+		// as are its panics before they are recovered
+		middleware = append(middleware, services.Tracker.Middleware())
+	}
+	middleware = append(middleware,
+		// Cross-origin requests from browser frontends, including
+		// preflights. The policy is installed even while CORS is off, as it
+		// may be turned on by reloading the configuration.
+		services.CORS.Middleware(),
+		appMetrics.Middleware(),
+		// Errors are answered with RFC 7807 problem details when configured
+		// or asked for, including those of unknown routes
+		apierror.ProblemDetails(cfg.Server.ProblemDetails),
+		// Error messages and the pages are served in the language asked for,
+		// their codes unchanged
+		i18n.Middleware(services.Catalog),
+	)
+	// Replicas answer refused changes as configured, pointing at the primary
+	if cfg.Replica.ReadOnly() {
+		middleware = append(middleware, replica.Middleware(cfg.Replica))
+	}
+	middleware = append(middleware, opts.Middlewares...)
+
+	var base *gin.RouterGroup
+	if standalone {
+		router.Use(middleware...)
+		base = router.Group(opts.BasePath)
+	} else {
+		base = router.Group(opts.BasePath, middleware...)
+	}
+	routes := newRouteGroup(base, opts.RouteMiddlewares)
+
+	// Changes made through the API are published to event subscribers, and
+	// those made through the user service are audited
+	userRepo := events.Repository(repo, services.Events)
+	userService := service.NewUserService(userRepo, services.Metadata, slog.Default()).
+		WithModerator(services.Moderator).WithTracker(services.Tracker)
+	userController := controllers.NewUserController(userService, cursor.New(cfg.Pagination.CursorSecret))
+	avatarController := controllers.NewAvatarController(userService, avatar.NewStore(cfg.Avatar), cfg.Avatar)
+	webhookController := controllers.NewWebhookController(services.Webhooks)
+	backupController := controllers.NewBackupController(services.Backups)
+	tenantController := controllers.NewTenantController(services.TenantRegistry)
+	clusterController := controllers.NewClusterController(cfg.Replica, services.Syncer)
+	followController := controllers.NewFollowController(repo, services.Follows)
+	groupController := controllers.NewGroupController(repo, services.Groups)
+	mergeController := controllers.NewMergeController(userService, services.Follows, services.Groups)
+	metadataController := controllers.NewMetadataController(services.Metadata)
+	var jobController *controllers.JobController
+	if services.Jobs != nil {
+		jobController = controllers.NewJobController(services.Jobs)
+	}
+	var ldapController *controllers.LDAPController
+	if services.LDAP != nil {
+		ldapController = controllers.NewLDAPController(services.LDAP)
+	}
+
+	// Each API key's requests are counted against its rate limit, which the
+	// admin API can adjust
+	limiter := quota.New(cfg.Quota)
+	quotaController := controllers.NewQuotaController(limiter, services.TenantRegistry, services.Tenants)
+
+	// Recent user reads are served from memory until a user changes
+	responseCache := cache.NewResponseCache(cfg.Cache)
+	if responseCache.Enabled() {
+		services.Events.Subscribe(responseCache.Handle)
+	}
+	cached := responseCache.Middleware()
+	// Clients can ask user reads for only the attributes they need, and for
+	// emoji as shortcodes
+	selectFields := fields.Middleware(controllers.UserFields)
+	emojiFormat := controllers.EmojiFormat()
+
+	adminController := controllers.NewAdminController(repo, userRepo, services.Backups, cfg.Seed, cfg.Database.Driver,
+		responseCache.Purge, appMetrics)
+
+	// Embedders' own credentials are checked ahead of the configured ones
+	var providers []auth.Authenticator
+	if opts.AuthProvider != nil {
+		providers = append(providers, opts.AuthProvider)
+	}
+	// Partners sign their requests instead of sending a credential
+	var signingKeyController *controllers.SigningKeyController
+	if services.SigningKeys != nil {
+		providers = append(providers, signing.NewAuthenticator(services.SigningKeys, cfg.Signing.Window,
+			cfg.Signing.MaxBodyBytes))
+		signingKeyController = controllers.NewSigningKeyController(services.SigningKeys)
+	}
+	// Shared links stand in for credentials to read a user when the API
+	// requires them; without credentials anyone can read users anyway
+	var shareController *controllers.ShareController
+	if cfg.Sharing.Enabled() {
+		signer := sharing.NewSigner(cfg.Sharing.Secret)
+		if len(providers) > 0 || cfg.Auth.Enabled() {
+			providers = append(providers, sharing.NewAuthenticator(signer))
+		}
+		shareController = controllers.NewShareController(userService, signer, cfg.Sharing, cfg.Server.BaseURL)
+	}
+	guard := auth.NewGuard(cfg.Auth, providers...)
+	var authController *controllers.AuthController
+	if services.Credentials != nil {
+		// Tokens of sessions that were logged out are refused before they
+		// expire
+		guard.RejectRevoked(services.Sessions.Revoked)
+		authController = controllers.NewAuthController(userController, services.Credentials, services.Sessions,
+			auth.NewJWTAuthenticator(cfg.Auth.JWT), cfg.Passwords)
+	}
+
+	// Only the standalone server has HTML pages, at the root
+	if standalone {
+		// Setup template rendering. Pages are built from the layout and
+		// partials, and link to assets by their fingerprinted paths.
+		_, b, _, _ := runtime.Caller(0)
+		basePath := filepath.Dir(filepath.Dir(b))
+		router.SetFuncMap(template.FuncMap{"asset": static.Path})
+		router.LoadHTMLFiles(templateFiles(filepath.Join(basePath, "templates"))...)
+
+		// The home page lists users and manages them through forms protected
+		// against cross-site request forgery. People log in with a session when
+		// accounts are configured; otherwise browsers cannot send the API's
+		// credentials, so the forms are only served while it needs none.
+		var sessions *session.Store
+		if cfg.Session.Enabled() {
+			sessions = session.NewStore(cfg.Session)
+		}
+		pageController := controllers.NewPageController(userService, sessions, guard.Enabled())
+		pages := router.Group("", csrf.Middleware())
 		{
-			users.GET("", controllers.GetUsers)
-			users.GET("/:id", controllers.GetUser)
-			users.POST("", controllers.CreateUser)
-			users.PUT("/:id", controllers.UpdateUser)
+			if sessions != nil {
+				pages.Use(sessions.Middleware())
+				pages.GET("/login", pageController.LoginPage)
+				pages.POST("/login", pageController.Login)
+				pages.POST("/logout", pageController.Logout)
+			}
+			pages.GET("/", pageController.RequireRole(config.RoleViewer), pageController.HomePageHandler)
+			pages.POST("/users", pageController.RequireRole(config.RoleEditor), pageController.CreateUser)
+			pages.GET("/users/:id/edit", pageController.RequireRole(config.RoleEditor), pageController.EditUser)
+			pages.POST("/users/:id", pageController.RequireRole(config.RoleEditor), pageController.UpdateUser)
+			pages.POST("/users/:id/delete", pageController.RequireRole(config.RoleAdmin), pageController.DeleteUser)
 		}
+		router.GET(static.Prefix+"*filepath", static.Handler)
 	}
-	
-	return router
+
+	// Kubernetes-style liveness and readiness probes
+	healthController := controllers.NewHealthController(repo)
+	routes.GET("/healthz", healthController.Liveness)
+	routes.GET("/readyz", healthController.Readiness)
+
+	// Prometheus scrape endpoint
+	routes.GET("/metrics", appMetrics.Handler())
+
+	// Profiling endpoints, unless main serves them on their own address
+	if cfg.Debug.Enabled && cfg.Debug.Addr == "" {
+		// The handlers expect their paths without the base path
+		profiler := gin.WrapH(http.StripPrefix(strings.TrimSuffix(opts.BasePath, "/"), profiling.Handler()))
+		routes.GET(profiling.Prefix+"*profile", profiler)
+		routes.POST(profiling.Prefix+"*profile", profiler)
+	}
+
+	// API documentation
+	routes.GET("/openapi.json", docs.SpecHandler)
+	routes.GET("/docs", docs.UIHandler)
+
+	// Users and their change events are scoped to the registered tenant a
+	// request names, if any
+	tenantScope := func(c *gin.Context) { c.Next() }
+	if cfg.Tenancy.Enabled() {
+		tenantScope = tenant.Middleware(cfg.Tenancy, services.TenantRegistry, services.Tenants)
+	}
+
+	// Live stream of user change events
+	routes.GET("/ws", guard.Authenticate(), guard.RequireRole(config.RoleViewer), tenantScope, services.Hub.ServeWS)
+	userRoutes := func(users *routeGroup) {
+		users.Use(tenantScope)
+		users.GET("", guard.RequireRole(config.RoleViewer),
+			guard.RequireRoleIf(config.RoleAdmin, controllers.IncludeDeleted), selectFields, emojiFormat, cached, userController.GetUsers)
+		users.GET("/stats", guard.RequireRole(config.RoleViewer), cached, userController.GetUserStats)
+		users.GET("/search", guard.RequireRole(config.RoleViewer), selectFields, emojiFormat, cached, userController.SearchUsers)
+		users.POST("/check-duplicates", guard.RequireRole(config.RoleViewer), selectFields, emojiFormat, userController.CheckDuplicates)
+		users.GET("/:id", guard.RequireRole(config.RoleViewer), selectFields, emojiFormat, cached, userController.GetUser)
+		users.GET("/:id/versions", guard.RequireRole(config.RoleViewer), selectFields, emojiFormat, cached, userController.GetUserVersions)
+		users.GET("/by-email/:email", guard.RequireRole(config.RoleViewer), selectFields, emojiFormat, cached, userController.GetUserByEmail)
+		users.POST("", guard.RequireRole(config.RoleEditor), userController.CreateUser)
+		users.POST("/import-ndjson", guard.RequireRole(config.RoleEditor), userController.ImportUsers)
+		// Fake users for demos must not end up in production data
+		if !cfg.Server.Production() {
+			users.POST("/generate", guard.RequireRole(config.RoleEditor), userController.GenerateUsers)
+		}
+		users.PUT("/:id", guard.RequireRole(config.RoleEditor), userController.UpdateUser)
+		users.DELETE("/:id", guard.RequireRole(config.RoleAdmin), userController.DeleteUser)
+		users.POST("/:id/restore", guard.RequireRole(config.RoleAdmin), userController.RestoreUser)
+		users.POST("/:id/merge", guard.RequireRole(config.RoleAdmin), mergeController.MergeUsers)
+		users.POST("/:id/revert", guard.RequireRole(config.RoleEditor), userController.RevertUser)
+		if shareController != nil {
+			users.POST("/:id/share", guard.RequireRole(config.RoleEditor), shareController.ShareUser)
+		}
+		users.POST("/:id/suspend", guard.RequireRole(config.RoleAdmin), userController.SuspendUser)
+		users.POST("/:id/activate", guard.RequireRole(config.RoleAdmin), userController.ActivateUser)
+		users.POST("/:id/archive", guard.RequireRole(config.RoleAdmin), userController.ArchiveUser)
+		users.POST("/:id/follow/:targetId", guard.RequireRole(config.RoleEditor), followController.Follow)
+		users.DELETE("/:id/follow/:targetId", guard.RequireRole(config.RoleEditor), followController.Unfollow)
+		users.GET("/:id/followers", guard.RequireRole(config.RoleViewer), followController.GetFollowers)
+		users.GET("/:id/following", guard.RequireRole(config.RoleViewer), followController.GetFollowing)
+		users.GET("/:id/groups", guard.RequireRole(config.RoleViewer), groupController.GetUserGroups)
+		users.GET("/:id/avatar", guard.RequireRole(config.RoleViewer), avatarController.GetAvatar)
+		users.POST("/:id/avatar", guard.RequireRole(config.RoleEditor), avatarController.UploadAvatar)
+	}
+	// Groups belong to the tenant their members do
+	groupRoutes := func(groups *routeGroup) {
+		groups.Use(tenantScope)
+		groups.GET("", guard.RequireRole(config.RoleViewer), groupController.GetGroups)
+		groups.POST("", guard.RequireRole(config.RoleEditor), groupController.CreateGroup)
+		groups.GET("/:id", guard.RequireRole(config.RoleViewer), groupController.GetGroup)
+		groups.PUT("/:id", guard.RequireRole(config.RoleEditor), groupController.UpdateGroup)
+		groups.DELETE("/:id", guard.RequireRole(config.RoleAdmin), groupController.DeleteGroup)
+		groups.GET("/:id/members", guard.RequireRole(config.RoleViewer), groupController.GetMembers)
+		groups.POST("/:id/members/:userId", guard.RequireRole(config.RoleEditor), groupController.AddMember)
+		groups.DELETE("/:id/members/:userId", guard.RequireRole(config.RoleEditor), groupController.RemoveMember)
+	}
+
+	// Every API version is served by the same controllers; the version
+	// recorded on the request selects the representation they render. Links
+	// point below the base path, under BASE_URL when it is set.
+	linkBuilder := links.NewBuilder(cfg.Server.BaseURL + strings.TrimSuffix(opts.BasePath, "/"))
+	for _, version := range apiversion.Versions {
+		group := routes.Group("/api/"+version, apiversion.Middleware(version), csrf.Protect(), guard.Authenticate(),
+			limiter.Middleware(), links.Middleware(linkBuilder, cfg.Server.Links))
+		// The OpenAPI document describes v1
+		if services.Contract != nil && version == apiversion.V1 {
+			group.Use(services.Contract.Middleware())
+		}
+
+		// The users of a tenant are served under /tenants/:tenant/users as
+		// well as with the X-Tenant-ID header, and so are their groups and tags
+		userRoutes(group.Group("/users"))
+		groupRoutes(group.Group("/groups"))
+		group.GET("/tags", guard.RequireRole(config.RoleViewer), tenantScope, cached, userController.GetTags)
+		if cfg.Tenancy.Enabled() {
+			userRoutes(group.Group("/tenants/:" + tenant.Param + "/users"))
+			groupRoutes(group.Group("/tenants/:" + tenant.Param + "/groups"))
+			group.GET("/tenants/:"+tenant.Param+"/tags", guard.RequireRole(config.RoleViewer), tenantScope, cached, userController.GetTags)
+
+			tenants := group.Group("/tenants", guard.RequireRole(config.RoleAdmin))
+			{
+				tenants.GET("", tenantController.ListTenants)
+				tenants.POST("", tenantController.CreateTenant)
+				tenants.GET("/:"+tenant.Param, tenantController.GetTenant)
+				tenants.PUT("/:"+tenant.Param, tenantController.UpdateTenant)
+				tenants.DELETE("/:"+tenant.Param, tenantController.DeactivateTenant)
+				tenants.POST("/:"+tenant.Param+"/activate", tenantController.ActivateTenant)
+			}
+		}
+
+		group.GET("/emojis", guard.RequireRole(config.RoleViewer), controllers.ListEmojis)
+		group.GET("/cluster/status", guard.RequireRole(config.RoleViewer), clusterController.Status)
+
+		webhooks := group.Group("/webhooks", guard.RequireRole(config.RoleAdmin))
+		{
+			webhooks.GET("", webhookController.ListWebhooks)
+			webhooks.POST("", webhookController.CreateWebhook)
+			webhooks.DELETE("/:id", webhookController.DeleteWebhook)
+		}
+
+		// Users register and log in without credentials, for the tokens the
+		// rest of the API accepts, so the routes are outside the guard
+		if services.Credentials != nil {
+			accounts := routes.Group("/api/"+version, apiversion.Middleware(version), csrf.Protect())
+			if services.Contract != nil && version == apiversion.V1 {
+				accounts.Use(services.Contract.Middleware())
+			}
+			authRoutes := func(endpoints *routeGroup) {
+				endpoints.Use(tenantScope)
+				endpoints.POST("/register", authController.Register)
+				endpoints.POST("/login", authController.Login)
+				endpoints.POST("/refresh", authController.Refresh)
+				endpoints.POST("/logout", authController.Logout)
+			}
+			authRoutes(accounts.Group("/auth"))
+			if cfg.Tenancy.Enabled() {
+				authRoutes(accounts.Group("/tenants/:" + tenant.Param + "/auth"))
+			}
+		}
+
+		// The admin API has its own credential instead of the user-facing
+		// authentication, and is only served when that is configured
+		if cfg.Auth.AdminToken != "" {
+			admin := routes.Group("/api/"+version+"/admin", apiversion.Middleware(version),
+				auth.AdminToken(cfg.Auth.AdminToken))
+			{
+				admin.GET("/stats", adminController.Stats)
+				admin.POST("/reset", adminController.Reset)
+				admin.POST("/reseed", adminController.Reseed)
+				admin.POST("/backup", backupController.CreateBackup)
+				if jobController != nil {
+					admin.GET("/jobs", jobController.ListJobs)
+					admin.POST("/jobs/retry", jobController.RetryJobs)
+					admin.GET("/jobs/:id", jobController.GetJob)
+					admin.DELETE("/jobs/:id", jobController.DiscardJob)
+					admin.POST("/jobs/:id/retry", jobController.RetryJob)
+				}
+				if signingKeyController != nil {
+					admin.GET("/signing-keys", signingKeyController.ListSigningKeys)
+					admin.POST("/signing-keys", signingKeyController.CreateSigningKey)
+					admin.POST("/signing-keys/:id/rotate", signingKeyController.RotateSigningKey)
+					admin.DELETE("/signing-keys/:id", signingKeyController.DeleteSigningKey)
+				}
+				if ldapController != nil {
+					admin.POST("/ldap-sync", ldapController.SyncLDAP)
+				}
+				admin.GET("/quotas", quotaController.GetQuotas)
+				admin.PUT("/quotas/rate-limit", quotaController.SetDefaultRateLimit)
+				admin.PUT("/quotas/keys/:name", quotaController.SetKeyRateLimit)
+				admin.DELETE("/quotas/keys/:name", quotaController.DeleteKeyRateLimit)
+				admin.GET("/metadata-schema", metadataController.GetSchema)
+				admin.PUT("/metadata-schema", metadataController.SetSchema)
+				admin.DELETE("/metadata-schema", metadataController.DeleteSchema)
+				if cfg.Tenancy.Enabled() {
+					admin.PUT("/quotas/tenants/:"+tenant.Param, quotaController.SetUserQuota)
+					admin.GET("/metadata-schema/tenants/:"+tenant.Param, metadataController.GetTenantSchema)
+					admin.PUT("/metadata-schema/tenants/:"+tenant.Param, metadataController.SetTenantSchema)
+					admin.DELETE("/metadata-schema/tenants/:"+tenant.Param, metadataController.DeleteTenantSchema)
+				}
+			}
+		}
+	}
+
+	routes.checkUsed()
+}
+
+// templateFiles lists the pages in dir along with the layout and partials
+// they are built from
+func templateFiles(dir string) []string {
+	var files []string
+	for _, pattern := range []string{"*.html", "layout/*.html", "partials/*.html"} {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		files = append(files, matches...)
+	}
+	return files
 }
@@ -0,0 +1,144 @@
+package api_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/api"
+	"userprofile-api/auth"
+	"userprofile-api/config"
+	"userprofile-api/cors"
+	"userprofile-api/events"
+	"userprofile-api/follow"
+	"userprofile-api/metadata"
+	"userprofile-api/repository"
+	"userprofile-api/webhook"
+	"userprofile-api/ws"
+)
+
+// protectedRoutes are the v1 routes guarded by a role, with the least role
+// each requires. The path of a request fills in the route's parameters, and
+// may ask for more than the route alone does, such as deleted users.
+var protectedRoutes = []struct {
+	route string
+	path  string
+	role  string
+}{
+	{"GET /api/v1/users", "/api/v1/users", config.RoleViewer},
+	{"GET /api/v1/users", "/api/v1/users?include_deleted=true", config.RoleAdmin},
+	{"GET /api/v1/users/stats", "/api/v1/users/stats", config.RoleViewer},
+	{"GET /api/v1/users/search", "/api/v1/users/search?q=ada", config.RoleViewer},
+	{"POST /api/v1/users/check-duplicates", "/api/v1/users/check-duplicates", config.RoleViewer},
+	{"GET /api/v1/users/:id", "/api/v1/users/1", config.RoleViewer},
+	{"GET /api/v1/users/:id/versions", "/api/v1/users/1/versions", config.RoleViewer},
+	{"GET /api/v1/users/by-email/:email", "/api/v1/users/by-email/ada@example.com", config.RoleViewer},
+	{"POST /api/v1/users", "/api/v1/users", config.RoleEditor},
+	{"POST /api/v1/users/import-ndjson", "/api/v1/users/import-ndjson", config.RoleEditor},
+	{"POST /api/v1/users/generate", "/api/v1/users/generate", config.RoleEditor},
+	{"PUT /api/v1/users/:id", "/api/v1/users/1", config.RoleEditor},
+	{"DELETE /api/v1/users/:id", "/api/v1/users/1", config.RoleAdmin},
+	{"POST /api/v1/users/:id/restore", "/api/v1/users/1/restore", config.RoleAdmin},
+	{"POST /api/v1/users/:id/merge", "/api/v1/users/1/merge", config.RoleAdmin},
+	{"POST /api/v1/users/:id/revert", "/api/v1/users/1/revert", config.RoleEditor},
+	{"POST /api/v1/users/:id/suspend", "/api/v1/users/1/suspend", config.RoleAdmin},
+	{"POST /api/v1/users/:id/activate", "/api/v1/users/1/activate", config.RoleAdmin},
+	{"POST /api/v1/users/:id/archive", "/api/v1/users/1/archive", config.RoleAdmin},
+	{"POST /api/v1/users/:id/follow/:targetId", "/api/v1/users/1/follow/2", config.RoleEditor},
+	{"DELETE /api/v1/users/:id/follow/:targetId", "/api/v1/users/1/follow/2", config.RoleEditor},
+	{"GET /api/v1/users/:id/followers", "/api/v1/users/1/followers", config.RoleViewer},
+	{"GET /api/v1/users/:id/following", "/api/v1/users/1/following", config.RoleViewer},
+	{"GET /api/v1/users/:id/groups", "/api/v1/users/1/groups", config.RoleViewer},
+	{"GET /api/v1/users/:id/avatar", "/api/v1/users/1/avatar", config.RoleViewer},
+	{"POST /api/v1/users/:id/avatar", "/api/v1/users/1/avatar", config.RoleEditor},
+	{"GET /api/v1/groups", "/api/v1/groups", config.RoleViewer},
+	{"POST /api/v1/groups", "/api/v1/groups", config.RoleEditor},
+	{"GET /api/v1/groups/:id", "/api/v1/groups/1", config.RoleViewer},
+	{"PUT /api/v1/groups/:id", "/api/v1/groups/1", config.RoleEditor},
+	{"DELETE /api/v1/groups/:id", "/api/v1/groups/1", config.RoleAdmin},
+	{"GET /api/v1/groups/:id/members", "/api/v1/groups/1/members", config.RoleViewer},
+	{"POST /api/v1/groups/:id/members/:userId", "/api/v1/groups/1/members/2", config.RoleEditor},
+	{"DELETE /api/v1/groups/:id/members/:userId", "/api/v1/groups/1/members/2", config.RoleEditor},
+	{"GET /api/v1/tags", "/api/v1/tags", config.RoleViewer},
+	{"GET /api/v1/emojis", "/api/v1/emojis", config.RoleViewer},
+	{"GET /api/v1/cluster/status", "/api/v1/cluster/status", config.RoleViewer},
+	{"GET /api/v1/webhooks", "/api/v1/webhooks", config.RoleAdmin},
+	{"POST /api/v1/webhooks", "/api/v1/webhooks", config.RoleAdmin},
+	{"DELETE /api/v1/webhooks/:id", "/api/v1/webhooks/1", config.RoleAdmin},
+}
+
+// TestRoutesRequireTheirRole sends a request to every protected route with a
+// token of every role, checking that roles at least as privileged as the
+// route's reach it and the others are refused with 403. The handlers are
+// replaced by route middleware answering 200, which also fails the test for
+// routes that no longer exist.
+func TestRoutesRequireTheirRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("APP_ENV", "development")
+	t.Setenv("JWT_SECRET", "test-secret-test-secret-test-secret")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reached := func(c *gin.Context) { c.AbortWithStatus(http.StatusOK) }
+	routeMiddlewares := map[string][]gin.HandlerFunc{}
+	for _, r := range protectedRoutes {
+		routeMiddlewares[r.route] = []gin.HandlerFunc{reached}
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	schemas, err := metadata.New(cfg.Metadata, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	follows, err := follow.OpenStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := cors.New(cfg.CORS)
+	router := gin.New()
+	api.Mount(router, api.Options{
+		Config:     cfg,
+		Repository: repository.NewInMemoryUserRepository(nil),
+		Services: api.Services{
+			Events:   events.NewBus(),
+			Webhooks: webhook.NewRegistry(),
+			Hub:      ws.NewHub(policy, logger),
+			CORS:     policy,
+			Follows:  follows,
+			Groups:   repository.NewGroups(),
+			Metadata: schemas,
+		},
+		RouteMiddlewares: routeMiddlewares,
+	})
+
+	tokens := auth.NewJWTAuthenticator(cfg.Auth.JWT)
+	for _, r := range protectedRoutes {
+		method, _, _ := strings.Cut(r.route, " ")
+		for _, role := range config.Roles {
+			want := http.StatusForbidden
+			if slices.Index(config.Roles, role) >= slices.Index(config.Roles, r.role) {
+				want = http.StatusOK
+			}
+			t.Run(method+" "+r.path+" as "+role, func(t *testing.T) {
+				token, _, err := tokens.Issue("tester", "", "", []string{role}, time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req := httptest.NewRequest(method, r.path, nil)
+				req.Header.Set("Authorization", "Bearer "+token)
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				if rec.Code != want {
+					t.Errorf("status %d, want %d: %s", rec.Code, want, rec.Body)
+				}
+			})
+		}
+	}
+}
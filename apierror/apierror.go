@@ -0,0 +1,137 @@
+package apierror
+
+import (
+	"encoding/xml"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apiversion"
+	"userprofile-api/envelope"
+	"userprofile-api/i18n"
+	"userprofile-api/jsonapi"
+	"userprofile-api/negotiate"
+	"userprofile-api/repository"
+	"userprofile-api/requestid"
+)
+
+// Machine-readable error codes returned in the code field
+const (
+	CodeInvalidRequestBody      = "INVALID_REQUEST_BODY"
+	CodeInvalidQueryParameter   = "INVALID_QUERY_PARAMETER"
+	CodeUserNotFound            = "USER_NOT_FOUND"
+	CodeVersionNotFound         = "VERSION_NOT_FOUND"
+	CodeUserAlreadyExists       = "USER_ALREADY_EXISTS"
+	CodeEmailAlreadyInUse       = "EMAIL_ALREADY_IN_USE"
+	CodeAvatarNotFound          = "AVATAR_NOT_FOUND"
+	CodeWebhookNotFound         = "WEBHOOK_NOT_FOUND"
+	CodeSigningKeyNotFound      = "SIGNING_KEY_NOT_FOUND"
+	CodeJobNotFound             = "JOB_NOT_FOUND"
+	CodeJobNotFailed            = "JOB_NOT_FAILED"
+	CodeCannotFollowSelf        = "CANNOT_FOLLOW_SELF"
+	CodeCannotMergeSelf         = "CANNOT_MERGE_SELF"
+	CodeAlreadyFollowing        = "ALREADY_FOLLOWING"
+	CodeNotFollowing            = "NOT_FOLLOWING"
+	CodeGroupNotFound           = "GROUP_NOT_FOUND"
+	CodeGroupAlreadyExists      = "GROUP_ALREADY_EXISTS"
+	CodeAlreadyMember           = "ALREADY_MEMBER"
+	CodeNotMember               = "NOT_MEMBER"
+	CodeMetadataSchemaNotSet    = "METADATA_SCHEMA_NOT_SET"
+	CodeInvalidStatusTransition = "INVALID_STATUS_TRANSITION"
+	CodeInvalidAvatar           = "INVALID_AVATAR"
+	CodeAvatarTooLarge          = "AVATAR_TOO_LARGE"
+	CodePreconditionFailed      = "PRECONDITION_FAILED"
+	CodePreconditionRequired    = "PRECONDITION_REQUIRED"
+	CodeUnauthorized            = "UNAUTHORIZED"
+	CodeForbidden               = "FORBIDDEN"
+	CodeInvalidCredentials      = "INVALID_CREDENTIALS"
+	CodeRequestReplayed         = "REQUEST_REPLAYED"
+	CodeRequestTooLarge         = "REQUEST_TOO_LARGE"
+	CodeWeakPassword            = "WEAK_PASSWORD"
+	CodeInvalidTenant           = "INVALID_TENANT"
+	CodeTenantNotFound          = "TENANT_NOT_FOUND"
+	CodeTenantAlreadyExists     = "TENANT_ALREADY_EXISTS"
+	CodeTenantInactive          = "TENANT_INACTIVE"
+	CodeUserQuotaExceeded       = "USER_QUOTA_EXCEEDED"
+	CodeRateLimitExceeded       = "RATE_LIMIT_EXCEEDED"
+	CodeContractViolation       = "CONTRACT_VIOLATION"
+	CodeCSRFTokenInvalid        = "CSRF_TOKEN_INVALID"
+	CodeReadOnlyReplica         = "READ_ONLY_REPLICA"
+	CodeRouteNotFound           = "ROUTE_NOT_FOUND"
+	CodeMethodNotAllowed        = "METHOD_NOT_ALLOWED"
+	CodeStorageUnavailable      = "STORAGE_UNAVAILABLE"
+	CodeLDAPSyncFailed          = "LDAP_SYNC_FAILED"
+	CodeInternal                = "INTERNAL_ERROR"
+)
+
+// Error is the body returned for every failed API request
+type Error struct {
+	XMLName   xml.Name `json:"-" yaml:"-" xml:"error"`
+	Code      string   `json:"code" xml:"code" yaml:"code"`
+	Message   string   `json:"message" xml:"message" yaml:"message"`
+	Details   any      `json:"details,omitempty" xml:"details,omitempty" yaml:"details,omitempty"`
+	RequestID string   `json:"requestId,omitempty" xml:"requestId,omitempty" yaml:"requestId,omitempty"`
+}
+
+// Respond writes an error response with the given status and code, in the
+// format the client accepts. Clients accepting JSON:API get an errors
+// document, and requests marked by ProblemDetails RFC 7807 problem details;
+// otherwise v2 requests get the error inside the response envelope. The message is served in the language of the request, as
+// i18n.Middleware picked it; the code never changes.
+func Respond(c *gin.Context, status int, code, message string, details any) {
+	message = i18n.T(c, message)
+	i18n.Localized(c)
+	if jsonapi.Accepts(c) {
+		negotiate.VaryAccept(c.Writer.Header())
+		jsonapi.Render(c, status, jsonapi.NewErrorDocument(c, status, code, title(c, code), message, details))
+		return
+	}
+	if c.GetBool(problemKey) {
+		respondWithProblem(c, NewProblem(c, status, code, message, details))
+		return
+	}
+	if apiversion.From(c) != apiversion.V1 {
+		negotiate.Render(c, status, envelope.Failure(c, envelope.Error{Code: code, Message: message, Details: details}))
+		return
+	}
+	negotiate.Render(c, status, Error{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: requestid.Get(c),
+	})
+}
+
+// Abort writes an error response and stops the remaining handlers, for use
+// from middleware
+func Abort(c *gin.Context, status int, code, message string, details any) {
+	Respond(c, status, code, message, details)
+	c.Abort()
+}
+
+// Internal responds with a 500 without leaking the underlying error, or with
+// a 503 and a Retry-After header when the storage backend is unavailable
+func Internal(c *gin.Context, err error) {
+	var unavailableErr *repository.UnavailableError
+	if errors.As(err, &unavailableErr) {
+		retryAfter := int(math.Ceil(unavailableErr.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		Respond(c, http.StatusServiceUnavailable, CodeStorageUnavailable, "User storage is unavailable; retry later",
+			gin.H{"retryAfterSeconds": retryAfter})
+		return
+	}
+	c.Error(err)
+	Respond(c, http.StatusInternalServerError, CodeInternal, "An internal error occurred", nil)
+}
+
+// NoRoute handles requests that match no route
+func NoRoute(c *gin.Context) {
+	Respond(c, http.StatusNotFound, CodeRouteNotFound, "Route not found", gin.H{"path": c.Request.URL.Path})
+}
+
+// NoMethod handles requests whose path matches a route but not the method
+func NoMethod(c *gin.Context) {
+	Respond(c, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed", gin.H{"method": c.Request.Method})
+}
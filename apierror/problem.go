@@ -0,0 +1,108 @@
+package apierror
+
+import (
+	"encoding/xml"
+	"mime"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/i18n"
+	"userprofile-api/negotiate"
+	"userprofile-api/requestid"
+)
+
+// Media types of RFC 7807 problem details
+const (
+	ProblemJSONContentType = "application/problem+json"
+	ProblemXMLContentType  = "application/problem+xml"
+)
+
+// problemKey is the gin context key marking requests answered with problem
+// details
+const problemKey = "problemDetails"
+
+// Problem is an error in the RFC 7807 problem details format. The error code,
+// details and request ID are kept as extension members.
+type Problem struct {
+	XMLName xml.Name `json:"-" yaml:"-" xml:"urn:ietf:rfc:7807 problem"`
+	// Type identifies the kind of problem, e.g. /problems/user-not-found
+	Type string `json:"type" xml:"type" yaml:"type"`
+	// Title summarizes the kind of problem and is the same for every
+	// occurrence of it
+	Title  string `json:"title" xml:"title" yaml:"title"`
+	Status int    `json:"status" xml:"status" yaml:"status"`
+	// Detail explains this occurrence of the problem
+	Detail string `json:"detail,omitempty" xml:"detail,omitempty" yaml:"detail,omitempty"`
+	// Instance is the URI of the request that failed
+	Instance  string `json:"instance,omitempty" xml:"instance,omitempty" yaml:"instance,omitempty"`
+	Code      string `json:"code" xml:"code" yaml:"code"`
+	Details   any    `json:"details,omitempty" xml:"details,omitempty" yaml:"details,omitempty"`
+	RequestID string `json:"requestId,omitempty" xml:"requestId,omitempty" yaml:"requestId,omitempty"`
+}
+
+// NewProblem builds the problem details of a failed request. The type and
+// title are derived from the code, so USER_NOT_FOUND becomes
+// /problems/user-not-found and "User not found", the title then being served
+// in the language of the request.
+func NewProblem(c *gin.Context, status int, code, message string, details any) Problem {
+	words := strings.ToLower(strings.ReplaceAll(code, "_", " "))
+	return Problem{
+		Type:      "/problems/" + strings.ReplaceAll(words, " ", "-"),
+		Title:     title(c, code),
+		Status:    status,
+		Detail:    message,
+		Instance:  c.Request.URL.RequestURI(),
+		Code:      code,
+		Details:   details,
+		RequestID: requestid.Get(c),
+	}
+}
+
+// title summarizes the kind of error a code stands for, in the language of
+// the request, so USER_NOT_FOUND becomes "User not found"
+func title(c *gin.Context, code string) string {
+	words := strings.ToLower(strings.ReplaceAll(code, "_", " "))
+	if words == "" {
+		return words
+	}
+	return i18n.T(c, strings.ToUpper(words[:1])+words[1:])
+}
+
+// ProblemDetails marks requests whose errors are answered with problem
+// details: every request when always is set, or those accepting a problem
+// details media type. It must be installed on the engine so that it also
+// runs for unknown routes.
+func ProblemDetails(always bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if always || AcceptsProblem(c) {
+			c.Set(problemKey, true)
+		}
+		c.Next()
+	}
+}
+
+// AcceptsProblem reports whether the Accept header lists a problem details
+// media type
+func AcceptsProblem(c *gin.Context) bool {
+	for _, accepted := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(accepted)
+		if err == nil && (mediaType == ProblemJSONContentType || mediaType == ProblemXMLContentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// respondWithProblem writes problem details as XML when the client prefers
+// XML, and as JSON otherwise
+func respondWithProblem(c *gin.Context, problem Problem) {
+	negotiate.VaryAccept(c.Writer.Header())
+	switch c.NegotiateFormat(ProblemJSONContentType, ProblemXMLContentType, gin.MIMEXML, gin.MIMEXML2) {
+	case ProblemXMLContentType, gin.MIMEXML, gin.MIMEXML2:
+		c.Header("Content-Type", ProblemXMLContentType)
+		c.XML(problem.Status, problem)
+	default:
+		c.Header("Content-Type", ProblemJSONContentType)
+		c.JSON(problem.Status, problem)
+	}
+}
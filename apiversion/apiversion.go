@@ -0,0 +1,49 @@
+package apiversion
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Supported API versions, oldest first. Each is served under /api/<version>.
+const (
+	V1 = "v1"
+	V2 = "v2"
+)
+
+// Versions lists every supported API version
+var Versions = []string{V1, V2}
+
+// Header reports the API version that produced a response
+const Header = "API-Version"
+
+// contextKey is the gin context key holding the request's API version
+const contextKey = "apiVersion"
+
+// Middleware records the API version of a route group on its requests, so
+// shared controllers can render the version's representation
+func Middleware(version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(contextKey, version)
+		c.Header(Header, version)
+		c.Next()
+	}
+}
+
+// From returns the request's API version. Requests that reached no
+// versioned group, such as unknown routes, are matched by path prefix, and
+// the remaining ones, such as the HTML home page, get V1.
+func From(c *gin.Context) string {
+	if version, ok := c.Get(contextKey); ok {
+		if s, ok := version.(string); ok {
+			return s
+		}
+	}
+	for _, version := range Versions {
+		if strings.HasPrefix(c.Request.URL.Path, "/api/"+version+"/") {
+			return version
+		}
+	}
+	return V1
+}
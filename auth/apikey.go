@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"net/http"
+
+	"userprofile-api/config"
+)
+
+// APIKeyHeader is the request header carrying the API key
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyAuthenticator checks the X-API-Key header against a configured key set
+type APIKeyAuthenticator struct {
+	// keys is indexed by the SHA-256 of the key so lookups don't compare the
+	// secret byte by byte
+	keys map[[sha256.Size]byte]config.APIKey
+}
+
+// NewAPIKeyAuthenticator creates an authenticator accepting the given keys
+func NewAPIKeyAuthenticator(keys []config.APIKey) *APIKeyAuthenticator {
+	a := &APIKeyAuthenticator{keys: make(map[[sha256.Size]byte]config.APIKey, len(keys))}
+	for _, key := range keys {
+		a.keys[sha256.Sum256([]byte(key.Key))] = key
+	}
+	return a
+}
+
+// Authenticate accepts requests whose API key is known and grants the scope
+// needed for the HTTP method
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	provided := r.Header.Get(APIKeyHeader)
+	if provided == "" {
+		return Principal{}, ErrNoCredentials
+	}
+
+	key, ok := a.keys[sha256.Sum256([]byte(provided))]
+	if !ok {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	scope := RequiredScope(r.Method)
+	if !key.HasScope(scope) {
+		return Principal{}, &ScopeError{Required: scope}
+	}
+
+	return Principal{Name: key.Name, Scopes: key.Scopes, Roles: apiKeyRoles(key)}, nil
+}
+
+// apiKeyRoles returns the key's explicit roles, or derives them from its scopes
+func apiKeyRoles(key config.APIKey) []string {
+	if len(key.Roles) > 0 {
+		return key.Roles
+	}
+	switch {
+	case key.HasScope(config.ScopeWrite):
+		return []string{config.RoleEditor}
+	case key.HasScope(config.ScopeRead):
+		return []string{config.RoleViewer}
+	default:
+		return nil
+	}
+}
+
+// RequiredScope returns the scope needed to call an endpoint with the method:
+// safe methods need read, everything else needs write
+func RequiredScope(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return config.ScopeRead
+	default:
+		return config.ScopeWrite
+	}
+}
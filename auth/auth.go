@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/config"
+)
+
+// principalKey is the gin context key holding the authenticated caller
+const principalKey = "principal"
+
+// principalContextKey is the context key holding the authenticated caller
+type principalContextKey struct{}
+
+var (
+	// ErrNoCredentials is returned by an Authenticator when the request does
+	// not carry the kind of credentials it handles
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned when credentials are present but
+	// not valid
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// ScopeError is returned when valid credentials lack the scope a request needs
+type ScopeError struct {
+	Required string
+}
+
+func (e *ScopeError) Error() string {
+	return "credentials do not grant the " + e.Required + " scope"
+}
+
+// ReplayError is returned for signed requests that may be replays of earlier
+// ones: those whose timestamp is too far from the server's clock, and those
+// whose nonce was already used
+type ReplayError struct {
+	Reason string
+}
+
+func (e *ReplayError) Error() string {
+	return "request rejected as a possible replay: " + e.Reason
+}
+
+// Principal identifies the authenticated caller of a request
+type Principal struct {
+	// Name identifies the caller, e.g. the API key name or JWT subject
+	Name string
+	// Scopes lists what an API key may do
+	Scopes []string
+	// Roles lists the caller's roles
+	Roles []string
+	// Tenant, when set, is the only tenant the caller may act in, "" being
+	// the default storage. The tokens of password accounts are bound to the
+	// tenant the user belongs to; API keys and other credentials of
+	// operators are not bound to any.
+	Tenant *string
+}
+
+// AllowsTenant reports whether the caller may act in the tenant with the
+// given ID, "" being the default storage
+func (p Principal) AllowsTenant(id string) bool {
+	return p.Tenant == nil || *p.Tenant == id
+}
+
+// HasScope reports whether the caller was granted the scope
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// HasRole reports whether any of the caller's roles is at least as
+// privileged as the required role
+func (p Principal) HasRole(required string) bool {
+	need := slices.Index(config.Roles, required)
+	for _, role := range p.Roles {
+		if slices.Index(config.Roles, role) >= need {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPrincipal records the authenticated caller on the request, and on its
+// context for code that is only passed the context
+func SetPrincipal(c *gin.Context, p Principal) {
+	c.Set(principalKey, p)
+	c.Request = c.Request.WithContext(NewContext(c.Request.Context(), p))
+}
+
+// PrincipalFrom returns the authenticated caller, if any
+func PrincipalFrom(c *gin.Context) (Principal, bool) {
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return Principal{}, false
+	}
+	p, ok := value.(Principal)
+	return p, ok
+}
+
+// NewContext returns a copy of ctx carrying the authenticated caller
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// FromContext returns the authenticated caller carried by ctx, if any
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(Principal)
+	return p, ok
+}
+
+// Authenticator validates one kind of credentials on a request
+type Authenticator interface {
+	// Authenticate returns the caller, ErrNoCredentials when the request
+	// carries none of this authenticator's credentials, or another error
+	// when they are rejected
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+// Guard authenticates callers and enforces role requirements. A Guard with
+// no authenticators lets every request through, so the API stays usable
+// when no credentials are configured.
+type Guard struct {
+	authenticators []Authenticator
+}
+
+// NewGuard creates a Guard for the configured authentication methods, trying
+// the extra authenticators first
+func NewGuard(cfg config.AuthConfig, extra ...Authenticator) *Guard {
+	g := &Guard{authenticators: slices.Clone(extra)}
+	if cfg.JWT.Secret != "" {
+		g.authenticators = append(g.authenticators, NewJWTAuthenticator(cfg.JWT))
+	}
+	if len(cfg.APIKeys) > 0 {
+		g.authenticators = append(g.authenticators, NewAPIKeyAuthenticator(cfg.APIKeys))
+	}
+	return g
+}
+
+// RejectRevoked makes the guard reject bearer tokens for which revoked
+// reports true, such as those of sessions that were logged out
+func (g *Guard) RejectRevoked(revoked func(*Claims) bool) {
+	for _, authenticator := range g.authenticators {
+		if jwtAuthenticator, ok := authenticator.(*JWTAuthenticator); ok {
+			jwtAuthenticator.RejectRevoked(revoked)
+		}
+	}
+}
+
+// Enabled reports whether any authentication method is configured
+func (g *Guard) Enabled() bool {
+	return len(g.authenticators) > 0
+}
+
+// Identify returns the caller using the first authenticator whose
+// credentials are present on the request. It returns ErrNoCredentials when
+// none are, a *ScopeError when valid credentials lack the required scope, or
+// another error when the credentials are rejected.
+func (g *Guard) Identify(r *http.Request) (Principal, error) {
+	for _, authenticator := range g.authenticators {
+		principal, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return principal, err
+	}
+	return Principal{}, ErrNoCredentials
+}
+
+// Authenticate returns middleware that identifies the caller using the first
+// authenticator whose credentials are present on the request
+func (g *Guard) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !g.Enabled() {
+			c.Next()
+			return
+		}
+
+		principal, err := g.Identify(c.Request)
+		var scopeErr *ScopeError
+		var replayErr *ReplayError
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.Is(err, ErrNoCredentials):
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Missing credentials",
+				gin.H{"accepted": []string{"Authorization: Bearer <token>", APIKeyHeader}})
+		case errors.As(err, &scopeErr):
+			apierror.Abort(c, http.StatusForbidden, apierror.CodeForbidden,
+				"Credentials do not grant the required scope", gin.H{"requiredScope": scopeErr.Required})
+		case errors.As(err, &replayErr):
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeRequestReplayed,
+				"Request rejected as a possible replay", gin.H{"reason": replayErr.Reason})
+		case errors.As(err, &tooLarge):
+			apierror.Abort(c, http.StatusRequestEntityTooLarge, apierror.CodeRequestTooLarge,
+				"Request body is too large", gin.H{"maxBytes": tooLarge.Limit})
+		case err != nil:
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid credentials", nil)
+		default:
+			SetPrincipal(c, principal)
+			c.Next()
+		}
+	}
+}
+
+// RequireRole returns middleware that allows the request only when the
+// authenticated caller has at least the given role
+func (g *Guard) RequireRole(role string) gin.HandlerFunc {
+	return g.RequireRoleIf(role, func(*gin.Context) bool { return true })
+}
+
+// RequireRoleIf is like RequireRole but only enforces the role on requests
+// for which cond returns true, e.g. when a privileged query parameter is set
+func (g *Guard) RequireRoleIf(role string, cond func(c *gin.Context) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !g.Enabled() || !cond(c) {
+			c.Next()
+			return
+		}
+
+		principal, ok := PrincipalFrom(c)
+		if !ok || !principal.HasRole(role) {
+			apierror.Abort(c, http.StatusForbidden, apierror.CodeForbidden,
+				"Your role does not allow this operation", gin.H{"requiredRole": role})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"userprofile-api/config"
+)
+
+// Claims are the JWT claims understood by the API
+type Claims struct {
+	jwt.RegisteredClaims
+	// Roles lists the caller's roles, e.g. ["editor"]
+	Roles []string `json:"roles"`
+	// SessionID names the login session the token was issued for, if any,
+	// which can be revoked before the token expires
+	SessionID string `json:"sid,omitempty"`
+	// Tenant binds the token to the tenant its subject belongs to, "" being
+	// the default storage; tokens without the claim are not bound to one
+	Tenant *string `json:"tenant,omitempty"`
+}
+
+// JWTAuthenticator validates HS256-signed bearer tokens
+type JWTAuthenticator struct {
+	secret   []byte
+	issuer   string
+	audience string
+	parser   *jwt.Parser
+	// revoked, when set, rejects tokens that were revoked before expiring
+	revoked func(*Claims) bool
+}
+
+// NewJWTAuthenticator creates an authenticator for the configured secret,
+// issuer and audience
+func NewJWTAuthenticator(cfg config.JWTConfig) *JWTAuthenticator {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+	return &JWTAuthenticator{
+		secret:   []byte(cfg.Secret),
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		parser:   jwt.NewParser(options...),
+	}
+}
+
+// Authenticate accepts requests with a valid "Authorization: Bearer" token
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return Principal{}, ErrNoCredentials
+	}
+
+	claims, err := a.Parse(token)
+	if err != nil || (a.revoked != nil && a.revoked(claims)) {
+		return Principal{}, ErrInvalidCredentials
+	}
+	return Principal{Name: claims.Subject, Roles: claims.Roles, Tenant: claims.Tenant}, nil
+}
+
+// Parse validates a token and returns its claims
+func (a *JWTAuthenticator) Parse(token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := a.parser.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return a.secret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// RejectRevoked makes Authenticate reject the tokens for which revoked
+// reports true
+func (a *JWTAuthenticator) RejectRevoked(revoked func(*Claims) bool) {
+	a.revoked = revoked
+}
+
+// Issue signs a token for subject, a user of tenant, with the given roles,
+// issued for the given login session, which expires after ttl. The token is
+// bound to tenant, "" being the default storage. It carries the configured
+// issuer and audience, so Authenticate accepts it.
+func (a *JWTAuthenticator) Issue(subject, tenant, sessionID string, roles []string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(ttl)
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			Issuer:    a.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+		Roles:     roles,
+		SessionID: sessionID,
+		Tenant:    &tenant,
+	}
+	if a.audience != "" {
+		claims.Audience = jwt.ClaimStrings{a.audience}
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.secret)
+	return token, expires, err
+}
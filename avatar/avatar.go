@@ -0,0 +1,115 @@
+package avatar
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for the accepted upload types
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"slices"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"userprofile-api/config"
+)
+
+// ContentType is the type every stored avatar is re-encoded to
+const ContentType = "image/png"
+
+// maxPixels guards against decompression bombs: images whose header claims
+// huge dimensions are rejected before they are decoded
+const maxPixels = 50_000_000
+
+// AcceptedTypes lists the upload content types Process accepts
+var AcceptedTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+var (
+	// ErrNotFound is returned by a Store when no avatar is stored under a key
+	ErrNotFound = errors.New("avatar not found")
+	// ErrUnsupportedType is returned by Process for data that is not an
+	// image in one of the AcceptedTypes
+	ErrUnsupportedType = errors.New("unsupported image type")
+)
+
+// Store persists processed avatar images
+type Store interface {
+	// Put stores the image under key, replacing any previous one
+	Put(ctx context.Context, key string, data []byte) error
+	// Get opens the image stored under key, or returns ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// NewStore creates the Store selected by the configuration
+func NewStore(cfg config.AvatarConfig) Store {
+	switch cfg.Storage {
+	case config.AvatarStorageS3:
+		return NewS3Store(cfg.S3)
+	default:
+		return NewDiskStore(cfg.Dir)
+	}
+}
+
+// Key returns the storage key for the avatar of a user of tenant, which is
+// empty for the default storage. User IDs are client supplied, so they are
+// hashed rather than used as file or object names.
+func Key(tenant, userID string) string {
+	if tenant != "" {
+		userID = tenant + "/" + userID
+	}
+	sum := sha256.Sum256([]byte(userID))
+	return hex.EncodeToString(sum[:]) + ".png"
+}
+
+// Process validates an uploaded image, scales it down to fit within
+// size×size pixels and re-encodes it as PNG
+func Process(data []byte, size int) ([]byte, error) {
+	contentType := http.DetectContentType(data)
+	if !slices.Contains(AcceptedTypes, contentType) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, fmt.Errorf("%w: image is %dx%d pixels", ErrUnsupportedType, cfg.Width, cfg.Height)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, fit(src, size)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fit scales img down, keeping its aspect ratio, so that neither side exceeds
+// size. Smaller images are returned unchanged.
+func fit(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	if w >= h {
+		w, h = size, max(h*size/w, 1)
+	} else {
+		w, h = max(w*size/h, 1), size
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	return dst
+}
@@ -0,0 +1,52 @@
+package avatar
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DiskStore keeps avatars as files in a local directory
+type DiskStore struct {
+	dir string
+}
+
+// NewDiskStore creates a store in dir. The directory is created on the
+// first upload.
+func NewDiskStore(dir string) *DiskStore {
+	return &DiskStore{dir: dir}
+}
+
+// Put writes the image to a temporary file and renames it into place, so
+// readers never see a partially written avatar
+func (s *DiskStore) Put(_ context.Context, key string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, key))
+}
+
+// Get opens the stored image
+func (s *DiskStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(s.dir, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
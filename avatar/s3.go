@@ -0,0 +1,65 @@
+package avatar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"userprofile-api/config"
+)
+
+// S3Store keeps avatars as objects in an S3-compatible bucket
+type S3Store struct {
+	client *s3.Client
+	bucket string
+}
+
+// NewS3Store creates a store for the configured bucket
+func NewS3Store(cfg config.S3Config) *S3Store {
+	client := s3.New(s3.Options{
+		Region:       cfg.Region,
+		Credentials:  credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		UsePathStyle: cfg.PathStyle,
+		// Checksums are only sent when an operation requires them, as not
+		// every S3-compatible service supports the SDK's default ones
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+		ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+	}, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	})
+	return &S3Store{client: client, bucket: cfg.Bucket}
+}
+
+// Put uploads the image, replacing any previous object
+func (s *S3Store) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(ContentType),
+	})
+	return err
+}
+
+// Get downloads the image; the caller must close the returned body
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	var missing *types.NoSuchKey
+	if errors.As(err, &missing) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
@@ -0,0 +1,187 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"userprofile-api/config"
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+// nameLayout timestamps backup names to the millisecond, so that names sort
+// in the order the backups were taken
+const nameLayout = "20060102T150405.000Z"
+
+// JobKind is the kind of the background jobs taking scheduled backups
+const JobKind = "backup"
+
+// backupTimeout bounds a scheduled backup, including pruning old ones
+const backupTimeout = 5 * time.Minute
+
+// Snapshot describes a backup that was just taken
+type Snapshot struct {
+	XMLName   struct{}  `json:"-" yaml:"-" xml:"backup"`
+	Name      string    `json:"name" xml:"name" yaml:"name"`
+	Users     int       `json:"users" xml:"users" yaml:"users"`
+	Bytes     int       `json:"bytes" xml:"bytes" yaml:"bytes"`
+	CreatedAt time.Time `json:"createdAt" xml:"createdAt" yaml:"createdAt"`
+}
+
+// Manager takes backups of a repository, on demand or on a schedule, and
+// removes old ones according to the retention policy. A backup is a JSON
+// array of every user, deleted ones included, in the format of the json
+// storage backend's file.
+type Manager struct {
+	repo   repository.UserRepository
+	store  Store
+	cfg    config.BackupConfig
+	logger *slog.Logger
+
+	// mu keeps on-demand and scheduled backups from running concurrently
+	mu sync.Mutex
+}
+
+// New creates a manager backing up repo to store
+func New(repo repository.UserRepository, store Store, cfg config.BackupConfig, logger *slog.Logger) *Manager {
+	return &Manager{repo: repo, store: store, cfg: cfg, logger: logger}
+}
+
+// HandleJob takes a scheduled backup. It is the handler of JobKind jobs.
+func (m *Manager) HandleJob(ctx context.Context, _ models.Job) error {
+	ctx, cancel := context.WithTimeout(ctx, backupTimeout)
+	defer cancel()
+	snapshot, err := m.Create(ctx)
+	if err != nil {
+		m.logger.Error("Scheduled backup failed", "error", err)
+		return err
+	}
+	m.logger.Info("Backed up users", "name", snapshot.Name, "users", snapshot.Users)
+	return nil
+}
+
+// Create takes a backup now and then applies the retention policy. Failing
+// to remove old backups is logged rather than returned, since the new
+// backup was stored.
+func (m *Manager) Create(ctx context.Context) (Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users, _, err := m.repo.List(ctx, repository.ListOptions{IncludeDeleted: true})
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("read users: %w", err)
+	}
+	if users == nil {
+		users = []models.UserProfile{}
+	}
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return Snapshot{}, err
+	}
+	data = append(data, '\n')
+
+	now := time.Now().UTC()
+	snapshot := Snapshot{
+		Name:      "users-" + now.Format(nameLayout) + ".json",
+		Users:     len(users),
+		Bytes:     len(data),
+		CreatedAt: now,
+	}
+	if err := m.store.Put(ctx, snapshot.Name, data); err != nil {
+		return Snapshot{}, fmt.Errorf("store backup %s: %w", snapshot.Name, err)
+	}
+
+	if err := m.prune(ctx, now); err != nil {
+		m.logger.Warn("Failed to remove old backups", "error", err)
+	}
+	return snapshot, nil
+}
+
+// List returns the names of the stored backups, oldest first
+func (m *Manager) List(ctx context.Context) ([]string, error) {
+	names, err := m.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names = slices.DeleteFunc(names, func(name string) bool {
+		_, ok := CreatedAt(name)
+		return !ok
+	})
+	slices.Sort(names)
+	return names, nil
+}
+
+// Load reads the users in the named backup
+func (m *Manager) Load(ctx context.Context, name string) ([]models.UserProfile, error) {
+	if _, ok := CreatedAt(name); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	body, err := m.store.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	users, err := Read(body)
+	if err != nil {
+		return nil, fmt.Errorf("backup %s: %w", name, err)
+	}
+	return users, nil
+}
+
+// prune removes the backups beyond the newest Keep and those older than
+// MaxAge
+func (m *Manager) prune(ctx context.Context, now time.Time) error {
+	names, err := m.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i, name := range names {
+		excess := m.cfg.Keep > 0 && i < len(names)-m.cfg.Keep
+		createdAt, _ := CreatedAt(name)
+		expired := m.cfg.MaxAge > 0 && now.Sub(createdAt) > m.cfg.MaxAge
+		if !excess && !expired {
+			continue
+		}
+		if err := m.store.Delete(ctx, name); err != nil {
+			errs = append(errs, fmt.Errorf("delete backup %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CreatedAt returns when the named backup was taken, or false if the name
+// is not that of a backup
+func CreatedAt(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, "users-")
+	if !ok {
+		return time.Time{}, false
+	}
+	stamp, ok = strings.CutSuffix(stamp, ".json")
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(nameLayout, stamp)
+	return t, err == nil
+}
+
+// Read decodes the users in a backup
+func Read(r io.Reader) ([]models.UserProfile, error) {
+	var users []models.UserProfile
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
@@ -0,0 +1,88 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+// RestoreResult counts the users a restore created and overwrote
+type RestoreResult struct {
+	Created int
+	Updated int
+}
+
+// Restore makes every user in a backup match it: missing users are
+// created, existing ones are overwritten and undeleted or deleted as in the
+// backup, and avatar locations are put back. Users that are not in the
+// backup are left alone. The repository maintains versions and timestamps,
+// so those are not restored. Users are restored one at a time; failures,
+// such as an email now held by another user, are collected and returned
+// after the rest have been restored.
+func Restore(ctx context.Context, repo repository.UserRepository, users []models.UserProfile) (RestoreResult, error) {
+	var result RestoreResult
+	var errs []error
+	for _, user := range users {
+		created, err := restoreUser(ctx, repo, user)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("restore user %s: %w", user.ID, err))
+			continue
+		}
+		if created {
+			result.Created++
+		} else {
+			result.Updated++
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+// restoreUser applies one backed up user, reporting whether it was created
+func restoreUser(ctx context.Context, repo repository.UserRepository, backedUp models.UserProfile) (bool, error) {
+	fields := models.UserProfile{
+		ID:        backedUp.ID,
+		FullName:  backedUp.FullName,
+		Emoji:     backedUp.Emoji,
+		Email:     backedUp.Email,
+		Bio:       backedUp.Bio,
+		Location:  backedUp.Location,
+		Tags:      backedUp.Tags,
+		Metadata:  backedUp.Metadata,
+		Status:    backedUp.Status,
+		ExpiresAt: backedUp.ExpiresAt,
+	}
+
+	created := false
+	current, err := repo.Get(ctx, backedUp.ID)
+	switch {
+	case err == nil:
+		current, err = repo.Update(ctx, backedUp.ID, fields)
+	case errors.Is(err, repository.ErrNotFound):
+		current, err = repo.Create(ctx, fields)
+		created = err == nil
+		if errors.Is(err, repository.ErrConflict) && !errors.Is(err, repository.ErrEmailConflict) {
+			// The user exists but is deleted
+			if _, err = repo.Restore(ctx, backedUp.ID); err == nil {
+				current, err = repo.Update(ctx, backedUp.ID, fields)
+			}
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if current.AvatarURL != backedUp.AvatarURL {
+		if _, err := repo.SetAvatarURL(ctx, backedUp.ID, backedUp.AvatarURL); err != nil {
+			return false, err
+		}
+	}
+	if backedUp.DeletedAt != nil {
+		if err := repo.Delete(ctx, backedUp.ID); err != nil {
+			return false, err
+		}
+	}
+	return created, nil
+}
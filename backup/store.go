@@ -0,0 +1,201 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"userprofile-api/config"
+)
+
+// ErrNotFound is returned by a Store when no backup has the given name
+var ErrNotFound = errors.New("backup not found")
+
+// Store persists backup files
+type Store interface {
+	// Put stores a backup under name
+	Put(ctx context.Context, name string, data []byte) error
+	// Get opens the named backup, or returns ErrNotFound
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// List returns the names of the stored backups in no particular order
+	List(ctx context.Context) ([]string, error)
+	// Delete removes the named backup
+	Delete(ctx context.Context, name string) error
+}
+
+// NewStore creates the Store selected by the configuration
+func NewStore(cfg config.BackupConfig) Store {
+	switch cfg.Storage {
+	case config.BackupStorageS3:
+		return NewS3Store(cfg.S3, cfg.Prefix)
+	default:
+		return NewDiskStore(cfg.Dir)
+	}
+}
+
+// DiskStore keeps backups as files in a local directory
+type DiskStore struct {
+	dir string
+}
+
+// NewDiskStore creates a store in dir. The directory is created on the
+// first backup.
+func NewDiskStore(dir string) *DiskStore {
+	return &DiskStore{dir: dir}
+}
+
+// Put writes the backup to a temporary file and renames it into place, so
+// an interrupted backup never leaves a truncated file behind
+func (s *DiskStore) Put(_ context.Context, name string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+}
+
+// Get opens the backup file
+func (s *DiskStore) Get(_ context.Context, name string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// List returns the names of the files in the directory
+func (s *DiskStore) List(_ context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// Delete removes the backup file
+func (s *DiskStore) Delete(_ context.Context, name string) error {
+	err := os.Remove(filepath.Join(s.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// S3Store keeps backups as objects under a key prefix in an S3-compatible
+// bucket
+type S3Store struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// NewS3Store creates a store for the configured bucket
+func NewS3Store(cfg config.S3Config, prefix string) *S3Store {
+	client := s3.New(s3.Options{
+		Region:       cfg.Region,
+		Credentials:  credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		UsePathStyle: cfg.PathStyle,
+		// Only the checksums an operation requires are sent, as some
+		// S3-compatible services reject the others
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+		ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+	}, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	})
+	return &S3Store{client: client, bucket: cfg.Bucket, prefix: prefix}
+}
+
+// Put uploads the backup
+func (s *S3Store) Put(ctx context.Context, name string, data []byte) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.prefix + name),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+// Get downloads the backup; the caller must close the returned body
+func (s *S3Store) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+	})
+	var missing *types.NoSuchKey
+	if errors.As(err, &missing) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// List returns the names of the objects under the prefix, not counting
+// those in nested "directories"
+func (s *S3Store) List(ctx context.Context) ([]string, error) {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	})
+	var names []string
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			if name := strings.TrimPrefix(aws.ToString(object.Key), s.prefix); !strings.Contains(name, "/") {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// Delete removes the backup object. Deleting a missing object is not an
+// error.
+func (s *S3Store) Delete(ctx context.Context, name string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+	})
+	return err
+}
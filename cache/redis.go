@@ -0,0 +1,299 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"userprofile-api/config"
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+// redisTimeout bounds each cache round trip, so a slow Redis degrades to
+// uncached reads rather than slowing requests down
+const redisTimeout = 250 * time.Millisecond
+
+// keyPrefix namespaces the cache's keys in a shared Redis database
+const keyPrefix = "userprofile:"
+
+// generationKey holds a counter that every write increments. Entries are
+// keyed by the generation they were read at, so one write invalidates them
+// all, and a read racing a write cannot store an entry that outlives it.
+const generationKey = keyPrefix + "generation"
+
+// Lookup results recorded in the cache_requests_total metric
+const (
+	resultHit   = "hit"
+	resultMiss  = "miss"
+	resultError = "error"
+)
+
+// Repository caches Get and List results in Redis for a limited time and
+// invalidates them whenever a user is changed through it. Redis failures
+// are logged and fall back to the wrapped repository.
+type Repository struct {
+	repository.UserRepository
+	client   *redis.Client
+	ttl      time.Duration
+	logger   *slog.Logger
+	requests *prometheus.CounterVec
+}
+
+// Open connects to the configured Redis server and wraps next with a cache.
+// An unreachable server is reported but not fatal, since reads fall back to
+// the repository until it becomes available.
+func Open(cfg config.CacheConfig, next repository.UserRepository, logger *slog.Logger) (*Repository, error) {
+	options, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+
+	r := NewRepository(next, redis.NewClient(options), cfg.TTL, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := r.client.Ping(ctx).Err(); err != nil {
+		logger.Warn("Redis cache is unreachable; reads will go to the repository until it recovers", "error", err)
+	}
+	return r, nil
+}
+
+// NewRepository wraps next with a cache stored through client
+func NewRepository(next repository.UserRepository, client *redis.Client, ttl time.Duration, logger *slog.Logger) *Repository {
+	return &Repository{
+		UserRepository: next,
+		client:         client,
+		ttl:            ttl,
+		logger:         logger,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "userprofile",
+			Name:      "cache_requests_total",
+			Help:      "Number of cache lookups, by operation and result (hit, miss or error).",
+		}, []string{"operation", "result"}),
+	}
+}
+
+// Close disconnects from Redis; it does not close the wrapped repository
+func (r *Repository) Close() error {
+	return r.client.Close()
+}
+
+// Ping checks the wrapped repository, so readiness keeps reflecting the
+// storage backend rather than the cache
+func (r *Repository) Ping(ctx context.Context) error {
+	if pinger, ok := r.UserRepository.(repository.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// Describe implements prometheus.Collector, along with the wrapped
+// repository when it exports metrics too
+func (r *Repository) Describe(ch chan<- *prometheus.Desc) {
+	r.requests.Describe(ch)
+	if collector, ok := r.UserRepository.(prometheus.Collector); ok {
+		collector.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (r *Repository) Collect(ch chan<- prometheus.Metric) {
+	r.requests.Collect(ch)
+	if collector, ok := r.UserRepository.(prometheus.Collector); ok {
+		collector.Collect(ch)
+	}
+}
+
+// listPage is the cached form of a List result
+type listPage struct {
+	Users []models.UserProfile `json:"users"`
+	Total int                  `json:"total"`
+}
+
+func (r *Repository) List(ctx context.Context, opts repository.ListOptions) ([]models.UserProfile, int, error) {
+	// Every option affects the result, so all of them make up the key
+	encoded, err := json.Marshal(opts)
+	if err != nil {
+		return r.UserRepository.List(ctx, opts)
+	}
+	sum := sha256.Sum256(encoded)
+
+	var page listPage
+	key, hit := r.lookup(ctx, "list", "list:"+hex.EncodeToString(sum[:]), &page)
+	if hit {
+		return page.Users, page.Total, nil
+	}
+
+	users, total, err := r.UserRepository.List(ctx, opts)
+	if err == nil {
+		r.store(ctx, key, listPage{Users: users, Total: total})
+	}
+	return users, total, err
+}
+
+// Stream bypasses the cache, which would have to hold every streamed user
+func (r *Repository) Stream(ctx context.Context, opts repository.ListOptions, yield func(user models.UserProfile) error) error {
+	return repository.Stream(ctx, r.UserRepository, opts, yield)
+}
+
+func (r *Repository) Get(ctx context.Context, id string) (models.UserProfile, error) {
+	var user models.UserProfile
+	key, hit := r.lookup(ctx, "get", "user:"+id, &user)
+	if hit {
+		return user, nil
+	}
+
+	user, err := r.UserRepository.Get(ctx, id)
+	if err == nil {
+		r.store(ctx, key, user)
+	}
+	return user, err
+}
+
+func (r *Repository) Create(ctx context.Context, user models.UserProfile) (models.UserProfile, error) {
+	created, err := r.UserRepository.Create(ctx, user)
+	if err == nil {
+		r.invalidate(ctx)
+	}
+	return created, err
+}
+
+func (r *Repository) Update(ctx context.Context, id string, user models.UserProfile) (models.UserProfile, error) {
+	updated, err := r.UserRepository.Update(ctx, id, user)
+	if err == nil {
+		r.invalidate(ctx)
+	}
+	return updated, err
+}
+
+func (r *Repository) Delete(ctx context.Context, id string) error {
+	err := r.UserRepository.Delete(ctx, id)
+	if err == nil {
+		r.invalidate(ctx)
+	}
+	return err
+}
+
+func (r *Repository) SetAvatarURL(ctx context.Context, id string, avatarURL string) (models.UserProfile, error) {
+	updated, err := r.UserRepository.SetAvatarURL(ctx, id, avatarURL)
+	if err == nil {
+		r.invalidate(ctx)
+	}
+	return updated, err
+}
+
+func (r *Repository) Restore(ctx context.Context, id string) (models.UserProfile, error) {
+	restored, err := r.UserRepository.Restore(ctx, id)
+	if err == nil {
+		r.invalidate(ctx)
+	}
+	return restored, err
+}
+
+// Reset resets the wrapped repository and invalidates every cached entry
+func (r *Repository) Reset(ctx context.Context) error {
+	err := repository.Reset(ctx, r.UserRepository)
+	if err == nil {
+		r.invalidate(ctx)
+	}
+	return err
+}
+
+// Transaction runs fn in a transaction of the wrapped repository and
+// invalidates every cached entry once it ends, orphaning those read from its
+// changes before they were committed or rolled back
+func (r *Repository) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := repository.Transaction(ctx, r.UserRepository, fn)
+	r.invalidate(ctx)
+	return err
+}
+
+// RecordAudit records through the wrapped repository; audit records are not
+// cached
+func (r *Repository) RecordAudit(ctx context.Context, record repository.AuditRecord) error {
+	return repository.RecordAudit(ctx, r.UserRepository, record)
+}
+
+// MoveAudit moves the trail through the wrapped repository
+func (r *Repository) MoveAudit(ctx context.Context, fromID, toID string) error {
+	return repository.MoveAudit(ctx, r.UserRepository, fromID, toID)
+}
+
+// Trail reads through the wrapped repository; audit trails are not cached
+func (r *Repository) Trail(ctx context.Context, userID string) ([]repository.AuditRecord, error) {
+	return repository.Trail(ctx, r.UserRepository, userID)
+}
+
+// lookup decodes the entry for name in the current generation into dest.
+// It returns the key to store a fresh value under, or "" when Redis failed
+// and nothing should be stored.
+func (r *Repository) lookup(ctx context.Context, operation, name string, dest any) (string, bool) {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	generation, err := r.client.Get(ctx, generationKey).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		r.failed(operation, err)
+		return "", false
+	}
+	key := fmt.Sprintf("%s%d:%s", keyPrefix, generation, name)
+
+	data, err := r.client.Get(ctx, key).Bytes()
+	switch {
+	case errors.Is(err, redis.Nil):
+		r.requests.WithLabelValues(operation, resultMiss).Inc()
+		return key, false
+	case err != nil:
+		r.failed(operation, err)
+		return "", false
+	}
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		// Overwrite entries written in an older format
+		r.requests.WithLabelValues(operation, resultMiss).Inc()
+		return key, false
+	}
+	r.requests.WithLabelValues(operation, resultHit).Inc()
+	return key, true
+}
+
+// store caches value under key until the TTL expires
+func (r *Repository) store(ctx context.Context, key string, value any) {
+	if key == "" {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+	if err := r.client.Set(ctx, key, data, r.ttl).Err(); err != nil {
+		r.logger.Warn("Failed to store cache entry", "key", key, "error", err)
+	}
+}
+
+// invalidate starts a new generation, orphaning every cached entry; the
+// orphans expire with their TTL. The change it follows is already made, so
+// it goes ahead even when ctx is cancelled.
+func (r *Repository) invalidate(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), redisTimeout)
+	defer cancel()
+	if err := r.client.Incr(ctx, generationKey).Err(); err != nil {
+		r.logger.Error("Failed to invalidate cache; reads may be stale until the TTL expires", "error", err)
+	}
+}
+
+func (r *Repository) failed(operation string, err error) {
+	r.requests.WithLabelValues(operation, resultError).Inc()
+	r.logger.Warn("Cache lookup failed", "operation", operation, "error", err)
+}
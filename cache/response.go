@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/conditional"
+	"userprofile-api/config"
+	"userprofile-api/events"
+	"userprofile-api/requestid"
+	"userprofile-api/tenant"
+)
+
+// CacheHeader reports whether a response was served from the response cache
+const CacheHeader = "X-Cache"
+
+// maxEntryBytes keeps single large responses from crowding out the rest
+const maxEntryBytes = 1 << 20
+
+// ResponseCache keeps recent GET responses in memory, keyed by URL, Accept
+// header and tenant, and evicts the least recently used once it is full. Any
+// user change event clears it, so it suits deployments without Redis that
+// want to absorb bursts of identical reads.
+type ResponseCache struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front is most recently used
+	// generation increases on every purge, so responses computed before a
+	// purge are not stored after it
+	generation uint64
+}
+
+// response is a cached response, holding only the headers set by the handler
+type response struct {
+	key      string
+	status   int
+	header   http.Header
+	body     []byte
+	storedAt time.Time
+}
+
+// notModified reports whether the client already holds this response,
+// judged by the validators the handler set on it
+func (r *response) notModified(req *http.Request) bool {
+	lastModified, _ := http.ParseTime(r.header.Get("Last-Modified"))
+	return conditional.NotModified(req, r.header.Get("ETag"), lastModified)
+}
+
+// NewResponseCache creates a cache for the configured number of responses.
+// A size of zero disables caching.
+func NewResponseCache(cfg config.CacheConfig) *ResponseCache {
+	return &ResponseCache{
+		size:    cfg.ResponseSize,
+		ttl:     cfg.ResponseTTL,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Enabled reports whether responses are cached
+func (rc *ResponseCache) Enabled() bool {
+	return rc.size > 0
+}
+
+// Handle purges the cache when a user changes; subscribe it to the event bus
+func (rc *ResponseCache) Handle(events.Event) {
+	rc.Purge()
+}
+
+// Purge removes every cached response
+func (rc *ResponseCache) Purge() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	clear(rc.entries)
+	rc.order.Init()
+	rc.generation++
+}
+
+// Middleware serves GET requests from the cache and stores successful
+// responses, setting X-Cache to HIT or MISS. Install it after the
+// authentication and role checks of a route, since cached responses are
+// shared by every caller allowed to reach the handler.
+func (rc *ResponseCache) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !rc.Enabled() || c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+
+		// The Accept header selects between representations of the same URL,
+		// and the X-Tenant-ID header between the users of different tenants
+		key := c.Request.URL.RequestURI() + "\n" + c.GetHeader("Accept") + "\n" + tenant.ID(c)
+		cached, generation := rc.get(key)
+		if cached != nil {
+			h := c.Writer.Header()
+			for name, values := range cached.header {
+				h[name] = slices.Clone(values)
+			}
+			h.Set(CacheHeader, "HIT")
+			h.Set("Age", strconv.Itoa(int(time.Since(cached.storedAt).Seconds())))
+			if cached.notModified(c.Request) {
+				h.Del("Content-Type")
+				c.AbortWithStatus(http.StatusNotModified)
+				return
+			}
+			c.Writer.WriteHeader(cached.status)
+			c.Writer.Write(cached.body)
+			c.Abort()
+			return
+		}
+
+		// The response may be served to other requests, so its body must
+		// not echo this one's ID
+		requestid.Share(c)
+		before := c.Writer.Header().Clone()
+		c.Header(CacheHeader, "MISS")
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+		c.Writer = recorder.ResponseWriter
+
+		if c.Writer.Status() != http.StatusOK || recorder.overflow {
+			return
+		}
+		rc.put(generation, &response{
+			key:      key,
+			status:   c.Writer.Status(),
+			header:   addedHeaders(before, c.Writer.Header()),
+			body:     recorder.body.Bytes(),
+			storedAt: time.Now(),
+		})
+	}
+}
+
+// get returns the fresh entry for key, if any, along with the current
+// generation to store a new entry under
+func (rc *ResponseCache) get(key string) (*response, uint64) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	element, ok := rc.entries[key]
+	if !ok {
+		return nil, rc.generation
+	}
+	entry := element.Value.(*response)
+	if time.Since(entry.storedAt) > rc.ttl {
+		rc.remove(element)
+		return nil, rc.generation
+	}
+	rc.order.MoveToFront(element)
+	return entry, rc.generation
+}
+
+// put stores the entry unless the cache was purged since generation,
+// evicting the least recently used entries to make room
+func (rc *ResponseCache) put(generation uint64, entry *response) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if generation != rc.generation {
+		return
+	}
+	if element, ok := rc.entries[entry.key]; ok {
+		rc.remove(element)
+	}
+	rc.entries[entry.key] = rc.order.PushFront(entry)
+	for rc.order.Len() > rc.size {
+		rc.remove(rc.order.Back())
+	}
+}
+
+func (rc *ResponseCache) remove(element *list.Element) {
+	delete(rc.entries, element.Value.(*response).key)
+	rc.order.Remove(element)
+}
+
+// addedHeaders returns the headers the handler set, leaving out those set by
+// earlier middleware such as X-Request-ID and the CORS headers, which differ
+// between requests
+func addedHeaders(before, after http.Header) http.Header {
+	added := http.Header{}
+	for name, values := range after {
+		if name == CacheHeader || slices.Equal(before[name], values) {
+			continue
+		}
+		added[name] = slices.Clone(values)
+	}
+	return added
+}
+
+// bodyRecorder copies the response body as it is written
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *bodyRecorder) Write(data []byte) (int, error) {
+	w.record(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *bodyRecorder) record(data []byte) {
+	if w.overflow || w.body.Len()+len(data) > maxEntryBytes {
+		w.overflow = true
+		return
+	}
+	w.body.Write(data)
+}
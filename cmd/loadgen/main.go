@@ -0,0 +1,126 @@
+// Command loadgen drives a steady rate of requests against a running server
+// and reports the latency percentiles of each kind of request, so that the
+// performance of storage and middleware changes can be compared.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// options holds the command's flags
+type options struct {
+	server       string
+	apiKey       string
+	token        string
+	rps          int
+	duration     time.Duration
+	concurrency  int
+	h2c          bool
+	timeout      time.Duration
+	mix          string
+	output       string
+	maxP99       time.Duration
+	maxErrorRate float64
+}
+
+// maxRPS bounds the request rate, beyond which a single client would
+// measure itself rather than the server
+const maxRPS = 10000
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCommand() *cobra.Command {
+	opts := &options{}
+	cmd := &cobra.Command{
+		Use:   "loadgen",
+		Short: "Load-test a running server",
+		Long: `loadgen sends requests to the v1 REST API of a running server at a fixed
+rate, open-loop: requests start on schedule whether or not earlier ones have
+finished, up to the concurrency limit. It then reports the throughput, errors
+and latency percentiles of each scenario.
+
+The get and search scenarios pick from the users the server already holds, and
+create adds users, so run it against a server with demo data rather than a
+production one. POST /api/v1/users/generate creates such data.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return run(cmd, opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.server, "server", envOr("LOADGEN_SERVER", "http://localhost:8080"), "base URL of the API server (LOADGEN_SERVER)")
+	flags.StringVar(&opts.apiKey, "api-key", os.Getenv("LOADGEN_API_KEY"), "API key sent in X-API-Key (LOADGEN_API_KEY)")
+	flags.StringVar(&opts.token, "token", os.Getenv("LOADGEN_TOKEN"), "JWT sent as a bearer token (LOADGEN_TOKEN)")
+	flags.IntVar(&opts.rps, "rps", 50, "requests started per second")
+	flags.DurationVar(&opts.duration, "duration", 30*time.Second, "how long to send requests")
+	flags.IntVar(&opts.concurrency, "concurrency", 100, "most requests in flight at once; requests due beyond it are dropped")
+	flags.BoolVar(&opts.h2c, "h2c", false, "speak HTTP/2 without TLS, to a server started with H2C=true")
+	flags.DurationVar(&opts.timeout, "timeout", 10*time.Second, "timeout of each request")
+	flags.StringVar(&opts.mix, "mix", defaultMix, "relative weights of the scenarios: list, get, search and create")
+	flags.StringVarP(&opts.output, "output", "o", "table", "output format: table or json")
+	flags.DurationVar(&opts.maxP99, "max-p99", 0, "fail when the overall 99th percentile latency exceeds this; 0 disables the check")
+	flags.Float64Var(&opts.maxErrorRate, "max-error-rate", 0, "fail when more than this fraction of requests fail or are dropped; 0 disables the check")
+	return cmd
+}
+
+func run(cmd *cobra.Command, opts *options) error {
+	switch {
+	case opts.rps < 1 || opts.rps > maxRPS:
+		return fmt.Errorf("--rps must be from 1 to %d", maxRPS)
+	case opts.duration <= 0:
+		return errors.New("--duration must be positive")
+	case opts.concurrency < 1:
+		return errors.New("--concurrency must be positive")
+	case opts.output != "table" && opts.output != "json":
+		return fmt.Errorf("unknown output format %q; use table or json", opts.output)
+	}
+	weights, err := parseMix(opts.mix)
+	if err != nil {
+		return err
+	}
+
+	target := newTarget(opts)
+	if err := target.prepare(weights); err != nil {
+		return err
+	}
+
+	// Interrupting the run still reports on the requests sent so far
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, opts.duration)
+	defer cancel()
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "Sending %d requests/s to %s for %s\n", opts.rps, opts.server, opts.duration)
+	results := target.drive(ctx, weights, opts.rps, opts.concurrency)
+
+	r := results.report()
+	if opts.output == "json" {
+		err = writeJSON(cmd.OutOrStdout(), r)
+	} else {
+		err = writeTable(cmd.OutOrStdout(), r)
+	}
+	if err != nil {
+		return err
+	}
+	return r.check(opts.maxP99, opts.maxErrorRate)
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// results collects the outcome of every request of a run
+type results struct {
+	mu        sync.Mutex
+	scenarios map[string]*scenarioResults
+	elapsed   time.Duration
+}
+
+type scenarioResults struct {
+	latencies []time.Duration
+	failed    int
+	dropped   int
+	// statuses counts responses by status code; transport errors count
+	// under 0
+	statuses map[int]int
+}
+
+func newResults() *results {
+	return &results{scenarios: map[string]*scenarioResults{}}
+}
+
+func (r *results) scenario(name string) *scenarioResults {
+	s := r.scenarios[name]
+	if s == nil {
+		s = &scenarioResults{statuses: map[int]int{}}
+		r.scenarios[name] = s
+	}
+	return s
+}
+
+// record adds a completed request; it failed unless it got a 2xx response
+func (r *results) record(scenario string, latency time.Duration, status int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.scenario(scenario)
+	s.latencies = append(s.latencies, latency)
+	s.statuses[status]++
+	if err != nil || status < 200 || status > 299 {
+		s.failed++
+	}
+}
+
+// drop counts a request that was due while too many were in flight
+func (r *results) drop(scenario string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scenario(scenario).dropped++
+}
+
+// report summarizes a run per scenario and in total
+type report struct {
+	Elapsed   string          `json:"elapsed"`
+	Scenarios []scenarioStats `json:"scenarios"`
+	Total     scenarioStats   `json:"total"`
+}
+
+// scenarioStats summarizes the requests of a scenario. Latencies are in
+// milliseconds and cover completed requests, failed ones included.
+type scenarioStats struct {
+	Name     string         `json:"name"`
+	Requests int            `json:"requests"`
+	Failed   int            `json:"failed"`
+	Dropped  int            `json:"dropped"`
+	RPS      float64        `json:"rps"`
+	Mean     float64        `json:"meanMs"`
+	P50      float64        `json:"p50Ms"`
+	P90      float64        `json:"p90Ms"`
+	P95      float64        `json:"p95Ms"`
+	P99      float64        `json:"p99Ms"`
+	Max      float64        `json:"maxMs"`
+	Statuses map[string]int `json:"statuses"`
+}
+
+func (r *results) report() report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	all := &scenarioResults{statuses: map[int]int{}}
+	rep := report{Elapsed: r.elapsed.Round(time.Millisecond).String()}
+	for _, name := range scenarios {
+		s, ok := r.scenarios[name]
+		if !ok {
+			continue
+		}
+		rep.Scenarios = append(rep.Scenarios, s.stats(name, r.elapsed))
+		all.latencies = append(all.latencies, s.latencies...)
+		all.failed += s.failed
+		all.dropped += s.dropped
+		for status, n := range s.statuses {
+			all.statuses[status] += n
+		}
+	}
+	rep.Total = all.stats("total", r.elapsed)
+	return rep
+}
+
+func (s *scenarioResults) stats(name string, elapsed time.Duration) scenarioStats {
+	latencies := slices.Clone(s.latencies)
+	slices.Sort(latencies)
+	stats := scenarioStats{
+		Name:     name,
+		Requests: len(latencies),
+		Failed:   s.failed,
+		Dropped:  s.dropped,
+		P50:      milliseconds(percentile(latencies, 50)),
+		P90:      milliseconds(percentile(latencies, 90)),
+		P95:      milliseconds(percentile(latencies, 95)),
+		P99:      milliseconds(percentile(latencies, 99)),
+		Statuses: map[string]int{},
+	}
+	if len(latencies) > 0 {
+		var sum time.Duration
+		for _, latency := range latencies {
+			sum += latency
+		}
+		stats.Mean = milliseconds(sum / time.Duration(len(latencies)))
+		stats.Max = milliseconds(latencies[len(latencies)-1])
+	}
+	if elapsed > 0 {
+		stats.RPS = float64(len(latencies)) / elapsed.Seconds()
+	}
+	for status, n := range s.statuses {
+		key := strconv.Itoa(status)
+		if status == 0 {
+			key = "error"
+		}
+		stats.Statuses[key] = n
+	}
+	return stats
+}
+
+// percentile returns the nearest-rank percentile p of sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// check fails a run whose overall p99 latency or error rate exceeds the
+// given limits; zero limits are not checked
+func (r report) check(maxP99 time.Duration, maxErrorRate float64) error {
+	var errs []error
+	if maxP99 > 0 && r.Total.P99 > milliseconds(maxP99) {
+		errs = append(errs, fmt.Errorf("p99 latency %.1fms exceeds %s", r.Total.P99, maxP99))
+	}
+	if attempted := r.Total.Requests + r.Total.Dropped; maxErrorRate > 0 && attempted > 0 {
+		rate := float64(r.Total.Failed+r.Total.Dropped) / float64(attempted)
+		if rate > maxErrorRate {
+			errs = append(errs, fmt.Errorf("error rate %.2f%% exceeds %.2f%%", rate*100, maxErrorRate*100))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func writeTable(w io.Writer, r report) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "SCENARIO\tREQUESTS\tFAILED\tDROPPED\tRPS\tMEAN\tP50\tP90\tP95\tP99\tMAX\t")
+	for _, s := range append(r.Scenarios, r.Total) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.1f\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t\n",
+			s.Name, s.Requests, s.Failed, s.Dropped, s.RPS, s.Mean, s.P50, s.P90, s.P95, s.P99, s.Max)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "Elapsed %s\n", r.Elapsed)
+	return err
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"userprofile-api/models"
+	"userprofile-api/seed"
+)
+
+// Scenarios are the kinds of request loadgen sends
+const (
+	scenarioList   = "list"
+	scenarioGet    = "get"
+	scenarioSearch = "search"
+	scenarioCreate = "create"
+)
+
+// scenarios lists the scenarios in the order they are reported
+var scenarios = []string{scenarioList, scenarioGet, scenarioSearch, scenarioCreate}
+
+// defaultMix is mostly reads, as user-facing traffic tends to be
+const defaultMix = "list=6,get=2,search=1,create=1"
+
+// sampleSize is how many of the server's users the get and search scenarios
+// pick from
+const sampleSize = 100
+
+// parseMix reads scenario weights written as name=weight pairs separated by
+// commas. Scenarios left out are not sent.
+func parseMix(mix string) (map[string]int, error) {
+	weights := map[string]int{}
+	total := 0
+	for _, pair := range strings.Split(mix, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --mix entry %q; expected name=weight", pair)
+		}
+		if !slices.Contains(scenarios, name) {
+			return nil, fmt.Errorf("unknown scenario %q in --mix; use %s", name, strings.Join(scenarios, ", "))
+		}
+		weight, err := strconv.Atoi(value)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("weight of %s in --mix must be a non-negative integer", name)
+		}
+		weights[name] = weight
+		total += weight
+	}
+	if total == 0 {
+		return nil, errors.New("--mix must give at least one scenario a positive weight")
+	}
+	return weights, nil
+}
+
+// target is the server under load
+type target struct {
+	baseURL string
+	apiKey  string
+	token   string
+	client  *http.Client
+	// users is a sample of the server's users for the get and search
+	// scenarios to pick from
+	users []models.UserProfile
+}
+
+func newTarget(opts *options) *target {
+	transport := &http.Transport{MaxIdleConnsPerHost: opts.concurrency}
+	if opts.h2c {
+		// HTTP/2 multiplexes the requests over one connection per host
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return &target{
+		baseURL: strings.TrimSuffix(opts.server, "/") + "/api/v1",
+		apiKey:  opts.apiKey,
+		token:   opts.token,
+		client:  &http.Client{Timeout: opts.timeout, Transport: transport},
+	}
+}
+
+// prepare fetches the users the get and search scenarios pick from, when
+// the mix includes them
+func (t *target) prepare(weights map[string]int) error {
+	if weights[scenarioGet] == 0 && weights[scenarioSearch] == 0 {
+		return nil
+	}
+	req, err := t.request(http.MethodGet, "/users?per_page="+strconv.Itoa(sampleSize), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch users: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch users: server answered %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&t.users); err != nil {
+		return fmt.Errorf("fetch users: %w", err)
+	}
+	if len(t.users) == 0 {
+		return errors.New("the server holds no users for the get and search scenarios; create some first, " +
+			"e.g. with POST /api/v1/users/generate, or leave those scenarios out of --mix")
+	}
+	return nil
+}
+
+// drive starts rps requests per second, each of a scenario picked by
+// weight, until ctx is done, and waits for those in flight to finish.
+// Requests due while concurrency requests are in flight are dropped rather
+// than delayed, so a slow server cannot lower the offered load unnoticed.
+func (t *target) drive(ctx context.Context, weights map[string]int, rps, concurrency int) *results {
+	results := newResults()
+	pick := weightedPicker(weights)
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	ticker := time.NewTicker(time.Second / time.Duration(rps))
+	defer ticker.Stop()
+	start := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			results.elapsed = time.Since(start)
+			return results
+		case <-ticker.C:
+		}
+
+		scenario := pick()
+		select {
+		case slots <- struct{}{}:
+		default:
+			results.drop(scenario)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			began := time.Now()
+			status, err := t.send(scenario)
+			results.record(scenario, time.Since(began), status, err)
+		}()
+	}
+}
+
+// weightedPicker returns a function choosing scenarios in proportion to
+// their weights
+func weightedPicker(weights map[string]int) func() string {
+	total := 0
+	for _, scenario := range scenarios {
+		total += weights[scenario]
+	}
+	return func() string {
+		n := rand.IntN(total)
+		for _, scenario := range scenarios {
+			if n < weights[scenario] {
+				return scenario
+			}
+			n -= weights[scenario]
+		}
+		panic("unreachable")
+	}
+}
+
+// send makes one request of a scenario and returns its status code
+func (t *target) send(scenario string) (int, error) {
+	var req *http.Request
+	var err error
+	switch scenario {
+	case scenarioList:
+		req, err = t.request(http.MethodGet, "/users?page=1&per_page=20", nil)
+	case scenarioGet:
+		user := t.users[rand.IntN(len(t.users))]
+		req, err = t.request(http.MethodGet, "/users/"+url.PathEscape(user.ID), nil)
+	case scenarioSearch:
+		// The first word of a real name keeps the results non-empty
+		name, _, _ := strings.Cut(t.users[rand.IntN(len(t.users))].FullName, " ")
+		req, err = t.request(http.MethodGet, "/users/search?q="+url.QueryEscape(name), nil)
+	case scenarioCreate:
+		user := seed.Generate(1, rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())))[0]
+		body, marshalErr := json.Marshal(user)
+		if marshalErr != nil {
+			return 0, marshalErr
+		}
+		req, err = t.request(http.MethodPost, "/users", body)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	// Reading the whole body counts transferring it, and lets the
+	// connection be reused
+	_, err = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, err
+}
+
+func (t *target) request(method, path string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(method, t.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if t.apiKey != "" {
+		req.Header.Set("X-API-Key", t.apiKey)
+	}
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	return req, nil
+}
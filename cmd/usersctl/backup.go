@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+	"userprofile-api/backup"
+	"userprofile-api/config"
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+func newBackupCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Take, list and restore backups",
+		Long: `Take, list and restore backups of the database configured by DATABASE_URL
+and the other DB_* variables, in the storage configured by the BACKUP_*
+variables, as used by the server. A running server also takes backups on
+POST /api/v1/admin/backup and every BACKUP_INTERVAL.`,
+	}
+	cmd.AddCommand(newBackupCreateCommand(), newBackupListCommand(), newBackupRestoreCommand())
+	return cmd
+}
+
+func newBackupCreateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "create",
+		Short: "Back up the database now",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withBackups(true, func(m *backup.Manager, _ repository.UserRepository) error {
+				snapshot, err := m.Create(cmd.Context())
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Backed up %d users to %s\n", snapshot.Users, snapshot.Name)
+				return nil
+			})
+		},
+	}
+}
+
+func newBackupListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the stored backups, oldest first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withBackups(false, func(m *backup.Manager, _ repository.UserRepository) error {
+				names, err := m.List(cmd.Context())
+				for _, name := range names {
+					fmt.Fprintln(cmd.OutOrStdout(), name)
+				}
+				return err
+			})
+		},
+	}
+}
+
+func newBackupRestoreCommand() *cobra.Command {
+	var file string
+	cmd := &cobra.Command{
+		Use:   "restore [name]",
+		Short: "Restore the users in a backup",
+		Long: `Restore the users in the named backup, or in a local backup file given with
+--file. Users in the backup are created, or overwritten and deleted or
+undeleted to match it; other users are left alone. Versions and timestamps
+are not restored.
+
+Restore while the server is stopped when it uses the json backend, which
+would otherwise overwrite the file with its own copy of the users.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if (len(args) == 1) == (file != "") {
+				return errors.New("name a backup or pass --file, but not both")
+			}
+			return withBackups(true, func(m *backup.Manager, repo repository.UserRepository) error {
+				var users []models.UserProfile
+				var err error
+				if file != "" {
+					users, err = readBackupFile(file)
+				} else {
+					users, err = m.Load(cmd.Context(), args[0])
+				}
+				if err != nil {
+					return err
+				}
+
+				result, err := backup.Restore(cmd.Context(), repo, users)
+				fmt.Fprintf(cmd.OutOrStdout(), "Created %d users, updated %d\n", result.Created, result.Updated)
+				return err
+			})
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", "local backup file to restore instead of a stored backup")
+	return cmd
+}
+
+// withBackups runs fn with a backup manager for the configured storage and,
+// if needed, the configured database, which is closed afterwards
+func withBackups(needRepo bool, fn func(*backup.Manager, repository.UserRepository) error) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	var repo repository.UserRepository
+	if needRepo {
+		if repo, err = openRepository(cfg); err != nil {
+			return err
+		}
+		if closer, ok := repo.(io.Closer); ok {
+			defer closer.Close()
+		}
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	return fn(backup.New(repo, backup.NewStore(cfg.Backup), cfg.Backup, logger), repo)
+}
+
+func readBackupFile(path string) ([]models.UserProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users, err := backup.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("backup file %s: %w", path, err)
+	}
+	return users, nil
+}
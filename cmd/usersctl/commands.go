@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+// exportPageSize is the largest page the API serves
+const exportPageSize = 100
+
+func newListCommand(opts *options) *cobra.Command {
+	q := listQuery{}
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List users",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := opts.open()
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			users, total, err := s.List(cmd.Context(), q)
+			if err != nil {
+				return err
+			}
+			if err := opts.print(cmd.OutOrStdout(), users); err != nil {
+				return err
+			}
+			if opts.output == "table" {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Page %d, %d of %d users\n", q.Page, len(users), total)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&q.Page, "page", 1, "page to list")
+	cmd.Flags().IntVar(&q.PerPage, "per-page", 20, "users per page")
+	cmd.Flags().StringVar(&q.Sort, "sort", "", `sort order, e.g. "fullName,-id"`)
+	cmd.Flags().StringVarP(&q.Query, "query", "q", "", "only list users whose ID, name or emoji contains this text")
+	cmd.Flags().StringVar(&q.Tag, "tag", "", "only list users with this tag")
+	cmd.Flags().StringVar(&q.Status, "status", "", `only list users with these statuses, e.g. "suspended,archived"; archived users are left out by default`)
+	return cmd
+}
+
+func newGetCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get ID",
+		Short: "Show a user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := opts.open()
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			user, err := s.Get(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			return opts.print(cmd.OutOrStdout(), user)
+		},
+	}
+}
+
+// userFlags binds the flags that set a user's editable fields
+type userFlags struct {
+	cmd  *cobra.Command
+	user models.UserProfile
+}
+
+func addUserFlags(cmd *cobra.Command) *userFlags {
+	f := &userFlags{cmd: cmd}
+	cmd.Flags().StringVar(&f.user.FullName, "full-name", "", "full name")
+	cmd.Flags().StringVar(&f.user.Emoji, "emoji", "", "emoji")
+	cmd.Flags().StringVar(&f.user.Email, "email", "", "email address")
+	cmd.Flags().StringVar(&f.user.Bio, "bio", "", "short biography")
+	cmd.Flags().StringVar(&f.user.Location, "location", "", "location")
+	cmd.Flags().StringSliceVar(&f.user.Tags, "tag", nil, "tag, repeated or comma-separated for several; replaces the user's tags")
+	cmd.Flags().Var(metadataFlag{&f.user.Metadata}, "metadata", `metadata as a JSON object, e.g. '{"team":"platform"}'; replaces the user's metadata`)
+	return f
+}
+
+// metadataFlag parses a flag's JSON object into metadata
+type metadataFlag struct {
+	metadata *models.Metadata
+}
+
+func (f metadataFlag) Set(value string) error {
+	var metadata models.Metadata
+	if err := json.Unmarshal([]byte(value), &metadata); err != nil {
+		return fmt.Errorf("not a JSON object: %w", err)
+	}
+	*f.metadata = metadata
+	return nil
+}
+
+func (f metadataFlag) String() string {
+	if f.metadata == nil || *f.metadata == nil {
+		return ""
+	}
+	encoded, _ := json.Marshal(*f.metadata)
+	return string(encoded)
+}
+
+func (f metadataFlag) Type() string {
+	return "json"
+}
+
+// apply copies the fields whose flags were given onto user, so an update
+// only changes what was asked for
+func (f *userFlags) apply(user *models.UserProfile) {
+	set := f.cmd.Flags().Changed
+	if set("full-name") {
+		user.FullName = f.user.FullName
+	}
+	if set("emoji") {
+		user.Emoji = f.user.Emoji
+	}
+	if set("email") {
+		user.Email = f.user.Email
+	}
+	if set("bio") {
+		user.Bio = f.user.Bio
+	}
+	if set("location") {
+		user.Location = f.user.Location
+	}
+	if set("tag") {
+		user.Tags = f.user.Tags
+	}
+	if set("metadata") {
+		user.Metadata = f.user.Metadata
+	}
+}
+
+func newCreateCommand(opts *options) *cobra.Command {
+	var id string
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a user",
+		Long:  "Create a user from the given fields. A UUID is generated when --id is not given.",
+		Args:  cobra.NoArgs,
+	}
+	fields := addUserFlags(cmd)
+	cmd.Flags().StringVar(&id, "id", "", "user ID")
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		s, err := opts.open()
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+
+		user := models.UserProfile{ID: id}
+		fields.apply(&user)
+		created, err := s.Create(cmd.Context(), user)
+		if err != nil {
+			return err
+		}
+		return opts.print(cmd.OutOrStdout(), created)
+	}
+	return cmd
+}
+
+func newUpdateCommand(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update ID",
+		Short: "Change a user's fields",
+		Long:  "Change the fields given as flags; the others keep their values.",
+		Args:  cobra.ExactArgs(1),
+	}
+	fields := addUserFlags(cmd)
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if cmd.Flags().NFlag() == 0 {
+			return errors.New("nothing to update; pass the fields to change as flags")
+		}
+		s, err := opts.open()
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+
+		updated, err := s.Update(cmd.Context(), args[0], fields.apply)
+		if err != nil {
+			return err
+		}
+		return opts.print(cmd.OutOrStdout(), updated)
+	}
+	return cmd
+}
+
+func newDeleteCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete ID...",
+		Short: "Delete users",
+		Long:  "Soft-delete users; they can be restored through the API.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := opts.open()
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			for _, id := range args {
+				if err := s.Delete(cmd.Context(), id); err != nil {
+					return fmt.Errorf("delete %s: %w", id, err)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Deleted %s\n", id)
+			}
+			return nil
+		},
+	}
+}
+
+func newImportCommand(opts *options) *cobra.Command {
+	var skipExisting bool
+	cmd := &cobra.Command{
+		Use:   "import FILE",
+		Short: "Create users from a JSON file",
+		Long: `Create the users in a JSON array, as written by export. Use - to read
+standard input. Server-maintained fields such as version and timestamps are
+ignored. Every user is attempted; the command fails if any could not be
+created.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			users, err := readUsers(args[0], cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			s, err := opts.open()
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			var created, skipped, failed int
+			for _, user := range users {
+				_, err := s.Create(cmd.Context(), models.UserProfile{
+					ID:       user.ID,
+					FullName: user.FullName,
+					Emoji:    user.Emoji,
+					Email:    user.Email,
+					Bio:      user.Bio,
+					Location: user.Location,
+					Tags:     user.Tags,
+					Metadata: user.Metadata,
+					Status:   user.Status,
+				})
+				switch {
+				case err == nil:
+					created++
+				case skipExisting && errors.Is(err, repository.ErrConflict) && !errors.Is(err, repository.ErrEmailConflict):
+					skipped++
+				default:
+					failed++
+					fmt.Fprintf(cmd.ErrOrStderr(), "%s: %v\n", user.ID, err)
+				}
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Created %d, skipped %d, failed %d of %d users\n", created, skipped, failed, len(users))
+			if failed > 0 {
+				return fmt.Errorf("%d users could not be imported", failed)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&skipExisting, "skip-existing", false, "skip users whose ID already exists instead of failing")
+	return cmd
+}
+
+func newExportCommand(opts *options) *cobra.Command {
+	var file string
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write every user to a JSON file",
+		Long:  "Write every active user as a JSON array that import accepts.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := opts.open()
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			users := []models.UserProfile{}
+			for page := 1; ; page++ {
+				batch, total, err := s.List(cmd.Context(), listQuery{Page: page, PerPage: exportPageSize, Sort: "id", Status: "active,suspended,archived"})
+				if err != nil {
+					return err
+				}
+				users = append(users, batch...)
+				if len(batch) == 0 || len(users) >= total {
+					break
+				}
+			}
+
+			out := cmd.OutOrStdout()
+			if file != "" {
+				f, err := os.Create(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+			if err := writeJSON(out, users); err != nil {
+				return err
+			}
+			if file != "" {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Exported %d users to %s\n", len(users), file)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", "file to write instead of standard output")
+	return cmd
+}
+
+// readUsers decodes a JSON array of users from a file, or from stdin when
+// the name is -
+func readUsers(name string, stdin io.Reader) ([]models.UserProfile, error) {
+	in := stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var users []models.UserProfile
+	if err := json.NewDecoder(in).Decode(&users); err != nil {
+		return nil, fmt.Errorf("read %s: expected a JSON array of users: %w", name, err)
+	}
+	return users, nil
+}
+
+// print writes a user, or a slice of users, in the selected output format
+func (o *options) print(w io.Writer, body any) error {
+	if o.output == "json" {
+		return writeJSON(w, body)
+	}
+
+	users, ok := body.([]models.UserProfile)
+	if !ok {
+		users = []models.UserProfile{body.(models.UserProfile)}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tEMOJI\tEMAIL\tLOCATION\tVERSION")
+	for _, user := range users {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\n", user.ID, user.FullName, user.Emoji, user.Email, user.Location, user.Version)
+	}
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
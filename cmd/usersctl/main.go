@@ -0,0 +1,107 @@
+// Command usersctl manages user profiles from the command line, through the
+// REST API of a running server or directly against its database.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"userprofile-api/config"
+	"userprofile-api/metadata"
+	"userprofile-api/repository"
+	"userprofile-api/service"
+)
+
+// options holds the flags shared by every subcommand
+type options struct {
+	server string
+	apiKey string
+	token  string
+	local  bool
+	output string
+}
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCommand() *cobra.Command {
+	opts := &options{}
+	root := &cobra.Command{
+		Use:   "usersctl",
+		Short: "Manage user profiles",
+		Long: `usersctl manages user profiles through the REST API of a running server.
+
+With --local it opens the database configured by the server's environment
+variables (DB_DRIVER, DATABASE_URL, ...) instead. Changes made locally publish
+no events: webhooks are not sent and the Redis cache is not invalidated.`,
+		SilenceUsage: true,
+	}
+
+	flags := root.PersistentFlags()
+	flags.StringVar(&opts.server, "server", envOr("USERSCTL_SERVER", "http://localhost:8080"), "base URL of the API server (USERSCTL_SERVER)")
+	flags.StringVar(&opts.apiKey, "api-key", os.Getenv("USERSCTL_API_KEY"), "API key sent in X-API-Key (USERSCTL_API_KEY)")
+	flags.StringVar(&opts.token, "token", os.Getenv("USERSCTL_TOKEN"), "JWT sent as a bearer token (USERSCTL_TOKEN)")
+	flags.BoolVar(&opts.local, "local", false, "work on the configured database instead of the API")
+	flags.StringVarP(&opts.output, "output", "o", "table", "output format: table or json")
+
+	root.AddCommand(
+		newListCommand(opts),
+		newGetCommand(opts),
+		newCreateCommand(opts),
+		newUpdateCommand(opts),
+		newDeleteCommand(opts),
+		newImportCommand(opts),
+		newExportCommand(opts),
+		newMigrateCommand(),
+		newBackupCommand(),
+	)
+	return root
+}
+
+// open returns the store selected by the flags
+func (o *options) open() (store, error) {
+	if o.output != "table" && o.output != "json" {
+		return nil, fmt.Errorf("unknown output format %q; use table or json", o.output)
+	}
+	if !o.local {
+		return newAPIStore(o.server, o.apiKey, o.token), nil
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	schemas, err := metadata.New(cfg.Metadata, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the metadata schema: %w", err)
+	}
+	repo, err := openRepository(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &localStore{users: service.NewUserService(repo, schemas, nil)}, nil
+}
+
+// openRepository opens the configured database, which must be persistent
+func openRepository(cfg *config.Config) (repository.UserRepository, error) {
+	if cfg.Database.Driver == config.DriverMemory {
+		return nil, errors.New("the memory backend keeps no data between runs; set DATABASE_URL to a persistent database")
+	}
+	repo, err := repository.Open(cfg.Database)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s repository: %w", cfg.Database.Driver, err)
+	}
+	return repo, nil
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"userprofile-api/config"
+	"userprofile-api/migrations"
+	"userprofile-api/repository"
+)
+
+func newMigrateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage the database schema",
+		Long: `Apply, revert or list the schema migrations of the database configured by
+DATABASE_URL and the other DB_* variables, as used by --local. The server
+applies pending migrations on startup unless DB_AUTO_MIGRATE=false.`,
+	}
+	cmd.AddCommand(newMigrateUpCommand(), newMigrateDownCommand(), newMigrateStatusCommand())
+	return cmd
+}
+
+func newMigrateUpCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "up",
+		Short: "Apply pending migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withMigrator(func(m *migrations.Migrator) error {
+				applied, err := m.Up()
+				for _, version := range applied {
+					fmt.Fprintf(cmd.OutOrStdout(), "Applied %s\n", version)
+				}
+				if err == nil && len(applied) == 0 {
+					fmt.Fprintln(cmd.OutOrStdout(), "Schema is up to date")
+				}
+				return err
+			})
+		},
+	}
+}
+
+func newMigrateDownCommand() *cobra.Command {
+	var steps int
+	var all bool
+	cmd := &cobra.Command{
+		Use:   "down",
+		Short: "Revert the most recent migrations",
+		Long:  "Revert the most recently applied migrations. Reverting drops the columns and tables they added, with their data.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if all {
+				steps = -1
+			} else if steps < 1 {
+				return errors.New("--steps must be at least 1")
+			}
+			return withMigrator(func(m *migrations.Migrator) error {
+				reverted, err := m.Down(steps)
+				for _, version := range reverted {
+					fmt.Fprintf(cmd.OutOrStdout(), "Reverted %s\n", version)
+				}
+				if err == nil && len(reverted) == 0 {
+					fmt.Fprintln(cmd.OutOrStdout(), "No migrations to revert")
+				}
+				return err
+			})
+		},
+	}
+	cmd.Flags().IntVar(&steps, "steps", 1, "number of migrations to revert")
+	cmd.Flags().BoolVar(&all, "all", false, "revert every applied migration")
+	return cmd
+}
+
+func newMigrateStatusCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "List migrations and whether they are applied",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withMigrator(func(m *migrations.Migrator) error {
+				statuses, err := m.Status()
+				if err != nil {
+					return err
+				}
+				tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+				fmt.Fprintln(tw, "VERSION\tSTATUS")
+				for _, status := range statuses {
+					state := "pending"
+					if status.Applied {
+						state = "applied"
+					}
+					fmt.Fprintf(tw, "%s\t%s\n", status.Version, state)
+				}
+				return tw.Flush()
+			})
+		},
+	}
+}
+
+// withMigrator connects to the configured database for the duration of fn
+func withMigrator(fn func(*migrations.Migrator) error) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if cfg.Database.Driver == config.DriverMemory {
+		return errors.New("the memory backend has no schema; set DATABASE_URL to a PostgreSQL or SQLite database")
+	}
+
+	db, err := repository.OpenDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db, cfg.Database.Driver)
+	if err != nil {
+		return err
+	}
+	return fn(migrator)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"userprofile-api/apierror"
+	"userprofile-api/models"
+	"userprofile-api/repository"
+	"userprofile-api/service"
+)
+
+// listQuery selects a page of users
+type listQuery struct {
+	Page    int
+	PerPage int
+	Sort    string
+	Query   string
+	Tag     string
+	// Status is a comma-separated list of statuses; archived users are left
+	// out without it
+	Status string
+}
+
+// store is where the commands read and write users: the REST API, or the
+// repository itself in --local mode. Errors wrap the repository errors, so
+// commands can tell a missing or conflicting user apart either way.
+type store interface {
+	List(ctx context.Context, q listQuery) ([]models.UserProfile, int, error)
+	Get(ctx context.Context, id string) (models.UserProfile, error)
+	Create(ctx context.Context, user models.UserProfile) (models.UserProfile, error)
+	// Update fetches the user, applies the changes and saves it, failing if
+	// someone else changed the user in between
+	Update(ctx context.Context, id string, apply func(*models.UserProfile)) (models.UserProfile, error)
+	Delete(ctx context.Context, id string) error
+	Close() error
+}
+
+// apiStore talks to a running server through the v1 REST API
+type apiStore struct {
+	baseURL string
+	apiKey  string
+	token   string
+	client  *http.Client
+}
+
+func newAPIStore(server, apiKey, token string) *apiStore {
+	return &apiStore{
+		baseURL: strings.TrimSuffix(server, "/") + "/api/v1",
+		apiKey:  apiKey,
+		token:   token,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *apiStore) List(ctx context.Context, q listQuery) ([]models.UserProfile, int, error) {
+	params := url.Values{}
+	params.Set("page", strconv.Itoa(q.Page))
+	params.Set("per_page", strconv.Itoa(q.PerPage))
+	if q.Sort != "" {
+		params.Set("sort", q.Sort)
+	}
+	if q.Query != "" {
+		params.Set("q", q.Query)
+	}
+	if q.Tag != "" {
+		params.Set("tag", q.Tag)
+	}
+	if q.Status != "" {
+		params.Set("status", q.Status)
+	}
+
+	var users []models.UserProfile
+	resp, err := s.do(ctx, http.MethodGet, "/users?"+params.Encode(), nil, nil, &users)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, _ := strconv.Atoi(resp.Header.Get("X-Total-Count"))
+	return users, total, nil
+}
+
+func (s *apiStore) Get(ctx context.Context, id string) (models.UserProfile, error) {
+	var user models.UserProfile
+	_, err := s.do(ctx, http.MethodGet, "/users/"+url.PathEscape(id), nil, nil, &user)
+	return user, err
+}
+
+func (s *apiStore) Create(ctx context.Context, user models.UserProfile) (models.UserProfile, error) {
+	var created models.UserProfile
+	_, err := s.do(ctx, http.MethodPost, "/users", user, nil, &created)
+	return created, err
+}
+
+func (s *apiStore) Update(ctx context.Context, id string, apply func(*models.UserProfile)) (models.UserProfile, error) {
+	var current models.UserProfile
+	resp, err := s.do(ctx, http.MethodGet, "/users/"+url.PathEscape(id), nil, nil, &current)
+	if err != nil {
+		return models.UserProfile{}, err
+	}
+	apply(&current)
+
+	var updated models.UserProfile
+	header := http.Header{"If-Match": {resp.Header.Get("ETag")}}
+	_, err = s.do(ctx, http.MethodPut, "/users/"+url.PathEscape(id), current, header, &updated)
+	return updated, err
+}
+
+func (s *apiStore) Delete(ctx context.Context, id string) error {
+	_, err := s.do(ctx, http.MethodDelete, "/users/"+url.PathEscape(id), nil, nil, nil)
+	return err
+}
+
+func (s *apiStore) Close() error {
+	return nil
+}
+
+// do sends a request with a JSON body, if any, and decodes a successful
+// response into out. Error responses are returned as errors carrying the
+// API's error code and message.
+func (s *apiStore) do(ctx context.Context, method, path string, body any, header http.Header, out any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.apiKey != "" {
+		req.Header.Set("X-API-Key", s.apiKey)
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return resp, responseError(resp)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, fmt.Errorf("decode %s %s response: %w", method, path, err)
+		}
+	}
+	return resp, nil
+}
+
+// responseError converts an API error response to an error, wrapping the
+// repository error it corresponds to
+func responseError(resp *http.Response) error {
+	var body apierror.Error
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Code == "" {
+		return fmt.Errorf("server responded %s", resp.Status)
+	}
+
+	message := body.Code + ": " + body.Message
+	if body.Details != nil {
+		details, _ := json.Marshal(body.Details)
+		message += " " + string(details)
+	}
+
+	switch body.Code {
+	case apierror.CodeUserNotFound:
+		return &apiError{message: message, cause: repository.ErrNotFound}
+	case apierror.CodeEmailAlreadyInUse:
+		return &apiError{message: message, cause: repository.ErrEmailConflict}
+	case apierror.CodeUserAlreadyExists:
+		return &apiError{message: message, cause: repository.ErrConflict}
+	case apierror.CodePreconditionFailed:
+		return &apiError{message: message, cause: repository.ErrVersionMismatch}
+	default:
+		return errors.New(message)
+	}
+}
+
+// apiError is an API error response that corresponds to a repository error
+type apiError struct {
+	message string
+	cause   error
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func (e *apiError) Unwrap() error {
+	return e.cause
+}
+
+// localStore works on the repository directly, through the same user service
+// as the server, for maintenance while the server is down. Changes made this
+// way publish no events, so webhooks are not sent and caches are not
+// invalidated, and metadata is checked against the schema file only.
+type localStore struct {
+	users *service.UserService
+}
+
+func (s *localStore) List(ctx context.Context, q listQuery) ([]models.UserProfile, int, error) {
+	sort, err := repository.ParseSort(q.Sort)
+	if err != nil {
+		return nil, 0, err
+	}
+	statuses := models.ListedStatuses
+	if q.Status != "" {
+		if statuses, err = models.ParseStatuses(q.Status); err != nil {
+			return nil, 0, err
+		}
+	}
+	return s.users.List(ctx, repository.ListOptions{
+		Offset: (q.Page - 1) * q.PerPage,
+		Limit:  q.PerPage,
+		Sort:   sort,
+		Filter: repository.UserFilter{Query: q.Query, Tag: models.NormalizeTag(q.Tag), Statuses: statuses},
+	})
+}
+
+func (s *localStore) Get(ctx context.Context, id string) (models.UserProfile, error) {
+	return s.users.Get(ctx, id)
+}
+
+func (s *localStore) Create(ctx context.Context, user models.UserProfile) (models.UserProfile, error) {
+	return s.users.Create(ctx, user)
+}
+
+func (s *localStore) Update(ctx context.Context, id string, apply func(*models.UserProfile)) (models.UserProfile, error) {
+	return s.users.Update(ctx, id, func(user *models.UserProfile) error {
+		apply(user)
+		return nil
+	})
+}
+
+func (s *localStore) Delete(ctx context.Context, id string) error {
+	return s.users.Delete(ctx, id)
+}
+
+func (s *localStore) Close() error {
+	if closer, ok := s.users.Repository().(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package conditional
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NotModified evaluates the conditional GET headers of RFC 9110, reporting
+// whether a GET or HEAD request can be answered with 304 Not Modified because the client already holds the representation
+// identified by etag and lastModified. Either validator may be empty.
+// If-Modified-Since is ignored when If-None-Match is present.
+func NotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return etag != "" && matchesAny(header, etag)
+	}
+
+	if header := r.Header.Get("If-Modified-Since"); header != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(header)
+		// Last-Modified has one-second precision
+		return err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// matchesAny reports whether the If-None-Match header lists etag, using the
+// weak comparison If-None-Match calls for
+func matchesAny(header, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
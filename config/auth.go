@@ -0,0 +1,165 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// API key scopes
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// Roles, from least to most privileged. Each role includes the permissions
+// of the roles before it.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// Roles lists every role from least to most privileged
+var Roles = []string{RoleViewer, RoleEditor, RoleAdmin}
+
+// AuthConfig holds the credentials accepted by the API. Authentication is
+// disabled when neither API keys nor a JWT secret are configured.
+type AuthConfig struct {
+	// APIKeys lists the keys accepted in the X-API-Key header
+	APIKeys []APIKey
+	// JWT configures bearer token validation
+	JWT JWTConfig
+	// AdminToken is the separate credential of the admin API, sent in the
+	// X-Admin-Token header; the admin API is disabled when it is empty
+	AdminToken string
+}
+
+// Enabled reports whether any authentication method is configured
+func (a AuthConfig) Enabled() bool {
+	return len(a.APIKeys) > 0 || a.JWT.Secret != ""
+}
+
+// JWTConfig configures validation of HS256-signed bearer tokens
+type JWTConfig struct {
+	// Secret is the HMAC key; JWT authentication is disabled when empty
+	Secret string
+	// Issuer, when set, must match the token's iss claim
+	Issuer string
+	// Audience, when set, must be present in the token's aud claim
+	Audience string
+}
+
+// APIKey is a single machine-to-machine credential. When Roles is empty the
+// key gets the viewer role for the read scope and editor for write.
+type APIKey struct {
+	Name   string   `json:"name"`
+	Key    string   `json:"key"`
+	Scopes []string `json:"scopes"`
+	Roles  []string `json:"roles,omitempty"`
+	// RateLimit overrides RATE_LIMIT for the key when set; zero means no
+	// limit
+	RateLimit *int `json:"rateLimit,omitempty"`
+}
+
+// loadAuth reads API keys from API_KEYS and, if set, the JSON file named by
+// API_KEYS_FILE, the JWT settings from JWT_SECRET, JWT_ISSUER and
+// JWT_AUDIENCE, and the admin API token from ADMIN_TOKEN
+func loadAuth() (AuthConfig, error) {
+	var auth AuthConfig
+
+	keys, err := parseAPIKeys(getenv("API_KEYS"))
+	if err != nil {
+		return auth, err
+	}
+	auth.APIKeys = keys
+
+	if path := getenv("API_KEYS_FILE"); path != "" {
+		keys, err := readAPIKeysFile(path)
+		if err != nil {
+			return auth, err
+		}
+		auth.APIKeys = append(auth.APIKeys, keys...)
+	}
+
+	for _, key := range auth.APIKeys {
+		if err := key.validate(); err != nil {
+			return auth, err
+		}
+	}
+
+	auth.JWT = JWTConfig{
+		Secret:   getenv("JWT_SECRET"),
+		Issuer:   getenv("JWT_ISSUER"),
+		Audience: getenv("JWT_AUDIENCE"),
+	}
+
+	// A leaked API key must not also open the admin API
+	auth.AdminToken = getenv("ADMIN_TOKEN")
+	if auth.AdminToken != "" && slices.ContainsFunc(auth.APIKeys, func(key APIKey) bool { return key.Key == auth.AdminToken }) {
+		return auth, fmt.Errorf("ADMIN_TOKEN must differ from every API key")
+	}
+	return auth, nil
+}
+
+// parseAPIKeys parses a comma-separated list of key:scope|scope entries, e.g.
+// "s3cret:read|write,readonly-key:read". Keys from the environment are named
+// after their position in the list.
+func parseAPIKeys(value string) ([]APIKey, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var keys []APIKey
+	for i, entry := range strings.Split(value, ",") {
+		key, scopes, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found {
+			return nil, fmt.Errorf("invalid API_KEYS entry %d: expected key:scope|scope", i+1)
+		}
+		keys = append(keys, APIKey{
+			Name:   fmt.Sprintf("env-key-%d", i+1),
+			Key:    key,
+			Scopes: strings.Split(scopes, "|"),
+		})
+	}
+	return keys, nil
+}
+
+// readAPIKeysFile reads a JSON array of {"name", "key", "scopes"} objects,
+// which may also carry "roles" and "rateLimit"
+func readAPIKeysFile(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read API_KEYS_FILE: %w", err)
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("parse API_KEYS_FILE: %w", err)
+	}
+	return keys, nil
+}
+
+func (k APIKey) validate() error {
+	if k.Key == "" {
+		return fmt.Errorf("API key %q has an empty key", k.Name)
+	}
+	for _, scope := range k.Scopes {
+		if scope != ScopeRead && scope != ScopeWrite {
+			return fmt.Errorf("API key %q has unknown scope %q", k.Name, scope)
+		}
+	}
+	for _, role := range k.Roles {
+		if !slices.Contains(Roles, role) {
+			return fmt.Errorf("API key %q has unknown role %q", k.Name, role)
+		}
+	}
+	return nil
+}
+
+// HasScope reports whether the key grants the scope
+func (k APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Avatar storage backends
+const (
+	AvatarStorageDisk = "disk"
+	AvatarStorageS3   = "s3"
+)
+
+// AvatarConfig controls avatar uploads and where the images are stored
+type AvatarConfig struct {
+	Storage string
+	// Dir is the directory used by the disk backend
+	Dir string
+	// MaxBytes limits the size of an uploaded file
+	MaxBytes int
+	// Size is the width and height avatars are scaled down to fit
+	Size int
+	S3   S3Config
+}
+
+// S3Config locates an S3-compatible bucket, e.g. AWS S3 or MinIO
+type S3Config struct {
+	// Endpoint is the URL of an S3-compatible service; AWS S3 in Region is
+	// used when it is empty
+	Endpoint        string
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle addresses the bucket in the URL path rather than the host
+	// name, as MinIO and most S3-compatible services expect
+	PathStyle bool
+}
+
+// loadS3 reads the <prefix>_S3_* bucket settings and the AWS credentials
+func loadS3(prefix string) (S3Config, error) {
+	cfg := S3Config{
+		Endpoint:        getenv(prefix + "_S3_ENDPOINT"),
+		Bucket:          getenv(prefix + "_S3_BUCKET"),
+		Region:          getenv(prefix + "_S3_REGION"),
+		AccessKeyID:     getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: getenv("AWS_SECRET_ACCESS_KEY"),
+		PathStyle:       true,
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if value := getenv(prefix + "_S3_PATH_STYLE"); value != "" {
+		var err error
+		if cfg.PathStyle, err = strconv.ParseBool(value); err != nil {
+			return cfg, fmt.Errorf("invalid %s_S3_PATH_STYLE: %w", prefix, err)
+		}
+	}
+	return cfg, nil
+}
+
+// loadAvatar reads AVATAR_* and the S3 credentials. Avatars are stored on
+// disk unless AVATAR_STORAGE=s3.
+func loadAvatar() (AvatarConfig, error) {
+	var err error
+	cfg := AvatarConfig{
+		Storage: strings.ToLower(getenv("AVATAR_STORAGE")),
+		Dir:     getenv("AVATAR_DIR"),
+	}
+	if cfg.S3, err = loadS3("AVATAR"); err != nil {
+		return cfg, err
+	}
+	if cfg.Storage == "" {
+		cfg.Storage = AvatarStorageDisk
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = "avatars"
+	}
+	if cfg.MaxBytes, err = intEnv("AVATAR_MAX_BYTES", 5<<20); err != nil {
+		return cfg, err
+	}
+	if cfg.Size, err = intEnv("AVATAR_SIZE", 256); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxBytes < 1 || cfg.Size < 1 {
+		return cfg, fmt.Errorf("AVATAR_MAX_BYTES and AVATAR_SIZE must be positive")
+	}
+
+	switch cfg.Storage {
+	case AvatarStorageDisk:
+	case AvatarStorageS3:
+		if cfg.S3.Bucket == "" {
+			return cfg, fmt.Errorf("AVATAR_S3_BUCKET is required for %s avatar storage", cfg.Storage)
+		}
+		if cfg.S3.AccessKeyID == "" || cfg.S3.SecretAccessKey == "" {
+			return cfg, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for %s avatar storage", cfg.Storage)
+		}
+	default:
+		return cfg, fmt.Errorf("unsupported AVATAR_STORAGE %q", cfg.Storage)
+	}
+
+	return cfg, nil
+}
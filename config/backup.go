@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Backup storage backends
+const (
+	BackupStorageDisk = "disk"
+	BackupStorageS3   = "s3"
+)
+
+// BackupConfig controls snapshots of the user store
+type BackupConfig struct {
+	// Interval between scheduled backups; zero only backs up on demand
+	Interval time.Duration
+	Storage  string
+	// Dir is the directory used by the disk backend
+	Dir string
+	S3  S3Config
+	// Prefix is prepended to the object keys of the s3 backend
+	Prefix string
+	// Keep is how many of the newest backups are retained; zero keeps all
+	Keep int
+	// MaxAge removes backups older than this; zero keeps them regardless
+	// of age
+	MaxAge time.Duration
+}
+
+// loadBackup reads BACKUP_* and the S3 credentials. Backups are stored on
+// disk unless BACKUP_STORAGE=s3.
+func loadBackup() (BackupConfig, error) {
+	var err error
+	cfg := BackupConfig{
+		Storage: strings.ToLower(getenv("BACKUP_STORAGE")),
+		Dir:     getenv("BACKUP_DIR"),
+		Prefix:  getenv("BACKUP_S3_PREFIX"),
+	}
+	if cfg.S3, err = loadS3("BACKUP"); err != nil {
+		return cfg, err
+	}
+	if cfg.Storage == "" {
+		cfg.Storage = BackupStorageDisk
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = "backups"
+	}
+	if cfg.Interval, err = durationEnv("BACKUP_INTERVAL", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.Keep, err = intEnv("BACKUP_KEEP", 7); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxAge, err = durationEnv("BACKUP_MAX_AGE", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.Interval < 0 || cfg.Keep < 0 || cfg.MaxAge < 0 {
+		return cfg, fmt.Errorf("BACKUP_INTERVAL, BACKUP_KEEP and BACKUP_MAX_AGE must not be negative")
+	}
+
+	switch cfg.Storage {
+	case BackupStorageDisk:
+	case BackupStorageS3:
+		if cfg.S3.Bucket == "" {
+			return cfg, fmt.Errorf("BACKUP_S3_BUCKET is required for %s backup storage", cfg.Storage)
+		}
+		if cfg.S3.AccessKeyID == "" || cfg.S3.SecretAccessKey == "" {
+			return cfg, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for %s backup storage", cfg.Storage)
+		}
+	default:
+		return cfg, fmt.Errorf("unsupported BACKUP_STORAGE %q", cfg.Storage)
+	}
+
+	return cfg, nil
+}
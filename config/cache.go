@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// CacheConfig controls the optional Redis cache in front of the repository
+// and the in-memory response cache
+type CacheConfig struct {
+	// RedisURL locates the Redis server, e.g. redis://localhost:6379/0; the
+	// cache is disabled when it is empty
+	RedisURL string
+	// TTL bounds how long a cached read is served
+	TTL time.Duration
+	// ResponseSize is how many GET responses the in-memory cache holds;
+	// zero disables it
+	ResponseSize int
+	// ResponseTTL bounds how long a cached response is served
+	ResponseTTL time.Duration
+}
+
+// Enabled reports whether reads should be cached in Redis
+func (c CacheConfig) Enabled() bool {
+	return c.RedisURL != ""
+}
+
+// loadCache reads REDIS_URL, CACHE_TTL, RESPONSE_CACHE_SIZE and
+// RESPONSE_CACHE_TTL
+func loadCache() (CacheConfig, error) {
+	var err error
+	cfg := CacheConfig{RedisURL: getenv("REDIS_URL")}
+	if cfg.TTL, err = durationEnv("CACHE_TTL", time.Minute); err != nil {
+		return cfg, err
+	}
+	if cfg.TTL <= 0 {
+		return cfg, fmt.Errorf("CACHE_TTL must be positive")
+	}
+	if cfg.ResponseSize, err = intEnv("RESPONSE_CACHE_SIZE", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.ResponseSize < 0 {
+		return cfg, fmt.Errorf("RESPONSE_CACHE_SIZE must not be negative")
+	}
+	if cfg.ResponseTTL, err = durationEnv("RESPONSE_CACHE_TTL", 5*time.Second); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
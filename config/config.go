@@ -0,0 +1,311 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported storage drivers
+const (
+	DriverMemory   = "memory"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverDynamoDB = "dynamodb"
+	DriverJSON     = "json"
+)
+
+// defaultSQLitePath is used when the sqlite driver is selected without a URL
+const defaultSQLitePath = "users.db"
+
+// defaultJSONPath is used when the json driver is selected without a URL
+const defaultJSONPath = "users.json"
+
+// Config holds the application settings loaded from the environment
+type Config struct {
+	Server     ServerConfig
+	Database   DatabaseConfig
+	Resilience ResilienceConfig
+	Auth       AuthConfig
+	Log        LogConfig
+	Tracing    TracingConfig
+	CORS       CORSConfig
+	Avatar     AvatarConfig
+	Webhooks   WebhookConfig
+	Cache      CacheConfig
+	Seed       SeedConfig
+	Backup     BackupConfig
+	Pagination PaginationConfig
+	Debug      DebugConfig
+	Tenancy    TenancyConfig
+	Quota      QuotaConfig
+	Validation ValidationConfig
+	Session    SessionConfig
+	TLS        TLSConfig
+	Publish    PublishConfig
+	Replica    ReplicaConfig
+	Follows    FollowConfig
+	Metadata   MetadataConfig
+	Passwords  PasswordConfig
+	I18N       I18NConfig
+	Moderation ModerationConfig
+	Expiry     ExpiryConfig
+	Jobs       JobsConfig
+	// ErrorTracking reports unexpected errors to a Sentry-compatible tracker
+	ErrorTracking ErrorTrackingConfig
+	// Signing accepts requests partners sign with HMAC keys
+	Signing SigningConfig
+	// Sharing signs links to user profiles for people without credentials
+	Sharing SharingConfig
+	// LDAP imports users from a directory server
+	LDAP LDAPConfig
+	// File is the CONFIG_FILE the settings were also read from, if any
+	File string
+}
+
+// DatabaseConfig selects the storage backend and tunes its connection pool
+type DatabaseConfig struct {
+	Driver          string
+	URL             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// AutoMigrate applies pending schema migrations on startup; when off,
+	// startup fails until they are applied with usersctl migrate up
+	AutoMigrate bool
+	DynamoDB    DynamoDBConfig
+}
+
+// DynamoDBConfig locates the table used by the dynamodb driver. The region
+// and credentials come from the standard AWS environment variables and
+// shared config files.
+type DynamoDBConfig struct {
+	// Table is named by the host of a dynamodb:// DATABASE_URL
+	Table string
+	// Endpoint overrides the AWS endpoint, e.g. for DynamoDB Local
+	Endpoint string
+	// CreateTable creates the table with on-demand capacity if it is missing
+	CreateTable bool
+}
+
+// Load reads the configuration from environment variables, applying defaults
+// for anything that is not set. Settings missing from the environment are
+// also looked up in CONFIG_FILE, when it names one.
+func Load() (*Config, error) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+
+	var err error
+	cfg := &Config{File: os.Getenv("CONFIG_FILE")}
+	if cfg.File != "" {
+		if fileValues, err = readFile(cfg.File); err != nil {
+			return nil, err
+		}
+		defer func() { fileValues = nil }()
+	}
+
+	if cfg.Server, err = loadServer(); err != nil {
+		return nil, err
+	}
+	if cfg.Database, err = loadDatabase(); err != nil {
+		return nil, err
+	}
+	if cfg.Resilience, err = loadResilience(); err != nil {
+		return nil, err
+	}
+	if cfg.Auth, err = loadAuth(); err != nil {
+		return nil, err
+	}
+	if cfg.Log, err = loadLogging(); err != nil {
+		return nil, err
+	}
+	cfg.Tracing = loadTracing()
+	if cfg.CORS, err = loadCORS(); err != nil {
+		return nil, err
+	}
+	if cfg.Avatar, err = loadAvatar(); err != nil {
+		return nil, err
+	}
+	if cfg.Webhooks, err = loadWebhooks(); err != nil {
+		return nil, err
+	}
+	if cfg.Cache, err = loadCache(); err != nil {
+		return nil, err
+	}
+	if cfg.Seed, err = loadSeed(); err != nil {
+		return nil, err
+	}
+	if cfg.Backup, err = loadBackup(); err != nil {
+		return nil, err
+	}
+	cfg.Pagination = loadPagination()
+	if cfg.Debug, err = loadDebug(); err != nil {
+		return nil, err
+	}
+	if cfg.Tenancy, err = loadTenancy(cfg.Database.Driver); err != nil {
+		return nil, err
+	}
+	if cfg.Quota, err = loadQuota(cfg.Auth.APIKeys); err != nil {
+		return nil, err
+	}
+	if cfg.Validation, err = loadValidation(cfg.Server.Environment); err != nil {
+		return nil, err
+	}
+	if cfg.Session, err = loadSession(cfg.Server.Environment); err != nil {
+		return nil, err
+	}
+	if cfg.TLS, err = loadTLS(); err != nil {
+		return nil, err
+	}
+	if cfg.Publish, err = loadPublish(); err != nil {
+		return nil, err
+	}
+	if cfg.Replica, err = loadReplica(cfg.Publish); err != nil {
+		return nil, err
+	}
+	cfg.Follows = loadFollows()
+	cfg.Metadata = loadMetadata()
+	cfg.I18N = loadI18N()
+	if cfg.Passwords, err = loadPasswords(cfg.Auth); err != nil {
+		return nil, err
+	}
+	if cfg.Moderation, err = loadModeration(); err != nil {
+		return nil, err
+	}
+	if cfg.Expiry, err = loadExpiry(); err != nil {
+		return nil, err
+	}
+	if cfg.Jobs, err = loadJobs(); err != nil {
+		return nil, err
+	}
+	if cfg.ErrorTracking, err = loadErrorTracking(cfg.Server.Environment); err != nil {
+		return nil, err
+	}
+	if cfg.Signing, err = loadSigning(); err != nil {
+		return nil, err
+	}
+	if cfg.Sharing, err = loadSharing(); err != nil {
+		return nil, err
+	}
+	if cfg.LDAP, err = loadLDAP(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func loadDatabase() (DatabaseConfig, error) {
+	var err error
+	db := DatabaseConfig{
+		URL:    getenv("DATABASE_URL"),
+		Driver: strings.ToLower(getenv("DB_DRIVER")),
+	}
+	if db.Driver == "" {
+		db.Driver = driverFromURL(db.URL)
+	}
+	if db.MaxOpenConns, err = intEnv("DB_MAX_OPEN_CONNS", 10); err != nil {
+		return db, err
+	}
+	if db.MaxIdleConns, err = intEnv("DB_MAX_IDLE_CONNS", 5); err != nil {
+		return db, err
+	}
+	if db.ConnMaxLifetime, err = durationEnv("DB_CONN_MAX_LIFETIME", 30*time.Minute); err != nil {
+		return db, err
+	}
+	if db.ConnMaxIdleTime, err = durationEnv("DB_CONN_MAX_IDLE_TIME", 5*time.Minute); err != nil {
+		return db, err
+	}
+	db.AutoMigrate = true
+	if value := getenv("DB_AUTO_MIGRATE"); value != "" {
+		if db.AutoMigrate, err = strconv.ParseBool(value); err != nil {
+			return db, fmt.Errorf("invalid DB_AUTO_MIGRATE: %w", err)
+		}
+	}
+
+	switch db.Driver {
+	case DriverMemory:
+	case DriverPostgres:
+		if db.URL == "" {
+			return db, fmt.Errorf("DATABASE_URL is required for the %s driver", db.Driver)
+		}
+	case DriverSQLite:
+		if db.URL == "" {
+			db.URL = defaultSQLitePath
+		}
+	case DriverJSON:
+		if db.URL == "" {
+			db.URL = defaultJSONPath
+		}
+	case DriverDynamoDB:
+		if db.DynamoDB, err = loadDynamoDB(db.URL); err != nil {
+			return db, err
+		}
+	default:
+		return db, fmt.Errorf("unsupported DB_DRIVER %q", db.Driver)
+	}
+
+	return db, nil
+}
+
+// driverFromURL infers the storage driver from the DATABASE_URL scheme
+func driverFromURL(url string) string {
+	switch {
+	case strings.HasPrefix(url, "postgres://"), strings.HasPrefix(url, "postgresql://"):
+		return DriverPostgres
+	case strings.HasPrefix(url, "sqlite:"), strings.HasPrefix(url, "file:"):
+		return DriverSQLite
+	case strings.HasPrefix(url, "dynamodb://"):
+		return DriverDynamoDB
+	case strings.HasPrefix(url, "json:"):
+		return DriverJSON
+	default:
+		return DriverMemory
+	}
+}
+
+// loadDynamoDB reads the table from a dynamodb://<table> DATABASE_URL,
+// along with DYNAMODB_ENDPOINT and DYNAMODB_CREATE_TABLE
+func loadDynamoDB(rawURL string) (DynamoDBConfig, error) {
+	var err error
+	cfg := DynamoDBConfig{Endpoint: getenv("DYNAMODB_ENDPOINT")}
+	if u, parseErr := url.Parse(rawURL); parseErr == nil && u.Scheme == "dynamodb" {
+		cfg.Table = u.Host
+	}
+	if cfg.Table == "" {
+		return cfg, fmt.Errorf("DATABASE_URL must name the table as dynamodb://<table> for the %s driver", DriverDynamoDB)
+	}
+	if value := getenv("DYNAMODB_CREATE_TABLE"); value != "" {
+		if cfg.CreateTable, err = strconv.ParseBool(value); err != nil {
+			return cfg, fmt.Errorf("invalid DYNAMODB_CREATE_TABLE: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+func intEnv(key string, fallback int) (int, error) {
+	value := getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return n, nil
+}
+
+func durationEnv(key string, fallback time.Duration) (time.Duration, error) {
+	value := getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return d, nil
+}
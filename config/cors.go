@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AnyOrigin allows cross-origin requests from every origin
+const AnyOrigin = "*"
+
+// CORSConfig controls which browser origins may call the API
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// Enabled reports whether any cross-origin requests are allowed
+func (c CORSConfig) Enabled() bool {
+	return len(c.AllowedOrigins) > 0
+}
+
+// loadCORS reads CORS_ALLOWED_ORIGINS and friends. CORS is disabled unless
+// at least one origin is allowed.
+func loadCORS() (CORSConfig, error) {
+	var err error
+	cfg := CORSConfig{
+		AllowedOrigins: listEnv("CORS_ALLOWED_ORIGINS", nil),
+		AllowedMethods: listEnv("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "DELETE"}),
+		AllowedHeaders: listEnv("CORS_ALLOWED_HEADERS", []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "X-API-Key", "X-CSRF-Token", "X-Request-ID", "X-Tenant-ID"}),
+		ExposedHeaders: listEnv("CORS_EXPOSED_HEADERS", []string{"API-Version", "ETag", "Link", "Location", "Retry-After", "X-Cache", "X-Generate-Error", "X-Total-Count", "X-Page", "X-Per-Page", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "X-Request-ID", "X-User-Quota-Limit", "X-User-Quota-Remaining"}),
+	}
+	for i, method := range cfg.AllowedMethods {
+		cfg.AllowedMethods[i] = strings.ToUpper(method)
+	}
+
+	if value := getenv("CORS_ALLOW_CREDENTIALS"); value != "" {
+		if cfg.AllowCredentials, err = strconv.ParseBool(value); err != nil {
+			return cfg, fmt.Errorf("invalid CORS_ALLOW_CREDENTIALS: %w", err)
+		}
+	}
+	if cfg.MaxAge, err = durationEnv("CORS_MAX_AGE", 10*time.Minute); err != nil {
+		return cfg, err
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == AnyOrigin && cfg.AllowCredentials {
+			return cfg, fmt.Errorf("CORS_ALLOW_CREDENTIALS cannot be used with CORS_ALLOWED_ORIGINS=%s", AnyOrigin)
+		}
+	}
+
+	return cfg, nil
+}
+
+// listEnv splits a comma-separated variable, dropping empty entries
+func listEnv(key string, fallback []string) []string {
+	value := getenv(key)
+	if value == "" {
+		return fallback
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// DebugConfig controls the pprof profiling endpoints
+type DebugConfig struct {
+	// Enabled serves the profiling endpoints under /debug/pprof/
+	Enabled bool
+	// Addr is a separate address, such as 127.0.0.1:6060, to serve the
+	// profiling endpoints on instead of the API's; keeping them off the
+	// public listener avoids exposing them to clients
+	Addr string
+}
+
+// loadDebug reads DEBUG and DEBUG_ADDR
+func loadDebug() (DebugConfig, error) {
+	var err error
+	cfg := DebugConfig{Addr: getenv("DEBUG_ADDR")}
+	if value := getenv("DEBUG"); value != "" {
+		if cfg.Enabled, err = strconv.ParseBool(value); err != nil {
+			return cfg, fmt.Errorf("invalid DEBUG: %w", err)
+		}
+	}
+	return cfg, nil
+}
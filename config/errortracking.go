@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"runtime/debug"
+	"strings"
+)
+
+// ErrorTrackingConfig controls the reporting of unexpected errors and panics
+// to a Sentry-compatible error tracker
+type ErrorTrackingConfig struct {
+	// DSN is the tracker's client key URL, such as
+	// https://<key>@o1.ingest.sentry.io/<project>; without one no errors are
+	// reported
+	DSN string
+	// Environment and Release are attached to every reported error
+	Environment string
+	Release     string
+}
+
+// Enabled reports whether errors are reported
+func (c ErrorTrackingConfig) Enabled() bool {
+	return c.DSN != ""
+}
+
+// loadErrorTracking reads SENTRY_DSN, SENTRY_ENVIRONMENT, which defaults to
+// the server's environment, and SENTRY_RELEASE, which defaults to the version
+// or VCS revision the binary was built from
+func loadErrorTracking(environment string) (ErrorTrackingConfig, error) {
+	cfg := ErrorTrackingConfig{
+		DSN:         getenv("SENTRY_DSN"),
+		Environment: getenv("SENTRY_ENVIRONMENT"),
+		Release:     getenv("SENTRY_RELEASE"),
+	}
+	if cfg.Environment == "" {
+		cfg.Environment = environment
+	}
+	if cfg.Release == "" {
+		cfg.Release = buildVersion()
+	}
+	if cfg.DSN != "" {
+		u, err := url.Parse(cfg.DSN)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			u.User.Username() == "" || strings.Trim(u.Path, "/") == "" {
+			return cfg, fmt.Errorf("invalid SENTRY_DSN: expected a URL such as https://<key>@<host>/<project>")
+		}
+	}
+	return cfg, nil
+}
+
+// buildVersion returns the module version the binary was built from, or its
+// VCS revision for builds of a checkout, or "" when neither is known
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return ""
+}
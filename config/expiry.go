@@ -0,0 +1,26 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// ExpiryConfig controls the janitor soft-deleting users past their expiry
+// time
+type ExpiryConfig struct {
+	// Interval between sweeps for expired users; zero never sweeps, leaving
+	// expired users in place
+	Interval time.Duration
+}
+
+// loadExpiry reads EXPIRY_INTERVAL
+func loadExpiry() (ExpiryConfig, error) {
+	interval, err := durationEnv("EXPIRY_INTERVAL", time.Minute)
+	if err != nil {
+		return ExpiryConfig{}, err
+	}
+	if interval < 0 {
+		return ExpiryConfig{}, fmt.Errorf("EXPIRY_INTERVAL must not be negative")
+	}
+	return ExpiryConfig{Interval: interval}, nil
+}
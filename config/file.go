@@ -0,0 +1,61 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	// loadMu serializes Load, which is called again when the settings file
+	// changes, around its use of fileValues
+	loadMu sync.Mutex
+	// fileValues holds the settings read from CONFIG_FILE during Load
+	fileValues map[string]string
+)
+
+// getenv returns a setting from the environment or, when it is not set
+// there, from CONFIG_FILE. The environment wins so that a deployment can
+// override single settings of a shared file.
+func getenv(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fileValues[key]
+}
+
+// readFile reads a settings file of KEY=VALUE lines, as used by .env files.
+// Blank lines and lines starting with # are ignored, and values may be
+// wrapped in single or double quotes.
+func readFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open CONFIG_FILE: %w", err)
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, line)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return values, nil
+}
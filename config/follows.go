@@ -0,0 +1,14 @@
+package config
+
+// FollowConfig controls where the relationships of users following each
+// other are kept
+type FollowConfig struct {
+	// File is a JSON file the relationships are saved to; without one they
+	// are lost on restart
+	File string
+}
+
+// loadFollows reads FOLLOWS_FILE
+func loadFollows() FollowConfig {
+	return FollowConfig{File: getenv("FOLLOWS_FILE")}
+}
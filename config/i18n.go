@@ -0,0 +1,22 @@
+package config
+
+import "cmp"
+
+// I18NConfig controls the languages error messages and the HTML pages are
+// served in
+type I18NConfig struct {
+	// DefaultLanguage is served to clients whose Accept-Language matches
+	// none of the catalogs
+	DefaultLanguage string
+	// Dir holds message catalogs adding languages or overriding the built-in
+	// messages; without one only the built-in catalogs are used
+	Dir string
+}
+
+// loadI18N reads DEFAULT_LANGUAGE and LOCALES_DIR
+func loadI18N() I18NConfig {
+	return I18NConfig{
+		DefaultLanguage: cmp.Or(getenv("DEFAULT_LANGUAGE"), "en"),
+		Dir:             getenv("LOCALES_DIR"),
+	}
+}
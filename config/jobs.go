@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// JobsConfig controls the runner of background jobs, such as webhook
+// deliveries and scheduled backups
+type JobsConfig struct {
+	// Workers is the number of jobs run at once
+	Workers int
+	// PollInterval is how often the runner looks for jobs that are due,
+	// such as retries
+	PollInterval time.Duration
+}
+
+// loadJobs reads JOB_WORKERS and JOB_POLL_INTERVAL
+func loadJobs() (JobsConfig, error) {
+	var err error
+	var cfg JobsConfig
+	if cfg.Workers, err = intEnv("JOB_WORKERS", 4); err != nil {
+		return cfg, err
+	}
+	if cfg.PollInterval, err = durationEnv("JOB_POLL_INTERVAL", time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.Workers < 1 || cfg.PollInterval <= 0 {
+		return cfg, fmt.Errorf("JOB_WORKERS and JOB_POLL_INTERVAL must be positive")
+	}
+	return cfg, nil
+}
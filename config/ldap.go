@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LDAPFields are the user fields LDAP attributes can be mapped to, along
+// with metadata.<key> for a metadata key
+var LDAPFields = []string{"fullName", "email", "bio", "location"}
+
+// LDAPMetadataPrefix starts the targets of attributes mapped to metadata
+const LDAPMetadataPrefix = "metadata."
+
+// LDAPConfig controls the import of users from an LDAP directory
+type LDAPConfig struct {
+	// URL is the ldap:// or ldaps:// URL of the directory server; users are
+	// not synced without one
+	URL string
+	// BindDN and BindPassword authenticate the sync; without a DN it binds
+	// anonymously
+	BindDN       string
+	BindPassword string
+	// BaseDN is searched, with its subtree, for the users matching Filter
+	BaseDN string
+	Filter string
+	// Attributes maps user fields to the LDAP attributes they are read from.
+	// Users are matched by email, so it is always mapped.
+	Attributes map[string]string
+	// Interval between scheduled syncs; zero only syncs when asked through
+	// the admin API
+	Interval time.Duration
+	// Timeout bounds a sync, from connecting to saving the last user
+	Timeout time.Duration
+}
+
+// Enabled reports whether users are synced from a directory
+func (c LDAPConfig) Enabled() bool {
+	return c.URL != ""
+}
+
+// loadLDAP reads LDAP_URL, LDAP_BIND_DN, LDAP_BIND_PASSWORD, LDAP_BASE_DN,
+// LDAP_USER_FILTER, LDAP_ATTRIBUTES, LDAP_SYNC_INTERVAL and LDAP_TIMEOUT
+func loadLDAP() (LDAPConfig, error) {
+	var err error
+	cfg := LDAPConfig{
+		URL:          getenv("LDAP_URL"),
+		BindDN:       getenv("LDAP_BIND_DN"),
+		BindPassword: getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:       getenv("LDAP_BASE_DN"),
+		Filter:       getenv("LDAP_USER_FILTER"),
+	}
+	if cfg.Filter == "" {
+		cfg.Filter = "(objectClass=inetOrgPerson)"
+	}
+	if cfg.Interval, err = durationEnv("LDAP_SYNC_INTERVAL", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.Timeout, err = durationEnv("LDAP_TIMEOUT", 5*time.Minute); err != nil {
+		return cfg, err
+	}
+	if cfg.Interval < 0 || cfg.Timeout <= 0 {
+		return cfg, fmt.Errorf("LDAP_SYNC_INTERVAL must not be negative and LDAP_TIMEOUT must be positive")
+	}
+
+	cfg.Attributes = map[string]string{}
+	for _, pair := range listEnv("LDAP_ATTRIBUTES", []string{"fullName=cn", "email=mail", "bio=description", "location=l"}) {
+		field, attribute, ok := strings.Cut(pair, "=")
+		field, attribute = strings.TrimSpace(field), strings.TrimSpace(attribute)
+		known := field != LDAPMetadataPrefix && strings.HasPrefix(field, LDAPMetadataPrefix)
+		for _, name := range LDAPFields {
+			known = known || field == name
+		}
+		if !ok || attribute == "" || !known {
+			return cfg, fmt.Errorf("invalid LDAP_ATTRIBUTES entry %q: expected <field>=<attribute>, where the field is one of %s or %s<key>",
+				pair, strings.Join(LDAPFields, ", "), LDAPMetadataPrefix)
+		}
+		cfg.Attributes[field] = attribute
+	}
+	if cfg.Attributes["email"] == "" {
+		return cfg, fmt.Errorf("LDAP_ATTRIBUTES must map email, which users are matched by")
+	}
+
+	if cfg.Enabled() {
+		u, err := url.Parse(cfg.URL)
+		if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+			return cfg, fmt.Errorf("invalid LDAP_URL %q: expected ldap://<host>[:<port>] or ldaps://<host>[:<port>]", cfg.URL)
+		}
+	}
+	return cfg, nil
+}
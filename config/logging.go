@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Log output formats
+const (
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console"
+)
+
+// LogConfig controls the structured logger
+type LogConfig struct {
+	Level  slog.Level
+	Format string
+}
+
+// loadLogging reads LOG_LEVEL (debug, info, warn, error) and LOG_FORMAT
+// (json, console)
+func loadLogging() (LogConfig, error) {
+	cfg := LogConfig{Level: slog.LevelInfo, Format: LogFormatJSON}
+
+	if level := getenv("LOG_LEVEL"); level != "" {
+		if err := cfg.Level.UnmarshalText([]byte(level)); err != nil {
+			return cfg, fmt.Errorf("invalid LOG_LEVEL %q", level)
+		}
+	}
+
+	if format := strings.ToLower(getenv("LOG_FORMAT")); format != "" {
+		if format != LogFormatJSON && format != LogFormatConsole {
+			return cfg, fmt.Errorf("invalid LOG_FORMAT %q: expected %s or %s", format, LogFormatJSON, LogFormatConsole)
+		}
+		cfg.Format = format
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,14 @@
+package config
+
+// MetadataConfig controls how the free-form metadata of users is checked
+type MetadataConfig struct {
+	// SchemaFile is a JSON Schema file the metadata of users must match,
+	// unless their tenant has a schema of its own; without one any metadata
+	// is accepted
+	SchemaFile string
+}
+
+// loadMetadata reads METADATA_SCHEMA_FILE
+func loadMetadata() MetadataConfig {
+	return MetadataConfig{SchemaFile: getenv("METADATA_SCHEMA_FILE")}
+}
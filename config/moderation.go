@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Moderation verdicts, for the content of a user's full name or bio
+const (
+	// ModerationReject refuses the change with a validation error
+	ModerationReject = "reject"
+	// ModerationFlag saves the change and records it in the audit trail for
+	// review
+	ModerationFlag = "flag"
+)
+
+// ModerationConfig controls how the full names and bios of users are
+// moderated before they are saved
+type ModerationConfig struct {
+	// WordlistFile lists blocked words, one per line; without one no words
+	// are blocked
+	WordlistFile string
+	// WordlistAction is the verdict on content holding a blocked word,
+	// ModerationReject or ModerationFlag
+	WordlistAction string
+	// URL is an external moderation service asked about the content of
+	// every change; without one none is asked
+	URL     string
+	Timeout time.Duration
+	// FailOpen saves changes when the moderation service fails; otherwise
+	// they fail with it
+	FailOpen bool
+}
+
+// Enabled reports whether any moderation is configured
+func (c ModerationConfig) Enabled() bool {
+	return c.WordlistFile != "" || c.URL != ""
+}
+
+// loadModeration reads MODERATION_WORDLIST_FILE, MODERATION_WORDLIST_ACTION,
+// MODERATION_URL, MODERATION_TIMEOUT and MODERATION_FAIL_OPEN
+func loadModeration() (ModerationConfig, error) {
+	var err error
+	cfg := ModerationConfig{
+		WordlistFile:   getenv("MODERATION_WORDLIST_FILE"),
+		WordlistAction: getenv("MODERATION_WORDLIST_ACTION"),
+		URL:            getenv("MODERATION_URL"),
+	}
+	switch cfg.WordlistAction {
+	case "":
+		cfg.WordlistAction = ModerationReject
+	case ModerationReject, ModerationFlag:
+	default:
+		return cfg, fmt.Errorf("invalid MODERATION_WORDLIST_ACTION %q: expected %s or %s",
+			cfg.WordlistAction, ModerationReject, ModerationFlag)
+	}
+	if cfg.URL != "" {
+		if u, err := url.Parse(cfg.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return cfg, fmt.Errorf("invalid MODERATION_URL %q: expected an http or https URL", cfg.URL)
+		}
+	}
+	if cfg.Timeout, err = durationEnv("MODERATION_TIMEOUT", 2*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.Timeout <= 0 {
+		return cfg, fmt.Errorf("MODERATION_TIMEOUT must be positive")
+	}
+	if value := getenv("MODERATION_FAIL_OPEN"); value != "" {
+		if cfg.FailOpen, err = strconv.ParseBool(value); err != nil {
+			return cfg, fmt.Errorf("invalid MODERATION_FAIL_OPEN: %w", err)
+		}
+	}
+	return cfg, nil
+}
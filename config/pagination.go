@@ -0,0 +1,14 @@
+package config
+
+// PaginationConfig controls cursor-based pagination of user lists
+type PaginationConfig struct {
+	// CursorSecret signs list cursors so clients cannot forge them. When it
+	// is empty a random key is used, so cursors stop working when the server
+	// restarts and are not accepted by other replicas.
+	CursorSecret string
+}
+
+// loadPagination reads CURSOR_SECRET
+func loadPagination() PaginationConfig {
+	return PaginationConfig{CursorSecret: getenv("CURSOR_SECRET")}
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Password hashing algorithms
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+// PasswordConfig configures the password-based accounts users can register
+// and log in with, which are issued JWTs for the API. They are disabled
+// unless PASSWORD_AUTH is set, and need a JWT secret to sign the tokens.
+type PasswordConfig struct {
+	// Enabled serves the register and login endpoints
+	Enabled bool
+	// Hash is the algorithm new passwords are hashed with; passwords hashed
+	// with the other one still verify, and are rehashed on login
+	Hash string
+	// MinLength is the fewest characters a password may have
+	MinLength int
+	// File is a JSON file the credentials are saved to; without one they are
+	// lost on restart
+	File string
+	// TokenTTL is how long the access tokens issued on login last
+	TokenTTL time.Duration
+	// RefreshTTL is how long a refresh token lasts, and so how long a
+	// session lasts without being refreshed
+	RefreshTTL time.Duration
+	// SessionsFile is a JSON file the sessions are saved to; without one
+	// they are lost on restart
+	SessionsFile string
+	// Role is the role the tokens grant
+	Role string
+	// LoginAttempts is how many logins a client may attempt per LoginWindow,
+	// and how many may be attempted on an account; zero means no limit
+	LoginAttempts int
+	// LoginWindow is the period the login attempts are counted over
+	LoginWindow time.Duration
+}
+
+// loadPasswords reads PASSWORD_AUTH, PASSWORD_HASH, PASSWORD_MIN_LENGTH,
+// CREDENTIALS_FILE, AUTH_TOKEN_TTL, REFRESH_TOKEN_TTL, SESSIONS_FILE,
+// PASSWORD_ROLE, LOGIN_RATE_LIMIT and LOGIN_RATE_WINDOW
+func loadPasswords(auth AuthConfig) (PasswordConfig, error) {
+	var err error
+	cfg := PasswordConfig{File: getenv("CREDENTIALS_FILE"), SessionsFile: getenv("SESSIONS_FILE")}
+	if value := getenv("PASSWORD_AUTH"); value != "" {
+		if cfg.Enabled, err = strconv.ParseBool(value); err != nil {
+			return cfg, fmt.Errorf("invalid PASSWORD_AUTH: %w", err)
+		}
+	}
+	if cfg.Enabled && auth.JWT.Secret == "" {
+		return cfg, fmt.Errorf("PASSWORD_AUTH requires JWT_SECRET to sign the tokens it issues")
+	}
+
+	cfg.Hash = strings.ToLower(getenv("PASSWORD_HASH"))
+	if cfg.Hash == "" {
+		cfg.Hash = HashBcrypt
+	}
+	if cfg.Hash != HashBcrypt && cfg.Hash != HashArgon2id {
+		return cfg, fmt.Errorf("unknown PASSWORD_HASH %q: use bcrypt or argon2id", cfg.Hash)
+	}
+	if cfg.MinLength, err = intEnv("PASSWORD_MIN_LENGTH", 10); err != nil {
+		return cfg, err
+	}
+	// bcrypt ignores anything past 72 bytes
+	if cfg.MinLength < 8 || cfg.MinLength > 72 {
+		return cfg, fmt.Errorf("PASSWORD_MIN_LENGTH must be between 8 and 72")
+	}
+	if cfg.TokenTTL, err = durationEnv("AUTH_TOKEN_TTL", time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.TokenTTL <= 0 {
+		return cfg, fmt.Errorf("AUTH_TOKEN_TTL must be positive")
+	}
+	if cfg.RefreshTTL, err = durationEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour); err != nil {
+		return cfg, err
+	}
+	// Revoked sessions are remembered until their refresh token expires,
+	// which must outlast the access tokens issued for them
+	if cfg.RefreshTTL <= cfg.TokenTTL {
+		return cfg, fmt.Errorf("REFRESH_TOKEN_TTL must be longer than AUTH_TOKEN_TTL")
+	}
+	cfg.Role = getenv("PASSWORD_ROLE")
+	if cfg.Role == "" {
+		cfg.Role = RoleViewer
+	}
+	if !slices.Contains(Roles, cfg.Role) {
+		return cfg, fmt.Errorf("unknown PASSWORD_ROLE %q", cfg.Role)
+	}
+	if cfg.LoginAttempts, err = intEnv("LOGIN_RATE_LIMIT", 5); err != nil {
+		return cfg, err
+	}
+	if cfg.LoginAttempts < 0 {
+		return cfg, fmt.Errorf("LOGIN_RATE_LIMIT must not be negative")
+	}
+	if cfg.LoginWindow, err = durationEnv("LOGIN_RATE_WINDOW", 15*time.Minute); err != nil {
+		return cfg, err
+	}
+	if cfg.LoginWindow <= 0 {
+		return cfg, fmt.Errorf("LOGIN_RATE_WINDOW must be positive")
+	}
+	return cfg, nil
+}
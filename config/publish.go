@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Brokers user change events can be published to
+const (
+	BrokerKafka = "kafka"
+	BrokerNATS  = "nats"
+)
+
+// Schemes of the URLs of Kafka clusters, the second connecting with TLS
+const (
+	KafkaScheme       = "kafka"
+	KafkaSecureScheme = "kafkas"
+)
+
+// Serialization formats of published events
+const (
+	// FormatJSON is the event as webhooks receive it
+	FormatJSON = "json"
+	// FormatCloudEvents is the event in the CloudEvents 1.0 structured JSON
+	// format
+	FormatCloudEvents = "cloudevents"
+)
+
+// BrokerConfig selects a message broker and where on it user change events
+// are published
+type BrokerConfig struct {
+	// Broker is BrokerKafka or BrokerNATS
+	Broker string
+	// URL is the kafka:// or kafkas:// URL of the Kafka cluster, listing its
+	// bootstrap brokers separated by commas, or the nats:// URL of the NATS
+	// server
+	URL string
+	// Topic is the Kafka topic or NATS subject of the events; {type} in it
+	// stands for the event type, e.g. user.created
+	Topic  string
+	Format string
+	// Timeout bounds each request to the broker
+	Timeout time.Duration
+}
+
+// Enabled reports whether a broker is selected
+func (b BrokerConfig) Enabled() bool {
+	return b.Broker != ""
+}
+
+// PublishConfig controls publishing user change events to a message broker.
+// Nothing is published unless a broker is selected.
+type PublishConfig struct {
+	BrokerConfig
+	// PollInterval is how often the outbox of a SQL database is checked for
+	// events to publish
+	PollInterval time.Duration
+	// BatchSize is the most events taken from an outbox at a time
+	BatchSize int
+}
+
+// loadPublish reads the PUBLISH_ broker settings, and OUTBOX_POLL_INTERVAL
+// and OUTBOX_BATCH_SIZE for the SQL backends
+func loadPublish() (PublishConfig, error) {
+	var err error
+	cfg := PublishConfig{}
+	if cfg.BrokerConfig, err = loadBroker("PUBLISH_"); err != nil {
+		return cfg, err
+	}
+	if cfg.PollInterval, err = durationEnv("OUTBOX_POLL_INTERVAL", time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.BatchSize, err = intEnv("OUTBOX_BATCH_SIZE", 100); err != nil {
+		return cfg, err
+	}
+	if cfg.PollInterval <= 0 || cfg.BatchSize < 1 {
+		return cfg, fmt.Errorf("OUTBOX_POLL_INTERVAL and OUTBOX_BATCH_SIZE must be positive")
+	}
+	return cfg, nil
+}
+
+// loadBroker reads the BROKER, URL, TOPIC, FORMAT and TIMEOUT settings with
+// the given prefix
+func loadBroker(prefix string) (BrokerConfig, error) {
+	var err error
+	cfg := BrokerConfig{
+		Broker: getenv(prefix + "BROKER"),
+		URL:    getenv(prefix + "URL"),
+		Topic:  getenv(prefix + "TOPIC"),
+		Format: getenv(prefix + "FORMAT"),
+	}
+	if cfg.Topic == "" {
+		cfg.Topic = "user-events"
+	}
+	if cfg.Format == "" {
+		cfg.Format = FormatJSON
+	}
+	if cfg.Timeout, err = durationEnv(prefix+"TIMEOUT", 10*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.Format != FormatJSON && cfg.Format != FormatCloudEvents {
+		return cfg, fmt.Errorf("invalid %sFORMAT %q: expected %s or %s", prefix, cfg.Format, FormatJSON, FormatCloudEvents)
+	}
+
+	switch cfg.Broker {
+	case "":
+		return cfg, nil
+	case BrokerKafka:
+		if cfg.URL == "" {
+			cfg.URL = "kafka://localhost:9092"
+		}
+		if u, err := url.Parse(cfg.URL); err != nil || (u.Scheme != KafkaScheme && u.Scheme != KafkaSecureScheme) || u.Host == "" {
+			return cfg, fmt.Errorf("invalid %sURL %q: expected kafka://[<user>:<password>@]<host>:<port>[,<host>:<port>...] or kafkas://…",
+				prefix, cfg.URL)
+		}
+	case BrokerNATS:
+		if cfg.URL == "" {
+			cfg.URL = "nats://localhost:4222"
+		}
+		if u, err := url.Parse(cfg.URL); err != nil || u.Scheme != "nats" || u.Host == "" {
+			return cfg, fmt.Errorf("invalid %sURL %q: expected a nats:// URL", prefix, cfg.URL)
+		}
+	default:
+		return cfg, fmt.Errorf("invalid %sBROKER %q: expected %s or %s", prefix, cfg.Broker, BrokerKafka, BrokerNATS)
+	}
+	return cfg, nil
+}
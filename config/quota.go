@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// QuotaConfig limits how many requests each caller may make
+type QuotaConfig struct {
+	// RateLimit is the number of requests an API key may make per
+	// RateWindow; zero means no limit
+	RateLimit int
+	// RateWindow is the period the requests are counted over
+	RateWindow time.Duration
+	// KeyLimits overrides RateLimit for API keys by name; zero means no
+	// limit
+	KeyLimits map[string]int
+}
+
+// loadQuota reads RATE_LIMIT and RATE_LIMIT_WINDOW, and the rateLimit of each
+// API key
+func loadQuota(keys []APIKey) (QuotaConfig, error) {
+	var err error
+	var cfg QuotaConfig
+	if cfg.RateLimit, err = intEnv("RATE_LIMIT", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.RateLimit < 0 {
+		return cfg, fmt.Errorf("RATE_LIMIT must not be negative")
+	}
+	if cfg.RateWindow, err = durationEnv("RATE_LIMIT_WINDOW", time.Minute); err != nil {
+		return cfg, err
+	}
+	if cfg.RateWindow <= 0 {
+		return cfg, fmt.Errorf("RATE_LIMIT_WINDOW must be positive")
+	}
+
+	for _, key := range keys {
+		if key.RateLimit == nil {
+			continue
+		}
+		if *key.RateLimit < 0 {
+			return cfg, fmt.Errorf("API key %q has a negative rateLimit", key.Name)
+		}
+		if cfg.KeyLimits == nil {
+			cfg.KeyLimits = make(map[string]int)
+		}
+		cfg.KeyLimits[key.Name] = *key.RateLimit
+	}
+	return cfg, nil
+}
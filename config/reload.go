@@ -0,0 +1,60 @@
+package config
+
+import "reflect"
+
+// restartOnly are the settings used to build components on startup, which
+// keep their settings until the server restarts
+var restartOnly = []struct {
+	name  string
+	value func(*Config) any
+}{
+	{"server", func(c *Config) any { return c.Server }},
+	{"storage backend", func(c *Config) any { return c.Database }},
+	{"storage retries and circuit breaker", func(c *Config) any { return c.Resilience }},
+	{"authentication", func(c *Config) any { return c.Auth }},
+	{"log format", func(c *Config) any { return c.Log.Format }},
+	{"tracing", func(c *Config) any { return c.Tracing }},
+	{"avatars", func(c *Config) any { return c.Avatar }},
+	{"webhooks", func(c *Config) any { return c.Webhooks }},
+	{"cache", func(c *Config) any { return c.Cache }},
+	{"seed", func(c *Config) any { return c.Seed }},
+	{"backups", func(c *Config) any { return c.Backup }},
+	{"pagination", func(c *Config) any { return c.Pagination }},
+	{"debug", func(c *Config) any { return c.Debug }},
+	{"tenancy", func(c *Config) any { return c.Tenancy }},
+	{"quotas", func(c *Config) any { return c.Quota }},
+	{"OpenAPI validation", func(c *Config) any { return c.Validation }},
+	{"sessions", func(c *Config) any { return c.Session }},
+	{"TLS", func(c *Config) any { return c.TLS }},
+	{"event publishing", func(c *Config) any { return c.Publish }},
+	{"cluster role and replication", func(c *Config) any { return c.Replica }},
+	{"follows", func(c *Config) any { return c.Follows }},
+	{"metadata schema", func(c *Config) any { return c.Metadata }},
+	{"password accounts", func(c *Config) any { return c.Passwords }},
+	{"localization", func(c *Config) any { return c.I18N }},
+	{"content moderation", func(c *Config) any { return c.Moderation }},
+	{"user expiry", func(c *Config) any { return c.Expiry }},
+	{"background jobs", func(c *Config) any { return c.Jobs }},
+	{"error tracking", func(c *Config) any { return c.ErrorTracking }},
+	{"signed requests", func(c *Config) any { return c.Signing }},
+	{"shared links", func(c *Config) any { return c.Sharing }},
+	{"LDAP sync", func(c *Config) any { return c.LDAP }},
+}
+
+// Changes compares a reloaded configuration with the running one. The log
+// level and the CORS settings can be applied without a restart and are
+// listed in safe; every other changed setting is listed in unsafe.
+func Changes(running, reloaded *Config) (safe, unsafe []string) {
+	if running.Log.Level != reloaded.Log.Level {
+		safe = append(safe, "log level")
+	}
+	if !reflect.DeepEqual(running.CORS, reloaded.CORS) {
+		safe = append(safe, "CORS")
+	}
+	for _, setting := range restartOnly {
+		if !reflect.DeepEqual(setting.value(running), setting.value(reloaded)) {
+			unsafe = append(unsafe, setting.name)
+		}
+	}
+	return safe, unsafe
+}
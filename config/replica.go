@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Roles of a server in a deployment of a primary and read replicas
+const (
+	ClusterPrimary = "primary"
+	ClusterReplica = "replica"
+)
+
+// ReplicaConfig makes the server a read replica of a primary: it refuses
+// changes through its APIs, pointing clients at the primary, and applies the
+// user change events the primary publishes to its own storage when a broker
+// is selected. Without one the storage is replicated by other means, e.g. a
+// PostgreSQL standby.
+type ReplicaConfig struct {
+	// Role is ClusterPrimary or ClusterReplica
+	Role string
+	// PrimaryURL is the public URL of the primary, e.g.
+	// https://api.example.com, where replicas send clients changing users
+	PrimaryURL string
+	// RefuseStatus answers changes on a replica: 405 Method Not Allowed, or
+	// 503 Service Unavailable for load balancers that retry those elsewhere
+	RefuseStatus int
+	BrokerConfig
+	// Group is the Kafka consumer group of the replica. Every replica needs
+	// a group of its own to receive every event.
+	Group string
+}
+
+// ReadOnly reports whether the server is a replica
+func (r ReplicaConfig) ReadOnly() bool {
+	return r.Role == ClusterReplica
+}
+
+// loadReplica reads CLUSTER_ROLE, which defaults to replica when
+// REPLICA_BROKER is set, REPLICA_PRIMARY_URL, REPLICA_REFUSE_STATUS, the
+// REPLICA_ broker settings and REPLICA_GROUP, which defaults to a group named
+// after the host. A replica cannot publish events itself, as it would publish
+// those it received again.
+func loadReplica(publish PublishConfig) (ReplicaConfig, error) {
+	var err error
+	cfg := ReplicaConfig{
+		Role:       strings.ToLower(getenv("CLUSTER_ROLE")),
+		PrimaryURL: strings.TrimSuffix(getenv("REPLICA_PRIMARY_URL"), "/"),
+		Group:      getenv("REPLICA_GROUP"),
+	}
+	if cfg.BrokerConfig, err = loadBroker("REPLICA_"); err != nil {
+		return cfg, err
+	}
+	if cfg.RefuseStatus, err = intEnv("REPLICA_REFUSE_STATUS", http.StatusMethodNotAllowed); err != nil {
+		return cfg, err
+	}
+
+	switch cfg.Role {
+	case "":
+		cfg.Role = ClusterPrimary
+		if cfg.Enabled() {
+			cfg.Role = ClusterReplica
+		}
+	case ClusterPrimary:
+		if cfg.Enabled() {
+			return cfg, fmt.Errorf("REPLICA_BROKER requires CLUSTER_ROLE %s", ClusterReplica)
+		}
+	case ClusterReplica:
+	default:
+		return cfg, fmt.Errorf("invalid CLUSTER_ROLE %q: expected %s or %s", cfg.Role, ClusterPrimary, ClusterReplica)
+	}
+	if cfg.ReadOnly() && publish.Enabled() {
+		return cfg, fmt.Errorf("CLUSTER_ROLE %s cannot be combined with PUBLISH_BROKER", ClusterReplica)
+	}
+	if cfg.RefuseStatus != http.StatusMethodNotAllowed && cfg.RefuseStatus != http.StatusServiceUnavailable {
+		return cfg, fmt.Errorf("invalid REPLICA_REFUSE_STATUS %d: expected %d or %d",
+			cfg.RefuseStatus, http.StatusMethodNotAllowed, http.StatusServiceUnavailable)
+	}
+	if cfg.PrimaryURL != "" {
+		if u, err := url.Parse(cfg.PrimaryURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return cfg, fmt.Errorf("invalid REPLICA_PRIMARY_URL %q: expected an absolute http(s) URL", cfg.PrimaryURL)
+		}
+	}
+	if cfg.Group == "" {
+		hostname, _ := os.Hostname()
+		cfg.Group = "userprofile-replica-" + hostname
+	}
+	return cfg, nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// ResilienceConfig controls how calls to the storage backend are retried and
+// when they stop being made while it keeps failing
+type ResilienceConfig struct {
+	// Retries is how many times a call failing with a transient error is
+	// made again; zero disables retries
+	Retries int
+	// RetryBackoff is the longest wait before the first retry, doubled for
+	// each further one
+	RetryBackoff time.Duration
+	// BreakerFailures is the number of consecutive failed calls that open
+	// the circuit breaker; zero disables it
+	BreakerFailures int
+	// BreakerCooldown is how long an open breaker rejects calls before
+	// letting one through to try the backend again
+	BreakerCooldown time.Duration
+}
+
+// Enabled reports whether calls to the storage backend are retried or guarded
+// by the circuit breaker
+func (c ResilienceConfig) Enabled() bool {
+	return c.Retries > 0 || c.BreakerFailures > 0
+}
+
+// loadResilience reads STORAGE_RETRIES, STORAGE_RETRY_BACKOFF,
+// STORAGE_BREAKER_FAILURES and STORAGE_BREAKER_COOLDOWN
+func loadResilience() (ResilienceConfig, error) {
+	var err error
+	var cfg ResilienceConfig
+	if cfg.Retries, err = intEnv("STORAGE_RETRIES", 2); err != nil {
+		return cfg, err
+	}
+	if cfg.Retries < 0 {
+		return cfg, fmt.Errorf("STORAGE_RETRIES must not be negative")
+	}
+	if cfg.RetryBackoff, err = durationEnv("STORAGE_RETRY_BACKOFF", 50*time.Millisecond); err != nil {
+		return cfg, err
+	}
+	if cfg.RetryBackoff <= 0 {
+		return cfg, fmt.Errorf("STORAGE_RETRY_BACKOFF must be positive")
+	}
+	if cfg.BreakerFailures, err = intEnv("STORAGE_BREAKER_FAILURES", 5); err != nil {
+		return cfg, err
+	}
+	if cfg.BreakerFailures < 0 {
+		return cfg, fmt.Errorf("STORAGE_BREAKER_FAILURES must not be negative")
+	}
+	if cfg.BreakerCooldown, err = durationEnv("STORAGE_BREAKER_COOLDOWN", 30*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.BreakerCooldown <= 0 {
+		return cfg, fmt.Errorf("STORAGE_BREAKER_COOLDOWN must be positive")
+	}
+	return cfg, nil
+}
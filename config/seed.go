@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SeedConfig selects the users loaded into the repository on startup
+type SeedConfig struct {
+	// File is a JSON or YAML file of users. When it is empty the in-memory
+	// backend gets the built-in demo users and SQL backends are not seeded.
+	File string
+	// Disabled turns seeding off entirely
+	Disabled bool
+	// SkipIfNotEmpty leaves a repository that already holds users alone.
+	// Otherwise the seed users are added, skipping those whose ID exists.
+	SkipIfNotEmpty bool
+}
+
+// loadSeed reads SEED_FILE, which may be "off", and SEED_SKIP_IF_NOT_EMPTY
+func loadSeed() (SeedConfig, error) {
+	var err error
+	cfg := SeedConfig{File: getenv("SEED_FILE"), SkipIfNotEmpty: true}
+	if strings.EqualFold(cfg.File, "off") {
+		cfg.File = ""
+		cfg.Disabled = true
+	}
+	if value := getenv("SEED_SKIP_IF_NOT_EMPTY"); value != "" {
+		if cfg.SkipIfNotEmpty, err = strconv.ParseBool(value); err != nil {
+			return cfg, fmt.Errorf("invalid SEED_SKIP_IF_NOT_EMPTY: %w", err)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environments the API can run in
+const (
+	EnvDevelopment = "development"
+	EnvStaging     = "staging"
+	EnvProduction  = "production"
+)
+
+// ServerConfig controls the HTTP and gRPC listeners and their shutdown
+type ServerConfig struct {
+	Addr string
+	// GRPCAddr is where the gRPC API listens; empty disables it
+	GRPCAddr string
+	// BaseURL is the public URL of the API, used to build absolute links;
+	// links are root-relative when it is empty
+	BaseURL string
+	// BasePath prefixes the routes of the API, such as /users, for servers
+	// embedding it under a path of their own; empty serves them at the root
+	BasePath string
+	// Links adds HAL _links to every user response instead of only to
+	// requests accepting application/hal+json
+	Links bool
+	// ProblemDetails answers every error with RFC 7807 problem details
+	// instead of only requests accepting application/problem+json
+	ProblemDetails bool
+	// ShutdownTimeout bounds how long in-flight requests may take to finish
+	// once a termination signal is received
+	ShutdownTimeout time.Duration
+	// Environment is the deployment the API runs in; demo features such as
+	// the user generator are only served outside production
+	Environment string
+	// ReadHeaderTimeout bounds how long clients may take to send request
+	// headers, so slow clients cannot hold connections open
+	ReadHeaderTimeout time.Duration
+	// IdleTimeout closes keep-alive connections left idle for longer
+	IdleTimeout time.Duration
+	// MaxHeaderBytes caps the size of request headers
+	MaxHeaderBytes int
+	// KeepAlives reuses connections for several requests
+	KeepAlives bool
+	// H2C serves HTTP/2 without TLS to clients that start with it, such as
+	// proxies and load generators talking HTTP/2 with prior knowledge
+	H2C bool
+}
+
+// Production reports whether the API runs in production
+func (s ServerConfig) Production() bool {
+	return s.Environment == EnvProduction
+}
+
+// loadServer reads APP_ENV, SERVER_ADDR, GRPC_ADDR, BASE_URL, BASE_PATH,
+// HAL_LINKS, PROBLEM_DETAILS and SHUTDOWN_TIMEOUT. Setting GRPC_ADDR to "off" disables the gRPC API.
+// The connections are tuned by SERVER_READ_HEADER_TIMEOUT, SERVER_IDLE_TIMEOUT,
+// SERVER_MAX_HEADER_BYTES, SERVER_KEEP_ALIVES and H2C.
+func loadServer() (ServerConfig, error) {
+	var err error
+	cfg := ServerConfig{
+		Environment: strings.ToLower(getenv("APP_ENV")),
+		Addr:        getenv("SERVER_ADDR"),
+		GRPCAddr:    getenv("GRPC_ADDR"),
+		BaseURL:     getenv("BASE_URL"),
+		BasePath:    strings.TrimSuffix(getenv("BASE_PATH"), "/"),
+	}
+	switch cfg.Environment {
+	case "":
+		cfg.Environment = EnvDevelopment
+	case EnvDevelopment, EnvStaging, EnvProduction:
+	default:
+		return cfg, fmt.Errorf("invalid APP_ENV %q: expected %s, %s or %s", cfg.Environment,
+			EnvDevelopment, EnvStaging, EnvProduction)
+	}
+	if cfg.Addr == "" {
+		cfg.Addr = ":8080"
+	}
+	switch cfg.GRPCAddr {
+	case "":
+		cfg.GRPCAddr = ":9090"
+	case "off":
+		cfg.GRPCAddr = ""
+	}
+	if cfg.BaseURL != "" {
+		if u, err := url.Parse(cfg.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return cfg, fmt.Errorf("invalid BASE_URL %q: expected an absolute http(s) URL", cfg.BaseURL)
+		}
+	}
+	if cfg.BasePath != "" && !strings.HasPrefix(cfg.BasePath, "/") {
+		return cfg, fmt.Errorf("invalid BASE_PATH %q: expected a path starting with /", cfg.BasePath)
+	}
+	if value := getenv("HAL_LINKS"); value != "" {
+		if cfg.Links, err = strconv.ParseBool(value); err != nil {
+			return cfg, fmt.Errorf("invalid HAL_LINKS: %w", err)
+		}
+	}
+	if value := getenv("PROBLEM_DETAILS"); value != "" {
+		if cfg.ProblemDetails, err = strconv.ParseBool(value); err != nil {
+			return cfg, fmt.Errorf("invalid PROBLEM_DETAILS: %w", err)
+		}
+	}
+	if cfg.ShutdownTimeout, err = durationEnv("SHUTDOWN_TIMEOUT", 15*time.Second); err != nil {
+		return cfg, err
+	}
+	if err := loadConnections(&cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// loadConnections reads the settings of the HTTP server's connections
+func loadConnections(cfg *ServerConfig) error {
+	var err error
+	if cfg.ReadHeaderTimeout, err = durationEnv("SERVER_READ_HEADER_TIMEOUT", 10*time.Second); err != nil {
+		return err
+	}
+	if cfg.IdleTimeout, err = durationEnv("SERVER_IDLE_TIMEOUT", 2*time.Minute); err != nil {
+		return err
+	}
+	if cfg.ReadHeaderTimeout <= 0 || cfg.IdleTimeout <= 0 {
+		return fmt.Errorf("SERVER_READ_HEADER_TIMEOUT and SERVER_IDLE_TIMEOUT must be positive")
+	}
+	if cfg.MaxHeaderBytes, err = intEnv("SERVER_MAX_HEADER_BYTES", 1<<20); err != nil {
+		return err
+	}
+	if cfg.MaxHeaderBytes <= 0 {
+		return fmt.Errorf("SERVER_MAX_HEADER_BYTES must be positive")
+	}
+	cfg.KeepAlives = true
+	if value := getenv("SERVER_KEEP_ALIVES"); value != "" {
+		if cfg.KeepAlives, err = strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("invalid SERVER_KEEP_ALIVES: %w", err)
+		}
+	}
+	if value := getenv("H2C"); value != "" {
+		if cfg.H2C, err = strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("invalid H2C: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SessionConfig configures logging in to the HTML pages, which is separate
+// from the credentials of the JSON API. Logins are disabled when no accounts
+// are configured.
+type SessionConfig struct {
+	// Accounts lists who may log in
+	Accounts []Account
+	// TTL is how long a session lasts after logging in
+	TTL time.Duration
+	// SecureCookie restricts the session cookie to HTTPS connections
+	SecureCookie bool
+}
+
+// Enabled reports whether logging in to the HTML pages is configured
+func (s SessionConfig) Enabled() bool {
+	return len(s.Accounts) > 0
+}
+
+// Account is a person who may log in to the HTML pages. Accounts without
+// roles get the viewer role.
+type Account struct {
+	Name string `json:"name"`
+	// PasswordHash is the bcrypt hash of the account's password
+	PasswordHash string   `json:"passwordHash"`
+	Roles        []string `json:"roles,omitempty"`
+}
+
+// loadSession reads the accounts from the JSON file named by
+// UI_ACCOUNTS_FILE, SESSION_TTL and SESSION_SECURE_COOKIE, which defaults to
+// true in production
+func loadSession(environment string) (SessionConfig, error) {
+	var err error
+	cfg := SessionConfig{SecureCookie: environment == EnvProduction}
+	if path := getenv("UI_ACCOUNTS_FILE"); path != "" {
+		if cfg.Accounts, err = readAccountsFile(path); err != nil {
+			return cfg, err
+		}
+	}
+	for _, account := range cfg.Accounts {
+		if err := account.validate(); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.TTL, err = durationEnv("SESSION_TTL", 12*time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.TTL <= 0 {
+		return cfg, fmt.Errorf("SESSION_TTL must be positive")
+	}
+	if value := getenv("SESSION_SECURE_COOKIE"); value != "" {
+		if cfg.SecureCookie, err = strconv.ParseBool(value); err != nil {
+			return cfg, fmt.Errorf("invalid SESSION_SECURE_COOKIE: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// readAccountsFile reads a JSON array of {"name", "passwordHash"} objects,
+// which may also carry "roles"
+func readAccountsFile(path string) ([]Account, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read UI_ACCOUNTS_FILE: %w", err)
+	}
+
+	var accounts []Account
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("parse UI_ACCOUNTS_FILE: %w", err)
+	}
+	return accounts, nil
+}
+
+func (a Account) validate() error {
+	if a.Name == "" {
+		return fmt.Errorf("UI_ACCOUNTS_FILE has an account without a name")
+	}
+	if _, err := bcrypt.Cost([]byte(a.PasswordHash)); err != nil {
+		return fmt.Errorf("account %q has an invalid passwordHash: %w", a.Name, err)
+	}
+	for _, role := range a.Roles {
+		if !slices.Contains(Roles, role) {
+			return fmt.Errorf("account %q has unknown role %q", a.Name, role)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// minShareLinkSecret is the fewest bytes the secret signing shared links may
+// have
+const minShareLinkSecret = 32
+
+// SharingConfig controls the signed links that let anyone holding them read a
+// user's profile until they expire
+type SharingConfig struct {
+	// Secret signs the links; sharing is disabled without one. Changing it
+	// invalidates every link handed out.
+	Secret string
+	// TTL is how long links are valid for when the caller does not say
+	TTL time.Duration
+	// MaxTTL caps how long a link may be valid for
+	MaxTTL time.Duration
+}
+
+// Enabled reports whether links can be shared
+func (c SharingConfig) Enabled() bool {
+	return c.Secret != ""
+}
+
+// loadSharing reads SHARE_LINK_SECRET, SHARE_LINK_TTL and SHARE_LINK_MAX_TTL
+func loadSharing() (SharingConfig, error) {
+	var err error
+	cfg := SharingConfig{Secret: getenv("SHARE_LINK_SECRET")}
+	if cfg.Secret != "" && len(cfg.Secret) < minShareLinkSecret {
+		return cfg, fmt.Errorf("SHARE_LINK_SECRET must be at least %d characters", minShareLinkSecret)
+	}
+	if cfg.TTL, err = durationEnv("SHARE_LINK_TTL", 24*time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxTTL, err = durationEnv("SHARE_LINK_MAX_TTL", 7*24*time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.TTL <= 0 || cfg.MaxTTL < cfg.TTL {
+		return cfg, fmt.Errorf("SHARE_LINK_TTL must be positive and at most SHARE_LINK_MAX_TTL")
+	}
+	return cfg, nil
+}
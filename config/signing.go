@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// SigningConfig controls the requests partners sign with HMAC keys instead of
+// sending a credential. They are refused unless SIGNED_REQUESTS is set.
+type SigningConfig struct {
+	// Enabled accepts signed requests
+	Enabled bool
+	// File is a JSON file the signing keys are saved to; without one they
+	// are lost on restart
+	File string
+	// Window is how far a signed request's timestamp may be from the
+	// server's clock; the nonces of requests are remembered for as long
+	Window time.Duration
+	// MaxBodyBytes bounds the bodies read to check their signature, before
+	// the caller is known
+	MaxBodyBytes int
+}
+
+// loadSigning reads SIGNED_REQUESTS, SIGNING_KEYS_FILE, SIGNATURE_WINDOW and
+// SIGNED_REQUEST_MAX_BYTES
+func loadSigning() (SigningConfig, error) {
+	var err error
+	cfg := SigningConfig{File: getenv("SIGNING_KEYS_FILE")}
+	if value := getenv("SIGNED_REQUESTS"); value != "" {
+		if cfg.Enabled, err = strconv.ParseBool(value); err != nil {
+			return cfg, fmt.Errorf("invalid SIGNED_REQUESTS: %w", err)
+		}
+	}
+	if cfg.Window, err = durationEnv("SIGNATURE_WINDOW", 5*time.Minute); err != nil {
+		return cfg, err
+	}
+	if cfg.Window <= 0 {
+		return cfg, fmt.Errorf("SIGNATURE_WINDOW must be positive")
+	}
+	if cfg.MaxBodyBytes, err = intEnv("SIGNED_REQUEST_MAX_BYTES", 10<<20); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		return cfg, fmt.Errorf("SIGNED_REQUEST_MAX_BYTES must be positive")
+	}
+	return cfg, nil
+}
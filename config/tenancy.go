@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tenancy modes
+const (
+	// TenancyOff serves a single set of users
+	TenancyOff = "off"
+	// TenancyOptional scopes requests naming a tenant to its users and
+	// serves the others from the default storage
+	TenancyOptional = "optional"
+	// TenancyRequired rejects user requests that do not name a tenant
+	TenancyRequired = "required"
+)
+
+// TenancyConfig controls whether users are kept apart per tenant
+type TenancyConfig struct {
+	Mode string
+	// File is a JSON file the registered tenants are saved to; without one
+	// they are lost on restart, though their users are kept
+	File string
+}
+
+// Enabled reports whether requests may name a tenant
+func (t TenancyConfig) Enabled() bool {
+	return t.Mode != TenancyOff
+}
+
+// loadTenancy reads TENANCY and TENANTS_FILE. Tenants are stored apart in the
+// memory, json, sqlite and postgres backends; dynamodb keeps every user in one
+// table.
+func loadTenancy(driver string) (TenancyConfig, error) {
+	cfg := TenancyConfig{Mode: strings.ToLower(getenv("TENANCY")), File: getenv("TENANTS_FILE")}
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = TenancyOff
+	case TenancyOff, TenancyOptional, TenancyRequired:
+	default:
+		return cfg, fmt.Errorf("invalid TENANCY %q: expected %s, %s or %s", cfg.Mode, TenancyOff, TenancyOptional, TenancyRequired)
+	}
+	if cfg.Enabled() && driver == DriverDynamoDB {
+		return cfg, fmt.Errorf("TENANCY=%s is not supported by the %s driver", cfg.Mode, DriverDynamoDB)
+	}
+	return cfg, nil
+}
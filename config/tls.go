@@ -0,0 +1,70 @@
+package config
+
+import "fmt"
+
+// defaultAutocertCacheDir is where certificates obtained from Let's Encrypt
+// are kept when TLS_AUTOCERT_CACHE_DIR is not set
+const defaultAutocertCacheDir = "autocert-cache"
+
+// TLSConfig controls terminating TLS in the server itself. TLS is off unless
+// a certificate and key are given, or domains to obtain certificates for from
+// Let's Encrypt.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// AutocertDomains are the host names certificates are obtained for;
+	// requests for other names are refused
+	AutocertDomains []string
+	// AutocertEmail is given to Let's Encrypt to warn about expiring
+	// certificates
+	AutocertEmail string
+	// AutocertCacheDir keeps the obtained certificates across restarts,
+	// which avoids Let's Encrypt's rate limits
+	AutocertCacheDir string
+	// RedirectAddr is where plain HTTP is served, redirecting to HTTPS and
+	// answering Let's Encrypt's HTTP-01 challenges; empty disables it
+	RedirectAddr string
+}
+
+// Enabled reports whether the server terminates TLS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.Autocert()
+}
+
+// Autocert reports whether certificates are obtained from Let's Encrypt
+func (t TLSConfig) Autocert() bool {
+	return len(t.AutocertDomains) > 0
+}
+
+// loadTLS reads TLS_CERT_FILE and TLS_KEY_FILE, or TLS_AUTOCERT_DOMAINS,
+// TLS_AUTOCERT_EMAIL and TLS_AUTOCERT_CACHE_DIR, and TLS_REDIRECT_ADDR, which
+// defaults to :80 with autocert as Let's Encrypt validates domains on that
+// port
+func loadTLS() (TLSConfig, error) {
+	cfg := TLSConfig{
+		CertFile:         getenv("TLS_CERT_FILE"),
+		KeyFile:          getenv("TLS_KEY_FILE"),
+		AutocertDomains:  listEnv("TLS_AUTOCERT_DOMAINS", nil),
+		AutocertEmail:    getenv("TLS_AUTOCERT_EMAIL"),
+		AutocertCacheDir: getenv("TLS_AUTOCERT_CACHE_DIR"),
+		RedirectAddr:     getenv("TLS_REDIRECT_ADDR"),
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return cfg, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if cfg.CertFile != "" && cfg.Autocert() {
+		return cfg, fmt.Errorf("TLS_AUTOCERT_DOMAINS cannot be combined with TLS_CERT_FILE")
+	}
+	if cfg.Autocert() {
+		if cfg.AutocertCacheDir == "" {
+			cfg.AutocertCacheDir = defaultAutocertCacheDir
+		}
+		if cfg.RedirectAddr == "" {
+			cfg.RedirectAddr = ":80"
+		}
+	}
+	if cfg.RedirectAddr == "off" || !cfg.Enabled() {
+		cfg.RedirectAddr = ""
+	}
+	return cfg, nil
+}
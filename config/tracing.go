@@ -0,0 +1,20 @@
+package config
+
+import "strings"
+
+// TracingConfig controls OpenTelemetry trace export. The exporter itself is
+// configured through the standard OTEL_EXPORTER_OTLP_* variables.
+type TracingConfig struct {
+	// Enabled is true when an OTLP endpoint is configured and the SDK has
+	// not been disabled with OTEL_SDK_DISABLED
+	Enabled bool
+}
+
+func loadTracing() TracingConfig {
+	enabled := getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" ||
+		getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+	if strings.EqualFold(getenv("OTEL_SDK_DISABLED"), "true") {
+		enabled = false
+	}
+	return TracingConfig{Enabled: enabled}
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OpenAPI validation modes
+const (
+	// ValidationOff validates nothing
+	ValidationOff = "off"
+	// ValidationRequests rejects requests that do not match the OpenAPI
+	// document
+	ValidationRequests = "requests"
+	// ValidationAll also logs responses that do not match it
+	ValidationAll = "all"
+)
+
+// ValidationConfig controls checking requests and responses against the
+// served OpenAPI document, to catch drift between it and the handlers
+type ValidationConfig struct {
+	Mode string
+}
+
+// Requests reports whether requests are validated
+func (v ValidationConfig) Requests() bool {
+	return v.Mode != ValidationOff
+}
+
+// Responses reports whether responses are validated
+func (v ValidationConfig) Responses() bool {
+	return v.Mode == ValidationAll
+}
+
+// loadValidation reads OPENAPI_VALIDATION, which is meant for development
+// and tests and so is refused in production
+func loadValidation(environment string) (ValidationConfig, error) {
+	cfg := ValidationConfig{Mode: strings.ToLower(getenv("OPENAPI_VALIDATION"))}
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = ValidationOff
+	case ValidationOff, ValidationRequests, ValidationAll:
+	default:
+		return cfg, fmt.Errorf("invalid OPENAPI_VALIDATION %q: expected %s, %s or %s", cfg.Mode,
+			ValidationOff, ValidationRequests, ValidationAll)
+	}
+	if cfg.Requests() && environment == EnvProduction {
+		return cfg, fmt.Errorf("OPENAPI_VALIDATION=%s is not available in production", cfg.Mode)
+	}
+	return cfg, nil
+}
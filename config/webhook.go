@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// WebhookConfig controls webhook delivery. URLs configured here receive
+// every event in addition to endpoints registered through the API.
+type WebhookConfig struct {
+	URLs []string
+	// Secret signs deliveries to the configured URLs
+	Secret      string
+	MaxAttempts int
+	Timeout     time.Duration
+}
+
+// loadWebhooks reads WEBHOOK_URLS, WEBHOOK_SECRET and the delivery settings
+func loadWebhooks() (WebhookConfig, error) {
+	var err error
+	cfg := WebhookConfig{
+		URLs:   listEnv("WEBHOOK_URLS", nil),
+		Secret: getenv("WEBHOOK_SECRET"),
+	}
+	if cfg.MaxAttempts, err = intEnv("WEBHOOK_MAX_ATTEMPTS", 5); err != nil {
+		return cfg, err
+	}
+	if cfg.Timeout, err = durationEnv("WEBHOOK_TIMEOUT", 10*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxAttempts < 1 {
+		return cfg, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be positive")
+	}
+
+	for _, raw := range cfg.URLs {
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return cfg, fmt.Errorf("invalid WEBHOOK_URLS entry %q: expected an http or https URL", raw)
+		}
+	}
+	if len(cfg.URLs) > 0 && cfg.Secret == "" {
+		return cfg, fmt.Errorf("WEBHOOK_SECRET is required when WEBHOOK_URLS is set")
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,172 @@
+// Package contract checks requests and responses against the served OpenAPI
+// document, so drift between the document and the handlers shows up in
+// development and tests rather than in clients.
+package contract
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"userprofile-api/apierror"
+	"userprofile-api/config"
+	"userprofile-api/negotiate"
+)
+
+// Validator matches requests to the operations of an OpenAPI document and
+// validates them, and optionally their responses, against it
+type Validator struct {
+	router    routers.Router
+	responses bool
+	logger    *slog.Logger
+}
+
+// New loads the OpenAPI document in spec, which must itself be valid
+func New(spec []byte, cfg config.ValidationConfig, logger *slog.Logger) (*Validator, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("load OpenAPI document: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	// The probes are served outside the API's base path, and the router would
+	// apply their servers to the paths matched after them too
+	for path, item := range doc.Paths.Map() {
+		if len(item.Servers) > 0 {
+			doc.Paths.Delete(path)
+		}
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("route OpenAPI document: %w", err)
+	}
+	return &Validator{router: router, responses: cfg.Responses(), logger: logger}, nil
+}
+
+// Middleware rejects requests that do not match their operation in the
+// document with 400 CONTRACT_VIOLATION and, when responses are validated,
+// logs the responses that do not match it. Routes the document does not
+// describe are logged and served as usual. Authentication is left to the
+// handlers' own middleware.
+func (v *Validator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route, params, err := v.router.FindRoute(c.Request)
+		if err != nil {
+			if c.FullPath() != "" {
+				v.logger.Warn("route is missing from the OpenAPI document",
+					"method", c.Request.Method, "route", c.FullPath())
+			}
+			c.Next()
+			return
+		}
+
+		options := &openapi3filter.Options{
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			// MessagePack bodies are bound like JSON but cannot be decoded
+			// by the validator, and NDJSON bodies are read as a stream
+			// rather than held in memory
+			ExcludeRequestBody: isMsgpack(c.ContentType()) || c.ContentType() == negotiate.NDJSONContentType,
+			// Every status a handler returns should be documented
+			IncludeResponseStatus: true,
+		}
+		options.WithCustomSchemaErrorFunc(schemaError)
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: params,
+			Route:      route,
+			Options:    options,
+		}
+		if err := openapi3filter.ValidateRequest(c.Request.Context(), input); err != nil {
+			apierror.Abort(c, http.StatusBadRequest, apierror.CodeContractViolation,
+				"The request does not match the API specification", gin.H{"error": err.Error()})
+			return
+		}
+
+		if !v.responses {
+			c.Next()
+			return
+		}
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+		c.Writer = recorder.ResponseWriter
+
+		if !validatedResponse(c.Writer.Status(), c.Writer.Header().Get("Content-Type")) {
+			return
+		}
+		response := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 c.Writer.Status(),
+			Header:                 c.Writer.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(recorder.body.Bytes())),
+			Options:                options,
+		}
+		if err := openapi3filter.ValidateResponse(c.Request.Context(), response); err != nil {
+			v.logger.Error("response does not match the OpenAPI document",
+				"method", c.Request.Method, "route", route.Path, "status", c.Writer.Status(), "error", err)
+		}
+	}
+}
+
+// schemaError describes a value that does not match its schema without
+// quoting the whole schema
+func schemaError(err *openapi3.SchemaError) string {
+	return fmt.Sprintf("value at /%s %s", strings.Join(err.JSONPointer(), "/"), err.Reason)
+}
+
+// validatedResponse reports whether a response is checked: JSON responses
+// other than server errors, which are not documented for every operation
+func validatedResponse(status int, contentType string) bool {
+	if status >= http.StatusInternalServerError {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == binding.MIMEJSON || mediaType == apierror.ProblemJSONContentType)
+}
+
+func isMsgpack(contentType string) bool {
+	return contentType == binding.MIMEMSGPACK || contentType == binding.MIMEMSGPACK2
+}
+
+// bodyRecorder copies the response body as it is written, when the
+// response is validated, so that streamed responses are not held in memory
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(data []byte) (int, error) {
+	if w.recorded() {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	if w.recorded() {
+		w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *bodyRecorder) recorded() bool {
+	return validatedResponse(w.Status(), w.Header().Get("Content-Type"))
+}
+
+// Unwrap returns the recorded writer, for http.ResponseController
+func (w *bodyRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/backup"
+	"userprofile-api/config"
+	"userprofile-api/metrics"
+	"userprofile-api/repository"
+	"userprofile-api/seed"
+)
+
+// AdminController serves the operational endpoints of the admin API
+type AdminController struct {
+	// repo is used for resets and statistics, and users, which publishes
+	// change events, for reseeding
+	repo    repository.UserRepository
+	users   repository.UserRepository
+	backups *backup.Manager
+	seed    config.SeedConfig
+	driver  string
+	// purge empties the response cache, which resets bypass since they
+	// publish no events
+	purge func()
+	// metrics holds the runtime and request metrics reported by Stats
+	metrics *metrics.Metrics
+}
+
+// NewAdminController creates a controller for the given repositories
+func NewAdminController(repo, users repository.UserRepository, backups *backup.Manager, seedCfg config.SeedConfig,
+	driver string, purge func(), appMetrics *metrics.Metrics) *AdminController {
+	return &AdminController{repo: repo, users: users, backups: backups, seed: seedCfg, driver: driver, purge: purge,
+		metrics: appMetrics}
+}
+
+// reseedResult reports the outcome of a reseed
+type reseedResult struct {
+	XMLName struct{} `json:"-" yaml:"-" xml:"reseed"`
+	Source  string   `json:"source" xml:"source" yaml:"source"`
+	Created int      `json:"created" xml:"created" yaml:"created"`
+	Skipped int      `json:"skipped" xml:"skipped" yaml:"skipped"`
+}
+
+// adminStats summarizes the state of the service
+type adminStats struct {
+	XMLName  struct{}             `json:"-" yaml:"-" xml:"stats"`
+	Users    userStats            `json:"users" xml:"users" yaml:"users"`
+	Storage  storageStats         `json:"storage" xml:"storage" yaml:"storage"`
+	Backups  backupStats          `json:"backups" xml:"backups" yaml:"backups"`
+	Runtime  metrics.RuntimeStats `json:"runtime" xml:"runtime" yaml:"runtime"`
+	Requests metrics.RequestStats `json:"requests" xml:"requests" yaml:"requests"`
+}
+
+type userStats struct {
+	Active  int `json:"active" xml:"active" yaml:"active"`
+	Deleted int `json:"deleted" xml:"deleted" yaml:"deleted"`
+	Total   int `json:"total" xml:"total" yaml:"total"`
+}
+
+type storageStats struct {
+	Driver string `json:"driver" xml:"driver" yaml:"driver"`
+	// Status is "up" or "down"
+	Status    string `json:"status" xml:"status" yaml:"status"`
+	LatencyMs *int64 `json:"latencyMs,omitempty" xml:"latencyMs,omitempty" yaml:"latencyMs,omitempty"`
+	Error     string `json:"error,omitempty" xml:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type backupStats struct {
+	Count  int    `json:"count" xml:"count" yaml:"count"`
+	Latest string `json:"latest,omitempty" xml:"latest,omitempty" yaml:"latest,omitempty"`
+	Error  string `json:"error,omitempty" xml:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Reset permanently removes every user, deleted ones included. No events
+// are published for the removed users.
+func (ac *AdminController) Reset(c *gin.Context) {
+	if err := repository.Reset(c.Request.Context(), ac.repo); err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+	ac.purge()
+	c.Status(http.StatusNoContent)
+}
+
+// Reseed adds the seed users, from SEED_FILE or the demo users, skipping
+// those whose ID exists. With reset=true the repository is reset first.
+func (ac *AdminController) Reseed(c *gin.Context) {
+	reset := false
+	if value := c.Query("reset"); value != "" {
+		var err error
+		if reset, err = strconv.ParseBool(value); err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter,
+				"reset must be true or false", gin.H{"parameter": "reset", "value": value})
+			return
+		}
+	}
+
+	users, source, err := seed.Users(ac.seed)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	if reset {
+		if err := repository.Reset(c.Request.Context(), ac.repo); err != nil {
+			respondWithRepositoryError(c, err)
+			return
+		}
+		ac.purge()
+	}
+
+	created, err := seed.Apply(c.Request.Context(), ac.users, users)
+	if errors.Is(err, repository.ErrEmailConflict) {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeEmailAlreadyInUse, err.Error(), gin.H{"source": source})
+		return
+	}
+	if err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, reseedResult{Source: source, Created: created, Skipped: len(users) - created}, nil)
+}
+
+// Stats reports user counts, storage health, stored backups, and the
+// runtime and request metrics also exported to Prometheus
+func (ac *AdminController) Stats(c *gin.Context) {
+	var stats adminStats
+	var err error
+	if _, stats.Users.Active, err = ac.repo.List(c.Request.Context(), repository.ListOptions{Limit: 1}); err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	if _, stats.Users.Total, err = ac.repo.List(c.Request.Context(), repository.ListOptions{Limit: 1, IncludeDeleted: true}); err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	stats.Users.Deleted = stats.Users.Total - stats.Users.Active
+
+	stats.Storage = storageStats{Driver: ac.driver, Status: "up"}
+	if latency, pinged, err := pingStorage(c.Request.Context(), ac.repo); pinged {
+		ms := latency.Milliseconds()
+		stats.Storage.LatencyMs = &ms
+		if err != nil {
+			stats.Storage.Status = "down"
+			stats.Storage.Error = err.Error()
+		}
+	}
+
+	names, err := ac.backups.List(c.Request.Context())
+	if err != nil {
+		stats.Backups.Error = err.Error()
+	}
+	stats.Backups.Count = len(names)
+	if len(names) > 0 {
+		stats.Backups.Latest = names[len(names)-1]
+	}
+
+	snapshot, err := ac.metrics.Snapshot()
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	stats.Runtime, stats.Requests = snapshot.Runtime, snapshot.Requests
+
+	respond(c, http.StatusOK, stats, nil)
+}
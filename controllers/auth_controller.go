@@ -0,0 +1,335 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"userprofile-api/apierror"
+	"userprofile-api/auth"
+	"userprofile-api/config"
+	"userprofile-api/credentials"
+	"userprofile-api/i18n"
+	"userprofile-api/models"
+	"userprofile-api/quota"
+	"userprofile-api/replica"
+	"userprofile-api/repository"
+	"userprofile-api/tenant"
+)
+
+// AuthController registers users with password-based accounts and logs them
+// in and out, issuing JWTs the rest of the API accepts along with refresh
+// tokens that renew them
+type AuthController struct {
+	users    *UserController
+	store    *credentials.Store
+	sessions *credentials.Sessions
+	tokens   *auth.JWTAuthenticator
+	cfg      config.PasswordConfig
+	// attempts counts the logins and registrations of each client, and the
+	// logins of each account
+	attempts *quota.Limiter
+	// dummyHash is verified when the email is unknown, so that the response
+	// time does not tell which emails have accounts
+	dummyHash string
+}
+
+// NewAuthController creates a controller creating users through the user
+// controller, keeping their passwords in store and their logins in sessions,
+// and signing their tokens with tokens
+func NewAuthController(users *UserController, store *credentials.Store, sessions *credentials.Sessions,
+	tokens *auth.JWTAuthenticator, cfg config.PasswordConfig) *AuthController {
+	dummyHash, err := credentials.Hash(cfg.Hash, uuid.NewString())
+	if err != nil {
+		panic(err)
+	}
+	return &AuthController{
+		users:     users,
+		store:     store,
+		sessions:  sessions,
+		tokens:    tokens,
+		cfg:       cfg,
+		attempts:  quota.New(config.QuotaConfig{RateLimit: cfg.LoginAttempts, RateWindow: cfg.LoginWindow}),
+		dummyHash: dummyHash,
+	}
+}
+
+// authToken is the response of a successful registration, login or refresh
+type authToken struct {
+	XMLName     xml.Name  `json:"-" yaml:"-" xml:"token"`
+	AccessToken string    `json:"accessToken" xml:"accessToken" yaml:"accessToken"`
+	TokenType   string    `json:"tokenType" xml:"tokenType" yaml:"tokenType"`
+	ExpiresIn   int       `json:"expiresIn" xml:"expiresIn" yaml:"expiresIn"`
+	ExpiresAt   time.Time `json:"expiresAt" xml:"expiresAt" yaml:"expiresAt"`
+	// RefreshToken renews the access token once, and is replaced by the
+	// refresh token of the response
+	RefreshToken          string    `json:"refreshToken" xml:"refreshToken" yaml:"refreshToken"`
+	RefreshTokenExpiresAt time.Time `json:"refreshTokenExpiresAt" xml:"refreshTokenExpiresAt" yaml:"refreshTokenExpiresAt"`
+	// User is the registered user, in the representation of the request's
+	// API version
+	User any `json:"user,omitempty" xml:"user,omitempty" yaml:"user,omitempty"`
+}
+
+// passwordBody is the password sent along with a registration
+type passwordBody struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// loginRequest is the body of a login
+type loginRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+// refreshRequest is the body of a refresh or logout
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// Register creates a user from the profile in the body, in the
+// representation of the request's API version, with the password sent along
+// with it, and logs it in. IDs are always generated. Passwords that are too
+// weak are rejected with 400 WEAK_PASSWORD.
+func (ac *AuthController) Register(c *gin.Context) {
+	if !ac.allow(c, "client:"+c.ClientIP()) {
+		return
+	}
+
+	// The body is read twice, for the password and the profile
+	bindBody := func(obj any) error { return c.ShouldBindBodyWith(obj, binding.JSON) }
+	var body passwordBody
+	if err := bindBody(&body); err != nil {
+		respondWithBindError(c, err)
+		return
+	}
+	var newUser models.UserProfile
+	if err := ac.users.decodeUser(c, &newUser, bindBody); err != nil {
+		respondWithBindError(c, err)
+		return
+	}
+	// IDs are always generated
+	newUser.ID = ""
+
+	err := credentials.CheckStrength(body.Password, ac.cfg.MinLength, newUser.FullName, newUser.Email)
+	var weakErr *credentials.WeakPasswordError
+	if errors.As(err, &weakErr) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeWeakPassword, "Password is too weak",
+			gin.H{"reasons": weakErr.Reasons})
+		return
+	}
+	hash, err := credentials.Hash(ac.cfg.Hash, body.Password)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	users := ac.users.service(c)
+	if !checkUserQuota(c, users.Repository(), 1) {
+		return
+	}
+	created, err := users.Create(c.Request.Context(), newUser)
+	if err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+	if err := ac.store.Set(tenant.ID(c), created.ID, hash); err != nil {
+		// A user that cannot log in would keep its email from registering
+		// again
+		if deleteErr := users.Delete(c.Request.Context(), created.ID); deleteErr != nil {
+			log.Printf("Failed to delete user %s without credentials: %v", created.ID, deleteErr)
+		}
+		apierror.Internal(c, err)
+		return
+	}
+
+	token, ok := ac.login(c, created)
+	if !ok {
+		return
+	}
+	token.User = userBody(c, created)
+	setETag(c, created)
+	respond(c, http.StatusCreated, token, nil)
+}
+
+// Login issues a token to the user with the email and password in the body.
+// Unknown emails and wrong passwords are answered alike with 401, and users
+// that are not active with 403. Each client, and each account, may attempt a
+// limited number of logins per window; further attempts are rejected with
+// 429 and a Retry-After header.
+func (ac *AuthController) Login(c *gin.Context) {
+	if !ac.allow(c, "client:"+c.ClientIP()) {
+		return
+	}
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithBindError(c, err)
+		return
+	}
+	tenantID := tenant.ID(c)
+	if !ac.allow(c, "account:"+tenantID+"/"+strings.ToLower(req.Email)) {
+		return
+	}
+
+	user, err := ac.users.service(c).GetByEmail(c.Request.Context(), req.Email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		apierror.Internal(c, err)
+		return
+	}
+	hash, hashErr := ac.dummyHash, credentials.ErrNotFound
+	if err == nil {
+		hash, hashErr = ac.store.Get(tenantID, user.ID)
+		if hashErr != nil {
+			hash = ac.dummyHash
+		}
+	}
+	err = credentials.Verify(hash, req.Password)
+	if errors.Is(err, credentials.ErrMismatch) || (err == nil && hashErr != nil) {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid email or password", nil)
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	if user.Status != models.StatusActive {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, i18n.Tf(c, "This account is {{.Status}}",
+			map[string]any{"Status": user.Status}), gin.H{"status": user.Status})
+		return
+	}
+
+	// Passwords hashed before the algorithm or its parameters changed are
+	// upgraded while the plain password is at hand
+	if credentials.NeedsRehash(hash, ac.cfg.Hash) && !replica.ReadOnly(c) {
+		if upgraded, err := credentials.Hash(ac.cfg.Hash, req.Password); err == nil {
+			if err := ac.store.Set(tenantID, user.ID, upgraded); err != nil {
+				log.Printf("Failed to rehash the password of user %s: %v", user.ID, err)
+			}
+		}
+	}
+
+	token, ok := ac.login(c, user)
+	if !ok {
+		return
+	}
+	respond(c, http.StatusOK, token, nil)
+}
+
+// Refresh issues a new access token for the session of the refresh token in
+// the body, replacing the refresh token. Refresh tokens that are unknown,
+// expired, revoked or already used are rejected with 401; using one twice
+// revokes its session, since it must have been stolen. Sessions of users that
+// were deleted or are no longer active are revoked too.
+func (ac *AuthController) Refresh(c *gin.Context) {
+	if !ac.allow(c, "client:"+c.ClientIP()) {
+		return
+	}
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithBindError(c, err)
+		return
+	}
+
+	tenantID := tenant.ID(c)
+	session, refreshToken, err := ac.sessions.Refresh(tenantID, req.RefreshToken)
+	if errors.Is(err, credentials.ErrInvalidToken) {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid or expired refresh token", nil)
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	user, err := ac.users.service(c).Get(c.Request.Context(), session.UserID)
+	if err == nil && user.Status != models.StatusActive {
+		err = repository.ErrNotFound
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		if err := ac.sessions.RevokeUser(tenantID, session.UserID); err != nil {
+			log.Printf("Failed to revoke the sessions of user %s: %v", session.UserID, err)
+		}
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid or expired refresh token", nil)
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	token, ok := ac.issue(c, user, session, refreshToken)
+	if !ok {
+		return
+	}
+	respond(c, http.StatusOK, token, nil)
+}
+
+// Logout revokes the session of the refresh token in the body, along with
+// the access tokens issued for it. Tokens of no live session are ignored, so
+// logging out twice succeeds.
+func (ac *AuthController) Logout(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithBindError(c, err)
+		return
+	}
+	if err := ac.sessions.Revoke(tenant.ID(c), req.RefreshToken); err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// login starts a session for user and issues its tokens, answering with 500
+// and reporting false when it cannot
+func (ac *AuthController) login(c *gin.Context, user models.UserProfile) (authToken, bool) {
+	session, refreshToken, err := ac.sessions.Start(tenant.ID(c), user.ID)
+	if err != nil {
+		apierror.Internal(c, err)
+		return authToken{}, false
+	}
+	return ac.issue(c, user, session, refreshToken)
+}
+
+// issue signs an access token for user granting the configured role, issued
+// for session and bound to its tenant, and returns it with the session's
+// refresh token, answering with 500 and reporting false when it cannot
+func (ac *AuthController) issue(c *gin.Context, user models.UserProfile, session credentials.Session,
+	refreshToken string) (authToken, bool) {
+	signed, expires, err := ac.tokens.Issue(user.ID, session.Tenant, session.ID, []string{ac.cfg.Role}, ac.cfg.TokenTTL)
+	if err != nil {
+		apierror.Internal(c, err)
+		return authToken{}, false
+	}
+	c.Header("Cache-Control", "no-store")
+	return authToken{
+		AccessToken:           signed,
+		TokenType:             "Bearer",
+		ExpiresIn:             int(ac.cfg.TokenTTL.Seconds()),
+		ExpiresAt:             expires.UTC(),
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: session.ExpiresAt,
+	}, true
+}
+
+// allow counts an attempt by the named client or account, answering with
+// 429 and reporting false when it is over the limit
+func (ac *AuthController) allow(c *gin.Context, name string) bool {
+	allowed, status := ac.attempts.Allow(name)
+	if allowed {
+		return true
+	}
+	retryAfter := int(time.Until(status.Reset).Seconds() + 1)
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	apierror.Respond(c, http.StatusTooManyRequests, apierror.CodeRateLimitExceeded,
+		"Too many attempts; retry after the window resets",
+		gin.H{"limit": status.Limit, "windowSeconds": int(ac.cfg.LoginWindow.Seconds()), "retryAfterSeconds": retryAfter})
+	return false
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/avatar"
+	"userprofile-api/config"
+	"userprofile-api/service"
+	"userprofile-api/tenant"
+)
+
+// avatarFormField is the multipart field holding the uploaded image
+const avatarFormField = "avatar"
+
+// multipartOverhead allows for the multipart headers and boundaries around
+// the file when limiting the request body
+const multipartOverhead = 64 << 10
+
+// AvatarController handles uploading and serving user avatars
+type AvatarController struct {
+	users *service.UserService
+	store avatar.Store
+	cfg   config.AvatarConfig
+}
+
+// NewAvatarController creates a controller storing avatars in store and
+// pointing users at them through the user service
+func NewAvatarController(users *service.UserService, store avatar.Store, cfg config.AvatarConfig) *AvatarController {
+	return &AvatarController{users: users, store: store, cfg: cfg}
+}
+
+// UploadAvatar accepts a multipart image upload, scales it down and stores
+// it as the user's avatar
+func (ac *AvatarController) UploadAvatar(c *gin.Context) {
+	id := c.Param("id")
+	users := tenantService(c, ac.users)
+
+	// Check the user first so uploads for unknown users are never stored
+	if _, err := users.Get(c.Request.Context(), id); err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(ac.cfg.MaxBytes)+multipartOverhead)
+	file, _, err := c.Request.FormFile(avatarFormField)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			ac.respondTooLarge(c)
+			return
+		}
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAvatar,
+			fmt.Sprintf("Expected a multipart form with an %q file", avatarFormField), err.Error())
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, int64(ac.cfg.MaxBytes)+1))
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	if len(data) > ac.cfg.MaxBytes {
+		ac.respondTooLarge(c)
+		return
+	}
+
+	processed, err := avatar.Process(data, ac.cfg.Size)
+	if errors.Is(err, avatar.ErrUnsupportedType) {
+		apierror.Respond(c, http.StatusUnsupportedMediaType, apierror.CodeInvalidAvatar,
+			"Avatar must be a PNG, JPEG, GIF or WebP image", gin.H{"accepted": avatar.AcceptedTypes})
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	if err := ac.store.Put(c.Request.Context(), avatar.Key(tenant.ID(c), id), processed); err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	user, err := users.SetAvatarURL(c.Request.Context(), id, "/api/v1/users/"+url.PathEscape(id)+"/avatar")
+	if err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+
+	setETag(c, user)
+	renderUser(c, http.StatusOK, user)
+}
+
+func (ac *AvatarController) respondTooLarge(c *gin.Context) {
+	apierror.Respond(c, http.StatusRequestEntityTooLarge, apierror.CodeAvatarTooLarge,
+		"Avatar file is too large", gin.H{"maxBytes": ac.cfg.MaxBytes})
+}
+
+// GetAvatar serves the user's avatar image
+func (ac *AvatarController) GetAvatar(c *gin.Context) {
+	id := c.Param("id")
+
+	user, err := tenantService(c, ac.users).Get(c.Request.Context(), id)
+	if err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+	if user.AvatarURL == "" {
+		respondAvatarNotFound(c)
+		return
+	}
+
+	image, err := ac.store.Get(c.Request.Context(), avatar.Key(tenant.ID(c), id))
+	if errors.Is(err, avatar.ErrNotFound) {
+		respondAvatarNotFound(c)
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	defer image.Close()
+
+	c.DataFromReader(http.StatusOK, -1, avatar.ContentType, image, map[string]string{
+		"Cache-Control": "private, no-cache",
+	})
+}
+
+func respondAvatarNotFound(c *gin.Context) {
+	apierror.Respond(c, http.StatusNotFound, apierror.CodeAvatarNotFound, "User has no avatar", gin.H{"id": c.Param("id")})
+}
@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/backup"
+)
+
+// BackupController triggers backups of the user store on demand
+type BackupController struct {
+	backups *backup.Manager
+}
+
+// NewBackupController creates a controller for the given backup manager
+func NewBackupController(backups *backup.Manager) *BackupController {
+	return &BackupController{backups: backups}
+}
+
+// CreateBackup takes a backup now and describes it
+func (bc *BackupController) CreateBackup(c *gin.Context) {
+	snapshot, err := bc.backups.Create(c.Request.Context())
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	respond(c, http.StatusCreated, snapshot, nil)
+}
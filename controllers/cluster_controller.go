@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/config"
+	"userprofile-api/replica"
+)
+
+// ClusterController describes the server's role in a deployment of a primary
+// and read replicas
+type ClusterController struct {
+	cfg config.ReplicaConfig
+	// syncer is nil unless the server is a replica receiving the primary's
+	// events
+	syncer *replica.Syncer
+}
+
+// NewClusterController creates a controller for the given configuration and
+// syncer, which may be nil
+func NewClusterController(cfg config.ReplicaConfig, syncer *replica.Syncer) *ClusterController {
+	return &ClusterController{cfg: cfg, syncer: syncer}
+}
+
+// clusterStatus is the server's role and, on replicas, where their users come
+// from
+type clusterStatus struct {
+	XMLName struct{} `json:"-" yaml:"-" xml:"cluster"`
+	Role    string   `json:"role" xml:"role" yaml:"role"`
+	// ReadOnly is whether changes to users are refused
+	ReadOnly    bool               `json:"readOnly" xml:"readOnly" yaml:"readOnly"`
+	PrimaryURL  string             `json:"primaryUrl,omitempty" xml:"primaryUrl,omitempty" yaml:"primaryUrl,omitempty"`
+	Replication *replicationStatus `json:"replication,omitempty" xml:"replication,omitempty" yaml:"replication,omitempty"`
+}
+
+type replicationStatus struct {
+	Broker string `json:"broker" xml:"broker" yaml:"broker"`
+	Topic  string `json:"topic" xml:"topic" yaml:"topic"`
+	// Group is only used with Kafka
+	Group         string `json:"group,omitempty" xml:"group,omitempty" yaml:"group,omitempty"`
+	replica.Stats `yaml:",inline"`
+}
+
+// Status reports the server's role and, on replicas receiving the primary's
+// events, how replication is going
+func (cc *ClusterController) Status(c *gin.Context) {
+	status := clusterStatus{Role: cc.cfg.Role, ReadOnly: cc.cfg.ReadOnly()}
+	if cc.cfg.ReadOnly() {
+		status.PrimaryURL = cc.cfg.PrimaryURL
+	}
+	if cc.syncer != nil {
+		status.Replication = &replicationStatus{Broker: cc.cfg.Broker, Topic: cc.cfg.Topic, Stats: cc.syncer.Stats()}
+		if cc.cfg.Broker == config.BrokerKafka {
+			status.Replication.Group = cc.cfg.Group
+		}
+	}
+	respond(c, http.StatusOK, status, nil)
+}
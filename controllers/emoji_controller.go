@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/emoji"
+)
+
+// Values of the emoji_format query parameter
+const (
+	EmojiFormatUnicode   = "unicode"
+	EmojiFormatShortcode = "shortcode"
+)
+
+// emojiFormatKey is the gin context key holding the request's emoji format
+const emojiFormatKey = "emojiFormat"
+
+// EmojiFormat parses the emoji_format query parameter of user reads:
+// "unicode", the default, renders emoji as stored, and "shortcode" renders
+// those with a shortcode as :name:
+func EmojiFormat() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch format := c.DefaultQuery("emoji_format", EmojiFormatUnicode); format {
+		case EmojiFormatUnicode, EmojiFormatShortcode:
+			c.Set(emojiFormatKey, format)
+			c.Next()
+		default:
+			apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter,
+				fmt.Sprintf("emoji_format must be %q or %q", EmojiFormatUnicode, EmojiFormatShortcode),
+				gin.H{"parameter": "emoji_format"})
+		}
+	}
+}
+
+// wantsShortcodes reports whether the request asked for emoji as shortcodes
+func wantsShortcodes(c *gin.Context) bool {
+	return c.GetString(emojiFormatKey) == EmojiFormatShortcode
+}
+
+// shortcodeBody is an emoji with its shortcode
+type shortcodeBody struct {
+	XMLName   struct{} `json:"-" yaml:"-" xml:"emoji"`
+	Shortcode string   `json:"shortcode" xml:"shortcode,attr" yaml:"shortcode"`
+	Emoji     string   `json:"emoji" xml:",chardata" yaml:"emoji"`
+}
+
+// ListEmojis returns the known emoji shortcodes, ordered by name. Users may
+// have any single emoji, including ones without a shortcode.
+func ListEmojis(c *gin.Context) {
+	shortcodes := emoji.Shortcodes()
+	bodies := make([]shortcodeBody, 0, len(shortcodes))
+	for _, shortcode := range shortcodes {
+		bodies = append(bodies, shortcodeBody{Shortcode: ":" + shortcode.Name + ":", Emoji: shortcode.Emoji})
+	}
+	respond(c, http.StatusOK, bodies, nil)
+}
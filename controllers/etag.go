@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/conditional"
+	"userprofile-api/models"
+)
+
+// etag formats a user's version as a strong entity tag
+func etag(user models.UserProfile) string {
+	return `"` + strconv.Itoa(user.Version) + `"`
+}
+
+// setETag exposes the user's version in the ETag header
+func setETag(c *gin.Context, user models.UserProfile) {
+	c.Header("ETag", etag(user))
+}
+
+// listETag derives a weak entity tag from a page of users and the total, so
+// it changes whenever the listed users or the pagination links would
+func listETag(users []models.UserProfile, total int) string {
+	hash := sha256.New()
+	json.NewEncoder(hash).Encode(users)
+	fmt.Fprintf(hash, "%d", total)
+	return `W/"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// notModified sets the validators of a GET response and, when the client's
+// cached copy is still current, answers 304 Not Modified and returns true.
+// Responses must be revalidated before reuse so that clients polling with
+// If-None-Match or If-Modified-Since see changes immediately.
+func notModified(c *gin.Context, etag string, lastModified time.Time) bool {
+	c.Header("ETag", etag)
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	c.Header("Cache-Control", "no-cache")
+
+	if conditional.NotModified(c.Request, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+var errMissingIfMatch = errors.New("missing If-Match header")
+
+// ifMatch holds the parsed If-Match request header
+type ifMatch struct {
+	// any is set for "If-Match: *", which matches every existing user
+	any bool
+	// versions lists the versions named by the entity tags
+	versions []int
+}
+
+// matches reports whether the header allows updating the given version
+func (m ifMatch) matches(version int) bool {
+	return m.any || slices.Contains(m.versions, version)
+}
+
+// parseIfMatch reads the If-Match header. Weak and malformed entity tags can
+// never match under the strong comparison If-Match requires, so they are
+// skipped.
+func parseIfMatch(c *gin.Context) (ifMatch, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		return ifMatch{}, errMissingIfMatch
+	}
+	if header == "*" {
+		return ifMatch{any: true}, nil
+	}
+
+	var m ifMatch
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		if version, err := strconv.Atoi(tag[1 : len(tag)-1]); err == nil && version > 0 {
+			m.versions = append(m.versions, version)
+		}
+	}
+	return m, nil
+}
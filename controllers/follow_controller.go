@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/follow"
+	"userprofile-api/replica"
+	"userprofile-api/repository"
+	"userprofile-api/tenant"
+)
+
+// FollowController handles users following each other
+type FollowController struct {
+	repo  repository.UserRepository
+	store *follow.Store
+}
+
+// NewFollowController creates a controller keeping relationships in store
+// between the users of the given repository
+func NewFollowController(repo repository.UserRepository, store *follow.Store) *FollowController {
+	return &FollowController{repo: repo, store: store}
+}
+
+// Follow makes the user follow the target user. Both must be active users.
+func (fc *FollowController) Follow(c *gin.Context) {
+	id, targetID := c.Param("id"), c.Param("targetId")
+	// Replicas keep no relationships of their own to change
+	if replica.ReadOnly(c) {
+		respondWithRepositoryError(c, repository.ErrReadOnly)
+		return
+	}
+	if id == targetID {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeCannotFollowSelf, "Users cannot follow themselves", gin.H{"id": id})
+		return
+	}
+	if !fc.usersExist(c, id, targetID) {
+		return
+	}
+
+	created, err := fc.store.Follow(tenant.ID(c), id, targetID)
+	switch {
+	case errors.Is(err, follow.ErrConflict):
+		apierror.Respond(c, http.StatusConflict, apierror.CodeAlreadyFollowing, "The user already follows the target user",
+			gin.H{"id": id, "targetId": targetID})
+	case err != nil:
+		apierror.Internal(c, err)
+	default:
+		respond(c, http.StatusCreated, created, nil)
+	}
+}
+
+// Unfollow stops the user following the target user. Relationships with
+// deleted users can still be removed.
+func (fc *FollowController) Unfollow(c *gin.Context) {
+	id, targetID := c.Param("id"), c.Param("targetId")
+	if replica.ReadOnly(c) {
+		respondWithRepositoryError(c, repository.ErrReadOnly)
+		return
+	}
+
+	err := fc.store.Unfollow(tenant.ID(c), id, targetID)
+	switch {
+	case errors.Is(err, follow.ErrNotFound):
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFollowing, "The user does not follow the target user",
+			gin.H{"id": id, "targetId": targetID})
+	case err != nil:
+		apierror.Internal(c, err)
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// GetFollowers returns a page of the relationships of the users following
+// the user, newest first, only those with friends when mutual is true
+func (fc *FollowController) GetFollowers(c *gin.Context) {
+	fc.list(c, fc.store.Followers)
+}
+
+// GetFollowing returns a page of the relationships of the user with the
+// users it follows, newest first, only those with friends when mutual is true
+func (fc *FollowController) GetFollowing(c *gin.Context) {
+	fc.list(c, fc.store.Following)
+}
+
+func (fc *FollowController) list(c *gin.Context, relationships func(tenant, userID string, opts follow.ListOptions) ([]follow.Follow, int)) {
+	id := c.Param("id")
+	page, err := parsePagination(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter, err.Error(), nil)
+		return
+	}
+	pageOpts := page.listOptions()
+	opts := follow.ListOptions{Offset: pageOpts.Offset, Limit: pageOpts.Limit}
+	if value := c.Query("mutual"); value != "" {
+		if opts.Mutual, err = strconv.ParseBool(value); err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter,
+				"mutual must be true or false", gin.H{"parameter": "mutual"})
+			return
+		}
+	}
+	if !fc.usersExist(c, id) {
+		return
+	}
+
+	follows, total := relationships(tenant.ID(c), id, opts)
+	setPaginationHeaders(c, page, total)
+	respond(c, http.StatusOK, follows, page.meta(total))
+}
+
+// usersExist responds with 404 and returns false unless every ID names an
+// active user of the request's tenant
+func (fc *FollowController) usersExist(c *gin.Context, ids ...string) bool {
+	repo := tracedRepository(c, fc.repo)
+	for _, id := range ids {
+		_, err := repo.Get(c.Request.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found", gin.H{"id": id})
+			return false
+		}
+		if err != nil {
+			apierror.Internal(c, err)
+			return false
+		}
+	}
+	return true
+}
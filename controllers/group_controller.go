@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"userprofile-api/apierror"
+	"userprofile-api/models"
+	"userprofile-api/negotiate"
+	"userprofile-api/replica"
+	"userprofile-api/repository"
+	"userprofile-api/tenant"
+)
+
+// GroupController handles groups of users, such as teams, and their members
+type GroupController struct {
+	repo   repository.UserRepository
+	groups *repository.Groups
+}
+
+// NewGroupController creates a controller keeping the groups of the users of
+// the given repository in groups
+func NewGroupController(repo repository.UserRepository, groups *repository.Groups) *GroupController {
+	return &GroupController{repo: repo, groups: groups}
+}
+
+// repository returns the group repository of the request's tenant
+func (gc *GroupController) repository(c *gin.Context) repository.GroupRepository {
+	return gc.groups.Tenant(tenant.ID(c))
+}
+
+// GetGroups returns a page of the groups ordered by name
+func (gc *GroupController) GetGroups(c *gin.Context) {
+	page, err := parsePagination(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter, err.Error(), nil)
+		return
+	}
+	opts := page.listOptions()
+	groups, total, err := gc.repository(c).List(c.Request.Context(), opts.Offset, opts.Limit)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	setPaginationHeaders(c, page, total)
+	respond(c, http.StatusOK, groups, page.meta(total))
+}
+
+// GetGroup returns the group with the given ID
+func (gc *GroupController) GetGroup(c *gin.Context) {
+	group, err := gc.repository(c).Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondWithGroupError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, group, nil)
+}
+
+// CreateGroup adds a new group. A UUID is generated when the request does
+// not supply an ID; an explicit ID that is already taken is rejected with
+// 409.
+func (gc *GroupController) CreateGroup(c *gin.Context) {
+	if replica.ReadOnly(c) {
+		respondWithRepositoryError(c, repository.ErrReadOnly)
+		return
+	}
+	var group models.Group
+	if err := negotiate.Bind(c, &group); err != nil {
+		respondWithBindError(c, err)
+		return
+	}
+	if group.ID == "" {
+		group.ID = uuid.NewString()
+	}
+
+	created, err := gc.repository(c).Create(c.Request.Context(), group)
+	if err != nil {
+		respondWithGroupError(c, err)
+		return
+	}
+	respond(c, http.StatusCreated, created, nil)
+}
+
+// UpdateGroup replaces the name and description of the group with the given
+// ID
+func (gc *GroupController) UpdateGroup(c *gin.Context) {
+	if replica.ReadOnly(c) {
+		respondWithRepositoryError(c, repository.ErrReadOnly)
+		return
+	}
+	var group models.Group
+	if err := negotiate.Bind(c, &group); err != nil {
+		respondWithBindError(c, err)
+		return
+	}
+
+	updated, err := gc.repository(c).Update(c.Request.Context(), c.Param("id"), group)
+	if err != nil {
+		respondWithGroupError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, updated, nil)
+}
+
+// DeleteGroup removes the group with the given ID along with its
+// memberships. Its members are not affected.
+func (gc *GroupController) DeleteGroup(c *gin.Context) {
+	if replica.ReadOnly(c) {
+		respondWithRepositoryError(c, repository.ErrReadOnly)
+		return
+	}
+	if err := gc.repository(c).Delete(c.Request.Context(), c.Param("id")); err != nil {
+		respondWithGroupError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetMembers returns a page of the memberships of the group, oldest first
+func (gc *GroupController) GetMembers(c *gin.Context) {
+	page, err := parsePagination(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter, err.Error(), nil)
+		return
+	}
+	opts := page.listOptions()
+	members, total, err := gc.repository(c).Members(c.Request.Context(), c.Param("id"), opts.Offset, opts.Limit)
+	if err != nil {
+		respondWithGroupError(c, err)
+		return
+	}
+	setPaginationHeaders(c, page, total)
+	respond(c, http.StatusOK, members, page.meta(total))
+}
+
+// AddMember adds the user to the group. The user must be active.
+func (gc *GroupController) AddMember(c *gin.Context) {
+	userID := c.Param("userId")
+	if replica.ReadOnly(c) {
+		respondWithRepositoryError(c, repository.ErrReadOnly)
+		return
+	}
+	if !gc.userExists(c, userID) {
+		return
+	}
+
+	membership, err := gc.repository(c).AddMember(c.Request.Context(), c.Param("id"), userID)
+	if err != nil {
+		respondWithGroupError(c, err)
+		return
+	}
+	respond(c, http.StatusCreated, membership, nil)
+}
+
+// RemoveMember removes the user from the group. Deleted users can still be
+// removed, although their memberships end when they are deleted.
+func (gc *GroupController) RemoveMember(c *gin.Context) {
+	if replica.ReadOnly(c) {
+		respondWithRepositoryError(c, repository.ErrReadOnly)
+		return
+	}
+	if err := gc.repository(c).RemoveMember(c.Request.Context(), c.Param("id"), c.Param("userId")); err != nil {
+		respondWithGroupError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetUserGroups returns a page of the groups the user belongs to, ordered by
+// name
+func (gc *GroupController) GetUserGroups(c *gin.Context) {
+	id := c.Param("id")
+	page, err := parsePagination(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter, err.Error(), nil)
+		return
+	}
+	if !gc.userExists(c, id) {
+		return
+	}
+
+	opts := page.listOptions()
+	groups, total, err := gc.repository(c).UserGroups(c.Request.Context(), id, opts.Offset, opts.Limit)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	setPaginationHeaders(c, page, total)
+	respond(c, http.StatusOK, groups, page.meta(total))
+}
+
+// userExists responds with 404 and returns false unless id names an active
+// user of the request's tenant
+func (gc *GroupController) userExists(c *gin.Context, id string) bool {
+	_, err := tracedRepository(c, gc.repo).Get(c.Request.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found", gin.H{"id": id})
+		return false
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return false
+	}
+	return true
+}
+
+// respondWithGroupError maps group repository errors to responses
+func respondWithGroupError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrGroupNotFound):
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeGroupNotFound, "Group not found", gin.H{"id": c.Param("id")})
+	case errors.Is(err, repository.ErrGroupConflict):
+		apierror.Respond(c, http.StatusConflict, apierror.CodeGroupAlreadyExists, "Group with this ID already exists", nil)
+	case errors.Is(err, repository.ErrAlreadyMember):
+		apierror.Respond(c, http.StatusConflict, apierror.CodeAlreadyMember, "The user is already a member of the group",
+			gin.H{"id": c.Param("id"), "userId": c.Param("userId")})
+	case errors.Is(err, repository.ErrNotMember):
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotMember, "The user is not a member of the group",
+			gin.H{"id": c.Param("id"), "userId": c.Param("userId")})
+	default:
+		apierror.Internal(c, err)
+	}
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/repository"
+)
+
+// readinessTimeout bounds how long a readiness probe waits on the storage backend
+const readinessTimeout = 2 * time.Second
+
+// HealthController serves liveness and readiness probes
+type HealthController struct {
+	repo repository.UserRepository
+}
+
+// NewHealthController creates a controller that checks the given repository
+func NewHealthController(repo repository.UserRepository) *HealthController {
+	return &HealthController{repo: repo}
+}
+
+// Liveness reports that the process is up and serving requests
+func (hc *HealthController) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readiness reports whether the service can handle traffic, which requires
+// the storage backend to be reachable
+func (hc *HealthController) Readiness(c *gin.Context) {
+	storage := gin.H{"status": "up"}
+	ready := true
+
+	if latency, pinged, err := pingStorage(c.Request.Context(), hc.repo); pinged {
+		storage["latencyMs"] = latency.Milliseconds()
+		if err != nil {
+			storage["status"] = "down"
+			storage["error"] = err.Error()
+			ready = false
+		}
+	}
+
+	status, body := http.StatusOK, gin.H{"status": "ready", "checks": gin.H{"storage": storage}}
+	if !ready {
+		status, body["status"] = http.StatusServiceUnavailable, "unavailable"
+	}
+	c.JSON(status, body)
+}
+
+// pingStorage checks that the repository's storage backend is reachable,
+// returning how long the check took. pinged is false for backends that
+// cannot be checked, such as the in-memory one.
+func pingStorage(ctx context.Context, repo repository.UserRepository) (latency time.Duration, pinged bool, err error) {
+	pinger, ok := repo.(repository.Pinger)
+	if !ok {
+		return 0, false, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err = pinger.Ping(ctx)
+	return time.Since(start), true, err
+}
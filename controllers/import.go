@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"userprofile-api/apierror"
+	"userprofile-api/models"
+	"userprofile-api/negotiate"
+	"userprofile-api/repository"
+	"userprofile-api/service"
+)
+
+// maxImportLine is the longest line of an import in bytes, which bounds the
+// memory an import holds whatever the size of its body
+const maxImportLine = 64 << 10
+
+// What became of a line of an import
+const (
+	importCreated = "created"
+	importSkipped = "skipped"
+	importFailed  = "failed"
+)
+
+// importResult reports what became of one line of an import
+type importResult struct {
+	// Line is the line's number in the body, counting from 1
+	Line   int             `json:"line"`
+	Status string          `json:"status"`
+	ID     string          `json:"id,omitempty"`
+	Error  *apierror.Error `json:"error,omitempty"`
+}
+
+// ImportUsers creates the users of a newline-delimited JSON body, one user
+// per line in the format of the request's API version, as the lines arrive,
+// and answers with a NDJSON line per user saying whether it was created.
+// Lines that are invalid or conflict with existing users fail on their own;
+// with skip_existing=true, users whose ID exists are skipped instead. Blank
+// lines are ignored. Once the first result is written the status cannot
+// change, so a failure of the repository stops the import and is reported in
+// the X-Stream-Error trailer.
+func (uc *UserController) ImportUsers(c *gin.Context) {
+	if c.ContentType() != negotiate.NDJSONContentType {
+		apierror.Respond(c, http.StatusUnsupportedMediaType, apierror.CodeInvalidRequestBody,
+			"Imports must be sent as "+negotiate.NDJSONContentType, nil)
+		return
+	}
+	skipExisting := false
+	if value := c.Query("skip_existing"); value != "" {
+		var err error
+		if skipExisting, err = strconv.ParseBool(value); err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter,
+				"skip_existing must be true or false", gin.H{"parameter": "skip_existing"})
+			return
+		}
+	}
+
+	users := uc.service(c)
+	t, active, limited, err := userQuota(c, users.Repository())
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	// Without full duplex, HTTP/1 connections stop reading the body once
+	// the first results are flushed. HTTP/2 always allows it.
+	_ = http.NewResponseController(c.Writer).EnableFullDuplex()
+
+	h := c.Writer.Header()
+	written := 0
+	encoder := json.NewEncoder(c.Writer)
+	write := func(result importResult) error {
+		if written == 0 {
+			h.Set("Content-Type", negotiate.NDJSONContentType)
+			h.Set("Trailer", "X-Stream-Error")
+			c.Writer.WriteHeader(http.StatusOK)
+			c.Writer.WriteHeaderNow()
+		}
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+		written++
+		if written%streamFlushInterval == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	}
+
+	reader := bufio.NewReaderSize(c.Request.Body, maxImportLine)
+	counts := make(map[string]int)
+	for number := 1; ; number++ {
+		line, tooLong, err := readLine(reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			abortImport(c, written, http.StatusBadRequest, err)
+			return
+		}
+		if len(line) == 0 && !tooLong {
+			continue
+		}
+
+		result := importResult{Line: number, Status: importFailed}
+		var user models.UserProfile
+		switch {
+		case tooLong:
+			result.Error = &apierror.Error{Code: apierror.CodeInvalidRequestBody,
+				Message: fmt.Sprintf("The line is longer than %d bytes", maxImportLine)}
+		case limited && active >= t.MaxUsers:
+			result.Error = &apierror.Error{Code: apierror.CodeUserQuotaExceeded,
+				Message: "The tenant's user quota does not allow more users", Details: gin.H{"tenant": t.ID, "maxUsers": t.MaxUsers}}
+		default:
+			if err := uc.decodeUser(c, &user, func(obj any) error { return binding.JSON.BindBody(line, obj) }); err != nil {
+				message, details := bindError(err)
+				result.Error = &apierror.Error{Code: apierror.CodeInvalidRequestBody, Message: message, Details: details}
+				break
+			}
+			created, err := users.Create(c.Request.Context(), user)
+			if err != nil {
+				result.ID = user.ID
+				switch {
+				case errors.Is(err, service.ErrInvalid):
+					message, details := bindError(err)
+					result.Error = &apierror.Error{Code: apierror.CodeInvalidRequestBody, Message: message, Details: details}
+				case errors.Is(err, repository.ErrEmailConflict):
+					result.Error = &apierror.Error{Code: apierror.CodeEmailAlreadyInUse,
+						Message: "Another user already has this email address"}
+				case errors.Is(err, repository.ErrConflict) && skipExisting:
+					result.Status = importSkipped
+				case errors.Is(err, repository.ErrConflict):
+					result.Error = &apierror.Error{Code: apierror.CodeUserAlreadyExists,
+						Message: "User with this ID already exists"}
+				default:
+					abortImport(c, written, 0, err)
+					return
+				}
+				break
+			}
+			result.ID, result.Status = created.ID, importCreated
+			active++
+		}
+
+		counts[result.Status]++
+		if err := write(result); err != nil {
+			log.Printf("Writing import results failed after %d lines: %v", number, err)
+			return
+		}
+	}
+
+	if written == 0 {
+		h.Set("Content-Type", negotiate.NDJSONContentType)
+		c.Status(http.StatusOK)
+		c.Writer.WriteHeaderNow()
+	}
+	log.Printf("Imported users: %d created, %d skipped, %d failed",
+		counts[importCreated], counts[importSkipped], counts[importFailed])
+}
+
+// abortImport stops an import on an error it cannot report for a single
+// line: in the response when no results were written yet, with the given
+// status or, when it is 0, the status of the repository error, and in the
+// X-Stream-Error trailer otherwise
+func abortImport(c *gin.Context, written, status int, err error) {
+	switch {
+	case written == 0 && status != 0:
+		apierror.Respond(c, status, apierror.CodeInvalidRequestBody, "Failed to read the request body", err.Error())
+	case written == 0:
+		respondWithRepositoryError(c, err)
+	default:
+		log.Printf("Importing users failed after %d results: %v", written, err)
+		c.Writer.Header().Set("X-Stream-Error", "The import stopped early; lines without a result were not imported")
+	}
+}
+
+// readLine returns the next line of r without surrounding whitespace, or
+// tooLong true when the line does not fit in r's buffer, in which case the
+// line is skipped. The last line needs no line ending.
+func readLine(r *bufio.Reader) (line []byte, tooLong bool, err error) {
+	line, err = r.ReadSlice('\n')
+	for errors.Is(err, bufio.ErrBufferFull) {
+		tooLong = true
+		_, err = r.ReadSlice('\n')
+	}
+	if errors.Is(err, io.EOF) && (len(line) > 0 || tooLong) {
+		err = nil
+	}
+	if tooLong {
+		line = nil
+	}
+	return bytes.TrimSpace(line), tooLong, err
+}
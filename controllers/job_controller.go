@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/jobs"
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+// jobStatuses lists the statuses jobs can be filtered by
+var jobStatuses = []models.JobStatus{models.JobPending, models.JobRunning, models.JobFailed}
+
+// JobController inspects the background jobs, such as webhook deliveries,
+// that are still to run or have failed, and requeues failed ones
+type JobController struct {
+	runner *jobs.Runner
+}
+
+// NewJobController creates a controller for the jobs of runner
+func NewJobController(runner *jobs.Runner) *JobController {
+	return &JobController{runner: runner}
+}
+
+// retryResult reports how many failed jobs were requeued
+type retryResult struct {
+	XMLName  struct{} `json:"-" yaml:"-" xml:"retry"`
+	Requeued int      `json:"requeued" xml:"requeued" yaml:"requeued"`
+}
+
+// ListJobs returns a page of the jobs, oldest first, optionally only those
+// with the status and kind given in the query string
+func (jc *JobController) ListJobs(c *gin.Context) {
+	page, err := parsePagination(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter, err.Error(), nil)
+		return
+	}
+	filter := repository.JobFilter{Status: models.JobStatus(c.Query("status")), Kind: c.Query("kind")}
+	if filter.Status != "" && !slices.Contains(jobStatuses, filter.Status) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter,
+			"status must be pending, running or failed", gin.H{"status": filter.Status})
+		return
+	}
+
+	opts := page.listOptions()
+	jobs, total, err := jc.runner.Repository().List(c.Request.Context(), filter, opts.Offset, opts.Limit)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	setPaginationHeaders(c, page, total)
+	respond(c, http.StatusOK, jobs, page.meta(total))
+}
+
+// GetJob returns the job with the given ID, payload included
+func (jc *JobController) GetJob(c *gin.Context) {
+	job, err := jc.runner.Repository().Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondWithJobError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, job, nil)
+}
+
+// RetryJob requeues the failed job with the given ID, with all its attempts
+// again
+func (jc *JobController) RetryJob(c *gin.Context) {
+	job, err := jc.runner.Retry(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondWithJobError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, job, nil)
+}
+
+// RetryJobs requeues every failed job, or those of the kind given in the
+// query string, such as the webhook deliveries that failed while a receiver
+// was down
+func (jc *JobController) RetryJobs(c *gin.Context) {
+	requeued, err := jc.runner.RetryFailed(c.Request.Context(), c.Query("kind"))
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	respond(c, http.StatusOK, retryResult{Requeued: requeued}, nil)
+}
+
+// DiscardJob removes the failed job with the given ID
+func (jc *JobController) DiscardJob(c *gin.Context) {
+	if err := jc.runner.Discard(c.Request.Context(), c.Param("id")); err != nil {
+		respondWithJobError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// respondWithJobError maps the errors of job operations to responses
+func respondWithJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrJobNotFound):
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeJobNotFound, "Job not found", gin.H{"id": c.Param("id")})
+	case errors.Is(err, jobs.ErrNotFailed):
+		apierror.Respond(c, http.StatusConflict, apierror.CodeJobNotFailed, "Only failed jobs can be requeued or discarded",
+			gin.H{"id": c.Param("id")})
+	default:
+		apierror.Internal(c, err)
+	}
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/ldapsync"
+)
+
+// LDAPController syncs users from the LDAP directory on demand
+type LDAPController struct {
+	syncer *ldapsync.Syncer
+}
+
+// NewLDAPController creates a controller for the given syncer
+func NewLDAPController(syncer *ldapsync.Syncer) *LDAPController {
+	return &LDAPController{syncer: syncer}
+}
+
+// SyncLDAP syncs users now, waiting for any sync under way to finish first,
+// and counts the users created, updated and skipped. A failed sync keeps the
+// changes made before it failed, which the error's details count.
+func (lc *LDAPController) SyncLDAP(c *gin.Context) {
+	result, err := lc.syncer.Sync(c.Request.Context())
+	if err != nil {
+		apierror.Respond(c, http.StatusBadGateway, apierror.CodeLDAPSyncFailed, "Sync of users from LDAP failed",
+			gin.H{"reason": err.Error(), "created": result.Created, "updated": result.Updated, "skipped": result.Skipped})
+		return
+	}
+	respond(c, http.StatusOK, result, nil)
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/follow"
+	"userprofile-api/repository"
+	"userprofile-api/service"
+	"userprofile-api/tenant"
+)
+
+// MergeController merges duplicate users, along with their relationships
+// and group memberships
+type MergeController struct {
+	users   *service.UserService
+	follows *follow.Store
+	groups  *repository.Groups
+}
+
+// NewMergeController creates a controller merging the users of the service,
+// handing over the relationships kept in follows and the memberships kept in
+// groups
+func NewMergeController(users *service.UserService, follows *follow.Store, groups *repository.Groups) *MergeController {
+	return &MergeController{users: users, follows: follows, groups: groups}
+}
+
+// mergeBody names the user merged into the user of the path, and how
+type mergeBody struct {
+	DuplicateID string `json:"duplicateId" binding:"required"`
+	// Strategy defaults to keepTarget
+	Strategy string `json:"strategy" binding:"omitempty,oneof=keepTarget preferDuplicate newest"`
+}
+
+// MergeUsers merges the duplicate user named in the body into the user with
+// the given ID: their fields are combined by the body's strategy, the
+// duplicate's relationships, group memberships and audit trail are handed
+// over to the user, and the duplicate is soft-deleted
+func (mc *MergeController) MergeUsers(c *gin.Context) {
+	var body mergeBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respondWithBindError(c, err)
+		return
+	}
+	strategy := service.MergeKeepTarget
+	if body.Strategy != "" {
+		strategy = service.MergeStrategy(body.Strategy)
+	}
+
+	id, tenantID := c.Param("id"), tenant.ID(c)
+	merged, err := tenantService(c, mc.users).Merge(c.Request.Context(), id, body.DuplicateID, strategy,
+		func(ctx context.Context, fromID, toID string) error {
+			// Memberships kept in the users' database are handed over within
+			// the merge's transaction. Relationships are saved on their own,
+			// so they are handed over last.
+			if mc.groups != nil {
+				if err := mc.groups.Tenant(tenantID).MoveUser(ctx, fromID, toID); err != nil {
+					return err
+				}
+			}
+			if mc.follows != nil {
+				return mc.follows.Move(tenantID, fromID, toID)
+			}
+			return nil
+		})
+	switch {
+	case errors.Is(err, service.ErrMergeSelf):
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeCannotMergeSelf, "Users cannot be merged into themselves",
+			gin.H{"id": id})
+	case errors.Is(err, repository.ErrNotFound):
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found",
+			gin.H{"id": id, "duplicateId": body.DuplicateID})
+	case err != nil:
+		respondWithRepositoryError(c, err)
+	default:
+		setETag(c, merged)
+		renderUser(c, http.StatusOK, merged)
+	}
+}
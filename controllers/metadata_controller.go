@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/metadata"
+	"userprofile-api/tenant"
+)
+
+// MetadataController serves the metadata schemas of the admin API: the
+// default one and, when tenancy is enabled, those of tenants
+type MetadataController struct {
+	schemas *metadata.Schemas
+}
+
+// NewMetadataController creates a controller managing the given schemas
+func NewMetadataController(schemas *metadata.Schemas) *MetadataController {
+	return &MetadataController{schemas: schemas}
+}
+
+// GetSchema returns the default metadata schema
+func (mc *MetadataController) GetSchema(c *gin.Context) {
+	respondWithSchema(c, mc.schemas.Default())
+}
+
+// SetSchema replaces the default metadata schema until the server restarts
+func (mc *MetadataController) SetSchema(c *gin.Context) {
+	schema, ok := bindSchema(c)
+	if !ok {
+		return
+	}
+	mc.schemas.SetDefault(schema)
+	respondWithSchema(c, schema)
+}
+
+// DeleteSchema accepts any metadata from users whose tenant has no schema of
+// its own, until the server restarts
+func (mc *MetadataController) DeleteSchema(c *gin.Context) {
+	mc.schemas.SetDefault(nil)
+	c.Status(http.StatusNoContent)
+}
+
+// GetTenantSchema returns the metadata schema a tenant has of its own
+func (mc *MetadataController) GetTenantSchema(c *gin.Context) {
+	schema, err := mc.schemas.Tenant(c.Param(tenant.Param))
+	if err != nil {
+		respondWithTenantError(c, err)
+		return
+	}
+	respondWithSchema(c, schema)
+}
+
+// SetTenantSchema replaces the metadata schema of a tenant, which is saved
+// with the tenant. Existing users are not checked again.
+func (mc *MetadataController) SetTenantSchema(c *gin.Context) {
+	schema, ok := bindSchema(c)
+	if !ok {
+		return
+	}
+	if _, err := mc.schemas.SetTenant(c.Param(tenant.Param), schema); err != nil {
+		respondWithTenantError(c, err)
+		return
+	}
+	respondWithSchema(c, schema)
+}
+
+// DeleteTenantSchema checks the metadata of a tenant's users against the
+// default schema again
+func (mc *MetadataController) DeleteTenantSchema(c *gin.Context) {
+	if _, err := mc.schemas.SetTenant(c.Param(tenant.Param), nil); err != nil {
+		respondWithTenantError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// bindSchema parses the JSON Schema in the request body, responding with 400
+// and returning false when it is not one
+func bindSchema(c *gin.Context) (*metadata.Schema, bool) {
+	data, err := c.GetRawData()
+	if err != nil {
+		respondWithBindError(c, err)
+		return nil, false
+	}
+	schema, err := metadata.Parse(data)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequestBody, err.Error(), nil)
+		return nil, false
+	}
+	return schema, true
+}
+
+// respondWithSchema writes the document of a schema, or responds with 404
+// when there is none
+func respondWithSchema(c *gin.Context, schema *metadata.Schema) {
+	if schema == nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeMetadataSchemaNotSet, "No metadata schema is set", nil)
+		return
+	}
+	respond(c, http.StatusOK, schema.Document(), nil)
+}
@@ -0,0 +1,393 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"userprofile-api/auth"
+	"userprofile-api/config"
+	"userprofile-api/csrf"
+	"userprofile-api/i18n"
+	"userprofile-api/models"
+	"userprofile-api/moderation"
+	"userprofile-api/replica"
+	"userprofile-api/repository"
+	"userprofile-api/service"
+	"userprofile-api/session"
+)
+
+// PageController serves the HTML pages listing users and, to those allowed,
+// creating, editing and deleting them through forms
+type PageController struct {
+	users *service.UserService
+	// sessions is nil when logins are disabled
+	sessions *session.Store
+	// apiAuth is set when the JSON API requires credentials; without logins
+	// the pages are then read-only
+	apiAuth bool
+}
+
+// NewPageController creates a controller working on users through the given
+// service, logging people in with sessions unless it is nil
+func NewPageController(users *service.UserService, sessions *session.Store, apiAuth bool) *PageController {
+	return &PageController{users: users, sessions: sessions, apiAuth: apiAuth}
+}
+
+// can reports whether the request may do what the role allows: with logins,
+// when its account has the role, and without, when the API needs no
+// credentials or the role only views users
+func (pc *PageController) can(c *gin.Context, role string) bool {
+	if pc.sessions == nil {
+		return !pc.apiAuth || role == config.RoleViewer
+	}
+	principal, ok := auth.PrincipalFrom(c)
+	return ok && principal.HasRole(role)
+}
+
+// RequireRole returns middleware that only lets requests allowed the role
+// through, sending browsers that have not logged in to the login page
+func (pc *PageController) RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if pc.can(c, role) {
+			c.Next()
+			return
+		}
+		if _, ok := auth.PrincipalFrom(c); !ok && pc.sessions != nil {
+			c.Redirect(http.StatusSeeOther, "/login")
+			c.Abort()
+			return
+		}
+		pc.renderError(c, http.StatusForbidden, "Your role does not allow this")
+		c.Abort()
+	}
+}
+
+// page adds what every page shows to its data: the CSRF token of its forms,
+// the logged-in account, and the language of the page along with the T
+// function rendering text in it
+func (pc *PageController) page(c *gin.Context, data gin.H) gin.H {
+	i18n.Localized(c)
+	data["CSRFToken"] = csrf.Token(c)
+	data["Lang"] = i18n.Language(c)
+	data["T"] = translator(c)
+	if principal, ok := auth.PrincipalFrom(c); ok && pc.sessions != nil {
+		data["Account"] = principal.Name
+	}
+	return data
+}
+
+// userForm is the data of the user_form partial
+type userForm struct {
+	// Action is the URL the form posts to
+	Action string
+	Submit string
+	User   models.UserProfile
+	// Errors holds messages by field name; the "form" entry concerns the
+	// form as a whole
+	Errors    map[string]string
+	CSRFToken string
+	// T renders the form's labels in the language of the page
+	T func(message string, pairs ...any) string
+}
+
+// translator returns the function templates render text in the language of
+// the request with, as in {{ call .T "Logged in as {{.Name}}" "Name" .Account }}:
+// the message is followed by pairs of names and values filling in its
+// template actions
+func translator(c *gin.Context) func(message string, pairs ...any) string {
+	return func(message string, pairs ...any) string {
+		if len(pairs) == 0 {
+			return i18n.T(c, message)
+		}
+		data := make(map[string]any, len(pairs)/2)
+		for i := 0; i+1 < len(pairs); i += 2 {
+			data[fmt.Sprint(pairs[i])] = pairs[i+1]
+		}
+		return i18n.Tf(c, message, data)
+	}
+}
+
+// userFormFields are the fields the user form posts
+type userFormFields struct {
+	FullName string `form:"fullName"`
+	Emoji    string `form:"emoji"`
+	Email    string `form:"email"`
+	Bio      string `form:"bio"`
+	Location string `form:"location"`
+	// Version is the version of the user the form was rendered from
+	Version int `form:"version"`
+}
+
+// applyTo copies the posted fields to user and normalizes them
+func (f userFormFields) applyTo(user *models.UserProfile) {
+	user.FullName = f.FullName
+	user.Emoji = f.Emoji
+	user.Email = f.Email
+	user.Bio = f.Bio
+	user.Location = f.Location
+	user.Normalize()
+}
+
+// HomePageHandler renders a HTML page displaying users in a table, with a
+// form adding users when the request may
+func (pc *PageController) HomePageHandler(c *gin.Context) {
+	log.Println("GET / endpoint called")
+	pc.renderHome(c, http.StatusOK, pc.newUserForm(c, models.UserProfile{}, nil))
+}
+
+// renderHome renders the home page with the given form for new users
+func (pc *PageController) renderHome(c *gin.Context, status int, form userForm) {
+	users, _, err := tenantService(c, pc.users).List(c.Request.Context(), repository.ListOptions{
+		Filter: repository.UserFilter{Statuses: models.ListedStatuses},
+	})
+	if err != nil {
+		pc.renderError(c, http.StatusInternalServerError, "Failed to load users")
+		return
+	}
+
+	c.HTML(status, "users.html", pc.page(c, gin.H{
+		"Title":     i18n.T(c, "User Profiles"),
+		"Users":     users,
+		"Editable":  pc.can(c, config.RoleEditor),
+		"Deletable": pc.can(c, config.RoleAdmin),
+		"Form":      form,
+	}))
+}
+
+// CreateUser adds the user posted by the home page's form and returns to the
+// home page, or renders it again with the form's errors
+func (pc *PageController) CreateUser(c *gin.Context) {
+	var fields userFormFields
+	if err := c.ShouldBind(&fields); err != nil {
+		pc.renderError(c, http.StatusBadRequest, "Invalid form")
+		return
+	}
+	var user models.UserProfile
+	fields.applyTo(&user)
+
+	if errs := validateUserForm(c, user); errs != nil {
+		pc.renderHome(c, http.StatusBadRequest, pc.newUserForm(c, user, errs))
+		return
+	}
+	if _, err := tenantService(c, pc.users).Create(c.Request.Context(), user); err != nil {
+		if errs, status := userFormError(c, err); errs != nil {
+			pc.renderHome(c, status, pc.newUserForm(c, user, errs))
+			return
+		}
+		pc.renderRepositoryError(c, err)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/")
+}
+
+// EditUser renders the form editing a user
+func (pc *PageController) EditUser(c *gin.Context) {
+	user, err := tenantService(c, pc.users).Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		pc.renderRepositoryError(c, err)
+		return
+	}
+	pc.renderEdit(c, http.StatusOK, pc.editUserForm(c, user, nil))
+}
+
+// renderEdit renders the page editing a user with the given form
+func (pc *PageController) renderEdit(c *gin.Context, status int, form userForm) {
+	c.HTML(status, "user_edit.html", pc.page(c, gin.H{
+		"Title": i18n.Tf(c, "Edit {{.Name}}", map[string]any{"Name": form.User.FullName}),
+		"Form":  form,
+	}))
+}
+
+// UpdateUser saves the user posted by the edit form and returns to the home
+// page, or renders the form again with its errors. Edits made to the user
+// since the form was rendered are not overwritten.
+func (pc *PageController) UpdateUser(c *gin.Context) {
+	var fields userFormFields
+	if err := c.ShouldBind(&fields); err != nil {
+		pc.renderError(c, http.StatusBadRequest, "Invalid form")
+		return
+	}
+
+	// edited is the user as the form would change it, rendered again along
+	// with the form's errors
+	var edited models.UserProfile
+	var errs map[string]string
+	_, err := tenantService(c, pc.users).Update(c.Request.Context(), c.Param("id"), func(user *models.UserProfile) error {
+		current := user.Version
+		fields.applyTo(user)
+		edited = *user
+		edited.Version = fields.Version
+		if errs = validateUserForm(c, *user); errs != nil {
+			return service.ErrInvalid
+		}
+		if current != fields.Version {
+			return repository.ErrVersionMismatch
+		}
+		return nil
+	})
+	status := http.StatusBadRequest
+	if errs == nil && edited.ID != "" {
+		errs, status = userFormError(c, err)
+	}
+	switch {
+	case errs != nil:
+		pc.renderEdit(c, status, pc.editUserForm(c, edited, errs))
+	case err != nil:
+		pc.renderRepositoryError(c, err)
+	default:
+		c.Redirect(http.StatusSeeOther, "/")
+	}
+}
+
+// DeleteUser soft-deletes a user and returns to the home page
+func (pc *PageController) DeleteUser(c *gin.Context) {
+	if err := tenantService(c, pc.users).Delete(c.Request.Context(), c.Param("id")); err != nil {
+		pc.renderRepositoryError(c, err)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/")
+}
+
+// LoginPage renders the form logging in to the pages
+func (pc *PageController) LoginPage(c *gin.Context) {
+	pc.renderLogin(c, http.StatusOK, "", "")
+}
+
+// renderLogin renders the login page with the given name and error
+func (pc *PageController) renderLogin(c *gin.Context, status int, name, message string) {
+	c.HTML(status, "login.html", pc.page(c, gin.H{
+		"Title": i18n.T(c, "Log in"),
+		"Name":  name,
+		"Error": message,
+	}))
+}
+
+// Login starts a session for the account posted by the login form and goes
+// to the home page, or renders the form again when the name or password is
+// wrong
+func (pc *PageController) Login(c *gin.Context) {
+	name := c.PostForm("name")
+	if !pc.sessions.Login(c, name, c.PostForm("password")) {
+		log.Printf("Failed login for %q", name)
+		pc.renderLogin(c, http.StatusUnauthorized, name, i18n.T(c, "Wrong name or password"))
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/")
+}
+
+// Logout ends the browser's session and goes to the login page
+func (pc *PageController) Logout(c *gin.Context) {
+	pc.sessions.Logout(c)
+	c.Redirect(http.StatusSeeOther, "/login")
+}
+
+func (pc *PageController) newUserForm(c *gin.Context, user models.UserProfile, errs map[string]string) userForm {
+	return userForm{Action: "/users", Submit: i18n.T(c, "Add user"), User: user, Errors: errs, CSRFToken: csrf.Token(c),
+		T: translator(c)}
+}
+
+func (pc *PageController) editUserForm(c *gin.Context, user models.UserProfile, errs map[string]string) userForm {
+	return userForm{Action: "/users/" + user.ID, Submit: i18n.T(c, "Save"), User: user, Errors: errs,
+		CSRFToken: csrf.Token(c), T: translator(c)}
+}
+
+// renderError renders a page showing only the given message, in the
+// language of the request, its template actions filled in from pairs of
+// names and values
+func (pc *PageController) renderError(c *gin.Context, status int, message string, pairs ...any) {
+	c.HTML(status, "error.html", pc.page(c, gin.H{
+		"Title":   i18n.T(c, http.StatusText(status)),
+		"Message": translator(c)(message, pairs...),
+	}))
+}
+
+// renderRepositoryError renders the page of a repository error
+func (pc *PageController) renderRepositoryError(c *gin.Context, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		pc.renderError(c, http.StatusNotFound, "The user does not exist or has been deleted")
+		return
+	}
+	if errors.Is(err, repository.ErrReadOnly) {
+		status, location := replica.Refusal(c)
+		if location == "" {
+			pc.renderError(c, status, "This server is a read replica; users can only be changed on the primary")
+			return
+		}
+		c.Header("Location", location)
+		pc.renderError(c, status, "This server is a read replica; users can only be changed on the primary at {{.Location}}",
+			"Location", location)
+		return
+	}
+	var unavailableErr *repository.UnavailableError
+	if errors.As(err, &unavailableErr) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(unavailableErr.RetryAfter.Seconds()))))
+		pc.renderError(c, http.StatusServiceUnavailable, "User storage is unavailable; please try again in a moment")
+		return
+	}
+	log.Printf("Error handling %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+	pc.renderError(c, http.StatusInternalServerError, "Something went wrong; please try again")
+}
+
+// validateUserForm checks a user posted by a form with the rules of the API
+// and returns a message for each invalid field, in the language of the
+// request, or nil
+func validateUserForm(c *gin.Context, user models.UserProfile) map[string]string {
+	err := binding.Validator.ValidateStruct(&user)
+	if err == nil {
+		return nil
+	}
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return map[string]string{"form": err.Error()}
+	}
+	errs := make(map[string]string, len(validationErrs))
+	for _, fieldErr := range validationErrs {
+		errs[jsonFieldName(fieldErr.Field())] = validationMessage(c, fieldErr)
+	}
+	return errs
+}
+
+// validationMessage describes a failed validation rule to people
+func validationMessage(c *gin.Context, fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "emoji":
+		return i18n.T(c, "Must be a single emoji")
+	case "email":
+		return i18n.T(c, "Must be an email address")
+	case "max":
+		return i18n.Tf(c, "Must be at most {{.Max}} characters", map[string]any{"Max": fieldErr.Param()})
+	case "nocontrol":
+		return i18n.T(c, "Must not contain control characters")
+	default:
+		return i18n.T(c, "Is invalid")
+	}
+}
+
+// userFormError returns the form errors describing an error of the user
+// service the person filling in the form can fix, and the status to render
+// them with, or nil for other errors
+func userFormError(c *gin.Context, err error) (map[string]string, int) {
+	var rejectedErr *moderation.RejectedError
+	switch {
+	case errors.As(err, &rejectedErr):
+		return map[string]string{rejectedErr.Field: i18n.T(c, "Was rejected by content moderation")}, http.StatusBadRequest
+	case errors.Is(err, repository.ErrEmailConflict):
+		return map[string]string{"email": i18n.T(c, "Another user already has this email address")}, http.StatusConflict
+	case errors.Is(err, repository.ErrVersionMismatch):
+		return map[string]string{"form": i18n.T(c, "The user was changed by someone else since this page was loaded; "+
+			"reload it to see their changes")}, http.StatusConflict
+	case errors.Is(err, service.ErrInvalid):
+		// The form's fields were checked already, which leaves the metadata
+		return map[string]string{"form": i18n.T(c, "The user's metadata does not match the metadata schema")},
+			http.StatusBadRequest
+	default:
+		return nil, 0
+	}
+}
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/cursor"
+	"userprofile-api/envelope"
+	"userprofile-api/jsonapi"
+	"userprofile-api/repository"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// pagination holds the page requested through the page/per_page query parameters
+type pagination struct {
+	Page    int
+	PerPage int
+}
+
+// parsePagination reads page and per_page from the query string. per_page is
+// capped at maxPerPage rather than rejected so clients asking for "everything"
+// still get a usable response.
+func parsePagination(c *gin.Context) (pagination, error) {
+	p := pagination{Page: 1, PerPage: defaultPerPage}
+
+	if value := c.Query("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return p, fmt.Errorf("page must be a positive integer")
+		}
+		p.Page = page
+	}
+
+	if value := c.Query("per_page"); value != "" {
+		perPage, err := strconv.Atoi(value)
+		if err != nil || perPage < 1 {
+			return p, fmt.Errorf("per_page must be a positive integer")
+		}
+		p.PerPage = min(perPage, maxPerPage)
+	}
+
+	return p, nil
+}
+
+// parseLimit reads the limit query parameter, capped at maxPerPage like
+// per_page
+func parseLimit(c *gin.Context) (int, error) {
+	limit := defaultPerPage
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("limit must be a positive integer")
+		}
+		limit = min(n, maxPerPage)
+	}
+	return limit, nil
+}
+
+// listOptions converts the page into repository offset/limit options
+func (p pagination) listOptions() repository.ListOptions {
+	return repository.ListOptions{
+		Offset: (p.Page - 1) * p.PerPage,
+		Limit:  p.PerPage,
+	}
+}
+
+// meta returns the pagination metadata of the page
+func (p pagination) meta(total int) *envelope.Pagination {
+	return &envelope.Pagination{Page: p.Page, PerPage: p.PerPage, Total: &total, TotalPages: p.lastPage(total)}
+}
+
+// lastPage returns the number of the final page for the given total
+func (p pagination) lastPage(total int) int {
+	if total == 0 {
+		return 1
+	}
+	return (total + p.PerPage - 1) / p.PerPage
+}
+
+// setPaginationHeaders writes X-Total-Count and an RFC 8288 Link header with
+// first/prev/next/last relations, preserving any other query parameters
+func setPaginationHeaders(c *gin.Context, p pagination, total int) {
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.Header("X-Page", strconv.Itoa(p.Page))
+	c.Header("X-Per-Page", strconv.Itoa(p.PerPage))
+
+	last := p.lastPage(total)
+	links := []string{
+		pageLink(c.Request.URL, p, 1, "first"),
+	}
+	if p.Page > 1 {
+		links = append(links, pageLink(c.Request.URL, p, min(p.Page-1, last), "prev"))
+	}
+	if p.Page < last {
+		links = append(links, pageLink(c.Request.URL, p, p.Page+1, "next"))
+	}
+	links = append(links, pageLink(c.Request.URL, p, last, "last"))
+
+	c.Header("Link", strings.Join(links, ", "))
+}
+
+func pageLink(base *url.URL, p pagination, page int, rel string) string {
+	return fmt.Sprintf("<%s>; rel=\"%s\"", pageURL(base, p.PerPage, page), rel)
+}
+
+// pageURL returns the URL of a page, keeping the other query parameters
+func pageURL(base *url.URL, perPage, page int) string {
+	query := base.Query()
+	query.Set("page", strconv.Itoa(page))
+	query.Set("per_page", strconv.Itoa(perPage))
+
+	target := url.URL{Path: base.Path, RawQuery: query.Encode()}
+	return target.String()
+}
+
+// paginationLinks returns the first, prev, next and last links of a page
+// requested by number, or the next link of one requested by cursor, as the
+// Link header has them, for JSON:API documents
+func paginationLinks(base *url.URL, meta *envelope.Pagination) jsonapi.Links {
+	if meta.Page == 0 {
+		if meta.NextCursor == "" {
+			return nil
+		}
+		return jsonapi.Links{"next": cursorURL(base, meta.NextCursor)}
+	}
+	links := jsonapi.Links{
+		"first": pageURL(base, meta.PerPage, 1),
+		"last":  pageURL(base, meta.PerPage, meta.TotalPages),
+	}
+	if meta.Page > 1 {
+		links["prev"] = pageURL(base, meta.PerPage, min(meta.Page-1, meta.TotalPages))
+	}
+	if meta.Page < meta.TotalPages {
+		links["next"] = pageURL(base, meta.PerPage, meta.Page+1)
+	}
+	return links
+}
+
+// cursorPage holds the page requested through the cursor/limit query
+// parameters
+type cursorPage struct {
+	// After is the position the page starts after; the zero position for the
+	// first page
+	After *repository.Cursor
+	Limit int
+}
+
+// wantsCursor reports whether the request pages by cursor rather than by
+// page number. An empty cursor parameter asks for the first page.
+func wantsCursor(c *gin.Context) bool {
+	_, hasCursor := c.GetQuery("cursor")
+	_, hasLimit := c.GetQuery("limit")
+	return hasCursor || hasLimit
+}
+
+// parseCursorPage reads cursor and limit from the query string. Cursor pages
+// are always in the backend's cursor order, so they cannot be combined with
+// page numbers or sort.
+func parseCursorPage(c *gin.Context, cursors *cursor.Codec) (cursorPage, error) {
+	for _, param := range []string{"page", "per_page", "sort"} {
+		if _, ok := c.GetQuery(param); ok {
+			return cursorPage{}, fmt.Errorf("%s cannot be combined with cursor or limit", param)
+		}
+	}
+
+	p := cursorPage{After: &repository.Cursor{}}
+	var err error
+	if p.Limit, err = parseLimit(c); err != nil {
+		return p, err
+	}
+	if token := c.Query("cursor"); token != "" {
+		after, err := cursors.Decode(token)
+		if err != nil {
+			return p, fmt.Errorf("cursor is invalid or has expired")
+		}
+		p.After = &after
+	}
+	return p, nil
+}
+
+// setCursorHeaders writes X-Total-Count, unless the total is unknown, and,
+// unless this is the last page, X-Next-Cursor and a Link header pointing at
+// the next page
+func setCursorHeaders(c *gin.Context, total int, next string) {
+	if total >= 0 {
+		c.Header("X-Total-Count", strconv.Itoa(total))
+	}
+	if next == "" {
+		return
+	}
+	c.Header("X-Next-Cursor", next)
+
+	c.Header("Link", fmt.Sprintf("<%s>; rel=\"next\"", cursorURL(c.Request.URL, next)))
+}
+
+// cursorURL returns the URL of the page after a cursor, keeping the other
+// query parameters
+func cursorURL(base *url.URL, cursor string) string {
+	query := base.Query()
+	query.Set("cursor", cursor)
+	target := url.URL{Path: base.Path, RawQuery: query.Encode()}
+	return target.String()
+}
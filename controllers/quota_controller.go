@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/quota"
+	"userprofile-api/repository"
+	"userprofile-api/tenant"
+)
+
+// QuotaController serves the quotas of the admin API: the rate limits of API
+// keys and, when tenancy is enabled, the user quotas of tenants
+type QuotaController struct {
+	limiter *quota.Limiter
+	// registry and tenants are nil when tenancy is disabled
+	registry *tenant.Registry
+	tenants  *tenant.Repositories
+}
+
+// NewQuotaController creates a controller for the given limiter and tenants
+func NewQuotaController(limiter *quota.Limiter, registry *tenant.Registry, tenants *tenant.Repositories) *QuotaController {
+	return &QuotaController{limiter: limiter, registry: registry, tenants: tenants}
+}
+
+// quotas lists every quota in force
+type quotas struct {
+	XMLName    struct{}      `json:"-" yaml:"-" xml:"quotas"`
+	RateLimits quota.Limits  `json:"rateLimits" xml:"rateLimits" yaml:"rateLimits"`
+	Tenants    []tenantQuota `json:"tenants,omitempty" xml:"tenants>tenant,omitempty" yaml:"tenants,omitempty"`
+}
+
+// tenantQuota is a tenant's user quota and how much of it is used
+type tenantQuota struct {
+	Tenant string `json:"tenant" xml:"tenant" yaml:"tenant"`
+	// MaxUsers is zero when the tenant has no limit
+	MaxUsers int `json:"maxUsers" xml:"maxUsers" yaml:"maxUsers"`
+	Users    int `json:"users" xml:"users" yaml:"users"`
+}
+
+// rateLimitRequest is the body setting a rate limit; zero means no limit
+type rateLimitRequest struct {
+	Limit *int `json:"limit" binding:"required,min=0"`
+}
+
+// userQuotaRequest is the body setting a tenant's user quota; zero means no
+// limit
+type userQuotaRequest struct {
+	MaxUsers *int `json:"maxUsers" binding:"required,min=0"`
+}
+
+// GetQuotas returns the rate limits and the user quotas of every tenant with
+// the number of users each has
+func (qc *QuotaController) GetQuotas(c *gin.Context) {
+	result := quotas{RateLimits: qc.limiter.Limits()}
+	if qc.registry != nil {
+		for _, t := range qc.registry.List() {
+			repo, err := qc.tenants.Get(t.ID)
+			if err != nil {
+				apierror.Internal(c, err)
+				return
+			}
+			_, users, err := repo.List(c.Request.Context(), repository.ListOptions{Limit: 1})
+			if err != nil {
+				apierror.Internal(c, err)
+				return
+			}
+			result.Tenants = append(result.Tenants, tenantQuota{Tenant: t.ID, MaxUsers: t.MaxUsers, Users: users})
+		}
+	}
+	respond(c, http.StatusOK, result, nil)
+}
+
+// SetDefaultRateLimit changes the rate limit of API keys without one of their
+// own until the server restarts
+func (qc *QuotaController) SetDefaultRateLimit(c *gin.Context) {
+	var req rateLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithBindError(c, err)
+		return
+	}
+	qc.limiter.SetDefault(*req.Limit)
+	respond(c, http.StatusOK, qc.limiter.Limits(), nil)
+}
+
+// SetKeyRateLimit gives an API key, by name, a rate limit of its own until
+// the server restarts
+func (qc *QuotaController) SetKeyRateLimit(c *gin.Context) {
+	var req rateLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithBindError(c, err)
+		return
+	}
+	qc.limiter.SetKey(c.Param("name"), *req.Limit)
+	respond(c, http.StatusOK, qc.limiter.Limits(), nil)
+}
+
+// DeleteKeyRateLimit makes an API key use the default rate limit again
+func (qc *QuotaController) DeleteKeyRateLimit(c *gin.Context) {
+	qc.limiter.RemoveKey(c.Param("name"))
+	respond(c, http.StatusOK, qc.limiter.Limits(), nil)
+}
+
+// SetUserQuota replaces a tenant's user quota. Lowering it below the current
+// number of users only stops new users from being added.
+func (qc *QuotaController) SetUserQuota(c *gin.Context) {
+	var req userQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithBindError(c, err)
+		return
+	}
+	t, err := qc.registry.SetMaxUsers(c.Param(tenant.Param), *req.MaxUsers)
+	if err != nil {
+		respondWithTenantError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, t, nil)
+}
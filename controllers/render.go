@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"maps"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/apiversion"
+	"userprofile-api/dto"
+	"userprofile-api/emoji"
+	"userprofile-api/envelope"
+	"userprofile-api/fields"
+	"userprofile-api/jsonapi"
+	"userprofile-api/links"
+	"userprofile-api/models"
+	"userprofile-api/negotiate"
+)
+
+// respond writes a successful response body in the format the client
+// accepts. v1 sends the body as is, while later versions wrap it in the
+// response envelope along with the pagination metadata of collections.
+// Clients accepting JSON:API get a JSON:API document in every version.
+func respond(c *gin.Context, status int, body any, pagination *envelope.Pagination) {
+	if jsonapi.Accepts(c) {
+		doc := jsonapi.NewDocument(c, body)
+		if pagination != nil {
+			doc.AddMeta("pagination", pagination)
+			maps.Copy(doc.Links, paginationLinks(c.Request.URL, pagination))
+		}
+		negotiate.VaryAccept(c.Writer.Header())
+		jsonapi.Render(c, status, doc)
+		return
+	}
+	if links.From(c) != nil && links.AcceptsHAL(c) {
+		c.Header("Content-Type", links.HALContentType+"; charset=utf-8")
+	}
+	if apiversion.From(c) == apiversion.V1 {
+		negotiate.Render(c, status, body)
+		return
+	}
+	negotiate.Render(c, status, envelope.Success(c, body, pagination))
+}
+
+// userWithLinks is the v1 user representation with HAL links
+type userWithLinks struct {
+	models.UserProfile
+	Links links.Links `json:"_links" xml:"links" yaml:"_links"`
+}
+
+// userBody converts a user to the representation of the request's API
+// version, adding links when they were asked for and leaving out the
+// attributes not selected with the fields parameter. For JSON:API the user is
+// a resource of type users, related to its followers, the users it follows
+// and its groups.
+func userBody(c *gin.Context, user models.UserProfile) any {
+	if wantsShortcodes(c) {
+		user.Emoji = emoji.ToShortcode(user.Emoji)
+	}
+	body := fields.From(c).Project(fullUserBody(c, user))
+	if !jsonapi.Accepts(c) {
+		return body
+	}
+
+	resource := jsonapi.NewResource(userResourceType, user.ID, body)
+	if builder := links.From(c); builder != nil {
+		resource.Relationships = map[string]jsonapi.Relationship{}
+		for _, name := range userRelationships {
+			resource.Relationships[name] = jsonapi.Relationship{
+				Links: jsonapi.Links{"related": builder.User(user.ID) + "/" + name},
+			}
+		}
+	}
+	return resource
+}
+
+// userResourceType is the JSON:API type of users
+const userResourceType = "users"
+
+// userRelationships name the collections of a user's JSON:API
+// relationships, after the paths they are served at below the user
+var userRelationships = []string{"followers", "following", "groups"}
+
+func fullUserBody(c *gin.Context, user models.UserProfile) any {
+	builder := links.From(c)
+	switch apiversion.From(c) {
+	case apiversion.V2:
+		body := dto.NewUserV2(user)
+		if builder != nil {
+			body.Links = builder.UserLinks(user)
+		}
+		return body
+	default:
+		if builder != nil {
+			return userWithLinks{UserProfile: user, Links: builder.UserLinks(user)}
+		}
+		return user
+	}
+}
+
+// UserFields lists the attributes the fields parameter can select on user
+// responses
+var UserFields = append(fields.Names(models.UserProfile{}), "_links")
+
+// respondWithResults writes results that each hold a user, such as search
+// results. For JSON:API the users are the data, with the rest of each result
+// as their meta.
+func respondWithResults(c *gin.Context, results any) {
+	if !jsonapi.Accepts(c) {
+		respond(c, http.StatusOK, results, nil)
+		return
+	}
+	resources, err := jsonapi.Annotated(results, "user")
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	respond(c, http.StatusOK, resources, nil)
+}
+
+// renderUser writes a user in the representation of the request's API
+// version
+func renderUser(c *gin.Context, status int, user models.UserProfile) {
+	respond(c, status, userBody(c, user), nil)
+}
+
+// renderUsers writes a page of users in the representation of the request's
+// API version
+func renderUsers(c *gin.Context, status int, users []models.UserProfile, meta *envelope.Pagination) {
+	if apiversion.From(c) == apiversion.V1 && links.From(c) == nil && fields.From(c) == nil && !wantsShortcodes(c) &&
+		!jsonapi.Accepts(c) {
+		respond(c, status, users, meta)
+		return
+	}
+
+	bodies := make([]any, 0, len(users))
+	for _, user := range users {
+		bodies = append(bodies, userBody(c, user))
+	}
+	respond(c, status, bodies, meta)
+}
+
+// bindUser decodes and validates the request body, in the format of the
+// request's API version, over user. Fields missing from the body keep their
+// values.
+func (uc *UserController) bindUser(c *gin.Context, user *models.UserProfile) error {
+	return uc.decodeUser(c, user, func(obj any) error { return negotiate.Bind(c, obj) })
+}
+
+// decodeUser decodes and validates a body with bind, in the format of the
+// request's API version, over user. Metadata in the body replaces the user's
+// rather than being merged with it; the user service checks it against the
+// metadata schema of the request's tenant. The status cannot be changed this
+// way and keeps its value.
+func (uc *UserController) decodeUser(c *gin.Context, user *models.UserProfile, bind func(obj any) error) error {
+	current, status := user.Metadata, user.Status
+	user.Metadata = nil
+	defer func() { user.Status = status }()
+	switch apiversion.From(c) {
+	case apiversion.V2:
+		body := dto.NewUserV2(*user)
+		if err := bind(&body); err != nil {
+			return err
+		}
+		body.ApplyTo(user)
+	default:
+		if err := bind(user); err != nil {
+			return err
+		}
+	}
+	if user.Metadata == nil {
+		user.Metadata = current
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/config"
+	"userprofile-api/service"
+	"userprofile-api/sharing"
+	"userprofile-api/tenant"
+)
+
+// ShareController hands out signed links to user profiles
+type ShareController struct {
+	users   *service.UserService
+	signer  *sharing.Signer
+	cfg     config.SharingConfig
+	baseURL string
+}
+
+// NewShareController creates a controller signing links with signer, under
+// baseURL when it is set and root-relative otherwise
+func NewShareController(users *service.UserService, signer *sharing.Signer, cfg config.SharingConfig,
+	baseURL string) *ShareController {
+	return &ShareController{users: users, signer: signer, cfg: cfg, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// ShareUser returns a link reading the user without other credentials until
+// it expires, after the expiresIn query parameter or SHARE_LINK_TTL
+func (sc *ShareController) ShareUser(c *gin.Context) {
+	ttl := sc.cfg.TTL
+	if value := c.Query("expiresIn"); value != "" {
+		var err error
+		if ttl, err = time.ParseDuration(value); err != nil || ttl <= 0 || ttl > sc.cfg.MaxTTL {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter,
+				"expiresIn must be a positive duration, such as 24h, of at most "+sc.cfg.MaxTTL.String(),
+				gin.H{"parameter": "expiresIn", "value": value})
+			return
+		}
+	}
+
+	id := c.Param("id")
+	if _, err := tenantService(c, sc.users).Get(c.Request.Context(), id); err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+
+	// The link is to the user's path, as requested; recipients cannot send
+	// X-Tenant-ID, so the link names the tenant in the path instead
+	path := strings.TrimSuffix(c.Request.URL.Path, "/share")
+	if id := tenant.ID(c); id != "" && c.Param(tenant.Param) == "" {
+		i := strings.LastIndex(path, "/users/")
+		path = path[:i] + "/tenants/" + id + path[i:]
+	}
+	respond(c, http.StatusOK, sc.signer.Link(sc.baseURL, path, time.Now().Add(ttl)), nil)
+}
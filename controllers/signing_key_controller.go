@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/signing"
+)
+
+// SigningKeyController manages the keys partners sign their requests with
+type SigningKeyController struct {
+	keys *signing.Registry
+}
+
+// NewSigningKeyController creates a controller for the given registry
+func NewSigningKeyController(keys *signing.Registry) *SigningKeyController {
+	return &SigningKeyController{keys: keys}
+}
+
+// signingKeyRequest is the body accepted when creating a key
+type signingKeyRequest struct {
+	Name string `json:"name" binding:"required"`
+	// Roles default to viewer
+	Roles []string `json:"roles"`
+}
+
+// ListSigningKeys returns the keys without their secrets
+func (sc *SigningKeyController) ListSigningKeys(c *gin.Context) {
+	respond(c, http.StatusOK, sc.keys.List(), nil)
+}
+
+// CreateSigningKey creates a key. The response, like that of a rotation, is
+// the only place the key's secret is returned.
+func (sc *SigningKeyController) CreateSigningKey(c *gin.Context) {
+	var req signingKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithBindError(c, err)
+		return
+	}
+
+	key, err := sc.keys.Create(req.Name, req.Roles)
+	if errors.Is(err, signing.ErrInvalid) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequestBody, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	respond(c, http.StatusCreated, key, nil)
+}
+
+// RotateSigningKey replaces the secret of a key, returning the new one
+func (sc *SigningKeyController) RotateSigningKey(c *gin.Context) {
+	key, err := sc.keys.Rotate(c.Param("id"))
+	if err != nil {
+		respondWithSigningKeyError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, key, nil)
+}
+
+// DeleteSigningKey revokes a key
+func (sc *SigningKeyController) DeleteSigningKey(c *gin.Context) {
+	if err := sc.keys.Delete(c.Param("id")); err != nil {
+		respondWithSigningKeyError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// respondWithSigningKeyError maps the errors of the key registry to
+// responses
+func respondWithSigningKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, signing.ErrNotFound):
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeSigningKeyNotFound, "Signing key not found",
+			gin.H{"id": c.Param("id")})
+	default:
+		apierror.Internal(c, err)
+	}
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/quota"
+	"userprofile-api/repository"
+	"userprofile-api/tenant"
+)
+
+// TenantController manages the tenants whose users are kept apart
+type TenantController struct {
+	registry *tenant.Registry
+}
+
+// NewTenantController creates a controller for the given registry
+func NewTenantController(registry *tenant.Registry) *TenantController {
+	return &TenantController{registry: registry}
+}
+
+// tenantRequest is the body accepted when creating or updating a tenant. The
+// ID cannot be changed once the tenant is created.
+type tenantRequest struct {
+	ID   string `json:"id"`
+	Name string `json:"name" binding:"required"`
+	// MaxUsers limits the tenant's active users; zero means no limit
+	MaxUsers int `json:"maxUsers" binding:"min=0"`
+}
+
+// ListTenants returns every tenant, deactivated ones included
+func (tc *TenantController) ListTenants(c *gin.Context) {
+	respond(c, http.StatusOK, tc.registry.List(), nil)
+}
+
+// GetTenant returns a tenant
+func (tc *TenantController) GetTenant(c *gin.Context) {
+	t, err := tc.registry.Get(c.Param(tenant.Param))
+	if err != nil {
+		respondWithTenantError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, t, nil)
+}
+
+// CreateTenant registers an active tenant. Its storage is opened on its
+// first user request.
+func (tc *TenantController) CreateTenant(c *gin.Context) {
+	var req tenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithBindError(c, err)
+		return
+	}
+
+	t, err := tc.registry.Create(tenant.Tenant{ID: req.ID, Name: req.Name, MaxUsers: req.MaxUsers})
+	if err != nil {
+		respondWithTenantError(c, err)
+		return
+	}
+	respond(c, http.StatusCreated, t, nil)
+}
+
+// UpdateTenant replaces a tenant's name and user quota. Lowering the quota
+// below the current number of users only stops new users from being added.
+func (tc *TenantController) UpdateTenant(c *gin.Context) {
+	var req tenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithBindError(c, err)
+		return
+	}
+
+	t, err := tc.registry.Update(c.Param(tenant.Param), req.Name, req.MaxUsers)
+	if err != nil {
+		respondWithTenantError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, t, nil)
+}
+
+// DeactivateTenant refuses further user requests naming the tenant, keeping
+// its users so it can be activated again
+func (tc *TenantController) DeactivateTenant(c *gin.Context) {
+	t, err := tc.registry.Deactivate(c.Param(tenant.Param))
+	if err != nil {
+		respondWithTenantError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, t, nil)
+}
+
+// ActivateTenant serves a deactivated tenant again
+func (tc *TenantController) ActivateTenant(c *gin.Context) {
+	t, err := tc.registry.Activate(c.Param(tenant.Param))
+	if err != nil {
+		respondWithTenantError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, t, nil)
+}
+
+// respondWithTenantError maps registry errors to responses
+func respondWithTenantError(c *gin.Context, err error) {
+	id := c.Param(tenant.Param)
+	switch {
+	case errors.Is(err, tenant.ErrNotFound):
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeTenantNotFound, "Tenant not found", gin.H{"tenant": id})
+	case errors.Is(err, tenant.ErrConflict):
+		apierror.Respond(c, http.StatusConflict, apierror.CodeTenantAlreadyExists, "A tenant with this ID already exists", nil)
+	case errors.Is(err, tenant.ErrInvalid):
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequestBody, err.Error(), nil)
+	default:
+		apierror.Internal(c, err)
+	}
+}
+
+// checkUserQuota responds with 403 and returns false when adding count users
+// to the request's tenant would exceed its quota. The quota and the room left
+// in it are reported in the X-User-Quota headers either way.
+func checkUserQuota(c *gin.Context, repo repository.UserRepository, count int) bool {
+	t, active, limited, err := userQuota(c, repo)
+	if err != nil {
+		apierror.Internal(c, err)
+		return false
+	}
+	if limited && active+count > t.MaxUsers {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeUserQuotaExceeded,
+			"The tenant's user quota does not allow more users", gin.H{"tenant": t.ID, "maxUsers": t.MaxUsers, "users": active})
+		return false
+	}
+	return true
+}
+
+// userQuota returns the request's tenant and how many active users it has,
+// setting the X-User-Quota headers, or limited false when the tenant's users
+// are not limited
+func userQuota(c *gin.Context, repo repository.UserRepository) (t tenant.Tenant, active int, limited bool, err error) {
+	t, ok := tenant.From(c)
+	if !ok || t.MaxUsers == 0 {
+		return t, 0, false, nil
+	}
+	if _, active, err = repo.List(c.Request.Context(), repository.ListOptions{Limit: 1}); err != nil {
+		return t, 0, false, err
+	}
+	c.Header(quota.UserLimitHeader, strconv.Itoa(t.MaxUsers))
+	c.Header(quota.UserRemainingHeader, strconv.Itoa(max(t.MaxUsers-active, 0)))
+	return t, active, true, nil
+}
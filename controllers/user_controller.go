@@ -1,84 +1,781 @@
 package controllers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
+	"math/rand/v2"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"userprofile-api/apierror"
+	"userprofile-api/cursor"
+	"userprofile-api/emoji"
+	"userprofile-api/envelope"
+	"userprofile-api/lifecycle"
+	"userprofile-api/metadata"
 	"userprofile-api/models"
+	"userprofile-api/moderation"
+	"userprofile-api/negotiate"
+	"userprofile-api/replica"
+	"userprofile-api/repository"
+	"userprofile-api/seed"
+	"userprofile-api/service"
+	"userprofile-api/tenant"
+	"userprofile-api/tracing"
 )
 
-// Sample user data
-var users = []models.UserProfile{
-	{ID: "1", FullName: "John Doe", Emoji: "😀"},
-	{ID: "2", FullName: "Jane Smith", Emoji: "🚀"},
-	{ID: "3", FullName: "Robert Johnson", Emoji: "🎸"},
+// UserController handles HTTP requests for user profiles, leaving the rules
+// users are held to to the user service
+type UserController struct {
+	users   *service.UserService
+	cursors *cursor.Codec
 }
 
-// HomePageHandler renders a HTML page displaying users in a table
-func HomePageHandler(c *gin.Context) {
-	log.Println("GET / endpoint called")
-	c.HTML(http.StatusOK, "users.html", gin.H{
-		"Users": users,
-	})
+// NewUserController creates a controller working on users through the given
+// service, signing list cursors with the given codec
+func NewUserController(users *service.UserService, cursors *cursor.Codec) *UserController {
+	return &UserController{users: users, cursors: cursors}
+}
+
+// service returns the user service working on the request's tenant, tracing
+// each repository call as a child span of the span of the context it is
+// passed
+func (uc *UserController) service(c *gin.Context) *service.UserService {
+	return tenantService(c, uc.users)
+}
+
+// tenantService returns users working on the request's tenant, tracing each
+// repository call
+func tenantService(c *gin.Context, users *service.UserService) *service.UserService {
+	return users.ForTenant(tenant.ID(c), tracedRepository(c, users.Repository()))
+}
+
+// tracedRepository returns the repository of the request's tenant, or repo
+// when it names none, tracing each call
+func tracedRepository(c *gin.Context, repo repository.UserRepository) repository.UserRepository {
+	return tracing.Repository(tenant.Repository(c, repo))
 }
 
-// GetUsers returns all users
-func GetUsers(c *gin.Context) {
+// GetUsers returns a page of users, optionally filtered by the fullName,
+// emoji, tag, status and q query parameters and ordered by the sort
+// parameter, with pagination metadata in the headers. Archived users are
+// only listed when status asks for them, and soft-deleted users when
+// include_deleted is true. Pages are selected by page and per_page, or
+// by cursor and limit (see listUsersByCursor).
+func (uc *UserController) GetUsers(c *gin.Context) {
 	log.Println("GET /api/v1/users endpoint called")
-	c.JSON(http.StatusOK, users)
+
+	var opts repository.ListOptions
+	var err error
+	if opts.Sort, err = repository.ParseSort(c.Query("sort")); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter, err.Error(),
+			gin.H{"parameter": "sort", "allowed": repository.SortableFields})
+		return
+	}
+	if opts.IncludeDeleted, err = parseIncludeDeleted(c); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter, err.Error(),
+			gin.H{"parameter": "include_deleted"})
+		return
+	}
+	opts.Filter = repository.UserFilter{
+		FullName: c.Query("fullName"),
+		Emoji:    c.Query("emoji"),
+		Query:    c.Query("q"),
+		Tag:      models.NormalizeTag(c.Query("tag")),
+		Statuses: models.ListedStatuses,
+	}
+	if value := c.Query("status"); value != "" {
+		if opts.Filter.Statuses, err = models.ParseStatuses(value); err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter, err.Error(),
+				gin.H{"parameter": "status", "allowed": models.Statuses})
+			return
+		}
+	}
+	// Emoji are stored normalized, so match the filter in the same form
+	if normalized, err := emoji.Normalize(opts.Filter.Emoji); err == nil {
+		opts.Filter.Emoji = normalized
+	}
+
+	// Very large lists are better streamed than paged through
+	if negotiate.AcceptsNDJSON(c) {
+		uc.streamUsers(c, opts)
+		return
+	}
+	if wantsCursor(c) {
+		uc.listUsersByCursor(c, opts)
+		return
+	}
+
+	page, err := parsePagination(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter, err.Error(), nil)
+		return
+	}
+	pageOpts := page.listOptions()
+	opts.Offset, opts.Limit = pageOpts.Offset, pageOpts.Limit
+
+	users, total, err := uc.service(c).List(c.Request.Context(), opts)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	setPaginationHeaders(c, page, total)
+	if notModified(c, listETag(users, total), time.Time{}) {
+		return
+	}
+	renderUsers(c, http.StatusOK, users, page.meta(total))
 }
 
-// GetUser returns a single user by ID
-func GetUser(c *gin.Context) {
+// listUsersByCursor returns up to limit users created after the position in
+// the cursor parameter, oldest first, along with the cursor of the next page.
+// Unlike page numbers, cursors neither skip nor repeat users when others are
+// added or deleted between requests.
+func (uc *UserController) listUsersByCursor(c *gin.Context, opts repository.ListOptions) {
+	page, err := parseCursorPage(c, uc.cursors)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter, err.Error(), nil)
+		return
+	}
+
+	// Ask for one user more than the page holds to learn whether there is
+	// a next page
+	opts.After, opts.Limit = page.After, page.Limit+1
+	users, total, err := uc.service(c).List(c.Request.Context(), opts)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	var next string
+	if len(users) > page.Limit {
+		users = users[:page.Limit]
+		next = uc.cursors.Encode(repository.CursorOf(users[len(users)-1]))
+	}
+
+	setCursorHeaders(c, total, next)
+	if notModified(c, listETag(users, total), time.Time{}) {
+		return
+	}
+	meta := &envelope.Pagination{Limit: page.Limit, NextCursor: next}
+	if total >= 0 {
+		meta.Total = &total
+	}
+	renderUsers(c, http.StatusOK, users, meta)
+}
+
+// streamFlushInterval is how many streamed users are written between flushes
+// to the client
+const streamFlushInterval = 100
+
+// streamUsers writes every user the options select as NDJSON, one user per
+// line, as they are read from the repository instead of after reading all of
+// them. Once the first user is written the status cannot change, so a later
+// failure is reported in the X-Stream-Error trailer, and only complete
+// streams end with the X-Total-Count trailer.
+func (uc *UserController) streamUsers(c *gin.Context, opts repository.ListOptions) {
+	h := c.Writer.Header()
+	start := func() {
+		negotiate.VaryAccept(h)
+		h.Set("Content-Type", negotiate.NDJSONContentType)
+		h.Set("Trailer", "X-Total-Count, X-Stream-Error")
+		c.Writer.WriteHeader(http.StatusOK)
+		c.Writer.WriteHeaderNow()
+	}
+
+	encoder := json.NewEncoder(c.Writer)
+	streamed := 0
+	err := uc.service(c).Stream(c.Request.Context(), opts, func(user models.UserProfile) error {
+		if streamed == 0 {
+			start()
+		}
+		if err := encoder.Encode(userBody(c, user)); err != nil {
+			return err
+		}
+		streamed++
+		if streamed%streamFlushInterval == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	switch {
+	case err != nil && streamed == 0:
+		apierror.Internal(c, err)
+	case err != nil:
+		log.Printf("Streaming users failed after %d of them: %v", streamed, err)
+		h.Set("X-Stream-Error", "The list is incomplete; retry the request")
+	default:
+		if streamed == 0 {
+			start()
+		}
+		h.Set("X-Total-Count", strconv.Itoa(streamed))
+	}
+}
+
+// GetUser returns a single user by ID, or 304 when the client's copy is
+// current. With asOf, an RFC 3339 timestamp, it returns the user as it was
+// then, from its history.
+func (uc *UserController) GetUser(c *gin.Context) {
 	id := c.Param("id")
-	
-	for _, user := range users {
-		if user.ID == id {
-			c.JSON(http.StatusOK, user)
+
+	if value := c.Query("asOf"); value != "" {
+		asOf, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter,
+				"asOf must be an RFC 3339 timestamp", gin.H{"parameter": "asOf", "value": value})
 			return
 		}
+		user, err := uc.service(c).GetAsOf(c.Request.Context(), id, asOf)
+		if err != nil {
+			respondWithRepositoryError(c, err)
+			return
+		}
+		// Past versions are not the current representation, so they carry
+		// no validators for conditional requests
+		renderUser(c, http.StatusOK, user)
+		return
+	}
+
+	user, err := uc.service(c).Get(c.Request.Context(), id)
+	if err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+
+	if notModified(c, etag(user), user.UpdatedAt) {
+		return
+	}
+	renderUser(c, http.StatusOK, user)
+}
+
+// GetUserVersions returns every version of a user kept in its history,
+// oldest first, ending with the current one
+func (uc *UserController) GetUserVersions(c *gin.Context) {
+	versions, err := uc.service(c).Versions(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+	renderUsers(c, http.StatusOK, versions, nil)
+}
+
+// GetUserByEmail returns the active user with the given email address
+func (uc *UserController) GetUserByEmail(c *gin.Context) {
+	email := c.Param("email")
+
+	user, err := uc.service(c).GetByEmail(c.Request.Context(), email)
+	if errors.Is(err, repository.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found", gin.H{"email": email})
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	if notModified(c, etag(user), user.UpdatedAt) {
+		return
 	}
-	
-	c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	renderUser(c, http.StatusOK, user)
 }
 
-// CreateUser adds a new user
-func CreateUser(c *gin.Context) {
+// CreateUser adds a new user. A UUID is generated when the request does not
+// supply an ID; an explicit ID that is already taken is rejected with 409.
+func (uc *UserController) CreateUser(c *gin.Context) {
 	var newUser models.UserProfile
-	
-	if err := c.ShouldBindJSON(&newUser); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+	if err := uc.bindUser(c, &newUser); err != nil {
+		respondWithBindError(c, err)
+		return
+	}
+
+	users := uc.service(c)
+	if !checkUserQuota(c, users.Repository(), 1) {
 		return
 	}
-	
-	// For simplicity, we're just appending to the slice
-	// In a real application, you would use a database
-	users = append(users, newUser)
-	
-	c.JSON(http.StatusCreated, newUser)
+	created, err := users.Create(c.Request.Context(), newUser)
+	if err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+
+	setETag(c, created)
+	renderUser(c, http.StatusCreated, created)
 }
 
-// UpdateUser updates an existing user
-func UpdateUser(c *gin.Context) {
-	id := c.Param("id")
-	var updatedUser models.UserProfile
-	
-	if err := c.ShouldBindJSON(&updatedUser); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	
-	for i, user := range users {
-		if user.ID == id {
-			updatedUser.ID = id // Ensure ID doesn't change
-			users[i] = updatedUser
-			c.JSON(http.StatusOK, updatedUser)
+// Number of users GenerateUsers creates by default and at most
+const (
+	defaultGeneratedUsers = 10
+	maxGeneratedUsers     = 1000
+)
+
+// generateErrorHeader explains why GenerateUsers created fewer users than
+// asked for
+const generateErrorHeader = "X-Generate-Error"
+
+// GenerateUsers creates count fake users with realistic names, emails,
+// bios, locations and emoji, for demos and for load-testing the UI and
+// pagination, and returns them. Users are created one at a time, so when one
+// fails after others were created, those are kept and returned with 207
+// Multi-Status and an X-Generate-Error header saying the generation stopped.
+func (uc *UserController) GenerateUsers(c *gin.Context) {
+	count := defaultGeneratedUsers
+	if value := c.Query("count"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxGeneratedUsers {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter,
+				fmt.Sprintf("count must be an integer from 1 to %d", maxGeneratedUsers), nil)
 			return
 		}
+		count = n
 	}
-	
-	c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+
+	users := uc.service(c)
+	if !checkUserQuota(c, users.Repository(), count) {
+		return
+	}
+	r := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	created := make([]models.UserProfile, 0, count)
+	for _, user := range seed.Generate(count, r) {
+		user, err := users.Create(c.Request.Context(), user)
+		if err != nil && len(created) == 0 {
+			respondWithRepositoryError(c, err)
+			return
+		}
+		if err != nil {
+			log.Printf("Generating users failed after %d of %d: %v", len(created), count, err)
+			c.Header(generateErrorHeader, fmt.Sprintf("Generation stopped after %d of %d users; only the users listed were created",
+				len(created), count))
+			renderUsers(c, http.StatusMultiStatus, created, nil)
+			return
+		}
+		created = append(created, user)
+	}
+	renderUsers(c, http.StatusCreated, created, nil)
+}
+
+// UpdateUser updates an existing user. The request must carry the user's
+// current ETag in If-Match so that concurrent edits are not silently lost.
+// Fields missing from the body keep their current values, so clients that
+// predate a field do not clear it.
+func (uc *UserController) UpdateUser(c *gin.Context) {
+	id := c.Param("id")
+
+	match, err := parseIfMatch(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusPreconditionRequired, apierror.CodePreconditionRequired,
+			"Updates require an If-Match header with the user's current ETag", nil)
+		return
+	}
+
+	var bindErr error
+	updated, err := uc.service(c).Update(c.Request.Context(), id, func(user *models.UserProfile) error {
+		if !match.matches(user.Version) {
+			return repository.ErrVersionMismatch
+		}
+		bindErr = uc.bindUser(c, user)
+		return bindErr
+	})
+	if bindErr != nil {
+		respondWithBindError(c, bindErr)
+		return
+	}
+	if err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+
+	setETag(c, updated)
+	renderUser(c, http.StatusOK, updated)
+}
+
+// DeleteUser soft-deletes a user by ID; it can be undone with RestoreUser
+func (uc *UserController) DeleteUser(c *gin.Context) {
+	id := c.Param("id")
+
+	if err := uc.service(c).Delete(c.Request.Context(), id); err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
 }
 
-// DeleteUser removes a user by ID TODO
\ No newline at end of file
+// RestoreUser undeletes a soft-deleted user
+func (uc *UserController) RestoreUser(c *gin.Context) {
+	id := c.Param("id")
+
+	restored, err := uc.service(c).Restore(c.Request.Context(), id)
+	if err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+
+	setETag(c, restored)
+	renderUser(c, http.StatusOK, restored)
+}
+
+// RevertUser rolls a user back to the version given by toVersion, saving it
+// as a new version. Like updates, it requires an If-Match header with the
+// ETag of the user's current version, so changes made since the caller read
+// the user's history are not undone unseen.
+func (uc *UserController) RevertUser(c *gin.Context) {
+	id := c.Param("id")
+
+	value := c.Query("toVersion")
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter,
+			"toVersion must be a positive integer", gin.H{"parameter": "toVersion", "value": value})
+		return
+	}
+	match, err := parseIfMatch(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusPreconditionRequired, apierror.CodePreconditionRequired,
+			"Updates require an If-Match header with the user's current ETag", nil)
+		return
+	}
+
+	reverted, err := uc.service(c).Revert(c.Request.Context(), id, version, func(current models.UserProfile) error {
+		if !match.matches(current.Version) {
+			return repository.ErrVersionMismatch
+		}
+		return nil
+	})
+	if errors.Is(err, service.ErrVersionNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeVersionNotFound, "Version not found",
+			gin.H{"id": id, "version": version})
+		return
+	}
+	if err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+
+	setETag(c, reverted)
+	renderUser(c, http.StatusOK, reverted)
+}
+
+// SuspendUser keeps an active user from use until it is activated again
+func (uc *UserController) SuspendUser(c *gin.Context) {
+	uc.transitionUser(c, models.StatusSuspended)
+}
+
+// ActivateUser puts a suspended or archived user back in use
+func (uc *UserController) ActivateUser(c *gin.Context) {
+	uc.transitionUser(c, models.StatusActive)
+}
+
+// ArchiveUser leaves a user out of lists unless they ask for archived users
+func (uc *UserController) ArchiveUser(c *gin.Context) {
+	uc.transitionUser(c, models.StatusArchived)
+}
+
+// transitionUser moves a user to a status, responding with 409 when its
+// current status cannot move there
+func (uc *UserController) transitionUser(c *gin.Context, to models.Status) {
+	user, err := uc.service(c).Transition(c.Request.Context(), c.Param("id"), to)
+	if err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+
+	setETag(c, user)
+	renderUser(c, http.StatusOK, user)
+}
+
+// searchResultBody is a user matching a search with its relevance and
+// highlighted snippets
+type searchResultBody struct {
+	XMLName    struct{}       `json:"-" yaml:"-" xml:"result"`
+	User       any            `json:"user" xml:"user" yaml:"user"`
+	Score      float64        `json:"score" xml:"score" yaml:"score"`
+	Highlights highlightsBody `json:"highlights" xml:"highlights" yaml:"highlights"`
+}
+
+type highlightsBody struct {
+	FullName string `json:"fullName,omitempty" xml:"fullName,omitempty" yaml:"fullName,omitempty"`
+	Bio      string `json:"bio,omitempty" xml:"bio,omitempty" yaml:"bio,omitempty"`
+}
+
+// SearchUsers returns the users whose full name or bio contains every word
+// of the q query parameter, most relevant first, with the matching words
+// marked in snippets. limit caps the number of results, and fuzziness lets
+// words match with up to that many typos, or a number scaled to each word's
+// length when it is "auto".
+func (uc *UserController) SearchUsers(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter, "q is required", nil)
+		return
+	}
+	limit, err := parseLimit(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter, err.Error(), nil)
+		return
+	}
+
+	fuzziness, err := parseFuzziness(c.Query("fuzziness"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter, err.Error(), nil)
+		return
+	}
+
+	results, err := uc.service(c).Search(c.Request.Context(), repository.SearchOptions{Query: query, Limit: limit, Fuzziness: fuzziness})
+	if err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+
+	bodies := make([]searchResultBody, 0, len(results))
+	for _, result := range results {
+		bodies = append(bodies, searchResultBody{
+			User:       userBody(c, result.User),
+			Score:      result.Score,
+			Highlights: highlightsBody{FullName: result.Highlights.FullName, Bio: result.Highlights.Bio},
+		})
+	}
+	respondWithResults(c, bodies)
+}
+
+// parseFuzziness reads the fuzziness query parameter, which defaults to
+// exact matching
+func parseFuzziness(value string) (int, error) {
+	switch value {
+	case "":
+		return 0, nil
+	case "auto":
+		return repository.FuzzinessAuto, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || n > repository.MaxFuzziness {
+		return 0, fmt.Errorf("fuzziness must be auto or an integer from 0 to %d", repository.MaxFuzziness)
+	}
+	return n, nil
+}
+
+// duplicateCandidateBody is the profile CheckDuplicates looks for; the other
+// attributes of a user may be sent along and are ignored
+type duplicateCandidateBody struct {
+	FullName string `json:"fullName"`
+	Email    string `json:"email"`
+}
+
+// duplicateBody is an existing user that is likely the same person as the
+// candidate, with how alike they are
+type duplicateBody struct {
+	XMLName    struct{} `json:"-" yaml:"-" xml:"duplicate"`
+	User       any      `json:"user" xml:"user" yaml:"user"`
+	Score      float64  `json:"score" xml:"score" yaml:"score"`
+	NameScore  float64  `json:"nameScore" xml:"nameScore" yaml:"nameScore"`
+	EmailScore float64  `json:"emailScore" xml:"emailScore" yaml:"emailScore"`
+	Reasons    []string `json:"reasons" xml:"reasons>reason" yaml:"reasons"`
+}
+
+// CheckDuplicates returns the active users likely to be the same person as
+// the candidate profile in the body, by the similarity of their full names
+// and email addresses, best matches first, so clients can offer them before
+// creating a duplicate. limit caps the number of results.
+func (uc *UserController) CheckDuplicates(c *gin.Context) {
+	var candidate duplicateCandidateBody
+	if err := c.ShouldBindJSON(&candidate); err != nil {
+		respondWithBindError(c, err)
+		return
+	}
+	if strings.TrimSpace(candidate.FullName) == "" && strings.TrimSpace(candidate.Email) == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequestBody, "fullName or email is required", nil)
+		return
+	}
+	limit, err := parseLimit(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter, err.Error(), nil)
+		return
+	}
+
+	duplicates, err := uc.service(c).FindDuplicates(c.Request.Context(),
+		models.UserProfile{FullName: candidate.FullName, Email: candidate.Email}, limit)
+	if err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+
+	bodies := make([]duplicateBody, 0, len(duplicates))
+	for _, duplicate := range duplicates {
+		bodies = append(bodies, duplicateBody{
+			User:       userBody(c, duplicate.User),
+			Score:      round(duplicate.Score),
+			NameScore:  round(duplicate.NameScore),
+			EmailScore: round(duplicate.EmailScore),
+			Reasons:    append([]string{}, duplicate.Reasons...),
+		})
+	}
+	respondWithResults(c, bodies)
+}
+
+// round rounds a score to two decimal places
+func round(score float64) float64 {
+	return math.Round(score*100) / 100
+}
+
+// userStatsBody summarizes the active users
+type userStatsBody struct {
+	XMLName        struct{}         `json:"-" yaml:"-" xml:"stats"`
+	Total          int              `json:"total" xml:"total" yaml:"total"`
+	ByEmoji        []emojiCountBody `json:"byEmoji" xml:"byEmoji>emoji" yaml:"byEmoji"`
+	CreatedLast24h int              `json:"createdLast24h" xml:"createdLast24h" yaml:"createdLast24h"`
+	CreatedLast7d  int              `json:"createdLast7d" xml:"createdLast7d" yaml:"createdLast7d"`
+}
+
+type emojiCountBody struct {
+	Emoji string `json:"emoji" xml:"value,attr" yaml:"emoji"`
+	Count int    `json:"count" xml:"count,attr" yaml:"count"`
+}
+
+// GetUserStats counts the active users in total, by emoji and by how
+// recently they were created
+func (uc *UserController) GetUserStats(c *gin.Context) {
+	stats, err := uc.service(c).Stats(c.Request.Context())
+	if err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+
+	body := userStatsBody{
+		Total:          stats.Total,
+		ByEmoji:        make([]emojiCountBody, 0, len(stats.ByEmoji)),
+		CreatedLast24h: stats.CreatedLast24h,
+		CreatedLast7d:  stats.CreatedLast7d,
+	}
+	for _, count := range stats.ByEmoji {
+		body.ByEmoji = append(body.ByEmoji, emojiCountBody{Emoji: count.Emoji, Count: count.Count})
+	}
+	respond(c, http.StatusOK, body, nil)
+}
+
+// tagCountBody is the number of active users with a tag
+type tagCountBody struct {
+	XMLName struct{} `json:"-" yaml:"-" xml:"tag"`
+	Tag     string   `json:"tag" xml:"name,attr" yaml:"tag"`
+	Count   int      `json:"count" xml:"count,attr" yaml:"count"`
+}
+
+// GetTags counts the active users with each tag, most used first
+func (uc *UserController) GetTags(c *gin.Context) {
+	stats, err := uc.service(c).Stats(c.Request.Context())
+	if err != nil {
+		respondWithRepositoryError(c, err)
+		return
+	}
+
+	tags := make([]tagCountBody, 0, len(stats.ByTag))
+	for _, count := range stats.ByTag {
+		tags = append(tags, tagCountBody{Tag: count.Tag, Count: count.Count})
+	}
+	respond(c, http.StatusOK, tags, nil)
+}
+
+// IncludeDeleted reports whether the request asks for soft-deleted users to
+// be listed, so routes can require extra privileges for it
+func IncludeDeleted(c *gin.Context) bool {
+	includeDeleted, err := parseIncludeDeleted(c)
+	return err == nil && includeDeleted
+}
+
+func parseIncludeDeleted(c *gin.Context) (bool, error) {
+	value := c.Query("include_deleted")
+	if value == "" {
+		return false, nil
+	}
+	includeDeleted, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New("include_deleted must be true or false")
+	}
+	return includeDeleted, nil
+}
+
+// respondWithBindError reports a request body that could not be decoded or
+// failed validation, listing the offending fields for the latter
+func respondWithBindError(c *gin.Context, err error) {
+	message, details := bindError(err)
+	apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequestBody, message, details)
+}
+
+// bindError describes why a body could not be bound, listing the failed
+// validation rules
+func bindError(err error) (message string, details any) {
+	var metadataErr *metadata.Error
+	if errors.As(err, &metadataErr) {
+		fields := make([]gin.H, 0, len(metadataErr.Violations))
+		for _, violation := range metadataErr.Violations {
+			fields = append(fields, gin.H{"field": violation.Field, "rule": "schema", "reason": violation.Reason})
+		}
+		return "Request body failed validation", fields
+	}
+	var rejectedErr *moderation.RejectedError
+	if errors.As(err, &rejectedErr) {
+		return "Request body failed validation",
+			[]gin.H{{"field": rejectedErr.Field, "rule": "moderation", "reason": rejectedErr.Reason}}
+	}
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return "Invalid request body", err.Error()
+	}
+
+	fields := make([]gin.H, 0, len(validationErrs))
+	for _, fieldErr := range validationErrs {
+		field := gin.H{"field": jsonFieldName(fieldErr.Field()), "rule": fieldErr.Tag()}
+		if fieldErr.Param() != "" {
+			field["param"] = fieldErr.Param()
+		}
+		fields = append(fields, field)
+	}
+	return "Request body failed validation", fields
+}
+
+// jsonFieldName converts a Go field name such as FullName to its JSON name
+func jsonFieldName(field string) string {
+	if field == "" {
+		return field
+	}
+	return strings.ToLower(field[:1]) + field[1:]
+}
+
+// respondWithRepositoryError maps repository and user service errors to HTTP
+// responses
+func respondWithRepositoryError(c *gin.Context, err error) {
+	var transitionErr *lifecycle.TransitionError
+	switch {
+	case errors.Is(err, service.ErrInvalid):
+		respondWithBindError(c, err)
+	case errors.Is(err, repository.ErrNotFound):
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found", gin.H{"id": c.Param("id")})
+	case errors.Is(err, repository.ErrEmailConflict):
+		apierror.Respond(c, http.StatusConflict, apierror.CodeEmailAlreadyInUse, "Another user already has this email address", nil)
+	case errors.Is(err, repository.ErrConflict):
+		apierror.Respond(c, http.StatusConflict, apierror.CodeUserAlreadyExists, "User with this ID already exists", nil)
+	case errors.As(err, &transitionErr):
+		apierror.Respond(c, http.StatusConflict, apierror.CodeInvalidStatusTransition, transitionErr.Error(),
+			gin.H{"id": c.Param("id"), "from": transitionErr.From, "to": transitionErr.To})
+	case errors.Is(err, repository.ErrVersionMismatch):
+		apierror.Respond(c, http.StatusPreconditionFailed, apierror.CodePreconditionFailed,
+			"User was modified by another request; fetch it again and retry", gin.H{"id": c.Param("id")})
+	case errors.Is(err, repository.ErrReadOnly):
+		// Clients are pointed at the same request on the primary when its
+		// URL is known
+		status, location := replica.Refusal(c)
+		var details any
+		if location != "" {
+			c.Header("Location", location)
+			details = gin.H{"primary": location}
+		}
+		apierror.Respond(c, status, apierror.CodeReadOnlyReplica, "This server is a read replica; change users through the primary", details)
+	default:
+		apierror.Internal(c, err)
+	}
+}
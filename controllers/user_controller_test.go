@@ -0,0 +1,236 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/controllers"
+	"userprofile-api/cursor"
+	"userprofile-api/models"
+	"userprofile-api/repository"
+	"userprofile-api/seed"
+	"userprofile-api/service"
+)
+
+// newRouter returns a router serving the user endpoints over an in-memory
+// store holding users
+func newRouter(tb testing.TB, users int) *gin.Engine {
+	return newRouterFor(tb, repository.NewInMemoryUserRepository(seed.Generate(users, rand.New(rand.NewPCG(1, 2)))))
+}
+
+// newRouterFor returns a router serving the user endpoints over repo
+func newRouterFor(tb testing.TB, repo repository.UserRepository) *gin.Engine {
+	tb.Helper()
+	gin.SetMode(gin.TestMode)
+	// GetUsers logs each call
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	tb.Cleanup(func() { log.SetOutput(output) })
+
+	uc := controllers.NewUserController(service.NewUserService(repo, nil, nil), cursor.New("test-secret"))
+	router := gin.New()
+	router.GET("/api/v1/users", uc.GetUsers)
+	router.POST("/api/v1/users", uc.CreateUser)
+	router.POST("/api/v1/users/generate", uc.GenerateUsers)
+	return router
+}
+
+// contextRecorder records the context of the last listing it was asked for
+type contextRecorder struct {
+	repository.UserRepository
+	ctx context.Context
+}
+
+func (r *contextRecorder) List(ctx context.Context, opts repository.ListOptions) ([]models.UserProfile, int, error) {
+	r.ctx = ctx
+	return r.UserRepository.List(ctx, opts)
+}
+
+type requestKey struct{}
+
+// TestGetUsersPassesRequestContext checks that the repository is called with
+// the context of the HTTP request, so it is cancelled with the request
+func TestGetUsersPassesRequestContext(t *testing.T) {
+	repo := &contextRecorder{UserRepository: repository.NewInMemoryUserRepository(nil)}
+	router := newRouterFor(t, repo)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), requestKey{}, "request"))
+	defer cancel()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequestWithContext(ctx, http.MethodGet, "/api/v1/users", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/v1/users: status %d: %s", rec.Code, rec.Body)
+	}
+	if repo.ctx == nil || repo.ctx.Value(requestKey{}) != "request" {
+		t.Fatal("List was not called with the request's context")
+	}
+	cancel()
+	if !errors.Is(repo.ctx.Err(), context.Canceled) {
+		t.Errorf("List's context: %v after the request was cancelled, want context.Canceled", repo.ctx.Err())
+	}
+}
+
+// TestGetUsersCombinedFilters sends the fullName, emoji, q, tag and status
+// query parameters together through the router, checking that only the users
+// matching all of them are listed and counted
+func TestGetUsersCombinedFilters(t *testing.T) {
+	router := newRouterFor(t, repository.NewInMemoryUserRepository([]models.UserProfile{
+		{ID: "1", FullName: "Ada Lovelace", Emoji: "😀", Tags: []string{"math"}, Status: models.StatusActive},
+		{ID: "2", FullName: "Ada Byron", Emoji: "🚀", Tags: []string{"math", "poetry"}, Status: models.StatusSuspended},
+		{ID: "3", FullName: "Grace Hopper", Emoji: "🚀", Tags: []string{"navy"}, Status: models.StatusActive},
+		{ID: "4", FullName: "Alan Turing", Emoji: "😀", Tags: []string{"math"}, Status: models.StatusArchived},
+	}))
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"fullName=ada&emoji=😀", []string{"1"}},
+		{"fullName=ADA&q=byron", []string{"2"}},
+		{"fullName=ada&emoji=🚀&q=lovelace", nil},
+		{"q=ing&emoji=😀&status=archived", []string{"4"}},
+		{"q=ing&emoji=😀", nil},
+		{"fullName=a&tag=math&status=active,archived", []string{"1", "4"}},
+		{"fullName=grace&emoji=🚀&q=hop&tag=navy", []string{"3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/users?"+escapeQuery(tt.query), nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			var users []models.UserProfile
+			if err := json.Unmarshal(rec.Body.Bytes(), &users); err != nil {
+				t.Fatalf("decode: %v: %s", err, rec.Body)
+			}
+			var ids []string
+			for _, user := range users {
+				ids = append(ids, user.ID)
+			}
+			total := rec.Header().Get("X-Total-Count")
+			if !slices.Equal(ids, tt.want) || total != strconv.Itoa(len(tt.want)) {
+				t.Errorf("users %v of %s, want %v of %d", ids, total, tt.want, len(tt.want))
+			}
+		})
+	}
+}
+
+// escapeQuery escapes the values of a query string written unescaped
+func escapeQuery(query string) string {
+	values := url.Values{}
+	for param := range strings.SplitSeq(query, "&") {
+		name, value, _ := strings.Cut(param, "=")
+		values.Add(name, value)
+	}
+	return values.Encode()
+}
+
+// failingCreates is a repository whose creates fail once it has created a
+// number of users
+type failingCreates struct {
+	repository.UserRepository
+	left int
+}
+
+func (r *failingCreates) Create(ctx context.Context, user models.UserProfile) (models.UserProfile, error) {
+	if r.left == 0 {
+		return models.UserProfile{}, errors.New("storage failed")
+	}
+	r.left--
+	return r.UserRepository.Create(ctx, user)
+}
+
+// TestGenerateUsersPartialFailure checks that when creating a generated user
+// fails, the users created before it are returned with 207 Multi-Status, or
+// the error is when none was created
+func TestGenerateUsersPartialFailure(t *testing.T) {
+	tests := []struct {
+		name        string
+		creates     int
+		wantStatus  int
+		wantCreated int
+	}{
+		{"every user created", -1, http.StatusCreated, 5},
+		{"failure after some users", 3, http.StatusMultiStatus, 3},
+		{"failure of the first user", 0, http.StatusInternalServerError, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &failingCreates{UserRepository: repository.NewInMemoryUserRepository(nil), left: tt.creates}
+			router := newRouterFor(t, repo)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/users/generate?count=5", nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if failed := rec.Header().Get("X-Generate-Error") != ""; failed != (tt.wantStatus == http.StatusMultiStatus) {
+				t.Errorf("X-Generate-Error %q on status %d", rec.Header().Get("X-Generate-Error"), rec.Code)
+			}
+			if rec.Code == http.StatusInternalServerError {
+				return
+			}
+
+			var listed []models.UserProfile
+			if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+				t.Fatalf("decode: %v: %s", err, rec.Body)
+			}
+			stored, total, err := repo.List(context.Background(), repository.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(listed) != tt.wantCreated || total != tt.wantCreated {
+				t.Fatalf("%d users listed and %d stored, want %d", len(listed), total, tt.wantCreated)
+			}
+			for i, user := range listed {
+				if user.ID != stored[i].ID {
+					t.Errorf("user %d listed as %s, stored as %s", i, user.ID, stored[i].ID)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGetUsers measures listing a page of a thousand users
+func BenchmarkGetUsers(b *testing.B) {
+	router := newRouter(b, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/users?per_page=20", nil))
+		if rec.Code != http.StatusOK {
+			b.Fatalf("GET /api/v1/users: status %d: %s", rec.Code, rec.Body)
+		}
+	}
+}
+
+// BenchmarkCreateUser measures creating users, each with an email of its own
+func BenchmarkCreateUser(b *testing.B) {
+	router := newRouter(b, 0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		body := fmt.Sprintf(`{"fullName":"Bench User","email":"bench.%d@example.com"}`, i)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/users", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusCreated {
+			b.Fatalf("POST /api/v1/users: status %d: %s", rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/webhook"
+)
+
+// WebhookController manages the endpoints subscribed to user change events
+type WebhookController struct {
+	registry *webhook.Registry
+}
+
+// NewWebhookController creates a controller for the given registry
+func NewWebhookController(registry *webhook.Registry) *WebhookController {
+	return &WebhookController{registry: registry}
+}
+
+// webhookRequest is the body accepted when registering an endpoint
+type webhookRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events"`
+	// Secret is generated when omitted
+	Secret string `json:"secret"`
+}
+
+// ListWebhooks returns the registered endpoints without their secrets
+func (wc *WebhookController) ListWebhooks(c *gin.Context) {
+	respond(c, http.StatusOK, wc.registry.List(), nil)
+}
+
+// CreateWebhook registers an endpoint. The response is the only place the
+// endpoint's signing secret is returned.
+func (wc *WebhookController) CreateWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithBindError(c, err)
+		return
+	}
+
+	endpoint, err := wc.registry.Add(webhook.Endpoint{URL: req.URL, Events: req.Events, Secret: req.Secret})
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequestBody, err.Error(), nil)
+		return
+	}
+
+	respond(c, http.StatusCreated, endpoint, nil)
+}
+
+// DeleteWebhook unregisters an endpoint
+func (wc *WebhookController) DeleteWebhook(c *gin.Context) {
+	id := c.Param("id")
+
+	err := wc.registry.Delete(id)
+	if errors.Is(err, webhook.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeWebhookNotFound, "Webhook endpoint not found", gin.H{"id": id})
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,108 @@
+package cors
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/config"
+)
+
+// Policy holds the CORS settings, which can be replaced while the server is
+// running
+type Policy struct {
+	current atomic.Pointer[rules]
+}
+
+// rules are the settings with their header values prepared
+type rules struct {
+	cfg       config.CORSConfig
+	anyOrigin bool
+	methods   string
+	headers   string
+	exposed   string
+	maxAge    string
+}
+
+// New creates a policy applying cfg
+func New(cfg config.CORSConfig) *Policy {
+	p := &Policy{}
+	p.Update(cfg)
+	return p
+}
+
+// Update replaces the settings; requests already being handled keep the old
+// ones
+func (p *Policy) Update(cfg config.CORSConfig) {
+	p.current.Store(&rules{
+		cfg:       cfg,
+		anyOrigin: slices.Contains(cfg.AllowedOrigins, config.AnyOrigin),
+		methods:   strings.Join(cfg.AllowedMethods, ", "),
+		headers:   strings.Join(cfg.AllowedHeaders, ", "),
+		exposed:   strings.Join(cfg.ExposedHeaders, ", "),
+		maxAge:    strconv.Itoa(int(cfg.MaxAge.Seconds())),
+	})
+}
+
+// AllowsOrigin reports whether cross-origin requests from origin are allowed
+func (p *Policy) AllowsOrigin(origin string) bool {
+	r := p.current.Load()
+	return r.anyOrigin || slices.Contains(r.cfg.AllowedOrigins, origin)
+}
+
+// Middleware adds CORS headers for allowed origins and answers preflight
+// requests directly, before routing and authentication. It must be installed
+// on the engine so that preflights for routes without an OPTIONS handler
+// still reach it. While no origin is allowed it does nothing.
+func (p *Policy) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r := p.current.Load()
+		origin := c.GetHeader("Origin")
+		if origin == "" || !r.cfg.Enabled() {
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		if !r.anyOrigin {
+			h.Add("Vary", "Origin")
+		}
+		if !r.anyOrigin && !slices.Contains(r.cfg.AllowedOrigins, origin) {
+			c.Next()
+			return
+		}
+
+		if r.anyOrigin {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if r.cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if isPreflight(c.Request) {
+			h.Set("Access-Control-Allow-Methods", r.methods)
+			if r.headers != "" {
+				h.Set("Access-Control-Allow-Headers", r.headers)
+			}
+			if r.cfg.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", r.maxAge)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		if r.exposed != "" {
+			h.Set("Access-Control-Expose-Headers", r.exposed)
+		}
+		c.Next()
+	}
+}
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
@@ -0,0 +1,120 @@
+package credentials
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"userprofile-api/config"
+)
+
+// ErrMismatch is returned when a password does not match its hash
+var ErrMismatch = errors.New("password does not match")
+
+// argon2id parameters, as recommended by OWASP: 19 MiB of memory, two passes
+// and one thread
+const (
+	argonMemory  = 19 * 1024
+	argonTime    = 2
+	argonThreads = 1
+	argonSaltLen = 16
+	argonKeyLen  = 32
+)
+
+// Hash hashes a password with the named algorithm, config.HashBcrypt or
+// config.HashArgon2id. The hash names its algorithm and parameters, so Verify
+// needs nothing else.
+func Hash(algorithm, password string) (string, error) {
+	switch algorithm {
+	case config.HashBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		return string(hash), err
+	case config.HashArgon2id:
+		salt := make([]byte, argonSaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+		// The PHC string format, as other argon2 implementations write it
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argonMemory, argonTime, argonThreads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	default:
+		return "", fmt.Errorf("unknown password hash %q", algorithm)
+	}
+}
+
+// Verify checks a password against a hash made by Hash with either
+// algorithm, returning ErrMismatch when it does not match
+func Verify(hash, password string) error {
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrMismatch
+		}
+		return err
+	}
+
+	params, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	key := argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(params.key)))
+	if subtle.ConstantTimeCompare(key, params.key) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// NeedsRehash reports whether a hash was made with another algorithm, or
+// weaker parameters, than Hash would use now
+func NeedsRehash(hash, algorithm string) bool {
+	switch algorithm {
+	case config.HashBcrypt:
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost < bcrypt.DefaultCost
+	case config.HashArgon2id:
+		params, err := parseArgon2id(hash)
+		return err != nil || params.memory < argonMemory || params.time < argonTime
+	default:
+		return false
+	}
+}
+
+// argon2idParams are the parameters, salt and key of an argon2id hash
+type argon2idParams struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2id parses a hash in the PHC string format,
+// $argon2id$v=19$m=...,t=...,p=...$salt$key
+func parseArgon2id(hash string) (argon2idParams, error) {
+	var params argon2idParams
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, errors.New("malformed argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, fmt.Errorf("malformed argon2id parameters %q", parts[3])
+	}
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.key) == 0 {
+		return params, errors.New("malformed argon2id key")
+	}
+	return params, nil
+}
@@ -0,0 +1,314 @@
+package credentials
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"userprofile-api/auth"
+)
+
+// ErrInvalidToken is returned for refresh tokens that are unknown, expired,
+// revoked or already used
+var ErrInvalidToken = errors.New("invalid refresh token")
+
+// Session is a login of a user, kept alive by refreshing it. Each refresh
+// replaces its refresh token, and the access tokens issued for it carry its
+// ID, so revoking the session revokes them all.
+type Session struct {
+	ID     string `json:"id"`
+	Tenant string `json:"tenant,omitempty"`
+	UserID string `json:"userId"`
+	// Current is the hash of the refresh token that may be used next;
+	// Previous lists the hashes of those already used, so that a stolen token
+	// used twice is recognized
+	Current  string   `json:"current"`
+	Previous []string `json:"previous,omitempty"`
+	// ExpiresAt is when the current refresh token expires, and with it the
+	// session
+	ExpiresAt time.Time `json:"expiresAt"`
+	// RevokedAt is when the session was logged out or revoked, if it was
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// Sessions keeps the sessions of users with password-based accounts in memory
+// and, when it has a file, saves them to it after every change, so they
+// survive restarts. Only hashes of the refresh tokens are kept. Sessions are
+// forgotten once they expire; as they outlive the access tokens issued for
+// them, so have those.
+type Sessions struct {
+	path string
+	ttl  time.Duration
+
+	mu sync.RWMutex
+	// sessions holds the sessions by tenant and ID, as keyed by sessionKey
+	sessions map[string]*Session
+	// tokens maps the hash of every refresh token of a live session to the
+	// session's key
+	tokens map[string]string
+}
+
+// OpenSessions loads the sessions saved in the JSON file at path, starting
+// empty if it does not exist yet, whose refresh tokens last ttl. With an
+// empty path the sessions are only kept in memory, and every user has to log
+// in again after a restart.
+func OpenSessions(path string, ttl time.Duration) (*Sessions, error) {
+	s := &Sessions{path: path, ttl: ttl, sessions: map[string]*Session{}, tokens: map[string]string{}}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*Session
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	for _, session := range sessions {
+		s.add(session)
+	}
+	return s, nil
+}
+
+// Start begins a session of a user of tenant and returns it with its first
+// refresh token
+func (s *Sessions) Start(tenant, userID string) (Session, string, error) {
+	token, hash, err := newRefreshToken()
+	if err != nil {
+		return Session{}, "", err
+	}
+	session := &Session{
+		ID:        uuid.NewString(),
+		Tenant:    tenant,
+		UserID:    userID,
+		Current:   hash,
+		ExpiresAt: time.Now().UTC().Add(s.ttl),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+	s.add(session)
+	if err := s.save(); err != nil {
+		s.remove(session)
+		return Session{}, "", fmt.Errorf("save %s: %w", s.path, err)
+	}
+	return *session, token, nil
+}
+
+// Refresh replaces a refresh token of a session of tenant with a new one,
+// which lasts the full TTL, and returns the session with it. Tokens that were
+// already replaced revoke their session, since one of its tokens must have
+// been stolen.
+func (s *Sessions) Refresh(tenant, token string) (Session, string, error) {
+	next, nextHash, err := newRefreshToken()
+	if err != nil {
+		return Session{}, "", err
+	}
+	hash := hashToken(token)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.live(tenant, hash)
+	if !ok {
+		return Session{}, "", ErrInvalidToken
+	}
+	if session.Current != hash {
+		if err := s.revoke(session); err != nil {
+			return Session{}, "", err
+		}
+		return Session{}, "", ErrInvalidToken
+	}
+
+	previous := *session
+	session.Previous = append(slices.Clip(session.Previous), session.Current)
+	session.Current = nextHash
+	session.ExpiresAt = time.Now().UTC().Add(s.ttl)
+	s.tokens[nextHash] = session.key()
+	if err := s.save(); err != nil {
+		*session = previous
+		delete(s.tokens, nextHash)
+		return Session{}, "", fmt.Errorf("save %s: %w", s.path, err)
+	}
+	return *session, next, nil
+}
+
+// Revoke ends the session a refresh token of tenant belongs to, along with
+// the access tokens issued for it. Tokens of no live session are ignored.
+func (s *Sessions) Revoke(tenant, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.live(tenant, hashToken(token))
+	if !ok {
+		return nil
+	}
+	return s.revoke(session)
+}
+
+// RevokeUser ends every session of a user of tenant, for users that are
+// deleted or may no longer log in
+func (s *Sessions) RevokeUser(tenant, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, session := range s.sessions {
+		if session.Tenant == tenant && session.UserID == userID && session.RevokedAt == nil {
+			if err := s.revoke(session); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Revoked reports whether the access token with the given claims was issued
+// for a session of its tenant that was revoked or has been forgotten, so a
+// token naming a session of another tenant is revoked too. Tokens issued
+// without a session are not checked; those without a tenant claim are of the
+// default storage.
+func (s *Sessions) Revoked(claims *auth.Claims) bool {
+	if claims.SessionID == "" {
+		return false
+	}
+	var tenant string
+	if claims.Tenant != nil {
+		tenant = *claims.Tenant
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	session, ok := s.sessions[sessionKey(tenant, claims.SessionID)]
+	return !ok || session.RevokedAt != nil
+}
+
+// live returns the unrevoked, unexpired session of tenant that the refresh
+// token with the given hash was issued for. The caller must hold mu.
+func (s *Sessions) live(tenant, hash string) (*Session, bool) {
+	session, ok := s.sessions[s.tokens[hash]]
+	if !ok || session.Tenant != tenant || session.RevokedAt != nil || !time.Now().Before(session.ExpiresAt) {
+		return nil, false
+	}
+	return session, true
+}
+
+// revoke marks a session revoked and saves it. The caller must hold mu.
+func (s *Sessions) revoke(session *Session) error {
+	now := time.Now().UTC()
+	session.RevokedAt = &now
+	if err := s.save(); err != nil {
+		session.RevokedAt = nil
+		return fmt.Errorf("save %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// sessionKey keys the session with the given ID of tenant, "" being the
+// default storage
+func sessionKey(tenant, id string) string {
+	return tenant + "/" + id
+}
+
+// key returns the key the session is held by
+func (s *Session) key() string {
+	return sessionKey(s.Tenant, s.ID)
+}
+
+// add indexes a session by its tenant and ID, and the hashes of its refresh
+// tokens. The caller must hold mu for writing.
+func (s *Sessions) add(session *Session) {
+	s.sessions[session.key()] = session
+	s.tokens[session.Current] = session.key()
+	for _, hash := range session.Previous {
+		s.tokens[hash] = session.key()
+	}
+}
+
+// remove forgets a session. The caller must hold mu for writing.
+func (s *Sessions) remove(session *Session) {
+	delete(s.sessions, session.key())
+	delete(s.tokens, session.Current)
+	for _, hash := range session.Previous {
+		delete(s.tokens, hash)
+	}
+}
+
+// sweep forgets the sessions that have expired. The caller must hold mu for
+// writing.
+func (s *Sessions) sweep() {
+	now := time.Now()
+	for _, session := range s.sessions {
+		if !now.Before(session.ExpiresAt) {
+			s.remove(session)
+		}
+	}
+}
+
+// save writes the sessions to a temporary file next to the store's file and
+// renames it into place, so a crash never leaves a partial file. The caller
+// must hold mu.
+func (s *Sessions) save() error {
+	if s.path == "" {
+		return nil
+	}
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	slices.SortFunc(sessions, func(a, b *Session) int {
+		return cmp.Or(strings.Compare(a.Tenant, b.Tenant), strings.Compare(a.UserID, b.UserID), strings.Compare(a.ID, b.ID))
+	})
+	data, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// newRefreshToken returns a random refresh token and its hash
+func newRefreshToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// hashToken hashes a refresh token for storage. Tokens are random, so a fast
+// hash is enough to keep a leaked file from being used to refresh sessions.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,103 @@
+package credentials
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"userprofile-api/auth"
+)
+
+// TestRevokedIsTenantScoped checks that access tokens are only accepted for
+// a live session of the tenant they are bound to
+func TestRevokedIsTenantScoped(t *testing.T) {
+	sessions, err := OpenSessions("", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, refreshToken, err := sessions.Start("acme", "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultSession, _, err := sessions.Start("", "user-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := func(tenant *string, sessionID string) *auth.Claims {
+		return &auth.Claims{SessionID: sessionID, Tenant: tenant}
+	}
+	acme, globex, none := "acme", "globex", ""
+	tests := []struct {
+		name   string
+		claims *auth.Claims
+		want   bool
+	}{
+		{"own tenant", claims(&acme, session.ID), false},
+		{"other tenant", claims(&globex, session.ID), true},
+		{"default storage", claims(&none, session.ID), true},
+		{"no tenant claim", claims(nil, session.ID), true},
+		{"default session without tenant claim", claims(nil, defaultSession.ID), false},
+		{"default session with tenant claim", claims(&none, defaultSession.ID), false},
+		{"default session claimed by a tenant", claims(&acme, defaultSession.ID), true},
+		{"unknown session", claims(&acme, "missing"), true},
+		{"no session", claims(&acme, ""), false},
+	}
+	for _, tt := range tests {
+		if got := sessions.Revoked(tt.claims); got != tt.want {
+			t.Errorf("%s: Revoked = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if err := sessions.Revoke("globex", refreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if sessions.Revoked(claims(&acme, session.ID)) {
+		t.Error("revoking with another tenant's name revoked the session")
+	}
+	if err := sessions.Revoke("acme", refreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if !sessions.Revoked(claims(&acme, session.ID)) {
+		t.Error("revoked session still accepted")
+	}
+}
+
+// TestRefreshReuseRevokesOnlyOnceSaved checks that reusing a replaced refresh
+// token leaves its session live when the revocation cannot be saved, as other
+// revocations do, and revokes it once it can
+func TestRefreshReuseRevokesOnlyOnceSaved(t *testing.T) {
+	dir := t.TempDir()
+	sessions, err := OpenSessions(filepath.Join(dir, "sessions.json"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, used, err := sessions.Start("acme", "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := sessions.Refresh("acme", used); err != nil {
+		t.Fatal(err)
+	}
+
+	acme := "acme"
+	claims := &auth.Claims{SessionID: session.ID, Tenant: &acme}
+	path := sessions.path
+	// Saving fails as the directory the file would be written to is missing
+	sessions.path = filepath.Join(dir, "missing", "sessions.json")
+	if _, _, err := sessions.Refresh("acme", used); err == nil || errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Refresh with a reused token while saving fails: %v, want the save error", err)
+	}
+	if sessions.Revoked(claims) {
+		t.Error("session revoked in memory although the revocation was not saved")
+	}
+
+	sessions.path = path
+	if _, _, err := sessions.Refresh("acme", used); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Refresh with a reused token: %v, want ErrInvalidToken", err)
+	}
+	if !sessions.Revoked(claims) {
+		t.Error("session still accepted after its reused token was refused")
+	}
+}
@@ -0,0 +1,170 @@
+// Package credentials keeps the password hashes and login sessions of users
+// with password-based accounts, hashes passwords with bcrypt or argon2id, and
+// checks that new passwords are strong enough. Profiles stay in the user
+// repository; a user has an account when the store holds a hash for it.
+package credentials
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when a user has no password
+var ErrNotFound = errors.New("credentials not found")
+
+// credential is a user's password hash
+type credential struct {
+	Hash      string
+	UpdatedAt time.Time
+}
+
+// record is a credential as saved to the store's file
+type record struct {
+	Tenant    string    `json:"tenant,omitempty"`
+	UserID    string    `json:"userId"`
+	Hash      string    `json:"hash"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Store holds the password hashes in memory and, when it has a file, saves
+// them to it after every change, so they survive restarts. The users of each
+// tenant, named by an empty string for the default storage, are kept apart.
+type Store struct {
+	path string
+
+	mu      sync.RWMutex
+	tenants map[string]map[string]credential
+}
+
+// OpenStore loads the credentials saved in the JSON file at path, starting
+// empty if it does not exist yet. With an empty path the credentials are only
+// kept in memory.
+func OpenStore(path string) (*Store, error) {
+	s := &Store{path: path, tenants: map[string]map[string]credential{}}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	for _, r := range records {
+		s.tenant(r.Tenant)[r.UserID] = credential{Hash: r.Hash, UpdatedAt: r.UpdatedAt}
+	}
+	return s, nil
+}
+
+// Get returns the password hash of a user of tenant
+func (s *Store) Get(tenant, userID string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.tenants[tenant][userID]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return c.Hash, nil
+}
+
+// Set saves the password hash of a user of tenant, replacing any it had
+func (s *Store) Set(tenant, userID, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := s.tenant(tenant)
+	previous, had := users[userID]
+	users[userID] = credential{Hash: hash, UpdatedAt: time.Now().UTC()}
+	if err := s.save(); err != nil {
+		if had {
+			users[userID] = previous
+		} else {
+			delete(users, userID)
+		}
+		return fmt.Errorf("save %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// Delete removes the password of a user of tenant, which can then no longer
+// log in. Users without one are ignored.
+func (s *Store) Delete(tenant, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := s.tenants[tenant]
+	previous, ok := users[userID]
+	if !ok {
+		return nil
+	}
+	delete(users, userID)
+	if err := s.save(); err != nil {
+		users[userID] = previous
+		return fmt.Errorf("save %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// tenant returns the credentials of tenant, adding an empty map for new
+// tenants. The caller must hold mu for writing.
+func (s *Store) tenant(tenant string) map[string]credential {
+	users, ok := s.tenants[tenant]
+	if !ok {
+		users = map[string]credential{}
+		s.tenants[tenant] = users
+	}
+	return users
+}
+
+// save writes the credentials to a temporary file next to the store's file
+// and renames it into place, so a crash never leaves a partial file. The file
+// is only readable by its owner. The caller must hold mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	records := []record{}
+	for tenant, users := range s.tenants {
+		for userID, c := range users {
+			records = append(records, record{Tenant: tenant, UserID: userID, Hash: c.Hash, UpdatedAt: c.UpdatedAt})
+		}
+	}
+	slices.SortFunc(records, func(a, b record) int {
+		return cmp.Or(strings.Compare(a.Tenant, b.Tenant), strings.Compare(a.UserID, b.UserID))
+	})
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// CreateTemp makes the file with mode 0600
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,91 @@
+package credentials
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxLength is the most bytes a password may have, as bcrypt ignores the
+// rest
+const MaxLength = 72
+
+// commonPasswords are passwords that are guessed first, whatever their
+// length and characters
+var commonPasswords = []string{
+	"password", "password1", "password123", "passw0rd", "p@ssw0rd", "p@ssword1",
+	"123456789", "1234567890", "12345678910", "qwertyuiop", "qwerty123", "1q2w3e4r5t",
+	"iloveyou", "sunshine1", "princess1", "football1", "baseball1", "welcome1", "welcome123",
+	"letmein123", "admin123", "administrator", "changeme", "changeme123", "trustno1",
+}
+
+// WeakPasswordError lists the reasons a password was refused
+type WeakPasswordError struct {
+	Reasons []string
+}
+
+func (e *WeakPasswordError) Error() string {
+	return "password is too weak: " + strings.Join(e.Reasons, "; ")
+}
+
+// CheckStrength refuses passwords shorter than minLength characters or longer
+// than MaxLength bytes, with fewer than three of lowercase letters, uppercase
+// letters, digits and symbols, that are commonly used, or that contain one of
+// the personal values, such as the user's name or email address. It returns a
+// *WeakPasswordError listing every reason that applies.
+func CheckStrength(password string, minLength int, personal ...string) error {
+	var reasons []string
+	if utf8.RuneCountInString(password) < minLength {
+		reasons = append(reasons, fmt.Sprintf("must be at least %d characters long", minLength))
+	}
+	if len(password) > MaxLength {
+		reasons = append(reasons, fmt.Sprintf("must be at most %d bytes long", MaxLength))
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, has := range []bool{lower, upper, digit, symbol} {
+		if has {
+			classes++
+		}
+	}
+	if classes < 3 {
+		reasons = append(reasons, "must use at least three of lowercase letters, uppercase letters, digits and symbols")
+	}
+
+	folded := strings.ToLower(password)
+	if slices.Contains(commonPasswords, folded) {
+		reasons = append(reasons, "is too common")
+	}
+personal:
+	for _, value := range personal {
+		for _, word := range strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			// Short words such as initials are likely in any password
+			if utf8.RuneCountInString(word) >= 4 && strings.Contains(folded, word) {
+				reasons = append(reasons, "must not contain your name or email address")
+				break personal
+			}
+		}
+	}
+
+	if len(reasons) > 0 {
+		return &WeakPasswordError{Reasons: reasons}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+// Package csrf protects browsers against cross-site request forgery with
+// double-submit tokens: each browser gets a random token in a cookie, which
+// pages embed in their forms and which state-changing requests must send
+// back. Requests carrying their credentials in a header, or no cookies at
+// all, cannot be forged by another site and are not checked.
+package csrf
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/auth"
+)
+
+// Names under which the token travels
+const (
+	// CookieName is the cookie holding the browser's token
+	CookieName = "csrf_token"
+	// FieldName is the form field forms send the token in
+	FieldName = "_csrf"
+	// HeaderName is the request header scripts send the token in
+	HeaderName = "X-CSRF-Token"
+)
+
+// contextKey is the gin context key holding the request's token
+const contextKey = "csrfToken"
+
+// Middleware gives browsers without a token a new one and protects the
+// requests as Protect does. It is meant for the HTML pages.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := c.Cookie(CookieName)
+		if err != nil || token == "" {
+			token = newToken()
+			// SameSite keeps the cookie off cross-site requests as well,
+			// for browsers that support it
+			http.SetCookie(c.Writer, &http.Cookie{
+				Name:     CookieName,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   c.Request.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+		c.Set(contextKey, token)
+
+		if checked(c.Request) && !valid(c, token) {
+			reject(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Protect rejects state-changing browser requests whose form field or header
+// does not carry the token of their cookie with 403 CSRF_TOKEN_INVALID,
+// without issuing tokens. It is meant for the JSON API, which scripts of the
+// pages call with the token in the X-CSRF-Token header.
+func Protect() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checked(c.Request) {
+			c.Next()
+			return
+		}
+		token, err := c.Cookie(CookieName)
+		if err != nil || !valid(c, token) {
+			reject(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// credentialHeaders carry credentials that browsers never attach on their
+// own, so requests sending them were made deliberately by their client
+var credentialHeaders = []string{auth.APIKeyHeader, auth.AdminTokenHeader}
+
+// checked reports whether a request must carry a token: state-changing
+// requests with cookies, which a browser may have attached to a request
+// forged by another site, unless they authenticate with a bearer token or
+// another header browsers do not send by themselves
+func checked(r *http.Request) bool {
+	if safeMethod(r.Method) || len(r.Cookies()) == 0 {
+		return false
+	}
+	// Unlike bearer tokens, Basic credentials are remembered and resent by
+	// browsers
+	if scheme, _, _ := strings.Cut(r.Header.Get("Authorization"), " "); strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+	for _, header := range credentialHeaders {
+		if r.Header.Get(header) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func reject(c *gin.Context) {
+	apierror.Abort(c, http.StatusForbidden, apierror.CodeCSRFTokenInvalid,
+		"The request does not carry a valid CSRF token; reload the page and try again",
+		gin.H{"accepted": []string{FieldName, HeaderName}})
+}
+
+// Token returns the request's token for pages to embed, or an empty string
+// when the middleware is not installed
+func Token(c *gin.Context) string {
+	return c.GetString(contextKey)
+}
+
+// valid reports whether the request sends back the token of its cookie
+func valid(c *gin.Context, token string) bool {
+	sent := c.GetHeader(HeaderName)
+	if sent == "" {
+		sent = c.PostForm(FieldName)
+	}
+	return sent != "" && token != "" && subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+// newToken returns 32 random bytes, base64url-encoded
+func newToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
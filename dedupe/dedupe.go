@@ -0,0 +1,165 @@
+// Package dedupe scores how likely two user profiles are to describe the same
+// person, from the similarity of their full names and email addresses. Names
+// are compared regardless of case, accents, punctuation and word order, and
+// email addresses regardless of case and subaddresses such as +news.
+package dedupe
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+	"userprofile-api/models"
+)
+
+// MinScore is the lowest score of a likely duplicate
+const MinScore = 0.6
+
+// similar is the lowest similarity of a name or email address reported as
+// similar
+const similar = 0.8
+
+// otherDomain scales the similarity of addresses at different domains
+const otherDomain = 0.8
+
+// Reasons a profile is a likely duplicate
+const (
+	ReasonSameEmail    = "sameEmail"
+	ReasonSimilarEmail = "similarEmail"
+	ReasonSameName     = "sameName"
+	ReasonSimilarName  = "similarName"
+)
+
+// Match scores a profile against a candidate. Scores range from 0 for nothing
+// in common to 1 for the same name or email address.
+type Match struct {
+	// Score combines the name and email scores; the same email address
+	// scores 1 whatever the names
+	Score      float64
+	NameScore  float64
+	EmailScore float64
+	// Reasons lists why the profile matched, such as sameEmail
+	Reasons []string
+}
+
+// Compare scores user against candidate, from the fields the candidate has
+func Compare(candidate, user models.UserProfile) Match {
+	var match Match
+	var scores []float64
+	if name := NormalizeName(candidate.FullName); name != "" {
+		match.NameScore = Similarity(name, NormalizeName(user.FullName))
+		match.Reasons = appendReason(match.Reasons, match.NameScore, ReasonSameName, ReasonSimilarName)
+		scores = append(scores, match.NameScore)
+	}
+	if email := NormalizeEmail(candidate.Email); email != "" {
+		match.EmailScore = emailSimilarity(email, NormalizeEmail(user.Email))
+		match.Reasons = appendReason(match.Reasons, match.EmailScore, ReasonSameEmail, ReasonSimilarEmail)
+		scores = append(scores, match.EmailScore)
+	}
+	if match.EmailScore == 1 {
+		match.Score = 1
+		return match
+	}
+	for _, score := range scores {
+		match.Score += score / float64(len(scores))
+	}
+	return match
+}
+
+// appendReason adds the reason a score gives, if any, to reasons
+func appendReason(reasons []string, score float64, same, similarReason string) []string {
+	switch {
+	case score == 1:
+		return append(reasons, same)
+	case score >= similar:
+		return append(reasons, similarReason)
+	default:
+		return reasons
+	}
+}
+
+// NormalizeName returns the words of name lower-cased, stripped of accents
+// and sorted, so "Lovelace, Ádá" and "ada lovelace" are alike
+func NormalizeName(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(name) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	words := strings.Fields(b.String())
+	slices.Sort(words)
+	return strings.Join(words, " ")
+}
+
+// NormalizeEmail returns email lower-cased and without its subaddress, and
+// for Gmail addresses, which ignore dots, without the dots of its local part
+func NormalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return email
+	}
+	local, _, _ = strings.Cut(local, "+")
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	if domain == "gmail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain
+}
+
+// emailSimilarity returns the similarity of the local parts of two normalized
+// addresses, scaled down when their domains differ, so addresses do not look
+// alike for sharing a domain
+func emailSimilarity(a, b string) float64 {
+	localA, domainA, _ := strings.Cut(a, "@")
+	localB, domainB, _ := strings.Cut(b, "@")
+	similarity := Similarity(localA, localB)
+	if domainA != domainB {
+		similarity *= otherDomain
+	}
+	return similarity
+}
+
+// Similarity returns 1 minus the number of single-rune edits turning a into
+// b, relative to the longer of the two: 1 when they are equal and 0 when
+// either is empty
+func Similarity(a, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	return 1 - float64(levenshtein(ra, rb))/float64(max(len(ra), len(rb)))
+}
+
+// levenshtein returns the number of single-rune insertions, deletions and
+// substitutions turning a into b
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,32 @@
+package docs
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// spec is the hand-maintained OpenAPI 3 document describing the API. Keep it
+// in sync with the routes in api.register.
+//
+//go:embed openapi.json
+var spec []byte
+
+//go:embed swagger.html
+var swaggerUI []byte
+
+// Spec returns the raw OpenAPI document
+func Spec() []byte {
+	return spec
+}
+
+// SpecHandler serves the OpenAPI document
+func SpecHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", spec)
+}
+
+// UIHandler serves an interactive Swagger UI for the OpenAPI document
+func UIHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", swaggerUI)
+}
@@ -0,0 +1,68 @@
+package dto
+
+import (
+	"encoding/xml"
+	"time"
+
+	"userprofile-api/links"
+	"userprofile-api/models"
+)
+
+// UserV2 is the v2 representation of a user profile. It starts out with the
+// same fields as v1, which serializes models.UserProfile directly; breaking
+// changes to the user format are made here so v1 clients are unaffected.
+type UserV2 struct {
+	XMLName   xml.Name        `json:"-" yaml:"-" xml:"user"`
+	ID        string          `json:"id" xml:"id" yaml:"id"`
+	FullName  string          `json:"fullName" xml:"fullName" yaml:"fullName"`
+	Emoji     string          `json:"emoji" xml:"emoji" yaml:"emoji" binding:"omitempty,emoji"`
+	Email     string          `json:"email,omitempty" xml:"email,omitempty" yaml:"email,omitempty" binding:"omitempty,email,max=254"`
+	Bio       string          `json:"bio,omitempty" xml:"bio,omitempty" yaml:"bio,omitempty" binding:"max=500"`
+	Location  string          `json:"location,omitempty" xml:"location,omitempty" yaml:"location,omitempty" binding:"max=100"`
+	Tags      []string        `json:"tags,omitempty" xml:"tags>tag,omitempty" yaml:"tags,omitempty" binding:"max=10,dive,tag"`
+	Metadata  models.Metadata `json:"metadata,omitempty" xml:"metadata,omitempty" yaml:"metadata,omitempty"`
+	Status    models.Status   `json:"status,omitempty" xml:"status,omitempty" yaml:"status,omitempty"`
+	AvatarURL string          `json:"avatarUrl,omitempty" xml:"avatarUrl,omitempty" yaml:"avatarUrl,omitempty"`
+	Version   int             `json:"version" xml:"version" yaml:"version"`
+	CreatedAt time.Time       `json:"createdAt" xml:"createdAt" yaml:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt" xml:"updatedAt" yaml:"updatedAt"`
+	DeletedAt *time.Time      `json:"deletedAt,omitempty" xml:"deletedAt,omitempty" yaml:"deletedAt,omitempty"`
+	ExpiresAt *time.Time      `json:"expiresAt,omitempty" xml:"expiresAt,omitempty" yaml:"expiresAt,omitempty"`
+	// Links is only set when the client asked for HAL links
+	Links links.Links `json:"_links,omitempty" xml:"links,omitempty" yaml:"_links,omitempty"`
+}
+
+// NewUserV2 converts a stored user to its v2 representation
+func NewUserV2(user models.UserProfile) UserV2 {
+	return UserV2{
+		ID:        user.ID,
+		FullName:  user.FullName,
+		Emoji:     user.Emoji,
+		Email:     user.Email,
+		Bio:       user.Bio,
+		Location:  user.Location,
+		Tags:      user.Tags,
+		Metadata:  user.Metadata,
+		Status:    user.Status,
+		AvatarURL: user.AvatarURL,
+		Version:   user.Version,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		DeletedAt: user.DeletedAt,
+		ExpiresAt: user.ExpiresAt,
+	}
+}
+
+// ApplyTo copies the fields clients may set onto a stored user. Fields the
+// server maintains, such as the version and timestamps, are left alone.
+func (u UserV2) ApplyTo(user *models.UserProfile) {
+	user.ID = u.ID
+	user.FullName = u.FullName
+	user.Emoji = u.Emoji
+	user.Email = u.Email
+	user.Bio = u.Bio
+	user.Location = u.Location
+	user.Tags = u.Tags
+	user.Metadata = u.Metadata
+	user.ExpiresAt = u.ExpiresAt
+}
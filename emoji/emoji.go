@@ -0,0 +1,161 @@
+// Package emoji validates and normalizes the emoji of user profiles and maps
+// shortcodes such as :rocket: to the emoji they stand for.
+package emoji
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// ErrInvalid is returned when normalizing text that is not exactly one emoji
+var ErrInvalid = errors.New("not a single emoji")
+
+// Code points with a structural role in emoji sequences
+const (
+	zwj             = '\u200D'
+	textSelector    = '\uFE0E'
+	emojiSelector   = '\uFE0F'
+	combiningKeycap = '\u20E3'
+	blackFlag       = '\U0001F3F4'
+	cancelTag       = '\U000E007F'
+	firstTag        = '\U000E0020'
+	lastTag         = '\U000E007E'
+	firstRegional   = '\U0001F1E6'
+	lastRegional    = '\U0001F1FF'
+	firstModifier   = '\U0001F3FB'
+	lastModifier    = '\U0001F3FF'
+)
+
+// keycapBases are the characters that form keycaps with U+20E3
+const keycapBases = "0123456789#*"
+
+// maxSequenceRunes bounds the length of an emoji; the longest standard
+// sequences, family emoji with skin tones, are under half of it
+const maxSequenceRunes = 32
+
+func init() {
+	// Register the emoji binding tag with the validator shared by gin, the
+	// gRPC API and the command-line tools
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterValidation("emoji", func(fl validator.FieldLevel) bool {
+			return Valid(fl.Field().String())
+		})
+	}
+}
+
+// Valid reports whether s is exactly one emoji, in any form Normalize
+// accepts
+func Valid(s string) bool {
+	_, err := Normalize(s)
+	return err == nil
+}
+
+// Normalize returns the fully-qualified form of s, which must be exactly one
+// emoji, optionally surrounded by spaces: a keycap such as 1️⃣, a flag, a
+// subdivision flag such as Scotland's, or pictographs joined by zero-width
+// joiners, each with an optional skin tone. Variation selectors are made
+// consistent: pictographs that default to text style get the emoji
+// selector, and those that default to emoji style or carry a skin tone get
+// none. A known shortcode such as :rocket: is replaced by its emoji. Any
+// other text, unknown shortcodes included, returns ErrInvalid.
+func Normalize(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if name, ok := shortcodeName(s); ok {
+		emoji, known := Lookup(name)
+		if !known {
+			return "", ErrInvalid
+		}
+		return emoji, nil
+	}
+
+	runes := []rune(s)
+	if len(runes) == 0 || len(runes) > maxSequenceRunes {
+		return "", ErrInvalid
+	}
+
+	switch first := runes[0]; {
+	case strings.ContainsRune(keycapBases, first):
+		rest := runes[1:]
+		if len(rest) > 0 && isSelector(rest[0]) {
+			rest = rest[1:]
+		}
+		if len(rest) != 1 || rest[0] != combiningKeycap {
+			return "", ErrInvalid
+		}
+		return string([]rune{first, emojiSelector, combiningKeycap}), nil
+	case isRegional(first):
+		if len(runes) != 2 || !isRegional(runes[1]) {
+			return "", ErrInvalid
+		}
+		return string(runes), nil
+	}
+
+	var normalized []rune
+	for {
+		element, n, ok := parseElement(runes)
+		if !ok {
+			return "", ErrInvalid
+		}
+		normalized = append(normalized, element...)
+		runes = runes[n:]
+		if len(runes) == 0 {
+			return string(normalized), nil
+		}
+		// Elements may only follow one another joined by a ZWJ
+		if runes[0] != zwj || len(runes) == 1 {
+			return "", ErrInvalid
+		}
+		normalized = append(normalized, zwj)
+		runes = runes[1:]
+	}
+}
+
+// parseElement reads a pictograph at the start of runes with its variation
+// selectors and either a skin tone or a tag sequence, returning its
+// normalized form and the number of runes read
+func parseElement(runes []rune) ([]rune, int, bool) {
+	base := runes[0]
+	if !pictographic.contains(base) {
+		return nil, 0, false
+	}
+	n := 1
+	for n < len(runes) && isSelector(runes[n]) {
+		n++
+	}
+
+	switch {
+	case n < len(runes) && isModifier(runes[n]):
+		return []rune{base, runes[n]}, n + 1, true
+	case base == blackFlag && n < len(runes) && isTag(runes[n]):
+		end := n
+		for end < len(runes) && isTag(runes[end]) {
+			end++
+		}
+		if end == len(runes) || runes[end] != cancelTag {
+			return nil, 0, false
+		}
+		return slices.Concat([]rune{base}, runes[n:end+1]), end + 1, true
+	case hasEmojiPresentation(base):
+		return []rune{base}, n, true
+	default:
+		return []rune{base, emojiSelector}, n, true
+	}
+}
+
+func isSelector(r rune) bool { return r == textSelector || r == emojiSelector }
+func isRegional(r rune) bool { return r >= firstRegional && r <= lastRegional }
+func isModifier(r rune) bool { return r >= firstModifier && r <= lastModifier }
+func isTag(r rune) bool      { return r >= firstTag && r <= lastTag }
+
+// hasEmojiPresentation reports whether a pictograph is shown as an emoji
+// without the emoji variation selector
+func hasEmojiPresentation(r rune) bool {
+	if r < 0x10000 {
+		return emojiPresentationBMP.contains(r)
+	}
+	return !textPresentationSupplementary.contains(r)
+}
@@ -0,0 +1,51 @@
+package emoji_test
+
+import (
+	"errors"
+	"testing"
+
+	"userprofile-api/emoji"
+)
+
+// TestNormalizeShortcodes checks that known shortcodes are replaced by their
+// emoji, and that unknown ones are rejected rather than stored as text
+func TestNormalizeShortcodes(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		err   error
+	}{
+		{":rocket:", "🚀", nil},
+		{"  :rocket: ", "🚀", nil},
+		{":+1:", "👍", nil},
+		{":not_an_emoji:", "", emoji.ErrInvalid},
+		{":Rocket:", "", emoji.ErrInvalid},
+		{":rocket", "", emoji.ErrInvalid},
+		{"::", "", emoji.ErrInvalid},
+		{":rocket::rocket:", "", emoji.ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := emoji.Normalize(tt.input)
+			if got != tt.want || !errors.Is(err, tt.err) {
+				t.Errorf("Normalize(%q) = %q, %v; want %q, %v", tt.input, got, err, tt.want, tt.err)
+			}
+			if valid := emoji.Valid(tt.input); valid != (tt.err == nil) {
+				t.Errorf("Valid(%q) = %t", tt.input, valid)
+			}
+		})
+	}
+}
+
+// TestToShortcode checks that emoji with a shortcode are rendered as it, and
+// that those without one are passed through unchanged
+func TestToShortcode(t *testing.T) {
+	for input, want := range map[string]string{
+		"🚀":  ":rocket:",
+		"👍🏽": "👍🏽",
+	} {
+		if got := emoji.ToShortcode(input); got != want {
+			t.Errorf("ToShortcode(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
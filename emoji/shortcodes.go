@@ -0,0 +1,398 @@
+package emoji
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Shortcode names an emoji in the :name: form used by chat and code hosting
+// services
+type Shortcode struct {
+	// Name is the shortcode without colons, e.g. rocket
+	Name  string
+	Emoji string
+}
+
+// shortcodes maps shortcode names to emoji, following GitHub's names
+var shortcodes = map[string]string{
+	// Smileys and people
+	"grinning":                     "😀",
+	"smiley":                       "😃",
+	"smile":                        "😄",
+	"grin":                         "😁",
+	"laughing":                     "😆",
+	"sweat_smile":                  "😅",
+	"joy":                          "😂",
+	"rofl":                         "🤣",
+	"slightly_smiling_face":        "🙂",
+	"upside_down_face":             "🙃",
+	"wink":                         "😉",
+	"blush":                        "😊",
+	"innocent":                     "😇",
+	"heart_eyes":                   "😍",
+	"star_struck":                  "🤩",
+	"kissing_heart":                "😘",
+	"yum":                          "😋",
+	"stuck_out_tongue_winking_eye": "😜",
+	"zany_face":                    "🤪",
+	"money_mouth_face":             "🤑",
+	"hugs":                         "🤗",
+	"thinking":                     "🤔",
+	"zipper_mouth_face":            "🤐",
+	"neutral_face":                 "😐",
+	"expressionless":               "😑",
+	"smirk":                        "😏",
+	"unamused":                     "😒",
+	"roll_eyes":                    "🙄",
+	"grimacing":                    "😬",
+	"relieved":                     "😌",
+	"pensive":                      "😔",
+	"sleepy":                       "😪",
+	"sleeping":                     "😴",
+	"mask":                         "😷",
+	"nerd_face":                    "🤓",
+	"sunglasses":                   "😎",
+	"cowboy_hat_face":              "🤠",
+	"partying_face":                "🥳",
+	"confused":                     "😕",
+	"worried":                      "😟",
+	"open_mouth":                   "😮",
+	"astonished":                   "😲",
+	"flushed":                      "😳",
+	"pleading_face":                "🥺",
+	"cry":                          "😢",
+	"sob":                          "😭",
+	"scream":                       "😱",
+	"angry":                        "😠",
+	"rage":                         "😡",
+	"exploding_head":               "🤯",
+	"skull":                        "💀",
+	"clown_face":                   "🤡",
+	"ghost":                        "👻",
+	"alien":                        "👽",
+	"robot":                        "🤖",
+	"poop":                         "💩",
+	"smiley_cat":                   "😺",
+	"see_no_evil":                  "🙈",
+	"wave":                         "👋",
+	"ok_hand":                      "👌",
+	"v":                            "✌️",
+	"crossed_fingers":              "🤞",
+	"metal":                        "🤘",
+	"point_up":                     "☝️",
+	"+1":                           "👍",
+	"-1":                           "👎",
+	"fist":                         "✊",
+	"clap":                         "👏",
+	"raised_hands":                 "🙌",
+	"pray":                         "🙏",
+	"muscle":                       "💪",
+	"brain":                        "🧠",
+	"eyes":                         "👀",
+	"baby":                         "👶",
+	"man":                          "👨",
+	"woman":                        "👩",
+	"older_adult":                  "🧓",
+	"technologist":                 "🧑‍💻",
+	"man_technologist":             "👨‍💻",
+	"woman_technologist":           "👩‍💻",
+	"scientist":                    "🧑‍🔬",
+	"artist":                       "🧑‍🎨",
+	"astronaut":                    "🧑‍🚀",
+	"firefighter":                  "🧑‍🚒",
+	"detective":                    "🕵️",
+	"ninja":                        "🥷",
+	"superhero":                    "🦸",
+	"mage":                         "🧙",
+	"zombie":                       "🧟",
+	"runner":                       "🏃",
+	"dancer":                       "💃",
+	"surfer":                       "🏄",
+	"family":                       "👪",
+	// Animals and nature
+	"dog":              "🐶",
+	"cat":              "🐱",
+	"mouse":            "🐭",
+	"rabbit":           "🐰",
+	"fox_face":         "🦊",
+	"bear":             "🐻",
+	"panda_face":       "🐼",
+	"koala":            "🐨",
+	"tiger":            "🐯",
+	"lion":             "🦁",
+	"cow":              "🐮",
+	"pig":              "🐷",
+	"frog":             "🐸",
+	"monkey_face":      "🐵",
+	"chicken":          "🐔",
+	"penguin":          "🐧",
+	"bird":             "🐦",
+	"eagle":            "🦅",
+	"owl":              "🦉",
+	"unicorn":          "🦄",
+	"bee":              "🐝",
+	"butterfly":        "🦋",
+	"snail":            "🐌",
+	"turtle":           "🐢",
+	"snake":            "🐍",
+	"dragon":           "🐉",
+	"t-rex":            "🦖",
+	"octopus":          "🐙",
+	"whale":            "🐳",
+	"dolphin":          "🐬",
+	"fish":             "🐟",
+	"shark":            "🦈",
+	"crab":             "🦀",
+	"sloth":            "🦥",
+	"cactus":           "🌵",
+	"evergreen_tree":   "🌲",
+	"palm_tree":        "🌴",
+	"four_leaf_clover": "🍀",
+	"maple_leaf":       "🍁",
+	"mushroom":         "🍄",
+	"rose":             "🌹",
+	"sunflower":        "🌻",
+	"cherry_blossom":   "🌸",
+	"sun_with_face":    "🌞",
+	"full_moon":        "🌕",
+	"crescent_moon":    "🌙",
+	"star":             "⭐",
+	"star2":            "🌟",
+	"sparkles":         "✨",
+	"zap":              "⚡",
+	"fire":             "🔥",
+	"rainbow":          "🌈",
+	"sunny":            "☀️",
+	"cloud":            "☁️",
+	"umbrella":         "☔",
+	"snowflake":        "❄️",
+	"snowman":          "⛄",
+	"ocean":            "🌊",
+	"earth_africa":     "🌍",
+	"earth_americas":   "🌎",
+	"earth_asia":       "🌏",
+	// Food and drink
+	"apple":          "🍎",
+	"banana":         "🍌",
+	"grapes":         "🍇",
+	"watermelon":     "🍉",
+	"strawberry":     "🍓",
+	"peach":          "🍑",
+	"cherries":       "🍒",
+	"avocado":        "🥑",
+	"hot_pepper":     "🌶️",
+	"carrot":         "🥕",
+	"bread":          "🍞",
+	"cheese":         "🧀",
+	"hamburger":      "🍔",
+	"fries":          "🍟",
+	"pizza":          "🍕",
+	"taco":           "🌮",
+	"sushi":          "🍣",
+	"ramen":          "🍜",
+	"doughnut":       "🍩",
+	"cookie":         "🍪",
+	"birthday":       "🎂",
+	"cake":           "🍰",
+	"chocolate_bar":  "🍫",
+	"popcorn":        "🍿",
+	"coffee":         "☕",
+	"tea":            "🍵",
+	"beer":           "🍺",
+	"wine_glass":     "🍷",
+	"tropical_drink": "🍹",
+	// Activities
+	"soccer":           "⚽",
+	"basketball":       "🏀",
+	"football":         "🏈",
+	"baseball":         "⚾",
+	"tennis":           "🎾",
+	"volleyball":       "🏐",
+	"ping_pong":        "🏓",
+	"golf":             "⛳",
+	"ski":              "🎿",
+	"trophy":           "🏆",
+	"medal_sports":     "🏅",
+	"dart":             "🎯",
+	"video_game":       "🎮",
+	"game_die":         "🎲",
+	"jigsaw":           "🧩",
+	"chess_pawn":       "♟️",
+	"art":              "🎨",
+	"performing_arts":  "🎭",
+	"microphone":       "🎤",
+	"headphones":       "🎧",
+	"musical_note":     "🎵",
+	"notes":            "🎶",
+	"guitar":           "🎸",
+	"musical_keyboard": "🎹",
+	"trumpet":          "🎺",
+	"violin":           "🎻",
+	"drum":             "🥁",
+	"clapper":          "🎬",
+	"tada":             "🎉",
+	"balloon":          "🎈",
+	"gift":             "🎁",
+	// Travel and places
+	"rocket":            "🚀",
+	"airplane":          "✈️",
+	"helicopter":        "🚁",
+	"sailboat":          "⛵",
+	"ship":              "🚢",
+	"car":               "🚗",
+	"taxi":              "🚕",
+	"bus":               "🚌",
+	"bike":              "🚲",
+	"train":             "🚋",
+	"motorcycle":        "🏍️",
+	"flying_saucer":     "🛸",
+	"house":             "🏠",
+	"office":            "🏢",
+	"hospital":          "🏥",
+	"school":            "🏫",
+	"european_castle":   "🏰",
+	"statue_of_liberty": "🗽",
+	"mount_fuji":        "🗻",
+	"mountain":          "⛰️",
+	"volcano":           "🌋",
+	"desert_island":     "🏝️",
+	"camping":           "🏕️",
+	"tent":              "⛺",
+	"world_map":         "🗺️",
+	"compass":           "🧭",
+	// Objects
+	"watch":                    "⌚",
+	"iphone":                   "📱",
+	"computer":                 "💻",
+	"keyboard":                 "⌨️",
+	"desktop_computer":         "🖥️",
+	"floppy_disk":              "💾",
+	"cd":                       "💿",
+	"camera":                   "📷",
+	"movie_camera":             "🎥",
+	"tv":                       "📺",
+	"radio":                    "📻",
+	"hourglass":                "⌛",
+	"alarm_clock":              "⏰",
+	"bulb":                     "💡",
+	"flashlight":               "🔦",
+	"moneybag":                 "💰",
+	"gem":                      "💎",
+	"wrench":                   "🔧",
+	"hammer":                   "🔨",
+	"hammer_and_wrench":        "🛠️",
+	"gear":                     "⚙️",
+	"magnet":                   "🧲",
+	"microscope":               "🔬",
+	"telescope":                "🔭",
+	"test_tube":                "🧪",
+	"dna":                      "🧬",
+	"pill":                     "💊",
+	"abacus":                   "🧮",
+	"key":                      "🔑",
+	"lock":                     "🔒",
+	"shield":                   "🛡️",
+	"bell":                     "🔔",
+	"books":                    "📚",
+	"book":                     "📖",
+	"memo":                     "📝",
+	"pencil2":                  "✏️",
+	"paperclip":                "📎",
+	"scissors":                 "✂️",
+	"package":                  "📦",
+	"email":                    "📧",
+	"mailbox":                  "📫",
+	"calendar":                 "📆",
+	"chart_with_upwards_trend": "📈",
+	"pushpin":                  "📌",
+	"crown":                    "👑",
+	"eyeglasses":               "👓",
+	"tophat":                   "🎩",
+	"mortar_board":             "🎓",
+	"lipstick":                 "💄",
+	"ring":                     "💍",
+	"coffin":                   "⚰️",
+	"crystal_ball":             "🔮",
+	"teddy_bear":               "🧸",
+	// Symbols
+	"heart":                   "❤️",
+	"orange_heart":            "🧡",
+	"yellow_heart":            "💛",
+	"green_heart":             "💚",
+	"blue_heart":              "💙",
+	"purple_heart":            "💜",
+	"black_heart":             "🖤",
+	"broken_heart":            "💔",
+	"sparkling_heart":         "💖",
+	"100":                     "💯",
+	"boom":                    "💥",
+	"dizzy":                   "💫",
+	"speech_balloon":          "💬",
+	"zzz":                     "💤",
+	"peace_symbol":            "☮️",
+	"yin_yang":                "☯️",
+	"atom_symbol":             "⚛️",
+	"recycle":                 "♻️",
+	"infinity":                "♾️",
+	"white_check_mark":        "✅",
+	"x":                       "❌",
+	"question":                "❓",
+	"exclamation":             "❗",
+	"warning":                 "⚠️",
+	"no_entry":                "⛔",
+	"copyright":               "©️",
+	"registered":              "®️",
+	"tm":                      "™️",
+	"one":                     "1️⃣",
+	"hash":                    "#️⃣",
+	"checkered_flag":          "🏁",
+	"triangular_flag_on_post": "🚩",
+	"rainbow_flag":            "🏳️‍🌈",
+	"pirate_flag":             "🏴‍☠️",
+}
+
+// names maps each emoji in shortcodes to its name, the alphabetically first
+// when several names share an emoji
+var names = func() map[string]string {
+	names := make(map[string]string, len(shortcodes))
+	for name, emoji := range shortcodes {
+		if existing, ok := names[emoji]; !ok || name < existing {
+			names[emoji] = name
+		}
+	}
+	return names
+}()
+
+// shortcodeName returns the name in s if it has the :name: form
+func shortcodeName(s string) (string, bool) {
+	if len(s) < 3 || !strings.HasPrefix(s, ":") || !strings.HasSuffix(s, ":") {
+		return "", false
+	}
+	name := s[1 : len(s)-1]
+	return name, !strings.ContainsAny(name, ": ")
+}
+
+// ToShortcode returns the :name: shortcode of an emoji in normalized form,
+// or the emoji itself when it has no shortcode
+func ToShortcode(emoji string) string {
+	if name, ok := names[emoji]; ok {
+		return ":" + name + ":"
+	}
+	return emoji
+}
+
+// Lookup returns the emoji with the given shortcode name, without colons
+func Lookup(name string) (string, bool) {
+	emoji, ok := shortcodes[name]
+	return emoji, ok
+}
+
+// Shortcodes returns every known shortcode, ordered by name
+func Shortcodes() []Shortcode {
+	list := make([]Shortcode, 0, len(shortcodes))
+	for _, name := range slices.Sorted(maps.Keys(shortcodes)) {
+		list = append(list, Shortcode{Name: name, Emoji: shortcodes[name]})
+	}
+	return list
+}
@@ -0,0 +1,54 @@
+package envelope
+
+import (
+	"encoding/xml"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/requestid"
+)
+
+// Envelope wraps every v2 response body. Data holds the resource on success
+// and is null on failure, when Errors explains what went wrong.
+type Envelope struct {
+	XMLName xml.Name `json:"-" yaml:"-" xml:"response"`
+	Data    any      `json:"data" xml:"data,omitempty" yaml:"data"`
+	Meta    Meta     `json:"meta" xml:"meta" yaml:"meta"`
+	Errors  []Error  `json:"errors,omitempty" xml:"error,omitempty" yaml:"errors,omitempty"`
+}
+
+// Meta describes the response rather than the resource
+type Meta struct {
+	RequestID  string      `json:"requestId,omitempty" xml:"requestId,omitempty" yaml:"requestId,omitempty"`
+	Pagination *Pagination `json:"pagination,omitempty" xml:"pagination,omitempty" yaml:"pagination,omitempty"`
+}
+
+// Pagination locates a page of a collection. Pages requested by number
+// carry Page, PerPage and TotalPages; pages requested by cursor carry Limit
+// and, unless they are the last, NextCursor. Total is nil when the backend
+// cannot count the collection cheaply.
+type Pagination struct {
+	Page       int    `json:"page,omitempty" xml:"page,omitempty" yaml:"page,omitempty"`
+	PerPage    int    `json:"perPage,omitempty" xml:"perPage,omitempty" yaml:"perPage,omitempty"`
+	Limit      int    `json:"limit,omitempty" xml:"limit,omitempty" yaml:"limit,omitempty"`
+	Total      *int   `json:"total,omitempty" xml:"total,omitempty" yaml:"total,omitempty"`
+	TotalPages int    `json:"totalPages,omitempty" xml:"totalPages,omitempty" yaml:"totalPages,omitempty"`
+	NextCursor string `json:"nextCursor,omitempty" xml:"nextCursor,omitempty" yaml:"nextCursor,omitempty"`
+}
+
+// Error is one problem with a request, using the same codes as v1 errors
+type Error struct {
+	Code    string `json:"code" xml:"code" yaml:"code"`
+	Message string `json:"message" xml:"message" yaml:"message"`
+	Details any    `json:"details,omitempty" xml:"details,omitempty" yaml:"details,omitempty"`
+}
+
+// Success wraps data, with pagination metadata for collections. Responses
+// shared through the response cache leave out the request ID.
+func Success(c *gin.Context, data any, pagination *Pagination) Envelope {
+	return Envelope{Data: data, Meta: Meta{RequestID: requestid.ForBody(c), Pagination: pagination}}
+}
+
+// Failure wraps the errors that made a request fail
+func Failure(c *gin.Context, errs ...Error) Envelope {
+	return Envelope{Errors: errs, Meta: Meta{RequestID: requestid.Get(c)}}
+}
@@ -0,0 +1,184 @@
+// Package errortracking reports unexpected errors and panics to a
+// Sentry-compatible error tracker with sentry-go, along with the request they
+// happened in, the caller and tenant it was made by, and the release and
+// environment of the server. Errors are sent in the background, so reporting
+// them never holds up a request.
+package errortracking
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	sentrygin "github.com/getsentry/sentry-go/gin"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"userprofile-api/auth"
+	"userprofile-api/config"
+	"userprofile-api/requestid"
+	"userprofile-api/tenant"
+)
+
+// queueSize is the number of events waiting to be sent; further events are
+// dropped until the tracker catches up
+const queueSize = 100
+
+// forwardedHeaders are the request headers sent along with events; the
+// others, such as those carrying credentials, are left out
+var forwardedHeaders = []string{"Accept", "Content-Type", "User-Agent"}
+
+// Tracker sends the errors it captures to the tracker named by a DSN
+type Tracker struct {
+	client *sentry.Client
+	logger *slog.Logger
+	closed atomic.Bool
+}
+
+// New creates a tracker sending to the configured DSN
+func New(cfg config.ErrorTrackingConfig, logger *slog.Logger) (*Tracker, error) {
+	transport := sentry.NewHTTPTransport()
+	transport.BufferSize = queueSize
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:              cfg.DSN,
+		Release:          cfg.Release,
+		Environment:      cfg.Environment,
+		AttachStacktrace: true,
+		Transport:        transport,
+		BeforeSend:       keepForwardedHeaders,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Tracker{client: client, logger: logger}, nil
+}
+
+// keepForwardedHeaders drops the request headers of an event but
+// forwardedHeaders
+func keepForwardedHeaders(e *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+	if e.Request == nil {
+		return e
+	}
+	headers := map[string]string{}
+	for _, name := range forwardedHeaders {
+		if value, ok := e.Request.Headers[name]; ok {
+			headers[name] = value
+		}
+	}
+	e.Request.Headers = headers
+	e.Request.Cookies = ""
+	e.Request.Env = nil
+	return e
+}
+
+// scope records that the error of a request was captured, so it is not
+// captured twice. The middleware puts it in the request's context.
+type scope struct {
+	clientIP string
+
+	mu       sync.Mutex
+	captured bool
+}
+
+type scopeKey struct{}
+
+func scopeFrom(ctx context.Context) *scope {
+	s, _ := ctx.Value(scopeKey{}).(*scope)
+	return s
+}
+
+// Middleware attaches the request to the errors captured while handling it,
+// through the Sentry gin integration, which also reports the panics of the
+// handlers after it at the fatal level before passing them on. It captures
+// the error of a request answered with a server error unless one was
+// captured already, such as by the service layer. Errors answered with 503
+// Service Unavailable, such as while the storage circuit breaker is open,
+// carry no error and are not captured.
+func (t *Tracker) Middleware() gin.HandlerFunc {
+	integration := sentrygin.New(sentrygin.Options{Repanic: true})
+	return func(c *gin.Context) {
+		hub := sentry.NewHub(t.client, sentry.NewScope())
+		hub.Scope().SetTag("route", c.FullPath())
+		if id := requestid.Get(c); id != "" {
+			hub.Scope().SetTag("request_id", id)
+		}
+		s := &scope{clientIP: c.ClientIP()}
+		ctx := context.WithValue(c.Request.Context(), scopeKey{}, s)
+		c.Request = c.Request.WithContext(sentry.SetHubOnContext(ctx, hub))
+
+		// The integration calls the next handlers
+		integration(c)
+
+		if c.Writer.Status() < http.StatusInternalServerError || len(c.Errors) == 0 {
+			return
+		}
+		s.mu.Lock()
+		captured := s.captured
+		s.mu.Unlock()
+		if !captured {
+			t.Capture(c.Request.Context(), c.Errors.Last().Err)
+		}
+	}
+}
+
+// Capture reports err with the request, caller, tenant and trace ctx carries
+func (t *Tracker) Capture(ctx context.Context, err error) {
+	if t.closed.Load() {
+		return
+	}
+	s := scopeFrom(ctx)
+	if s != nil {
+		s.mu.Lock()
+		s.captured = true
+		s.mu.Unlock()
+	}
+
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.NewHub(t.client, sentry.NewScope())
+	}
+	hub.WithScope(func(scope *sentry.Scope) {
+		var user sentry.User
+		if s != nil {
+			user.IPAddress = s.clientIP
+		}
+		if principal, ok := auth.FromContext(ctx); ok {
+			user.ID = principal.Name
+		}
+		scope.SetUser(user)
+		if id := tenant.FromContext(ctx); id != "" {
+			scope.SetTag("tenant", id)
+		}
+		// Errors of traced requests are linked to their trace
+		if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+			scope.SetContext("trace", sentry.Context{
+				"trace_id": span.TraceID().String(),
+				"span_id":  span.SpanID().String(),
+			})
+			scope.SetPropagationContext(sentry.PropagationContext{
+				TraceID: sentry.TraceID(span.TraceID()),
+				SpanID:  sentry.SpanID(span.SpanID()),
+			})
+		}
+		hub.CaptureException(err)
+	})
+}
+
+// Close stops capturing errors and waits for the queued ones to be sent
+// until ctx is done
+func (t *Tracker) Close(ctx context.Context) error {
+	t.closed.Store(true)
+	timeout := 5 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	if !t.client.Flush(timeout) {
+		t.logger.Warn("Errors were left unsent to the error tracker on shutdown")
+		return errors.New("error tracker flush timed out")
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"userprofile-api/models"
+)
+
+// Types of user change events
+const (
+	UserCreated  = "user.created"
+	UserUpdated  = "user.updated"
+	UserDeleted  = "user.deleted"
+	UserRestored = "user.restored"
+)
+
+// Types lists every event type, e.g. for validating subscriptions
+var Types = []string{UserCreated, UserUpdated, UserDeleted, UserRestored}
+
+// Event describes a change to a user profile
+type Event struct {
+	ID         string             `json:"id"`
+	Type       string             `json:"type"`
+	OccurredAt time.Time          `json:"occurredAt"`
+	User       models.UserProfile `json:"data"`
+	// Tenant is the tenant the user belongs to, empty for the default storage
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// New creates an event of the given type for user
+func New(eventType string, user models.UserProfile) Event {
+	return Event{
+		ID:         uuid.NewString(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		User:       user,
+	}
+}
+
+// Handler receives published events. Handlers run on the publishing
+// goroutine, so they must hand slow work off rather than block.
+type Handler func(Event)
+
+// Bus fans events out to every subscribed handler
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+// NewBus creates a bus with no subscribers
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers a handler for all future events
+func (b *Bus) Subscribe(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, h)
+}
+
+// Publish delivers the event to every subscriber
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, h := range b.handlers {
+		h(e)
+	}
+}
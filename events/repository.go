@@ -0,0 +1,156 @@
+package events
+
+import (
+	"context"
+
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+// publishingRepository publishes an event on the bus after every successful
+// change to a user
+type publishingRepository struct {
+	repository.UserRepository
+	bus    *Bus
+	tenant string
+}
+
+// Repository wraps a repository so that writes publish user change events
+func Repository(next repository.UserRepository, bus *Bus) repository.UserRepository {
+	return &publishingRepository{UserRepository: next, bus: bus}
+}
+
+// TenantRepository wraps a tenant's repository so that writes publish user
+// change events naming the tenant
+func TenantRepository(next repository.UserRepository, bus *Bus, tenant string) repository.UserRepository {
+	return &publishingRepository{UserRepository: next, bus: bus, tenant: tenant}
+}
+
+// pendingKey is the context key of the events of the changes made within a
+// Transaction of a repository, held back until it commits
+type pendingKey struct {
+	repo *publishingRepository
+}
+
+// pendingEvents collects the events held back by a Transaction
+type pendingEvents struct {
+	events []Event
+}
+
+// publish publishes the event of a change, or holds it back until the
+// transaction ctx carries commits
+func (r *publishingRepository) publish(ctx context.Context, eventType string, user models.UserProfile) {
+	e := New(eventType, user)
+	e.Tenant = r.tenant
+	if pending, ok := ctx.Value(pendingKey{r}).(*pendingEvents); ok {
+		pending.events = append(pending.events, e)
+		return
+	}
+	r.bus.Publish(e)
+}
+
+func (r *publishingRepository) Create(ctx context.Context, user models.UserProfile) (models.UserProfile, error) {
+	created, err := r.UserRepository.Create(ctx, user)
+	if err == nil {
+		r.publish(ctx, UserCreated, created)
+	}
+	return created, err
+}
+
+func (r *publishingRepository) Update(ctx context.Context, id string, user models.UserProfile) (models.UserProfile, error) {
+	updated, err := r.UserRepository.Update(ctx, id, user)
+	if err == nil {
+		r.publish(ctx, UserUpdated, updated)
+	}
+	return updated, err
+}
+
+func (r *publishingRepository) SetAvatarURL(ctx context.Context, id string, avatarURL string) (models.UserProfile, error) {
+	updated, err := r.UserRepository.SetAvatarURL(ctx, id, avatarURL)
+	if err == nil {
+		r.publish(ctx, UserUpdated, updated)
+	}
+	return updated, err
+}
+
+// Delete publishes the profile as it was before deletion, so subscribers
+// learn more than the ID
+func (r *publishingRepository) Delete(ctx context.Context, id string) error {
+	user, err := r.UserRepository.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.UserRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	r.publish(ctx, UserDeleted, user)
+	return nil
+}
+
+func (r *publishingRepository) Restore(ctx context.Context, id string) (models.UserProfile, error) {
+	restored, err := r.UserRepository.Restore(ctx, id)
+	if err == nil {
+		r.publish(ctx, UserRestored, restored)
+	}
+	return restored, err
+}
+
+// Stream reads through the wrapped repository, which may stream its users
+func (r *publishingRepository) Stream(ctx context.Context, opts repository.ListOptions, yield func(user models.UserProfile) error) error {
+	return repository.Stream(ctx, r.UserRepository, opts, yield)
+}
+
+// Transaction runs fn in a transaction of the wrapped repository and
+// publishes the events of the changes fn makes once it commits, so that
+// subscribers never learn of changes that were rolled back. No events are
+// published when fn fails, which drops those of the changes made before the
+// failure by repositories that cannot roll them back.
+func (r *publishingRepository) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(pendingKey{r}).(*pendingEvents); ok {
+		// Joining a transaction, whose events are published when it commits
+		return repository.Transaction(ctx, r.UserRepository, fn)
+	}
+	pending := &pendingEvents{}
+	err := repository.Transaction(ctx, r.UserRepository, func(ctx context.Context) error {
+		return fn(context.WithValue(ctx, pendingKey{r}, pending))
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range pending.events {
+		r.bus.Publish(e)
+	}
+	return nil
+}
+
+// RecordAudit records through the wrapped repository; audit records are not
+// published
+func (r *publishingRepository) RecordAudit(ctx context.Context, record repository.AuditRecord) error {
+	return repository.RecordAudit(ctx, r.UserRepository, record)
+}
+
+// MoveAudit moves the trail through the wrapped repository
+func (r *publishingRepository) MoveAudit(ctx context.Context, fromID, toID string) error {
+	return repository.MoveAudit(ctx, r.UserRepository, fromID, toID)
+}
+
+// Trail reads through the wrapped repository
+func (r *publishingRepository) Trail(ctx context.Context, userID string) ([]repository.AuditRecord, error) {
+	return repository.Trail(ctx, r.UserRepository, userID)
+}
+
+// changeTypes maps the changes recorded in outboxes to event types
+var changeTypes = map[repository.Change]string{
+	repository.ChangeCreated:  UserCreated,
+	repository.ChangeUpdated:  UserUpdated,
+	repository.ChangeDeleted:  UserDeleted,
+	repository.ChangeRestored: UserRestored,
+}
+
+// FromChange creates the event describing a change recorded in an outbox,
+// naming the tenant the user belongs to, if any
+func FromChange(change repository.Change, user models.UserProfile, tenant string) Event {
+	e := New(changeTypes[change], user)
+	e.Tenant = tenant
+	return e
+}
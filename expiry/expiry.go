@@ -0,0 +1,133 @@
+// Package expiry soft-deletes users once their expiry time has passed. A
+// janitor sweeps the default storage and every tenant's in scheduled
+// background jobs, logging and counting the users it expired.
+package expiry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"userprofile-api/auth"
+	"userprofile-api/models"
+	"userprofile-api/service"
+	"userprofile-api/tenant"
+)
+
+// Actor names the janitor in the audit trail of the users it expires
+const Actor = "expiry"
+
+// JobKind is the kind of the background jobs sweeping for expired users
+const JobKind = "expiry.sweep"
+
+// sweepTimeout bounds a sweep of every tenant's users
+const sweepTimeout = 5 * time.Minute
+
+// Janitor soft-deletes expired users through the user service, so each is
+// audited and published like any other deletion
+type Janitor struct {
+	users    *service.UserService
+	registry *tenant.Registry
+	tenants  *tenant.Repositories
+	logger   *slog.Logger
+
+	expired prometheus.Counter
+	sweeps  *prometheus.CounterVec
+	last    prometheus.Gauge
+}
+
+// New creates a janitor expiring the users of the default storage through
+// users and, when tenancy is enabled, those of the tenants registry lists,
+// whose repositories are kept by tenants. registry and tenants are nil
+// without tenancy.
+func New(users *service.UserService, registry *tenant.Registry, tenants *tenant.Repositories, logger *slog.Logger) *Janitor {
+	return &Janitor{
+		users:    users,
+		registry: registry,
+		tenants:  tenants,
+		logger:   logger,
+		expired: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "userprofile",
+			Name:      "users_expired_total",
+			Help:      "Number of users soft-deleted for reaching their expiry time.",
+		}),
+		sweeps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "userprofile",
+			Name:      "expiry_sweeps_total",
+			Help:      "Number of sweeps for expired users, by result (ok or error).",
+		}, []string{"result"}),
+		last: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "userprofile",
+			Name:      "expiry_last_sweep_users",
+			Help:      "Number of users soft-deleted by the last sweep for expired users.",
+		}),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (j *Janitor) Describe(ch chan<- *prometheus.Desc) {
+	j.expired.Describe(ch)
+	j.sweeps.Describe(ch)
+	j.last.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (j *Janitor) Collect(ch chan<- prometheus.Metric) {
+	j.expired.Collect(ch)
+	j.sweeps.Collect(ch)
+	j.last.Collect(ch)
+}
+
+// HandleJob sweeps for expired users. It is the handler of JobKind jobs; a
+// sweep failing with some storage is logged, and not retried until the next
+// one.
+func (j *Janitor) HandleJob(ctx context.Context, _ models.Job) error {
+	ctx, cancel := context.WithTimeout(ctx, sweepTimeout)
+	defer cancel()
+	j.Sweep(ctx)
+	return nil
+}
+
+// Sweep soft-deletes the users that have expired by now, in the default
+// storage and then in every tenant's, deactivated ones included, and returns
+// how many it deleted. A failure with one storage is logged, and the others
+// are still swept.
+func (j *Janitor) Sweep(ctx context.Context) int {
+	ctx = auth.NewContext(ctx, auth.Principal{Name: Actor})
+	start := time.Now()
+
+	expired, err := j.users.Expire(ctx, start)
+	errs := []error{err}
+	if j.registry != nil && j.tenants != nil {
+		for _, t := range j.registry.List() {
+			repo, err := j.tenants.Get(t.ID)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			n, err := j.users.ForTenant(t.ID, repo).Expire(ctx, start)
+			expired += n
+			if err != nil {
+				errs = append(errs, fmt.Errorf("tenant %s: %w", t.ID, err))
+			}
+		}
+	}
+
+	j.expired.Add(float64(expired))
+	j.last.Set(float64(expired))
+	if err := errors.Join(errs...); err != nil {
+		j.sweeps.WithLabelValues("error").Inc()
+		j.logger.Error("Sweep for expired users failed", "users", expired, "error", err)
+		return expired
+	}
+	j.sweeps.WithLabelValues("ok").Inc()
+	level := slog.LevelDebug
+	if expired > 0 {
+		level = slog.LevelInfo
+	}
+	j.logger.Log(ctx, level, "Expired users", "users", expired, "duration", time.Since(start).String())
+	return expired
+}
@@ -0,0 +1,148 @@
+// Package fields implements sparse fieldsets: the fields query parameter
+// lists the attributes a client wants, and responses leave out the rest.
+package fields
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+)
+
+// contextKey is the gin context key holding the request's selection
+const contextKey = "fields"
+
+// Selection lists the attributes, by their JSON names, a response should
+// include. A nil Selection includes every attribute.
+type Selection []string
+
+// Middleware parses the comma-separated fields query parameter, rejecting
+// names that are not among allowed with 400
+func Middleware(allowed []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.GetQuery("fields")
+		if !ok {
+			c.Next()
+			return
+		}
+
+		var selection Selection
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if !slices.Contains(allowed, name) {
+				apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter,
+					fmt.Sprintf("unknown field %q", name), gin.H{"parameter": "fields", "allowed": allowed})
+				return
+			}
+			if !slices.Contains(selection, name) {
+				selection = append(selection, name)
+			}
+		}
+		if len(selection) == 0 {
+			apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidQueryParameter,
+				"fields must name at least one field", gin.H{"parameter": "fields", "allowed": allowed})
+			return
+		}
+		c.Set(contextKey, selection)
+		c.Next()
+	}
+}
+
+// From returns the request's selection, or nil when the client did not ask
+// for specific fields
+func From(c *gin.Context) Selection {
+	selection, _ := c.Get(contextKey)
+	s, _ := selection.(Selection)
+	return s
+}
+
+// Names returns the JSON names of the attributes of v, a struct, including
+// those of embedded structs
+func Names(v any) []string {
+	var names []string
+	walk(reflect.ValueOf(v), func(field reflect.StructField, _ reflect.Value) {
+		if name := jsonName(field); name != "" {
+			names = append(names, name)
+		}
+	})
+	return names
+}
+
+// Project returns a copy of v, a struct or pointer to one, holding only the
+// selected attributes. The copy keeps the fields' tags and the XML element
+// name, so it serializes in every format like v minus the other attributes.
+// Values that are not structs, and every value when the selection is nil,
+// are returned unchanged.
+func (s Selection) Project(v any) any {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+	if s == nil || value.Kind() != reflect.Struct {
+		return v
+	}
+
+	var kept []reflect.StructField
+	var values []reflect.Value
+	hasXMLName := false
+	walk(value, func(field reflect.StructField, fieldValue reflect.Value) {
+		switch {
+		case field.Name == "XMLName":
+			// Embedded structs may name an element too; the outermost wins,
+			// as it does when encoding/xml marshals the original
+			if hasXMLName {
+				return
+			}
+			hasXMLName = true
+		case !slices.Contains(s, jsonName(field)):
+			return
+		}
+		field.Index, field.Offset, field.Anonymous = nil, 0, false
+		kept = append(kept, field)
+		values = append(values, fieldValue)
+	})
+
+	projected := reflect.New(reflect.StructOf(kept)).Elem()
+	for i, fieldValue := range values {
+		projected.Field(i).Set(fieldValue)
+	}
+	return projected.Interface()
+}
+
+// walk calls fn with each exported field of a struct, descending into
+// embedded structs without a JSON name of their own
+func walk(value reflect.Value, fn func(reflect.StructField, reflect.Value)) {
+	t := value.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			walk(value.Field(i), fn)
+			continue
+		}
+		fn(field, value.Field(i))
+	}
+}
+
+// jsonName returns the name a field is serialized under in JSON, or "" if
+// it is not serialized
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	default:
+		return name
+	}
+}
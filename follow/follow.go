@@ -0,0 +1,315 @@
+// Package follow keeps the relationships of users following each other, a
+// minimal social graph of the users of each tenant. Users who follow each
+// other are friends.
+package follow
+
+import (
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSelf is returned when a user would follow themselves, the one
+	// cycle the graph refuses
+	ErrSelf = errors.New("users cannot follow themselves")
+	// ErrConflict is returned when the user already follows the other
+	ErrConflict = errors.New("already following")
+	// ErrNotFound is returned when the user does not follow the other
+	ErrNotFound = errors.New("not following")
+)
+
+// Follow is a user following another
+type Follow struct {
+	XMLName    xml.Name  `json:"-" yaml:"-" xml:"follow"`
+	FollowerID string    `json:"followerId" xml:"followerId" yaml:"followerId"`
+	FolloweeID string    `json:"followeeId" xml:"followeeId" yaml:"followeeId"`
+	CreatedAt  time.Time `json:"createdAt" xml:"createdAt" yaml:"createdAt"`
+	// Mutual is whether the followee follows the follower back, which makes
+	// them friends
+	Mutual bool `json:"mutual" xml:"mutual" yaml:"mutual"`
+}
+
+// ListOptions selects a page of a user's relationships, newest first
+type ListOptions struct {
+	Offset int
+	Limit  int
+	// Mutual keeps only the relationships with friends
+	Mutual bool
+}
+
+// record is a relationship as saved to the store's file
+type record struct {
+	Tenant     string    `json:"tenant,omitempty"`
+	FollowerID string    `json:"followerId"`
+	FolloweeID string    `json:"followeeId"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// edges maps user IDs to the IDs they are related to, and since when
+type edges map[string]map[string]time.Time
+
+func (e edges) add(from, to string, at time.Time) {
+	if e[from] == nil {
+		e[from] = map[string]time.Time{}
+	}
+	e[from][to] = at
+}
+
+func (e edges) remove(from, to string) {
+	delete(e[from], to)
+	if len(e[from]) == 0 {
+		delete(e, from)
+	}
+}
+
+// graph holds the relationships of a tenant's users both ways, so that
+// followers and followed users are found alike
+type graph struct {
+	following edges
+	followers edges
+}
+
+// Store holds the relationships in memory and, when it has a file, saves them
+// to it after every change, so they survive restarts. The users of each
+// tenant, named by an empty string for the default storage, have a graph of
+// their own.
+type Store struct {
+	path string
+
+	mu     sync.RWMutex
+	graphs map[string]*graph
+}
+
+// OpenStore loads the relationships saved in the JSON file at path, starting
+// empty if it does not exist yet. With an empty path the relationships are
+// only kept in memory.
+func OpenStore(path string) (*Store, error) {
+	s := &Store{path: path, graphs: map[string]*graph{}}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	for _, r := range records {
+		s.graph(r.Tenant).add(r.FollowerID, r.FolloweeID, r.CreatedAt)
+	}
+	return s, nil
+}
+
+// Follow makes followerID follow followeeID among the users of tenant
+func (s *Store) Follow(tenant, followerID, followeeID string) (Follow, error) {
+	if followerID == followeeID {
+		return Follow{}, ErrSelf
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.graph(tenant)
+	if _, ok := g.following[followerID][followeeID]; ok {
+		return Follow{}, ErrConflict
+	}
+	now := time.Now().UTC()
+	g.add(followerID, followeeID, now)
+	if err := s.save(); err != nil {
+		g.remove(followerID, followeeID)
+		return Follow{}, fmt.Errorf("save %s: %w", s.path, err)
+	}
+	_, mutual := g.following[followeeID][followerID]
+	return Follow{FollowerID: followerID, FolloweeID: followeeID, CreatedAt: now, Mutual: mutual}, nil
+}
+
+// Unfollow stops followerID following followeeID among the users of tenant
+func (s *Store) Unfollow(tenant, followerID, followeeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.graph(tenant)
+	since, ok := g.following[followerID][followeeID]
+	if !ok {
+		return ErrNotFound
+	}
+	g.remove(followerID, followeeID)
+	if err := s.save(); err != nil {
+		g.add(followerID, followeeID, since)
+		return fmt.Errorf("save %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// Move hands the relationships of fromID over to toID among the users of
+// tenant, once fromID was merged into toID. Relationships toID already has
+// keep their date, and those between the two users are dropped.
+func (s *Store) Move(tenant, fromID, toID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.graphs[tenant]
+	if !ok {
+		return nil
+	}
+
+	previous := g.clone()
+	for followeeID, since := range g.following[fromID] {
+		g.remove(fromID, followeeID)
+		if _, ok := g.following[toID][followeeID]; !ok && followeeID != toID {
+			g.add(toID, followeeID, since)
+		}
+	}
+	for followerID, since := range g.followers[fromID] {
+		g.remove(followerID, fromID)
+		if _, ok := g.following[followerID][toID]; !ok && followerID != toID {
+			g.add(followerID, toID, since)
+		}
+	}
+	if err := s.save(); err != nil {
+		s.graphs[tenant] = previous
+		return fmt.Errorf("save %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// Followers returns a page of the relationships of the users following
+// userID, and how many there are in all
+func (s *Store) Followers(tenant, userID string, opts ListOptions) ([]Follow, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	g, ok := s.graphs[tenant]
+	if !ok {
+		return []Follow{}, 0
+	}
+
+	var follows []Follow
+	for followerID, since := range g.followers[userID] {
+		_, mutual := g.following[userID][followerID]
+		follows = append(follows, Follow{FollowerID: followerID, FolloweeID: userID, CreatedAt: since, Mutual: mutual})
+	}
+	return page(follows, opts, func(f Follow) string { return f.FollowerID })
+}
+
+// Following returns a page of the relationships of userID with the users it
+// follows, and how many there are in all
+func (s *Store) Following(tenant, userID string, opts ListOptions) ([]Follow, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	g, ok := s.graphs[tenant]
+	if !ok {
+		return []Follow{}, 0
+	}
+
+	var follows []Follow
+	for followeeID, since := range g.following[userID] {
+		_, mutual := g.followers[userID][followeeID]
+		follows = append(follows, Follow{FollowerID: userID, FolloweeID: followeeID, CreatedAt: since, Mutual: mutual})
+	}
+	return page(follows, opts, func(f Follow) string { return f.FolloweeID })
+}
+
+// page filters and orders the relationships newest first, then by the ID of
+// the other user, and returns the page the options select with the total
+func page(follows []Follow, opts ListOptions, other func(Follow) string) ([]Follow, int) {
+	if opts.Mutual {
+		follows = slices.DeleteFunc(follows, func(f Follow) bool { return !f.Mutual })
+	}
+	slices.SortFunc(follows, func(a, b Follow) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), strings.Compare(other(a), other(b)))
+	})
+	total := len(follows)
+	start := min(opts.Offset, total)
+	end := total
+	if opts.Limit > 0 {
+		end = min(start+opts.Limit, total)
+	}
+	return append([]Follow{}, follows[start:end]...), total
+}
+
+// graph returns the graph of tenant, adding an empty one for new tenants.
+// The caller must hold mu for writing.
+func (s *Store) graph(tenant string) *graph {
+	g, ok := s.graphs[tenant]
+	if !ok {
+		g = &graph{following: edges{}, followers: edges{}}
+		s.graphs[tenant] = g
+	}
+	return g
+}
+
+// clone returns a copy of the graph sharing no memory with it
+func (g *graph) clone() *graph {
+	c := &graph{following: edges{}, followers: edges{}}
+	for followerID, followees := range g.following {
+		for followeeID, since := range followees {
+			c.add(followerID, followeeID, since)
+		}
+	}
+	return c
+}
+
+func (g *graph) add(followerID, followeeID string, at time.Time) {
+	g.following.add(followerID, followeeID, at)
+	g.followers.add(followeeID, followerID, at)
+}
+
+func (g *graph) remove(followerID, followeeID string) {
+	g.following.remove(followerID, followeeID)
+	g.followers.remove(followeeID, followerID)
+}
+
+// save writes the relationships, oldest first, to a temporary file next to
+// the store's file and renames it into place, so a crash never leaves a
+// partial file. The caller must hold mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	records := []record{}
+	for tenant, g := range s.graphs {
+		for followerID, followees := range g.following {
+			for followeeID, since := range followees {
+				records = append(records, record{Tenant: tenant, FollowerID: followerID, FolloweeID: followeeID, CreatedAt: since})
+			}
+		}
+	}
+	slices.SortFunc(records, func(a, b record) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.Tenant, b.Tenant),
+			strings.Compare(a.FollowerID, b.FollowerID), strings.Compare(a.FolloweeID, b.FolloweeID))
+	})
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,171 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"userprofile-api/auth"
+	"userprofile-api/config"
+	"userprofile-api/tracing"
+	"userprofile-api/userspb"
+)
+
+// methodRoles lists the role each user service RPC requires, matching the
+// equivalent REST routes. Methods not listed here, such as health checks and
+// reflection, need no credentials.
+var methodRoles = map[string]string{
+	userspb.UserService_ListUsers_FullMethodName:  config.RoleViewer,
+	userspb.UserService_GetUser_FullMethodName:    config.RoleViewer,
+	userspb.UserService_CreateUser_FullMethodName: config.RoleEditor,
+	userspb.UserService_UpdateUser_FullMethodName: config.RoleEditor,
+	userspb.UserService_DeleteUser_FullMethodName: config.RoleAdmin,
+}
+
+// authInterceptor authenticates callers with the same API keys and JWTs as
+// the REST API, read from the authorization and x-api-key metadata
+func authInterceptor(guard *auth.Guard) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		role, ok := methodRoles[info.FullMethod]
+		if !ok || !guard.Enabled() {
+			return handler(ctx, req)
+		}
+
+		principal, err := guard.Identify(credentialsRequest(ctx, role))
+		var scopeErr *auth.ScopeError
+		switch {
+		case errors.Is(err, auth.ErrNoCredentials):
+			return nil, status.Error(codes.Unauthenticated, "missing credentials")
+		case errors.As(err, &scopeErr):
+			return nil, status.Errorf(codes.PermissionDenied, "credentials do not grant the %s scope", scopeErr.Required)
+		case err != nil:
+			return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+		case !principal.HasRole(role):
+			return nil, status.Errorf(codes.PermissionDenied, "the %s role is required", role)
+		}
+		return handler(auth.NewContext(ctx, principal), req)
+	}
+}
+
+// credentialsRequest adapts the call's metadata to the HTTP request the
+// authenticators expect. Read-only RPCs are presented as GET requests so API
+// keys need the same scope as for the REST equivalent.
+func credentialsRequest(ctx context.Context, role string) *http.Request {
+	r := &http.Request{Method: http.MethodPost, Header: http.Header{}}
+	if role == config.RoleViewer {
+		r.Method = http.MethodGet
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, key := range []string{"Authorization", auth.APIKeyHeader} {
+		if values := md.Get(key); len(values) > 0 {
+			r.Header.Set(key, values[0])
+		}
+	}
+	return r
+}
+
+// loggingInterceptor logs one structured entry per call, like the HTTP
+// logging middleware. Server-side failures are logged at error level and
+// other failures at warn level.
+func loggingInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		attrs := []slog.Attr{
+			slog.String("method", info.FullMethod),
+			slog.String("code", code.String()),
+			slog.Duration("latency", time.Since(start)),
+		}
+		if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+			attrs = append(attrs, slog.String("traceId", span.TraceID().String()))
+		}
+		if err != nil {
+			attrs = append(attrs, slog.String("error", err.Error()))
+		}
+
+		level := slog.LevelInfo
+		switch code {
+		case codes.OK:
+		case codes.Internal, codes.Unknown, codes.Unavailable, codes.DataLoss:
+			level = slog.LevelError
+		default:
+			level = slog.LevelWarn
+		}
+
+		logger.LogAttrs(ctx, level, "rpc handled", attrs...)
+		return resp, err
+	}
+}
+
+// recoveryInterceptor turns a panicking handler into an Internal error
+// instead of crashing the process
+func recoveryInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.ErrorContext(ctx, "rpc panicked", "method", info.FullMethod, "panic", r, "stack", string(debug.Stack()))
+				err = status.Error(codes.Internal, "an internal error occurred")
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// tracingInterceptor starts a server span for each call, continuing the
+// trace propagated in the call's metadata
+func tracingInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+
+		ctx, span := tracing.Tracer().Start(ctx, info.FullMethod,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("rpc.system", "grpc")),
+		)
+		defer span.End()
+
+		resp, err := handler(ctx, req)
+		code := status.Code(err)
+		span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(code)))
+		if code == codes.Internal || code == codes.Unknown {
+			span.SetStatus(otelcodes.Error, err.Error())
+		}
+		return resp, err
+	}
+}
+
+// metadataCarrier lets the OpenTelemetry propagator read gRPC metadata
+type metadataCarrier metadata.MD
+
+func (m metadataCarrier) Get(key string) string {
+	if values := metadata.MD(m).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (m metadataCarrier) Set(key, value string) {
+	metadata.MD(m).Set(key, value)
+}
+
+func (m metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,32 @@
+package grpcapi
+
+import (
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"userprofile-api/auth"
+	"userprofile-api/service"
+	"userprofile-api/userspb"
+)
+
+// NewServer creates a gRPC server exposing the user service backed by users,
+// whose callers are authenticated by guard. The standard health and
+// reflection services are registered as well, so tools such as grpcurl and
+// grpc_health_probe work without the .proto file.
+func NewServer(users *service.UserService, guard *auth.Guard, logger *slog.Logger) *grpc.Server {
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		tracingInterceptor(),
+		loggingInterceptor(logger),
+		recoveryInterceptor(logger),
+		authInterceptor(guard),
+	))
+
+	userspb.RegisterUserServiceServer(server, NewUserService(users))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	reflection.Register(server)
+
+	return server
+}
@@ -0,0 +1,280 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"userprofile-api/models"
+	"userprofile-api/repository"
+	"userprofile-api/service"
+	"userprofile-api/tracing"
+	"userprofile-api/userspb"
+)
+
+// Page sizes match the REST API's page/per_page parameters
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// UserService implements the users.v1.UserService gRPC service on top of the
+// user service the REST API uses
+type UserService struct {
+	userspb.UnimplementedUserServiceServer
+	users *service.UserService
+}
+
+// NewUserService creates a gRPC service working on users through the given
+// service, tracing each repository call as a child span of the call's span
+func NewUserService(users *service.UserService) *UserService {
+	return &UserService{users: users.ForTenant("", tracing.Repository(users.Repository()))}
+}
+
+// ListUsers returns a page of active users matching the request's filters
+func (s *UserService) ListUsers(ctx context.Context, req *userspb.ListUsersRequest) (*userspb.ListUsersResponse, error) {
+	if req.GetPage() < 0 || req.GetPerPage() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page and per_page must not be negative")
+	}
+	page := max(int(req.GetPage()), 1)
+	perPage := int(req.GetPerPage())
+	if perPage == 0 {
+		perPage = defaultPerPage
+	}
+	perPage = min(perPage, maxPerPage)
+
+	sort, err := repository.ParseSort(req.GetSort())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	users, total, err := s.users.List(ctx, repository.ListOptions{
+		Offset: (page - 1) * perPage,
+		Limit:  perPage,
+		Sort:   sort,
+		Filter: repository.UserFilter{
+			FullName: req.GetFullName(),
+			Emoji:    req.GetEmoji(),
+			Query:    req.GetQuery(),
+			Statuses: models.ListedStatuses,
+		},
+	})
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+
+	resp := &userspb.ListUsersResponse{TotalCount: int32(total)}
+	for _, user := range users {
+		resp.Users = append(resp.Users, toProto(user))
+	}
+	return resp, nil
+}
+
+// GetUser returns an active user by ID
+func (s *UserService) GetUser(ctx context.Context, req *userspb.GetUserRequest) (*userspb.User, error) {
+	user, err := s.users.Get(ctx, req.GetId())
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	return toProto(user), nil
+}
+
+// CreateUser adds a new user. A UUID is generated when the request does not
+// supply an ID.
+func (s *UserService) CreateUser(ctx context.Context, req *userspb.CreateUserRequest) (*userspb.User, error) {
+	if req.GetUser() == nil {
+		return nil, status.Error(codes.InvalidArgument, "user is required")
+	}
+
+	newUser := models.UserProfile{ID: req.GetUser().GetId()}
+	applyFields(&newUser, req.GetUser(), mutableFields)
+
+	created, err := s.users.Create(ctx, newUser)
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	return toProto(created), nil
+}
+
+// UpdateUser changes the fields named in the update mask, or every mutable
+// field when the mask is empty. The request must carry the user's current
+// version so that concurrent edits are not silently lost.
+func (s *UserService) UpdateUser(ctx context.Context, req *userspb.UpdateUserRequest) (*userspb.User, error) {
+	user := req.GetUser()
+	if user.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user.id is required")
+	}
+	if user.GetVersion() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user.version is required; send the user's current version")
+	}
+
+	fields := req.GetUpdateMask().GetPaths()
+	if len(fields) == 0 {
+		fields = mutableFields
+	}
+	for _, field := range fields {
+		if !slices.Contains(mutableFields, field) {
+			return nil, status.Errorf(codes.InvalidArgument, "update_mask: %q cannot be updated; allowed fields are %s",
+				field, strings.Join(mutableFields, ", "))
+		}
+	}
+
+	updated, err := s.users.Update(ctx, user.GetId(), func(current *models.UserProfile) error {
+		if int64(current.Version) != user.GetVersion() {
+			return repository.ErrVersionMismatch
+		}
+		applyFields(current, user, fields)
+		return nil
+	})
+	if err != nil {
+		return nil, repositoryError(err)
+	}
+	return toProto(updated), nil
+}
+
+// DeleteUser soft-deletes a user by ID
+func (s *UserService) DeleteUser(ctx context.Context, req *userspb.DeleteUserRequest) (*emptypb.Empty, error) {
+	if err := s.users.Delete(ctx, req.GetId()); err != nil {
+		return nil, repositoryError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// mutableFields lists the User fields clients may set, by proto field name
+var mutableFields = []string{"full_name", "emoji", "email", "bio", "location"}
+
+// applyFields copies the named fields from the message onto the model
+func applyFields(user *models.UserProfile, msg *userspb.User, fields []string) {
+	for _, field := range fields {
+		switch field {
+		case "full_name":
+			user.FullName = msg.GetFullName()
+		case "emoji":
+			user.Emoji = msg.GetEmoji()
+		case "email":
+			user.Email = msg.GetEmail()
+		case "bio":
+			user.Bio = msg.GetBio()
+		case "location":
+			user.Location = msg.GetLocation()
+		}
+	}
+}
+
+func toProto(user models.UserProfile) *userspb.User {
+	return &userspb.User{
+		Id:         user.ID,
+		FullName:   user.FullName,
+		Emoji:      user.Emoji,
+		Email:      user.Email,
+		Bio:        user.Bio,
+		Location:   user.Location,
+		AvatarUrl:  user.AvatarURL,
+		Version:    int64(user.Version),
+		CreateTime: timestamppb.New(user.CreatedAt),
+		UpdateTime: timestamppb.New(user.UpdatedAt),
+	}
+}
+
+// validationError reports a user the user service found invalid, listing the
+// offending fields as BadRequest error details
+func validationError(err error) error {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	badRequest := &errdetails.BadRequest{}
+	for _, fieldErr := range validationErrs {
+		description := "failed the " + fieldErr.Tag() + " rule"
+		if fieldErr.Param() != "" {
+			description += " (" + fieldErr.Param() + ")"
+		}
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       "user." + protoFieldName(fieldErr.Field()),
+			Description: description,
+		})
+	}
+
+	st, detailErr := status.New(codes.InvalidArgument, "user failed validation").WithDetails(badRequest)
+	if detailErr != nil {
+		return status.Error(codes.InvalidArgument, "user failed validation")
+	}
+	return st.Err()
+}
+
+// protoFieldName converts a Go field name such as FullName to its proto
+// name, full_name
+func protoFieldName(field string) string {
+	var b strings.Builder
+	for i, r := range field {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// repositoryError maps repository and user service errors to gRPC status
+// errors
+func repositoryError(err error) error {
+	var unavailableErr *repository.UnavailableError
+	switch {
+	case errors.Is(err, service.ErrInvalid):
+		return validationError(err)
+	case errors.Is(err, repository.ErrNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, repository.ErrEmailConflict):
+		return status.Error(codes.AlreadyExists, "another user already has this email address")
+	case errors.Is(err, repository.ErrConflict):
+		return status.Error(codes.AlreadyExists, "user with this ID already exists")
+	case errors.Is(err, repository.ErrVersionMismatch):
+		return status.Error(codes.Aborted, "user was modified by another request; fetch it again and retry")
+	case errors.Is(err, repository.ErrReadOnly):
+		return status.Error(codes.FailedPrecondition, "this server is a read replica; change users through the primary")
+	case errors.As(err, &unavailableErr):
+		st, detailErr := status.New(codes.Unavailable, "user storage is unavailable; retry later").
+			WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(unavailableErr.RetryAfter)})
+		if detailErr != nil {
+			return status.Error(codes.Unavailable, "user storage is unavailable; retry later")
+		}
+		return st.Err()
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "the call's deadline passed before the repository answered")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "the call was cancelled")
+	default:
+		return &internalError{cause: err}
+	}
+}
+
+// internalError reports a generic Internal status to the client while
+// keeping the cause for the server's logs
+type internalError struct {
+	cause error
+}
+
+func (e *internalError) Error() string {
+	return e.cause.Error()
+}
+
+func (e *internalError) Unwrap() error {
+	return e.cause
+}
+
+func (e *internalError) GRPCStatus() *status.Status {
+	return status.New(codes.Internal, "an internal error occurred")
+}
@@ -0,0 +1,68 @@
+// Package https terminates TLS in the server itself, with a certificate read
+// from files or obtained from Let's Encrypt, and redirects plain HTTP to
+// HTTPS, so the API can be served securely without a proxy in front of it.
+package https
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+	"userprofile-api/config"
+)
+
+// Setup returns the TLS configuration of the server listening on addr, and
+// the handler of the plain HTTP listener, which redirects to it and, with
+// autocert, answers Let's Encrypt's HTTP-01 challenges. It returns nil for
+// both when TLS is off.
+func Setup(cfg config.TLSConfig, addr string) (*tls.Config, http.Handler, error) {
+	if !cfg.Enabled() {
+		return nil, nil, nil
+	}
+	redirect := Redirect(addr)
+
+	if cfg.Autocert() {
+		// Setting domains accepts Let's Encrypt's terms of service
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+			Email:      cfg.AutocertEmail,
+		}
+		tlsConfig := manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return tlsConfig, manager.HTTPHandler(redirect), nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load TLS certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	return tlsConfig, redirect, nil
+}
+
+// Redirect returns a handler permanently redirecting requests to the same
+// URL over HTTPS on the port of addr
+func Redirect(addr string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			// The request named no port
+			host = strings.Trim(r.Host, "[]")
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
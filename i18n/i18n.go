@@ -0,0 +1,198 @@
+// Package i18n serves error messages and the HTML pages in the language
+// clients ask for with their Accept-Language header. Messages are looked up
+// by their English text, as with gettext, so the code keeps its messages
+// readable and those without a translation are served in English. Messages
+// may hold template actions such as {{.Name}}, filled in from the data they
+// are localized with. Error codes are never localized.
+package i18n
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	goi18n "github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v3"
+	"userprofile-api/config"
+)
+
+// localizerKey is the gin context key of the request's localizer
+const localizerKey = "localizer"
+
+// locales holds the built-in catalogs. English needs none, being the
+// language of the messages themselves.
+//
+//go:embed locales/*.json
+var locales embed.FS
+
+// english renders the messages of requests that went through no Middleware
+var english = goi18n.NewLocalizer(goi18n.NewBundle(language.English), "en")
+
+// builtin is the catalog used when none is configured
+var builtin = sync.OnceValue(func() *Catalog {
+	catalog, err := Load(config.I18NConfig{DefaultLanguage: "en"})
+	if err != nil {
+		panic(err)
+	}
+	return catalog
+})
+
+// Catalog holds the translations of the messages in every language served
+type Catalog struct {
+	bundle *goi18n.Bundle
+	// languages are those served, the default first
+	languages []language.Tag
+	matcher   language.Matcher
+}
+
+// Load reads the built-in catalogs and those in cfg.Dir, named after their
+// language like de.json or active.pt-BR.yaml, which add languages or override
+// the built-in translations. Every file maps English messages to their
+// translation.
+func Load(cfg config.I18NConfig) (*Catalog, error) {
+	defaultLanguage, err := language.Parse(cfg.DefaultLanguage)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default language %q: %w", cfg.DefaultLanguage, err)
+	}
+
+	bundle := goi18n.NewBundle(language.English)
+	bundle.RegisterUnmarshalFunc("yaml", yaml.Unmarshal)
+	bundle.RegisterUnmarshalFunc("yml", yaml.Unmarshal)
+	paths, err := fs.Glob(locales, "locales/*.json")
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		if _, err := bundle.LoadMessageFileFS(locales, path); err != nil {
+			return nil, fmt.Errorf("failed to load built-in catalog %s: %w", path, err)
+		}
+	}
+	if cfg.Dir != "" {
+		entries, err := os.ReadDir(cfg.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read catalogs: %w", err)
+		}
+		for _, entry := range entries {
+			switch filepath.Ext(entry.Name()) {
+			case ".json", ".yaml", ".yml":
+			default:
+				continue
+			}
+			path := filepath.Join(cfg.Dir, entry.Name())
+			if _, err := bundle.LoadMessageFile(path); err != nil {
+				return nil, fmt.Errorf("failed to load catalog %s: %w", path, err)
+			}
+		}
+	}
+
+	served := append([]language.Tag{language.English}, bundle.LanguageTags()...)
+	if !slices.Contains(served, defaultLanguage) {
+		return nil, fmt.Errorf("no catalog for the default language %s", defaultLanguage)
+	}
+	languages := []language.Tag{defaultLanguage}
+	for _, tag := range served {
+		if !slices.Contains(languages, tag) {
+			languages = append(languages, tag)
+		}
+	}
+	return &Catalog{bundle: bundle, languages: languages, matcher: language.NewMatcher(languages)}, nil
+}
+
+// Languages returns the languages served, the default first
+func (c *Catalog) Languages() []string {
+	languages := make([]string, len(c.languages))
+	for i, tag := range c.languages {
+		languages[i] = tag.String()
+	}
+	return languages
+}
+
+// Match returns the served language that best matches an Accept-Language
+// header, or the default language when none does
+func (c *Catalog) Match(acceptLanguage string) language.Tag {
+	// Malformed headers are matched as far as they could be parsed
+	tags, _, _ := language.ParseAcceptLanguage(acceptLanguage)
+	_, index, confidence := c.matcher.Match(tags...)
+	if confidence == language.No {
+		return c.languages[0]
+	}
+	return c.languages[index]
+}
+
+// localizer renders the messages of a request in its language
+type localizer struct {
+	language  language.Tag
+	localizer *goi18n.Localizer
+}
+
+// Middleware picks the language of each request from its Accept-Language
+// header, for T and Tf to render messages in. A nil catalog serves the
+// built-in catalogs, with English as the default language.
+func Middleware(catalog *Catalog) gin.HandlerFunc {
+	if catalog == nil {
+		catalog = builtin()
+	}
+	return func(c *gin.Context) {
+		tag := catalog.Match(c.GetHeader("Accept-Language"))
+		c.Set(localizerKey, &localizer{language: tag, localizer: goi18n.NewLocalizer(catalog.bundle, tag.String())})
+		c.Next()
+	}
+}
+
+// Localized marks a response as holding messages in the request's language,
+// setting its Content-Language, and as varying with Accept-Language
+func Localized(c *gin.Context) {
+	if tag := Language(c); tag != "" {
+		c.Header("Content-Language", tag)
+	}
+	c.Writer.Header().Add("Vary", "Accept-Language")
+}
+
+// Language returns the language of the request, or "" when it went through
+// no Middleware
+func Language(c *gin.Context) string {
+	if l, ok := c.Get(localizerKey); ok {
+		return l.(*localizer).language.String()
+	}
+	return ""
+}
+
+// T returns message in the language of the request, or as is when it has no
+// translation in that language. Messages without a translation are never
+// parsed, so they may come from anywhere.
+func T(c *gin.Context, message string) string {
+	text, err := localizerOf(c).Localize(&goi18n.LocalizeConfig{MessageID: message})
+	if err != nil {
+		return message
+	}
+	return text
+}
+
+// Tf is T for messages holding template actions, filled in from data. The
+// messages must come from the code, not from requests.
+func Tf(c *gin.Context, message string, data map[string]any) string {
+	text, err := localizerOf(c).Localize(&goi18n.LocalizeConfig{
+		DefaultMessage: &goi18n.Message{ID: message, Other: message},
+		TemplateData:   data,
+	})
+	// Messages without a translation come back rendered in English, along
+	// with an error
+	if err != nil && text == "" {
+		return message
+	}
+	return text
+}
+
+// localizerOf returns the localizer of the request's language
+func localizerOf(c *gin.Context) *goi18n.Localizer {
+	if l, ok := c.Get(localizerKey); ok {
+		return l.(*localizer).localizer
+	}
+	return english
+}
@@ -0,0 +1,392 @@
+// Package jobs runs background work, such as webhook deliveries, backups and
+// sweeps for expired users, as jobs kept in a repository.JobRepository. A
+// pool of workers runs each job with the handler registered for its kind,
+// retrying failed jobs with exponential backoff until they run out of
+// attempts. Failed jobs are kept for inspection; jobs that succeed are
+// removed.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"userprofile-api/config"
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+const (
+	queueSize   = 1024
+	baseBackoff = time.Second
+	maxBackoff  = 5 * time.Minute
+)
+
+// ErrNotFailed is returned when requeuing or discarding a job that has not
+// failed
+var ErrNotFailed = errors.New("job has not failed")
+
+// Handler runs a job. A job whose handler returns an error is retried until
+// it has made its maximum number of attempts.
+type Handler func(ctx context.Context, job models.Job) error
+
+// kind is how the jobs of a kind are run
+type kind struct {
+	handle      Handler
+	maxAttempts int
+}
+
+// schedule enqueues a job of a kind on an interval
+type schedule struct {
+	kind     string
+	interval time.Duration
+}
+
+// Runner runs the jobs of a repository with a pool of workers. Jobs are
+// queued as they are enqueued, and the repository is polled for those due to
+// be retried or left behind when the queue was full.
+type Runner struct {
+	repo   repository.JobRepository
+	cfg    config.JobsConfig
+	logger *slog.Logger
+
+	mu        sync.Mutex
+	kinds     map[string]kind
+	schedules []schedule
+	// queued holds the IDs of the jobs in the queue or being run, so polling
+	// does not queue them twice
+	queued  map[string]bool
+	closed  bool
+	queue   chan string
+	workers sync.WaitGroup
+
+	runs *prometheus.CounterVec
+}
+
+// New creates a runner of the jobs kept in repo and starts its workers
+func New(repo repository.JobRepository, cfg config.JobsConfig, logger *slog.Logger) *Runner {
+	r := &Runner{
+		repo:   repo,
+		cfg:    cfg,
+		logger: logger,
+		kinds:  map[string]kind{},
+		queued: map[string]bool{},
+		queue:  make(chan string, queueSize),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "userprofile",
+			Name:      "jobs_total",
+			Help:      "Number of background job attempts, by kind and result (succeeded, retried or failed).",
+		}, []string{"kind", "result"}),
+	}
+	for range cfg.Workers {
+		r.workers.Add(1)
+		go r.work()
+	}
+	return r
+}
+
+// Describe implements prometheus.Collector
+func (r *Runner) Describe(ch chan<- *prometheus.Desc) {
+	r.runs.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (r *Runner) Collect(ch chan<- prometheus.Metric) {
+	r.runs.Collect(ch)
+}
+
+// Repository returns the repository the runner's jobs are kept in
+func (r *Runner) Repository() repository.JobRepository {
+	return r.repo
+}
+
+// Register runs the jobs of a kind with handle, making up to maxAttempts
+// attempts at each
+func (r *Runner) Register(name string, maxAttempts int, handle Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kinds[name] = kind{handle: handle, maxAttempts: max(maxAttempts, 1)}
+}
+
+// Schedule enqueues a job of a registered kind, without a payload, every
+// interval once Run is called, unless one is still pending or running. A zero
+// interval schedules nothing.
+func (r *Runner) Schedule(name string, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schedules = append(r.schedules, schedule{kind: name, interval: interval})
+}
+
+// Enqueue stores a job of a registered kind, due now, and queues it
+func (r *Runner) Enqueue(ctx context.Context, name string, payload models.Metadata) (models.Job, error) {
+	r.mu.Lock()
+	k, ok := r.kinds[name]
+	r.mu.Unlock()
+	if !ok {
+		return models.Job{}, fmt.Errorf("unknown job kind %q", name)
+	}
+
+	job, err := r.repo.Create(ctx, models.Job{
+		ID:          uuid.NewString(),
+		Kind:        name,
+		Payload:     payload,
+		Status:      models.JobPending,
+		MaxAttempts: k.maxAttempts,
+		RunAt:       time.Now().UTC(),
+	})
+	if err != nil {
+		return models.Job{}, err
+	}
+	r.push(job.ID)
+	return job, nil
+}
+
+// Retry requeues the failed job with the given ID, due now and with all its
+// attempts again, returning repository.ErrJobNotFound if it does not exist
+// and ErrNotFailed if it has not failed
+func (r *Runner) Retry(ctx context.Context, id string) (models.Job, error) {
+	job, err := r.repo.Get(ctx, id)
+	if err != nil {
+		return models.Job{}, err
+	}
+	if job.Status != models.JobFailed {
+		return models.Job{}, ErrNotFailed
+	}
+	job.Status, job.Attempts, job.LastError, job.RunAt = models.JobPending, 0, "", time.Now().UTC()
+	if job, err = r.repo.Update(ctx, job); err != nil {
+		return models.Job{}, err
+	}
+	r.push(job.ID)
+	return job, nil
+}
+
+// RetryFailed requeues every failed job, or only those of a kind when it is
+// not empty, and returns how many it requeued
+func (r *Runner) RetryFailed(ctx context.Context, name string) (int, error) {
+	failed, _, err := r.repo.List(ctx, repository.JobFilter{Status: models.JobFailed, Kind: name}, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	requeued := 0
+	for _, job := range failed {
+		_, err := r.Retry(ctx, job.ID)
+		if errors.Is(err, ErrNotFailed) || errors.Is(err, repository.ErrJobNotFound) {
+			// Requeued or removed since it was listed
+			continue
+		}
+		if err != nil {
+			return requeued, err
+		}
+		requeued++
+	}
+	return requeued, nil
+}
+
+// Discard removes the failed job with the given ID, returning
+// repository.ErrJobNotFound if it does not exist and ErrNotFailed if it has
+// not failed
+func (r *Runner) Discard(ctx context.Context, id string) error {
+	job, err := r.repo.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if job.Status != models.JobFailed {
+		return ErrNotFailed
+	}
+	return r.repo.Delete(ctx, id)
+}
+
+// Run returns the jobs left running by an earlier run to pending, then
+// polls for jobs that are due and enqueues the scheduled ones until ctx is
+// done
+func (r *Runner) Run(ctx context.Context) {
+	if released, err := r.repo.Release(ctx); err != nil {
+		r.logger.Error("Failed to release interrupted jobs", "error", err)
+	} else if released > 0 {
+		r.logger.Info("Released interrupted jobs", "jobs", released)
+	}
+
+	r.mu.Lock()
+	schedules := r.schedules
+	r.mu.Unlock()
+	for _, s := range schedules {
+		go r.runSchedule(ctx, s)
+	}
+
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		r.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll queues the jobs that are due
+func (r *Runner) poll(ctx context.Context) {
+	due, err := r.repo.Due(ctx, time.Now(), queueSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.Error("Failed to look up due jobs", "error", err)
+		}
+		return
+	}
+	for _, job := range due {
+		r.push(job.ID)
+	}
+}
+
+// runSchedule enqueues a job of the schedule's kind every interval
+func (r *Runner) runSchedule(ctx context.Context, s schedule) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.enqueueScheduled(ctx, s.kind); err != nil {
+				r.logger.Error("Failed to enqueue scheduled job", "kind", s.kind, "error", err)
+			}
+		}
+	}
+}
+
+// enqueueScheduled enqueues a job of a kind unless one is already pending or
+// running, so slow jobs do not pile up
+func (r *Runner) enqueueScheduled(ctx context.Context, name string) error {
+	for _, status := range []models.JobStatus{models.JobPending, models.JobRunning} {
+		_, total, err := r.repo.List(ctx, repository.JobFilter{Status: status, Kind: name}, 0, 1)
+		if err != nil {
+			return err
+		}
+		if total > 0 {
+			return nil
+		}
+	}
+	_, err := r.Enqueue(ctx, name, nil)
+	return err
+}
+
+// push queues the job with the given ID unless it is already queued. Jobs
+// that do not fit in the queue stay pending until a later poll.
+func (r *Runner) push(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.queued[id] {
+		return
+	}
+	select {
+	case r.queue <- id:
+		r.queued[id] = true
+	default:
+	}
+}
+
+func (r *Runner) work() {
+	defer r.workers.Done()
+	for id := range r.queue {
+		r.run(id)
+		r.mu.Lock()
+		delete(r.queued, id)
+		r.mu.Unlock()
+	}
+}
+
+// run claims the job with the given ID, runs it, and removes it when it
+// succeeds, schedules a retry when it fails, or marks it as failed on its
+// last attempt
+func (r *Runner) run(id string) {
+	// Jobs are not cut short by shutdown; Close waits for them
+	ctx := context.Background()
+	job, err := r.repo.Claim(ctx, id)
+	if errors.Is(err, repository.ErrJobNotPending) || errors.Is(err, repository.ErrJobNotFound) {
+		// Another server claimed it first
+		return
+	}
+	if err != nil {
+		r.logger.Error("Failed to claim job", "job", id, "error", err)
+		return
+	}
+
+	r.mu.Lock()
+	k, ok := r.kinds[job.Kind]
+	r.mu.Unlock()
+	if ok {
+		err = k.handle(ctx, job)
+	} else {
+		err = fmt.Errorf("unknown job kind %q", job.Kind)
+		job.Attempts = job.MaxAttempts
+	}
+
+	log := r.logger.With("job", job.ID, "kind", job.Kind, "attempt", job.Attempts)
+	if err == nil {
+		r.runs.WithLabelValues(job.Kind, "succeeded").Inc()
+		if err := r.repo.Delete(ctx, job.ID); err != nil && !errors.Is(err, repository.ErrJobNotFound) {
+			log.Error("Failed to remove finished job", "error", err)
+		}
+		return
+	}
+
+	job.LastError = err.Error()
+	if job.Attempts >= job.MaxAttempts {
+		r.runs.WithLabelValues(job.Kind, "failed").Inc()
+		job.Status = models.JobFailed
+		log.Error("Job failed; giving up", "error", err)
+	} else {
+		r.runs.WithLabelValues(job.Kind, "retried").Inc()
+		delay := backoff(job.Attempts)
+		job.Status, job.RunAt = models.JobPending, time.Now().Add(delay)
+		log.Warn("Job failed; retrying", "retryIn", delay.String(), "error", err)
+	}
+	if _, err := r.repo.Update(ctx, job); err != nil {
+		log.Error("Failed to save job", "error", err)
+	}
+}
+
+// backoff doubles the delay with each attempt, with up to 10% jitter so
+// retries to a recovering service are spread out
+func backoff(attempt int) time.Duration {
+	delay := maxBackoff
+	if attempt < 20 { // larger shifts would overflow
+		delay = min(baseBackoff<<(attempt-1), maxBackoff)
+	}
+	return delay + rand.N(delay/10+1)
+}
+
+// Close stops queuing jobs and waits for the queued ones to be run. Jobs
+// enqueued afterwards, and retries that are still waiting for their backoff,
+// are left pending, to be run after a restart by repositories that keep
+// them.
+func (r *Runner) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
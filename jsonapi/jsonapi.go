@@ -0,0 +1,356 @@
+// Package jsonapi renders responses and errors as JSON:API documents, and
+// reads the resource documents clients send, for clients that ask for the
+// JSON:API media type.
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/requestid"
+)
+
+// ContentType is the JSON:API media type, which clients accept to get
+// JSON:API documents and send resource documents with
+const ContentType = "application/vnd.api+json"
+
+// Version is the JSON:API version the documents follow
+const Version = "1.1"
+
+// Document is a JSON:API top-level document. Data holds a resource or a
+// list of them on success, Errors what went wrong otherwise; Meta holds the
+// bodies that are not resources, such as statistics.
+type Document struct {
+	Data    any            `json:"data,omitempty"`
+	Errors  []Error        `json:"errors,omitempty"`
+	Meta    map[string]any `json:"meta,omitempty"`
+	Links   Links          `json:"links,omitempty"`
+	JSONAPI Implementation `json:"jsonapi"`
+}
+
+// Implementation describes the server's JSON:API implementation
+type Implementation struct {
+	Version string `json:"version"`
+}
+
+// Resource is a JSON:API resource object
+type Resource struct {
+	Type          string                  `json:"type"`
+	ID            string                  `json:"id"`
+	Attributes    map[string]any          `json:"attributes,omitempty"`
+	Relationships map[string]Relationship `json:"relationships,omitempty"`
+	Links         Links                   `json:"links,omitempty"`
+	// Meta describes the resource's place in the response, such as its
+	// relevance to a search
+	Meta map[string]any `json:"meta,omitempty"`
+}
+
+// Relationship links a resource to related ones, such as a user's followers
+type Relationship struct {
+	Links Links `json:"links"`
+}
+
+// Links maps link relations to URLs
+type Links map[string]string
+
+// Error is a JSON:API error object. Code is the same as in the other error
+// formats.
+type Error struct {
+	Status string         `json:"status"`
+	Code   string         `json:"code"`
+	Title  string         `json:"title"`
+	Detail string         `json:"detail,omitempty"`
+	Source *Source        `json:"source,omitempty"`
+	Meta   map[string]any `json:"meta,omitempty"`
+}
+
+// Source points at the member of the request document an error is about
+type Source struct {
+	Pointer string `json:"pointer"`
+}
+
+// Accepts reports whether the Accept header lists the JSON:API media type
+func Accepts(c *gin.Context) bool {
+	for _, accepted := range strings.Split(c.GetHeader("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(accepted); err == nil && mediaType == ContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// Render writes a document with the JSON:API media type
+func Render(c *gin.Context, status int, doc Document) {
+	c.Header("Content-Type", ContentType)
+	c.JSON(status, doc)
+}
+
+// NewDocument wraps a response body: resources, or lists of them, become the
+// document's data and other bodies its meta. The document links to the
+// request and carries its request ID, unless it is shared through the
+// response cache.
+func NewDocument(c *gin.Context, body any) Document {
+	doc := Document{
+		Links:   Links{"self": c.Request.URL.RequestURI()},
+		JSONAPI: Implementation{Version: Version},
+	}
+	if data, ok := resources(body); ok {
+		doc.Data = data
+	} else if meta, ok := toMap(body); ok {
+		doc.Meta = meta
+	} else {
+		doc.Meta = map[string]any{"items": body}
+	}
+	doc.AddMeta("requestId", requestid.ForBody(c))
+	return doc
+}
+
+// NewErrorDocument describes a failed request. Details listing the invalid
+// fields of a request body, as validation errors do, become an error for
+// each field pointing at its attribute; other details are kept in the
+// error's meta.
+func NewErrorDocument(c *gin.Context, status int, code, title, detail string, details any) Document {
+	doc := Document{JSONAPI: Implementation{Version: Version}}
+	base := Error{Status: strconv.Itoa(status), Code: code, Title: title, Detail: detail}
+	if fields, ok := details.([]gin.H); ok && len(fields) > 0 {
+		for _, field := range fields {
+			name, _ := field["field"].(string)
+			fieldErr := base
+			fieldErr.Source = &Source{Pointer: "/data/attributes/" + name}
+			for key, value := range field {
+				if key != "field" {
+					fieldErr.addMeta(key, value)
+				}
+			}
+			doc.Errors = append(doc.Errors, fieldErr)
+		}
+	} else {
+		if details != nil {
+			base.addMeta("details", details)
+		}
+		doc.Errors = []Error{base}
+	}
+	doc.AddMeta("requestId", requestid.Get(c))
+	return doc
+}
+
+// AddMeta sets a member of the document's meta, leaving out empty values
+func (d *Document) AddMeta(name string, value any) {
+	if value == nil || value == "" {
+		return
+	}
+	if d.Meta == nil {
+		d.Meta = map[string]any{}
+	}
+	d.Meta[name] = value
+}
+
+func (e *Error) addMeta(name string, value any) {
+	if e.Meta == nil {
+		e.Meta = map[string]any{}
+	}
+	e.Meta[name] = value
+}
+
+// NewResource converts the body of a resource to a resource object of the
+// given type. Its members become the attributes, apart from its id and its
+// HAL links, which become the resource's links.
+func NewResource(resourceType, id string, body any) Resource {
+	members, _ := toMap(body)
+	return newResource(resourceType, id, members)
+}
+
+func newResource(resourceType, id string, attributes map[string]any) Resource {
+	resource := Resource{Type: resourceType, ID: id}
+	delete(attributes, "id")
+	if hal, ok := attributes["_links"].(map[string]any); ok {
+		resource.Links = Links{}
+		for rel, link := range hal {
+			if link, ok := link.(map[string]any); ok {
+				resource.Links[rel], _ = link["href"].(string)
+			}
+		}
+	}
+	delete(attributes, "_links")
+	if len(attributes) > 0 {
+		resource.Attributes = attributes
+	}
+	return resource
+}
+
+// Annotated converts a list of results that each hold a resource in member,
+// such as search results, to the resources, with the other members of each
+// result as the resource's meta
+func Annotated(results any, member string) ([]Resource, error) {
+	data, err := json.Marshal(results)
+	if err != nil {
+		return nil, err
+	}
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	resources := make([]Resource, 0, len(items))
+	for _, item := range items {
+		var resource Resource
+		if err := json.Unmarshal(item[member], &resource); err != nil {
+			return nil, err
+		}
+		delete(item, member)
+		for name, value := range item {
+			var decoded any
+			if err := json.Unmarshal(value, &decoded); err != nil {
+				return nil, err
+			}
+			if resource.Meta == nil {
+				resource.Meta = map[string]any{}
+			}
+			resource.Meta[name] = decoded
+		}
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+// resources converts a body that is a resource, or a list of them, to
+// resource objects. Bodies are resources when they are objects with an id;
+// their type is named after their XML element, so a group is of type
+// groups.
+func resources(body any) (any, bool) {
+	value := reflect.ValueOf(body)
+	if value.Kind() != reflect.Slice {
+		return resourceOf(body)
+	}
+	if value.Len() == 0 && !mayHaveID(value.Type().Elem()) {
+		return nil, false
+	}
+	list := make([]any, 0, value.Len())
+	for i := range value.Len() {
+		resource, ok := resourceOf(value.Index(i).Interface())
+		if !ok {
+			return nil, false
+		}
+		list = append(list, resource)
+	}
+	return list, true
+}
+
+func resourceOf(body any) (any, bool) {
+	if resource, ok := body.(Resource); ok {
+		return resource, true
+	}
+	attributes, ok := toMap(body)
+	if !ok {
+		return nil, false
+	}
+	var id string
+	switch value := attributes["id"].(type) {
+	case string:
+		id = value
+	case float64:
+		id = strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return nil, false
+	}
+	return newResource(typeOf(body), id, attributes), true
+}
+
+// mayHaveID reports whether values of type t can be resources, so that an
+// empty list of them is one too
+func mayHaveID(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Interface, reflect.Map:
+		return true
+	case reflect.Struct:
+		_, ok := t.FieldByNameFunc(func(name string) bool {
+			field, _ := t.FieldByName(name)
+			return strings.Split(field.Tag.Get("json"), ",")[0] == "id"
+		})
+		return ok
+	default:
+		return false
+	}
+}
+
+// typeOf names the resource type of a body after its XML element, or its Go
+// type, in the plural
+func typeOf(body any) string {
+	t := reflect.TypeOf(body)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	name := t.Name()
+	if field, ok := t.FieldByName("XMLName"); ok {
+		if tag := strings.Split(field.Tag.Get("xml"), ","); tag[0] != "" {
+			name = tag[0]
+		}
+	}
+	if name == "" {
+		return "resources"
+	}
+	name = strings.ToLower(name[:1]) + name[1:]
+	if strings.HasSuffix(name, "s") {
+		return name
+	}
+	return name + "s"
+}
+
+// toMap returns the members of a body that marshals to a JSON object
+func toMap(body any) (map[string]any, bool) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, false
+	}
+	var members map[string]any
+	if err := json.Unmarshal(data, &members); err != nil || members == nil {
+		return nil, false
+	}
+	return members, true
+}
+
+// requestDocument is a resource document sent by a client
+type requestDocument struct {
+	Data *struct {
+		Type       string                     `json:"type"`
+		ID         json.RawMessage            `json:"id"`
+		Attributes map[string]json.RawMessage `json:"attributes"`
+	} `json:"data"`
+}
+
+// Attributes reads a resource document and returns its attributes, along
+// with its id if it has one, as a JSON object, for the body to be bound as
+// if it had been sent as JSON
+func Attributes(body io.Reader) ([]byte, error) {
+	var doc requestDocument
+	decoder := json.NewDecoder(body)
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc.Data == nil {
+		return nil, errors.New("JSON:API document has no data object")
+	}
+	if doc.Data.Type == "" {
+		return nil, errors.New("JSON:API resource has no type")
+	}
+	attributes := doc.Data.Attributes
+	if attributes == nil {
+		attributes = map[string]json.RawMessage{}
+	}
+	if len(doc.Data.ID) > 0 && !bytes.Equal(doc.Data.ID, []byte("null")) {
+		if _, ok := attributes["id"]; ok {
+			return nil, errors.New("JSON:API resource attributes cannot include id")
+		}
+		attributes["id"] = doc.Data.ID
+	}
+	return json.Marshal(attributes)
+}
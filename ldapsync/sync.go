@@ -0,0 +1,302 @@
+// Package ldapsync imports users from an LDAP directory. A syncer searches
+// the directory for the users' entries, maps their attributes to user
+// fields, and creates or updates the matching users by email, on demand
+// through the admin API or in scheduled background jobs.
+package ldapsync
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"userprofile-api/auth"
+	"userprofile-api/config"
+	"userprofile-api/models"
+	"userprofile-api/repository"
+	"userprofile-api/service"
+)
+
+// Actor names the syncer in the audit trail of the users it imports
+const Actor = "ldap-sync"
+
+// JobKind is the kind of the background jobs syncing users
+const JobKind = "ldap.sync"
+
+// pageSize is how many entries are asked for at a time, so the server's size
+// limit does not cut the results short
+const pageSize = 500
+
+// errUnchanged stops the update of a user the directory has nothing new for
+var errUnchanged = errors.New("user is up to date")
+
+// Result counts what a sync did with the entries it found
+type Result struct {
+	XMLName xml.Name `json:"-" yaml:"-" xml:"ldapSync"`
+	// Created and Updated count the users created and updated from entries
+	Created int `json:"created" xml:"created" yaml:"created"`
+	Updated int `json:"updated" xml:"updated" yaml:"updated"`
+	// Skipped counts the entries whose user was up to date, along with those
+	// that could not be imported, which are logged
+	Skipped int `json:"skipped" xml:"skipped" yaml:"skipped"`
+}
+
+// Syncer imports the users of a directory into the default storage through
+// the user service, so each change is validated, audited and published like
+// any other
+type Syncer struct {
+	cfg    config.LDAPConfig
+	filter string
+	users  *service.UserService
+	logger *slog.Logger
+
+	// mu lets one sync run at a time, so scheduled and requested ones do not
+	// race to create the same users
+	mu sync.Mutex
+
+	synced *prometheus.CounterVec
+	syncs  *prometheus.CounterVec
+}
+
+// New creates a syncer for the directory of cfg, failing if its filter is
+// invalid
+func New(cfg config.LDAPConfig, users *service.UserService, logger *slog.Logger) (*Syncer, error) {
+	// The parentheses around a lone item can be left out
+	filter := strings.TrimSpace(cfg.Filter)
+	if !strings.HasPrefix(filter, "(") {
+		filter = "(" + filter + ")"
+	}
+	if _, err := ldap.CompileFilter(filter); err != nil {
+		return nil, fmt.Errorf("invalid LDAP filter %q: %w", cfg.Filter, err)
+	}
+	return &Syncer{
+		cfg:    cfg,
+		filter: filter,
+		users:  users,
+		logger: logger,
+		synced: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "userprofile",
+			Name:      "ldap_synced_users_total",
+			Help:      "Number of directory entries synced, by result (created, updated or skipped).",
+		}, []string{"result"}),
+		syncs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "userprofile",
+			Name:      "ldap_syncs_total",
+			Help:      "Number of syncs of users from the LDAP directory, by result (ok or error).",
+		}, []string{"result"}),
+	}, nil
+}
+
+// Describe implements prometheus.Collector
+func (s *Syncer) Describe(ch chan<- *prometheus.Desc) {
+	s.synced.Describe(ch)
+	s.syncs.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (s *Syncer) Collect(ch chan<- prometheus.Metric) {
+	s.synced.Collect(ch)
+	s.syncs.Collect(ch)
+}
+
+// HandleJob syncs users. It is the handler of JobKind jobs; a failed sync is
+// logged, and not retried until the next one.
+func (s *Syncer) HandleJob(ctx context.Context, _ models.Job) error {
+	_, _ = s.Sync(ctx)
+	return nil
+}
+
+// Sync reads the users' entries from the directory and imports them, within
+// LDAP_TIMEOUT. Entries are matched to active users by email: users are
+// created for new addresses, and updated when a mapped attribute changed;
+// attributes an entry lacks clear their field. Entries without an email, or
+// whose users are rejected, such as by validation, are skipped and logged.
+// Other failures stop the sync, keeping the changes made so far.
+func (s *Syncer) Sync(ctx context.Context) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+	ctx = auth.NewContext(ctx, auth.Principal{Name: Actor})
+	start := time.Now()
+
+	result, err := s.sync(ctx)
+	s.synced.WithLabelValues("created").Add(float64(result.Created))
+	s.synced.WithLabelValues("updated").Add(float64(result.Updated))
+	s.synced.WithLabelValues("skipped").Add(float64(result.Skipped))
+	if err != nil {
+		s.syncs.WithLabelValues("error").Inc()
+		s.logger.Error("Sync of users from LDAP failed", "created", result.Created, "updated", result.Updated,
+			"skipped", result.Skipped, "error", err)
+		return result, err
+	}
+	s.syncs.WithLabelValues("ok").Inc()
+	s.logger.Info("Synced users from LDAP", "created", result.Created, "updated", result.Updated,
+		"skipped", result.Skipped, "duration", time.Since(start).String())
+	return result, nil
+}
+
+func (s *Syncer) sync(ctx context.Context) (Result, error) {
+	entries, err := s.search(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var result Result
+	for _, found := range entries {
+		created, err := s.apply(ctx, found)
+		switch {
+		case err == nil && created:
+			result.Created++
+		case err == nil:
+			result.Updated++
+		case errors.Is(err, errUnchanged):
+			result.Skipped++
+		case errors.Is(err, service.ErrInvalid), errors.Is(err, repository.ErrConflict),
+			errors.Is(err, repository.ErrVersionMismatch):
+			result.Skipped++
+			s.logger.Warn("Skipped LDAP entry", "dn", found.DN, "error", err)
+		default:
+			return result, fmt.Errorf("entry %s: %w", found.DN, err)
+		}
+	}
+	return result, nil
+}
+
+// search returns the entries of the directory matching the filter, with the
+// mapped attributes, in pages. Referrals to other servers are not followed.
+func (s *Syncer) search(ctx context.Context) ([]*ldap.Entry, error) {
+	conn, err := connect(ctx, s.cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP: %w", err)
+	}
+	defer conn.Close()
+	if s.cfg.BindDN == "" {
+		err = conn.UnauthenticatedBind("")
+	} else {
+		err = conn.Bind(s.cfg.BindDN, s.cfg.BindPassword)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := make([]string, 0, len(s.cfg.Attributes))
+	for _, attribute := range s.cfg.Attributes {
+		if !slices.Contains(attributes, attribute) {
+			attributes = append(attributes, attribute)
+		}
+	}
+	result, err := conn.SearchWithPaging(ldap.NewSearchRequest(s.cfg.BaseDN, ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 0, 0, false, s.filter, attributes, nil), pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return result.Entries, nil
+}
+
+// connect dials the directory at rawURL, an ldap:// or ldaps:// URL. The
+// connection is closed when ctx is done, failing the operation under way.
+func connect(ctx context.Context, rawURL string) (*ldap.Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	deadline, hasDeadline := ctx.Deadline()
+	conn, err := ldap.DialURL(rawURL, ldap.DialWithDialer(&net.Dialer{Deadline: deadline}),
+		ldap.DialWithTLSConfig(&tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}))
+	if err != nil {
+		return nil, err
+	}
+	if hasDeadline {
+		conn.SetTimeout(time.Until(deadline))
+	}
+	context.AfterFunc(ctx, func() { conn.Close() })
+	return conn, nil
+}
+
+// apply creates or updates the user of an entry, reporting whether it was
+// created. It fails with errUnchanged when the user is up to date, and with
+// service.ErrInvalid when the entry has no email.
+func (s *Syncer) apply(ctx context.Context, found *ldap.Entry) (bool, error) {
+	email, _ := value(found, s.cfg.Attributes["email"])
+	if strings.TrimSpace(email) == "" {
+		return false, fmt.Errorf("%w: no %s attribute", service.ErrInvalid, s.cfg.Attributes["email"])
+	}
+
+	user, err := s.users.GetByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		var user models.UserProfile
+		s.mapAttributes(found, &user)
+		_, err := s.users.Create(ctx, user)
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, err = s.users.Update(ctx, user.ID, func(user *models.UserProfile) error {
+		current := user.Clone()
+		s.mapAttributes(found, user)
+		mapped := user.Clone()
+		mapped.Normalize()
+		if reflect.DeepEqual(mapped, current) {
+			return errUnchanged
+		}
+		return nil
+	})
+	return false, err
+}
+
+// mapAttributes sets the mapped fields of user to the values of the entry's
+// attributes
+func (s *Syncer) mapAttributes(found *ldap.Entry, user *models.UserProfile) {
+	for field, attribute := range s.cfg.Attributes {
+		v, ok := value(found, attribute)
+		v = strings.TrimSpace(v)
+		switch field {
+		case "fullName":
+			user.FullName = v
+		case "email":
+			user.Email = v
+		case "bio":
+			user.Bio = v
+		case "location":
+			user.Location = v
+		default:
+			key := strings.TrimPrefix(field, config.LDAPMetadataPrefix)
+			if ok {
+				if user.Metadata == nil {
+					user.Metadata = models.Metadata{}
+				}
+				user.Metadata[key] = v
+			} else if _, set := user.Metadata[key]; set {
+				delete(user.Metadata, key)
+				if len(user.Metadata) == 0 {
+					user.Metadata = nil
+				}
+			}
+		}
+	}
+}
+
+// value returns the first value of the named attribute of an entry, if any,
+// matching the name regardless of case
+func value(entry *ldap.Entry, attribute string) (string, bool) {
+	for _, a := range entry.Attributes {
+		if strings.EqualFold(a.Name, attribute) && len(a.Values) > 0 {
+			return a.Values[0], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,96 @@
+// Package lifecycle moves users between statuses, enforcing the transitions
+// the status state machine allows:
+//
+//	active    -> suspended, archived
+//	suspended -> active, archived
+//	archived  -> active
+//
+// Archived users must be activated before they can be suspended again.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+// ErrInvalidTransition is wrapped by the errors of transitions the state
+// machine does not allow
+var ErrInvalidTransition = errors.New("status transition not allowed")
+
+// transitions lists the statuses each status can move to
+var transitions = map[models.Status][]models.Status{
+	models.StatusActive:    {models.StatusSuspended, models.StatusArchived},
+	models.StatusSuspended: {models.StatusActive, models.StatusArchived},
+	models.StatusArchived:  {models.StatusActive},
+}
+
+// TransitionError reports a transition the state machine does not allow
+type TransitionError struct {
+	From models.Status
+	To   models.Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot move a user from %s to %s", e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+// Allowed reports whether a user can move from one status to another.
+// Staying in the same status is always allowed.
+func Allowed(from, to models.Status) bool {
+	return from == to || slices.Contains(transitions[from], to)
+}
+
+// maxAttempts bounds how often Transition reads the user again when it is
+// changed by another request in the meantime
+const maxAttempts = 3
+
+// Transition moves the active user with the given ID to a status and
+// returns it, or a *TransitionError when its current status cannot move
+// there. A user already in the status is returned unchanged.
+func Transition(ctx context.Context, repo repository.UserRepository, id string, to models.Status) (models.UserProfile, error) {
+	for attempt := 1; ; attempt++ {
+		user, err := repo.Get(ctx, id)
+		if err != nil {
+			return models.UserProfile{}, err
+		}
+		if user.Status == to {
+			return user, nil
+		}
+		if !Allowed(user.Status, to) {
+			return models.UserProfile{}, &TransitionError{From: user.Status, To: to}
+		}
+
+		// The version makes the check and the change atomic: the update
+		// fails if the status changed since it was read
+		user.Status = to
+		updated, err := repo.Update(ctx, id, user)
+		if errors.Is(err, repository.ErrVersionMismatch) && attempt < maxAttempts {
+			continue
+		}
+		return updated, err
+	}
+}
+
+// Suspend moves the user with the given ID to StatusSuspended
+func Suspend(ctx context.Context, repo repository.UserRepository, id string) (models.UserProfile, error) {
+	return Transition(ctx, repo, id, models.StatusSuspended)
+}
+
+// Activate moves the user with the given ID to StatusActive
+func Activate(ctx context.Context, repo repository.UserRepository, id string) (models.UserProfile, error) {
+	return Transition(ctx, repo, id, models.StatusActive)
+}
+
+// Archive moves the user with the given ID to StatusArchived
+func Archive(ctx context.Context, repo repository.UserRepository, id string) (models.UserProfile, error) {
+	return Transition(ctx, repo, id, models.StatusArchived)
+}
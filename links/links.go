@@ -0,0 +1,122 @@
+package links
+
+import (
+	"encoding/xml"
+	"maps"
+	"mime"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apiversion"
+	"userprofile-api/jsonapi"
+	"userprofile-api/models"
+)
+
+// HALContentType is the media type clients accept to get links without the
+// server-wide setting
+const HALContentType = "application/hal+json"
+
+// contextKey is the gin context key holding the request's link builder
+const contextKey = "links"
+
+// Link is a HAL link object
+type Link struct {
+	Href string `json:"href" yaml:"href"`
+}
+
+// Links maps link relations to their targets, serialized as _links
+type Links map[string]Link
+
+// MarshalXML writes the links as Atom-style link elements, in relation
+// order, since XML has no counterpart to a JSON object's keys
+func (l Links) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, rel := range slices.Sorted(maps.Keys(l)) {
+		link := xml.StartElement{
+			Name: xml.Name{Local: "link"},
+			Attr: []xml.Attr{
+				{Name: xml.Name{Local: "rel"}, Value: rel},
+				{Name: xml.Name{Local: "href"}, Value: l[rel].Href},
+			},
+		}
+		if err := e.EncodeElement("", link); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// Builder generates links to API resources, absolute when a base URL is
+// configured and root-relative otherwise
+type Builder struct {
+	base    string
+	version string
+}
+
+// NewBuilder creates a builder for links under baseURL, e.g.
+// https://api.example.com; an empty base URL yields root-relative links
+func NewBuilder(baseURL string) *Builder {
+	return &Builder{base: strings.TrimSuffix(baseURL, "/"), version: apiversion.V1}
+}
+
+// Users returns the URL of the user collection
+func (b *Builder) Users() string {
+	return b.base + "/api/" + b.version + "/users"
+}
+
+// User returns the URL of a single user
+func (b *Builder) User(id string) string {
+	return b.Users() + "/" + url.PathEscape(id)
+}
+
+// UserLinks returns the links of a user resource. The avatar link is only
+// present once an avatar has been uploaded.
+func (b *Builder) UserLinks(user models.UserProfile) Links {
+	links := Links{
+		"self":       {Href: b.User(user.ID)},
+		"collection": {Href: b.Users()},
+	}
+	if user.AvatarURL != "" {
+		links["avatar"] = Link{Href: b.User(user.ID) + "/avatar"}
+	}
+	return links
+}
+
+// Middleware makes a link builder for the request's API version available
+// to the handlers when links are enabled for every response or the client
+// accepts HAL or JSON:API, whose resources link to themselves
+func Middleware(builder *Builder, always bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Responses depend on Accept for their format as well as their
+		// links, including 304s that never reach the renderer
+		c.Writer.Header().Add("Vary", "Accept")
+		if always || AcceptsHAL(c) || jsonapi.Accepts(c) {
+			versioned := *builder
+			versioned.version = apiversion.From(c)
+			c.Set(contextKey, &versioned)
+		}
+		c.Next()
+	}
+}
+
+// From returns the request's link builder, or nil when the response should
+// not include links
+func From(c *gin.Context) *Builder {
+	builder, _ := c.Get(contextKey)
+	b, _ := builder.(*Builder)
+	return b
+}
+
+// AcceptsHAL reports whether the Accept header lists the HAL media type
+func AcceptsHAL(c *gin.Context) bool {
+	for _, accepted := range strings.Split(c.GetHeader("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(accepted); err == nil && mediaType == HALContentType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"userprofile-api/config"
+	"userprofile-api/requestid"
+)
+
+// New creates a logger writing to stderr in the configured format. Its
+// minimum level is held by level, so that it can be changed while the
+// server is running.
+func New(cfg config.LogConfig, level *slog.LevelVar) *slog.Logger {
+	level.Set(cfg.Level)
+	options := &slog.HandlerOptions{Level: level}
+	if cfg.Format == config.LogFormatConsole {
+		return slog.New(slog.NewTextHandler(os.Stderr, options))
+	}
+	return slog.New(slog.NewJSONHandler(os.Stderr, options))
+}
+
+// Middleware logs one structured entry per request once it has been handled.
+// Server errors are logged at error level and client errors at warn level.
+func Middleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		query := c.Request.URL.RawQuery
+
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("clientIp", c.ClientIP()),
+			slog.String("requestId", requestid.Get(c)),
+		}
+		if query != "" {
+			attrs = append(attrs, slog.String("query", query))
+		}
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+			attrs = append(attrs, slog.String("traceId", span.TraceID().String()))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		logger.LogAttrs(c.Request.Context(), level, "request handled", attrs...)
+	}
+}
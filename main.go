@@ -1,14 +1,88 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"userprofile-api/api"
+	"userprofile-api/config"
+	"userprofile-api/logging"
+	"userprofile-api/server"
+	"userprofile-api/tracing"
 )
 
 func main() {
-	router := api.SetupRouter()
-	
-	log.Println("Starting server on :8080")
-	router.Run(":8080")
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Route the standard library logger through slog as well, so every log
+	// line shares the configured format
+	logLevel := new(slog.LevelVar)
+	slog.SetDefault(logging.New(cfg.Log, logLevel))
+
+	if err := run(cfg, logLevel); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves the API until SIGINT or SIGTERM, then drains in-flight requests
+// and releases resources. Returning instead of exiting lets the deferred
+// cleanup run on every path.
+func run(cfg *config.Config, logLevel *slog.LevelVar) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	defer func() {
+		// Flush buffered spans even though the signal context is done
+		flushCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			log.Printf("Failed to flush traces: %v", err)
+		}
+	}()
+
+	srv, err := server.New(cfg, server.WithLogLevel(logLevel))
+	if err != nil {
+		return err
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Start() }()
+
+	select {
+	case err := <-serveErr:
+		// Release what the server opened before reporting the failure
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Failed to shut down: %v", err)
+		}
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	log.Printf("Shutting down; waiting up to %s for in-flight requests", cfg.Server.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	log.Println("Server stopped")
+	return nil
 }
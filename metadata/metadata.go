@@ -0,0 +1,210 @@
+// Package metadata checks the free-form metadata of users against JSON
+// Schemas: a default one, and the schemas tenants may have of their own.
+// Schemas are written as OpenAPI 3 schema objects, the JSON Schema dialect
+// the API document uses.
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"userprofile-api/config"
+	"userprofile-api/models"
+	"userprofile-api/tenant"
+)
+
+// ErrInvalidSchema is wrapped by the errors of Parse
+var ErrInvalidSchema = errors.New("invalid metadata schema")
+
+// Schema is a JSON Schema that metadata can be checked against
+type Schema struct {
+	document models.Metadata
+	schema   *openapi3.Schema
+}
+
+// Parse reads a schema from its JSON document, which must be an object
+func Parse(data []byte) (*Schema, error) {
+	var document models.Metadata
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	if document == nil {
+		return nil, fmt.Errorf("%w: the schema must be a JSON object", ErrInvalidSchema)
+	}
+	return parseDocument(document)
+}
+
+func parseDocument(document models.Metadata) (*Schema, error) {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	var schema openapi3.Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	if err := schema.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	return &Schema{document: document.Clone(), schema: &schema}, nil
+}
+
+// Document returns the JSON document of the schema
+func (s *Schema) Document() models.Metadata {
+	return s.document.Clone()
+}
+
+// Validate returns an *Error listing the ways metadata fails to match the
+// schema, or nil when it matches. Missing metadata is checked as an empty
+// object.
+func (s *Schema) Validate(m models.Metadata) error {
+	value := map[string]any(m.Clone())
+	if value == nil {
+		value = map[string]any{}
+	}
+	err := s.schema.VisitJSON(value, openapi3.MultiErrors())
+	if err == nil {
+		return nil
+	}
+	return &Error{Violations: violations(err)}
+}
+
+// Error reports metadata that does not match its schema
+type Error struct {
+	Violations []Violation
+}
+
+// Violation is a way metadata fails to match its schema
+type Violation struct {
+	// Field locates the offending value, e.g. metadata.team or
+	// metadata.skills[1]
+	Field string
+	// Reason says what is wrong with it
+	Reason string
+}
+
+func (e *Error) Error() string {
+	reasons := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		reasons = append(reasons, v.Field+": "+v.Reason)
+	}
+	return "metadata does not match its schema: " + strings.Join(reasons, "; ")
+}
+
+// violations flattens the errors of a schema validation
+func violations(err error) []Violation {
+	var multi openapi3.MultiError
+	if errors.As(err, &multi) {
+		var all []Violation
+		for _, err := range multi {
+			all = append(all, violations(err)...)
+		}
+		return all
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if !errors.As(err, &schemaErr) {
+		return []Violation{{Field: "metadata", Reason: err.Error()}}
+	}
+	field := "metadata"
+	for _, key := range schemaErr.JSONPointer() {
+		if _, err := strconv.Atoi(key); err == nil {
+			field += "[" + key + "]"
+		} else {
+			field += "." + key
+		}
+	}
+	reason := schemaErr.Reason
+	if reason == "" && schemaErr.Origin != nil {
+		reason = schemaErr.Origin.Error()
+	}
+	return []Violation{{Field: field, Reason: reason}}
+}
+
+// Schemas holds the default schema, which the admin API can replace until
+// the server restarts, and finds the schemas of tenants in their registry
+type Schemas struct {
+	// registry is nil when tenancy is disabled
+	registry *tenant.Registry
+
+	mu            sync.RWMutex
+	defaultSchema *Schema
+}
+
+// New loads the default schema from the configured file, if any, and looks
+// up tenants' schemas in registry
+func New(cfg config.MetadataConfig, registry *tenant.Registry) (*Schemas, error) {
+	s := &Schemas{registry: registry}
+	if cfg.SchemaFile == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(cfg.SchemaFile)
+	if err != nil {
+		return nil, err
+	}
+	if s.defaultSchema, err = Parse(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.SchemaFile, err)
+	}
+	return s, nil
+}
+
+// Default returns the default schema, or nil when there is none
+func (s *Schemas) Default() *Schema {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.defaultSchema
+}
+
+// SetDefault replaces the default schema; nil removes it
+func (s *Schemas) SetDefault(schema *Schema) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defaultSchema = schema
+}
+
+// Tenant returns the schema the tenant has of its own, or nil when it has
+// none. The default tenant, named by an empty string, never has one.
+func (s *Schemas) Tenant(id string) (*Schema, error) {
+	if id == "" || s.registry == nil {
+		return nil, nil
+	}
+	t, err := s.registry.Get(id)
+	if err != nil || t.MetadataSchema == nil {
+		return nil, err
+	}
+	return parseDocument(t.MetadataSchema)
+}
+
+// SetTenant replaces the schema of a tenant; nil removes it, so that the
+// tenant's users are checked against the default schema again
+func (s *Schemas) SetTenant(id string, schema *Schema) (tenant.Tenant, error) {
+	var document models.Metadata
+	if schema != nil {
+		document = schema.Document()
+	}
+	return s.registry.SetMetadataSchema(id, document)
+}
+
+// Validate checks the metadata of a user of the given tenant against the
+// tenant's schema, or the default one when it has none. Without either any
+// metadata is valid.
+func (s *Schemas) Validate(tenantID string, m models.Metadata) error {
+	schema, err := s.Tenant(tenantID)
+	if err != nil {
+		return err
+	}
+	if schema == nil {
+		schema = s.Default()
+	}
+	if schema == nil {
+		return nil
+	}
+	return schema.Validate(m)
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"userprofile-api/repository"
+)
+
+const namespace = "userprofile"
+
+// unmatchedRoute labels requests that did not match any route, keeping the
+// label cardinality bounded
+const unmatchedRoute = "unmatched"
+
+// Metrics holds the Prometheus collectors for the service. Each instance owns
+// its registry so several routers can coexist in one process.
+type Metrics struct {
+	registry *prometheus.Registry
+	// started is when the metrics began to be collected, around when the
+	// server started
+	started time.Time
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+}
+
+// New creates the HTTP and runtime collectors plus a gauge reporting how
+// many users the repository holds. Repositories that export metrics of their
+// own, such as the Redis cache and the storage circuit breaker, are
+// registered as well, along with the collectors of other components, such as
+// the expiry janitor.
+func New(repo repository.UserRepository, extra ...prometheus.Collector) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		started:  time.Now().UTC(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests handled, by method, route and status code.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency, by method, route and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "Number of HTTP requests currently being served, by method and route.",
+		}, []string{"method", "route"}),
+	}
+
+	usersStored := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "users_stored",
+		Help:      "Number of user profiles held by the repository.",
+	}, func() float64 {
+		_, total, err := repo.List(context.Background(), repository.ListOptions{Limit: 1})
+		if err != nil {
+			return 0
+		}
+		return float64(total)
+	})
+
+	m.registry.MustRegister(
+		m.requests,
+		m.duration,
+		m.inFlight,
+		usersStored,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	// Read replicas wrap the repository in a read-only one that exports none
+	if collector, ok := repository.Writable(repo).(prometheus.Collector); ok {
+		m.registry.MustRegister(collector)
+	}
+	m.registry.MustRegister(extra...)
+	return m
+}
+
+// Middleware records request counts, latencies and in-flight requests,
+// labelled by the matched route template rather than the raw path
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := c.Request.Method
+
+		inFlight := m.inFlight.WithLabelValues(method, route)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		c.Next()
+
+		status := strconv.Itoa(c.Writer.Status())
+		m.requests.WithLabelValues(method, route, status).Inc()
+		m.duration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the collected metrics in the Prometheus exposition format
+func (m *Metrics) Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
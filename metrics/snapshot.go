@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"math"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// RuntimeStats describes the Go runtime and process of the server
+type RuntimeStats struct {
+	Goroutines int `json:"goroutines" xml:"goroutines" yaml:"goroutines"`
+	Threads    int `json:"threads" xml:"threads" yaml:"threads"`
+	// GCCycles is the number of completed garbage collections
+	GCCycles      int         `json:"gcCycles" xml:"gcCycles" yaml:"gcCycles"`
+	Memory        MemoryStats `json:"memory" xml:"memory" yaml:"memory"`
+	StartedAt     time.Time   `json:"startedAt" xml:"startedAt" yaml:"startedAt"`
+	UptimeSeconds int64       `json:"uptimeSeconds" xml:"uptimeSeconds" yaml:"uptimeSeconds"`
+}
+
+// MemoryStats describes the memory of the server, in bytes
+type MemoryStats struct {
+	// Alloc is held by live and not yet collected heap objects
+	Alloc int64 `json:"allocBytes" xml:"allocBytes" yaml:"allocBytes"`
+	// HeapInUse is held by heap spans in use
+	HeapInUse int64 `json:"heapInUseBytes" xml:"heapInUseBytes" yaml:"heapInUseBytes"`
+	// Sys is obtained from the operating system by the Go runtime
+	Sys int64 `json:"sysBytes" xml:"sysBytes" yaml:"sysBytes"`
+	// Resident is the resident set size of the process, where the operating
+	// system reports it
+	Resident int64 `json:"residentBytes,omitempty" xml:"residentBytes,omitempty" yaml:"residentBytes,omitempty"`
+}
+
+// RequestStats counts the HTTP requests handled since the server started
+type RequestStats struct {
+	Total    int `json:"total" xml:"total" yaml:"total"`
+	InFlight int `json:"inFlight" xml:"inFlight" yaml:"inFlight"`
+	// Responses by status class
+	Informational int `json:"informational" xml:"informational" yaml:"informational"`
+	Success       int `json:"success" xml:"success" yaml:"success"`
+	Redirection   int `json:"redirection" xml:"redirection" yaml:"redirection"`
+	ClientErrors  int `json:"clientErrors" xml:"clientErrors" yaml:"clientErrors"`
+	ServerErrors  int `json:"serverErrors" xml:"serverErrors" yaml:"serverErrors"`
+}
+
+// Snapshot is a reading of the collected metrics for consumers that do not
+// scrape Prometheus
+type Snapshot struct {
+	Runtime  RuntimeStats
+	Requests RequestStats
+}
+
+// Snapshot gathers the metrics of the registry into a Snapshot
+func (m *Metrics) Snapshot() (Snapshot, error) {
+	families, err := m.registry.Gather()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+
+	snapshot := Snapshot{
+		Runtime: RuntimeStats{
+			Goroutines: int(gaugeValue(byName["go_goroutines"])),
+			Threads:    int(gaugeValue(byName["go_threads"])),
+			Memory: MemoryStats{
+				Alloc:     int64(gaugeValue(byName["go_memstats_alloc_bytes"])),
+				HeapInUse: int64(gaugeValue(byName["go_memstats_heap_inuse_bytes"])),
+				Sys:       int64(gaugeValue(byName["go_memstats_sys_bytes"])),
+				Resident:  int64(gaugeValue(byName["process_resident_memory_bytes"])),
+			},
+			StartedAt:     m.started,
+			UptimeSeconds: int64(time.Since(m.started) / time.Second),
+		},
+	}
+	if gc := byName["go_gc_duration_seconds"]; gc != nil && len(gc.GetMetric()) > 0 {
+		snapshot.Runtime.GCCycles = int(gc.GetMetric()[0].GetSummary().GetSampleCount())
+	}
+
+	if inFlight := byName[namespace+"_http_requests_in_flight"]; inFlight != nil {
+		for _, metric := range inFlight.GetMetric() {
+			snapshot.Requests.InFlight += int(metric.GetGauge().GetValue())
+		}
+	}
+	if requests := byName[namespace+"_http_requests_total"]; requests != nil {
+		for _, metric := range requests.GetMetric() {
+			count := int(metric.GetCounter().GetValue())
+			snapshot.Requests.Total += count
+			switch statusClass(metric) {
+			case "1":
+				snapshot.Requests.Informational += count
+			case "2":
+				snapshot.Requests.Success += count
+			case "3":
+				snapshot.Requests.Redirection += count
+			case "4":
+				snapshot.Requests.ClientErrors += count
+			case "5":
+				snapshot.Requests.ServerErrors += count
+			}
+		}
+	}
+	return snapshot, nil
+}
+
+// gaugeValue returns the value of a family's single gauge, or 0 when the
+// family was not gathered, such as process metrics where the operating system
+// does not report them
+func gaugeValue(family *dto.MetricFamily) float64 {
+	if family == nil || len(family.GetMetric()) == 0 {
+		return 0
+	}
+	value := family.GetMetric()[0].GetGauge().GetValue()
+	if math.IsNaN(value) {
+		return 0
+	}
+	return value
+}
+
+// statusClass returns the first digit of a request metric's status label
+func statusClass(metric *dto.Metric) string {
+	for _, label := range metric.GetLabel() {
+		if label.GetName() == "status" && label.GetValue() != "" {
+			return label.GetValue()[:1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,178 @@
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+)
+
+// files holds a directory of numbered up scripts per dialect, applied in
+// name order, and a down directory with the script reverting each of them
+//
+//go:embed postgres sqlite
+var files embed.FS
+
+// placeholders is the first bind parameter in each dialect's syntax
+var placeholders = map[string]string{
+	"postgres": "$1",
+	"sqlite":   "?",
+}
+
+// ErrNoDown is returned when reverting a migration that has no down script
+var ErrNoDown = errors.New("migration has no down script")
+
+// Status reports whether a migration has been applied
+type Status struct {
+	Version string
+	Applied bool
+}
+
+// Migrator applies and reverts the embedded schema migrations of one SQL
+// dialect. Applied migrations are recorded by file name in the
+// schema_migrations table.
+type Migrator struct {
+	db          *sql.DB
+	dialect     string
+	placeholder string
+}
+
+// New creates a migrator for a database of the given dialect, "postgres" or
+// "sqlite"
+func New(db *sql.DB, dialect string) (*Migrator, error) {
+	placeholder, ok := placeholders[dialect]
+	if !ok {
+		return nil, fmt.Errorf("no migrations for %q databases", dialect)
+	}
+	return &Migrator{db: db, dialect: dialect, placeholder: placeholder}, nil
+}
+
+// Up applies every pending migration in order, each in its own
+// transaction, and returns the versions it applied
+func (m *Migrator) Up() ([]string, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []string
+	for _, status := range statuses {
+		if status.Applied {
+			continue
+		}
+		if err := m.run(status.Version, status.Version,
+			`INSERT INTO schema_migrations (version) VALUES (`+m.placeholder+`)`); err != nil {
+			return applied, fmt.Errorf("apply migration %s: %w", status.Version, err)
+		}
+		applied = append(applied, status.Version)
+	}
+	return applied, nil
+}
+
+// Down reverts the given number of most recently applied migrations, newest
+// first, or all of them when steps is negative, and returns the versions it
+// reverted
+func (m *Migrator) Down(steps int) ([]string, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []string
+	for _, status := range slices.Backward(statuses) {
+		if len(reverted) == steps {
+			break
+		}
+		if !status.Applied {
+			continue
+		}
+		if err := m.run("down/"+status.Version, status.Version,
+			`DELETE FROM schema_migrations WHERE version = `+m.placeholder); err != nil {
+			return reverted, fmt.Errorf("revert migration %s: %w", status.Version, err)
+		}
+		reverted = append(reverted, status.Version)
+	}
+	return reverted, nil
+}
+
+// Status lists every migration in order along with whether it was applied
+func (m *Migrator) Status() ([]Status, error) {
+	if _, err := m.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version TEXT PRIMARY KEY)`); err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	rows, err := m.db.Query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[string]bool{}
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	entries, err := fs.ReadDir(files, m.dialect)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []Status
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		statuses = append(statuses, Status{Version: entry.Name(), Applied: applied[entry.Name()]})
+	}
+	slices.SortFunc(statuses, func(a, b Status) int { return strings.Compare(a.Version, b.Version) })
+	return statuses, nil
+}
+
+// Pending returns the versions that have not been applied yet
+func (m *Migrator) Pending() ([]string, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, status := range statuses {
+		if !status.Applied {
+			pending = append(pending, status.Version)
+		}
+	}
+	return pending, nil
+}
+
+// run executes a script and records the change to schema_migrations in one
+// transaction
+func (m *Migrator) run(script, version, record string) error {
+	contents, err := files.ReadFile(m.dialect + "/" + script)
+	if errors.Is(err, fs.ErrNotExist) && strings.HasPrefix(script, "down/") {
+		return ErrNoDown
+	}
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(string(contents)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(record, version); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
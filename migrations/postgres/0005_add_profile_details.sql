@@ -0,0 +1,7 @@
+ALTER TABLE user_profiles ADD COLUMN email TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_profiles ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_profiles ADD COLUMN location TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_profiles ADD COLUMN updated_at TIMESTAMPTZ;
+UPDATE user_profiles SET updated_at = created_at;
+ALTER TABLE user_profiles ALTER COLUMN updated_at SET NOT NULL;
+ALTER TABLE user_profiles ALTER COLUMN updated_at SET DEFAULT now();
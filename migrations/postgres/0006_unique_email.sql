@@ -0,0 +1 @@
+CREATE UNIQUE INDEX user_profiles_email_key ON user_profiles (LOWER(email)) WHERE email <> '';
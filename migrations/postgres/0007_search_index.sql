@@ -0,0 +1 @@
+CREATE INDEX user_profiles_search ON user_profiles USING GIN (to_tsvector('simple', full_name || ' ' || bio));
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS event_outbox (
+    id          BIGSERIAL PRIMARY KEY,
+    topic       TEXT NOT NULL,
+    message_key TEXT NOT NULL,
+    payload     BYTEA NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1 @@
+ALTER TABLE user_profiles ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
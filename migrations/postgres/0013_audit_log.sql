@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+    id         BIGSERIAL PRIMARY KEY,
+    action     TEXT NOT NULL,
+    actor      TEXT NOT NULL,
+    user_id    TEXT NOT NULL,
+    version    INTEGER NOT NULL,
+    status     TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS audit_log_user_id ON audit_log (user_id, id);
@@ -0,0 +1,2 @@
+CREATE COLLATION IF NOT EXISTS unicode (provider = icu, locale = 'und');
+CREATE INDEX IF NOT EXISTS user_profiles_full_name ON user_profiles (full_name COLLATE unicode);
@@ -0,0 +1 @@
+ALTER TABLE audit_log ADD COLUMN snapshot TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE user_profiles ADD COLUMN expires_at TIMESTAMPTZ;
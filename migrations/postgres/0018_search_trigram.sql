@@ -0,0 +1,2 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX user_profiles_search_trigram ON user_profiles USING GIN (LOWER(full_name) gin_trgm_ops, LOWER(bio) gin_trgm_ops);
@@ -0,0 +1,4 @@
+ALTER TABLE user_profiles DROP COLUMN updated_at;
+ALTER TABLE user_profiles DROP COLUMN location;
+ALTER TABLE user_profiles DROP COLUMN bio;
+ALTER TABLE user_profiles DROP COLUMN email;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS user_profiles_full_name;
+DROP COLLATION IF EXISTS unicode;
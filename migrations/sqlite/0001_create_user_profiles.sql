@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS user_profiles (
+    id         TEXT PRIMARY KEY,
+    full_name  TEXT NOT NULL,
+    emoji      TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
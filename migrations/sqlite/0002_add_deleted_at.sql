@@ -0,0 +1 @@
+ALTER TABLE user_profiles ADD COLUMN deleted_at DATETIME;
@@ -0,0 +1 @@
+ALTER TABLE user_profiles ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
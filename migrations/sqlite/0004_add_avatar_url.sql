@@ -0,0 +1 @@
+ALTER TABLE user_profiles ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '';
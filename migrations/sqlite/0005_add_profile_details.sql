@@ -0,0 +1,5 @@
+ALTER TABLE user_profiles ADD COLUMN email TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_profiles ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_profiles ADD COLUMN location TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_profiles ADD COLUMN updated_at TEXT;
+UPDATE user_profiles SET updated_at = created_at;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS event_outbox (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    topic       TEXT NOT NULL,
+    message_key TEXT NOT NULL,
+    payload     BLOB NOT NULL,
+    created_at  TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
@@ -0,0 +1 @@
+ALTER TABLE user_profiles ADD COLUMN tags TEXT NOT NULL DEFAULT '';
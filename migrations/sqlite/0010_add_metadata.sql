@@ -0,0 +1 @@
+ALTER TABLE user_profiles ADD COLUMN metadata TEXT NOT NULL DEFAULT '';
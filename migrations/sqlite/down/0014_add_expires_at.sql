@@ -0,0 +1 @@
+ALTER TABLE user_profiles DROP COLUMN expires_at;
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Group is a named set of users, such as a team
+type Group struct {
+	// XMLName names the root element when the group is rendered as XML
+	XMLName     xml.Name `json:"-" yaml:"-" xml:"group"`
+	ID          string   `json:"id" xml:"id" yaml:"id" binding:"max=100"`
+	Name        string   `json:"name" xml:"name" yaml:"name" binding:"required,max=100"`
+	Description string   `json:"description,omitempty" xml:"description,omitempty" yaml:"description,omitempty" binding:"max=500"`
+	// CreatedAt and UpdatedAt are maintained by the repository
+	CreatedAt time.Time `json:"createdAt" xml:"createdAt" yaml:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" xml:"updatedAt" yaml:"updatedAt"`
+}
+
+// Membership is a user belonging to a group
+type Membership struct {
+	XMLName xml.Name  `json:"-" yaml:"-" xml:"membership"`
+	GroupID string    `json:"groupId" xml:"groupId" yaml:"groupId"`
+	UserID  string    `json:"userId" xml:"userId" yaml:"userId"`
+	AddedAt time.Time `json:"addedAt" xml:"addedAt" yaml:"addedAt"`
+}
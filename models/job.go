@@ -0,0 +1,41 @@
+package models
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// JobStatus is the state of a background job
+type JobStatus string
+
+// Job statuses. Jobs that succeed are removed, so only those still to run
+// and those that gave up are kept.
+const (
+	// JobPending jobs wait for their RunAt time and a free worker
+	JobPending JobStatus = "pending"
+	// JobRunning jobs are being run by a worker
+	JobRunning JobStatus = "running"
+	// JobFailed jobs failed on their last allowed attempt
+	JobFailed JobStatus = "failed"
+)
+
+// Job is a unit of background work, such as delivering a webhook, run by the
+// handler registered for its kind and retried until it succeeds or runs out
+// of attempts
+type Job struct {
+	// XMLName names the root element when the job is rendered as XML
+	XMLName xml.Name `json:"-" yaml:"-" xml:"job"`
+	ID      string   `json:"id" xml:"id" yaml:"id"`
+	Kind    string   `json:"kind" xml:"kind" yaml:"kind"`
+	// Payload holds the arguments of the job's handler
+	Payload     Metadata  `json:"payload,omitempty" xml:"payload,omitempty" yaml:"payload,omitempty"`
+	Status      JobStatus `json:"status" xml:"status" yaml:"status"`
+	Attempts    int       `json:"attempts" xml:"attempts" yaml:"attempts"`
+	MaxAttempts int       `json:"maxAttempts" xml:"maxAttempts" yaml:"maxAttempts"`
+	// LastError is the error of the last failed attempt
+	LastError string `json:"lastError,omitempty" xml:"lastError,omitempty" yaml:"lastError,omitempty"`
+	// RunAt is when the job is next due to run
+	RunAt     time.Time `json:"runAt" xml:"runAt" yaml:"runAt"`
+	CreatedAt time.Time `json:"createdAt" xml:"createdAt" yaml:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" xml:"updatedAt" yaml:"updatedAt"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// Metadata holds free-form attributes of a user as a JSON object. Values
+// take the form encoding/json decodes them to: strings, float64 numbers,
+// booleans, nil, []any and map[string]any.
+type Metadata map[string]any
+
+// Clone returns a deep copy of the metadata, converting the maps and numbers
+// other decoders produce, such as MessagePack's, to their JSON form. Empty
+// metadata is returned as nil.
+func (m Metadata) Clone() Metadata {
+	if len(m) == 0 {
+		return nil
+	}
+	return jsonValue(map[string]any(m)).(map[string]any)
+}
+
+// MarshalXML writes each attribute as an entry element holding its value as
+// JSON, in key order, since XML has no counterpart to JSON values
+func (m Metadata) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, key := range slices.Sorted(maps.Keys(m)) {
+		value, err := json.Marshal(m[key])
+		if err != nil {
+			return err
+		}
+		entry := xml.StartElement{
+			Name: xml.Name{Local: "entry"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: key}},
+		}
+		if err := e.EncodeElement(string(value), entry); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// jsonValue returns a copy of v in the form encoding/json decodes JSON to
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[key] = jsonValue(value)
+		}
+		return m
+	case Metadata:
+		return jsonValue(map[string]any(v))
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, value := range v {
+			s[i] = jsonValue(value)
+		}
+		return s
+	case []byte:
+		return string(v)
+	case nil, string, bool, float64:
+		return v
+	}
+
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.CanInt():
+		return float64(rv.Int())
+	case rv.CanUint():
+		return float64(rv.Uint())
+	case rv.CanFloat():
+		return rv.Float()
+	}
+	return v
+}
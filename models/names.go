@@ -0,0 +1,35 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/text/unicode/norm"
+)
+
+func init() {
+	// Register the nocontrol binding tag with the validator shared by gin,
+	// the gRPC API and the command-line tools
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterValidation("nocontrol", func(fl validator.FieldLevel) bool {
+			return ValidName(fl.Field().String())
+		})
+	}
+}
+
+// ValidName reports whether name is valid UTF-8 without control characters,
+// such as line breaks, tabs or escape sequences, which have no place in a
+// name and would garble the pages, logs and terminals showing it
+func ValidName(name string) bool {
+	return utf8.ValidString(name) && !strings.ContainsFunc(name, unicode.IsControl)
+}
+
+// NormalizeName returns name in Unicode Normalization Form C, so that names
+// typed with precomposed letters or with combining marks are stored, found
+// and sorted alike
+func NormalizeName(name string) string {
+	return norm.NFC.String(name)
+}
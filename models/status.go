@@ -0,0 +1,44 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Status is where a user is in its lifecycle. Users start active; the
+// lifecycle package moves them between statuses.
+type Status string
+
+const (
+	// StatusActive users are in normal use
+	StatusActive Status = "active"
+	// StatusSuspended users are kept from use for a while
+	StatusSuspended Status = "suspended"
+	// StatusArchived users are no longer in use and are left out of lists
+	// unless asked for
+	StatusArchived Status = "archived"
+)
+
+// Statuses lists every status
+var Statuses = []Status{StatusActive, StatusSuspended, StatusArchived}
+
+// ListedStatuses are the statuses of the users lists show unless asked for
+// others
+var ListedStatuses = []Status{StatusActive, StatusSuspended}
+
+// ParseStatuses parses a comma-separated list of statuses such as
+// "active,suspended"
+func ParseStatuses(expr string) ([]Status, error) {
+	var statuses []Status
+	for _, part := range strings.Split(expr, ",") {
+		status := Status(strings.ToLower(strings.TrimSpace(part)))
+		if !slices.Contains(Statuses, status) {
+			return nil, fmt.Errorf("unknown status %q: allowed statuses are active, suspended and archived", part)
+		}
+		if !slices.Contains(statuses, status) {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// MaxTags is the most tags a user can have, and MaxTagLength the longest tag
+// in characters
+const (
+	MaxTags      = 10
+	MaxTagLength = 30
+)
+
+// tagPattern keeps tags to lower-case letters, digits, hyphens and
+// underscores, so they can be used in URLs and joined with commas
+var tagPattern = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{N}][\p{Ll}\p{Lo}\p{N}_-]*$`)
+
+func init() {
+	// Register the tag binding tag with the validator shared by gin, the
+	// gRPC API and the command-line tools
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		// Tags are validated in the form they are stored in, so case and
+		// surrounding spaces are not held against them
+		v.RegisterValidation("tag", func(fl validator.FieldLevel) bool {
+			return ValidTag(NormalizeTag(fl.Field().String()))
+		})
+	}
+}
+
+// ValidTag reports whether tag is a normalized tag of at most MaxTagLength
+// characters
+func ValidTag(tag string) bool {
+	return utf8.RuneCountInString(tag) <= MaxTagLength && tagPattern.MatchString(tag)
+}
+
+// NormalizeTag returns the canonical form of a tag: trimmed and lower-cased
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// normalizeTags normalizes each tag and drops repeated ones, keeping the
+// first, and returns nil when there are no tags
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
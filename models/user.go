@@ -1,8 +1,82 @@
 package models
 
-// UserProfile represents user profile data
+import (
+	"encoding/xml"
+	"slices"
+	"time"
+
+	"userprofile-api/emoji"
+)
+
+// UserProfile represents user profile data. Email, Bio, Location, Tags,
+// Metadata and ExpiresAt are optional so payloads written before they existed remain valid.
 type UserProfile struct {
-	ID       string `json:"id"`
-	FullName string `json:"fullName"`
-	Emoji    string `json:"emoji"`
+	// XMLName names the root element when the profile is rendered as XML
+	XMLName  xml.Name `json:"-" yaml:"-" xml:"user"`
+	ID       string   `json:"id" xml:"id" yaml:"id"`
+	FullName string   `json:"fullName" xml:"fullName" yaml:"fullName" binding:"nocontrol"`
+	Emoji    string   `json:"emoji" xml:"emoji" yaml:"emoji" binding:"omitempty,emoji"`
+	Email    string   `json:"email,omitempty" xml:"email,omitempty" yaml:"email,omitempty" binding:"omitempty,email,max=254"`
+	Bio      string   `json:"bio,omitempty" xml:"bio,omitempty" yaml:"bio,omitempty" binding:"max=500"`
+	Location string   `json:"location,omitempty" xml:"location,omitempty" yaml:"location,omitempty" binding:"max=100"`
+	// Tags categorize the user; see ValidTag for their form
+	Tags []string `json:"tags,omitempty" xml:"tags>tag,omitempty" yaml:"tags,omitempty" binding:"max=10,dive,tag"`
+	// Metadata holds free-form attributes, checked against the metadata
+	// schema when one is configured
+	Metadata Metadata `json:"metadata,omitempty" xml:"metadata,omitempty" yaml:"metadata,omitempty"`
+	// Status is changed through the lifecycle package only; updates that
+	// leave it empty keep the stored status
+	Status Status `json:"status,omitempty" xml:"status,omitempty" yaml:"status,omitempty"`
+	// AvatarURL locates the user's uploaded avatar, if any
+	AvatarURL string `json:"avatarUrl,omitempty" xml:"avatarUrl,omitempty" yaml:"avatarUrl,omitempty"`
+	// Version increases with every update and is exposed as the ETag
+	Version int `json:"version" xml:"version" yaml:"version"`
+	// CreatedAt and UpdatedAt are maintained by the repository
+	CreatedAt time.Time `json:"createdAt" xml:"createdAt" yaml:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" xml:"updatedAt" yaml:"updatedAt"`
+	// DeletedAt is set when the profile has been soft-deleted
+	DeletedAt *time.Time `json:"deletedAt,omitempty" xml:"deletedAt,omitempty" yaml:"deletedAt,omitempty"`
+	// ExpiresAt, when set, is when the profile is soft-deleted by the expiry
+	// janitor
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" xml:"expiresAt,omitempty" yaml:"expiresAt,omitempty"`
+}
+
+// Normalize puts the fields clients supply in canonical form, so equal
+// values are stored alike: the full name takes Unicode Normalization Form C,
+// the emoji its fully-qualified form, tags are lower-cased without repeats,
+// metadata takes its JSON form and the expiry time is in UTC. Values that
+// cannot be normalized are left for validation to reject.
+func (u *UserProfile) Normalize() {
+	u.FullName = NormalizeName(u.FullName)
+	if normalized, err := emoji.Normalize(u.Emoji); err == nil {
+		u.Emoji = normalized
+	}
+	u.Tags = normalizeTags(u.Tags)
+	u.Metadata = u.Metadata.Clone()
+	if u.ExpiresAt != nil {
+		expiresAt := u.ExpiresAt.UTC()
+		u.ExpiresAt = &expiresAt
+	}
+}
+
+// Expired reports whether the profile has an expiry time that is not after
+// now
+func (u UserProfile) Expired(now time.Time) bool {
+	return u.ExpiresAt != nil && !u.ExpiresAt.After(now)
+}
+
+// Clone returns a copy of the profile that shares no memory with it, so
+// changes to either do not show in the other
+func (u UserProfile) Clone() UserProfile {
+	if u.DeletedAt != nil {
+		deletedAt := *u.DeletedAt
+		u.DeletedAt = &deletedAt
+	}
+	if u.ExpiresAt != nil {
+		expiresAt := *u.ExpiresAt
+		u.ExpiresAt = &expiresAt
+	}
+	u.Tags = slices.Clone(u.Tags)
+	u.Metadata = u.Metadata.Clone()
+	return u
 }
@@ -0,0 +1,121 @@
+// Package moderation checks the free text of user profiles, their full names
+// and bios, before they are saved. A Moderator allows the content, flags it
+// for review, or rejects it. The built-in moderators block words from a list
+// and ask an external moderation service; New combines those configured.
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"userprofile-api/config"
+)
+
+// Verdict is a moderator's decision on content
+type Verdict string
+
+// Verdicts, from the mildest to the strictest
+const (
+	Allow  Verdict = "allow"
+	Flag   Verdict = config.ModerationFlag
+	Reject Verdict = config.ModerationReject
+)
+
+// severity orders the verdicts, so the strictest of several wins
+var severity = map[Verdict]int{Allow: 0, Flag: 1, Reject: 2}
+
+// Content is the text of a user profile that is moderated
+type Content struct {
+	FullName string `json:"fullName"`
+	Bio      string `json:"bio"`
+}
+
+// Decision is a moderator's verdict on content. Flagged and rejected content
+// names the offending field, fullName or bio, and says why.
+type Decision struct {
+	Verdict Verdict `json:"verdict"`
+	Field   string  `json:"field,omitempty"`
+	Reason  string  `json:"reason,omitempty"`
+}
+
+// Moderator decides whether content may be saved. Errors mean no decision
+// could be made.
+type Moderator interface {
+	Moderate(ctx context.Context, content Content) (Decision, error)
+}
+
+// RejectedError is the error of a change whose content a moderator rejected
+type RejectedError struct {
+	Field  string
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("%s was rejected by moderation: %s", e.Field, e.Reason)
+}
+
+// Chain asks each of its moderators in turn, stopping at the first that
+// rejects the content, and returns the strictest decision
+type Chain []Moderator
+
+// Moderate implements Moderator
+func (c Chain) Moderate(ctx context.Context, content Content) (Decision, error) {
+	decision := Decision{Verdict: Allow}
+	for _, moderator := range c {
+		next, err := moderator.Moderate(ctx, content)
+		if err != nil {
+			return Decision{}, err
+		}
+		if severity[next.Verdict] > severity[decision.Verdict] {
+			decision = next
+		}
+		if decision.Verdict == Reject {
+			break
+		}
+	}
+	return decision, nil
+}
+
+// failOpen allows the content its moderator could not decide on
+type failOpen struct {
+	next   Moderator
+	logger *slog.Logger
+}
+
+func (f failOpen) Moderate(ctx context.Context, content Content) (Decision, error) {
+	decision, err := f.next.Moderate(ctx, content)
+	if err != nil {
+		f.logger.WarnContext(ctx, "Moderation failed; allowing the content", "error", err)
+		return Decision{Verdict: Allow}, nil
+	}
+	return decision, nil
+}
+
+// New returns the moderator configured by cfg: the wordlist, then the
+// external service. It returns nil when no moderation is configured.
+func New(cfg config.ModerationConfig, logger *slog.Logger) (Moderator, error) {
+	var chain Chain
+	if cfg.WordlistFile != "" {
+		wordlist, err := LoadWordlist(cfg.WordlistFile, Verdict(cfg.WordlistAction))
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, wordlist)
+	}
+	if cfg.URL != "" {
+		var service Moderator = NewService(cfg.URL, cfg.Timeout)
+		if cfg.FailOpen {
+			service = failOpen{next: service, logger: logger}
+		}
+		chain = append(chain, service)
+	}
+	switch len(chain) {
+	case 0:
+		return nil, nil
+	case 1:
+		return chain[0], nil
+	default:
+		return chain, nil
+	}
+}
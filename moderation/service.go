@@ -0,0 +1,70 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxResponseBytes bounds the decisions read from a moderation service
+const maxResponseBytes = 64 << 10
+
+// Service asks an external moderation service for its decision. The content
+// is posted to its URL as a JSON object with fullName and bio members, and the
+// service answers 200 with a JSON decision:
+//
+//	{"verdict": "reject", "field": "bio", "reason": "harassment"}
+//
+// where verdict is allow, flag or reject.
+type Service struct {
+	url    string
+	client *http.Client
+}
+
+// NewService creates a moderator asking the service at url, giving up on
+// calls that take longer than timeout
+func NewService(url string, timeout time.Duration) *Service {
+	return &Service{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+// Moderate implements Moderator
+func (s *Service) Moderate(ctx context.Context, content Content) (Decision, error) {
+	body, err := json.Marshal(content)
+	if err != nil {
+		return Decision{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return Decision{}, fmt.Errorf("moderation service: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+		return Decision{}, fmt.Errorf("moderation service answered %s", resp.Status)
+	}
+
+	var decision Decision
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&decision); err != nil {
+		return Decision{}, fmt.Errorf("moderation service: invalid decision: %w", err)
+	}
+	if _, ok := severity[decision.Verdict]; !ok {
+		return Decision{}, fmt.Errorf("moderation service: unknown verdict %q", decision.Verdict)
+	}
+	if decision.Verdict != Allow && decision.Field != "fullName" && decision.Field != "bio" {
+		// Decisions that do not say which field they are about concern the
+		// profile as a whole, shown against its name
+		decision.Field = "fullName"
+	}
+	return decision, nil
+}
@@ -0,0 +1,77 @@
+package moderation
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Wordlist gives its verdict on content holding any of its words. Words are
+// matched whole, ignoring case and Unicode normalization, so "ass" does not
+// block "Cassandra".
+type Wordlist struct {
+	words   map[string]bool
+	verdict Verdict
+}
+
+// NewWordlist creates a moderator giving verdict on content holding any of
+// words
+func NewWordlist(words []string, verdict Verdict) *Wordlist {
+	w := &Wordlist{words: make(map[string]bool, len(words)), verdict: verdict}
+	for _, word := range words {
+		if word = normalizeWord(strings.TrimSpace(word)); word != "" {
+			w.words[word] = true
+		}
+	}
+	return w
+}
+
+// LoadWordlist reads the words of a wordlist from a file holding one per
+// line. Blank lines and lines starting with # are skipped.
+func LoadWordlist(path string, verdict Verdict) (*Wordlist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the moderation wordlist: %w", err)
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the moderation wordlist: %w", err)
+	}
+	return NewWordlist(words, verdict), nil
+}
+
+// Moderate implements Moderator
+func (w *Wordlist) Moderate(_ context.Context, content Content) (Decision, error) {
+	for _, field := range []struct{ name, text string }{{"fullName", content.FullName}, {"bio", content.Bio}} {
+		for _, word := range strings.FieldsFunc(field.text, notWordRune) {
+			if w.words[normalizeWord(word)] {
+				return Decision{Verdict: w.verdict, Field: field.name, Reason: fmt.Sprintf("contains the blocked word %q", word)}, nil
+			}
+		}
+	}
+	return Decision{Verdict: Allow}, nil
+}
+
+// notWordRune splits text into words of letters, digits and their combining
+// marks
+func notWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r)
+}
+
+// normalizeWord returns the form words are compared in
+func normalizeWord(word string) string {
+	return strings.ToLower(norm.NFC.String(word))
+}
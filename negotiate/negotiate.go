@@ -0,0 +1,122 @@
+package negotiate
+
+import (
+	"encoding/xml"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/ugorji/go/codec"
+	"userprofile-api/jsonapi"
+)
+
+// offered lists the response formats in order of preference; JSON comes
+// first so clients that send no Accept header, or */*, get JSON
+var offered = []string{
+	binding.MIMEJSON,
+	binding.MIMEXML,
+	binding.MIMEXML2,
+	binding.MIMEYAML,
+	binding.MIMEYAML2,
+	binding.MIMEMSGPACK,
+	binding.MIMEMSGPACK2,
+}
+
+// Render writes body in the format the Accept header asks for: XML, YAML,
+// MessagePack, or JSON otherwise. Media types the API does not offer, such as HAL, are
+// answered with JSON rather than 406 so existing clients keep working.
+func Render(c *gin.Context, status int, body any) {
+	VaryAccept(c.Writer.Header())
+	switch c.NegotiateFormat(offered...) {
+	case binding.MIMEXML, binding.MIMEXML2:
+		c.XML(status, xmlDocument(body))
+	case binding.MIMEYAML, binding.MIMEYAML2:
+		c.YAML(status, body)
+	case binding.MIMEMSGPACK, binding.MIMEMSGPACK2:
+		c.Render(status, msgpack{data: body})
+	default:
+		c.JSON(status, body)
+	}
+}
+
+// NDJSONContentType is the media type of collections streamed as
+// newline-delimited JSON, one item per line
+const NDJSONContentType = "application/x-ndjson"
+
+// AcceptsNDJSON reports whether the Accept header asks for NDJSON before
+// any format Render offers
+func AcceptsNDJSON(c *gin.Context) bool {
+	return c.NegotiateFormat(append(slices.Clone(offered), NDJSONContentType)...) == NDJSONContentType
+}
+
+// Bind decodes the request body into obj as MessagePack or a JSON:API
+// resource document when the Content-Type says so, and as JSON otherwise.
+// MessagePack maps and the resource's attributes use the same keys as the
+// JSON representation.
+func Bind(c *gin.Context, obj any) error {
+	switch c.ContentType() {
+	case binding.MIMEMSGPACK, binding.MIMEMSGPACK2:
+		return c.ShouldBindWith(obj, binding.MsgPack)
+	case jsonapi.ContentType:
+		body, err := jsonapi.Attributes(c.Request.Body)
+		if err != nil {
+			return err
+		}
+		return binding.JSON.BindBody(body, obj)
+	default:
+		return c.ShouldBindJSON(obj)
+	}
+}
+
+// list is the root element of collections rendered as XML, which unlike
+// JSON needs a single root. Items take the element name of their type, such
+// as user, or item when the type does not name one.
+type list struct {
+	XMLName xml.Name `xml:"list"`
+	Items   any      `xml:"item"`
+}
+
+func xmlDocument(body any) any {
+	if v := reflect.ValueOf(body); v.Kind() == reflect.Slice {
+		return list{Items: body}
+	}
+	return body
+}
+
+// VaryAccept marks the response as depending on the Accept header, unless
+// earlier middleware already did
+func VaryAccept(h http.Header) {
+	for _, value := range h.Values("Vary") {
+		if slices.ContainsFunc(strings.Split(value, ","), func(name string) bool {
+			return strings.EqualFold(strings.TrimSpace(name), "Accept")
+		}) {
+			return
+		}
+	}
+	h.Add("Vary", "Accept")
+}
+
+// MsgpackContentType is the media type of MessagePack responses
+const MsgpackContentType = binding.MIMEMSGPACK2
+
+// msgpackHandle writes times as the standard timestamp extension and strings
+// as the str types, which gin's default handle does not, so any MessagePack
+// library can decode responses
+var msgpackHandle = &codec.MsgpackHandle{WriteExt: true}
+
+// msgpack renders a body as MessagePack, with the same keys as its JSON form
+type msgpack struct {
+	data any
+}
+
+func (r msgpack) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return codec.NewEncoder(w, msgpackHandle).Encode(r.data)
+}
+
+func (r msgpack) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", MsgpackContentType)
+}
@@ -0,0 +1,144 @@
+package negotiate_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/ugorji/go/codec"
+	"gopkg.in/yaml.v3"
+	"userprofile-api/models"
+	"userprofile-api/negotiate"
+	"userprofile-api/seed"
+)
+
+// formats are the media types compared, MessagePack against the default
+var formats = []struct {
+	name      string
+	mediaType string
+}{
+	{"json", binding.MIMEJSON},
+	{"msgpack", negotiate.MsgpackContentType},
+}
+
+// TestRenderFormats checks that each format Render offers is answered with
+// its media type and a body that decodes back to the users rendered
+func TestRenderFormats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := seed.Generate(2, rand.New(rand.NewPCG(1, 2)))
+
+	// xmlList is the root element XML collections are wrapped in
+	type xmlList struct {
+		Users []models.UserProfile `xml:"user"`
+	}
+	tests := []struct {
+		accept      string
+		contentType string
+		decode      func(body []byte) ([]models.UserProfile, error)
+	}{
+		{"application/json", binding.MIMEJSON, func(body []byte) (decoded []models.UserProfile, err error) {
+			return decoded, json.Unmarshal(body, &decoded)
+		}},
+		{"application/xml", binding.MIMEXML, func(body []byte) ([]models.UserProfile, error) {
+			var list xmlList
+			err := xml.Unmarshal(body, &list)
+			return list.Users, err
+		}},
+		{"text/xml", binding.MIMEXML, func(body []byte) ([]models.UserProfile, error) {
+			var list xmlList
+			err := xml.Unmarshal(body, &list)
+			return list.Users, err
+		}},
+		{"application/yaml", binding.MIMEYAML2, func(body []byte) (decoded []models.UserProfile, err error) {
+			return decoded, yaml.Unmarshal(body, &decoded)
+		}},
+		{"application/msgpack", negotiate.MsgpackContentType, func(body []byte) (decoded []models.UserProfile, err error) {
+			return decoded, codec.NewDecoderBytes(body, &codec.MsgpackHandle{}).Decode(&decoded)
+		}},
+		{"application/hal+json", binding.MIMEJSON, func(body []byte) (decoded []models.UserProfile, err error) {
+			return decoded, json.Unmarshal(body, &decoded)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+			c.Request.Header.Set("Accept", tt.accept)
+			negotiate.Render(c, http.StatusOK, users)
+
+			if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, tt.contentType) {
+				t.Errorf("Content-Type %q, want %s", contentType, tt.contentType)
+			}
+			decoded, err := tt.decode(rec.Body.Bytes())
+			if err != nil {
+				t.Fatalf("decode: %v: %s", err, rec.Body)
+			}
+			if len(decoded) != len(users) {
+				t.Fatalf("decoded %d users, want %d", len(decoded), len(users))
+			}
+			for i, user := range decoded {
+				if user.ID != users[i].ID || user.FullName != users[i].FullName || user.Email != users[i].Email {
+					t.Errorf("user %d decoded as %s %q <%s>, want %s %q <%s>", i, user.ID, user.FullName, user.Email,
+						users[i].ID, users[i].FullName, users[i].Email)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRender compares the time to render a page of users as JSON and as
+// MessagePack, and the size of the responses, reported as bytes/response
+func BenchmarkRender(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+	users := seed.Generate(100, rand.New(rand.NewPCG(1, 2)))
+	for _, format := range formats {
+		b.Run(format.name, func(b *testing.B) {
+			var size int
+			for b.Loop() {
+				rec := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(rec)
+				c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+				c.Request.Header.Set("Accept", format.mediaType)
+				negotiate.Render(c, http.StatusOK, users)
+				size = rec.Body.Len()
+			}
+			b.ReportMetric(float64(size), "bytes/response")
+		})
+	}
+}
+
+// BenchmarkBind compares the time to decode a user request body sent as JSON
+// and as MessagePack
+func BenchmarkBind(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+	user := seed.Generate(1, rand.New(rand.NewPCG(1, 2)))[0]
+	for _, format := range formats {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/users/"+user.ID, nil)
+		c.Request.Header.Set("Accept", format.mediaType)
+		negotiate.Render(c, http.StatusOK, user)
+		body := rec.Body.Bytes()
+
+		b.Run(format.name, func(b *testing.B) {
+			for b.Loop() {
+				c, _ := gin.CreateTestContext(httptest.NewRecorder())
+				c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/users", bytes.NewReader(body))
+				c.Request.Header.Set("Content-Type", format.mediaType)
+				var decoded models.UserProfile
+				if err := negotiate.Bind(c, &decoded); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(body)), "bytes/request")
+		})
+	}
+}
@@ -0,0 +1,24 @@
+// Package profiling serves the net/http/pprof endpoints, from which CPU and
+// heap profiles, goroutine dumps and execution traces of the running server
+// can be captured with go tool pprof.
+package profiling
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// Prefix is the path the endpoints are served under
+const Prefix = "/debug/pprof/"
+
+// Handler serves the profiling endpoints under Prefix
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	// Index also serves the named profiles, such as heap and goroutine
+	mux.HandleFunc(Prefix, pprof.Index)
+	mux.HandleFunc(Prefix+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(Prefix+"profile", pprof.Profile)
+	mux.HandleFunc(Prefix+"symbol", pprof.Symbol)
+	mux.HandleFunc(Prefix+"trace", pprof.Trace)
+	return mux
+}
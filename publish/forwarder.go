@@ -0,0 +1,109 @@
+package publish
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"userprofile-api/config"
+	"userprofile-api/events"
+	"userprofile-api/repository"
+)
+
+const (
+	forwardQueueSize   = 1024
+	forwardMaxAttempts = 5
+	forwardBackoff     = time.Second
+)
+
+// Forwarder publishes the events of the bus for backends without an
+// outbox. Events are published in order from a queue in the background,
+// and are lost when the queue is full, the broker stays unreachable or the
+// server stops before they are sent.
+type Forwarder struct {
+	publisher Publisher
+	cfg       config.PublishConfig
+	logger    *slog.Logger
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan repository.OutboxMessage
+	done   chan struct{}
+}
+
+// NewForwarder starts the goroutine publishing queued events
+func NewForwarder(publisher Publisher, cfg config.PublishConfig, logger *slog.Logger) *Forwarder {
+	f := &Forwarder{
+		publisher: publisher,
+		cfg:       cfg,
+		logger:    logger,
+		queue:     make(chan repository.OutboxMessage, forwardQueueSize),
+		done:      make(chan struct{}),
+	}
+	go f.work()
+	return f
+}
+
+// Handle queues the event for publishing. It is an events.Handler and never
+// blocks.
+func (f *Forwarder) Handle(e events.Event) {
+	message, err := Encode(f.cfg.BrokerConfig, e)
+	if err != nil {
+		f.logger.Error("event encoding failed", "event", e.Type, "error", err)
+		return
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.closed {
+		return
+	}
+	select {
+	case f.queue <- message:
+	default:
+		f.logger.Warn("event publishing queue full; dropping event", "event", e.Type, "id", e.ID)
+	}
+}
+
+func (f *Forwarder) work() {
+	defer close(f.done)
+	for message := range f.queue {
+		f.publish(message)
+	}
+}
+
+// publish sends a message, retrying with a growing delay before giving up
+func (f *Forwarder) publish(message repository.OutboxMessage) {
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), f.cfg.Timeout)
+		err := f.publisher.Publish(ctx, []repository.OutboxMessage{message})
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt == forwardMaxAttempts {
+			f.logger.Error("publishing event failed; giving up", "topic", message.Topic, "key", message.Key, "error", err)
+			return
+		}
+		f.logger.Warn("publishing event failed; retrying", "topic", message.Topic, "attempt", attempt, "error", err)
+		time.Sleep(forwardBackoff << (attempt - 1))
+	}
+}
+
+// Close stops accepting events and waits for queued ones to be published
+func (f *Forwarder) Close(ctx context.Context) error {
+	f.mu.Lock()
+	if !f.closed {
+		f.closed = true
+		close(f.queue)
+	}
+	f.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
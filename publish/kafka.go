@@ -0,0 +1,158 @@
+package publish
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"userprofile-api/config"
+	"userprofile-api/events"
+	"userprofile-api/repository"
+)
+
+// kafkaBatchTimeout is how long the writer waits for more messages before
+// sending a batch smaller than its size. Publish waits for every message it
+// is given to be written, so there is nothing to wait for.
+const kafkaBatchTimeout = 10 * time.Millisecond
+
+// kafkaBrokers holds where and how to reach a Kafka cluster, from a
+// kafka:// or kafkas:// URL listing its bootstrap brokers
+type kafkaBrokers struct {
+	addrs []string
+	// tls is set for kafkas:// URLs
+	tls *tls.Config
+	// mechanism authenticates with SASL/PLAIN when the URL has credentials
+	mechanism sasl.Mechanism
+}
+
+func parseKafkaBrokers(raw string) (kafkaBrokers, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return kafkaBrokers{}, err
+	}
+	var brokers kafkaBrokers
+	for _, addr := range strings.Split(u.Host, ",") {
+		if !strings.Contains(addr, ":") {
+			addr += ":9092"
+		}
+		brokers.addrs = append(brokers.addrs, addr)
+	}
+	if u.Scheme == config.KafkaSecureScheme {
+		brokers.tls = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		brokers.mechanism = plain.Mechanism{Username: u.User.Username(), Password: password}
+	}
+	return brokers, nil
+}
+
+// kafkaPublisher produces records to Kafka, keyed by user ID so the events
+// of a user stay in order on one partition
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func newKafkaPublisher(cfg config.BrokerConfig) (*kafkaPublisher, error) {
+	brokers, err := parseKafkaBrokers(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaPublisher{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers.addrs...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: kafkaBatchTimeout,
+		WriteTimeout: cfg.Timeout,
+		ReadTimeout:  cfg.Timeout,
+		Transport: &kafka.Transport{
+			DialTimeout: cfg.Timeout,
+			TLS:         brokers.tls,
+			SASL:        brokers.mechanism,
+		},
+	}}, nil
+}
+
+// Publish produces the messages, each to its own topic, and waits until
+// every replica of their partitions has them
+func (p *kafkaPublisher) Publish(ctx context.Context, messages []repository.OutboxMessage) error {
+	records := make([]kafka.Message, len(messages))
+	for i, m := range messages {
+		records[i] = kafka.Message{Topic: m.Topic, Key: []byte(m.Key), Value: m.Payload}
+	}
+	if err := p.writer.WriteMessages(ctx, records...); err != nil {
+		return fmt.Errorf("produce to Kafka: %w", err)
+	}
+	return nil
+}
+
+// Close flushes pending writes and closes the connections to the brokers
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
+
+// kafkaSubscriber consumes the records of a topic as a member of a consumer
+// group, committing their offsets once they have been handled, so a
+// subscriber that reconnects resumes where its group left off
+type kafkaSubscriber struct {
+	cfg kafka.ReaderConfig
+}
+
+func newKafkaSubscriber(cfg config.BrokerConfig, group string) (*kafkaSubscriber, error) {
+	brokers, err := parseKafkaBrokers(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	// A {type} topic stands for the topic of every event type
+	topics := []string{cfg.Topic}
+	if strings.Contains(cfg.Topic, "{type}") {
+		topics = topics[:0]
+		for _, t := range events.Types {
+			topics = append(topics, strings.ReplaceAll(cfg.Topic, "{type}", t))
+		}
+	}
+	return &kafkaSubscriber{cfg: kafka.ReaderConfig{
+		Brokers:     brokers.addrs,
+		GroupID:     group,
+		GroupTopics: topics,
+		StartOffset: kafka.FirstOffset,
+		Dialer: &kafka.Dialer{
+			Timeout:       cfg.Timeout,
+			DualStack:     true,
+			TLS:           brokers.tls,
+			SASLMechanism: brokers.mechanism,
+		},
+	}}, nil
+}
+
+// Subscribe joins the group, passes each record it fetches to handle and
+// commits its offset, until ctx is done or fetching or committing fails.
+// The group is left on return.
+func (s *kafkaSubscriber) Subscribe(ctx context.Context, handle func(payload []byte)) error {
+	reader := kafka.NewReader(s.cfg)
+	defer reader.Close()
+
+	for {
+		record, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("fetch from Kafka: %w", err)
+		}
+		handle(record.Value)
+		if err := reader.CommitMessages(ctx, record); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("commit Kafka consumer offsets: %w", err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package publish
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"userprofile-api/config"
+	"userprofile-api/repository"
+)
+
+// connectNATS connects to the server at the URL, which may carry a user and
+// password or a token. Lost connections are not reestablished by the
+// client: callers connect again, so their errors and retries stay their own.
+func connectNATS(rawURL string, timeout time.Duration) (*nats.Conn, error) {
+	return nats.Connect(rawURL, nats.Name("userprofile-api"), nats.Timeout(timeout), nats.NoReconnect())
+}
+
+// natsPublisher publishes to a NATS server. A flush after the messages
+// confirms the server received them; whether anyone was subscribed is not
+// known. Messages are published over one connection at a time, which is
+// opened again after an error.
+type natsPublisher struct {
+	url     string
+	timeout time.Duration
+
+	mu   sync.Mutex
+	conn *nats.Conn
+}
+
+func newNATSPublisher(cfg config.BrokerConfig) (*natsPublisher, error) {
+	return &natsPublisher{url: cfg.URL, timeout: cfg.Timeout}, nil
+}
+
+// Publish sends the messages and flushes them, waiting for the server to
+// answer
+func (p *natsPublisher) Publish(ctx context.Context, messages []repository.OutboxMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		conn, err := connectNATS(p.url, p.timeout)
+		if err != nil {
+			return fmt.Errorf("connect to NATS: %w", err)
+		}
+		p.conn = conn
+	}
+	if err := p.publish(ctx, messages); err != nil {
+		p.conn.Close()
+		p.conn = nil
+		return fmt.Errorf("publish to NATS: %w", err)
+	}
+	return nil
+}
+
+func (p *natsPublisher) publish(ctx context.Context, messages []repository.OutboxMessage) error {
+	for _, m := range messages {
+		if err := p.conn.Publish(m.Topic, m.Payload); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return p.conn.FlushWithContext(ctx)
+}
+
+// Close closes the connection to the server, if any
+func (p *natsPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+	return nil
+}
+
+// natsSubscriber receives the messages published to a subject. Core NATS
+// keeps no messages, so those published while it is disconnected are missed.
+type natsSubscriber struct {
+	url     string
+	subject string
+	timeout time.Duration
+}
+
+func newNATSSubscriber(cfg config.BrokerConfig) (*natsSubscriber, error) {
+	// Every event type starts with "user.", so one wildcard token covers
+	// the rest
+	subject := strings.ReplaceAll(cfg.Topic, "{type}", "user.*")
+	return &natsSubscriber{url: cfg.URL, subject: subject, timeout: cfg.Timeout}, nil
+}
+
+// Subscribe subscribes to the subject and passes each message to handle
+// until ctx is done or the connection fails
+func (s *natsSubscriber) Subscribe(ctx context.Context, handle func(payload []byte)) error {
+	conn, err := connectNATS(s.url, s.timeout)
+	if err != nil {
+		return fmt.Errorf("connect to NATS: %w", err)
+	}
+	defer conn.Close()
+
+	sub, err := conn.SubscribeSync(s.subject)
+	if err != nil {
+		return fmt.Errorf("subscribe to NATS: %w", err)
+	}
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("receive from NATS: %w", err)
+		}
+		handle(msg.Data)
+	}
+}
@@ -0,0 +1,141 @@
+// Package publish sends user change events to a message broker, Kafka or
+// NATS, and receives them from it. SQL backends record each event in an outbox table in the same
+// transaction as the change, and a Relay publishes them from there, so an
+// event is published for every committed change even when the broker or the
+// server was down at the time. Other backends publish the events of the bus
+// through a Forwarder on a best-effort basis.
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"userprofile-api/config"
+	"userprofile-api/events"
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+// Publisher sends messages to a broker
+type Publisher interface {
+	// Publish sends the messages in order, returning once the broker has
+	// accepted all of them. After an error some of them may have been
+	// published.
+	Publish(ctx context.Context, messages []repository.OutboxMessage) error
+	Close() error
+}
+
+// Open creates the publisher for the configured broker
+func Open(cfg config.BrokerConfig) (Publisher, error) {
+	switch cfg.Broker {
+	case config.BrokerKafka:
+		return newKafkaPublisher(cfg)
+	case config.BrokerNATS:
+		return newNATSPublisher(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported broker %q", cfg.Broker)
+	}
+}
+
+// Subscriber receives the messages published to a broker
+type Subscriber interface {
+	// Subscribe passes the payload of each message on the topic to handle,
+	// in order, until ctx is done or the connection to the broker fails
+	Subscribe(ctx context.Context, handle func(payload []byte)) error
+}
+
+// OpenSubscriber creates the subscriber for the configured broker. Kafka
+// subscribers consume as members of the given consumer group.
+func OpenSubscriber(cfg config.BrokerConfig, group string) (Subscriber, error) {
+	switch cfg.Broker {
+	case config.BrokerKafka:
+		return newKafkaSubscriber(cfg, group)
+	case config.BrokerNATS:
+		return newNATSSubscriber(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported broker %q", cfg.Broker)
+	}
+}
+
+// Encoder returns the outbox encoder serializing the changes to a tenant's
+// users, or to those of the default storage when tenant is empty
+func Encoder(cfg config.BrokerConfig, tenant string) repository.OutboxEncoder {
+	return func(change repository.Change, user models.UserProfile) (repository.OutboxMessage, error) {
+		return Encode(cfg, events.FromChange(change, user, tenant))
+	}
+}
+
+// Encode serializes an event in the configured format into a message for
+// the configured topic, keyed by the user's ID
+func Encode(cfg config.BrokerConfig, e events.Event) (repository.OutboxMessage, error) {
+	var payload []byte
+	var err error
+	if cfg.Format == config.FormatCloudEvents {
+		payload, err = json.Marshal(newCloudEvent(e))
+	} else {
+		payload, err = json.Marshal(e)
+	}
+	if err != nil {
+		return repository.OutboxMessage{}, err
+	}
+	return repository.OutboxMessage{
+		Topic:     strings.ReplaceAll(cfg.Topic, "{type}", e.Type),
+		Key:       e.User.ID,
+		Payload:   payload,
+		CreatedAt: e.OccurredAt,
+	}, nil
+}
+
+// Decode parses a payload serialized by Encode in the configured format
+func Decode(cfg config.BrokerConfig, payload []byte) (events.Event, error) {
+	if cfg.Format != config.FormatCloudEvents {
+		var e events.Event
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	}
+	var ce cloudEvent
+	if err := json.Unmarshal(payload, &ce); err != nil {
+		return events.Event{}, err
+	}
+	return events.Event{
+		ID:         ce.ID,
+		Type:       ce.Type,
+		OccurredAt: ce.Time,
+		User:       ce.Data,
+		Tenant:     ce.Tenant,
+	}, nil
+}
+
+// cloudEvent is an event in the CloudEvents 1.0 structured JSON format
+type cloudEvent struct {
+	SpecVersion     string             `json:"specversion"`
+	ID              string             `json:"id"`
+	Source          string             `json:"source"`
+	Type            string             `json:"type"`
+	Subject         string             `json:"subject"`
+	Time            time.Time          `json:"time"`
+	DataContentType string             `json:"datacontenttype"`
+	Data            models.UserProfile `json:"data"`
+	// Tenant is an extension attribute naming the user's tenant
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// cloudEventSource identifies this service as the source of CloudEvents
+const cloudEventSource = "/userprofile-api"
+
+func newCloudEvent(e events.Event) cloudEvent {
+	return cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              e.ID,
+		Source:          cloudEventSource,
+		Type:            e.Type,
+		Subject:         e.User.ID,
+		Time:            e.OccurredAt,
+		DataContentType: "application/json",
+		Data:            e.User,
+		Tenant:          e.Tenant,
+	}
+}
@@ -0,0 +1,103 @@
+package publish
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"userprofile-api/config"
+	"userprofile-api/repository"
+)
+
+// Relay publishes the messages recorded in outboxes and deletes them once
+// the broker has accepted them. A message is published at least once: when
+// the server stops between publishing and deleting it, or several servers
+// share a database, it may be published again, so consumers should ignore
+// event IDs they have seen.
+type Relay struct {
+	publisher Publisher
+	interval  time.Duration
+	batchSize int
+	timeout   time.Duration
+	logger    *slog.Logger
+
+	mu sync.Mutex
+	// outboxes holds the outboxes by tenant, "" being the default storage
+	outboxes map[string]repository.Outbox
+}
+
+// NewRelay creates a relay with no outboxes
+func NewRelay(publisher Publisher, cfg config.PublishConfig, logger *slog.Logger) *Relay {
+	return &Relay{
+		publisher: publisher,
+		interval:  cfg.PollInterval,
+		batchSize: cfg.BatchSize,
+		timeout:   cfg.Timeout,
+		logger:    logger,
+		outboxes:  make(map[string]repository.Outbox),
+	}
+}
+
+// Add has the relay publish the messages of a tenant's outbox, or of the
+// default storage's when tenant is empty
+func (r *Relay) Add(tenant string, outbox repository.Outbox) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outboxes[tenant] = outbox
+}
+
+// Run checks the outboxes every poll interval until ctx is done
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.mu.Lock()
+		outboxes := make(map[string]repository.Outbox, len(r.outboxes))
+		for tenant, outbox := range r.outboxes {
+			outboxes[tenant] = outbox
+		}
+		r.mu.Unlock()
+
+		for tenant, outbox := range outboxes {
+			if err := r.drain(ctx, outbox); err != nil && ctx.Err() == nil {
+				r.logger.Warn("publishing events from the outbox failed; retrying", "tenant", tenant, "error", err)
+			}
+		}
+	}
+}
+
+// drain publishes batches from the outbox until it is empty. A failed batch
+// stops the outbox's turn so that its messages stay in order.
+func (r *Relay) drain(ctx context.Context, outbox repository.Outbox) error {
+	for {
+		messages, err := outbox.PendingOutbox(ctx, r.batchSize)
+		if err != nil || len(messages) == 0 {
+			return err
+		}
+
+		publishCtx, cancel := context.WithTimeout(ctx, r.timeout)
+		err = r.publisher.Publish(publishCtx, messages)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		ids := make([]int64, len(messages))
+		for i, m := range messages {
+			ids[i] = m.ID
+		}
+		if err := outbox.DeleteOutbox(ctx, ids); err != nil {
+			return err
+		}
+		if len(messages) < r.batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Package quota limits how many requests each API key may make in a window
+// of time, and reports the limits, along with the user quotas of tenants, in
+// response headers.
+package quota
+
+import (
+	"maps"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/auth"
+	"userprofile-api/config"
+)
+
+// Response headers describing the caller's rate limit
+const (
+	LimitHeader     = "X-RateLimit-Limit"
+	RemainingHeader = "X-RateLimit-Remaining"
+	ResetHeader     = "X-RateLimit-Reset"
+)
+
+// Response headers describing the user quota of the request's tenant
+const (
+	UserLimitHeader     = "X-User-Quota-Limit"
+	UserRemainingHeader = "X-User-Quota-Remaining"
+)
+
+// Limits are the rate limits in force, which can be adjusted while the server
+// is running
+type Limits struct {
+	XMLName struct{} `json:"-" yaml:"-" xml:"rateLimits"`
+	// Default applies to keys without a limit of their own; zero means no
+	// limit
+	Default int `json:"default" xml:"default" yaml:"default"`
+	// WindowSeconds is the period requests are counted over
+	WindowSeconds int `json:"windowSeconds" xml:"windowSeconds" yaml:"windowSeconds"`
+	// Keys overrides Default for API keys by name
+	Keys map[string]int `json:"keys" xml:"-" yaml:"keys"`
+}
+
+// Status is a caller's use of its limit in the current window
+type Status struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// window counts a caller's requests since start
+type window struct {
+	start time.Time
+	count int
+}
+
+// Limiter counts requests per caller in fixed windows
+type Limiter struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	limit     int
+	keys      map[string]int
+	windows   map[string]*window
+	nextSweep time.Time
+}
+
+// New creates a limiter enforcing the configured limits
+func New(cfg config.QuotaConfig) *Limiter {
+	keys := maps.Clone(cfg.KeyLimits)
+	if keys == nil {
+		keys = make(map[string]int)
+	}
+	return &Limiter{
+		window:  cfg.RateWindow,
+		limit:   cfg.RateLimit,
+		keys:    keys,
+		windows: make(map[string]*window),
+	}
+}
+
+// Limits returns the limits in force
+func (l *Limiter) Limits() Limits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Limits{Default: l.limit, WindowSeconds: int(l.window.Seconds()), Keys: maps.Clone(l.keys)}
+}
+
+// SetDefault changes the limit of keys without one of their own
+func (l *Limiter) SetDefault(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+}
+
+// SetKey gives the named key a limit of its own; zero means no limit
+func (l *Limiter) SetKey(name string, limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.keys[name] = limit
+}
+
+// RemoveKey makes the named key use the default limit again
+func (l *Limiter) RemoveKey(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.keys, name)
+}
+
+// Allow counts a request by the named caller and reports whether it is
+// within the limit, along with the caller's status. Callers without a limit
+// are always allowed and get a zero Status.
+func (l *Limiter) Allow(name string) (bool, Status) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit, ok := l.keys[name]
+	if !ok {
+		limit = l.limit
+	}
+	if limit == 0 {
+		return true, Status{}
+	}
+
+	now := time.Now()
+	l.sweep(now)
+	w, ok := l.windows[name]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &window{start: now}
+		l.windows[name] = w
+	}
+	status := Status{Limit: limit, Reset: w.start.Add(l.window)}
+	if w.count >= limit {
+		return false, status
+	}
+	w.count++
+	status.Remaining = limit - w.count
+	return true, status
+}
+
+// sweep forgets the windows that have ended, at most once per window, so
+// callers that stop making requests are not remembered. The caller must hold
+// mu.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Before(l.nextSweep) {
+		return
+	}
+	l.nextSweep = now.Add(l.window)
+	for name, w := range l.windows {
+		if now.Sub(w.start) >= l.window {
+			delete(l.windows, name)
+		}
+	}
+}
+
+// Middleware counts the requests of the authenticated caller, adding its
+// status in the X-RateLimit headers, and rejects those over its limit with
+// 429 and a Retry-After header. Unauthenticated requests are not limited. It
+// must run after auth.Guard.Authenticate.
+func (l *Limiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := auth.PrincipalFrom(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		allowed, status := l.Allow(principal.Name)
+		if status.Limit == 0 {
+			c.Next()
+			return
+		}
+		c.Header(LimitHeader, strconv.Itoa(status.Limit))
+		c.Header(RemainingHeader, strconv.Itoa(status.Remaining))
+		c.Header(ResetHeader, strconv.FormatInt(status.Reset.Unix(), 10))
+		if !allowed {
+			retryAfter := int(time.Until(status.Reset).Seconds() + 1)
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			apierror.Abort(c, http.StatusTooManyRequests, apierror.CodeRateLimitExceeded,
+				"Too many requests; retry after the window resets",
+				gin.H{"limit": status.Limit, "windowSeconds": int(l.window.Seconds()), "retryAfterSeconds": retryAfter})
+			return
+		}
+		c.Next()
+	}
+}
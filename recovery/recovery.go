@@ -0,0 +1,127 @@
+// Package recovery turns panics in HTTP handlers into the API's internal
+// error responses, logging them with their stack trace and request ID and
+// passing them on to a Reporter, such as an error tracker, so crashes are not
+// only found in the logs.
+package recovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/requestid"
+)
+
+// Crash describes a panic recovered while handling a request
+type Crash struct {
+	// Value is the value the handler panicked with
+	Value any
+	// Stack is the stack trace of the panicking goroutine
+	Stack []byte
+	// Request is the request being handled
+	Request *http.Request
+	// Route is the route the request matched, such as /api/v1/users/:id,
+	// empty for unknown routes
+	Route     string
+	RequestID string
+}
+
+// Err returns the panic value as an error, wrapping it when it is not one
+func (c Crash) Err() error {
+	if err, ok := c.Value.(error); ok {
+		return err
+	}
+	return fmt.Errorf("panic: %v", c.Value)
+}
+
+// Reporter is told of the panics recovered in handlers, such as to send them
+// to an error tracker. Report is called before the response is written, so
+// it should not block for long.
+type Reporter interface {
+	Report(ctx context.Context, crash Crash)
+}
+
+// ReporterFunc adapts a function to a Reporter
+type ReporterFunc func(ctx context.Context, crash Crash)
+
+// Report calls f
+func (f ReporterFunc) Report(ctx context.Context, crash Crash) {
+	f(ctx, crash)
+}
+
+// Middleware recovers from panics in the handlers after it. The panic is
+// logged at error level with its stack trace and the request ID, handed to
+// the reporters, and answered with an INTERNAL_ERROR in the format the client
+// accepts, unless the handler had already started the response. Panics with
+// http.ErrAbortHandler are passed on, so the server aborts the response as
+// the handler asked.
+func Middleware(logger *slog.Logger, reporters ...Reporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+			if value == http.ErrAbortHandler {
+				panic(value)
+			}
+
+			ctx := c.Request.Context()
+			if brokenConnection(value) {
+				// The client went away; there is no one to answer and
+				// nothing to report
+				logger.WarnContext(ctx, "Client connection lost", "requestId", requestid.Get(c),
+					"method", c.Request.Method, "path", c.Request.URL.Path, "error", value)
+				c.Error(fmt.Errorf("%v", value))
+				c.Abort()
+				return
+			}
+
+			crash := Crash{
+				Value:     value,
+				Stack:     debug.Stack(),
+				Request:   c.Request,
+				Route:     c.FullPath(),
+				RequestID: requestid.Get(c),
+			}
+			logger.ErrorContext(ctx, "Handler panicked", "requestId", crash.RequestID,
+				"method", c.Request.Method, "path", c.Request.URL.Path, "route", crash.Route,
+				"panic", fmt.Sprint(value), "stack", string(crash.Stack))
+			for _, reporter := range reporters {
+				reporter.Report(ctx, crash)
+			}
+
+			c.Error(crash.Err())
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "An internal error occurred", nil)
+		}()
+		c.Next()
+	}
+}
+
+// brokenConnection reports whether a panic was caused by writing to a
+// client that closed its connection
+func brokenConnection(value any) bool {
+	err, ok := value.(error)
+	if !ok {
+		return false
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	var syscallErr *os.SyscallError
+	return errors.As(opErr, &syscallErr) &&
+		(errors.Is(syscallErr.Err, syscall.EPIPE) || errors.Is(syscallErr.Err, syscall.ECONNRESET))
+}
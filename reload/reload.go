@@ -0,0 +1,174 @@
+// Package reload watches CONFIG_FILE and SEED_FILE and applies their changes
+// to the running server, for the settings that can change without a restart.
+package reload
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"userprofile-api/config"
+	"userprofile-api/cors"
+	"userprofile-api/repository"
+	"userprofile-api/seed"
+)
+
+// settleDelay groups the bursts of events editors and deployment tools
+// produce while writing a file into a single reload
+const settleDelay = 250 * time.Millisecond
+
+// Targets are the running components reloaded settings are applied to
+type Targets struct {
+	// LogLevel is the minimum level of the default logger; without it,
+	// reloaded log levels are ignored
+	LogLevel *slog.LevelVar
+	CORS     *cors.Policy
+	// Users receives the users added to the seed file. It should publish
+	// change events, so that caches and subscribers see the new users.
+	Users repository.UserRepository
+}
+
+// Watcher reloads the configuration and seed files when they change
+type Watcher struct {
+	cfg     *config.Config
+	targets Targets
+	logger  *slog.Logger
+}
+
+// New creates a watcher for the files named by cfg, which must be the
+// configuration the server is running with
+func New(cfg *config.Config, targets Targets, logger *slog.Logger) *Watcher {
+	// Keep a copy, as the watcher updates it with the reloaded settings
+	running := *cfg
+	return &Watcher{cfg: &running, targets: targets, logger: logger}
+}
+
+// Run watches the files until ctx is done. It returns immediately when
+// neither a configuration nor a seed file is configured.
+func (w *Watcher) Run(ctx context.Context) {
+	configFile, seedFile := absPath(w.cfg.File), ""
+	if !w.cfg.Seed.Disabled {
+		seedFile = absPath(w.cfg.Seed.File)
+	}
+	if configFile == "" && seedFile == "" {
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		w.logger.Error("Failed to watch configuration files", "error", err)
+		return
+	}
+	defer watcher.Close()
+
+	// Watch the directories rather than the files, as many editors and
+	// Kubernetes ConfigMaps replace a file instead of writing to it
+	for _, file := range []string{configFile, seedFile} {
+		if file == "" {
+			continue
+		}
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			w.logger.Error("Failed to watch configuration file", "file", file, "error", err)
+			return
+		}
+		w.logger.Info("Watching for changes", "file", file)
+	}
+
+	timer := time.NewTimer(settleDelay)
+	timer.Stop()
+	defer timer.Stop()
+	var configChanged, seedChanged bool
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Error("Watching configuration files failed", "error", err)
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) {
+				continue
+			}
+			switch filepath.Clean(event.Name) {
+			case configFile:
+				configChanged = true
+			case seedFile:
+				seedChanged = true
+			default:
+				continue
+			}
+			timer.Reset(settleDelay)
+		case <-timer.C:
+			if configChanged {
+				w.reloadConfig()
+			}
+			if seedChanged {
+				w.reloadSeed(ctx)
+			}
+			configChanged, seedChanged = false, false
+		}
+	}
+}
+
+// reloadConfig applies the settings that can change without a restart and
+// rejects the others, which keep their running values
+func (w *Watcher) reloadConfig() {
+	reloaded, err := config.Load()
+	if err != nil {
+		w.logger.Error("Configuration reload failed; keeping the running settings", "file", w.cfg.File, "error", err)
+		return
+	}
+
+	safe, unsafe := config.Changes(w.cfg, reloaded)
+	if len(unsafe) > 0 {
+		w.logger.Warn("Configuration changes need a restart and were not applied", "file", w.cfg.File, "settings", unsafe)
+	}
+	if len(safe) == 0 {
+		return
+	}
+
+	if w.targets.LogLevel != nil {
+		w.targets.LogLevel.Set(reloaded.Log.Level)
+	}
+	w.cfg.Log.Level = reloaded.Log.Level
+	w.targets.CORS.Update(reloaded.CORS)
+	w.cfg.CORS = reloaded.CORS
+	w.logger.Info("Reloaded configuration", "file", w.cfg.File, "settings", safe)
+}
+
+// reloadSeed adds the users of the seed file that are not in the repository
+// yet. Users that exist are left alone, as they may have been changed
+// through the API since.
+func (w *Watcher) reloadSeed(ctx context.Context) {
+	users, err := seed.Load(w.cfg.Seed.File)
+	if err != nil {
+		w.logger.Error("Seed file reload failed", "error", err)
+		return
+	}
+	created, err := seed.Apply(ctx, w.targets.Users, users)
+	if err != nil {
+		w.logger.Error("Seed file reload failed", "file", w.cfg.Seed.File, "created", created, "error", err)
+		return
+	}
+	w.logger.Info("Reloaded seed file", "file", w.cfg.Seed.File, "created", created, "skipped", len(users)-created)
+}
+
+// absPath makes a configured file path absolute, to compare it with the
+// paths of watcher events
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,42 @@
+package replica
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/config"
+)
+
+// contextKey is the gin context key holding the replica's configuration
+const contextKey = "replica"
+
+// Middleware records the replica's configuration on each request, for
+// Refusal to answer the changes its read-only repositories refuse
+func Middleware(cfg config.ReplicaConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(contextKey, cfg)
+		c.Next()
+	}
+}
+
+// ReadOnly reports whether the request is served by a replica, for changes
+// kept apart from its read-only repositories
+func ReadOnly(c *gin.Context) bool {
+	_, ok := c.Get(contextKey)
+	return ok
+}
+
+// Refusal returns the status answering a change refused on a replica, and
+// the URL of the request on the primary, which is empty when the primary's
+// URL is not configured
+func Refusal(c *gin.Context) (status int, location string) {
+	value, ok := c.Get(contextKey)
+	if !ok {
+		return http.StatusMethodNotAllowed, ""
+	}
+	cfg := value.(config.ReplicaConfig)
+	if cfg.PrimaryURL != "" {
+		location = cfg.PrimaryURL + c.Request.URL.RequestURI()
+	}
+	return cfg.RefuseStatus, location
+}
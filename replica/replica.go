@@ -0,0 +1,175 @@
+// Package replica keeps the users of a read replica in sync with its
+// primary by applying the user change events the primary publishes to a
+// message broker.
+package replica
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"userprofile-api/backup"
+	"userprofile-api/config"
+	"userprofile-api/events"
+	"userprofile-api/models"
+	"userprofile-api/publish"
+	"userprofile-api/repository"
+	"userprofile-api/tenant"
+)
+
+const (
+	baseBackoff = time.Second
+	maxBackoff  = time.Minute
+)
+
+// Syncer applies the events it receives to the replica's storage. Versions
+// and timestamps are maintained by the replica's storage, as when restoring
+// a backup, so they differ from the primary's.
+type Syncer struct {
+	subscriber publish.Subscriber
+	cfg        config.BrokerConfig
+	repo       repository.UserRepository
+	// tenants is nil when tenancy is disabled
+	tenants *tenant.Repositories
+	logger  *slog.Logger
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// Stats describes how replication has gone since the server started
+type Stats struct {
+	// Subscribed is whether the syncer is receiving events, as opposed to
+	// waiting to subscribe again after a failure
+	Subscribed bool `json:"subscribed" xml:"subscribed" yaml:"subscribed"`
+	Applied    int  `json:"eventsApplied" xml:"eventsApplied" yaml:"eventsApplied"`
+	Skipped    int  `json:"eventsSkipped" xml:"eventsSkipped" yaml:"eventsSkipped"`
+	// LastEventAt is when the primary made the change of the last event
+	// applied
+	LastEventAt *time.Time `json:"lastEventAt,omitempty" xml:"lastEventAt,omitempty" yaml:"lastEventAt,omitempty"`
+	// LastError is the latest failure to receive or apply an event
+	LastError string `json:"lastError,omitempty" xml:"lastError,omitempty" yaml:"lastError,omitempty"`
+}
+
+// New creates a syncer applying events to repo, or for tenants' users, to
+// their repositories, which may be wrapped by repository.ReadOnly
+func New(subscriber publish.Subscriber, cfg config.BrokerConfig, repo repository.UserRepository,
+	tenants *tenant.Repositories, logger *slog.Logger) *Syncer {
+	return &Syncer{subscriber: subscriber, cfg: cfg, repo: repo, tenants: tenants, logger: logger}
+}
+
+// Stats returns the replication statistics so far
+func (s *Syncer) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// record updates the statistics
+func (s *Syncer) record(update func(stats *Stats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(&s.stats)
+}
+
+// Run receives events until ctx is done, subscribing again with a growing
+// delay whenever the connection to the broker fails
+func (s *Syncer) Run(ctx context.Context) {
+	delay := baseBackoff
+	for {
+		start := time.Now()
+		s.record(func(stats *Stats) { stats.Subscribed = true })
+		// An event being applied is finished even once ctx is done, as the
+		// broker may already count it as received
+		applyCtx := context.WithoutCancel(ctx)
+		err := s.subscriber.Subscribe(ctx, func(payload []byte) { s.handle(applyCtx, payload) })
+		s.record(func(stats *Stats) { stats.Subscribed = false })
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.record(func(stats *Stats) { stats.LastError = err.Error() })
+		}
+		// A subscription that lasted a while failed afresh
+		if time.Since(start) > maxBackoff {
+			delay = baseBackoff
+		}
+		s.logger.Warn("receiving events from the primary failed; subscribing again",
+			"retryIn", delay.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxBackoff)
+	}
+}
+
+// handle applies one received event and counts whether it was applied
+func (s *Syncer) handle(ctx context.Context, payload []byte) {
+	occurredAt, err := s.receive(ctx, payload)
+	s.record(func(stats *Stats) {
+		if err != nil {
+			stats.Skipped++
+			stats.LastError = err.Error()
+			return
+		}
+		stats.Applied++
+		stats.LastEventAt = &occurredAt
+	})
+}
+
+// receive applies one received event, returning when the primary made the
+// change. Events that cannot be applied are logged and skipped, so one bad
+// event does not stop replication.
+func (s *Syncer) receive(ctx context.Context, payload []byte) (time.Time, error) {
+	e, err := publish.Decode(s.cfg, payload)
+	if err != nil {
+		s.logger.Error("received an event that cannot be decoded; skipping it", "error", err)
+		return time.Time{}, fmt.Errorf("decode event: %w", err)
+	}
+	if !slices.Contains(events.Types, e.Type) {
+		s.logger.Warn("received an event of an unknown type; skipping it", "event", e.Type, "id", e.ID)
+		return time.Time{}, fmt.Errorf("unknown event type %q", e.Type)
+	}
+
+	repo := s.repo
+	if e.Tenant != "" {
+		if s.tenants == nil {
+			s.logger.Warn("received an event of a tenant without tenancy enabled; skipping it",
+				"tenant", e.Tenant, "id", e.ID)
+			return time.Time{}, fmt.Errorf("event of tenant %q without tenancy enabled", e.Tenant)
+		}
+		if repo, err = s.tenants.Get(e.Tenant); err != nil {
+			s.logger.Error("opening the tenant's users failed; skipping the event", "tenant", e.Tenant, "id", e.ID, "error", err)
+			return time.Time{}, fmt.Errorf("open tenant %q: %w", e.Tenant, err)
+		}
+	}
+	if err := apply(ctx, repository.Writable(repo), e); err != nil {
+		s.logger.Error("applying an event from the primary failed; skipping it",
+			"event", e.Type, "id", e.ID, "user", e.User.ID, "tenant", e.Tenant, "error", err)
+		return time.Time{}, fmt.Errorf("apply event %s: %w", e.ID, err)
+	}
+	return e.OccurredAt, nil
+}
+
+// apply makes the user in repo match the event: deleted for user.deleted
+// events, and as in the event, active, for the others
+func apply(ctx context.Context, repo repository.UserRepository, e events.Event) error {
+	if e.Type == events.UserDeleted {
+		err := repo.Delete(ctx, e.User.ID)
+		if errors.Is(err, repository.ErrNotFound) {
+			// Already deleted, e.g. when an event is received twice
+			return nil
+		}
+		return err
+	}
+	user := e.User
+	user.DeletedAt = nil
+	_, err := backup.Restore(ctx, repo, []models.UserProfile{user})
+	return err
+}
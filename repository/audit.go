@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"userprofile-api/models"
+)
+
+// AuditRecord is an entry of the audit trail of the changes made to users
+type AuditRecord struct {
+	// ID orders the records of a trail; it is set when the record is stored
+	ID int64
+	// Action names the change, such as "user.create"
+	Action string
+	// Actor names the caller that made the change
+	Actor  string
+	UserID string
+	// Version and Status are those of the user after the change, and are
+	// left empty for deletions
+	Version int
+	Status  models.Status
+	// User is the user after the change, kept as a version of its history;
+	// it is nil for deletions and for records that do not change the user
+	User      *models.UserProfile
+	CreatedAt time.Time
+}
+
+// Auditor is implemented by repositories that keep an audit trail of the
+// changes made to their users. Recorded within a Transaction, a record is
+// committed together with the change it describes.
+type Auditor interface {
+	RecordAudit(ctx context.Context, record AuditRecord) error
+	// MoveAudit hands the trail of the user fromID over to the user toID,
+	// which it was merged into
+	MoveAudit(ctx context.Context, fromID, toID string) error
+	// Trail returns the records of a user's trail, oldest first
+	Trail(ctx context.Context, userID string) ([]AuditRecord, error)
+}
+
+// RecordAudit adds a record to the audit trail of the repository, or does
+// nothing if it keeps none
+func RecordAudit(ctx context.Context, repo UserRepository, record AuditRecord) error {
+	auditor, ok := repo.(Auditor)
+	if !ok {
+		return nil
+	}
+	return auditor.RecordAudit(ctx, record)
+}
+
+// MoveAudit hands the audit trail of one user over to another in the
+// repository, or does nothing if it keeps none
+func MoveAudit(ctx context.Context, repo UserRepository, fromID, toID string) error {
+	auditor, ok := repo.(Auditor)
+	if !ok {
+		return nil
+	}
+	return auditor.MoveAudit(ctx, fromID, toID)
+}
+
+// Trail returns the audit trail of a user in the repository, oldest first,
+// or errors.ErrUnsupported if it keeps none
+func Trail(ctx context.Context, repo UserRepository, userID string) ([]AuditRecord, error) {
+	auditor, ok := repo.(Auditor)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	return auditor.Trail(ctx, userID)
+}
+
+// RecordAudit adds a record to the trail held in memory
+func (r *InMemoryUserRepository) RecordAudit(_ context.Context, record AuditRecord) error {
+	r.auditMu.Lock()
+	defer r.auditMu.Unlock()
+	record.ID = int64(len(r.audit) + 1)
+	record.CreatedAt = time.Now().UTC()
+	if record.User != nil {
+		user := record.User.Clone()
+		record.User = &user
+	}
+	r.audit = append(r.audit, record)
+	return nil
+}
+
+// MoveAudit reassigns the records of the trail held in memory
+func (r *InMemoryUserRepository) MoveAudit(_ context.Context, fromID, toID string) error {
+	r.auditMu.Lock()
+	defer r.auditMu.Unlock()
+	for i := range r.audit {
+		if r.audit[i].UserID == fromID {
+			r.audit[i].UserID = toID
+		}
+	}
+	return nil
+}
+
+// Trail returns the records of a user from the trail held in memory
+func (r *InMemoryUserRepository) Trail(_ context.Context, userID string) ([]AuditRecord, error) {
+	r.auditMu.Lock()
+	defer r.auditMu.Unlock()
+	records := []AuditRecord{}
+	for _, record := range r.audit {
+		if record.UserID != userID {
+			continue
+		}
+		if record.User != nil {
+			user := record.User.Clone()
+			record.User = &user
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// RecordAudit stores a record in the audit_log table
+func (r *SQLUserRepository) RecordAudit(ctx context.Context, record AuditRecord) error {
+	_, err := r.conn(ctx).ExecContext(ctx, r.dialect.rebind(`INSERT INTO audit_log (action, actor, user_id, version, status, snapshot, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`),
+		record.Action, record.Actor, record.UserID, record.Version, string(record.Status), snapshotColumn{&record.User},
+		time.Now().UTC())
+	return err
+}
+
+// Trail reads the records of a user from the audit_log table
+func (r *SQLUserRepository) Trail(ctx context.Context, userID string) ([]AuditRecord, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, r.dialect.rebind(`SELECT id, action, actor, user_id, version, status, snapshot, created_at
+		FROM audit_log WHERE user_id = $1 ORDER BY id`), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []AuditRecord{}
+	for rows.Next() {
+		var record AuditRecord
+		if err := rows.Scan(&record.ID, &record.Action, &record.Actor, &record.UserID, &record.Version, &record.Status,
+			snapshotColumn{&record.User}, timestamp{&record.CreatedAt}); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// snapshotColumn reads and writes the snapshot column, which holds the user
+// after the change as JSON, or an empty string when there is none
+type snapshotColumn struct {
+	user **models.UserProfile
+}
+
+func (sc snapshotColumn) Scan(src any) error {
+	var encoded sql.NullString
+	if err := encoded.Scan(src); err != nil {
+		return err
+	}
+	*sc.user = nil
+	if encoded.String == "" {
+		return nil
+	}
+	var user models.UserProfile
+	if err := json.Unmarshal([]byte(encoded.String), &user); err != nil {
+		return err
+	}
+	*sc.user = &user
+	return nil
+}
+
+func (sc snapshotColumn) Value() (driver.Value, error) {
+	if *sc.user == nil {
+		return "", nil
+	}
+	encoded, err := json.Marshal(*sc.user)
+	return string(encoded), err
+}
+
+// MoveAudit reassigns the records of the audit_log table
+func (r *SQLUserRepository) MoveAudit(ctx context.Context, fromID, toID string) error {
+	_, err := r.conn(ctx).ExecContext(ctx, r.dialect.rebind(`UPDATE audit_log SET user_id = $1 WHERE user_id = $2`), toID, fromID)
+	return err
+}
@@ -0,0 +1,582 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"userprofile-api/config"
+	"userprofile-api/models"
+)
+
+// dynamoTimeout bounds each DynamoDB call, including the SDK's retries
+const dynamoTimeout = 10 * time.Second
+
+// versionName refers to the version attribute in expressions, since
+// VERSION may be a reserved word
+var versionName = map[string]string{"#version": "version"}
+
+// Partition key prefixes of the two kinds of items in the table
+const (
+	userKeyPrefix  = "user#"
+	emailKeyPrefix = "email#"
+)
+
+// DynamoDBUserRepository stores users in a DynamoDB table keyed by the
+// string attribute pk. Each user is an item keyed user#<id>; each email in
+// use is reserved by an item keyed email#<lowercased email> naming its
+// owner, so transactions with conditional writes keep IDs and emails unique.
+// Like the SQL backends, deleted users keep their email reserved.
+type DynamoDBUserRepository struct {
+	client *dynamodb.Client
+	table  string
+}
+
+// NewDynamoDBUserRepository creates a repository storing users in the
+// given table
+func NewDynamoDBUserRepository(client *dynamodb.Client, table string) *DynamoDBUserRepository {
+	return &DynamoDBUserRepository{client: client, table: table}
+}
+
+// OpenDynamoDB connects to the configured table, creating it first if
+// configured to, and verifies that it is reachable
+func OpenDynamoDB(cfg config.DynamoDBConfig) (*DynamoDBUserRepository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load AWS configuration: %w", err)
+	}
+	client := dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	})
+
+	if cfg.CreateTable {
+		if err := CreateDynamoDBTable(ctx, client, cfg.Table); err != nil {
+			return nil, err
+		}
+	}
+	repo := NewDynamoDBUserRepository(client, cfg.Table)
+	if err := repo.Ping(ctx); err != nil {
+		return nil, fmt.Errorf("connect to %s table %s: %w", config.DriverDynamoDB, cfg.Table, err)
+	}
+	return repo, nil
+}
+
+// CreateDynamoDBTable creates a table with the key schema the repository
+// expects and on-demand capacity, and waits until it is active. An existing
+// table is left as is.
+func CreateDynamoDBTable(ctx context.Context, client *dynamodb.Client, table string) error {
+	_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(table),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("pk"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("pk"), KeyType: types.KeyTypeHash},
+		},
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	var inUse *types.ResourceInUseException
+	if err != nil && !errors.As(err, &inUse) {
+		return fmt.Errorf("create table %s: %w", table, err)
+	}
+
+	waiter := dynamodb.NewTableExistsWaiter(client)
+	if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)}, 2*time.Minute); err != nil {
+		return fmt.Errorf("wait for table %s: %w", table, err)
+	}
+	return nil
+}
+
+// List scans every user, following LastEvaluatedKey from page to page, and
+// filters, sorts and pages them like the in-memory backend. The API pages
+// by offset and reports a total count, which DynamoDB cannot compute
+// without reading every item anyway, so this suits tables of moderate size.
+// Listing after a cursor reads only the page instead; see listAfter.
+func (r *DynamoDBUserRepository) List(ctx context.Context, opts ListOptions) ([]models.UserProfile, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, dynamoTimeout)
+	defer cancel()
+	if opts.After != nil {
+		return r.listAfter(ctx, opts)
+	}
+
+	var matched []models.UserProfile
+	paginator := dynamodb.NewScanPaginator(r.client, &dynamodb.ScanInput{
+		TableName:                 aws.String(r.table),
+		ConsistentRead:            aws.Bool(true),
+		FilterExpression:          aws.String("begins_with(pk, :prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":prefix": stringValue(userKeyPrefix)},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, item := range page.Items {
+			user, err := unmarshalUser(item)
+			if err != nil {
+				return nil, 0, err
+			}
+			if user.DeletedAt != nil && !opts.IncludeDeleted {
+				continue
+			}
+			if opts.Filter.Matches(user) {
+				matched = append(matched, user)
+			}
+		}
+	}
+
+	// Scans return items in hash order; start from insertion order like the
+	// other backends
+	slices.SortFunc(matched, func(a, b models.UserProfile) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+	sortUsers(matched, opts)
+	return paginate(matched, opts), len(matched), nil
+}
+
+// listAfter returns up to opts.Limit users following the cursor in the order
+// the table is scanned in, rather than by creation time. The scan starts
+// from the key of the cursor's user, which is the LastEvaluatedKey of the
+// scan that returned it, and reads at most as many items as the page still
+// lacks, so each page costs reads in proportion to its size rather than to
+// the table's. The total is -1, since counting the matches would read every
+// item.
+func (r *DynamoDBUserRepository) listAfter(ctx context.Context, opts ListOptions) ([]models.UserProfile, int, error) {
+	input := &dynamodb.ScanInput{
+		TableName:                 aws.String(r.table),
+		ConsistentRead:            aws.Bool(true),
+		FilterExpression:          aws.String("begins_with(pk, :prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":prefix": stringValue(userKeyPrefix)},
+	}
+	if opts.After.ID != "" {
+		input.ExclusiveStartKey = userKey(opts.After.ID)
+	}
+
+	users := []models.UserProfile{}
+	for {
+		if opts.Limit > 0 {
+			// Limit counts the items read, before the filters drop any
+			input.Limit = aws.Int32(int32(opts.Limit - len(users)))
+		}
+		page, err := r.client.Scan(ctx, input)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, item := range page.Items {
+			user, err := unmarshalUser(item)
+			if err != nil {
+				return nil, 0, err
+			}
+			if (user.DeletedAt == nil || opts.IncludeDeleted) && opts.Filter.Matches(user) {
+				users = append(users, user)
+			}
+		}
+		if len(page.LastEvaluatedKey) == 0 || (opts.Limit > 0 && len(users) >= opts.Limit) {
+			return users, -1, nil
+		}
+		input.ExclusiveStartKey = page.LastEvaluatedKey
+	}
+}
+
+// Get returns the active user with the given ID
+func (r *DynamoDBUserRepository) Get(ctx context.Context, id string) (models.UserProfile, error) {
+	ctx, cancel := context.WithTimeout(ctx, dynamoTimeout)
+	defer cancel()
+
+	user, err := r.get(ctx, id)
+	if err != nil {
+		return models.UserProfile{}, err
+	}
+	if user.DeletedAt != nil {
+		return models.UserProfile{}, ErrNotFound
+	}
+	return user, nil
+}
+
+// GetByEmail looks up the owner of the email's reservation
+func (r *DynamoDBUserRepository) GetByEmail(ctx context.Context, email string) (models.UserProfile, error) {
+	ctx, cancel := context.WithTimeout(ctx, dynamoTimeout)
+	defer cancel()
+
+	out, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.table),
+		Key:            emailKey(email),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return models.UserProfile{}, err
+	}
+	owner, ok := out.Item["userId"].(*types.AttributeValueMemberS)
+	if !ok {
+		return models.UserProfile{}, ErrNotFound
+	}
+
+	user, err := r.get(ctx, owner.Value)
+	if err != nil {
+		return models.UserProfile{}, err
+	}
+	if user.DeletedAt != nil {
+		return models.UserProfile{}, ErrNotFound
+	}
+	return user, nil
+}
+
+// Create stores the user and reserves its email in one transaction, which
+// fails if either the ID or the email is taken
+func (r *DynamoDBUserRepository) Create(ctx context.Context, user models.UserProfile) (models.UserProfile, error) {
+	ctx, cancel := context.WithTimeout(ctx, dynamoTimeout)
+	defer cancel()
+
+	user.DeletedAt = nil
+	user.AvatarURL = ""
+	if user.Status == "" {
+		user.Status = models.StatusActive
+	}
+	user.Version = 1
+	user.CreatedAt = time.Now().UTC()
+	user.UpdatedAt = user.CreatedAt
+	item, err := marshalUser(user)
+	if err != nil {
+		return models.UserProfile{}, err
+	}
+
+	writes := []types.TransactWriteItem{{Put: &types.Put{
+		TableName:           aws.String(r.table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(pk)"),
+	}}}
+	if user.Email != "" {
+		writes = append(writes, r.reserveEmail(user.Email, user.ID))
+	}
+
+	_, err = r.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes})
+	switch failed := failedConditions(err); {
+	case failed == nil && err != nil:
+		return models.UserProfile{}, err
+	case slices.Contains(failed, 0):
+		return models.UserProfile{}, ErrConflict
+	case len(failed) > 0:
+		return models.UserProfile{}, ErrEmailConflict
+	}
+	return user, nil
+}
+
+// Update replaces the active user, conditional on its version, and moves
+// the email reservation in the same transaction when the email changes
+func (r *DynamoDBUserRepository) Update(ctx context.Context, id string, user models.UserProfile) (models.UserProfile, error) {
+	ctx, cancel := context.WithTimeout(ctx, dynamoTimeout)
+	defer cancel()
+
+	current, err := r.get(ctx, id)
+	if err != nil {
+		return models.UserProfile{}, err
+	}
+	if current.DeletedAt != nil {
+		return models.UserProfile{}, ErrNotFound
+	}
+	if user.Version != 0 && user.Version != current.Version {
+		return models.UserProfile{}, ErrVersionMismatch
+	}
+
+	user.ID = id
+	user.DeletedAt = nil
+	user.AvatarURL = current.AvatarURL
+	if user.Status == "" {
+		user.Status = current.Status
+	}
+	user.Version = current.Version + 1
+	user.CreatedAt = current.CreatedAt
+	user.UpdatedAt = time.Now().UTC()
+	item, err := marshalUser(user)
+	if err != nil {
+		return models.UserProfile{}, err
+	}
+
+	writes := []types.TransactWriteItem{{Put: &types.Put{
+		TableName:                aws.String(r.table),
+		Item:                     item,
+		ConditionExpression:      aws.String("#version = :version AND attribute_not_exists(deletedAt)"),
+		ExpressionAttributeNames: versionName,
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":version": numberValue(current.Version),
+		},
+	}}}
+	if !strings.EqualFold(user.Email, current.Email) {
+		if user.Email != "" {
+			writes = append(writes, r.reserveEmail(user.Email, id))
+		}
+		if current.Email != "" {
+			writes = append(writes, r.releaseEmail(current.Email, id))
+		}
+	}
+
+	_, err = r.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes})
+	switch failed := failedConditions(err); {
+	case failed == nil && err != nil:
+		return models.UserProfile{}, err
+	case slices.Contains(failed, 0):
+		// Changed or deleted by another request since it was read
+		return models.UserProfile{}, ErrVersionMismatch
+	case len(failed) > 0:
+		return models.UserProfile{}, ErrEmailConflict
+	}
+	return user, nil
+}
+
+// Delete soft-deletes the active user with the given ID
+func (r *DynamoDBUserRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.update(ctx, id, "SET deletedAt = :now, #version = #version + :one, updatedAt = :now", "attribute_not_exists(deletedAt)",
+		map[string]types.AttributeValue{
+			":one": numberValue(1),
+			":now": timeValue(time.Now().UTC()),
+		})
+	return err
+}
+
+// SetAvatarURL records the location of the active user's avatar
+func (r *DynamoDBUserRepository) SetAvatarURL(ctx context.Context, id string, avatarURL string) (models.UserProfile, error) {
+	return r.update(ctx, id, "SET avatarUrl = :url, #version = #version + :one, updatedAt = :now", "attribute_not_exists(deletedAt)",
+		map[string]types.AttributeValue{
+			":url": stringValue(avatarURL),
+			":one": numberValue(1),
+			":now": timeValue(time.Now().UTC()),
+		})
+}
+
+// Restore undeletes the deleted user with the given ID
+func (r *DynamoDBUserRepository) Restore(ctx context.Context, id string) (models.UserProfile, error) {
+	return r.update(ctx, id, "SET #version = #version + :one, updatedAt = :now REMOVE deletedAt", "attribute_exists(deletedAt)",
+		map[string]types.AttributeValue{
+			":one": numberValue(1),
+			":now": timeValue(time.Now().UTC()),
+		})
+}
+
+// Stats scans every user, like List, and summarizes the active ones
+func (r *DynamoDBUserRepository) Stats(ctx context.Context) (UserStats, error) {
+	users, _, err := r.List(ctx, ListOptions{})
+	if err != nil {
+		return UserStats{}, err
+	}
+	return computeStats(users, time.Now().UTC()), nil
+}
+
+// Search scans the active users and indexes them in memory, returning
+// those whose full name or bio contains every word of the query
+func (r *DynamoDBUserRepository) Search(ctx context.Context, opts SearchOptions) ([]SearchResult, error) {
+	users, _, err := r.List(ctx, ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return newSearchIndex(users).search(opts), nil
+}
+
+// Reset permanently deletes every item in the table, users and email
+// reservations alike, in batches of the 25 deletes BatchWriteItem allows
+func (r *DynamoDBUserRepository) Reset(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*dynamoTimeout)
+	defer cancel()
+
+	paginator := dynamodb.NewScanPaginator(r.client, &dynamodb.ScanInput{
+		TableName:            aws.String(r.table),
+		ProjectionExpression: aws.String("pk"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for batch := range slices.Chunk(page.Items, 25) {
+			writes := make([]types.WriteRequest, len(batch))
+			for i, key := range batch {
+				writes[i] = types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: key}}
+			}
+			if err := r.deleteBatch(ctx, writes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteBatch sends the deletes, resending those DynamoDB leaves
+// unprocessed when throttled
+func (r *DynamoDBUserRepository) deleteBatch(ctx context.Context, writes []types.WriteRequest) error {
+	for len(writes) > 0 {
+		out, err := r.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{r.table: writes},
+		})
+		if err != nil {
+			return err
+		}
+		writes = out.UnprocessedItems[r.table]
+		if len(writes) > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+	return nil
+}
+
+// Ping checks that the table exists and is reachable
+func (r *DynamoDBUserRepository) Ping(ctx context.Context) error {
+	_, err := r.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(r.table)})
+	return err
+}
+
+// get returns the user with the given ID, whether or not it is deleted
+func (r *DynamoDBUserRepository) get(ctx context.Context, id string) (models.UserProfile, error) {
+	out, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.table),
+		Key:            userKey(id),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return models.UserProfile{}, err
+	}
+	if out.Item == nil {
+		return models.UserProfile{}, ErrNotFound
+	}
+	return unmarshalUser(out.Item)
+}
+
+// update applies an update expression to an existing user, subject to an
+// optional extra condition, and returns the updated user. A user that does
+// not exist or fails the condition is reported as ErrNotFound.
+func (r *DynamoDBUserRepository) update(ctx context.Context, id, expression, condition string, values map[string]types.AttributeValue) (models.UserProfile, error) {
+	ctx, cancel := context.WithTimeout(ctx, dynamoTimeout)
+	defer cancel()
+
+	conditions := "attribute_exists(pk)"
+	if condition != "" {
+		conditions += " AND " + condition
+	}
+	var names map[string]string
+	if strings.Contains(expression, "#version") {
+		names = versionName
+	}
+	out, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(r.table),
+		Key:                       userKey(id),
+		UpdateExpression:          aws.String(expression),
+		ConditionExpression:       aws.String(conditions),
+		ExpressionAttributeValues: values,
+		ExpressionAttributeNames:  names,
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return models.UserProfile{}, ErrNotFound
+	}
+	if err != nil {
+		return models.UserProfile{}, err
+	}
+	return unmarshalUser(out.Attributes)
+}
+
+// reserveEmail claims an email for the user, failing if another user holds it
+func (r *DynamoDBUserRepository) reserveEmail(email, id string) types.TransactWriteItem {
+	item := emailKey(email)
+	item["userId"] = stringValue(id)
+	return types.TransactWriteItem{Put: &types.Put{
+		TableName:                 aws.String(r.table),
+		Item:                      item,
+		ConditionExpression:       aws.String("attribute_not_exists(pk) OR userId = :id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":id": stringValue(id)},
+	}}
+}
+
+// releaseEmail removes the user's reservation of an email it no longer uses
+func (r *DynamoDBUserRepository) releaseEmail(email, id string) types.TransactWriteItem {
+	return types.TransactWriteItem{Delete: &types.Delete{
+		TableName:                 aws.String(r.table),
+		Key:                       emailKey(email),
+		ConditionExpression:       aws.String("attribute_not_exists(pk) OR userId = :id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":id": stringValue(id)},
+	}}
+}
+
+// failedConditions returns the positions of the writes whose condition
+// failed when err is a cancelled transaction, or nil otherwise
+func failedConditions(err error) []int {
+	var cancelled *types.TransactionCanceledException
+	if !errors.As(err, &cancelled) {
+		return nil
+	}
+	failed := []int{}
+	for i, reason := range cancelled.CancellationReasons {
+		if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+			failed = append(failed, i)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return failed
+}
+
+// marshalUser converts a user to an item, naming attributes after the JSON
+// fields and omitting the same empty ones
+func marshalUser(user models.UserProfile) (map[string]types.AttributeValue, error) {
+	item, err := attributevalue.MarshalMapWithOptions(user, func(o *attributevalue.EncoderOptions) {
+		o.TagKey = "json"
+	})
+	if err != nil {
+		return nil, err
+	}
+	item["pk"] = stringValue(userKeyPrefix + user.ID)
+	return item, nil
+}
+
+func unmarshalUser(item map[string]types.AttributeValue) (models.UserProfile, error) {
+	var user models.UserProfile
+	err := attributevalue.UnmarshalMapWithOptions(item, &user, func(o *attributevalue.DecoderOptions) {
+		o.TagKey = "json"
+	})
+	// Users saved before statuses existed are active
+	if user.Status == "" {
+		user.Status = models.StatusActive
+	}
+	return user, err
+}
+
+func userKey(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{"pk": stringValue(userKeyPrefix + id)}
+}
+
+// emailKey is the key of an email's reservation; emails are unique
+// regardless of case
+func emailKey(email string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{"pk": stringValue(emailKeyPrefix + strings.ToLower(email))}
+}
+
+func stringValue(s string) types.AttributeValue {
+	return &types.AttributeValueMemberS{Value: s}
+}
+
+func numberValue(n int) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.Itoa(n)}
+}
+
+// timeValue encodes a time the way attributevalue marshals time.Time fields
+func timeValue(t time.Time) types.AttributeValue {
+	return stringValue(t.Format(time.RFC3339Nano))
+}
@@ -0,0 +1,236 @@
+package repository_test
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+// item is a DynamoDB item as sent over the wire, by attribute name
+type item map[string]json.RawMessage
+
+// fakeDynamoDB answers the TransactWriteItems puts and the Scans the
+// repository makes, keeping items in a table that scans them in the order
+// of a hash of their key, as DynamoDB does, rather than the order they were
+// written in
+type fakeDynamoDB struct {
+	mu    sync.Mutex
+	items map[string]item
+}
+
+// attribute is a key or string attribute value
+type attribute struct {
+	S string
+}
+
+// scanInput is the part of a Scan request the fake reads. Only the filter
+// on the key prefix the repository uses is understood.
+type scanInput struct {
+	ExclusiveStartKey         map[string]attribute
+	ExpressionAttributeValues map[string]attribute
+	FilterExpression          string
+	Limit                     int
+}
+
+// newFakeDynamoDB starts a fake and returns a repository using it
+func newFakeDynamoDB(t *testing.T) (*fakeDynamoDB, *repository.DynamoDBUserRepository) {
+	t.Helper()
+	fake := &fakeDynamoDB{items: map[string]item{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	client := dynamodb.New(dynamodb.Options{
+		BaseEndpoint: aws.String(server.URL),
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+	})
+	return fake, repository.NewDynamoDBUserRepository(client, "users")
+}
+
+func (f *fakeDynamoDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var out any
+	var err error
+	switch r.Header.Get("X-Amz-Target") {
+	case "DynamoDB_20120810.TransactWriteItems":
+		out, err = f.transactWrite(r)
+	case "DynamoDB_20120810.Scan":
+		out, err = f.scan(r)
+	default:
+		err = fmt.Errorf("unsupported operation %s", r.Header.Get("X-Amz-Target"))
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazon.coral.validate#ValidationException", "message": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// transactWrite stores the items put, without checking their conditions
+func (f *fakeDynamoDB) transactWrite(r *http.Request) (any, error) {
+	var input struct {
+		TransactItems []struct {
+			Put *struct{ Item item }
+		}
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, err
+	}
+	for _, write := range input.TransactItems {
+		if write.Put == nil {
+			return nil, fmt.Errorf("only puts are supported")
+		}
+		var key attribute
+		if err := json.Unmarshal(write.Put.Item["pk"], &key); err != nil {
+			return nil, err
+		}
+		f.items[key.S] = write.Put.Item
+	}
+	return struct{}{}, nil
+}
+
+// scan reads up to Limit items following ExclusiveStartKey in hash order,
+// then filters them, returning the key of the last item read when more
+// remain
+func (f *fakeDynamoDB) scan(r *http.Request) (any, error) {
+	var input scanInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, err
+	}
+	if input.FilterExpression != "begins_with(pk, :prefix)" {
+		return nil, fmt.Errorf("unsupported filter %q", input.FilterExpression)
+	}
+	prefix := input.ExpressionAttributeValues[":prefix"].S
+
+	keys := make([]string, 0, len(f.items))
+	for key := range f.items {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, compareKeys)
+	start := 0
+	if after, ok := input.ExclusiveStartKey["pk"]; ok {
+		// Scans resume where the key would be, whether or not it exists
+		start, _ = slices.BinarySearchFunc(keys, after.S, compareKeys)
+		if start < len(keys) && keys[start] == after.S {
+			start++
+		}
+	}
+	end := len(keys)
+	if input.Limit > 0 {
+		end = min(end, start+input.Limit)
+	}
+
+	items := []item{}
+	for _, key := range keys[start:end] {
+		if strings.HasPrefix(key, prefix) {
+			items = append(items, f.items[key])
+		}
+	}
+	out := map[string]any{"Items": items, "Count": len(items), "ScannedCount": end - start}
+	if end < len(keys) {
+		out["LastEvaluatedKey"] = map[string]attribute{"pk": {S: keys[end-1]}}
+	}
+	return out, nil
+}
+
+// compareKeys orders keys by their hash, as DynamoDB orders a scan by the
+// hash of the partition key
+func compareKeys(a, b string) int {
+	return cmp.Or(cmp.Compare(keyHash(a), keyHash(b)), strings.Compare(a, b))
+}
+
+func keyHash(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// deleteUser marks the user's item deleted, as Delete would
+func (f *fakeDynamoDB) deleteUser(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.items["user#"+id]["deletedAt"] = json.RawMessage(`{"S":"2025-06-01T12:00:00Z"}`)
+}
+
+// TestDynamoDBListAfterPages pages through a table by cursor with pages of
+// several sizes, checking that every user is listed exactly once, although
+// scans return them out of creation order and the table also holds email
+// reservations, which the filter drops from the pages
+func TestDynamoDBListAfterPages(t *testing.T) {
+	ctx := context.Background()
+	fake, repo := newFakeDynamoDB(t)
+	var active, all []string
+	for i := range 57 {
+		id := fmt.Sprintf("user-%02d", i)
+		if _, err := repo.Create(ctx, models.UserProfile{ID: id, FullName: "User", Email: id + "@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, id)
+		if i%3 == 0 {
+			fake.deleteUser(id)
+			continue
+		}
+		active = append(active, id)
+	}
+
+	for _, includeDeleted := range []bool{false, true} {
+		want := active
+		if includeDeleted {
+			want = all
+		}
+		for _, limit := range []int{1, 7, 20, 100} {
+			t.Run(fmt.Sprintf("limit=%d/include_deleted=%t", limit, includeDeleted), func(t *testing.T) {
+				var listed []string
+				after := repository.Cursor{}
+				for page := 0; ; page++ {
+					if page > len(all) {
+						t.Fatalf("still paging after %d pages", page)
+					}
+					users, total, err := repo.List(ctx, repository.ListOptions{
+						After:          &after,
+						Limit:          limit,
+						IncludeDeleted: includeDeleted,
+					})
+					if err != nil {
+						t.Fatal(err)
+					}
+					if total != -1 || len(users) > limit {
+						t.Fatalf("page %d: %d users of %d, want at most %d of -1", page, len(users), total, limit)
+					}
+					for _, user := range users {
+						listed = append(listed, user.ID)
+					}
+					if len(users) < limit {
+						break
+					}
+					after = repository.CursorOf(users[len(users)-1])
+				}
+
+				if slices.IsSorted(listed) {
+					t.Error("users were listed in creation order, so the fake did not scan them out of order")
+				}
+				slices.Sort(listed)
+				if !slices.Equal(listed, want) {
+					t.Errorf("listed %v, want each of %v once", listed, want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"userprofile-api/models"
+)
+
+var (
+	// ErrGroupNotFound is returned when the requested group does not exist
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrGroupConflict is returned when creating a group whose ID is taken
+	ErrGroupConflict = errors.New("group already exists")
+	// ErrAlreadyMember is returned when adding a user to a group it belongs to
+	ErrAlreadyMember = errors.New("user is already a member of the group")
+	// ErrNotMember is returned when removing a user from a group it does not
+	// belong to
+	ErrNotMember = errors.New("user is not a member of the group")
+)
+
+// GroupRepository defines the storage operations for the groups of a set of
+// users and their memberships. It does not check that members exist, which
+// is left to callers holding the users. Like UserRepository, every method
+// takes the context of the request it serves.
+type GroupRepository interface {
+	// List returns a page of the groups ordered by name and then ID, along
+	// with the total number of groups
+	List(ctx context.Context, offset, limit int) ([]models.Group, int, error)
+	// Get returns the group with the given ID
+	Get(ctx context.Context, id string) (models.Group, error)
+	// Create stores a new group, returning ErrGroupConflict if the ID is
+	// taken
+	Create(ctx context.Context, group models.Group) (models.Group, error)
+	// Update replaces the name and description of the group with the given
+	// ID
+	Update(ctx context.Context, id string, group models.Group) (models.Group, error)
+	// Delete removes the group with the given ID along with its memberships
+	Delete(ctx context.Context, id string) error
+	// AddMember adds a user to a group, returning ErrAlreadyMember if it
+	// already belongs to it
+	AddMember(ctx context.Context, groupID, userID string) (models.Membership, error)
+	// RemoveMember removes a user from a group, returning ErrNotMember if it
+	// does not belong to it
+	RemoveMember(ctx context.Context, groupID, userID string) error
+	// Members returns a page of a group's memberships, oldest first, along
+	// with the total number of members
+	Members(ctx context.Context, groupID string, offset, limit int) ([]models.Membership, int, error)
+	// UserGroups returns a page of the groups a user belongs to, ordered
+	// like List, along with the total number of them
+	UserGroups(ctx context.Context, userID string, offset, limit int) ([]models.Group, int, error)
+	// RemoveUser removes a user from every group, once it is deleted
+	RemoveUser(ctx context.Context, userID string) error
+	// MoveUser hands the memberships of the user fromID over to the user
+	// toID, once it was merged into it, keeping those toID already has
+	MoveUser(ctx context.Context, fromID, toID string) error
+}
+
+// GroupStore is implemented by user repositories that also keep groups in
+// their database
+type GroupStore interface {
+	// GroupRepository returns the repository of the groups kept in the
+	// user repository's database
+	GroupRepository() GroupRepository
+}
+
+// Groups holds the group repository of each tenant, named by an empty string
+// for the default storage: that of its GroupStore when it has one, and one
+// in memory otherwise
+type Groups struct {
+	mu    sync.Mutex
+	repos map[string]GroupRepository
+}
+
+// NewGroups creates an empty set of group repositories
+func NewGroups() *Groups {
+	return &Groups{repos: map[string]GroupRepository{}}
+}
+
+// Use keeps the groups of tenant in the database of store. It must be called
+// before the tenant's groups are first used.
+func (g *Groups) Use(tenant string, store GroupStore) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.repos[tenant] = store.GroupRepository()
+}
+
+// Tenant returns the group repository of a tenant
+func (g *Groups) Tenant(tenant string) GroupRepository {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	repo, ok := g.repos[tenant]
+	if !ok {
+		repo = NewInMemoryGroupRepository()
+		g.repos[tenant] = repo
+	}
+	return repo
+}
+
+// InMemoryGroupRepository keeps groups and memberships in memory
+type InMemoryGroupRepository struct {
+	mu     sync.RWMutex
+	groups map[string]models.Group
+	// members maps group IDs to their memberships in the order they were
+	// added
+	members map[string][]models.Membership
+}
+
+// NewInMemoryGroupRepository creates an empty repository
+func NewInMemoryGroupRepository() *InMemoryGroupRepository {
+	return &InMemoryGroupRepository{groups: map[string]models.Group{}, members: map[string][]models.Membership{}}
+}
+
+// List returns a page of the groups ordered by name and then ID
+func (r *InMemoryGroupRepository) List(_ context.Context, offset, limit int) ([]models.Group, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	groups := make([]models.Group, 0, len(r.groups))
+	for _, group := range r.groups {
+		groups = append(groups, group)
+	}
+	sortGroups(groups)
+	return pageOf(groups, offset, limit), len(groups), nil
+}
+
+// Get returns the group with the given ID
+func (r *InMemoryGroupRepository) Get(_ context.Context, id string) (models.Group, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	group, ok := r.groups[id]
+	if !ok {
+		return models.Group{}, ErrGroupNotFound
+	}
+	return group, nil
+}
+
+// Create stores a new group, returning ErrGroupConflict if the ID is taken
+func (r *InMemoryGroupRepository) Create(_ context.Context, group models.Group) (models.Group, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.groups[group.ID]; ok {
+		return models.Group{}, ErrGroupConflict
+	}
+	now := time.Now().UTC()
+	group.CreatedAt, group.UpdatedAt = now, now
+	r.groups[group.ID] = group
+	return group, nil
+}
+
+// Update replaces the name and description of the group with the given ID
+func (r *InMemoryGroupRepository) Update(_ context.Context, id string, group models.Group) (models.Group, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.groups[id]
+	if !ok {
+		return models.Group{}, ErrGroupNotFound
+	}
+	current.Name, current.Description = group.Name, group.Description
+	current.UpdatedAt = time.Now().UTC()
+	r.groups[id] = current
+	return current, nil
+}
+
+// Delete removes the group with the given ID along with its memberships
+func (r *InMemoryGroupRepository) Delete(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.groups[id]; !ok {
+		return ErrGroupNotFound
+	}
+	delete(r.groups, id)
+	delete(r.members, id)
+	return nil
+}
+
+// AddMember adds a user to a group
+func (r *InMemoryGroupRepository) AddMember(_ context.Context, groupID, userID string) (models.Membership, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.groups[groupID]; !ok {
+		return models.Membership{}, ErrGroupNotFound
+	}
+	if slices.ContainsFunc(r.members[groupID], func(m models.Membership) bool { return m.UserID == userID }) {
+		return models.Membership{}, ErrAlreadyMember
+	}
+	membership := models.Membership{GroupID: groupID, UserID: userID, AddedAt: time.Now().UTC()}
+	r.members[groupID] = append(r.members[groupID], membership)
+	return membership, nil
+}
+
+// RemoveMember removes a user from a group
+func (r *InMemoryGroupRepository) RemoveMember(_ context.Context, groupID, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.groups[groupID]; !ok {
+		return ErrGroupNotFound
+	}
+	i := slices.IndexFunc(r.members[groupID], func(m models.Membership) bool { return m.UserID == userID })
+	if i < 0 {
+		return ErrNotMember
+	}
+	r.members[groupID] = slices.Delete(r.members[groupID], i, i+1)
+	return nil
+}
+
+// Members returns a page of a group's memberships, oldest first
+func (r *InMemoryGroupRepository) Members(_ context.Context, groupID string, offset, limit int) ([]models.Membership, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.groups[groupID]; !ok {
+		return nil, 0, ErrGroupNotFound
+	}
+	members := r.members[groupID]
+	return pageOf(slices.Clone(members), offset, limit), len(members), nil
+}
+
+// UserGroups returns a page of the groups a user belongs to
+func (r *InMemoryGroupRepository) UserGroups(_ context.Context, userID string, offset, limit int) ([]models.Group, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var groups []models.Group
+	for groupID, members := range r.members {
+		if slices.ContainsFunc(members, func(m models.Membership) bool { return m.UserID == userID }) {
+			groups = append(groups, r.groups[groupID])
+		}
+	}
+	sortGroups(groups)
+	return pageOf(groups, offset, limit), len(groups), nil
+}
+
+// RemoveUser removes a user from every group
+func (r *InMemoryGroupRepository) RemoveUser(_ context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for groupID, members := range r.members {
+		r.members[groupID] = slices.DeleteFunc(members, func(m models.Membership) bool { return m.UserID == userID })
+	}
+	return nil
+}
+
+// MoveUser hands a user's memberships over to another user
+func (r *InMemoryGroupRepository) MoveUser(_ context.Context, fromID, toID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for groupID, members := range r.members {
+		i := slices.IndexFunc(members, func(m models.Membership) bool { return m.UserID == fromID })
+		if i < 0 {
+			continue
+		}
+		if slices.ContainsFunc(members, func(m models.Membership) bool { return m.UserID == toID }) {
+			r.members[groupID] = slices.Delete(members, i, i+1)
+		} else {
+			members[i].UserID = toID
+		}
+	}
+	return nil
+}
+
+// sortGroups orders groups by name and then ID
+func sortGroups(groups []models.Group) {
+	slices.SortFunc(groups, func(a, b models.Group) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.ID, b.ID))
+	})
+}
+
+// pageOf returns the items from offset on, at most limit of them unless
+// limit is zero
+func pageOf[T any](items []T, offset, limit int) []T {
+	start := min(max(offset, 0), len(items))
+	end := len(items)
+	if limit > 0 {
+		end = min(start+limit, end)
+	}
+	return items[start:end:end]
+}
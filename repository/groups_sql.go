@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"userprofile-api/models"
+)
+
+// SQLGroupRepository stores groups in the user_groups table of a SQL
+// database, and their members in group_members
+type SQLGroupRepository struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// GroupRepository returns the repository of the groups kept in the same
+// database as the users
+func (r *SQLUserRepository) GroupRepository() GroupRepository {
+	return &SQLGroupRepository{db: r.db, dialect: r.dialect}
+}
+
+// conn returns the transaction ctx carries, or the connection pool outside
+// of transactions
+func (r *SQLGroupRepository) conn(ctx context.Context) queryer {
+	return connection(ctx, r.db)
+}
+
+const groupColumns = `id, name, description, created_at, updated_at`
+
+// List returns a page of the groups ordered by name and then ID
+func (r *SQLGroupRepository) List(ctx context.Context, offset, limit int) ([]models.Group, int, error) {
+	var total int
+	if err := r.conn(ctx).QueryRowContext(ctx, `SELECT COUNT(*) FROM user_groups`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	groups, err := r.queryGroups(ctx, `SELECT `+groupColumns+` FROM user_groups ORDER BY name, id`+r.pageClause(offset, limit))
+	return groups, total, err
+}
+
+// Get returns the group with the given ID
+func (r *SQLGroupRepository) Get(ctx context.Context, id string) (models.Group, error) {
+	group, err := scanGroup(r.conn(ctx).QueryRowContext(ctx, r.dialect.rebind(`SELECT `+groupColumns+` FROM user_groups WHERE id = $1`), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Group{}, ErrGroupNotFound
+	}
+	return group, err
+}
+
+// Create stores a new group, returning ErrGroupConflict if the ID is taken
+func (r *SQLGroupRepository) Create(ctx context.Context, group models.Group) (models.Group, error) {
+	now := time.Now().UTC()
+	_, err := r.conn(ctx).ExecContext(ctx, r.dialect.rebind(`INSERT INTO user_groups (id, name, description, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $4)`), group.ID, group.Name, group.Description, now)
+	if r.dialect.isUniqueViolation(err) {
+		return models.Group{}, ErrGroupConflict
+	}
+	if err != nil {
+		return models.Group{}, err
+	}
+	group.CreatedAt, group.UpdatedAt = now, now
+	return group, nil
+}
+
+// Update replaces the name and description of the group with the given ID
+func (r *SQLGroupRepository) Update(ctx context.Context, id string, group models.Group) (models.Group, error) {
+	result, err := r.conn(ctx).ExecContext(ctx, r.dialect.rebind(`UPDATE user_groups SET name = $2, description = $3, updated_at = $4 WHERE id = $1`),
+		id, group.Name, group.Description, time.Now().UTC())
+	if err != nil {
+		return models.Group{}, err
+	}
+	if err := r.expectGroup(result); err != nil {
+		return models.Group{}, err
+	}
+	return r.Get(ctx, id)
+}
+
+// Delete removes the group with the given ID along with its memberships.
+// SQLite only enforces the foreign key when asked to, so the memberships are
+// deleted explicitly.
+func (r *SQLGroupRepository) Delete(ctx context.Context, id string) error {
+	return r.Transaction(ctx, func(ctx context.Context) error {
+		q := r.conn(ctx)
+		if _, err := q.ExecContext(ctx, r.dialect.rebind(`DELETE FROM group_members WHERE group_id = $1`), id); err != nil {
+			return err
+		}
+		result, err := q.ExecContext(ctx, r.dialect.rebind(`DELETE FROM user_groups WHERE id = $1`), id)
+		if err != nil {
+			return err
+		}
+		return r.expectGroup(result)
+	})
+}
+
+// AddMember adds a user to a group
+func (r *SQLGroupRepository) AddMember(ctx context.Context, groupID, userID string) (models.Membership, error) {
+	if _, err := r.Get(ctx, groupID); err != nil {
+		return models.Membership{}, err
+	}
+	now := time.Now().UTC()
+	_, err := r.conn(ctx).ExecContext(ctx, r.dialect.rebind(`INSERT INTO group_members (group_id, user_id, added_at) VALUES ($1, $2, $3)`),
+		groupID, userID, now)
+	if r.dialect.isUniqueViolation(err) {
+		return models.Membership{}, ErrAlreadyMember
+	}
+	if err != nil {
+		return models.Membership{}, err
+	}
+	return models.Membership{GroupID: groupID, UserID: userID, AddedAt: now}, nil
+}
+
+// RemoveMember removes a user from a group
+func (r *SQLGroupRepository) RemoveMember(ctx context.Context, groupID, userID string) error {
+	if _, err := r.Get(ctx, groupID); err != nil {
+		return err
+	}
+	result, err := r.conn(ctx).ExecContext(ctx, r.dialect.rebind(`DELETE FROM group_members WHERE group_id = $1 AND user_id = $2`), groupID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotMember
+	}
+	return nil
+}
+
+// Members returns a page of a group's memberships, oldest first
+func (r *SQLGroupRepository) Members(ctx context.Context, groupID string, offset, limit int) ([]models.Membership, int, error) {
+	if _, err := r.Get(ctx, groupID); err != nil {
+		return nil, 0, err
+	}
+	var total int
+	if err := r.conn(ctx).QueryRowContext(ctx, r.dialect.rebind(`SELECT COUNT(*) FROM group_members WHERE group_id = $1`), groupID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := r.conn(ctx).QueryContext(ctx, r.dialect.rebind(`SELECT group_id, user_id, added_at FROM group_members
+		WHERE group_id = $1 ORDER BY added_at, user_id`+r.pageClause(offset, limit)), groupID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	members := []models.Membership{}
+	for rows.Next() {
+		var m models.Membership
+		if err := rows.Scan(&m.GroupID, &m.UserID, timestamp{&m.AddedAt}); err != nil {
+			return nil, 0, err
+		}
+		members = append(members, m)
+	}
+	return members, total, rows.Err()
+}
+
+// UserGroups returns a page of the groups a user belongs to
+func (r *SQLGroupRepository) UserGroups(ctx context.Context, userID string, offset, limit int) ([]models.Group, int, error) {
+	var total int
+	if err := r.conn(ctx).QueryRowContext(ctx, r.dialect.rebind(`SELECT COUNT(*) FROM group_members WHERE user_id = $1`), userID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	groups, err := r.queryGroups(ctx, `SELECT `+groupColumns+` FROM user_groups
+		WHERE id IN (SELECT group_id FROM group_members WHERE user_id = $1) ORDER BY name, id`+r.pageClause(offset, limit), userID)
+	return groups, total, err
+}
+
+// RemoveUser removes a user from every group
+func (r *SQLGroupRepository) RemoveUser(ctx context.Context, userID string) error {
+	_, err := r.conn(ctx).ExecContext(ctx, r.dialect.rebind(`DELETE FROM group_members WHERE user_id = $1`), userID)
+	return err
+}
+
+// MoveUser hands a user's memberships over to another user
+func (r *SQLGroupRepository) MoveUser(ctx context.Context, fromID, toID string) error {
+	_, err := r.conn(ctx).ExecContext(ctx, r.dialect.rebind(`UPDATE group_members SET user_id = $1
+		WHERE user_id = $2 AND group_id NOT IN (SELECT group_id FROM group_members WHERE user_id = $1)`), toID, fromID)
+	if err != nil {
+		return err
+	}
+	return r.RemoveUser(ctx, fromID)
+}
+
+// pageClause selects the page starting at offset, of at most limit rows
+// unless it is 0
+func (r *SQLGroupRepository) pageClause(offset, limit int) string {
+	limitValue := r.dialect.noLimit
+	if limit > 0 {
+		limitValue = fmt.Sprint(limit)
+	}
+	return fmt.Sprintf(` LIMIT %s OFFSET %d`, limitValue, max(offset, 0))
+}
+
+func (r *SQLGroupRepository) queryGroups(ctx context.Context, query string, args ...any) ([]models.Group, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, r.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []models.Group{}
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+func scanGroup(row interface{ Scan(dest ...any) error }) (models.Group, error) {
+	var group models.Group
+	err := row.Scan(&group.ID, &group.Name, &group.Description, timestamp{&group.CreatedAt}, timestamp{&group.UpdatedAt})
+	return group, err
+}
+
+// expectGroup returns ErrGroupNotFound when a statement matched no groups
+func (r *SQLGroupRepository) expectGroup(result sql.Result) error {
+	if err := expectAffected(result); errors.Is(err, ErrNotFound) {
+		return ErrGroupNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
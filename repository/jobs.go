@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"userprofile-api/models"
+)
+
+var (
+	// ErrJobNotFound is returned when the requested job does not exist
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobNotPending is returned when claiming a job that is not pending,
+	// such as one another worker claimed first
+	ErrJobNotPending = errors.New("job is not pending")
+)
+
+// JobFilter selects the jobs List returns; empty fields select every job
+type JobFilter struct {
+	Status models.JobStatus
+	Kind   string
+}
+
+// matches reports whether the filter selects job
+func (f JobFilter) matches(job models.Job) bool {
+	return (f.Status == "" || job.Status == f.Status) && (f.Kind == "" || job.Kind == f.Kind)
+}
+
+// JobRepository defines the storage operations for background jobs. Like
+// UserRepository, every method takes the context of the request it serves.
+type JobRepository interface {
+	// List returns a page of the jobs the filter selects, oldest first,
+	// along with the total number of them
+	List(ctx context.Context, filter JobFilter, offset, limit int) ([]models.Job, int, error)
+	// Get returns the job with the given ID
+	Get(ctx context.Context, id string) (models.Job, error)
+	// Create stores a new job
+	Create(ctx context.Context, job models.Job) (models.Job, error)
+	// Update saves the status, attempts, last error and next run time of
+	// the job with the given ID
+	Update(ctx context.Context, job models.Job) (models.Job, error)
+	// Delete removes the job with the given ID
+	Delete(ctx context.Context, id string) error
+	// Due returns up to limit of the pending jobs due to run by now, those
+	// due first first
+	Due(ctx context.Context, now time.Time, limit int) ([]models.Job, error)
+	// Claim marks the pending job with the given ID as running and counts
+	// an attempt, returning ErrJobNotPending if it is not pending
+	Claim(ctx context.Context, id string) (models.Job, error)
+	// Release returns the jobs left running, such as by a server that
+	// stopped, to pending, and returns how many there were
+	Release(ctx context.Context) (int, error)
+}
+
+// JobStore is implemented by user repositories that also keep background
+// jobs in their database
+type JobStore interface {
+	// JobRepository returns the repository of the jobs kept in the user
+	// repository's database
+	JobRepository() JobRepository
+}
+
+// InMemoryJobRepository keeps jobs in memory, so they are lost on restart
+type InMemoryJobRepository struct {
+	mu   sync.RWMutex
+	jobs map[string]models.Job
+}
+
+// NewInMemoryJobRepository creates an empty repository
+func NewInMemoryJobRepository() *InMemoryJobRepository {
+	return &InMemoryJobRepository{jobs: map[string]models.Job{}}
+}
+
+// List returns a page of the jobs the filter selects, oldest first
+func (r *InMemoryJobRepository) List(_ context.Context, filter JobFilter, offset, limit int) ([]models.Job, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	jobs := []models.Job{}
+	for _, job := range r.jobs {
+		if filter.matches(job) {
+			jobs = append(jobs, cloneJob(job))
+		}
+	}
+	slices.SortFunc(jobs, func(a, b models.Job) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+	return pageOf(jobs, offset, limit), len(jobs), nil
+}
+
+// Get returns the job with the given ID
+func (r *InMemoryJobRepository) Get(_ context.Context, id string) (models.Job, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return models.Job{}, ErrJobNotFound
+	}
+	return cloneJob(job), nil
+}
+
+// Create stores a new job
+func (r *InMemoryJobRepository) Create(_ context.Context, job models.Job) (models.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	job.CreatedAt, job.UpdatedAt = now, now
+	job.RunAt = job.RunAt.UTC()
+	r.jobs[job.ID] = cloneJob(job)
+	return job, nil
+}
+
+// Update saves the status, attempts, last error and next run time of a job
+func (r *InMemoryJobRepository) Update(_ context.Context, job models.Job) (models.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.jobs[job.ID]
+	if !ok {
+		return models.Job{}, ErrJobNotFound
+	}
+	current.Status, current.Attempts, current.LastError = job.Status, job.Attempts, job.LastError
+	current.RunAt, current.UpdatedAt = job.RunAt.UTC(), time.Now().UTC()
+	r.jobs[job.ID] = current
+	return cloneJob(current), nil
+}
+
+// Delete removes the job with the given ID
+func (r *InMemoryJobRepository) Delete(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.jobs[id]; !ok {
+		return ErrJobNotFound
+	}
+	delete(r.jobs, id)
+	return nil
+}
+
+// Due returns up to limit of the pending jobs due to run by now
+func (r *InMemoryJobRepository) Due(_ context.Context, now time.Time, limit int) ([]models.Job, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	jobs := []models.Job{}
+	for _, job := range r.jobs {
+		if job.Status == models.JobPending && !job.RunAt.After(now) {
+			jobs = append(jobs, cloneJob(job))
+		}
+	}
+	slices.SortFunc(jobs, func(a, b models.Job) int {
+		return cmp.Or(a.RunAt.Compare(b.RunAt), strings.Compare(a.ID, b.ID))
+	})
+	return pageOf(jobs, 0, limit), nil
+}
+
+// Claim marks a pending job as running and counts an attempt
+func (r *InMemoryJobRepository) Claim(_ context.Context, id string) (models.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return models.Job{}, ErrJobNotFound
+	}
+	if job.Status != models.JobPending {
+		return models.Job{}, ErrJobNotPending
+	}
+	job.Status = models.JobRunning
+	job.Attempts++
+	job.UpdatedAt = time.Now().UTC()
+	r.jobs[id] = job
+	return cloneJob(job), nil
+}
+
+// Release returns the jobs left running to pending
+func (r *InMemoryJobRepository) Release(context.Context) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	released := 0
+	for id, job := range r.jobs {
+		if job.Status == models.JobRunning {
+			job.Status, job.UpdatedAt = models.JobPending, time.Now().UTC()
+			r.jobs[id] = job
+			released++
+		}
+	}
+	return released, nil
+}
+
+// cloneJob returns a copy of job whose payload can be changed independently
+func cloneJob(job models.Job) models.Job {
+	job.Payload = job.Payload.Clone()
+	return job
+}
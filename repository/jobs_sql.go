@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"userprofile-api/models"
+)
+
+// SQLJobRepository stores background jobs in the jobs table of a SQL
+// database
+type SQLJobRepository struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// JobRepository returns the repository of the jobs kept in the same database
+// as the users
+func (r *SQLUserRepository) JobRepository() JobRepository {
+	return &SQLJobRepository{db: r.db, dialect: r.dialect}
+}
+
+// conn returns the transaction ctx carries, or the connection pool outside
+// of transactions
+func (r *SQLJobRepository) conn(ctx context.Context) queryer {
+	return connection(ctx, r.db)
+}
+
+const jobColumns = `id, kind, payload, status, attempts, max_attempts, last_error, run_at, created_at, updated_at`
+
+// List returns a page of the jobs the filter selects, oldest first
+func (r *SQLJobRepository) List(ctx context.Context, filter JobFilter, offset, limit int) ([]models.Job, int, error) {
+	var conditions []string
+	var args []any
+	if filter.Status != "" {
+		args = append(args, string(filter.Status))
+		conditions = append(conditions, fmt.Sprintf(`status = $%d`, len(args)))
+	}
+	if filter.Kind != "" {
+		args = append(args, filter.Kind)
+		conditions = append(conditions, fmt.Sprintf(`kind = $%d`, len(args)))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+
+	var total int
+	if err := r.conn(ctx).QueryRowContext(ctx, r.dialect.rebind(`SELECT COUNT(*) FROM jobs`+where), args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	limitValue := r.dialect.noLimit
+	if limit > 0 {
+		limitValue = fmt.Sprint(limit)
+	}
+	jobs, err := r.queryJobs(ctx, `SELECT `+jobColumns+` FROM jobs`+where+` ORDER BY created_at, id`+
+		fmt.Sprintf(` LIMIT %s OFFSET %d`, limitValue, max(offset, 0)), args...)
+	return jobs, total, err
+}
+
+// Get returns the job with the given ID
+func (r *SQLJobRepository) Get(ctx context.Context, id string) (models.Job, error) {
+	job, err := scanJob(r.conn(ctx).QueryRowContext(ctx, r.dialect.rebind(`SELECT `+jobColumns+` FROM jobs WHERE id = $1`), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Job{}, ErrJobNotFound
+	}
+	return job, err
+}
+
+// Create stores a new job
+func (r *SQLJobRepository) Create(ctx context.Context, job models.Job) (models.Job, error) {
+	now := time.Now().UTC()
+	job.RunAt = job.RunAt.UTC()
+	_, err := r.conn(ctx).ExecContext(ctx, r.dialect.rebind(`INSERT INTO jobs (`+jobColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)`),
+		job.ID, job.Kind, metadataColumn{&job.Payload}, string(job.Status), job.Attempts, job.MaxAttempts, job.LastError,
+		job.RunAt, now)
+	if err != nil {
+		return models.Job{}, err
+	}
+	job.CreatedAt, job.UpdatedAt = now, now
+	return job, nil
+}
+
+// Update saves the status, attempts, last error and next run time of a job
+func (r *SQLJobRepository) Update(ctx context.Context, job models.Job) (models.Job, error) {
+	result, err := r.conn(ctx).ExecContext(ctx, r.dialect.rebind(`UPDATE jobs
+		SET status = $2, attempts = $3, last_error = $4, run_at = $5, updated_at = $6 WHERE id = $1`),
+		job.ID, string(job.Status), job.Attempts, job.LastError, job.RunAt.UTC(), time.Now().UTC())
+	if err != nil {
+		return models.Job{}, err
+	}
+	if err := r.expectJob(result); err != nil {
+		return models.Job{}, err
+	}
+	return r.Get(ctx, job.ID)
+}
+
+// Delete removes the job with the given ID
+func (r *SQLJobRepository) Delete(ctx context.Context, id string) error {
+	result, err := r.conn(ctx).ExecContext(ctx, r.dialect.rebind(`DELETE FROM jobs WHERE id = $1`), id)
+	if err != nil {
+		return err
+	}
+	return r.expectJob(result)
+}
+
+// Due returns up to limit of the pending jobs due to run by now
+func (r *SQLJobRepository) Due(ctx context.Context, now time.Time, limit int) ([]models.Job, error) {
+	return r.queryJobs(ctx, `SELECT `+jobColumns+` FROM jobs WHERE status = $1 AND run_at <= $2
+		ORDER BY run_at, id LIMIT `+fmt.Sprint(limit), string(models.JobPending), now.UTC())
+}
+
+// Claim marks a pending job as running and counts an attempt. The status is
+// checked by the update itself, so servers sharing the database never both
+// claim a job.
+func (r *SQLJobRepository) Claim(ctx context.Context, id string) (models.Job, error) {
+	result, err := r.conn(ctx).ExecContext(ctx, r.dialect.rebind(`UPDATE jobs
+		SET status = $2, attempts = attempts + 1, updated_at = $3 WHERE id = $1 AND status = $4`),
+		id, string(models.JobRunning), time.Now().UTC(), string(models.JobPending))
+	if err != nil {
+		return models.Job{}, err
+	}
+	if err := expectAffected(result); errors.Is(err, ErrNotFound) {
+		if _, err := r.Get(ctx, id); err != nil {
+			return models.Job{}, err
+		}
+		return models.Job{}, ErrJobNotPending
+	} else if err != nil {
+		return models.Job{}, err
+	}
+	return r.Get(ctx, id)
+}
+
+// Release returns the jobs left running to pending
+func (r *SQLJobRepository) Release(ctx context.Context) (int, error) {
+	result, err := r.conn(ctx).ExecContext(ctx, r.dialect.rebind(`UPDATE jobs SET status = $1, updated_at = $2 WHERE status = $3`),
+		string(models.JobPending), time.Now().UTC(), string(models.JobRunning))
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (r *SQLJobRepository) queryJobs(ctx context.Context, query string, args ...any) ([]models.Job, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, r.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []models.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func scanJob(row interface{ Scan(dest ...any) error }) (models.Job, error) {
+	var job models.Job
+	var status string
+	err := row.Scan(&job.ID, &job.Kind, metadataColumn{&job.Payload}, &status, &job.Attempts, &job.MaxAttempts, &job.LastError,
+		timestamp{&job.RunAt}, timestamp{&job.CreatedAt}, timestamp{&job.UpdatedAt})
+	job.Status = models.JobStatus(status)
+	return job, err
+}
+
+// expectJob returns ErrJobNotFound when a statement matched no jobs
+func (r *SQLJobRepository) expectJob(result sql.Result) error {
+	if err := expectAffected(result); errors.Is(err, ErrNotFound) {
+		return ErrJobNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
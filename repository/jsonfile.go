@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"userprofile-api/models"
+)
+
+// JSONFileUserRepository keeps users in memory and rewrites the whole
+// collection to a JSON file after every change. Each write goes to a
+// temporary file that is renamed over the old one, so a crash leaves either
+// the previous or the new contents, never a partial file. It suits demos and
+// small single-instance deployments.
+type JSONFileUserRepository struct {
+	*InMemoryUserRepository
+
+	// writeMu serializes changes so the file is written in the order the
+	// changes were made
+	writeMu sync.Mutex
+	path    string
+}
+
+// OpenJSONFile loads the users stored in the file at path, starting empty
+// if it does not exist yet
+func OpenJSONFile(path string) (*JSONFileUserRepository, error) {
+	var users []models.UserProfile
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &users); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", path, err)
+		}
+	}
+	return &JSONFileUserRepository{InMemoryUserRepository: NewInMemoryUserRepository(users), path: path}, nil
+}
+
+// Create stores a new user and saves the collection
+func (r *JSONFileUserRepository) Create(ctx context.Context, user models.UserProfile) (models.UserProfile, error) {
+	return persist(r, func() (models.UserProfile, error) { return r.InMemoryUserRepository.Create(ctx, user) })
+}
+
+// Update replaces the active user and saves the collection
+func (r *JSONFileUserRepository) Update(ctx context.Context, id string, user models.UserProfile) (models.UserProfile, error) {
+	return persist(r, func() (models.UserProfile, error) { return r.InMemoryUserRepository.Update(ctx, id, user) })
+}
+
+// Delete soft-deletes the active user and saves the collection
+func (r *JSONFileUserRepository) Delete(ctx context.Context, id string) error {
+	_, err := persist(r, func() (struct{}, error) { return struct{}{}, r.InMemoryUserRepository.Delete(ctx, id) })
+	return err
+}
+
+// SetAvatarURL records the user's avatar location and saves the collection
+func (r *JSONFileUserRepository) SetAvatarURL(ctx context.Context, id string, avatarURL string) (models.UserProfile, error) {
+	return persist(r, func() (models.UserProfile, error) { return r.InMemoryUserRepository.SetAvatarURL(ctx, id, avatarURL) })
+}
+
+// Restore undeletes the user and saves the collection
+func (r *JSONFileUserRepository) Restore(ctx context.Context, id string) (models.UserProfile, error) {
+	return persist(r, func() (models.UserProfile, error) { return r.InMemoryUserRepository.Restore(ctx, id) })
+}
+
+// Reset removes every user and saves the empty collection
+func (r *JSONFileUserRepository) Reset(ctx context.Context) error {
+	_, err := persist(r, func() (struct{}, error) { return struct{}{}, r.InMemoryUserRepository.Reset(ctx) })
+	return err
+}
+
+// persist applies a change to the in-memory users and writes them to the
+// file. If the file cannot be written the change is rolled back, so memory
+// never holds data that would be lost on restart.
+func persist[T any](r *JSONFileUserRepository, change func() (T, error)) (T, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	before := r.snapshot()
+	result, err := change()
+	if err != nil {
+		return result, err
+	}
+	if err := r.save(r.snapshot()); err != nil {
+		r.mu.Lock()
+		r.setUsers(before)
+		r.mu.Unlock()
+		var zero T
+		return zero, fmt.Errorf("save %s: %w", r.path, err)
+	}
+	return result, nil
+}
+
+func (r *JSONFileUserRepository) snapshot() []models.UserProfile {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.users)
+}
+
+// save writes the users to a temporary file next to the target, flushes it
+// to disk and renames it into place
+func (r *JSONFileUserRepository) save(users []models.UserProfile) error {
+	if users == nil {
+		users = []models.UserProfile{}
+	}
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(r.path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(r.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return err
+	}
+
+	// Flush the rename itself; not every platform supports syncing a
+	// directory, so failures are ignored
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// Ping checks that the directory the file is saved in is still there, so
+// changes can be saved
+func (r *JSONFileUserRepository) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	info, err := os.Stat(filepath.Dir(r.path))
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", filepath.Dir(r.path))
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package repository_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+// openJSONFile opens a JSON file repository in a temporary directory,
+// holding users
+func openJSONFile(tb testing.TB, users []models.UserProfile) *repository.JSONFileUserRepository {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "users.json")
+	if users != nil {
+		data, err := json.Marshal(users)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	repo, err := repository.OpenJSONFile(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return repo
+}
+
+// TestJSONFilePing checks that the file backend is ready while the directory
+// it saves to exists, and not once it is gone
+func TestJSONFilePing(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := repository.OpenJSONFile(filepath.Join(dir, "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := repo.Ping(ctx); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := repo.Ping(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("Ping with a cancelled context: %v, want context.Canceled", err)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Ping(ctx); err == nil {
+		t.Error("Ping succeeded without the directory")
+	}
+}
+
+func BenchmarkJSONFile(b *testing.B) {
+	benchmarkReads(b, benchSizes, func(b *testing.B, users []models.UserProfile) repository.UserRepository {
+		return openJSONFile(b, users)
+	})
+}
@@ -0,0 +1,342 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"userprofile-api/models"
+)
+
+// InMemoryUserRepository stores users in a slice held in memory, in the
+// order they were created, with a map from ID to position for lookups. It is
+// safe for concurrent use: reads share a read lock and writes take the write
+// lock. Users are cloned on the way in and out, so callers never share memory
+// with the stored users and cannot change them behind the lock's back. Its
+// methods never wait on anything but the lock, so they ignore their context.
+type InMemoryUserRepository struct {
+	mu    sync.RWMutex
+	users []models.UserProfile
+	// byID holds the position in users of every user, deleted ones
+	// included. Users are never removed individually, so positions stay
+	// valid until setUsers replaces them all.
+	byID map[string]int
+
+	// index is built by the first search after a change. Writers clear it
+	// while holding mu for writing; searches build it under indexMu.
+	indexMu sync.Mutex
+	index   *searchIndex
+
+	// audit is the audit trail of the users, oldest first, which is lost on
+	// restart like the users themselves
+	auditMu sync.Mutex
+	audit   []AuditRecord
+}
+
+// NewInMemoryUserRepository creates an in-memory repository seeded with the given users
+func NewInMemoryUserRepository(users []models.UserProfile) *InMemoryUserRepository {
+	seeded := make([]models.UserProfile, len(users))
+	now := time.Now().UTC()
+	for i := range seeded {
+		seeded[i] = users[i].Clone()
+		seeded[i].Version = max(seeded[i].Version, 1)
+		if seeded[i].CreatedAt.IsZero() {
+			seeded[i].CreatedAt = now
+		}
+		if seeded[i].UpdatedAt.IsZero() {
+			seeded[i].UpdatedAt = seeded[i].CreatedAt
+		}
+		// Users saved before statuses existed are active
+		if seeded[i].Status == "" {
+			seeded[i].Status = models.StatusActive
+		}
+	}
+	r := &InMemoryUserRepository{}
+	r.setUsers(seeded)
+	return r
+}
+
+// setUsers replaces every user and rebuilds the indexes. Callers must hold
+// the lock, unless the repository is not in use yet.
+func (r *InMemoryUserRepository) setUsers(users []models.UserProfile) {
+	r.users = users
+	r.byID = make(map[string]int, len(users))
+	for i, user := range users {
+		r.byID[user.ID] = i
+	}
+	r.index = nil
+}
+
+// List returns a page of the users matching the filter along with the
+// total number of matches
+func (r *InMemoryUserRepository) List(_ context.Context, opts ListOptions) ([]models.UserProfile, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matched := make([]models.UserProfile, 0, len(r.users))
+	for _, user := range r.users {
+		if user.DeletedAt != nil && !opts.IncludeDeleted {
+			continue
+		}
+		if opts.Filter.Matches(user) {
+			matched = append(matched, user)
+		}
+	}
+	sortUsers(matched, opts)
+	// Only the page returned is cloned; the rest are dropped
+	page := paginate(matched, opts)
+	for i := range page {
+		page[i] = page[i].Clone()
+	}
+	return page, len(matched), nil
+}
+
+// sortUsers orders users by creation time and ID when listing after a
+// cursor, and otherwise by the sort fields, keeping insertion order for ties
+func sortUsers(users []models.UserProfile, opts ListOptions) {
+	if opts.After != nil {
+		slices.SortFunc(users, func(a, b models.UserProfile) int {
+			return compareCursors(CursorOf(a), CursorOf(b))
+		})
+		return
+	}
+	fields := opts.Sort
+	if len(fields) == 0 {
+		return
+	}
+	slices.SortStableFunc(users, func(a, b models.UserProfile) int {
+		for _, field := range fields {
+			cmp := compareField(a, b, field.Field)
+			if field.Descending {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp
+			}
+		}
+		return 0
+	})
+}
+
+// compareField orders two users by a sort field, full names by their
+// collation and the other fields by code point
+func compareField(a, b models.UserProfile, field string) int {
+	if field == "fullName" {
+		return CompareNames(a.FullName, b.FullName)
+	}
+	return strings.Compare(sortValue(a, field), sortValue(b, field))
+}
+
+func sortValue(user models.UserProfile, field string) string {
+	switch field {
+	case "fullName":
+		return user.FullName
+	case "emoji":
+		return user.Emoji
+	default:
+		return user.ID
+	}
+}
+
+// paginate returns the slice of users selected by the cursor or offset and
+// the limit. Users listed after a cursor must be sorted by sortUsers.
+func paginate(users []models.UserProfile, opts ListOptions) []models.UserProfile {
+	start := min(max(opts.Offset, 0), len(users))
+	if opts.After != nil {
+		start, _ = slices.BinarySearchFunc(users, *opts.After, func(user models.UserProfile, after Cursor) int {
+			if compareCursors(CursorOf(user), after) <= 0 {
+				return -1
+			}
+			return 1
+		})
+	}
+	end := len(users)
+	if opts.Limit > 0 {
+		end = min(start+opts.Limit, end)
+	}
+	return users[start:end]
+}
+
+// Get returns the active user with the given ID
+func (r *InMemoryUserRepository) Get(_ context.Context, id string) (models.UserProfile, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.indexActive(id)
+	if i < 0 {
+		return models.UserProfile{}, ErrNotFound
+	}
+	return r.users[i].Clone(), nil
+}
+
+// GetByEmail returns the active user with the given email address
+func (r *InMemoryUserRepository) GetByEmail(_ context.Context, email string) (models.UserProfile, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.DeletedAt == nil && user.Email != "" && strings.EqualFold(user.Email, email) {
+			return user.Clone(), nil
+		}
+	}
+	return models.UserProfile{}, ErrNotFound
+}
+
+// emailTaken reports whether a user other than exceptID, including deleted
+// ones, has the email address. Callers must hold the lock.
+func (r *InMemoryUserRepository) emailTaken(email, exceptID string) bool {
+	if email == "" {
+		return false
+	}
+	return slices.ContainsFunc(r.users, func(user models.UserProfile) bool {
+		return user.ID != exceptID && strings.EqualFold(user.Email, email)
+	})
+}
+
+// indexActive returns the position of the active user with the given ID, or
+// -1 if there is none. Callers must hold the lock.
+func (r *InMemoryUserRepository) indexActive(id string) int {
+	i, ok := r.byID[id]
+	if !ok || r.users[i].DeletedAt != nil {
+		return -1
+	}
+	return i
+}
+
+// Create stores a new user, returning ErrConflict if the ID is taken
+func (r *InMemoryUserRepository) Create(_ context.Context, user models.UserProfile) (models.UserProfile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.byID[user.ID]; ok {
+		return models.UserProfile{}, ErrConflict
+	}
+	if r.emailTaken(user.Email, user.ID) {
+		return models.UserProfile{}, ErrEmailConflict
+	}
+	user.DeletedAt = nil
+	user.AvatarURL = ""
+	if user.Status == "" {
+		user.Status = models.StatusActive
+	}
+	user.Version = 1
+	user.CreatedAt = time.Now().UTC()
+	user.UpdatedAt = user.CreatedAt
+	r.byID[user.ID] = len(r.users)
+	// The store keeps its own copy, so the caller's tags and metadata stay
+	// theirs
+	r.users = append(r.users, user.Clone())
+	r.index = nil
+	return user, nil
+}
+
+// Update replaces the active user with the given ID and increments its
+// version
+func (r *InMemoryUserRepository) Update(_ context.Context, id string, user models.UserProfile) (models.UserProfile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.indexActive(id)
+	if i < 0 {
+		return models.UserProfile{}, ErrNotFound
+	}
+	if user.Version != 0 && user.Version != r.users[i].Version {
+		return models.UserProfile{}, ErrVersionMismatch
+	}
+	if r.emailTaken(user.Email, id) {
+		return models.UserProfile{}, ErrEmailConflict
+	}
+	user.ID = id // Ensure ID doesn't change
+	user.DeletedAt = nil
+	user.AvatarURL = r.users[i].AvatarURL
+	if user.Status == "" {
+		user.Status = r.users[i].Status
+	}
+	user.Version = r.users[i].Version + 1
+	user.CreatedAt = r.users[i].CreatedAt
+	user.UpdatedAt = time.Now().UTC()
+	r.users[i] = user.Clone()
+	r.index = nil
+	return user, nil
+}
+
+// Delete soft-deletes the active user with the given ID
+func (r *InMemoryUserRepository) Delete(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.indexActive(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	deletedAt := time.Now().UTC()
+	r.users[i].DeletedAt = &deletedAt
+	r.users[i].Version++
+	r.users[i].UpdatedAt = deletedAt
+	r.index = nil
+	return nil
+}
+
+// SetAvatarURL records the location of the active user's avatar
+func (r *InMemoryUserRepository) SetAvatarURL(_ context.Context, id string, avatarURL string) (models.UserProfile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.indexActive(id)
+	if i < 0 {
+		return models.UserProfile{}, ErrNotFound
+	}
+	r.users[i].AvatarURL = avatarURL
+	r.users[i].Version++
+	r.users[i].UpdatedAt = time.Now().UTC()
+	r.index = nil
+	return r.users[i].Clone(), nil
+}
+
+// Stats summarizes the active users
+func (r *InMemoryUserRepository) Stats(_ context.Context) (UserStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return computeStats(r.users, time.Now().UTC()), nil
+}
+
+// Search returns the active users whose full name or bio contains every
+// word of the query, most relevant first
+func (r *InMemoryUserRepository) Search(_ context.Context, opts SearchOptions) ([]SearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	r.indexMu.Lock()
+	if r.index == nil {
+		r.index = newSearchIndex(r.users)
+	}
+	index := r.index
+	r.indexMu.Unlock()
+	return index.search(opts), nil
+}
+
+// Reset permanently removes every user
+func (r *InMemoryUserRepository) Reset(_ context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.setUsers(nil)
+	return nil
+}
+
+// Restore undeletes the deleted user with the given ID
+func (r *InMemoryUserRepository) Restore(_ context.Context, id string) (models.UserProfile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, ok := r.byID[id]
+	if !ok || r.users[i].DeletedAt == nil {
+		return models.UserProfile{}, ErrNotFound
+	}
+	r.users[i].DeletedAt = nil
+	r.users[i].Version++
+	r.users[i].UpdatedAt = time.Now().UTC()
+	r.index = nil
+	return r.users[i].Clone(), nil
+}
@@ -0,0 +1,240 @@
+package repository_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+// TestInMemoryConcurrentChanges creates, updates and deletes users from many
+// goroutines while others read them; run it with -race to check the store's
+// locking
+func TestInMemoryConcurrentChanges(t *testing.T) {
+	const workers = 50
+	ctx := context.Background()
+	repo := repository.NewInMemoryUserRepository(nil)
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, _, err := repo.List(ctx, repository.ListOptions{Limit: 10}); err != nil {
+					t.Error(err)
+					return
+				}
+				repo.Get(ctx, "user-0")
+				repo.Stats(ctx)
+			}
+		}()
+	}
+
+	var changes sync.WaitGroup
+	for i := range workers {
+		changes.Add(1)
+		go func() {
+			defer changes.Done()
+			id := fmt.Sprintf("user-%d", i)
+			created, err := repo.Create(ctx, models.UserProfile{ID: id, FullName: "User", Email: id + "@example.com"})
+			if err != nil {
+				t.Errorf("Create(%s): %v", id, err)
+				return
+			}
+			created.FullName = "Renamed"
+			if _, err := repo.Update(ctx, id, created); err != nil {
+				t.Errorf("Update(%s): %v", id, err)
+				return
+			}
+			// The first update moved the user past the version it was read at
+			if _, err := repo.Update(ctx, id, created); !errors.Is(err, repository.ErrVersionMismatch) {
+				t.Errorf("Update(%s) at a stale version: %v, want ErrVersionMismatch", id, err)
+			}
+			if i%2 == 1 {
+				if err := repo.Delete(ctx, id); err != nil {
+					t.Errorf("Delete(%s): %v", id, err)
+				}
+			}
+		}()
+	}
+	changes.Wait()
+	close(done)
+	wg.Wait()
+
+	users, total, err := repo.List(ctx, repository.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != workers/2 {
+		t.Errorf("%d active users, want %d", total, workers/2)
+	}
+	for _, user := range users {
+		if user.FullName != "Renamed" || user.Version != 2 {
+			t.Errorf("user %s: name %q at version %d, want \"Renamed\" at version 2", user.ID, user.FullName, user.Version)
+		}
+	}
+}
+
+// TestInMemoryConcurrentUpdatesOfOneUser checks that of concurrent updates
+// made to the same version of a user, exactly one is saved
+func TestInMemoryConcurrentUpdatesOfOneUser(t *testing.T) {
+	const writers = 20
+	ctx := context.Background()
+	repo := repository.NewInMemoryUserRepository(nil)
+	user, err := repo.Create(ctx, models.UserProfile{ID: "shared", FullName: "Shared", Email: "shared@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var saved, mismatched atomic.Int32
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			change := user
+			change.FullName = fmt.Sprintf("Writer %d", i)
+			_, err := repo.Update(ctx, user.ID, change)
+			switch {
+			case err == nil:
+				saved.Add(1)
+			case errors.Is(err, repository.ErrVersionMismatch):
+				mismatched.Add(1)
+			default:
+				t.Errorf("Update: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if saved.Load() != 1 || mismatched.Load() != writers-1 {
+		t.Errorf("%d updates saved and %d refused, want 1 and %d", saved.Load(), mismatched.Load(), writers-1)
+	}
+	if current, err := repo.Get(ctx, user.ID); err != nil || current.Version != 2 {
+		t.Errorf("Get: version %d, %v; want version 2", current.Version, err)
+	}
+}
+
+func BenchmarkInMemory(b *testing.B) {
+	benchmarkReads(b, benchSizes, func(_ *testing.B, users []models.UserProfile) repository.UserRepository {
+		return repository.NewInMemoryUserRepository(users)
+	})
+}
+
+// copyStrategy copies the users a read returns, and replaces a user on a
+// write
+type copyStrategy struct {
+	name  string
+	read  func(users []models.UserProfile) []models.UserProfile
+	write func(users []models.UserProfile, i int, user models.UserProfile) []models.UserProfile
+}
+
+// replace changes the user in place, which is safe while reads copy
+func replace(users []models.UserProfile, i int, user models.UserProfile) []models.UserProfile {
+	users[i] = user
+	return users
+}
+
+// copyStrategies are the ways the in-memory store could hand out its users:
+// value copies whose deletion times still point into the store, as it
+// returned them before it cloned users; clones sharing no memory with the
+// store, as it returns them now; copies made by a JSON round trip; and an
+// immutable slice shared by reads that each write copies
+var copyStrategies = []copyStrategy{
+	{name: "shared", read: slices.Clone[[]models.UserProfile], write: replace},
+	{name: "clone", read: cloneAll, write: replace},
+	{name: "json", read: jsonCopy, write: replace},
+	{
+		name: "snapshot",
+		read: func(users []models.UserProfile) []models.UserProfile { return users },
+		write: func(users []models.UserProfile, i int, user models.UserProfile) []models.UserProfile {
+			users = slices.Clone(users)
+			users[i] = user
+			return users
+		},
+	},
+}
+
+func cloneAll(users []models.UserProfile) []models.UserProfile {
+	copies := make([]models.UserProfile, len(users))
+	for i, user := range users {
+		copies[i] = user.Clone()
+	}
+	return copies
+}
+
+func jsonCopy(users []models.UserProfile) []models.UserProfile {
+	data, err := json.Marshal(users)
+	if err != nil {
+		panic(err)
+	}
+	var copies []models.UserProfile
+	if err := json.Unmarshal(data, &copies); err != nil {
+		panic(err)
+	}
+	return copies
+}
+
+// BenchmarkCopyStrategies compares what reading every user costs when each
+// read copies them with what replacing one costs when reads share a snapshot
+func BenchmarkCopyStrategies(b *testing.B) {
+	for _, n := range benchSizes {
+		users := benchUsers(n)
+		for _, s := range copyStrategies {
+			b.Run(fmt.Sprintf("users=%d/%s/read_all", n, s.name), func(b *testing.B) {
+				b.ReportAllocs()
+				for range b.N {
+					s.read(users)
+				}
+			})
+			b.Run(fmt.Sprintf("users=%d/%s/replace_one", n, s.name), func(b *testing.B) {
+				b.ReportAllocs()
+				current := slices.Clone(users)
+				for i := range b.N {
+					current = s.write(current, i%n, users[i%n])
+				}
+			})
+		}
+	}
+}
+
+// found keeps the lookups benchmarked from being optimized away
+var found int
+
+// BenchmarkLookup compares finding a user by ID with a linear scan, as the
+// in-memory store did before it indexed its users, and with the map from ID
+// to position it keeps now
+func BenchmarkLookup(b *testing.B) {
+	for _, n := range benchSizes {
+		users := benchUsers(n)
+		byID := make(map[string]int, n)
+		for i, user := range users {
+			byID[user.ID] = i
+		}
+		b.Run(fmt.Sprintf("users=%d/scan", n), func(b *testing.B) {
+			for i := range b.N {
+				id := users[i%n].ID
+				found = slices.IndexFunc(users, func(user models.UserProfile) bool { return user.ID == id })
+			}
+		})
+		b.Run(fmt.Sprintf("users=%d/map", n), func(b *testing.B) {
+			for i := range b.N {
+				found = byID[users[i%n].ID]
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" database/sql driver
+	_ "modernc.org/sqlite"             // registers the "sqlite" database/sql driver
+	"userprofile-api/config"
+	"userprofile-api/migrations"
+)
+
+// Open creates the repository selected by the database configuration. The
+// in-memory backend starts out empty; the JSON file, SQL and DynamoDB
+// backends keep whatever data they already hold, and SQL backends have their
+// schema migrated first if configured to.
+func Open(cfg config.DatabaseConfig) (UserRepository, error) {
+	switch cfg.Driver {
+	case config.DriverMemory:
+		return NewInMemoryUserRepository(nil), nil
+	case config.DriverJSON:
+		return OpenJSONFile(jsonFilePath(cfg.URL))
+	case config.DriverDynamoDB:
+		return OpenDynamoDB(cfg.DynamoDB)
+	}
+
+	db, err := OpenDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := prepareSchema(db, cfg); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if cfg.Driver == config.DriverPostgres {
+		return NewPostgresUserRepository(db), nil
+	}
+	return NewSQLiteUserRepository(db), nil
+}
+
+// OpenDB connects to the configured SQL database without opening a
+// repository, e.g. to manage its schema
+func OpenDB(cfg config.DatabaseConfig) (*sql.DB, error) {
+	switch cfg.Driver {
+	case config.DriverPostgres:
+		return openDB("pgx", cfg)
+	case config.DriverSQLite:
+		sqliteCfg := cfg
+		sqliteCfg.URL = sqliteDSN(cfg.URL)
+		return openDB("sqlite", sqliteCfg)
+	default:
+		return nil, fmt.Errorf("unsupported SQL database driver %q", cfg.Driver)
+	}
+}
+
+// prepareSchema applies pending migrations, or with auto-migration off,
+// refuses to run against a schema that is not up to date
+func prepareSchema(db *sql.DB, cfg config.DatabaseConfig) error {
+	migrator, err := migrations.New(db, cfg.Driver)
+	if err != nil {
+		return err
+	}
+	if cfg.AutoMigrate {
+		_, err := migrator.Up()
+		return err
+	}
+
+	pending, err := migrator.Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is missing migrations %s; run usersctl migrate up or set DB_AUTO_MIGRATE=true",
+			strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// openDB opens a connection pool and verifies the database is reachable
+func openDB(driverName string, cfg config.DatabaseConfig) (*sql.DB, error) {
+	db, err := sql.Open(driverName, cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect to %s: %w", cfg.Driver, err)
+	}
+	return db, nil
+}
+
+// jsonFilePath converts a json:// URL into the path of the file
+func jsonFilePath(url string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(url, "json://"), "json:")
+}
+
+// sqliteDSN converts a sqlite:// URL into a DSN for the SQLite driver. Unless
+// given explicitly, it enables WAL journaling and a busy timeout, so
+// concurrent requests wait for locks instead of failing, and stores times in
+// SQLite's own sortable text format.
+func sqliteDSN(url string) string {
+	dsn := strings.TrimPrefix(strings.TrimPrefix(url, "sqlite://"), "sqlite:")
+
+	var params []string
+	if !strings.Contains(dsn, "_pragma=") {
+		params = append(params, "_pragma=busy_timeout(5000)", "_pragma=journal_mode(WAL)")
+	}
+	if !strings.Contains(dsn, "_time_format=") {
+		params = append(params, "_time_format=sqlite")
+	}
+	if len(params) == 0 {
+		return dsn
+	}
+
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + strings.Join(params, "&")
+}
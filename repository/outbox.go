@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"userprofile-api/models"
+)
+
+// Change is a kind of change to a user recorded in an outbox
+type Change string
+
+// Changes recorded in an outbox
+const (
+	ChangeCreated  Change = "created"
+	ChangeUpdated  Change = "updated"
+	ChangeDeleted  Change = "deleted"
+	ChangeRestored Change = "restored"
+)
+
+// OutboxMessage is a serialized change event kept in the outbox until it has
+// been published
+type OutboxMessage struct {
+	// ID orders the messages of an outbox; it is set when the message is
+	// stored
+	ID int64
+	// Topic is where the message is published
+	Topic string
+	// Key keeps the messages about one user in order, e.g. on one Kafka
+	// partition
+	Key       string
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+// OutboxEncoder serializes a change to a user into the message recorded with
+// it. Deleted users are passed as they were before the deletion.
+type OutboxEncoder func(change Change, user models.UserProfile) (OutboxMessage, error)
+
+// Outbox is implemented by repositories that record an event in the same
+// transaction as every change to a user, so that events are published for
+// exactly the changes that were committed
+type Outbox interface {
+	// UseOutbox makes every later change record the message encode returns;
+	// a change whose message cannot be encoded fails
+	UseOutbox(encode OutboxEncoder)
+	// PendingOutbox returns up to limit of the oldest recorded messages
+	PendingOutbox(ctx context.Context, limit int) ([]OutboxMessage, error)
+	// DeleteOutbox removes messages once they have been published
+	DeleteOutbox(ctx context.Context, ids []int64) error
+}
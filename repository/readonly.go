@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+
+	"userprofile-api/models"
+)
+
+// readOnlyRepository rejects every change with ErrReadOnly
+type readOnlyRepository struct {
+	UserRepository
+}
+
+// ReadOnly wraps a repository so that users can be read but not changed
+func ReadOnly(next UserRepository) UserRepository {
+	return &readOnlyRepository{UserRepository: next}
+}
+
+// Writable returns the repository a ReadOnly wrapper was made for, or repo
+// itself when it is not one
+func Writable(repo UserRepository) UserRepository {
+	if readOnly, ok := repo.(*readOnlyRepository); ok {
+		return readOnly.UserRepository
+	}
+	return repo
+}
+
+func (r *readOnlyRepository) Create(context.Context, models.UserProfile) (models.UserProfile, error) {
+	return models.UserProfile{}, ErrReadOnly
+}
+
+func (r *readOnlyRepository) Update(context.Context, string, models.UserProfile) (models.UserProfile, error) {
+	return models.UserProfile{}, ErrReadOnly
+}
+
+func (r *readOnlyRepository) Delete(context.Context, string) error {
+	return ErrReadOnly
+}
+
+func (r *readOnlyRepository) SetAvatarURL(context.Context, string, string) (models.UserProfile, error) {
+	return models.UserProfile{}, ErrReadOnly
+}
+
+func (r *readOnlyRepository) Restore(context.Context, string) (models.UserProfile, error) {
+	return models.UserProfile{}, ErrReadOnly
+}
+
+// Reset is rejected like the other changes rather than reported as
+// unsupported
+func (r *readOnlyRepository) Reset(context.Context) error {
+	return ErrReadOnly
+}
+
+// Ping checks the wrapped repository, so readiness keeps reflecting the
+// storage backend
+func (r *readOnlyRepository) Ping(ctx context.Context) error {
+	if pinger, ok := r.UserRepository.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// Stream reads through the wrapped repository, which may stream its users
+func (r *readOnlyRepository) Stream(ctx context.Context, opts ListOptions, yield func(user models.UserProfile) error) error {
+	return Stream(ctx, r.UserRepository, opts, yield)
+}
+
+// Transaction runs fn in a transaction of the wrapped repository, so its
+// reads are consistent; its changes are rejected all the same
+func (r *readOnlyRepository) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return Transaction(ctx, r.UserRepository, fn)
+}
+
+// RecordAudit is rejected like the changes it would describe
+func (r *readOnlyRepository) RecordAudit(context.Context, AuditRecord) error {
+	return ErrReadOnly
+}
+
+// MoveAudit is rejected like the merge it is part of
+func (r *readOnlyRepository) MoveAudit(context.Context, string, string) error {
+	return ErrReadOnly
+}
+
+// Trail reads through the wrapped repository
+func (r *readOnlyRepository) Trail(ctx context.Context, userID string) ([]AuditRecord, error) {
+	return Trail(ctx, r.UserRepository, userID)
+}
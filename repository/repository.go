@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"userprofile-api/models"
+)
+
+// ErrNotFound is returned when the requested user does not exist
+var ErrNotFound = errors.New("user not found")
+
+// ErrConflict is returned when creating a user whose ID is already taken
+var ErrConflict = errors.New("user already exists")
+
+// ErrEmailConflict is returned when creating or updating a user with an
+// email address another user already has. It wraps ErrConflict.
+var ErrEmailConflict = fmt.Errorf("email already in use: %w", ErrConflict)
+
+// ErrVersionMismatch is returned when updating a user whose version differs
+// from the expected one, i.e. it was changed by someone else in the meantime
+var ErrVersionMismatch = errors.New("user version does not match")
+
+// ErrReadOnly is returned when changing users through a read replica, whose
+// users only change with those of its primary
+var ErrReadOnly = errors.New("users are read-only on this replica")
+
+// ListOptions controls which page of users List returns
+type ListOptions struct {
+	// Offset is the number of users to skip
+	Offset int
+	// Limit is the maximum number of users to return; zero means no limit
+	Limit int
+	// Filter restricts which users are listed and counted
+	Filter UserFilter
+	// Sort orders the users before the page is taken; ties keep insertion order
+	Sort []SortField
+	// IncludeDeleted lists soft-deleted users alongside active ones
+	IncludeDeleted bool
+	// After, when set, lists the users that follow it instead of applying
+	// Offset and Sort, in an order defined by the backend that is stable
+	// across pages, so paging lists every user once while users are added:
+	// creation time and then ID for the in-memory and SQL backends, and scan
+	// order for DynamoDB. The zero Cursor lists from the first user.
+	After *Cursor
+}
+
+// Cursor is a position in the list of users: the creation time and ID of
+// the user it follows, of which DynamoDB uses only the ID
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// CursorOf returns the position of a user
+func CursorOf(user models.UserProfile) Cursor {
+	return Cursor{CreatedAt: user.CreatedAt, ID: user.ID}
+}
+
+// compareCursors orders positions by creation time and then ID
+func compareCursors(a, b Cursor) int {
+	return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+}
+
+// SortableFields lists the user attributes List can sort by
+var SortableFields = []string{"id", "fullName", "emoji"}
+
+// SortField orders listed users by a single attribute
+type SortField struct {
+	// Field is one of SortableFields
+	Field string
+	// Descending reverses the order for this field
+	Descending bool
+}
+
+// ParseSort parses a comma-separated sort expression such as "fullName,-id",
+// where a leading "-" sorts that field in descending order
+func ParseSort(expr string) ([]SortField, error) {
+	if expr == "" {
+		return nil, nil
+	}
+
+	var fields []SortField
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		field := SortField{Field: strings.TrimPrefix(part, "-"), Descending: strings.HasPrefix(part, "-")}
+		if !slices.Contains(SortableFields, field.Field) {
+			return nil, fmt.Errorf("cannot sort by %q: allowed fields are %s", field.Field, strings.Join(SortableFields, ", "))
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// UserFilter narrows the users returned by List. Empty fields match every user
+// and non-empty fields are combined with AND.
+type UserFilter struct {
+	// FullName matches users whose full name contains the value, ignoring case
+	FullName string
+	// Emoji matches users with exactly this emoji
+	Emoji string
+	// Query matches users whose ID, full name or emoji contains the value,
+	// ignoring case
+	Query string
+	// Tag matches users with exactly this tag among theirs
+	Tag string
+	// Statuses matches users with any of these statuses
+	Statuses []models.Status
+}
+
+// Matches reports whether the user satisfies every condition of the filter
+func (f UserFilter) Matches(user models.UserProfile) bool {
+	if f.FullName != "" && !containsFold(user.FullName, f.FullName) {
+		return false
+	}
+	if f.Emoji != "" && user.Emoji != f.Emoji {
+		return false
+	}
+	if f.Query != "" &&
+		!containsFold(user.ID, f.Query) &&
+		!containsFold(user.FullName, f.Query) &&
+		!containsFold(user.Emoji, f.Query) {
+		return false
+	}
+	if f.Tag != "" && !slices.Contains(user.Tags, f.Tag) {
+		return false
+	}
+	if len(f.Statuses) > 0 && !slices.Contains(f.Statuses, user.Status) {
+		return false
+	}
+	return true
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(normalizeQuery(substr)))
+}
+
+// UserRepository defines the storage operations for user profiles. Every
+// method takes the context of the request it serves; implementations backed
+// by a database or a remote service give up once it is done, returning its
+// error.
+type UserRepository interface {
+	// List returns a page of the users matching the filter along with the
+	// total number of matches, or -1 when listing after a cursor from a
+	// backend that cannot count them without reading every user
+	List(ctx context.Context, opts ListOptions) ([]models.UserProfile, int, error)
+	// Get returns the active user with the given ID
+	Get(ctx context.Context, id string) (models.UserProfile, error)
+	// GetByEmail returns the active user with the given email address,
+	// ignoring case
+	GetByEmail(ctx context.Context, email string) (models.UserProfile, error)
+	// Create stores a new user at version 1, active unless it has another
+	// status, returning ErrConflict if the ID is taken or ErrEmailConflict if
+	// the email is
+	Create(ctx context.Context, user models.UserProfile) (models.UserProfile, error)
+	// Update replaces the active user with the given ID and increments its
+	// version, keeping its avatar, and its status when user has none. A
+	// non-zero user.Version must match the stored version, or
+	// ErrVersionMismatch is returned. ErrEmailConflict is returned if another
+	// user has the new email.
+	Update(ctx context.Context, id string, user models.UserProfile) (models.UserProfile, error)
+	// Delete soft-deletes the active user with the given ID, hiding it from
+	// List and Get until it is restored, and increments its version
+	Delete(ctx context.Context, id string) error
+	// SetAvatarURL records the location of the active user's avatar and
+	// increments its version
+	SetAvatarURL(ctx context.Context, id string, avatarURL string) (models.UserProfile, error)
+	// Restore undeletes the deleted user with the given ID and increments
+	// its version. Restoring an active user fails with ErrNotFound.
+	Restore(ctx context.Context, id string) (models.UserProfile, error)
+	// Stats summarizes the active users
+	Stats(ctx context.Context) (UserStats, error)
+	// Search returns the active users whose full name or bio contains
+	// every word of the query, or a word within opts.Fuzziness edits of
+	// it, most relevant first
+	Search(ctx context.Context, opts SearchOptions) ([]SearchResult, error)
+}
+
+// Resetter is implemented by repositories that can permanently remove every
+// user, deleted ones included
+type Resetter interface {
+	Reset(ctx context.Context) error
+}
+
+// Reset permanently removes every user from the repository, or returns
+// errors.ErrUnsupported if it cannot be reset
+func Reset(ctx context.Context, repo UserRepository) error {
+	resetter, ok := repo.(Resetter)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return resetter.Reset(ctx)
+}
+
+// Pinger is implemented by repositories backed by an external service that
+// can be checked for reachability
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Streamer is implemented by repositories that can pass the users a list
+// selects to a function as they are read, without holding them all in memory
+type Streamer interface {
+	// Stream passes the users List would return to yield, in order, and
+	// stops at the first error yield returns
+	Stream(ctx context.Context, opts ListOptions, yield func(user models.UserProfile) error) error
+}
+
+// Stream passes the users a list selects to yield as they are read from
+// repositories that can stream them, and after listing them from others
+func Stream(ctx context.Context, repo UserRepository, opts ListOptions, yield func(user models.UserProfile) error) error {
+	if streamer, ok := repo.(Streamer); ok {
+		return streamer.Stream(ctx, opts, yield)
+	}
+	users, _, err := repo.List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if err := yield(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+
+	"userprofile-api/models"
+	"userprofile-api/repository"
+	"userprofile-api/seed"
+)
+
+// benchSizes are the numbers of users the in-memory backends are benchmarked
+// with
+var benchSizes = []int{1000, 10000, 100000}
+
+// benchUsers returns n made-up users as they would be stored, of which about
+// a tenth are soft-deleted
+func benchUsers(n int) []models.UserProfile {
+	r := rand.New(rand.NewPCG(1, 2))
+	users := seed.Generate(n, r)
+	now := time.Now().UTC()
+	for i := range users {
+		users[i].Version = 1
+		users[i].CreatedAt, users[i].UpdatedAt = now, now
+		if r.Float64() < 0.1 {
+			deletedAt := now
+			users[i].DeletedAt = &deletedAt
+		}
+	}
+	return users
+}
+
+// benchmarkReads measures List and Get of the repositories open returns
+// holding each number of users
+func benchmarkReads(b *testing.B, sizes []int, open func(b *testing.B, users []models.UserProfile) repository.UserRepository) {
+	ctx := context.Background()
+	for _, n := range sizes {
+		users := benchUsers(n)
+		repo := open(b, users)
+		b.Run(fmt.Sprintf("users=%d/List", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				if _, _, err := repo.List(ctx, repository.ListOptions{IncludeDeleted: true}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("users=%d/Get", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := range b.N {
+				repo.Get(ctx, users[i%n].ID)
+			}
+		})
+	}
+}
+
+// backends open each repository backend holding the given users, keeping
+// their creation and deletion times
+var backends = []struct {
+	name string
+	open func(t *testing.T, users []models.UserProfile) repository.UserRepository
+}{
+	{"memory", func(_ *testing.T, users []models.UserProfile) repository.UserRepository {
+		return repository.NewInMemoryUserRepository(users)
+	}},
+	{"jsonfile", func(t *testing.T, users []models.UserProfile) repository.UserRepository {
+		return openJSONFile(t, users)
+	}},
+	{"sqlite", func(t *testing.T, users []models.UserProfile) repository.UserRepository {
+		return openSQLite(t, users)
+	}},
+}
+
+// TestStats checks the counts every backend summarizes its active users
+// with, leaving deleted users out
+func TestStats(t *testing.T) {
+	now := time.Now().UTC()
+	user := func(id, emoji string, age time.Duration, deleted bool, tags ...string) models.UserProfile {
+		u := models.UserProfile{ID: id, FullName: "User " + id, Emoji: emoji, Email: id + "@example.com", Tags: tags,
+			CreatedAt: now.Add(-age)}
+		if deleted {
+			deletedAt := now
+			u.DeletedAt = &deletedAt
+		}
+		return u
+	}
+	const day = 24 * time.Hour
+
+	tests := []struct {
+		name  string
+		users []models.UserProfile
+		want  repository.UserStats
+	}{
+		{"no users", nil, repository.UserStats{}},
+		{
+			"created over a month",
+			[]models.UserProfile{
+				user("a", "😀", time.Hour, false, "math"),
+				user("b", "😀", 2*day, false, "math", "chess"),
+				user("c", "🚀", 30*day, false),
+				user("d", "🚀", time.Hour, true, "chess"),
+				user("e", "😀", 3*day, true),
+			},
+			repository.UserStats{
+				Total:          3,
+				ByEmoji:        []repository.EmojiCount{{Emoji: "😀", Count: 2}, {Emoji: "🚀", Count: 1}},
+				ByTag:          []repository.TagCount{{Tag: "math", Count: 2}, {Tag: "chess", Count: 1}},
+				CreatedLast24h: 1,
+				CreatedLast7d:  2,
+			},
+		},
+		{
+			"only deleted users",
+			[]models.UserProfile{user("a", "😀", time.Hour, true, "math"), user("b", "🚀", 2*day, true)},
+			repository.UserStats{},
+		},
+		{
+			"tied counts",
+			[]models.UserProfile{user("a", "🚀", 8*day, false, "b"), user("b", "😀", 8*day, false, "a")},
+			repository.UserStats{
+				Total:   2,
+				ByEmoji: []repository.EmojiCount{{Emoji: "😀", Count: 1}, {Emoji: "🚀", Count: 1}},
+				ByTag:   []repository.TagCount{{Tag: "a", Count: 1}, {Tag: "b", Count: 1}},
+			},
+		},
+	}
+	for _, backend := range backends {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				stats, err := backend.open(t, tt.users).Stats(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stats.Total != tt.want.Total || stats.CreatedLast24h != tt.want.CreatedLast24h ||
+					stats.CreatedLast7d != tt.want.CreatedLast7d || !slices.Equal(stats.ByEmoji, tt.want.ByEmoji) ||
+					!slices.Equal(stats.ByTag, tt.want.ByTag) {
+					t.Errorf("Stats = %+v, want %+v", stats, tt.want)
+				}
+			})
+		}
+	}
+}
+
+// TestListCombinedFilters checks that every backend's List keeps only the
+// users matching every condition of a filter at once, and counts them all
+// regardless of the page
+func TestListCombinedFilters(t *testing.T) {
+	deletedAt := time.Now().UTC()
+	users := []models.UserProfile{
+		{ID: "1", FullName: "Ada Lovelace", Emoji: "😀", Tags: []string{"math"}, Status: models.StatusActive},
+		{ID: "2", FullName: "Ada Byron", Emoji: "🚀", Tags: []string{"math", "poetry"}, Status: models.StatusSuspended},
+		{ID: "3", FullName: "Grace Hopper", Emoji: "🚀", Tags: []string{"navy"}, Status: models.StatusActive},
+		{ID: "4", FullName: "Alan Turing", Emoji: "😀", Tags: []string{"math"}, Status: models.StatusArchived},
+		{ID: "5", FullName: "Ada Gone", Emoji: "😀", Tags: []string{"math"}, DeletedAt: &deletedAt},
+	}
+
+	tests := []struct {
+		name           string
+		filter         repository.UserFilter
+		includeDeleted bool
+		limit          int
+		want           []string
+		wantTotal      int
+	}{
+		{"name and emoji", repository.UserFilter{FullName: "ada", Emoji: "😀"}, false, 0, []string{"1"}, 1},
+		{"name and tag", repository.UserFilter{FullName: "ADA", Tag: "math"}, false, 0, []string{"1", "2"}, 2},
+		{"name, tag and status",
+			repository.UserFilter{FullName: "ada", Tag: "math", Statuses: []models.Status{models.StatusSuspended}},
+			false, 0, []string{"2"}, 1},
+		{"query and emoji", repository.UserFilter{Query: "ing", Emoji: "😀"}, false, 0, []string{"4"}, 1},
+		{"query, emoji and status",
+			repository.UserFilter{Query: "ing", Emoji: "😀", Statuses: []models.Status{models.StatusActive, models.StatusSuspended}},
+			false, 0, nil, 0},
+		{"emoji and tag", repository.UserFilter{Emoji: "🚀", Tag: "navy"}, false, 0, []string{"3"}, 1},
+		{"name and emoji with deleted users", repository.UserFilter{FullName: "ada", Emoji: "😀"}, true, 0, []string{"1", "5"}, 2},
+		{"name and tag on a page", repository.UserFilter{FullName: "ada", Tag: "math"}, false, 1, []string{"1"}, 2},
+		{"conflicting conditions", repository.UserFilter{FullName: "grace", Tag: "math"}, false, 0, nil, 0},
+	}
+	for _, backend := range backends {
+		repo := backend.open(t, users)
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				users, total, err := repo.List(context.Background(), repository.ListOptions{
+					Filter:         tt.filter,
+					IncludeDeleted: tt.includeDeleted,
+					Limit:          tt.limit,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				var ids []string
+				for _, user := range users {
+					ids = append(ids, user.ID)
+				}
+				if !slices.Equal(ids, tt.want) || total != tt.wantTotal {
+					t.Errorf("List: users %v of %d, want %v of %d", ids, total, tt.want, tt.wantTotal)
+				}
+			})
+		}
+	}
+}
+
+// TestDeleteAndRestore checks that deleting and restoring a user each
+// increment its version and update time, and that only deleted users can be
+// restored
+func TestDeleteAndRestore(t *testing.T) {
+	ctx := context.Background()
+	deletedAt := time.Now().UTC().Add(-time.Hour)
+	users := []models.UserProfile{
+		{ID: "1", FullName: "Ada Lovelace", Email: "ada@example.com"},
+		{ID: "2", FullName: "Grace Hopper", Email: "grace@example.com", DeletedAt: &deletedAt},
+	}
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			repo := backend.open(t, users)
+			before, err := repo.Get(ctx, "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := repo.Delete(ctx, "1"); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			all, _, err := repo.List(ctx, repository.ListOptions{IncludeDeleted: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			i := slices.IndexFunc(all, func(user models.UserProfile) bool { return user.ID == "1" })
+			if i < 0 || all[i].DeletedAt == nil {
+				t.Fatalf("List: user 1 missing or not deleted after Delete")
+			}
+			deleted := all[i]
+			if deleted.Version != before.Version+1 || !deleted.UpdatedAt.After(before.UpdatedAt) {
+				t.Errorf("Delete: version %d updated at %v, want version %d updated after %v",
+					deleted.Version, deleted.UpdatedAt, before.Version+1, before.UpdatedAt)
+			}
+
+			restored, err := repo.Restore(ctx, "1")
+			if err != nil {
+				t.Fatalf("Restore: %v", err)
+			}
+			if restored.DeletedAt != nil || restored.Version != deleted.Version+1 || restored.UpdatedAt.Before(deleted.UpdatedAt) {
+				t.Errorf("Restore: deleted at %v, version %d updated at %v; want active at version %d updated since %v",
+					restored.DeletedAt, restored.Version, restored.UpdatedAt, deleted.Version+1, deleted.UpdatedAt)
+			}
+
+			for _, id := range []string{"1", "missing"} {
+				if _, err := repo.Restore(ctx, id); !errors.Is(err, repository.ErrNotFound) {
+					t.Errorf("Restore(%s) of a user that is not deleted: %v, want ErrNotFound", id, err)
+				}
+			}
+			if current, err := repo.Get(ctx, "1"); err != nil || current.Version != restored.Version {
+				t.Errorf("Get after a failed Restore: version %d, %v; want version %d", current.Version, err, restored.Version)
+			}
+
+			restored, err = repo.Restore(ctx, "2")
+			if err != nil || restored.DeletedAt != nil {
+				t.Errorf("Restore(2): deleted at %v, %v; want it active", restored.DeletedAt, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package repository
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"userprofile-api/models"
+)
+
+// Highlighted matches in search snippets are wrapped in these markers
+const (
+	HighlightStart = "<mark>"
+	HighlightStop  = "</mark>"
+)
+
+// SearchOptions selects the users Search returns
+type SearchOptions struct {
+	// Query holds the words to look for in full names and bios; a user must
+	// match every word, ignoring case
+	Query string
+	// Limit is the maximum number of results; zero means no limit
+	Limit int
+	// Fuzziness is the number of single-character edits a word may be away
+	// from a query word and still match it, or FuzzinessAuto. Zero matches
+	// whole words exactly.
+	Fuzziness int
+}
+
+// FuzzinessAuto allows no edits for query words of up to two letters, one
+// for words of up to five and two for longer words
+const FuzzinessAuto = -1
+
+// MaxFuzziness is the largest number of edits Fuzziness may allow
+const MaxFuzziness = 2
+
+// maxEdits returns the number of edits allowed for a query word
+func (opts SearchOptions) maxEdits(term string) int {
+	if opts.Fuzziness != FuzzinessAuto {
+		return min(opts.Fuzziness, MaxFuzziness)
+	}
+	switch n := utf8.RuneCountInString(term); {
+	case n <= 2:
+		return 0
+	case n <= 5:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// SearchResult is an active user matching a search
+type SearchResult struct {
+	User models.UserProfile
+	// Score ranks the result, higher being more relevant. Scores are only
+	// comparable within a single search.
+	Score float64
+	// Highlights holds snippets of the fields that matched
+	Highlights SearchHighlights
+}
+
+// SearchHighlights holds snippets of a user's matching fields with the
+// matched words marked; a field that did not match is empty
+type SearchHighlights struct {
+	FullName string
+	Bio      string
+}
+
+// Matches in a full name count for more than matches in a bio
+const (
+	fullNameWeight = 2.0
+	bioWeight      = 1.0
+)
+
+// snippetWords is the most words of a bio a highlight includes
+const snippetWords = 30
+
+// searchIndex is an inverted index over the full names and bios of a set
+// of users, ranking matches by TF-IDF
+type searchIndex struct {
+	users []models.UserProfile
+	// postings maps each word to the weighted number of times it occurs in
+	// each user, keyed by position in users
+	postings map[string]map[int]float64
+}
+
+// newSearchIndex indexes the active users among users
+func newSearchIndex(users []models.UserProfile) *searchIndex {
+	index := &searchIndex{postings: map[string]map[int]float64{}}
+	for _, user := range users {
+		if user.DeletedAt != nil {
+			continue
+		}
+		doc := len(index.users)
+		index.users = append(index.users, user)
+		index.add(doc, user.FullName, fullNameWeight)
+		index.add(doc, user.Bio, bioWeight)
+	}
+	return index
+}
+
+func (index *searchIndex) add(doc int, text string, weight float64) {
+	for _, word := range words(text) {
+		docs := index.postings[word.text]
+		if docs == nil {
+			docs = map[int]float64{}
+			index.postings[word.text] = docs
+		}
+		docs[doc] += weight
+	}
+}
+
+// search returns the users matching every word of the query, most relevant
+// first and then in index order. A word of a user that is a few edits away
+// from a query word matches it, contributing less the more edits it takes.
+func (index *searchIndex) search(opts SearchOptions) []SearchResult {
+	terms := uniqueTerms(opts.Query)
+	if len(terms) == 0 {
+		return []SearchResult{}
+	}
+
+	var scores map[int]float64
+	matched := map[string]bool{}
+	for _, term := range terms {
+		termScores := map[int]float64{}
+		for word, similarity := range index.expand(term, opts.maxEdits(term)) {
+			matched[word] = true
+			docs := index.postings[word]
+			idf := math.Log(1 + float64(len(index.users))/float64(len(docs)))
+			for doc, frequency := range docs {
+				termScores[doc] = max(termScores[doc], frequency*idf*similarity)
+			}
+		}
+		if scores == nil {
+			scores = termScores
+			continue
+		}
+		for doc, score := range scores {
+			if termScore, ok := termScores[doc]; ok {
+				scores[doc] = score + termScore
+			} else {
+				delete(scores, doc)
+			}
+		}
+	}
+
+	docs := make([]int, 0, len(scores))
+	for doc := range scores {
+		docs = append(docs, doc)
+	}
+	slices.SortFunc(docs, func(a, b int) int {
+		return cmp.Or(cmp.Compare(scores[b], scores[a]), cmp.Compare(a, b))
+	})
+	if opts.Limit > 0 && len(docs) > opts.Limit {
+		docs = docs[:opts.Limit]
+	}
+
+	results := make([]SearchResult, 0, len(docs))
+	for _, doc := range docs {
+		user := index.users[doc]
+		results = append(results, SearchResult{
+			User:  user.Clone(),
+			Score: scores[doc],
+			Highlights: SearchHighlights{
+				FullName: highlight(user.FullName, matched, 0),
+				Bio:      highlight(user.Bio, matched, snippetWords),
+			},
+		})
+	}
+	return results
+}
+
+// expand returns the indexed words within maxEdits edits of term, each with
+// its similarity to term: 1 for the term itself, falling with every edit
+func (index *searchIndex) expand(term string, maxEdits int) map[string]float64 {
+	if maxEdits == 0 {
+		if _, ok := index.postings[term]; ok {
+			return map[string]float64{term: 1}
+		}
+		return nil
+	}
+
+	similar := map[string]float64{}
+	target := []rune(term)
+	for word := range index.postings {
+		candidate := []rune(word)
+		if d := levenshtein(target, candidate, maxEdits); d <= maxEdits {
+			similar[word] = 1 - float64(d)/float64(max(len(target), len(candidate)))
+		}
+	}
+	return similar
+}
+
+// levenshtein returns the number of single-rune insertions, deletions and
+// substitutions turning a into b, or limit+1 once it is known to exceed
+// limit
+func levenshtein(a, b []rune, limit int) int {
+	if abs(len(a)-len(b)) > limit {
+		return limit + 1
+	}
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// word is a lower-cased word of a text and its byte offsets in the text
+type word struct {
+	text       string
+	start, end int
+}
+
+// words splits text into runs of letters and digits, along with their
+// combining marks
+func words(text string) []word {
+	var found []word
+	start := -1
+	for i, r := range text {
+		// Combining marks belong to the letter they follow
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			found = append(found, word{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		found = append(found, word{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return found
+}
+
+// uniqueTerms returns the distinct words of a query in order
+func uniqueTerms(query string) []string {
+	var terms []string
+	for _, word := range words(normalizeQuery(query)) {
+		if !slices.Contains(terms, word.text) {
+			terms = append(terms, word.text)
+		}
+	}
+	return terms
+}
+
+// highlight marks the words of text that are among matched. When maxWords is
+// positive the text is cut down to at most that many words, starting a few
+// words before the first match. It returns "" when no word matches.
+func highlight(text string, matched map[string]bool, maxWords int) string {
+	all := words(text)
+	first := slices.IndexFunc(all, func(w word) bool { return matched[w.text] })
+	if first < 0 {
+		return ""
+	}
+
+	from, to := 0, len(all)
+	if maxWords > 0 && len(all) > maxWords {
+		from = max(min(first-maxWords/4, len(all)-maxWords), 0)
+		to = from + maxWords
+	}
+	start, end := 0, len(text)
+	if from > 0 {
+		start = all[from].start
+	}
+	if to < len(all) {
+		end = all[to-1].end
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, w := range all[from:to] {
+		if !matched[w.text] {
+			continue
+		}
+		b.WriteString(text[pos:w.start])
+		b.WriteString(HighlightStart)
+		b.WriteString(text[w.start:w.end])
+		b.WriteString(HighlightStop)
+		pos = w.end
+	}
+	b.WriteString(text[pos:end])
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
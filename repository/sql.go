@@ -0,0 +1,746 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"userprofile-api/models"
+)
+
+// dialect captures the differences between the SQL databases we support
+type dialect struct {
+	// rebind rewrites a query written with $N placeholders into the
+	// placeholder syntax understood by the driver
+	rebind func(query string) string
+	// noLimit is the LIMIT value meaning "all rows"
+	noLimit string
+	// isUniqueViolation reports whether err is a primary key or unique
+	// constraint violation
+	isUniqueViolation func(err error) bool
+	// fullTextSearch reports whether Search can use PostgreSQL's text
+	// search; otherwise the active users are indexed in memory per search
+	fullTextSearch bool
+	// lower is the SQL function lower-casing every letter, not only ASCII
+	// ones, for filters to match names in any script regardless of case
+	lower string
+}
+
+var postgresDialect = dialect{
+	rebind:  func(query string) string { return query },
+	noLimit: "ALL",
+	isUniqueViolation: func(err error) bool {
+		var pgErr *pgconn.PgError
+		return errors.As(err, &pgErr) && pgErr.Code == "23505"
+	},
+	fullTextSearch: true,
+	lower:          "LOWER",
+}
+
+var dollarPlaceholder = regexp.MustCompile(`\$(\d+)`)
+
+var sqliteDialect = dialect{
+	rebind:  func(query string) string { return dollarPlaceholder.ReplaceAllString(query, "?$1") },
+	noLimit: "-1",
+	isUniqueViolation: func(err error) bool {
+		var sqliteErr *sqlite.Error
+		return errors.As(err, &sqliteErr) &&
+			(sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE)
+	},
+	lower: unicodeLower,
+}
+
+// SQLUserRepository stores users in the user_profiles table of a SQL database
+type SQLUserRepository struct {
+	db      *sql.DB
+	dialect dialect
+	// outbox encodes the message recorded with each change; nil when no
+	// outbox is used
+	outbox OutboxEncoder
+}
+
+// NewPostgresUserRepository creates a repository using an open PostgreSQL
+// handle whose schema has been migrated
+func NewPostgresUserRepository(db *sql.DB) *SQLUserRepository {
+	return &SQLUserRepository{db: db, dialect: postgresDialect}
+}
+
+// NewSQLiteUserRepository creates a repository using an open SQLite handle
+// whose schema has been migrated
+func NewSQLiteUserRepository(db *sql.DB) *SQLUserRepository {
+	return &SQLUserRepository{db: db, dialect: sqliteDialect}
+}
+
+// List returns a page of the users matching the filter, sorted by the
+// requested fields and then insertion order, along with the total number of
+// matches
+func (r *SQLUserRepository) List(ctx context.Context, opts ListOptions) ([]models.UserProfile, int, error) {
+	where, args := r.dialect.filterClause(opts.Filter, opts.IncludeDeleted)
+
+	var total int
+	if err := r.conn(ctx).QueryRowContext(ctx, r.dialect.rebind(`SELECT COUNT(*) FROM user_profiles`+where), args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	users := []models.UserProfile{}
+	err := r.query(ctx, opts, where, args, func(user models.UserProfile) error {
+		users = append(users, user)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// Stream passes the users List would return to yield as the rows are read,
+// without counting them
+func (r *SQLUserRepository) Stream(ctx context.Context, opts ListOptions, yield func(user models.UserProfile) error) error {
+	where, args := r.dialect.filterClause(opts.Filter, opts.IncludeDeleted)
+	return r.query(ctx, opts, where, args, yield)
+}
+
+// query selects the page of users opts asks for among those matching where
+// and passes each to yield
+func (r *SQLUserRepository) query(ctx context.Context, opts ListOptions, where string, args []any, yield func(user models.UserProfile) error) error {
+	limit := r.dialect.noLimit
+	if opts.Limit > 0 {
+		limit = fmt.Sprint(opts.Limit)
+	}
+	order, offset := orderClause(opts.Sort), max(opts.Offset, 0)
+	if opts.After != nil {
+		// The count covers every match, the page only those after the cursor
+		n := len(args)
+		condition := fmt.Sprintf(`(created_at > $%d OR (created_at = $%[1]d AND id > $%d))`, n+1, n+2)
+		if where == "" {
+			where = " WHERE " + condition
+		} else {
+			where += " AND " + condition
+		}
+		args = append(args, opts.After.CreatedAt, opts.After.ID)
+		order, offset = orderClause(nil), 0
+	}
+	query := fmt.Sprintf(`SELECT %s FROM user_profiles%s ORDER BY %s LIMIT %s OFFSET %d`,
+		userColumns, where, order, limit, offset)
+
+	rows, err := r.conn(ctx).QueryContext(ctx, r.dialect.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return err
+		}
+		if err := yield(user); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// userColumns lists the columns read by scanUser, in order
+const userColumns = `id, full_name, emoji, email, bio, location, tags, metadata, status, avatar_url, version, created_at, updated_at, deleted_at,
+	expires_at`
+
+// scanUser reads a row selected with userColumns
+func scanUser(row interface{ Scan(dest ...any) error }) (models.UserProfile, error) {
+	var user models.UserProfile
+	var deletedAt, expiresAt sql.NullTime
+	if err := row.Scan(&user.ID, &user.FullName, &user.Emoji, &user.Email, &user.Bio, &user.Location, tagList{&user.Tags},
+		metadataColumn{&user.Metadata}, &user.Status, &user.AvatarURL, &user.Version, timestamp{&user.CreatedAt}, timestamp{&user.UpdatedAt},
+		&deletedAt, &expiresAt); err != nil {
+		return models.UserProfile{}, err
+	}
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+	if expiresAt.Valid {
+		expires := expiresAt.Time.UTC()
+		user.ExpiresAt = &expires
+	}
+	return user, nil
+}
+
+// timestamp scans a timestamp column. SQLite's created_at and updated_at
+// columns are declared as TEXT, so the driver returns them as strings.
+type timestamp struct {
+	t *time.Time
+}
+
+// timestampLayouts lists the text forms SQLite timestamps are stored in: the
+// strftime column default and the driver's _time_format=sqlite
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+func (ts timestamp) Scan(src any) error {
+	switch v := src.(type) {
+	case time.Time:
+		*ts.t = v.UTC()
+		return nil
+	case []byte:
+		return ts.Scan(string(v))
+	case string:
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				*ts.t = t.UTC()
+				return nil
+			}
+		}
+		return fmt.Errorf("cannot parse timestamp %q", v)
+	case nil:
+		*ts.t = time.Time{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into a timestamp", src)
+	}
+}
+
+// tagList scans the tags column, which holds a user's tags joined with
+// commas; tags cannot contain commas
+type tagList struct {
+	tags *[]string
+}
+
+func (tl tagList) Scan(src any) error {
+	var joined sql.NullString
+	if err := joined.Scan(src); err != nil {
+		return err
+	}
+	*tl.tags = nil
+	if joined.String != "" {
+		*tl.tags = strings.Split(joined.String, ",")
+	}
+	return nil
+}
+
+// joinTags is the value of the tags column for tags
+func joinTags(tags []string) string {
+	return strings.Join(tags, ",")
+}
+
+// metadataColumn reads and writes the metadata column, which holds the
+// metadata as JSON, or an empty string when there is none
+type metadataColumn struct {
+	metadata *models.Metadata
+}
+
+func (mc metadataColumn) Scan(src any) error {
+	var encoded sql.NullString
+	if err := encoded.Scan(src); err != nil {
+		return err
+	}
+	*mc.metadata = nil
+	if encoded.String == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(encoded.String), mc.metadata)
+}
+
+func (mc metadataColumn) Value() (driver.Value, error) {
+	if len(*mc.metadata) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(*mc.metadata)
+	return string(encoded), err
+}
+
+// Get returns the active user with the given ID
+func (r *SQLUserRepository) Get(ctx context.Context, id string) (models.UserProfile, error) {
+	return r.get(ctx, r.conn(ctx), `SELECT `+userColumns+` FROM user_profiles WHERE id = $1 AND deleted_at IS NULL`, id)
+}
+
+// GetByEmail returns the active user with the given email address
+func (r *SQLUserRepository) GetByEmail(ctx context.Context, email string) (models.UserProfile, error) {
+	if email == "" {
+		return models.UserProfile{}, ErrNotFound
+	}
+	return r.get(ctx, r.conn(ctx), `SELECT `+userColumns+` FROM user_profiles WHERE LOWER(email) = LOWER($1) AND deleted_at IS NULL`, email)
+}
+
+func (r *SQLUserRepository) get(ctx context.Context, q queryer, query string, arg string) (models.UserProfile, error) {
+	user, err := scanUser(q.QueryRowContext(ctx, r.dialect.rebind(query), arg))
+	if err == sql.ErrNoRows {
+		return models.UserProfile{}, ErrNotFound
+	}
+	return user, err
+}
+
+// queryer runs statements on the connection pool, or on the transaction
+// recording a change together with its outbox message
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns the transaction ctx carries, or the connection pool outside
+// of transactions
+func (r *SQLUserRepository) conn(ctx context.Context) queryer {
+	return connection(ctx, r.db)
+}
+
+// Create stores a new user, returning ErrConflict if the ID is taken
+func (r *SQLUserRepository) Create(ctx context.Context, user models.UserProfile) (models.UserProfile, error) {
+	return r.change(ctx, ChangeCreated, func(q queryer) (models.UserProfile, error) {
+		now := time.Now().UTC()
+		if user.Status == "" {
+			user.Status = models.StatusActive
+		}
+		_, err := q.ExecContext(ctx, r.dialect.rebind(`INSERT INTO user_profiles (id, full_name, emoji, email, bio, location, tags, metadata, status,
+				expires_at, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11)`),
+			user.ID, user.FullName, user.Emoji, user.Email, user.Bio, user.Location, joinTags(user.Tags), metadataColumn{&user.Metadata},
+			string(user.Status), user.ExpiresAt, now)
+		if r.dialect.isUniqueViolation(err) {
+			return models.UserProfile{}, uniqueViolation(err)
+		}
+		if err != nil {
+			return models.UserProfile{}, err
+		}
+		user.DeletedAt = nil
+		user.AvatarURL = ""
+		user.Version = 1
+		user.CreatedAt = now
+		user.UpdatedAt = now
+		return user, nil
+	})
+}
+
+// Update replaces the active user with the given ID and increments its
+// version. The version check is part of the UPDATE so concurrent writers
+// cannot both succeed.
+func (r *SQLUserRepository) Update(ctx context.Context, id string, user models.UserProfile) (models.UserProfile, error) {
+	return r.change(ctx, ChangeUpdated, func(q queryer) (models.UserProfile, error) {
+		result, err := q.ExecContext(ctx, r.dialect.rebind(`UPDATE user_profiles
+			SET full_name = $2, emoji = $3, email = $4, bio = $5, location = $6, tags = $7, metadata = $8,
+				status = COALESCE(NULLIF($9, ''), status), expires_at = $10, updated_at = $11, version = version + 1
+			WHERE id = $1 AND deleted_at IS NULL AND ($12 = 0 OR version = $12)`),
+			id, user.FullName, user.Emoji, user.Email, user.Bio, user.Location, joinTags(user.Tags), metadataColumn{&user.Metadata},
+			string(user.Status), user.ExpiresAt, time.Now().UTC(), user.Version)
+		if r.dialect.isUniqueViolation(err) {
+			return models.UserProfile{}, uniqueViolation(err)
+		}
+		if err != nil {
+			return models.UserProfile{}, err
+		}
+		if err := expectAffected(result); err != nil {
+			// Tell a missing user apart from a stale version
+			if _, getErr := r.get(ctx, q, `SELECT `+userColumns+` FROM user_profiles WHERE id = $1 AND deleted_at IS NULL`, id); getErr == nil {
+				return models.UserProfile{}, ErrVersionMismatch
+			}
+			return models.UserProfile{}, err
+		}
+		return r.get(ctx, q, `SELECT `+userColumns+` FROM user_profiles WHERE id = $1`, id)
+	})
+}
+
+// Delete soft-deletes the active user with the given ID
+func (r *SQLUserRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.change(ctx, ChangeDeleted, func(q queryer) (models.UserProfile, error) {
+		result, err := q.ExecContext(ctx, r.dialect.rebind(`UPDATE user_profiles SET deleted_at = $2, updated_at = $2, version = version + 1
+			WHERE id = $1 AND deleted_at IS NULL`),
+			id, time.Now().UTC())
+		if err != nil {
+			return models.UserProfile{}, err
+		}
+		if err := expectAffected(result); err != nil || r.outbox == nil {
+			return models.UserProfile{}, err
+		}
+		// The deletion is the only change, so the user was otherwise as read
+		user, err := r.get(ctx, q, `SELECT `+userColumns+` FROM user_profiles WHERE id = $1`, id)
+		user.DeletedAt = nil
+		return user, err
+	})
+	return err
+}
+
+// SetAvatarURL records the location of the active user's avatar
+func (r *SQLUserRepository) SetAvatarURL(ctx context.Context, id string, avatarURL string) (models.UserProfile, error) {
+	return r.change(ctx, ChangeUpdated, func(q queryer) (models.UserProfile, error) {
+		result, err := q.ExecContext(ctx, r.dialect.rebind(`UPDATE user_profiles SET avatar_url = $2, updated_at = $3, version = version + 1
+			WHERE id = $1 AND deleted_at IS NULL`), id, avatarURL, time.Now().UTC())
+		if err != nil {
+			return models.UserProfile{}, err
+		}
+		if err := expectAffected(result); err != nil {
+			return models.UserProfile{}, err
+		}
+		return r.get(ctx, q, `SELECT `+userColumns+` FROM user_profiles WHERE id = $1`, id)
+	})
+}
+
+// Restore undeletes the deleted user with the given ID
+func (r *SQLUserRepository) Restore(ctx context.Context, id string) (models.UserProfile, error) {
+	return r.change(ctx, ChangeRestored, func(q queryer) (models.UserProfile, error) {
+		result, err := q.ExecContext(ctx, r.dialect.rebind(`UPDATE user_profiles SET deleted_at = NULL, updated_at = $2, version = version + 1
+			WHERE id = $1 AND deleted_at IS NOT NULL`), id, time.Now().UTC())
+		if err != nil {
+			return models.UserProfile{}, err
+		}
+		if err := expectAffected(result); err != nil {
+			return models.UserProfile{}, err
+		}
+		return r.get(ctx, q, `SELECT `+userColumns+` FROM user_profiles WHERE id = $1`, id)
+	})
+}
+
+// change applies a write and returns the changed user. With an outbox, the
+// write runs in a transaction that also records the message describing it,
+// or in the transaction ctx carries.
+func (r *SQLUserRepository) change(ctx context.Context, kind Change, apply func(q queryer) (models.UserProfile, error)) (models.UserProfile, error) {
+	if r.outbox == nil {
+		return apply(r.conn(ctx))
+	}
+	var user models.UserProfile
+	err := r.Transaction(ctx, func(ctx context.Context) error {
+		q := r.conn(ctx)
+		var err error
+		if user, err = apply(q); err != nil {
+			return err
+		}
+		message, err := r.outbox(kind, user)
+		if err != nil {
+			return fmt.Errorf("encode outbox message: %w", err)
+		}
+		_, err = q.ExecContext(ctx, r.dialect.rebind(`INSERT INTO event_outbox (topic, message_key, payload, created_at) VALUES ($1, $2, $3, $4)`),
+			message.Topic, message.Key, message.Payload, time.Now().UTC())
+		return err
+	})
+	if err != nil {
+		return models.UserProfile{}, err
+	}
+	return user, nil
+}
+
+// UseOutbox makes every later change record a message in the event_outbox
+// table. It must be called before the repository is used.
+func (r *SQLUserRepository) UseOutbox(encode OutboxEncoder) {
+	r.outbox = encode
+}
+
+// PendingOutbox returns up to limit of the oldest messages in the
+// event_outbox table
+func (r *SQLUserRepository) PendingOutbox(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, r.dialect.rebind(`SELECT id, topic, message_key, payload, created_at FROM event_outbox ORDER BY id LIMIT $1`), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []OutboxMessage
+	for rows.Next() {
+		var message OutboxMessage
+		if err := rows.Scan(&message.ID, &message.Topic, &message.Key, &message.Payload, timestamp{&message.CreatedAt}); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// DeleteOutbox removes published messages from the event_outbox table
+func (r *SQLUserRepository) DeleteOutbox(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	placeholders := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+	_, err := r.conn(ctx).ExecContext(ctx, r.dialect.rebind(`DELETE FROM event_outbox WHERE id IN (`+strings.Join(placeholders, ", ")+`)`), args...)
+	return err
+}
+
+// Stats counts the active users with a grouping query and a windowed count
+func (r *SQLUserRepository) Stats(ctx context.Context) (UserStats, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `SELECT emoji, COUNT(*) FROM user_profiles WHERE deleted_at IS NULL GROUP BY emoji`)
+	if err != nil {
+		return UserStats{}, err
+	}
+	defer rows.Close()
+
+	var stats UserStats
+	for rows.Next() {
+		var count EmojiCount
+		if err := rows.Scan(&count.Emoji, &count.Count); err != nil {
+			return UserStats{}, err
+		}
+		stats.ByEmoji = append(stats.ByEmoji, count)
+	}
+	if err := rows.Err(); err != nil {
+		return UserStats{}, err
+	}
+	sortEmojiCounts(stats.ByEmoji)
+	if stats.ByTag, err = r.tagCounts(ctx); err != nil {
+		return UserStats{}, err
+	}
+
+	now := time.Now().UTC()
+	err = r.conn(ctx).QueryRowContext(ctx, r.dialect.rebind(`SELECT COUNT(*),
+			COALESCE(SUM(CASE WHEN created_at >= $1 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN created_at >= $2 THEN 1 ELSE 0 END), 0)
+		FROM user_profiles WHERE deleted_at IS NULL`),
+		now.Add(-24*time.Hour), now.Add(-7*24*time.Hour),
+	).Scan(&stats.Total, &stats.CreatedLast24h, &stats.CreatedLast7d)
+	return stats, err
+}
+
+// tagCounts counts the active users with each tag. The tags share a column,
+// so they are counted here rather than by the database.
+func (r *SQLUserRepository) tagCounts(ctx context.Context) ([]TagCount, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `SELECT tags FROM user_profiles WHERE deleted_at IS NULL AND tags <> ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byTag := map[string]int{}
+	for rows.Next() {
+		var tags []string
+		if err := rows.Scan(tagList{&tags}); err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			byTag[tag]++
+		}
+	}
+	return tagCounts(byTag), rows.Err()
+}
+
+// searchQuery ranks the active users matching the words of $1 with
+// PostgreSQL's text search. The simple configuration neither stems nor
+// drops stop words, matching the in-memory index, and the WHERE clause
+// repeats the expression of the user_profiles_search index so it is used.
+const searchQuery = `SELECT ` + userColumns + `,
+		ts_rank(setweight(to_tsvector('simple', full_name), 'A') || setweight(to_tsvector('simple', bio), 'D'), query),
+		CASE WHEN to_tsvector('simple', full_name) @@ query
+			THEN ts_headline('simple', full_name, query, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true') ELSE '' END,
+		CASE WHEN to_tsvector('simple', bio) @@ query
+			THEN ts_headline('simple', bio, query, 'StartSel=<mark>, StopSel=</mark>, MaxWords=30, MinWords=15') ELSE '' END
+	FROM user_profiles, plainto_tsquery('simple', $1) AS query
+	WHERE deleted_at IS NULL AND to_tsvector('simple', full_name || ' ' || bio) @@ query
+	ORDER BY 16 DESC, created_at, id
+	LIMIT %s`
+
+// maxSearchCandidates caps the users a search indexes in memory, keeping the
+// earliest created when more may match
+const maxSearchCandidates = 5000
+
+// Search returns the active users whose full name or bio contains every
+// word of the query, most relevant first. PostgreSQL's text search has no
+// typo tolerance, so fuzzy searches, like every search on SQLite, index in
+// memory the users searchClause selects as candidates.
+func (r *SQLUserRepository) Search(ctx context.Context, opts SearchOptions) ([]SearchResult, error) {
+	if !r.dialect.fullTextSearch || opts.Fuzziness != 0 {
+		terms := uniqueTerms(opts.Query)
+		if len(terms) == 0 {
+			return []SearchResult{}, nil
+		}
+		where, args := r.dialect.searchClause(terms, opts)
+		var candidates []models.UserProfile
+		err := r.query(ctx, ListOptions{Limit: maxSearchCandidates}, where, args, func(user models.UserProfile) error {
+			candidates = append(candidates, user)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return newSearchIndex(candidates).search(opts), nil
+	}
+
+	limit := r.dialect.noLimit
+	if opts.Limit > 0 {
+		limit = fmt.Sprint(opts.Limit)
+	}
+	rows, err := r.conn(ctx).QueryContext(ctx, fmt.Sprintf(searchQuery, limit), normalizeQuery(opts.Query))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var result SearchResult
+		var deletedAt, expiresAt sql.NullTime
+		if err := rows.Scan(&result.User.ID, &result.User.FullName, &result.User.Emoji, &result.User.Email,
+			&result.User.Bio, &result.User.Location, tagList{&result.User.Tags}, metadataColumn{&result.User.Metadata},
+			&result.User.Status, &result.User.AvatarURL, &result.User.Version,
+			timestamp{&result.User.CreatedAt}, timestamp{&result.User.UpdatedAt}, &deletedAt, &expiresAt,
+			&result.Score, &result.Highlights.FullName, &result.Highlights.Bio); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			expires := expiresAt.Time.UTC()
+			result.User.ExpiresAt = &expires
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// Reset permanently deletes every user
+func (r *SQLUserRepository) Reset(ctx context.Context) error {
+	_, err := r.conn(ctx).ExecContext(ctx, `DELETE FROM user_profiles`)
+	return err
+}
+
+// Ping checks that the database is reachable
+func (r *SQLUserRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// Close releases the underlying connection pool
+func (r *SQLUserRepository) Close() error {
+	return r.db.Close()
+}
+
+// sortColumns maps sortable fields to their columns, full names sorted with
+// the same collation as CompareNames
+var sortColumns = map[string]string{
+	"id":       "id",
+	"fullName": "full_name COLLATE " + nameCollation,
+	"emoji":    "emoji",
+}
+
+// orderClause builds the ORDER BY terms, falling back to insertion order so
+// ordering is stable across pages
+func orderClause(fields []SortField) string {
+	terms := make([]string, 0, len(fields)+2)
+	for _, field := range fields {
+		term := sortColumns[field.Field]
+		if field.Descending {
+			term += " DESC"
+		}
+		terms = append(terms, term)
+	}
+	terms = append(terms, "created_at", "id")
+	return strings.Join(terms, ", ")
+}
+
+// filterClause builds a WHERE clause with $N placeholders for the filter,
+// excluding soft-deleted users unless includeDeleted is set
+func (d dialect) filterClause(f UserFilter, includeDeleted bool) (string, []any) {
+	var conditions []string
+	var args []any
+
+	if !includeDeleted {
+		conditions = append(conditions, `deleted_at IS NULL`)
+	}
+	if f.FullName != "" {
+		args = append(args, likePattern(f.FullName))
+		conditions = append(conditions, fmt.Sprintf(`%s(full_name) LIKE $%d ESCAPE '\'`, d.lower, len(args)))
+	}
+	if f.Emoji != "" {
+		args = append(args, f.Emoji)
+		conditions = append(conditions, fmt.Sprintf(`emoji = $%d`, len(args)))
+	}
+	if f.Tag != "" {
+		args = append(args, "%,"+likeEscaper.Replace(f.Tag)+",%")
+		conditions = append(conditions, fmt.Sprintf(`(',' || tags || ',') LIKE $%d ESCAPE '\'`, len(args)))
+	}
+	if len(f.Statuses) > 0 {
+		placeholders := make([]string, 0, len(f.Statuses))
+		for _, status := range f.Statuses {
+			args = append(args, string(status))
+			placeholders = append(placeholders, fmt.Sprintf(`$%d`, len(args)))
+		}
+		conditions = append(conditions, `status IN (`+strings.Join(placeholders, ", ")+`)`)
+	}
+	if f.Query != "" {
+		args = append(args, likePattern(f.Query))
+		n := len(args)
+		conditions = append(conditions, fmt.Sprintf(
+			`(%[2]s(id) LIKE $%[1]d ESCAPE '\' OR %[2]s(full_name) LIKE $%[1]d ESCAPE '\' OR %[2]s(emoji) LIKE $%[1]d ESCAPE '\')`, n, d.lower))
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// searchClause returns a WHERE clause selecting the active users that may
+// match every search term. A word a few edits away from a term still holds
+// one of the pieces the term splits into, one more than the edits allowed,
+// since each edit changes at most one piece; so for every term, the full
+// name or bio must contain one of its pieces. On PostgreSQL the
+// user_profiles_search_trigram index serves these LIKE conditions.
+func (d dialect) searchClause(terms []string, opts SearchOptions) (string, []any) {
+	conditions := []string{"deleted_at IS NULL"}
+	var args []any
+	for _, term := range terms {
+		var contains []string
+		for _, piece := range splitTerm(term, opts.maxEdits(term)+1) {
+			args = append(args, likePattern(piece))
+			contains = append(contains, fmt.Sprintf(`%[2]s(full_name) LIKE $%[1]d ESCAPE '\' OR %[2]s(bio) LIKE $%[1]d ESCAPE '\'`,
+				len(args), d.lower))
+		}
+		if len(contains) > 0 {
+			conditions = append(conditions, "("+strings.Join(contains, " OR ")+")")
+		}
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// splitTerm splits term into n pieces of nearly equal length, or returns nil
+// when it has fewer than n letters, as any word might then be close enough
+func splitTerm(term string, n int) []string {
+	runes := []rune(term)
+	if len(runes) < n {
+		return nil
+	}
+	pieces := make([]string, n)
+	for i := range n {
+		pieces[i] = string(runes[i*len(runes)/n : (i+1)*len(runes)/n])
+	}
+	return pieces
+}
+
+// likePattern turns a substring into a lower-cased LIKE pattern, escaping
+// the LIKE wildcards so they match literally
+func likePattern(substr string) string {
+	return "%" + likeEscaper.Replace(strings.ToLower(normalizeQuery(substr))) + "%"
+}
+
+// likeEscaper escapes the LIKE wildcards, and the escape character itself
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// emailIndex is the unique index on user_profiles' email addresses
+const emailIndex = "user_profiles_email_key"
+
+// uniqueViolation maps a unique constraint violation to ErrEmailConflict or
+// ErrConflict. Both drivers name the violated index in the error message.
+func uniqueViolation(err error) error {
+	if strings.Contains(err.Error(), emailIndex) {
+		return ErrEmailConflict
+	}
+	return ErrConflict
+}
+
+// expectAffected returns ErrNotFound when a statement matched no rows
+func expectAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
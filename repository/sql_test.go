@@ -0,0 +1,245 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"userprofile-api/config"
+	"userprofile-api/models"
+	"userprofile-api/repository"
+	"userprofile-api/service"
+)
+
+// openSQLite opens a SQLite repository with a migrated schema in a
+// temporary directory, holding users with their creation times
+func openSQLite(tb testing.TB, users []models.UserProfile) *repository.SQLUserRepository {
+	tb.Helper()
+	cfg := config.DatabaseConfig{
+		Driver:      config.DriverSQLite,
+		URL:         "sqlite://" + filepath.Join(tb.TempDir(), "users.db"),
+		AutoMigrate: true,
+	}
+	repo, err := repository.Open(cfg)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	sqlite := repo.(*repository.SQLUserRepository)
+	tb.Cleanup(func() { sqlite.Close() })
+
+	ctx := context.Background()
+	for _, user := range users {
+		if _, err := repo.Create(ctx, user); err != nil {
+			tb.Fatal(err)
+		}
+		if user.DeletedAt != nil {
+			if err := repo.Delete(ctx, user.ID); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	backdate(tb, cfg, users)
+	return sqlite
+}
+
+// backdate sets the creation times of the users in the database to theirs,
+// which Create replaces with the current time
+func backdate(tb testing.TB, cfg config.DatabaseConfig, users []models.UserProfile) {
+	tb.Helper()
+	db, err := repository.OpenDB(cfg)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer tx.Rollback()
+	for _, user := range users {
+		if user.CreatedAt.IsZero() {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE user_profiles SET created_at = ? WHERE id = ?`, user.CreatedAt, user.ID); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// TestSQLitePing checks that a SQLite repository is ready while its database
+// is open, and not once it is closed or the check is cancelled
+func TestSQLitePing(t *testing.T) {
+	repo := openSQLite(t, nil)
+	ctx := context.Background()
+	if err := repo.Ping(ctx); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := repo.Ping(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("Ping with a cancelled context: %v, want context.Canceled", err)
+	}
+
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Ping(ctx); err == nil {
+		t.Error("Ping succeeded after Close")
+	}
+}
+
+// TestSQLiteCancelledContext checks that changes made with a cancelled
+// context, directly or through the user service, fail with
+// context.Canceled and leave the database untouched
+func TestSQLiteCancelledContext(t *testing.T) {
+	repo := openSQLite(t, []models.UserProfile{{ID: "ada", FullName: "Ada Lovelace", Email: "ada@example.com"}})
+	users := service.NewUserService(repo, nil, nil)
+	ctx := context.Background()
+	existing, err := repo.Get(ctx, "ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	renamed := existing
+	renamed.FullName = "Ada King"
+	changes := map[string]func() error{
+		"Create": func() error {
+			_, err := repo.Create(cancelled, models.UserProfile{ID: "grace", FullName: "Grace Hopper", Email: "grace@example.com"})
+			return err
+		},
+		"Update": func() error {
+			_, err := repo.Update(cancelled, "ada", renamed)
+			return err
+		},
+		"Delete": func() error { return repo.Delete(cancelled, "ada") },
+		"service Create": func() error {
+			_, err := users.Create(cancelled, models.UserProfile{ID: "grace", FullName: "Grace Hopper", Email: "grace@example.com"})
+			return err
+		},
+		"service Update": func() error {
+			_, err := users.Update(cancelled, "ada", func(user *models.UserProfile) error {
+				user.FullName = "Ada King"
+				return nil
+			})
+			return err
+		},
+	}
+	for name, change := range changes {
+		if err := change(); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: %v, want context.Canceled", name, err)
+		}
+	}
+
+	list, total, err := repo.List(ctx, repository.ListOptions{IncludeDeleted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || list[0].FullName != existing.FullName || list[0].Version != existing.Version || list[0].DeletedAt != nil {
+		t.Errorf("users after cancelled changes: %+v, want only %+v", list, existing)
+	}
+}
+
+// TestSQLiteCancelWhileStreaming cancels a listing while its query is
+// reading rows, checking that it stops promptly with context.Canceled
+// instead of reading the rest
+func TestSQLiteCancelWhileStreaming(t *testing.T) {
+	users := benchUsers(300)
+	repo := openSQLite(t, users)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var streamed int
+	var cancelledAt time.Time
+	err := repo.Stream(ctx, repository.ListOptions{IncludeDeleted: true}, func(models.UserProfile) error {
+		streamed++
+		if streamed == 1 {
+			cancel()
+			cancelledAt = time.Now()
+			// Let the cancellation reach the query before reading on
+			time.Sleep(10 * time.Millisecond)
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Stream: %v, want context.Canceled", err)
+	}
+	if streamed >= len(users) {
+		t.Errorf("streamed all %d users after being cancelled", streamed)
+	}
+	if elapsed := time.Since(cancelledAt); elapsed > time.Second {
+		t.Errorf("Stream returned %s after being cancelled", elapsed)
+	}
+}
+
+// TestSQLiteSearchMatchesInMemory checks that the candidates SQLite selects
+// for a search keep every user the in-memory index finds, for exact and
+// fuzzy searches alike
+func TestSQLiteSearchMatchesInMemory(t *testing.T) {
+	ctx := context.Background()
+	users := benchUsers(300)
+	memory := repository.NewInMemoryUserRepository(users)
+	sqlite := openSQLite(t, users)
+
+	active := users[slices.IndexFunc(users, func(user models.UserProfile) bool { return user.DeletedAt == nil })]
+	first, last, _ := strings.Cut(active.FullName, " ")
+	// typo replaces a letter in the middle of a word
+	typo := func(word string) string {
+		runes := []rune(strings.ToLower(word))
+		runes[len(runes)/2] = 'x'
+		return string(runes)
+	}
+	tests := []repository.SearchOptions{
+		{Query: first},
+		{Query: first + " " + last},
+		{Query: "enjoys"},
+		{Query: "nobody"},
+		{Query: "50%_off"},
+		{Query: typo(first)},
+		{Query: typo(first), Fuzziness: 1},
+		{Query: typo(first) + " " + typo(last), Fuzziness: repository.FuzzinessAuto},
+		{Query: "enjxxs", Fuzziness: 2},
+		{Query: "qz", Fuzziness: 2},
+	}
+	for _, opts := range tests {
+		t.Run(fmt.Sprintf("%s/fuzziness=%d", opts.Query, opts.Fuzziness), func(t *testing.T) {
+			want, err := memory.Search(ctx, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := sqlite.Search(ctx, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(resultIDs(got), resultIDs(want)) {
+				t.Errorf("Search found %v, want %v", resultIDs(got), resultIDs(want))
+			}
+		})
+	}
+}
+
+// resultIDs returns the sorted IDs of the users found by a search
+func resultIDs(results []repository.SearchResult) []string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.User.ID
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func BenchmarkSQLite(b *testing.B) {
+	benchmarkReads(b, []int{1000, 10000}, func(b *testing.B, users []models.UserProfile) repository.UserRepository {
+		return openSQLite(b, users)
+	})
+}
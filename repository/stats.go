@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	"userprofile-api/models"
+)
+
+// UserStats summarizes the active users
+type UserStats struct {
+	Total int
+	// ByEmoji counts the users with each emoji, most common first
+	ByEmoji []EmojiCount
+	// ByTag counts the users with each tag, most common first
+	ByTag []TagCount
+	// CreatedLast24h and CreatedLast7d count the users created within the
+	// last day and week
+	CreatedLast24h int
+	CreatedLast7d  int
+}
+
+// EmojiCount is the number of active users with an emoji
+type EmojiCount struct {
+	Emoji string
+	Count int
+}
+
+// TagCount is the number of active users with a tag
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+// computeStats summarizes the active users among users, as of now
+func computeStats(users []models.UserProfile, now time.Time) UserStats {
+	var stats UserStats
+	byEmoji := map[string]int{}
+	byTag := map[string]int{}
+	for _, user := range users {
+		if user.DeletedAt != nil {
+			continue
+		}
+		stats.Total++
+		byEmoji[user.Emoji]++
+		for _, tag := range user.Tags {
+			byTag[tag]++
+		}
+		if !user.CreatedAt.Before(now.Add(-24 * time.Hour)) {
+			stats.CreatedLast24h++
+		}
+		if !user.CreatedAt.Before(now.Add(-7 * 24 * time.Hour)) {
+			stats.CreatedLast7d++
+		}
+	}
+	for emoji, count := range byEmoji {
+		stats.ByEmoji = append(stats.ByEmoji, EmojiCount{Emoji: emoji, Count: count})
+	}
+	sortEmojiCounts(stats.ByEmoji)
+	stats.ByTag = tagCounts(byTag)
+	return stats
+}
+
+// sortEmojiCounts orders the counts from most to least common, then by emoji
+func sortEmojiCounts(counts []EmojiCount) {
+	slices.SortFunc(counts, func(a, b EmojiCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), strings.Compare(a.Emoji, b.Emoji))
+	})
+}
+
+// tagCounts lists the counts of byTag from most to least common, then by tag
+func tagCounts(byTag map[string]int) []TagCount {
+	counts := make([]TagCount, 0, len(byTag))
+	for tag, count := range byTag {
+		counts = append(counts, TagCount{Tag: tag, Count: count})
+	}
+	slices.SortFunc(counts, func(a, b TagCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), strings.Compare(a.Tag, b.Tag))
+	})
+	return counts
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"userprofile-api/config"
+)
+
+// OpenTenant creates the repository holding a tenant's users, apart from
+// those of the default storage and of every other tenant: a new in-memory
+// store, or a JSON or SQLite file, or a PostgreSQL schema named after the
+// tenant. The tenant ID must be safe to use in file and schema names.
+func OpenTenant(cfg config.DatabaseConfig, tenant string) (UserRepository, error) {
+	switch cfg.Driver {
+	case config.DriverMemory:
+		return NewInMemoryUserRepository(nil), nil
+	case config.DriverJSON:
+		return OpenJSONFile(tenantPath(jsonFilePath(cfg.URL), tenant))
+	case config.DriverSQLite:
+		path, params, _ := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(cfg.URL, "sqlite://"), "sqlite:"), "?")
+		cfg.URL = tenantPath(path, tenant)
+		if params != "" {
+			cfg.URL += "?" + params
+		}
+		return Open(cfg)
+	case config.DriverPostgres:
+		return openPostgresTenant(cfg, tenant)
+	default:
+		return nil, fmt.Errorf("the %s driver does not support tenants", cfg.Driver)
+	}
+}
+
+// tenantPath names a tenant's file after the default one, e.g. users.acme.db
+// for users.db
+func tenantPath(path, tenant string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + tenant + ext
+}
+
+// tenantSchema is the PostgreSQL schema holding a tenant's tables
+func tenantSchema(tenant string) string {
+	return "tenant_" + strings.ReplaceAll(tenant, "-", "_")
+}
+
+// openPostgresTenant connects with the tenant's schema as the search path,
+// so the unqualified table names of the queries and migrations resolve to
+// its tables, creating the schema if needed
+func openPostgresTenant(cfg config.DatabaseConfig, tenant string) (UserRepository, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DATABASE_URL: %w", err)
+	}
+	schema := tenantSchema(tenant)
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	cfg.URL = u.String()
+
+	db, err := OpenDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`CREATE SCHEMA IF NOT EXISTS ` + schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create schema %s: %w", schema, err)
+	}
+	if err := prepareSchema(db, cfg); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return NewPostgresUserRepository(db), nil
+}
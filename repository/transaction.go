@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Transactor is implemented by repositories that can make several changes
+// atomically: the users they change, the outbox messages recorded with them
+// and the audit records of the changes are committed together or not at all
+type Transactor interface {
+	// Transaction calls fn with a context that makes every call given it
+	// part of one transaction, committed when fn returns nil and rolled back
+	// when it returns an error, which Transaction returns. Transactions
+	// started with a context already carrying one join it, so they commit
+	// with the outermost.
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Transaction runs fn in a transaction of the repository when it supports
+// them. Otherwise fn is called with ctx as is and its changes are made one by
+// one, as they are when they are not part of a transaction.
+func Transaction(ctx context.Context, repo UserRepository, fn func(ctx context.Context) error) error {
+	if transactor, ok := repo.(Transactor); ok {
+		return transactor.Transaction(ctx, fn)
+	}
+	return fn(ctx)
+}
+
+// Transaction runs fn without a transaction: each change to the users held
+// in memory is already atomic, and there is no outbox to keep in step with
+// them. Audit records of changes that fail halfway are kept.
+func (r *InMemoryUserRepository) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// sqlTxKey is the context key of the transaction started by sqlTransaction
+type sqlTxKey struct{}
+
+// sqlTx is a transaction carried by a context, along with the database it
+// was started on
+type sqlTx struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+// sqlTransaction runs fn with a context carrying a transaction of db, which
+// is committed when fn returns nil. A context already carrying a transaction
+// of db joins it.
+func sqlTransaction(ctx context.Context, db *sql.DB, fn func(ctx context.Context) error) error {
+	if current, ok := ctx.Value(sqlTxKey{}).(*sqlTx); ok && current.db == db {
+		return fn(ctx)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, sqlTxKey{}, &sqlTx{db: db, tx: tx})); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// connection returns the transaction of db carried by ctx, or db itself
+// when ctx carries none. Statements made within a transaction must go
+// through it: outside of it they would not see its changes, and SQLite
+// would make them wait for it to end.
+func connection(ctx context.Context, db *sql.DB) queryer {
+	if current, ok := ctx.Value(sqlTxKey{}).(*sqlTx); ok && current.db == db {
+		return current.tx
+	}
+	return db
+}
+
+// Transaction makes the changes fn makes with the context it is given,
+// along with their outbox messages and audit records, in one database
+// transaction
+func (r *SQLUserRepository) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return sqlTransaction(ctx, r.db, fn)
+}
+
+// Transaction makes the changes fn makes with the context it is given in one
+// database transaction, together with those of the user repository sharing
+// the database
+func (r *SQLGroupRepository) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return sqlTransaction(ctx, r.db, fn)
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// ErrUnavailable is returned when the storage backend is not called because
+// it keeps failing. The errors wrapping it are *UnavailableError values.
+var ErrUnavailable = errors.New("storage backend unavailable")
+
+// UnavailableError is returned instead of calling a storage backend that
+// keeps failing, saying when it will be tried again. It wraps ErrUnavailable.
+type UnavailableError struct {
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%v; retry after %s", ErrUnavailable, e.RetryAfter.Round(time.Millisecond))
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return ErrUnavailable
+}
+
+// retryableSQLStates are the PostgreSQL errors reported before a statement
+// was applied, that may not happen again: serialization failures, deadlocks,
+// too many connections and a server starting up
+var retryableSQLStates = map[string]bool{
+	"40001": true,
+	"40P01": true,
+	"53300": true,
+	"57P03": true,
+}
+
+// IsTransient reports whether err is a failure of the storage backend that
+// may not happen again, such as a lost connection, a timeout or a busy
+// database. Errors about the users themselves, and the cancellation or
+// deadline of the caller's context, are not transient.
+func IsTransient(err error) bool {
+	switch {
+	case err == nil, errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case IsRetryable(err):
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Connection exceptions and shutdowns
+		return strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "57P")
+	}
+	return retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
+
+// IsRetryable reports whether err is a transient failure the storage backend
+// reported before applying anything, so that the call failing with it, even
+// a change, can safely be made again
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, syscall.ECONNREFUSED) || pgconn.SafeToRetry(err) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return retryableSQLStates[pgErr.Code]
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		primary := sqliteErr.Code() & 0xff
+		return primary == sqlite3.SQLITE_BUSY || primary == sqlite3.SQLITE_LOCKED
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"database/sql/driver"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+	"modernc.org/sqlite"
+)
+
+// nameCollation is the collation full names are sorted with in SQL. SQLite
+// databases get it from CompareNames; PostgreSQL ones from ICU, created by a
+// migration with the same root order.
+const nameCollation = "unicode"
+
+// collators hold collators of the Unicode Collation Algorithm's root order,
+// which sorts accented letters next to their base letter and every script in
+// the order people expect, rather than by code point. A collator is not safe
+// for concurrent use.
+var collators = sync.Pool{
+	New: func() any { return collate.New(language.Und) },
+}
+
+// unicodeLower is the SQLite function lower-casing every letter, where the
+// built-in LOWER only lower-cases ASCII ones
+const unicodeLower = "unicode_lower"
+
+func init() {
+	sqlite.MustRegisterCollationUtf8(nameCollation, CompareNames)
+	sqlite.MustRegisterDeterministicScalarFunction(unicodeLower, 1,
+		func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			if text, ok := args[0].(string); ok {
+				return strings.ToLower(text), nil
+			}
+			return args[0], nil
+		})
+}
+
+// CompareNames orders full names by the root collation, so that "Émile"
+// comes between "Eli" and "Emma". Names the collation considers equal, such
+// as those differing in ignorable characters, are ordered by their bytes so
+// that the order is total.
+func CompareNames(a, b string) int {
+	collator := collators.Get().(*collate.Collator)
+	defer collators.Put(collator)
+	if c := collator.CompareString(a, b); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// normalizeQuery puts text searched for in the form names are stored in, so
+// that accented letters typed as a letter and a combining mark still match
+func normalizeQuery(query string) string {
+	return norm.NFC.String(query)
+}
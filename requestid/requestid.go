@@ -0,0 +1,57 @@
+package requestid
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Header is the HTTP header carrying the request ID in both directions
+const Header = "X-Request-ID"
+
+// contextKey is the gin context key holding the current request ID
+const contextKey = "requestId"
+
+// sharedKey is the gin context key marking responses shared between requests
+const sharedKey = "requestIdShared"
+
+// validID limits client-supplied IDs to something safe to log and echo back
+var validID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Middleware assigns every request an ID, reusing the caller's X-Request-ID
+// when it is well formed, and echoes it in the response headers
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if !validID.MatchString(id) {
+			id = uuid.NewString()
+		}
+
+		c.Set(contextKey, id)
+		c.Header(Header, id)
+		c.Next()
+	}
+}
+
+// Get returns the ID assigned to the request, or an empty string when the
+// middleware is not installed
+func Get(c *gin.Context) string {
+	return c.GetString(contextKey)
+}
+
+// Share marks the response to the request as one that may be served to other
+// requests too, such as by a response cache, so its body leaves out the
+// request ID; the X-Request-ID header still carries it
+func Share(c *gin.Context) {
+	c.Set(sharedKey, true)
+}
+
+// ForBody returns the ID to echo in the body of a response: the request's
+// ID, or an empty string when the response is shared
+func ForBody(c *gin.Context) string {
+	if c.GetBool(sharedKey) {
+		return ""
+	}
+	return Get(c)
+}
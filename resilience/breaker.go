@@ -0,0 +1,124 @@
+package resilience
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the state of a circuit breaker
+type State string
+
+// Breaker states, as labelled in the storage_breaker_state metric
+const (
+	// StateClosed lets every call through
+	StateClosed State = "closed"
+	// StateOpen rejects every call until the cooldown has passed
+	StateOpen State = "open"
+	// StateHalfOpen lets one call through to try the backend again, closing
+	// the breaker when it succeeds and opening it again when it fails
+	StateHalfOpen State = "half_open"
+)
+
+// states lists every state, for reporting each in the metrics
+var states = []State{StateClosed, StateOpen, StateHalfOpen}
+
+// breaker counts consecutive failures and opens once there are too many. It
+// is safe for concurrent use.
+type breaker struct {
+	// failures opens the breaker; zero never opens it
+	failures int
+	cooldown time.Duration
+	// changed is called with the new state on every transition, while mu is
+	// held
+	changed func(from, to State)
+
+	mu    sync.Mutex
+	state State
+	// consecutive is the number of failures since the last success
+	consecutive int
+	// openedAt is when the breaker last opened
+	openedAt time.Time
+	// trying is set while the call trying the backend in the half-open
+	// state is in flight
+	trying bool
+}
+
+func newBreaker(failures int, cooldown time.Duration, changed func(from, to State)) *breaker {
+	return &breaker{failures: failures, cooldown: cooldown, changed: changed, state: StateClosed}
+}
+
+// allow reports whether a call may be made, and whether it is the call
+// trying the backend in the half-open state, or how long to wait before
+// calling again when it may not. A call that is allowed must report its
+// outcome to done.
+func (b *breaker) allow() (ok, trial bool, wait time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen {
+		if wait := b.cooldown - time.Since(b.openedAt); wait > 0 {
+			return false, false, wait
+		}
+		b.transition(StateHalfOpen)
+	}
+	if b.state == StateHalfOpen {
+		if b.trying {
+			return false, false, b.cooldown
+		}
+		b.trying = true
+		return true, true, 0
+	}
+	return true, false, 0
+}
+
+// open reports whether calls are rejected, and for how long, without
+// counting as a call
+func (b *breaker) open() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != StateOpen {
+		return false, 0
+	}
+	wait := b.cooldown - time.Since(b.openedAt)
+	return wait > 0, wait
+}
+
+// done records the outcome of a call allow let through: a failure of the
+// backend, a success, or neither when the call ended before telling, such as
+// when its context was cancelled
+func (b *breaker) done(trial, failed, succeeded bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if trial {
+		b.trying = false
+	}
+	trial = trial && b.state == StateHalfOpen
+	switch {
+	case succeeded:
+		b.consecutive = 0
+		if trial {
+			b.transition(StateClosed)
+		}
+	case failed:
+		b.consecutive++
+		if trial || (b.failures > 0 && b.consecutive >= b.failures && b.state == StateClosed) {
+			b.openedAt = time.Now()
+			b.transition(StateOpen)
+		}
+	}
+}
+
+// current returns the breaker's state
+func (b *breaker) current() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// transition moves the breaker to a state. The caller must hold mu.
+func (b *breaker) transition(to State) {
+	from := b.state
+	b.state = to
+	if b.changed != nil {
+		b.changed(from, to)
+	}
+}
@@ -0,0 +1,317 @@
+// Package resilience guards the storage backend. Calls failing with a
+// transient error are retried with backoff, and a circuit breaker stops
+// calling a backend that keeps failing, so that requests fail fast with
+// repository.ErrUnavailable, rather than piling up, until it recovers.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"userprofile-api/config"
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+// maxBackoff bounds the wait before a retry, however many came before it
+const maxBackoff = 2 * time.Second
+
+// txKey marks the contexts of the transactions made through a Repository
+type txKey struct{}
+
+// Repository retries the calls to the wrapped repository that fail with a
+// transient error and rejects them with a *repository.UnavailableError while
+// its circuit breaker is open. Reads are retried on every transient error,
+// changes only on those reported before anything was applied, so a change is
+// never made twice. Calls within a transaction are not retried, since the
+// backend may have aborted the transaction with the error; the breaker still
+// counts them.
+type Repository struct {
+	next    repository.UserRepository
+	retries int
+	backoff time.Duration
+	breaker *breaker
+	logger  *slog.Logger
+
+	state       *prometheus.GaugeVec
+	transitions *prometheus.CounterVec
+	retried     *prometheus.CounterVec
+	rejected    *prometheus.CounterVec
+}
+
+// New wraps next so that its calls are retried and guarded by a circuit
+// breaker as cfg says, logging the breaker's transitions to logger
+func New(next repository.UserRepository, cfg config.ResilienceConfig, logger *slog.Logger) *Repository {
+	r := &Repository{
+		next:    next,
+		retries: cfg.Retries,
+		backoff: cfg.RetryBackoff,
+		logger:  logger,
+		state: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "userprofile",
+			Name:      "storage_breaker_state",
+			Help:      "State of the storage backend's circuit breaker: 1 for the current state (closed, open or half_open), 0 for the others.",
+		}, []string{"state"}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "userprofile",
+			Name:      "storage_breaker_transitions_total",
+			Help:      "Number of times the storage backend's circuit breaker entered each state.",
+		}, []string{"state"}),
+		retried: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "userprofile",
+			Name:      "storage_retries_total",
+			Help:      "Number of storage calls retried after a transient error, by operation.",
+		}, []string{"operation"}),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "userprofile",
+			Name:      "storage_rejected_total",
+			Help:      "Number of storage calls rejected by the open circuit breaker, by operation.",
+		}, []string{"operation"}),
+	}
+	r.breaker = newBreaker(cfg.BreakerFailures, cfg.BreakerCooldown, r.changed)
+	r.setState(StateClosed)
+	return r
+}
+
+// State returns the state of the circuit breaker
+func (r *Repository) State() State {
+	return r.breaker.current()
+}
+
+// changed reports a transition of the breaker
+func (r *Repository) changed(from, to State) {
+	r.setState(to)
+	r.transitions.WithLabelValues(string(to)).Inc()
+	switch to {
+	case StateOpen:
+		r.logger.Warn("Storage backend keeps failing; rejecting calls until it recovers",
+			"from", from, "cooldown", r.breaker.cooldown.String())
+	case StateClosed:
+		r.logger.Info("Storage backend recovered; circuit breaker closed")
+	}
+}
+
+func (r *Repository) setState(current State) {
+	for _, state := range states {
+		value := 0.0
+		if state == current {
+			value = 1
+		}
+		r.state.WithLabelValues(string(state)).Set(value)
+	}
+}
+
+// Describe implements prometheus.Collector
+func (r *Repository) Describe(ch chan<- *prometheus.Desc) {
+	r.state.Describe(ch)
+	r.transitions.Describe(ch)
+	r.retried.Describe(ch)
+	r.rejected.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (r *Repository) Collect(ch chan<- prometheus.Metric) {
+	r.state.Collect(ch)
+	r.transitions.Collect(ch)
+	r.retried.Collect(ch)
+	r.rejected.Collect(ch)
+}
+
+// call makes a call through the breaker, retrying it while it fails with an
+// error retryable accepts
+func (r *Repository) call(ctx context.Context, operation string, retryable func(err error) bool, call func() error) error {
+	retries := r.retries
+	if ctx.Value(txKey{}) != nil {
+		retries = 0
+	}
+	for attempt := 0; ; attempt++ {
+		ok, trial, wait := r.breaker.allow()
+		if !ok {
+			r.rejected.WithLabelValues(operation).Inc()
+			return &repository.UnavailableError{RetryAfter: wait}
+		}
+		err := call()
+		// Errors about the users show the backend is working; those of the
+		// caller's context tell nothing
+		transient := repository.IsTransient(err)
+		ended := errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+		r.breaker.done(trial, transient, !transient && !ended)
+		if err == nil || attempt >= retries || !retryable(err) {
+			return err
+		}
+
+		r.retried.WithLabelValues(operation).Inc()
+		// Full jitter spreads out the retries of concurrent calls
+		timer := time.NewTimer(rand.N(min(r.backoff<<attempt, maxBackoff)) + 1)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// read makes a call that changes nothing, which can be retried on every
+// transient error
+func (r *Repository) read(ctx context.Context, operation string, call func() error) error {
+	return r.call(ctx, operation, repository.IsTransient, call)
+}
+
+// write makes a call that changes users, which is only retried when the
+// failed attempt is known not to have changed anything
+func (r *Repository) write(ctx context.Context, operation string, call func() error) error {
+	return r.call(ctx, operation, repository.IsRetryable, call)
+}
+
+func (r *Repository) List(ctx context.Context, opts repository.ListOptions) (users []models.UserProfile, total int, err error) {
+	err = r.read(ctx, "List", func() error {
+		users, total, err = r.next.List(ctx, opts)
+		return err
+	})
+	return users, total, err
+}
+
+// Stream is retried only as long as no user was yielded, so that none is
+// yielded twice. Errors returned by yield stop it without counting as
+// failures of the backend.
+func (r *Repository) Stream(ctx context.Context, opts repository.ListOptions, yield func(user models.UserProfile) error) error {
+	yielded := false
+	var yieldErr error
+	err := r.call(ctx, "Stream", func(err error) bool { return !yielded && repository.IsTransient(err) }, func() error {
+		err := repository.Stream(ctx, r.next, opts, func(user models.UserProfile) error {
+			yielded = true
+			yieldErr = yield(user)
+			return yieldErr
+		})
+		if yieldErr != nil {
+			return nil
+		}
+		return err
+	})
+	if yieldErr != nil {
+		return yieldErr
+	}
+	return err
+}
+
+func (r *Repository) Get(ctx context.Context, id string) (user models.UserProfile, err error) {
+	err = r.read(ctx, "Get", func() error {
+		user, err = r.next.Get(ctx, id)
+		return err
+	})
+	return user, err
+}
+
+func (r *Repository) GetByEmail(ctx context.Context, email string) (user models.UserProfile, err error) {
+	err = r.read(ctx, "GetByEmail", func() error {
+		user, err = r.next.GetByEmail(ctx, email)
+		return err
+	})
+	return user, err
+}
+
+func (r *Repository) Stats(ctx context.Context) (stats repository.UserStats, err error) {
+	err = r.read(ctx, "Stats", func() error {
+		stats, err = r.next.Stats(ctx)
+		return err
+	})
+	return stats, err
+}
+
+func (r *Repository) Search(ctx context.Context, opts repository.SearchOptions) (results []repository.SearchResult, err error) {
+	err = r.read(ctx, "Search", func() error {
+		results, err = r.next.Search(ctx, opts)
+		return err
+	})
+	return results, err
+}
+
+func (r *Repository) Create(ctx context.Context, user models.UserProfile) (created models.UserProfile, err error) {
+	err = r.write(ctx, "Create", func() error {
+		created, err = r.next.Create(ctx, user)
+		return err
+	})
+	return created, err
+}
+
+func (r *Repository) Update(ctx context.Context, id string, user models.UserProfile) (updated models.UserProfile, err error) {
+	err = r.write(ctx, "Update", func() error {
+		updated, err = r.next.Update(ctx, id, user)
+		return err
+	})
+	return updated, err
+}
+
+func (r *Repository) Delete(ctx context.Context, id string) error {
+	return r.write(ctx, "Delete", func() error {
+		return r.next.Delete(ctx, id)
+	})
+}
+
+func (r *Repository) SetAvatarURL(ctx context.Context, id string, avatarURL string) (updated models.UserProfile, err error) {
+	err = r.write(ctx, "SetAvatarURL", func() error {
+		updated, err = r.next.SetAvatarURL(ctx, id, avatarURL)
+		return err
+	})
+	return updated, err
+}
+
+func (r *Repository) Restore(ctx context.Context, id string) (restored models.UserProfile, err error) {
+	err = r.write(ctx, "Restore", func() error {
+		restored, err = r.next.Restore(ctx, id)
+		return err
+	})
+	return restored, err
+}
+
+func (r *Repository) Reset(ctx context.Context) error {
+	return r.write(ctx, "Reset", func() error {
+		return repository.Reset(ctx, r.next)
+	})
+}
+
+func (r *Repository) RecordAudit(ctx context.Context, record repository.AuditRecord) error {
+	return r.write(ctx, "RecordAudit", func() error {
+		return repository.RecordAudit(ctx, r.next, record)
+	})
+}
+
+func (r *Repository) MoveAudit(ctx context.Context, fromID, toID string) error {
+	return r.write(ctx, "MoveAudit", func() error {
+		return repository.MoveAudit(ctx, r.next, fromID, toID)
+	})
+}
+
+func (r *Repository) Trail(ctx context.Context, userID string) (records []repository.AuditRecord, err error) {
+	err = r.read(ctx, "Trail", func() error {
+		records, err = repository.Trail(ctx, r.next, userID)
+		return err
+	})
+	return records, err
+}
+
+// Transaction is rejected while the breaker is open, and is otherwise made
+// once: the calls within it count for the breaker, and are not retried
+func (r *Repository) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if open, wait := r.breaker.open(); open {
+		r.rejected.WithLabelValues("Transaction").Inc()
+		return &repository.UnavailableError{RetryAfter: wait}
+	}
+	return repository.Transaction(ctx, r.next, func(ctx context.Context) error {
+		return fn(context.WithValue(ctx, txKey{}, true))
+	})
+}
+
+// Ping checks the wrapped repository whatever the breaker's state, so
+// readiness reflects the storage backend itself
+func (r *Repository) Ping(ctx context.Context) error {
+	if pinger, ok := r.next.(repository.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package seed
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/google/uuid"
+	"userprofile-api/emoji"
+	"userprofile-api/models"
+)
+
+// Word lists the roles and hobbies in the bios of generated users are drawn
+// from
+var (
+	roles = []string{
+		"Backend engineer", "Data scientist", "Designer", "Developer advocate", "Frontend developer",
+		"Product manager", "QA engineer", "Site reliability engineer", "Student", "Technical writer",
+	}
+	hobbies = []string{
+		"baking sourdough", "bouldering", "chess", "cycling", "gardening", "jazz piano", "knitting",
+		"open source", "photography", "running", "sci-fi novels", "surfing", "board games", "hiking",
+	}
+)
+
+// Generate returns n realistic but made-up users with random names,
+// emails, emoji, bios and locations, for demos and load tests. Names and
+// locations come from gofakeit, drawing on r, so the same r yields the same
+// users but for their IDs. Emails carry a random suffix so that they do not
+// clash with each other or with earlier generated users.
+func Generate(n int, r *rand.Rand) []models.UserProfile {
+	faker := gofakeit.NewFaker(r, false)
+	shortcodes := emoji.Shortcodes()
+	users := make([]models.UserProfile, 0, n)
+	for range n {
+		first, last := faker.FirstName(), faker.LastName()
+		// Two different hobbies
+		h := r.Perm(len(hobbies))
+		users = append(users, models.UserProfile{
+			ID:       uuid.NewString(),
+			FullName: first + " " + last,
+			Emoji:    pick(r, shortcodes).Emoji,
+			Email: fmt.Sprintf("%s.%s.%06x@example.com", emailLocal(first), emailLocal(last),
+				r.IntN(1<<24)),
+			Bio:      fmt.Sprintf("%s who enjoys %s and %s.", pick(r, roles), hobbies[h[0]], hobbies[h[1]]),
+			Location: faker.City(),
+		})
+	}
+	return users
+}
+
+func pick[T any](r *rand.Rand, values []T) T {
+	return values[r.IntN(len(values))]
+}
+
+// asciiLetters spells the accented letters of names without accents
+var asciiLetters = strings.NewReplacer("ä", "a", "ã", "a", "é", "e", "ö", "o", "ü", "u")
+
+// emailLocal lower-cases a name and spells it in ASCII letters, as not every
+// mail system accepts others in addresses
+func emailLocal(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r
+		}
+		return -1
+	}, asciiLetters.Replace(strings.ToLower(name)))
+}
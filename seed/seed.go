@@ -0,0 +1,160 @@
+package seed
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+	"userprofile-api/config"
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+// demo holds the users the in-memory backend starts with when no seed file
+// is configured
+//
+//go:embed demo.json
+var demo []byte
+
+// Run seeds the repository as configured: from the seed file if one is set,
+// or with the demo users when the in-memory backend is used without one
+func Run(ctx context.Context, repo repository.UserRepository, cfg config.SeedConfig, driver string, logger *slog.Logger) error {
+	if cfg.Disabled || (cfg.File == "" && driver != config.DriverMemory) {
+		return nil
+	}
+
+	users, source, err := Users(cfg)
+	if err != nil {
+		return err
+	}
+
+	if cfg.SkipIfNotEmpty {
+		_, total, err := repo.List(ctx, repository.ListOptions{Limit: 1, IncludeDeleted: true})
+		if err != nil {
+			return fmt.Errorf("check whether the repository is empty: %w", err)
+		}
+		if total > 0 {
+			logger.Info("Repository already holds users; skipping seeding", "source", source)
+			return nil
+		}
+	}
+
+	created, err := Apply(ctx, repo, users)
+	if err != nil {
+		return err
+	}
+	logger.Info("Seeded users", "source", source, "created", created, "skipped", len(users)-created)
+	return nil
+}
+
+// Users returns the users in the seed file, or the demo users when none is
+// configured, along with a description of where they came from
+func Users(cfg config.SeedConfig) ([]models.UserProfile, string, error) {
+	if cfg.File == "" {
+		users, err := Decode(bytes.NewReader(demo), ".json")
+		return users, "demo users", err
+	}
+	users, err := Load(cfg.File)
+	return users, cfg.File, err
+}
+
+// Load reads and validates the users in a seed file, which is decoded as
+// YAML when its extension is .yaml or .yml and as JSON otherwise
+func Load(path string) ([]models.UserProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open seed file: %w", err)
+	}
+	defer f.Close()
+
+	users, err := Decode(f, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("seed file %s: %w", path, err)
+	}
+	return users, nil
+}
+
+// Decode reads a list of users in the format given by a file extension and
+// validates them with the API's rules. Users without an ID get a UUID.
+// Unknown fields are rejected, so that typos do not silently drop data.
+func Decode(r io.Reader, ext string) ([]models.UserProfile, error) {
+	var users []models.UserProfile
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(r)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&users); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	default:
+		decoder := json.NewDecoder(r)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&users); err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make(map[string]bool, len(users))
+	emails := make(map[string]bool, len(users))
+	for i := range users {
+		user := &users[i]
+		if user.ID == "" {
+			user.ID = uuid.NewString()
+		}
+		if err := binding.Validator.ValidateStruct(user); err != nil {
+			return nil, fmt.Errorf("user %d (%s): %w", i+1, user.ID, err)
+		}
+		if ids[user.ID] {
+			return nil, fmt.Errorf("user %d: duplicate ID %s", i+1, user.ID)
+		}
+		ids[user.ID] = true
+		if email := strings.ToLower(user.Email); email != "" {
+			if emails[email] {
+				return nil, fmt.Errorf("user %d (%s): duplicate email %s", i+1, user.ID, user.Email)
+			}
+			emails[email] = true
+		}
+	}
+	return users, nil
+}
+
+// Apply creates the users, skipping those whose ID is already taken, and
+// returns how many were created. Server-maintained fields such as the
+// version and timestamps are set by the repository.
+func Apply(ctx context.Context, repo repository.UserRepository, users []models.UserProfile) (int, error) {
+	created := 0
+	for _, user := range users {
+		_, err := repo.Create(ctx, models.UserProfile{
+			ID:        user.ID,
+			FullName:  user.FullName,
+			Emoji:     user.Emoji,
+			Email:     user.Email,
+			Bio:       user.Bio,
+			Location:  user.Location,
+			Tags:      user.Tags,
+			Metadata:  user.Metadata,
+			Status:    user.Status,
+			ExpiresAt: user.ExpiresAt,
+		})
+		switch {
+		case err == nil:
+			created++
+		case errors.Is(err, repository.ErrConflict) && !errors.Is(err, repository.ErrEmailConflict):
+			// The user exists already, e.g. from an earlier run
+		default:
+			return created, fmt.Errorf("seed user %s: %w", user.ID, err)
+		}
+	}
+	return created, nil
+}
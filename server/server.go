@@ -0,0 +1,637 @@
+// Package server assembles the users API from its configuration: it opens the
+// storage and the other components the routes are built on, serves the routes
+// as an http.Handler, and runs the listeners of the standalone server. Other
+// Go programs embed the API by mounting a Server under a path prefix of their
+// own server.
+package server
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+
+	"google.golang.org/grpc"
+
+	"userprofile-api/api"
+	"userprofile-api/auth"
+	"userprofile-api/backup"
+	"userprofile-api/cache"
+	"userprofile-api/config"
+	"userprofile-api/contract"
+	"userprofile-api/cors"
+	"userprofile-api/credentials"
+	"userprofile-api/docs"
+	"userprofile-api/errortracking"
+	"userprofile-api/events"
+	"userprofile-api/expiry"
+	"userprofile-api/follow"
+	"userprofile-api/grpcapi"
+	"userprofile-api/https"
+	"userprofile-api/i18n"
+	"userprofile-api/jobs"
+	"userprofile-api/ldapsync"
+	"userprofile-api/metadata"
+	"userprofile-api/models"
+	"userprofile-api/moderation"
+	"userprofile-api/profiling"
+	"userprofile-api/publish"
+	"userprofile-api/recovery"
+	"userprofile-api/reload"
+	"userprofile-api/replica"
+	"userprofile-api/repository"
+	"userprofile-api/resilience"
+	"userprofile-api/seed"
+	"userprofile-api/service"
+	"userprofile-api/signing"
+	"userprofile-api/tenant"
+	"userprofile-api/webhook"
+	"userprofile-api/ws"
+)
+
+// Server is the users API along with the components it is built on. It is an
+// http.Handler serving the API's routes, under cfg.Server.BasePath, so it can
+// be mounted in another server; Start serves it on listeners of its own.
+type Server struct {
+	cfg      *config.Config
+	handler  http.Handler
+	logLevel *slog.LevelVar
+	reporter recovery.Reporter
+
+	// users is the user service of the gRPC API, publishing its changes to
+	// the same bus as the REST API's
+	users    *service.UserService
+	hub      *ws.Hub
+	sessions *credentials.Sessions
+
+	// cancel stops the background work New starts, such as scheduled backups
+	cancel context.CancelFunc
+	// cleanup releases the components New opened, in the order they were
+	// opened; Shutdown runs it backwards
+	cleanup []func(ctx context.Context) error
+
+	mu      sync.Mutex
+	started bool
+	closed  bool
+	// servers are the HTTP listeners Start serves on, the API's first
+	servers []*http.Server
+	grpc    *grpc.Server
+}
+
+// Option customizes a Server
+type Option func(*Server)
+
+// WithLogLevel applies the log level of reloaded configuration files to
+// level, which should be the level of the default logger. Without it, the log
+// level is left to the embedding program.
+func WithLogLevel(level *slog.LevelVar) Option {
+	return func(s *Server) { s.logLevel = level }
+}
+
+// WithReporter tells reporter of the panics recovered in the API's handlers,
+// such as to send them to an error tracker
+func WithReporter(reporter recovery.Reporter) Option {
+	return func(s *Server) { s.reporter = reporter }
+}
+
+// New opens the storage configured by cfg and the other components the API
+// is built on, and starts their background work, such as scheduled backups
+// and replication. The Server must be shut down to stop it and release them.
+func New(cfg *config.Config, opts ...Option) (*Server, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{cfg: cfg, cancel: cancel}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := s.open(ctx); err != nil {
+		// Release what was opened before the failing step
+		if releaseErr := s.release(context.Background()); releaseErr != nil {
+			log.Printf("Failed to release resources: %v", releaseErr)
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens the components of the API, starting their background work with
+// ctx, and builds its routes
+func (s *Server) open(ctx context.Context) error {
+	cfg := s.cfg
+	// Unexpected errors are reported to the error tracker, if configured,
+	// which is closed last so the errors of the other components' shutdown
+	// are sent too
+	var tracker *errortracking.Tracker
+	if cfg.ErrorTracking.Enabled() {
+		var err error
+		if tracker, err = errortracking.New(cfg.ErrorTracking, slog.Default()); err != nil {
+			return fmt.Errorf("failed to set up error tracking: %w", err)
+		}
+		s.onShutdown(tracker.Close)
+	}
+
+	repo, err := repository.Open(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to open %s repository: %w", cfg.Database.Driver, err)
+	}
+	if closer, ok := repo.(io.Closer); ok {
+		s.onShutdown(func(context.Context) error {
+			if err := closer.Close(); err != nil {
+				return fmt.Errorf("failed to close repository: %w", err)
+			}
+			return nil
+		})
+	}
+
+	// SQL databases record the events to publish with the changes themselves;
+	// this is checked before the repository is wrapped
+	outbox, _ := repo.(repository.Outbox)
+	// SQL databases also keep groups along with the users; elsewhere they
+	// are only kept in memory
+	groups := repository.NewGroups()
+	if store, ok := repo.(repository.GroupStore); ok {
+		groups.Use("", store)
+	}
+	// They keep background jobs too, so pending ones survive restarts
+	var jobRepo repository.JobRepository = repository.NewInMemoryJobRepository()
+	if store, ok := repo.(repository.JobStore); ok {
+		jobRepo = store.JobRepository()
+	}
+
+	// Calls to the storage backend failing with transient errors are
+	// retried, and rejected while it keeps failing. Cache hits are served
+	// all the same.
+	if cfg.Resilience.Enabled() {
+		repo = resilience.New(repo, cfg.Resilience, slog.Default())
+	}
+
+	// Reads are served from Redis when it is configured, for both APIs
+	if cfg.Cache.Enabled() {
+		cached, err := cache.Open(cfg.Cache, repo, slog.Default())
+		if err != nil {
+			return err
+		}
+		s.onShutdown(func(context.Context) error { return cached.Close() })
+		repo = cached
+	}
+
+	// Seed through the cache, if any, so entries from an earlier run of a
+	// persistent database are invalidated. Replicas take their users from
+	// the primary instead.
+	if !cfg.Replica.ReadOnly() {
+		if err := seed.Run(ctx, repo, cfg.Seed, cfg.Database.Driver, slog.Default()); err != nil {
+			return fmt.Errorf("failed to seed users: %w", err)
+		}
+	}
+
+	if !cfg.Auth.Enabled() {
+		log.Println("No API keys or JWT secret configured; /api/v1 is open to unauthenticated clients")
+	}
+
+	// Webhook deliveries, scheduled backups and sweeps for expired users run
+	// as background jobs
+	runner := jobs.New(jobRepo, cfg.Jobs, slog.Default())
+	s.onShutdown(func(ctx context.Context) error {
+		// Run jobs that are already queued, such as deliveries, before exiting
+		if err := runner.Close(ctx); err != nil {
+			return fmt.Errorf("failed to run queued jobs: %w", err)
+		}
+		return nil
+	})
+
+	bus := events.NewBus()
+	webhooks := webhook.FromConfig(cfg.Webhooks)
+	dispatcher := webhook.NewDispatcher(cfg.Webhooks, webhooks, runner, slog.Default())
+	bus.Subscribe(dispatcher.Handle)
+
+	// User changes are also published to a message broker when one is
+	// configured: from the outbox of SQL databases, and from the bus otherwise
+	var relay *publish.Relay
+	if cfg.Publish.Enabled() {
+		publisher, err := publish.Open(cfg.Publish.BrokerConfig)
+		if err != nil {
+			return fmt.Errorf("failed to set up event publishing: %w", err)
+		}
+		s.onShutdown(func(context.Context) error { return publisher.Close() })
+		if outbox != nil {
+			outbox.UseOutbox(publish.Encoder(cfg.Publish.BrokerConfig, ""))
+			relay = publish.NewRelay(publisher, cfg.Publish, slog.Default())
+			relay.Add("", outbox)
+			go relay.Run(ctx)
+		} else {
+			forwarder := publish.NewForwarder(publisher, cfg.Publish, slog.Default())
+			bus.Subscribe(forwarder.Handle)
+			s.onShutdown(func(ctx context.Context) error {
+				if err := forwarder.Close(ctx); err != nil {
+					return fmt.Errorf("failed to publish queued events: %w", err)
+				}
+				return nil
+			})
+		}
+	}
+
+	// A read replica changes its users only as the primary's events say, if
+	// it receives them, and refuses changes through its own APIs
+	writable := repo
+	if cfg.Replica.ReadOnly() {
+		log.Printf("Serving as a read replica of %s", cmp.Or(cfg.Replica.PrimaryURL, "the primary"))
+		repo = repository.ReadOnly(repo)
+	}
+
+	// Each registered tenant's users are opened on first use, publishing
+	// their changes to the same bus as the default storage's
+	var (
+		tenants        *tenant.Repositories
+		tenantRegistry *tenant.Registry
+	)
+	if cfg.Tenancy.Enabled() {
+		tenantRegistry, err = tenant.OpenRegistry(cfg.Tenancy.File)
+		if err != nil {
+			return fmt.Errorf("failed to load tenants: %w", err)
+		}
+		tenants = tenant.NewRepositories(func(id string) (repository.UserRepository, error) {
+			repo, err := repository.OpenTenant(cfg.Database, id)
+			if outbox, ok := repo.(repository.Outbox); ok && relay != nil {
+				outbox.UseOutbox(publish.Encoder(cfg.Publish.BrokerConfig, id))
+				relay.Add(id, outbox)
+			}
+			if store, ok := repo.(repository.GroupStore); ok {
+				groups.Use(id, store)
+			}
+			return repo, err
+		}, func(id string, repo repository.UserRepository) repository.UserRepository {
+			repo = events.TenantRepository(repo, bus, id)
+			if cfg.Replica.ReadOnly() {
+				repo = repository.ReadOnly(repo)
+			}
+			return repo
+		})
+		s.onShutdown(func(context.Context) error {
+			if err := tenants.Close(); err != nil {
+				return fmt.Errorf("failed to close tenant repositories: %w", err)
+			}
+			return nil
+		})
+	}
+
+	follows, err := follow.OpenStore(cfg.Follows.File)
+	if err != nil {
+		return fmt.Errorf("failed to load follows: %w", err)
+	}
+
+	// Partners sign their requests with the keys kept here
+	var signingKeys *signing.Registry
+	if cfg.Signing.Enabled {
+		if signingKeys, err = signing.OpenRegistry(cfg.Signing.File); err != nil {
+			return fmt.Errorf("failed to load signing keys: %w", err)
+		}
+	}
+
+	// Users with password-based accounts log in with the passwords kept here,
+	// and stay logged in with the sessions. Users that are deleted, suspended
+	// or archived are logged out.
+	var credentialStore *credentials.Store
+	var sessions *credentials.Sessions
+	if cfg.Passwords.Enabled {
+		if credentialStore, err = credentials.OpenStore(cfg.Passwords.File); err != nil {
+			return fmt.Errorf("failed to load credentials: %w", err)
+		}
+		if sessions, err = credentials.OpenSessions(cfg.Passwords.SessionsFile, cfg.Passwords.RefreshTTL); err != nil {
+			return fmt.Errorf("failed to load sessions: %w", err)
+		}
+		bus.Subscribe(func(e events.Event) {
+			if e.Type != events.UserDeleted && (e.Type != events.UserUpdated || e.User.Status == models.StatusActive) {
+				return
+			}
+			if err := sessions.RevokeUser(e.Tenant, e.User.ID); err != nil {
+				log.Printf("Failed to revoke the sessions of user %s: %v", e.User.ID, err)
+			}
+		})
+	}
+
+	// User metadata is checked against the default schema, or the schema of
+	// the user's tenant when it has one
+	metadataSchemas, err := metadata.New(cfg.Metadata, tenantRegistry)
+	if err != nil {
+		return fmt.Errorf("failed to load the metadata schema: %w", err)
+	}
+
+	// Deleted users leave every group they belonged to; restoring them does
+	// not bring the memberships back
+	bus.Subscribe(func(e events.Event) {
+		if e.Type != events.UserDeleted {
+			return
+		}
+		if err := groups.Tenant(e.Tenant).RemoveUser(context.Background(), e.User.ID); err != nil {
+			log.Printf("Failed to remove deleted user %s from groups: %v", e.User.ID, err)
+		}
+	})
+
+	// The primary's events are applied through the bus, so replicas serve
+	// live updates of them too
+	var syncer *replica.Syncer
+	if cfg.Replica.Enabled() {
+		subscriber, err := publish.OpenSubscriber(cfg.Replica.BrokerConfig, cfg.Replica.Group)
+		if err != nil {
+			return fmt.Errorf("failed to set up replication: %w", err)
+		}
+		syncer = replica.New(subscriber, cfg.Replica.BrokerConfig, events.Repository(writable, bus), tenants, slog.Default())
+		log.Printf("Replicating users from %s topic %s", cfg.Replica.Broker, cfg.Replica.Topic)
+		go syncer.Run(ctx)
+	}
+
+	// Error messages and the pages are translated with the built-in catalogs
+	// and those in LOCALES_DIR
+	catalog, err := i18n.Load(cfg.I18N)
+	if err != nil {
+		return fmt.Errorf("failed to load message catalogs: %w", err)
+	}
+
+	// Full names and bios are moderated by the wordlist and the external
+	// service configured, if any
+	moderator, err := moderation.New(cfg.Moderation, slog.Default())
+	if err != nil {
+		return fmt.Errorf("failed to set up content moderation: %w", err)
+	}
+
+	corsPolicy := cors.New(cfg.CORS)
+	hub := ws.NewHub(corsPolicy, slog.Default())
+	bus.Subscribe(hub.Handle)
+
+	// Scheduled backups stop on shutdown; on-demand ones are taken through
+	// the admin API
+	backups := backup.New(repo, backup.NewStore(cfg.Backup), cfg.Backup, slog.Default())
+	runner.Register(backup.JobKind, 1, backups.HandleJob)
+	runner.Schedule(backup.JobKind, cfg.Backup.Interval)
+
+	// Users past their expiry time are soft-deleted on the primary, which
+	// publishes the deletions to replicas like any other
+	janitor := expiry.New(service.NewUserService(events.Repository(repo, bus), metadataSchemas, slog.Default()).
+		WithTracker(tracker), tenantRegistry, tenants, slog.Default())
+	runner.Register(expiry.JobKind, 1, janitor.HandleJob)
+	if !cfg.Replica.ReadOnly() {
+		runner.Schedule(expiry.JobKind, cfg.Expiry.Interval)
+	}
+
+	// Users are imported from the directory on the primary, on demand
+	// through the admin API and, with LDAP_SYNC_INTERVAL, on a schedule
+	var directory *ldapsync.Syncer
+	if cfg.LDAP.Enabled() && !cfg.Replica.ReadOnly() {
+		directory, err = ldapsync.New(cfg.LDAP, service.NewUserService(events.Repository(repo, bus), metadataSchemas,
+			slog.Default()).WithModerator(moderator).WithTracker(tracker), slog.Default())
+		if err != nil {
+			return fmt.Errorf("failed to set up LDAP sync: %w", err)
+		}
+		runner.Register(ldapsync.JobKind, 1, directory.HandleJob)
+		if cfg.LDAP.Interval > 0 {
+			runner.Schedule(ldapsync.JobKind, cfg.LDAP.Interval)
+		}
+	}
+	go runner.Run(ctx)
+
+	// Edits to CONFIG_FILE and SEED_FILE are applied without a restart where
+	// that is safe
+	watcher := reload.New(cfg, reload.Targets{
+		LogLevel: s.logLevel,
+		CORS:     corsPolicy,
+		Users:    events.Repository(repo, bus),
+	}, slog.Default())
+	go watcher.Run(ctx)
+
+	// Requests, and optionally responses, are checked against the OpenAPI
+	// document outside production
+	var validator *contract.Validator
+	if cfg.Validation.Requests() {
+		if validator, err = contract.New(docs.Spec(), cfg.Validation, slog.Default()); err != nil {
+			return fmt.Errorf("failed to set up OpenAPI validation: %w", err)
+		}
+	}
+
+	s.users = service.NewUserService(events.Repository(repo, bus), metadataSchemas, slog.Default()).
+		WithModerator(moderator).WithTracker(tracker)
+	s.hub, s.sessions = hub, sessions
+	s.handler = api.SetupRouter(api.Options{
+		Config:     cfg,
+		Repository: repo,
+		BasePath:   cfg.Server.BasePath,
+		Reporter:   s.reporter,
+		Services: api.Services{
+			Events:         bus,
+			Webhooks:       webhooks,
+			Hub:            hub,
+			Backups:        backups,
+			CORS:           corsPolicy,
+			Tenants:        tenants,
+			TenantRegistry: tenantRegistry,
+			Contract:       validator,
+			Syncer:         syncer,
+			Follows:        follows,
+			Groups:         groups,
+			Metadata:       metadataSchemas,
+			Credentials:    credentialStore,
+			Sessions:       sessions,
+			Catalog:        catalog,
+			Moderator:      moderator,
+			Expiry:         janitor,
+			Jobs:           runner,
+			Tracker:        tracker,
+			SigningKeys:    signingKeys,
+			LDAP:           directory,
+		},
+	})
+	return nil
+}
+
+// ServeHTTP serves the API's routes, which are under cfg.Server.BasePath, and
+// the HTML pages at the root
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Start serves the API on cfg.Server.Addr, over HTTPS when TLS is configured,
+// along with the gRPC API, the plain HTTP redirect and the profiling endpoints
+// when their addresses are configured. It blocks until Shutdown is called,
+// returning http.ErrServerClosed, or until a listener fails, returning its
+// error; the other listeners then keep serving until Shutdown.
+func (s *Server) Start() error {
+	cfg := s.cfg
+	// The server terminates TLS itself when configured, and a plain HTTP
+	// listener redirects to it
+	tlsConfig, redirect, err := https.Setup(cfg.TLS, cfg.Server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to set up TLS: %w", err)
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return http.ErrServerClosed
+	}
+	if s.started {
+		s.mu.Unlock()
+		return errors.New("server already started")
+	}
+	s.started = true
+
+	server := &http.Server{Addr: cfg.Server.Addr, Handler: s, TLSConfig: tlsConfig}
+	tuneConnections(server, cfg.Server)
+	s.servers = append(s.servers, server)
+
+	// The gRPC API shares the user service and publishes the same events
+	var grpcListener net.Listener
+	if cfg.Server.GRPCAddr != "" {
+		if grpcListener, err = net.Listen("tcp", cfg.Server.GRPCAddr); err != nil {
+			s.mu.Unlock()
+			return fmt.Errorf("failed to listen for gRPC: %w", err)
+		}
+		guard := auth.NewGuard(cfg.Auth)
+		if s.sessions != nil {
+			guard.RejectRevoked(s.sessions.Revoked)
+		}
+		s.grpc = grpcapi.NewServer(s.users, guard, slog.Default())
+	}
+
+	var redirectServer *http.Server
+	if redirect != nil && cfg.TLS.RedirectAddr != "" {
+		redirectServer = &http.Server{Addr: cfg.TLS.RedirectAddr, Handler: redirect}
+		s.servers = append(s.servers, redirectServer)
+	}
+	// Profiling endpoints on their own address stay off the public listener
+	var debugServer *http.Server
+	if cfg.Debug.Enabled && cfg.Debug.Addr != "" {
+		debugServer = &http.Server{Addr: cfg.Debug.Addr, Handler: profiling.Handler()}
+		s.servers = append(s.servers, debugServer)
+	}
+	grpcServer := s.grpc
+	s.mu.Unlock()
+
+	errs := make(chan error, 4)
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			log.Printf("Starting HTTPS server on %s using %s storage", cfg.Server.Addr, cfg.Database.Driver)
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("Starting server on %s using %s storage", cfg.Server.Addr, cfg.Database.Driver)
+			err = server.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			err = fmt.Errorf("server failed: %w", err)
+		}
+		errs <- err
+	}()
+	if redirectServer != nil {
+		go func() {
+			log.Printf("Redirecting HTTP on %s to HTTPS", cfg.TLS.RedirectAddr)
+			if err := redirectServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("HTTP redirect server failed: %w", err)
+			}
+		}()
+	}
+	if grpcServer != nil {
+		go func() {
+			log.Printf("Starting gRPC server on %s", cfg.Server.GRPCAddr)
+			// Serve returns nil once stopped, or ErrServerStopped when it was
+			// stopped before it started
+			if err := grpcServer.Serve(grpcListener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+				errs <- fmt.Errorf("gRPC server failed: %w", err)
+			}
+		}()
+	}
+	if debugServer != nil {
+		go func() {
+			log.Printf("Serving profiling endpoints on %s", cfg.Debug.Addr)
+			if err := debugServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("profiling server failed: %w", err)
+			}
+		}()
+	}
+	return <-errs
+}
+
+// Shutdown stops the listeners Start serves on, letting in-flight requests
+// and RPCs finish until ctx is done, and disconnects the live update clients.
+// It then stops the background work, sends the webhooks and events that are
+// still queued, and closes the storage. The Server cannot be used afterwards.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	servers, grpcServer := s.servers, s.grpc
+	s.mu.Unlock()
+
+	// Shutdown does not track upgraded connections, so close them explicitly
+	s.hub.Close()
+	var errs []error
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			// Requests still running past the deadline are cut off
+			server.Close()
+			errs = append(errs, fmt.Errorf("graceful shutdown failed: %w", err))
+		}
+	}
+	if grpcServer != nil {
+		stopGRPC(ctx, grpcServer)
+	}
+	return errors.Join(append(errs, s.release(ctx))...)
+}
+
+// onShutdown adds a step to the release of the Server's components
+func (s *Server) onShutdown(step func(ctx context.Context) error) {
+	s.cleanup = append(s.cleanup, step)
+}
+
+// release stops the background work and releases the components that were
+// opened, the last first
+func (s *Server) release(ctx context.Context) error {
+	s.cancel()
+	var errs []error
+	for i := len(s.cleanup) - 1; i >= 0; i-- {
+		if err := s.cleanup[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.cleanup = nil
+	return errors.Join(errs...)
+}
+
+// tuneConnections applies the configured timeouts and limits to the
+// server's connections, and lets clients speak HTTP/2 without TLS when H2C
+// is set
+func tuneConnections(server *http.Server, cfg config.ServerConfig) {
+	server.ReadHeaderTimeout = cfg.ReadHeaderTimeout
+	server.IdleTimeout = cfg.IdleTimeout
+	server.MaxHeaderBytes = cfg.MaxHeaderBytes
+	server.SetKeepAlivesEnabled(cfg.KeepAlives)
+	if cfg.H2C {
+		// Setting Protocols replaces the defaults, so HTTP/1 and HTTP/2
+		// over TLS are listed again
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetHTTP2(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+}
+
+// stopGRPC lets in-flight RPCs finish, cancelling them once ctx is done
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.Stop()
+	}
+}
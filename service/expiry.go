@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+// errNotExpired aborts the expiry of a user whose expiry time changed after
+// it was found expired
+var errNotExpired = errors.New("user has not expired")
+
+// Expire soft-deletes the users whose expiry time is not after now, whatever
+// their status, and returns how many it deleted. Each is deleted in a
+// transaction of its own, recorded as ActionExpire; users changed in the
+// meantime so they no longer expire are skipped. Failures to delete a user
+// are joined in the error, after the others have been tried.
+func (s *UserService) Expire(ctx context.Context, now time.Time) (int, error) {
+	var expired []models.UserProfile
+	err := repository.Stream(ctx, s.repo, repository.ListOptions{}, func(user models.UserProfile) error {
+		if user.Expired(now) {
+			expired = append(expired, user)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	var errs []error
+	for _, user := range expired {
+		_, err := s.change(ctx, ActionExpire, func(ctx context.Context) (models.UserProfile, error) {
+			current, err := s.repo.Get(ctx, user.ID)
+			if err != nil {
+				return models.UserProfile{}, err
+			}
+			if !current.Expired(now) {
+				return models.UserProfile{}, errNotExpired
+			}
+			return models.UserProfile{ID: user.ID}, s.repo.Delete(ctx, user.ID)
+		}, slog.Time("expiresAt", *user.ExpiresAt))
+		switch {
+		case errors.Is(err, errNotExpired) || errors.Is(err, repository.ErrNotFound):
+		case err != nil:
+			errs = append(errs, err)
+		default:
+			deleted++
+		}
+	}
+	return deleted, errors.Join(errs...)
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+// ErrVersionNotFound is returned when a user is reverted to a version its
+// history does not keep, or that is not older than its current version
+var ErrVersionNotFound = errors.New("version not found")
+
+// Versions returns every version of the user with the given ID kept by the
+// repository's audit trail, oldest first, ending with the current one.
+// Repositories keeping no trail only have the current version.
+func (s *UserService) Versions(ctx context.Context, id string) ([]models.UserProfile, error) {
+	current, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	records, err := s.trail(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Changes that keep the version, such as setting the avatar, replace the
+	// version they were made to
+	byVersion := map[int]models.UserProfile{}
+	for _, record := range records {
+		if record.User != nil && record.User.ID == id {
+			byVersion[record.User.Version] = *record.User
+		}
+	}
+	byVersion[current.Version] = current
+
+	versions := make([]models.UserProfile, 0, len(byVersion))
+	for _, user := range byVersion {
+		versions = append(versions, user)
+	}
+	slices.SortFunc(versions, func(a, b models.UserProfile) int {
+		return a.Version - b.Version
+	})
+	return versions, nil
+}
+
+// GetAsOf returns the user with the given ID as it was at t, replaying the
+// repository's audit trail, and repository.ErrNotFound if it did not exist or
+// was deleted then. Without a trail, only the current user is known, from
+// the time it was last updated.
+func (s *UserService) GetAsOf(ctx context.Context, id string, t time.Time) (models.UserProfile, error) {
+	records, err := s.trail(ctx, id)
+	if err != nil {
+		return models.UserProfile{}, err
+	}
+	if len(records) == 0 {
+		current, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return models.UserProfile{}, err
+		}
+		if current.UpdatedAt.After(t) {
+			return models.UserProfile{}, repository.ErrNotFound
+		}
+		return current, nil
+	}
+
+	var user *models.UserProfile
+	for _, record := range records {
+		if record.CreatedAt.After(t) {
+			break
+		}
+		switch {
+		case record.Action == ActionDelete || record.Action == ActionExpire:
+			user = nil
+		case record.User != nil && record.User.ID == id:
+			user = record.User
+		}
+	}
+	if user == nil {
+		return models.UserProfile{}, repository.ErrNotFound
+	}
+	return *user, nil
+}
+
+// Revert rolls the user with the given ID back to one of its past versions,
+// saving the version's full name, emoji, email address, bio, location, tags
+// and metadata as a new version. The status and avatar are kept. check, when
+// set, is given the current user and may reject it, such as with
+// repository.ErrVersionMismatch when it is not the version the caller read.
+// The version must pass the rules of Update, as they are now.
+func (s *UserService) Revert(ctx context.Context, id string, version int, check func(current models.UserProfile) error) (models.UserProfile, error) {
+	return s.update(ctx, ActionRevert, id, func(ctx context.Context, user *models.UserProfile) error {
+		if check != nil {
+			if err := check(*user); err != nil {
+				return callerError{err}
+			}
+		}
+		if version >= user.Version {
+			return ErrVersionNotFound
+		}
+		versions, err := s.Versions(ctx, id)
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(versions, func(past models.UserProfile) bool {
+			return past.Version == version
+		})
+		if i < 0 {
+			return ErrVersionNotFound
+		}
+		past := versions[i]
+		user.FullName, user.Emoji, user.Email = past.FullName, past.Emoji, past.Email
+		user.Bio, user.Location = past.Bio, past.Location
+		user.Tags, user.Metadata = past.Tags, past.Metadata
+		return nil
+	}, slog.Int("toVersion", version))
+}
+
+// trail returns the audit trail of the user with the given ID, which is empty
+// when the repository keeps none
+func (s *UserService) trail(ctx context.Context, id string) ([]repository.AuditRecord, error) {
+	records, err := repository.Trail(ctx, s.repo, id)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil, nil
+	}
+	return records, err
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+// ActionMerge records a duplicate user merged into another
+const ActionMerge = "user.merge"
+
+// ErrMergeSelf is returned when a user would be merged into itself
+var ErrMergeSelf = errors.New("users cannot be merged into themselves")
+
+// MergeStrategy decides which of two users' values a merged user keeps when
+// both have one
+type MergeStrategy string
+
+// Merge strategies. Whatever the strategy, values only one of the users has
+// are kept, tags are combined, and the merged user keeps its own email
+// address, which stays reserved by the deleted duplicate.
+const (
+	// MergeKeepTarget keeps the values of the user merged into
+	MergeKeepTarget MergeStrategy = "keepTarget"
+	// MergePreferDuplicate takes the values of the duplicate
+	MergePreferDuplicate MergeStrategy = "preferDuplicate"
+	// MergeNewest takes the values of the user updated last
+	MergeNewest MergeStrategy = "newest"
+)
+
+// MergeStrategies lists the strategies Merge accepts
+var MergeStrategies = []MergeStrategy{MergeKeepTarget, MergePreferDuplicate, MergeNewest}
+
+// Merge merges the duplicate user into the user with the given ID, combining
+// their fields by strategy, and soft-deletes the duplicate. The duplicate's
+// audit trail is handed over to the merged user, and repoint, when set, is
+// called within the same transaction to hand over anything else that refers
+// to the duplicate, such as its relationships.
+func (s *UserService) Merge(ctx context.Context, id, duplicateID string, strategy MergeStrategy,
+	repoint func(ctx context.Context, fromID, toID string) error) (models.UserProfile, error) {
+	if id == duplicateID {
+		return models.UserProfile{}, ErrMergeSelf
+	}
+	return s.change(ctx, ActionMerge, func(ctx context.Context) (models.UserProfile, error) {
+		target, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return models.UserProfile{}, err
+		}
+		duplicate, err := s.repo.Get(ctx, duplicateID)
+		if err != nil {
+			return models.UserProfile{}, err
+		}
+
+		merged := mergeUsers(target, duplicate, strategy)
+		if err := s.validate(merged, !reflect.DeepEqual(merged.Metadata, target.Metadata)); err != nil {
+			return models.UserProfile{}, err
+		}
+		if err := s.repo.Delete(ctx, duplicateID); err != nil {
+			return models.UserProfile{}, err
+		}
+		updated, err := s.repo.Update(ctx, id, merged)
+		if err != nil {
+			return models.UserProfile{}, err
+		}
+		if err := repository.MoveAudit(ctx, s.repo, duplicateID, id); err != nil {
+			return models.UserProfile{}, err
+		}
+		if repoint != nil {
+			if err := repoint(ctx, duplicateID, id); err != nil {
+				return models.UserProfile{}, err
+			}
+		}
+		return updated, nil
+	}, slog.String("duplicateId", duplicateID), slog.String("strategy", string(strategy)))
+}
+
+// mergeUsers returns target with the values of duplicate combined by
+// strategy, normalized
+func mergeUsers(target, duplicate models.UserProfile, strategy MergeStrategy) models.UserProfile {
+	preferred, other := target.Clone(), duplicate.Clone()
+	switch strategy {
+	case MergePreferDuplicate:
+		preferred, other = other, preferred
+	case MergeNewest:
+		if duplicate.UpdatedAt.After(target.UpdatedAt) {
+			preferred, other = other, preferred
+		}
+	}
+
+	merged := target.Clone()
+	merged.FullName = either(preferred.FullName, other.FullName)
+	merged.Emoji = either(preferred.Emoji, other.Emoji)
+	merged.Bio = either(preferred.Bio, other.Bio)
+	merged.Location = either(preferred.Location, other.Location)
+	merged.Tags = append(merged.Tags, duplicate.Tags...)
+	if len(other.Metadata) > 0 {
+		merged.Metadata = other.Metadata
+		for key, value := range preferred.Metadata {
+			merged.Metadata[key] = value
+		}
+	}
+	merged.Normalize()
+	merged.Tags = merged.Tags[:min(len(merged.Tags), models.MaxTags)]
+	return merged
+}
+
+// either returns preferred unless it is empty
+func either(preferred, other string) string {
+	if preferred != "" {
+		return preferred
+	}
+	return other
+}
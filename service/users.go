@@ -0,0 +1,451 @@
+// Package service holds the business rules of user profiles, so the REST
+// and gRPC APIs, the HTML pages and the command line apply them alike and
+// are left to translate between their protocols and the service.
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"userprofile-api/auth"
+	"userprofile-api/dedupe"
+	"userprofile-api/errortracking"
+	"userprofile-api/lifecycle"
+	"userprofile-api/metadata"
+	"userprofile-api/models"
+	"userprofile-api/moderation"
+	"userprofile-api/repository"
+	"userprofile-api/tenant"
+)
+
+// ErrInvalid is wrapped by the errors of users that break the validation
+// rules, along with a validator.ValidationErrors or a *metadata.Error
+// listing the offending fields, or a *moderation.RejectedError
+var ErrInvalid = errors.New("invalid user")
+
+// Actions recorded in the audit log
+const (
+	ActionCreate  = "user.create"
+	ActionUpdate  = "user.update"
+	ActionDelete  = "user.delete"
+	ActionRestore = "user.restore"
+	ActionStatus  = "user.status"
+	ActionAvatar  = "user.avatar"
+	ActionRevert  = "user.revert"
+	// ActionExpire records a user soft-deleted for reaching its expiry time
+	ActionExpire = "user.expire"
+	// ActionFlag records that moderation flagged the content of a change
+	// for review, along with the change's own record
+	ActionFlag = "user.flag"
+)
+
+// UserService creates, changes and deletes users, applying the rules every
+// client of the repository is held to:
+//
+//   - users created without an ID are given a UUID
+//   - users must pass the validation rules of their fields, and metadata the
+//     schema of their tenant
+//   - full names and bios must pass the moderator, if any, which may also
+//     flag them for review
+//   - IDs and email addresses are unique, which the repository enforces
+//     atomically and reports with repository.ErrConflict and
+//     repository.ErrEmailConflict
+//   - the status only changes through the lifecycle's transitions
+//   - changes apply to the version of the user they were made to
+//
+// Every change is made in a transaction of the repository, together with its
+// record in the repository's audit trail, which keeps the user it left behind
+// as a version of its history, and, on SQL backends, its outbox
+// message, and is written to the audit log once committed, naming the caller
+// carried by the context. The repository publishes the change events, so the
+// service must be given one wrapped with events.Repository for subscribers
+// to learn of its changes. Reads go straight to the repository.
+type UserService struct {
+	repo    repository.UserRepository
+	schemas *metadata.Schemas
+	// moderator is nil when content is not moderated
+	moderator moderation.Moderator
+	// audit is nil when changes are not audited
+	audit *slog.Logger
+	// tracker is nil when unexpected errors are not reported
+	tracker *errortracking.Tracker
+	// tenant is the tenant whose users repo holds, or "" for the default
+	// storage
+	tenant string
+}
+
+// NewUserService creates a service keeping the users of the default storage
+// in repo, checking their metadata against schemas unless it is nil and
+// recording changes in audit unless it is nil
+func NewUserService(repo repository.UserRepository, schemas *metadata.Schemas, audit *slog.Logger) *UserService {
+	return &UserService{repo: repo, schemas: schemas, audit: audit}
+}
+
+// ForTenant returns a service working on the users of a tenant, kept in repo.
+// An empty tenant selects the default storage.
+func (s *UserService) ForTenant(tenant string, repo repository.UserRepository) *UserService {
+	scoped := *s
+	scoped.tenant, scoped.repo = tenant, repo
+	return &scoped
+}
+
+// WithModerator returns a service having the full names and bios of the
+// users it creates and updates checked by moderator
+func (s *UserService) WithModerator(moderator moderation.Moderator) *UserService {
+	moderated := *s
+	moderated.moderator = moderator
+	return &moderated
+}
+
+// WithTracker returns a service reporting the unexpected errors of the
+// changes it makes to tracker, such as failures of the storage or the
+// moderator, along with the tenant of the users
+func (s *UserService) WithTracker(tracker *errortracking.Tracker) *UserService {
+	tracked := *s
+	tracked.tracker = tracker
+	return &tracked
+}
+
+// Repository returns the repository the service keeps its users in
+func (s *UserService) Repository() repository.UserRepository {
+	return s.repo
+}
+
+// List returns a page of the users opts selects, and how many it selects in
+// total
+func (s *UserService) List(ctx context.Context, opts repository.ListOptions) ([]models.UserProfile, int, error) {
+	return s.repo.List(ctx, opts)
+}
+
+// Stream calls yield with every user opts selects, in order, stopping at the
+// first error
+func (s *UserService) Stream(ctx context.Context, opts repository.ListOptions, yield func(models.UserProfile) error) error {
+	return repository.Stream(ctx, s.repo, opts, yield)
+}
+
+// Get returns the user with the given ID
+func (s *UserService) Get(ctx context.Context, id string) (models.UserProfile, error) {
+	return s.repo.Get(ctx, id)
+}
+
+// GetByEmail returns the active user with the given email address
+func (s *UserService) GetByEmail(ctx context.Context, email string) (models.UserProfile, error) {
+	return s.repo.GetByEmail(ctx, email)
+}
+
+// Search returns the users matching a full-text query, most relevant first
+func (s *UserService) Search(ctx context.Context, opts repository.SearchOptions) ([]repository.SearchResult, error) {
+	return s.repo.Search(ctx, opts)
+}
+
+// Duplicate is an active user that is likely the same person as a candidate
+type Duplicate struct {
+	User models.UserProfile
+	dedupe.Match
+}
+
+// FindDuplicates returns the active users most likely to be the same person
+// as candidate, by the similarity of their full names and email addresses,
+// best matches first. limit caps the number of users returned; zero means no
+// limit.
+func (s *UserService) FindDuplicates(ctx context.Context, candidate models.UserProfile, limit int) ([]Duplicate, error) {
+	candidate.Normalize()
+	duplicates := []Duplicate{}
+	err := repository.Stream(ctx, s.repo, repository.ListOptions{}, func(user models.UserProfile) error {
+		if match := dedupe.Compare(candidate, user); match.Score >= dedupe.MinScore {
+			duplicates = append(duplicates, Duplicate{User: user, Match: match})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(duplicates, func(a, b Duplicate) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	if limit > 0 && len(duplicates) > limit {
+		duplicates = duplicates[:limit]
+	}
+	return duplicates, nil
+}
+
+// Stats counts the active users in total, by emoji, tag and creation time
+func (s *UserService) Stats(ctx context.Context) (repository.UserStats, error) {
+	return s.repo.Stats(ctx)
+}
+
+// Create adds a new user, generating its ID when it has none. New users are
+// active whatever status they are given.
+func (s *UserService) Create(ctx context.Context, user models.UserProfile) (models.UserProfile, error) {
+	if user.ID == "" {
+		user.ID = uuid.NewString()
+	}
+	user.Status = ""
+	user.Normalize()
+	if err := s.validate(user, true); err != nil {
+		return models.UserProfile{}, err
+	}
+	decision, err := s.moderate(ctx, user)
+	if err != nil {
+		return models.UserProfile{}, err
+	}
+	created, err := s.change(ctx, ActionCreate, func(ctx context.Context) (models.UserProfile, error) {
+		created, err := s.repo.Create(ctx, user)
+		if err != nil {
+			return models.UserProfile{}, err
+		}
+		return created, s.flag(ctx, created, decision)
+	})
+	if err != nil {
+		return models.UserProfile{}, err
+	}
+	s.logFlag(ctx, created, decision)
+	return created, nil
+}
+
+// Update applies change to the user with the given ID and saves the result,
+// failing with repository.ErrVersionMismatch if the user changed in the
+// meantime. change may reject the user's current version by returning
+// repository.ErrVersionMismatch itself, or fail with any other error, which
+// Update returns. The ID, status and creation time cannot be changed this way
+// and keep their values; metadata is only checked against the schema when it
+// changes, so users keep metadata written before the schema changed until it
+// is replaced. The same goes for the moderation of full names and bios.
+func (s *UserService) Update(ctx context.Context, id string, change func(user *models.UserProfile) error) (models.UserProfile, error) {
+	return s.update(ctx, ActionUpdate, id, func(_ context.Context, user *models.UserProfile) error {
+		if err := change(user); err != nil {
+			return callerError{err}
+		}
+		return nil
+	})
+}
+
+// update is Update recording the change as action; change is given the
+// context of the change's transaction
+func (s *UserService) update(ctx context.Context, action, id string, change func(ctx context.Context, user *models.UserProfile) error,
+	attrs ...slog.Attr) (models.UserProfile, error) {
+	var decision moderation.Decision
+	updated, err := s.change(ctx, action, func(ctx context.Context) (models.UserProfile, error) {
+		current, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return models.UserProfile{}, err
+		}
+		updated := current.Clone()
+		if err := change(ctx, &updated); err != nil {
+			return models.UserProfile{}, err
+		}
+		updated.ID, updated.Status, updated.CreatedAt = current.ID, current.Status, current.CreatedAt
+		// The repository re-checks the version atomically
+		updated.Version = current.Version
+		updated.Normalize()
+		if err := s.validate(updated, !reflect.DeepEqual(updated.Metadata, current.Metadata)); err != nil {
+			return models.UserProfile{}, err
+		}
+		decision = moderation.Decision{}
+		if updated.FullName != current.FullName || updated.Bio != current.Bio {
+			// Moderators are asked within the transaction, so they must answer
+			// quickly; external services are bounded by MODERATION_TIMEOUT
+			if decision, err = s.moderate(ctx, updated); err != nil {
+				return models.UserProfile{}, err
+			}
+		}
+		saved, err := s.repo.Update(ctx, id, updated)
+		if err != nil {
+			return models.UserProfile{}, err
+		}
+		return saved, s.flag(ctx, saved, decision)
+	}, attrs...)
+	if err != nil {
+		return models.UserProfile{}, err
+	}
+	s.logFlag(ctx, updated, decision)
+	return updated, nil
+}
+
+// SetAvatarURL points the user's avatar at url, incrementing its version so
+// the ETag changes along with the avatar
+func (s *UserService) SetAvatarURL(ctx context.Context, id, url string) (models.UserProfile, error) {
+	return s.change(ctx, ActionAvatar, func(ctx context.Context) (models.UserProfile, error) {
+		return s.repo.SetAvatarURL(ctx, id, url)
+	})
+}
+
+// Transition moves the user to a status, failing with a
+// *lifecycle.TransitionError when its current status cannot move there. A
+// user already in the status is returned unchanged.
+func (s *UserService) Transition(ctx context.Context, id string, to models.Status) (models.UserProfile, error) {
+	return s.change(ctx, ActionStatus, func(ctx context.Context) (models.UserProfile, error) {
+		return lifecycle.Transition(ctx, s.repo, id, to)
+	}, slog.String("status", string(to)))
+}
+
+// Delete soft-deletes the user with the given ID; Restore undoes it
+func (s *UserService) Delete(ctx context.Context, id string) error {
+	_, err := s.change(ctx, ActionDelete, func(ctx context.Context) (models.UserProfile, error) {
+		return models.UserProfile{ID: id}, s.repo.Delete(ctx, id)
+	})
+	return err
+}
+
+// Restore undeletes a soft-deleted user. Users whose expiry time has passed
+// lose it, so they are not expired again.
+func (s *UserService) Restore(ctx context.Context, id string) (models.UserProfile, error) {
+	return s.change(ctx, ActionRestore, func(ctx context.Context) (models.UserProfile, error) {
+		restored, err := s.repo.Restore(ctx, id)
+		if err != nil || !restored.Expired(time.Now()) {
+			return restored, err
+		}
+		restored.ExpiresAt = nil
+		return s.repo.Update(ctx, id, restored)
+	})
+}
+
+// change makes a change to a user with apply, in a transaction that also adds
+// the change to the repository's audit trail, and writes it to the audit log
+// once the transaction has committed
+func (s *UserService) change(ctx context.Context, action string, apply func(ctx context.Context) (models.UserProfile, error),
+	attrs ...slog.Attr) (models.UserProfile, error) {
+	actor := actorOf(ctx)
+	var user models.UserProfile
+	err := repository.Transaction(ctx, s.repo, func(ctx context.Context) error {
+		var err error
+		if user, err = apply(ctx); err != nil {
+			return err
+		}
+		record := repository.AuditRecord{
+			Action:  action,
+			Actor:   actor,
+			UserID:  user.ID,
+			Version: user.Version,
+			Status:  user.Status,
+		}
+		if user.Version > 0 {
+			record.User = &user
+		}
+		return repository.RecordAudit(ctx, s.repo, record)
+	})
+	if err != nil {
+		s.report(ctx, err)
+		return models.UserProfile{}, err
+	}
+	s.log(ctx, action, actor, user, attrs...)
+	return user, nil
+}
+
+// callerError wraps the errors of the functions callers pass the service,
+// which are theirs to handle rather than to report
+type callerError struct {
+	err error
+}
+
+func (e callerError) Error() string { return e.err.Error() }
+
+func (e callerError) Unwrap() error { return e.err }
+
+// report sends err to the tracker, if any, unless it is one of the outcomes
+// callers expect, such as a missing user or an invalid change, or their own
+func (s *UserService) report(ctx context.Context, err error) {
+	var caller callerError
+	switch {
+	case s.tracker == nil, errors.As(err, &caller),
+		errors.Is(err, ErrInvalid), errors.Is(err, ErrVersionNotFound), errors.Is(err, ErrMergeSelf),
+		errors.Is(err, errNotExpired), errors.Is(err, lifecycle.ErrInvalidTransition),
+		errors.Is(err, repository.ErrNotFound), errors.Is(err, repository.ErrConflict),
+		errors.Is(err, repository.ErrVersionMismatch), errors.Is(err, repository.ErrReadOnly),
+		errors.Is(err, repository.ErrUnavailable),
+		errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return
+	}
+	if s.tenant != "" {
+		ctx = tenant.NewContext(ctx, s.tenant)
+	}
+	s.tracker.Capture(ctx, err)
+}
+
+// actorOf returns the name of the principal making a change
+func actorOf(ctx context.Context) string {
+	if principal, ok := auth.FromContext(ctx); ok {
+		return principal.Name
+	}
+	return "anonymous"
+}
+
+// moderate asks the moderator about the full name and bio of user, returning
+// an error wrapping ErrInvalid when it rejects them
+func (s *UserService) moderate(ctx context.Context, user models.UserProfile) (moderation.Decision, error) {
+	if s.moderator == nil {
+		return moderation.Decision{Verdict: moderation.Allow}, nil
+	}
+	decision, err := s.moderator.Moderate(ctx, moderation.Content{FullName: user.FullName, Bio: user.Bio})
+	if err != nil {
+		return moderation.Decision{}, err
+	}
+	if decision.Verdict == moderation.Reject {
+		return moderation.Decision{}, fmt.Errorf("%w: %w", ErrInvalid, &moderation.RejectedError{Field: decision.Field, Reason: decision.Reason})
+	}
+	return decision, nil
+}
+
+// flag records that the content of a change made to user was flagged for
+// review, within the change's transaction. Other decisions record nothing.
+func (s *UserService) flag(ctx context.Context, user models.UserProfile, decision moderation.Decision) error {
+	if decision.Verdict != moderation.Flag {
+		return nil
+	}
+	return repository.RecordAudit(ctx, s.repo, repository.AuditRecord{
+		Action:  ActionFlag,
+		Actor:   actorOf(ctx),
+		UserID:  user.ID,
+		Version: user.Version,
+		Status:  user.Status,
+	})
+}
+
+// logFlag writes the audit log entry of a flagged change once it committed
+func (s *UserService) logFlag(ctx context.Context, user models.UserProfile, decision moderation.Decision) {
+	if decision.Verdict == moderation.Flag {
+		s.log(ctx, ActionFlag, actorOf(ctx), user, slog.String("field", decision.Field), slog.String("reason", decision.Reason))
+	}
+}
+
+// validate checks the user against the validation rules of its fields and,
+// when checkMetadata is set, its metadata against the tenant's schema
+func (s *UserService) validate(user models.UserProfile, checkMetadata bool) error {
+	if err := binding.Validator.ValidateStruct(&user); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	if !checkMetadata || s.schemas == nil {
+		return nil
+	}
+	err := s.schemas.Validate(s.tenant, user.Metadata)
+	var metadataErr *metadata.Error
+	if errors.As(err, &metadataErr) {
+		return fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	return err
+}
+
+// log writes an entry to the audit log for a change made to user by actor
+func (s *UserService) log(ctx context.Context, action, actor string, user models.UserProfile, attrs ...slog.Attr) {
+	if s.audit == nil {
+		return
+	}
+	attrs = append([]slog.Attr{
+		slog.String("action", action),
+		slog.String("actor", actor),
+		slog.String("tenant", s.tenant),
+		slog.String("userId", user.ID),
+	}, attrs...)
+	if user.Version > 0 {
+		attrs = append(attrs, slog.Int("version", user.Version))
+	}
+	s.audit.LogAttrs(ctx, slog.LevelInfo, "audit", attrs...)
+}
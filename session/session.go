@@ -0,0 +1,150 @@
+// Package session keeps the logins of the HTML pages: the accounts that may
+// log in, a server-side store of their sessions and the HttpOnly cookie
+// naming a browser's session. Sessions are not accepted by the JSON API,
+// which keeps its own credentials.
+package session
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"userprofile-api/auth"
+	"userprofile-api/config"
+)
+
+// CookieName is the cookie holding the ID of a browser's session
+const CookieName = "session_id"
+
+// session is a logged-in account until it expires
+type session struct {
+	principal auth.Principal
+	expires   time.Time
+}
+
+// Store checks logins against the configured accounts and keeps the
+// sessions they start in memory, so they end when the server restarts
+type Store struct {
+	ttl    time.Duration
+	secure bool
+	// accounts holds the accounts by name
+	accounts map[string]config.Account
+	// dummyHash is compared with the passwords of unknown accounts, so that
+	// failed logins take as long whether or not the account exists
+	dummyHash []byte
+
+	mu       sync.Mutex
+	sessions map[string]session
+}
+
+// NewStore creates a store for the configured accounts
+func NewStore(cfg config.SessionConfig) *Store {
+	accounts := make(map[string]config.Account, len(cfg.Accounts))
+	for _, account := range cfg.Accounts {
+		accounts[account.Name] = account
+	}
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte(newID()), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return &Store{
+		ttl:       cfg.TTL,
+		secure:    cfg.SecureCookie,
+		accounts:  accounts,
+		dummyHash: dummyHash,
+		sessions:  make(map[string]session),
+	}
+}
+
+// Login starts a session for the named account when the password matches
+// its hash, replacing the browser's previous session, and reports whether
+// it did
+func (s *Store) Login(c *gin.Context, name, password string) bool {
+	account, ok := s.accounts[name]
+	hash := s.dummyHash
+	if ok {
+		hash = []byte(account.PasswordHash)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || !ok {
+		return false
+	}
+
+	roles := account.Roles
+	if len(roles) == 0 {
+		roles = []string{config.RoleViewer}
+	}
+	now := time.Now()
+	id := newID()
+
+	s.mu.Lock()
+	// A new ID on every login keeps an ID planted before it from being
+	// used after it
+	if previous, err := c.Cookie(CookieName); err == nil {
+		delete(s.sessions, previous)
+	}
+	for sessionID, existing := range s.sessions {
+		if now.After(existing.expires) {
+			delete(s.sessions, sessionID)
+		}
+	}
+	s.sessions[id] = session{
+		principal: auth.Principal{Name: account.Name, Roles: roles},
+		expires:   now.Add(s.ttl),
+	}
+	s.mu.Unlock()
+
+	s.setCookie(c, id, int(s.ttl.Seconds()))
+	return true
+}
+
+// Logout ends the browser's session and clears its cookie
+func (s *Store) Logout(c *gin.Context) {
+	if id, err := c.Cookie(CookieName); err == nil {
+		s.mu.Lock()
+		delete(s.sessions, id)
+		s.mu.Unlock()
+	}
+	s.setCookie(c, "", -1)
+}
+
+// Middleware records the account of the browser's session, if it has one
+// that has not expired, as the request's principal
+func (s *Store) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if id, err := c.Cookie(CookieName); err == nil {
+			s.mu.Lock()
+			current, ok := s.sessions[id]
+			s.mu.Unlock()
+			if ok && time.Now().Before(current.expires) {
+				auth.SetPrincipal(c, current.principal)
+			}
+		}
+		c.Next()
+	}
+}
+
+// setCookie sets the session cookie, or deletes it when maxAge is negative.
+// Lax rather than Strict keeps people logged in when they follow a link to
+// the pages from another site.
+func (s *Store) setCookie(c *gin.Context, id string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     CookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   s.secure || c.Request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// newID returns 32 random bytes, base64url-encoded
+func newID() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,98 @@
+// Package sharing signs links that let people without credentials read a
+// user's profile until the link expires, and authenticates the requests made
+// through them.
+package sharing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"userprofile-api/auth"
+	"userprofile-api/config"
+)
+
+// Query parameters a shared link carries along with the path it grants
+const (
+	ExpiresParam   = "expires"
+	SignatureParam = "signature"
+)
+
+// Link is a shared link handed out to the caller
+type Link struct {
+	XMLName xml.Name `json:"-" yaml:"-" xml:"sharedLink"`
+	// URL reads the profile without other credentials until ExpiresAt
+	URL       string    `json:"url" xml:"url" yaml:"url"`
+	ExpiresAt time.Time `json:"expiresAt" xml:"expiresAt" yaml:"expiresAt"`
+}
+
+// Signer signs and checks shared links with a secret
+type Signer struct {
+	secret []byte
+}
+
+// NewSigner creates a signer for the given secret
+func NewSigner(secret string) *Signer {
+	return &Signer{secret: []byte(secret)}
+}
+
+// Link returns the link to path, such as /api/v1/users/42, under baseURL,
+// valid until expires. The signature covers the path and expiry only, so
+// the query parameters of the endpoint, such as fields, can be added to it.
+func (s *Signer) Link(baseURL, path string, expires time.Time) Link {
+	expires = expires.Truncate(time.Second).UTC()
+	query := url.Values{
+		ExpiresParam:   {strconv.FormatInt(expires.Unix(), 10)},
+		SignatureParam: {hex.EncodeToString(s.sign(path, expires))},
+	}
+	return Link{URL: baseURL + path + "?" + query.Encode(), ExpiresAt: expires}
+}
+
+// sign returns the HMAC-SHA256 of the path and expiry
+func (s *Signer) sign(path string, expires time.Time) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%d", path, expires.Unix())
+	return mac.Sum(nil)
+}
+
+// Authenticator lets GET requests through a link signed by a signer, as a
+// viewer. The principal is named after the path, so each link has a rate
+// limit of its own.
+type Authenticator struct {
+	signer *Signer
+}
+
+// NewAuthenticator creates an authenticator for the links of signer
+func NewAuthenticator(signer *Signer) *Authenticator {
+	return &Authenticator{signer: signer}
+}
+
+// Authenticate implements auth.Authenticator
+func (a *Authenticator) Authenticate(r *http.Request) (auth.Principal, error) {
+	query := r.URL.Query()
+	if !query.Has(SignatureParam) {
+		return auth.Principal{}, auth.ErrNoCredentials
+	}
+	if r.Method != http.MethodGet {
+		return auth.Principal{}, fmt.Errorf("%w: shared links only allow GET", auth.ErrInvalidCredentials)
+	}
+	seconds, err := strconv.ParseInt(query.Get(ExpiresParam), 10, 64)
+	if err != nil {
+		return auth.Principal{}, fmt.Errorf("%w: %s must be in Unix seconds", auth.ErrInvalidCredentials, ExpiresParam)
+	}
+	expires := time.Unix(seconds, 0)
+	mac, err := hex.DecodeString(query.Get(SignatureParam))
+	if err != nil || !hmac.Equal(mac, a.signer.sign(r.URL.Path, expires)) {
+		return auth.Principal{}, auth.ErrInvalidCredentials
+	}
+	if !time.Now().Before(expires) {
+		return auth.Principal{}, fmt.Errorf("%w: shared link has expired", auth.ErrInvalidCredentials)
+	}
+	return auth.Principal{Name: "shared link " + r.URL.Path, Roles: []string{config.RoleViewer}}, nil
+}
@@ -0,0 +1,169 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"userprofile-api/auth"
+)
+
+// Header is the request header carrying the signature, along with the key,
+// timestamp and nonce it was made with:
+//
+//	X-Signature: keyId=<id>, timestamp=<unix seconds>, nonce=<nonce>, signature=<hex>
+const Header = "X-Signature"
+
+// validNonce limits nonces to something safe to keep and log
+var validNonce = regexp.MustCompile(`^[A-Za-z0-9._-]{8,128}$`)
+
+// Authenticator accepts requests signed with a key of a registry. The
+// signature is the hex-encoded HMAC-SHA256, under the key's secret, of
+//
+//	METHOD \n path?query \n timestamp \n nonce \n hex(SHA-256(body))
+//
+// Requests whose timestamp is more than the window away from the server's
+// clock are refused, and so are those reusing the nonce of a request the
+// server accepted within the window, so a captured request cannot be sent
+// again. Bodies are read to be signed before the caller is known, so only
+// up to a limit.
+type Authenticator struct {
+	keys         *Registry
+	window       time.Duration
+	maxBodyBytes int64
+
+	mu sync.Mutex
+	// nonces holds the nonces of the requests accepted in the window, by key,
+	// with the time they can be forgotten, when their timestamp leaves it
+	nonces map[string]time.Time
+	pruned time.Time
+}
+
+// NewAuthenticator creates an authenticator for the keys of registry,
+// accepting timestamps within window of the server's clock and bodies of up
+// to maxBodyBytes
+func NewAuthenticator(keys *Registry, window time.Duration, maxBodyBytes int) *Authenticator {
+	return &Authenticator{keys: keys, window: window, maxBodyBytes: int64(maxBodyBytes), nonces: map[string]time.Time{}}
+}
+
+// signature holds the fields of the X-Signature header
+type signature struct {
+	keyID     string
+	timestamp time.Time
+	nonce     string
+	mac       []byte
+}
+
+// Authenticate implements auth.Authenticator. The principal is named after
+// the key and has its roles. Bodies over the limit fail with an
+// *http.MaxBytesError.
+func (a *Authenticator) Authenticate(r *http.Request) (auth.Principal, error) {
+	value := r.Header.Get(Header)
+	if value == "" {
+		return auth.Principal{}, auth.ErrNoCredentials
+	}
+	sig, err := parseSignature(value)
+	if err != nil {
+		return auth.Principal{}, fmt.Errorf("%w: %w", auth.ErrInvalidCredentials, err)
+	}
+	key, err := a.keys.Get(sig.keyID)
+	if errors.Is(err, ErrNotFound) {
+		return auth.Principal{}, auth.ErrInvalidCredentials
+	}
+	if err != nil {
+		return auth.Principal{}, err
+	}
+
+	now := time.Now()
+	if sig.timestamp.Before(now.Add(-a.window)) || sig.timestamp.After(now.Add(a.window)) {
+		return auth.Principal{}, &auth.ReplayError{Reason: "timestamp is outside the allowed window"}
+	}
+
+	// The body is read to be signed and put back for the handler
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, a.maxBodyBytes))
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if !hmac.Equal(sig.mac, Sign(key.Secret, r.Method, r.URL.RequestURI(), sig.timestamp, sig.nonce, body)) {
+		return auth.Principal{}, auth.ErrInvalidCredentials
+	}
+
+	// Nonces are only remembered once the signature is verified, so others
+	// cannot use them up
+	if !a.remember(key.ID+" "+sig.nonce, sig.timestamp.Add(a.window), now) {
+		return auth.Principal{}, &auth.ReplayError{Reason: "nonce was already used"}
+	}
+	return auth.Principal{Name: key.Name, Roles: key.Roles}, nil
+}
+
+// remember records a nonce until expires, reporting false if it is already
+// recorded. Nonces whose time has passed are forgotten once per window.
+func (a *Authenticator) remember(nonce string, expires, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if now.Sub(a.pruned) >= a.window {
+		for n, t := range a.nonces {
+			if !t.After(now) {
+				delete(a.nonces, n)
+			}
+		}
+		a.pruned = now
+	}
+	if t, ok := a.nonces[nonce]; ok && t.After(now) {
+		return false
+	}
+	a.nonces[nonce] = expires
+	return true
+}
+
+// Sign returns the signature of a request, for the X-Signature header.
+// requestURI is the path and query of the request as it is sent.
+func Sign(secret, method, requestURI string, timestamp time.Time, nonce string, body []byte) []byte {
+	digest := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%s\n%s", method, requestURI, timestamp.Unix(), nonce, hex.EncodeToString(digest[:]))
+	return mac.Sum(nil)
+}
+
+// parseSignature parses the comma-separated key=value fields of the
+// X-Signature header, whose values may be quoted
+func parseSignature(value string) (signature, error) {
+	var sig signature
+	fields := map[string]string{}
+	for _, field := range strings.Split(value, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(field), "=")
+		if !found {
+			return sig, fmt.Errorf("malformed %s field %q", Header, field)
+		}
+		fields[name] = strings.Trim(value, `"`)
+	}
+
+	sig.keyID, sig.nonce = fields["keyId"], fields["nonce"]
+	if sig.keyID == "" {
+		return sig, errors.New("keyId is missing")
+	}
+	if !validNonce.MatchString(sig.nonce) {
+		return sig, errors.New("nonce must be 8 to 128 letters, digits, dots, underscores and hyphens")
+	}
+	seconds, err := strconv.ParseInt(fields["timestamp"], 10, 64)
+	if err != nil {
+		return sig, errors.New("timestamp must be in Unix seconds")
+	}
+	sig.timestamp = time.Unix(seconds, 0)
+	if sig.mac, err = hex.DecodeString(fields["signature"]); err != nil || len(sig.mac) != sha256.Size {
+		return sig, errors.New("signature must be a hex-encoded HMAC-SHA256")
+	}
+	return sig, nil
+}
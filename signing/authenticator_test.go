@@ -0,0 +1,50 @@
+package signing
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"userprofile-api/auth"
+)
+
+// TestAuthenticateLimitsBody checks that bodies are only read up to the limit
+// before the signature is verified
+func TestAuthenticateLimitsBody(t *testing.T) {
+	keys, err := OpenRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keys.Create("partner", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := NewAuthenticator(keys, time.Minute, 16)
+
+	signed := func(body, nonce string) *http.Request {
+		now := time.Now()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/users", strings.NewReader(body))
+		mac := Sign(key.Secret, req.Method, req.URL.RequestURI(), now, nonce, []byte(body))
+		req.Header.Set(Header, fmt.Sprintf("keyId=%s, timestamp=%d, nonce=%s, signature=%s",
+			key.ID, now.Unix(), nonce, hex.EncodeToString(mac)))
+		return req
+	}
+
+	if _, err := authenticator.Authenticate(signed(`{"fullName":"A"}`, "nonce-0001")); err != nil {
+		t.Fatalf("body within the limit: %v", err)
+	}
+
+	_, err = authenticator.Authenticate(signed(strings.Repeat("x", 17), "nonce-0002"))
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != 16 {
+		t.Fatalf("body over the limit: got %v, want *http.MaxBytesError with limit 16", err)
+	}
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Error("body over the limit reported as invalid credentials")
+	}
+}
@@ -0,0 +1,223 @@
+// Package signing authenticates the requests partners sign with HMAC keys,
+// rejecting those that may be replays, and holds the keys, which are managed
+// through the admin API.
+package signing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"userprofile-api/config"
+)
+
+var (
+	// ErrNotFound is returned when no signing key has the requested ID
+	ErrNotFound = errors.New("signing key not found")
+	// ErrInvalid is wrapped by the errors of Validate
+	ErrInvalid = errors.New("invalid signing key")
+)
+
+// Key is a secret a partner signs its requests with
+type Key struct {
+	XMLName xml.Name `json:"-" yaml:"-" xml:"signingKey"`
+	// ID is sent with every signed request to name the key
+	ID string `json:"id" xml:"id" yaml:"id"`
+	// Name identifies the partner as the caller of its requests, such as in
+	// the audit log
+	Name  string   `json:"name" xml:"name" yaml:"name"`
+	Roles []string `json:"roles" xml:"roles>role" yaml:"roles"`
+	// Secret signs the requests. It is only returned when the key is created
+	// or rotated.
+	Secret    string     `json:"secret,omitempty" xml:"secret,omitempty" yaml:"secret,omitempty"`
+	CreatedAt time.Time  `json:"createdAt" xml:"createdAt" yaml:"createdAt"`
+	RotatedAt *time.Time `json:"rotatedAt,omitempty" xml:"rotatedAt,omitempty" yaml:"rotatedAt,omitempty"`
+}
+
+// Validate checks the name and roles of a key being created
+func (k Key) Validate() error {
+	if k.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	for _, role := range k.Roles {
+		if !slices.Contains(config.Roles, role) {
+			return fmt.Errorf("%w: unknown role %q", ErrInvalid, role)
+		}
+	}
+	return nil
+}
+
+// Registry holds the signing keys in memory and, when it has a file, saves
+// them to it after every change, so they survive restarts
+type Registry struct {
+	path string
+
+	mu   sync.RWMutex
+	keys []Key
+}
+
+// OpenRegistry loads the keys saved in the JSON file at path, starting empty
+// if it does not exist yet. With an empty path the keys are only kept in
+// memory.
+func OpenRegistry(path string) (*Registry, error) {
+	r := &Registry{path: path}
+	if path == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &r.keys); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", path, err)
+		}
+	}
+	return r, nil
+}
+
+// List returns every key, without its secret, in creation order
+func (r *Registry) List() []Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]Key, len(r.keys))
+	for i, key := range r.keys {
+		key.Secret = ""
+		keys[i] = key
+	}
+	return keys
+}
+
+// Get returns the key with the given ID, secret included
+func (r *Registry) Get(id string) (Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.index(id)
+	if i < 0 {
+		return Key{}, ErrNotFound
+	}
+	return r.keys[i], nil
+}
+
+// Create adds a key with a generated ID and secret. Keys without roles get
+// the viewer role.
+func (r *Registry) Create(name string, roles []string) (Key, error) {
+	if len(roles) == 0 {
+		roles = []string{config.RoleViewer}
+	}
+	key := Key{ID: uuid.NewString(), Name: name, Roles: roles, Secret: newSecret(), CreatedAt: time.Now().UTC()}
+	if err := key.Validate(); err != nil {
+		return Key{}, err
+	}
+	return r.change(func() (Key, error) {
+		r.keys = append(r.keys, key)
+		return key, nil
+	})
+}
+
+// Rotate replaces the secret of the key with the given ID, so requests signed
+// with the old one are refused from then on
+func (r *Registry) Rotate(id string) (Key, error) {
+	return r.change(func() (Key, error) {
+		i := r.index(id)
+		if i < 0 {
+			return Key{}, ErrNotFound
+		}
+		now := time.Now().UTC()
+		r.keys[i].Secret, r.keys[i].RotatedAt = newSecret(), &now
+		return r.keys[i], nil
+	})
+}
+
+// Delete revokes the key with the given ID
+func (r *Registry) Delete(id string) error {
+	_, err := r.change(func() (Key, error) {
+		i := r.index(id)
+		if i < 0 {
+			return Key{}, ErrNotFound
+		}
+		r.keys = slices.Delete(r.keys, i, i+1)
+		return Key{}, nil
+	})
+	return err
+}
+
+// index returns the position of the key with the given ID, or -1. The caller
+// must hold mu.
+func (r *Registry) index(id string) int {
+	return slices.IndexFunc(r.keys, func(k Key) bool { return k.ID == id })
+}
+
+// change applies a change to the keys under the write lock and saves them.
+// If the file cannot be written the change is rolled back.
+func (r *Registry) change(apply func() (Key, error)) (Key, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before := slices.Clone(r.keys)
+	key, err := apply()
+	if err != nil {
+		r.keys = before
+		return Key{}, err
+	}
+	if err := r.save(); err != nil {
+		r.keys = before
+		return Key{}, fmt.Errorf("save %s: %w", r.path, err)
+	}
+	return key, nil
+}
+
+// save writes the keys to a temporary file next to the registry's file and
+// renames it into place, so a crash never leaves a partial file. The file is
+// only readable by its owner, as it holds the secrets.
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	keys := r.keys
+	if keys == nil {
+		keys = []Key{}
+	}
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), "."+filepath.Base(r.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
+
+// newSecret returns a random 256-bit secret, hex-encoded
+func newSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
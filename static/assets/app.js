@@ -0,0 +1,78 @@
+// apiFetch calls the JSON API, sending the page's CSRF token so that
+// state-changing requests are accepted
+function apiFetch(url, options = {}) {
+    const meta = document.querySelector('meta[name="csrf-token"]');
+    const headers = new Headers(options.headers);
+    headers.set("Accept", "application/json");
+    if (meta) {
+        headers.set("X-CSRF-Token", meta.content);
+    }
+    return fetch(url, { ...options, headers });
+}
+
+// Filters the rows of each table with a data-filter attribute as the user
+// types into the input whose ID it names.
+document.addEventListener("DOMContentLoaded", () => {
+    document.querySelectorAll("table[data-filter]").forEach((table) => {
+        const input = document.getElementById(table.dataset.filter);
+        if (!input) {
+            return;
+        }
+        input.addEventListener("input", () => {
+            const query = input.value.trim().toLowerCase();
+            table.querySelectorAll("tbody tr").forEach((row) => {
+                row.hidden = query !== "" && !row.textContent.toLowerCase().includes(query);
+            });
+        });
+    });
+});
+
+// Turns each button with a data-emoji-picker attribute into a picker filling
+// the input whose ID it names, with the emoji listed by the JSON API. The
+// button stays hidden when they cannot be loaded.
+document.addEventListener("DOMContentLoaded", () => {
+    document.querySelectorAll("button[data-emoji-picker]").forEach(async (button) => {
+        const input = document.getElementById(button.dataset.emojiPicker);
+        if (!input) {
+            return;
+        }
+        let emojis;
+        try {
+            const response = await apiFetch("/api/v1/emojis");
+            if (!response.ok) {
+                return;
+            }
+            emojis = await response.json();
+        } catch {
+            return;
+        }
+
+        const picker = document.createElement("div");
+        picker.className = "emoji-picker";
+        picker.hidden = true;
+        emojis.forEach(({ shortcode, emoji }) => {
+            const choice = document.createElement("button");
+            choice.type = "button";
+            choice.textContent = emoji;
+            choice.title = shortcode;
+            choice.addEventListener("click", () => {
+                input.value = emoji;
+                picker.hidden = true;
+            });
+            picker.appendChild(choice);
+        });
+        button.closest("label").after(picker);
+        button.addEventListener("click", () => {
+            picker.hidden = !picker.hidden;
+        });
+        button.hidden = false;
+    });
+});
+
+// Asks for confirmation before submitting forms with a data-confirm attribute
+document.addEventListener("submit", (event) => {
+    const message = event.target.dataset.confirm;
+    if (message && !window.confirm(message)) {
+        event.preventDefault();
+    }
+});
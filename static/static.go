@@ -0,0 +1,100 @@
+// Package static serves the CSS and JavaScript of the HTML pages, embedded in
+// the binary. Pages link to assets by fingerprinted paths, such as
+// /static/app.3f2a9c1b.css, which change with their content and so can be
+// cached for good.
+package static
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+)
+
+// Prefix is the path the assets are served under
+const Prefix = "/static/"
+
+//go:embed assets
+var files embed.FS
+
+// asset is an embedded file with the fingerprint of its content
+type asset struct {
+	name        string
+	data        []byte
+	fingerprint string
+}
+
+var (
+	// byName holds the assets by their file name, e.g. app.css
+	byName = make(map[string]*asset)
+	// byPath holds them by their fingerprinted name, e.g. app.3f2a9c1b.css
+	byPath = make(map[string]*asset)
+)
+
+func init() {
+	entries, err := fs.ReadDir(files, "assets")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		data, err := files.ReadFile("assets/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		sum := sha256.Sum256(data)
+		a := &asset{name: entry.Name(), data: data, fingerprint: hex.EncodeToString(sum[:4])}
+		byName[a.name] = a
+		byPath[fingerprinted(a.name, a.fingerprint)] = a
+	}
+}
+
+// fingerprinted inserts the fingerprint before the extension of name
+func fingerprinted(name, fingerprint string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + fingerprint + ext
+}
+
+// Path returns the fingerprinted path of the named asset, for use in
+// templates as {{ asset "app.css" }}. Unknown names are returned
+// unfingerprinted, so a typo shows up as a 404 in the browser.
+func Path(name string) string {
+	a, ok := byName[name]
+	if !ok {
+		return Prefix + name
+	}
+	return Prefix + fingerprinted(a.name, a.fingerprint)
+}
+
+// Handler serves the assets from a /static/*filepath route. Fingerprinted
+// paths are cached by browsers and proxies for a year; plain names, which
+// change meaning with each release, must be revalidated on every use.
+func Handler(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("filepath"), "/")
+	cacheControl := "public, max-age=31536000, immutable"
+	a, ok := byPath[name]
+	if !ok {
+		if a, ok = byName[name]; !ok {
+			apierror.NoRoute(c)
+			return
+		}
+		cacheControl = "no-cache"
+	}
+
+	c.Header("Cache-Control", cacheControl)
+	c.Header("ETag", `"`+a.fingerprint+`"`)
+	if contentType := mime.TypeByExtension(path.Ext(a.name)); contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+	// ServeContent answers If-None-Match with 304 and handles HEAD and
+	// range requests
+	http.ServeContent(c.Writer, c.Request, a.name, time.Time{}, bytes.NewReader(a.data))
+}
@@ -0,0 +1,259 @@
+package tenant
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"userprofile-api/models"
+)
+
+var (
+	// ErrNotFound is returned when no tenant has the requested ID
+	ErrNotFound = errors.New("tenant not found")
+	// ErrConflict is returned when creating a tenant whose ID is taken
+	ErrConflict = errors.New("tenant already exists")
+	// ErrInvalid is wrapped by the errors of Validate
+	ErrInvalid = errors.New("invalid tenant")
+)
+
+// Tenant is an organisation whose users are kept apart from every other's
+type Tenant struct {
+	XMLName xml.Name `json:"-" yaml:"-" xml:"tenant"`
+	ID      string   `json:"id" xml:"id" yaml:"id"`
+	Name    string   `json:"name" xml:"name" yaml:"name"`
+	// MaxUsers limits the number of active users; zero means no limit
+	MaxUsers int `json:"maxUsers" xml:"maxUsers" yaml:"maxUsers"`
+	// MetadataSchema is the JSON Schema the metadata of the tenant's users
+	// must match instead of the default one, if it has one
+	MetadataSchema models.Metadata `json:"metadataSchema,omitempty" xml:"metadataSchema,omitempty" yaml:"metadataSchema,omitempty"`
+	// Active is false once the tenant is deactivated. Its users are kept,
+	// but requests naming it are refused until it is activated again.
+	Active        bool       `json:"active" xml:"active" yaml:"active"`
+	CreatedAt     time.Time  `json:"createdAt" xml:"createdAt" yaml:"createdAt"`
+	DeactivatedAt *time.Time `json:"deactivatedAt,omitempty" xml:"deactivatedAt,omitempty" yaml:"deactivatedAt,omitempty"`
+}
+
+// Validate checks the ID, name and quota of a tenant being saved
+func (t Tenant) Validate() error {
+	if !Valid(t.ID) {
+		return fmt.Errorf("%w: id must be up to 40 lower-case letters, digits and hyphens, starting with a letter or digit", ErrInvalid)
+	}
+	if t.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	if t.MaxUsers < 0 {
+		return fmt.Errorf("%w: maxUsers must not be negative", ErrInvalid)
+	}
+	return nil
+}
+
+// Registry holds the tenants in memory and, when it has a file, saves them to
+// it after every change, so they survive restarts along with their storage
+type Registry struct {
+	path string
+
+	mu      sync.RWMutex
+	tenants []Tenant
+}
+
+// OpenRegistry loads the tenants saved in the JSON file at path, starting
+// empty if it does not exist yet. With an empty path the tenants are only
+// kept in memory.
+func OpenRegistry(path string) (*Registry, error) {
+	r := &Registry{path: path}
+	if path == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &r.tenants); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", path, err)
+		}
+	}
+	return r, nil
+}
+
+// List returns every tenant, deactivated ones included, in creation order
+func (r *Registry) List() []Tenant {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.tenants)
+}
+
+// Get returns the tenant with the given ID
+func (r *Registry) Get(id string) (Tenant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.index(id)
+	if i < 0 {
+		return Tenant{}, ErrNotFound
+	}
+	return r.tenants[i], nil
+}
+
+// Create adds an active tenant, returning ErrConflict if the ID is taken
+func (r *Registry) Create(t Tenant) (Tenant, error) {
+	if err := t.Validate(); err != nil {
+		return Tenant{}, err
+	}
+	t.Active = true
+	t.CreatedAt = time.Now().UTC()
+	t.DeactivatedAt = nil
+
+	return r.change(func() (Tenant, error) {
+		if r.index(t.ID) >= 0 {
+			return Tenant{}, ErrConflict
+		}
+		r.tenants = append(r.tenants, t)
+		return t, nil
+	})
+}
+
+// Update replaces the name and quota of the tenant with the given ID
+func (r *Registry) Update(id string, name string, maxUsers int) (Tenant, error) {
+	return r.change(func() (Tenant, error) {
+		i := r.index(id)
+		if i < 0 {
+			return Tenant{}, ErrNotFound
+		}
+		t := r.tenants[i]
+		t.Name, t.MaxUsers = name, maxUsers
+		if err := t.Validate(); err != nil {
+			return Tenant{}, err
+		}
+		r.tenants[i] = t
+		return t, nil
+	})
+}
+
+// SetMaxUsers replaces the user quota of the tenant with the given ID
+func (r *Registry) SetMaxUsers(id string, maxUsers int) (Tenant, error) {
+	return r.change(func() (Tenant, error) {
+		i := r.index(id)
+		if i < 0 {
+			return Tenant{}, ErrNotFound
+		}
+		t := r.tenants[i]
+		t.MaxUsers = maxUsers
+		if err := t.Validate(); err != nil {
+			return Tenant{}, err
+		}
+		r.tenants[i] = t
+		return t, nil
+	})
+}
+
+// SetMetadataSchema replaces the metadata schema of the tenant with the given
+// ID; nil removes it. The schema is expected to have been checked already.
+func (r *Registry) SetMetadataSchema(id string, schema models.Metadata) (Tenant, error) {
+	return r.change(func() (Tenant, error) {
+		i := r.index(id)
+		if i < 0 {
+			return Tenant{}, ErrNotFound
+		}
+		r.tenants[i].MetadataSchema = schema
+		return r.tenants[i], nil
+	})
+}
+
+// Deactivate refuses further requests naming the tenant, keeping its users.
+// Deactivating an inactive tenant leaves it unchanged.
+func (r *Registry) Deactivate(id string) (Tenant, error) {
+	return r.change(func() (Tenant, error) {
+		i := r.index(id)
+		if i < 0 {
+			return Tenant{}, ErrNotFound
+		}
+		if r.tenants[i].Active {
+			now := time.Now().UTC()
+			r.tenants[i].Active = false
+			r.tenants[i].DeactivatedAt = &now
+		}
+		return r.tenants[i], nil
+	})
+}
+
+// Activate serves a deactivated tenant again
+func (r *Registry) Activate(id string) (Tenant, error) {
+	return r.change(func() (Tenant, error) {
+		i := r.index(id)
+		if i < 0 {
+			return Tenant{}, ErrNotFound
+		}
+		r.tenants[i].Active = true
+		r.tenants[i].DeactivatedAt = nil
+		return r.tenants[i], nil
+	})
+}
+
+// index returns the position of the tenant with the given ID, or -1. The
+// caller must hold mu.
+func (r *Registry) index(id string) int {
+	return slices.IndexFunc(r.tenants, func(t Tenant) bool { return t.ID == id })
+}
+
+// change applies a change to the tenants under the write lock and saves
+// them. If the file cannot be written the change is rolled back.
+func (r *Registry) change(apply func() (Tenant, error)) (Tenant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before := slices.Clone(r.tenants)
+	t, err := apply()
+	if err != nil {
+		r.tenants = before
+		return Tenant{}, err
+	}
+	if err := r.save(); err != nil {
+		r.tenants = before
+		return Tenant{}, fmt.Errorf("save %s: %w", r.path, err)
+	}
+	return t, nil
+}
+
+// save writes the tenants to a temporary file next to the registry's file
+// and renames it into place, so a crash never leaves a partial file
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	tenants := r.tenants
+	if tenants == nil {
+		tenants = []Tenant{}
+	}
+	data, err := json.MarshalIndent(tenants, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), "."+filepath.Base(r.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
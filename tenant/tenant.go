@@ -0,0 +1,208 @@
+// Package tenant scopes user requests to a registered tenant, named by the
+// X-Tenant-ID header or the :tenant path parameter, whose users are stored
+// apart from every other tenant's.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/apierror"
+	"userprofile-api/auth"
+	"userprofile-api/config"
+	"userprofile-api/repository"
+)
+
+// Header names the tenant of a request
+const Header = "X-Tenant-ID"
+
+// Param is the path parameter naming the tenant in /tenants/:tenant routes
+const Param = "tenant"
+
+// Context keys holding the request's tenant and its repository
+const (
+	tenantKey = "tenant"
+	repoKey   = "tenantRepository"
+)
+
+// idContextKey is the context key holding the ID of the request's tenant
+type idContextKey struct{}
+
+// idPattern keeps tenant IDs safe to use in file and schema names
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,39}$`)
+
+// Valid reports whether id is a well-formed tenant ID: up to 40 lower-case
+// letters, digits and hyphens, starting with a letter or digit
+func Valid(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// Repositories opens the repository of each tenant on first use and keeps it
+// open until Close
+type Repositories struct {
+	open     func(tenant string) (repository.UserRepository, error)
+	decorate func(tenant string, repo repository.UserRepository) repository.UserRepository
+
+	mu     sync.Mutex
+	opened map[string]repository.UserRepository
+	repos  map[string]repository.UserRepository
+}
+
+// NewRepositories creates the set of tenant repositories, opened with open.
+// Each is wrapped with decorate once it is open, e.g. to publish change
+// events.
+func NewRepositories(open func(tenant string) (repository.UserRepository, error),
+	decorate func(tenant string, repo repository.UserRepository) repository.UserRepository) *Repositories {
+	return &Repositories{
+		open:     open,
+		decorate: decorate,
+		opened:   make(map[string]repository.UserRepository),
+		repos:    make(map[string]repository.UserRepository),
+	}
+}
+
+// Get returns the repository of a tenant, opening it if needed
+func (r *Repositories) Get(tenant string) (repository.UserRepository, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if repo, ok := r.repos[tenant]; ok {
+		return repo, nil
+	}
+	opened, err := r.open(tenant)
+	if err != nil {
+		return nil, fmt.Errorf("open storage of tenant %s: %w", tenant, err)
+	}
+	repo := r.decorate(tenant, opened)
+	r.opened[tenant] = opened
+	r.repos[tenant] = repo
+	return repo, nil
+}
+
+// Close releases the tenant repositories that hold resources, such as
+// connection pools
+func (r *Repositories) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	for tenant, repo := range r.opened {
+		if closer, ok := repo.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close storage of tenant %s: %w", tenant, err))
+			}
+		}
+		delete(r.opened, tenant)
+		delete(r.repos, tenant)
+	}
+	return errors.Join(errs...)
+}
+
+// Middleware resolves the tenant of a request from the :tenant path
+// parameter or the X-Tenant-ID header and records it, along with its
+// repository, for the handlers. The tenant must be registered and active,
+// and callers bound to a tenant, such as users with password accounts, are
+// refused any other. Requests naming no tenant are served from the default
+// storage, unless the mode requires one.
+func Middleware(cfg config.TenancyConfig, registry *Registry, repos *Repositories) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, header := c.Param(Param), c.GetHeader(Header)
+		switch {
+		case id == "":
+			id = header
+		case header != "" && header != id:
+			apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidTenant,
+				"The "+Header+" header names a different tenant than the path", gin.H{"path": id, "header": header})
+			return
+		}
+		// Checked before the tenant is looked up, so bound callers cannot
+		// learn which tenants exist
+		if principal, ok := auth.PrincipalFrom(c); ok && !principal.AllowsTenant(id) {
+			apierror.Abort(c, http.StatusForbidden, apierror.CodeForbidden,
+				"Credentials do not grant access to this tenant", gin.H{"tenant": id})
+			return
+		}
+
+		if id == "" {
+			if cfg.Mode == config.TenancyRequired {
+				apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidTenant,
+					"The "+Header+" header is required", gin.H{"header": Header})
+				return
+			}
+			c.Next()
+			return
+		}
+		if !Valid(id) {
+			apierror.Abort(c, http.StatusBadRequest, apierror.CodeInvalidTenant,
+				"Tenant IDs are up to 40 lower-case letters, digits and hyphens", gin.H{"tenant": id})
+			return
+		}
+
+		t, err := registry.Get(id)
+		if err != nil {
+			apierror.Abort(c, http.StatusNotFound, apierror.CodeTenantNotFound, "Tenant not found", gin.H{"tenant": id})
+			return
+		}
+		if !t.Active {
+			apierror.Abort(c, http.StatusForbidden, apierror.CodeTenantInactive, "Tenant is deactivated", gin.H{"tenant": id})
+			return
+		}
+
+		repo, err := repos.Get(id)
+		if err != nil {
+			apierror.Internal(c, err)
+			c.Abort()
+			return
+		}
+		c.Set(tenantKey, t)
+		c.Set(repoKey, repo)
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), t.ID))
+		c.Next()
+	}
+}
+
+// From returns the tenant of the request, if it names one
+func From(c *gin.Context) (Tenant, bool) {
+	value, ok := c.Get(tenantKey)
+	if !ok {
+		return Tenant{}, false
+	}
+	t, ok := value.(Tenant)
+	return t, ok
+}
+
+// ID returns the tenant of the request, or "" for the default storage
+func ID(c *gin.Context) string {
+	t, _ := From(c)
+	return t.ID
+}
+
+// NewContext returns a copy of ctx carrying the ID of a tenant, for code that
+// is only passed the context
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idContextKey{}, id)
+}
+
+// FromContext returns the ID of the tenant ctx carries, or "" for the default
+// storage
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(idContextKey{}).(string)
+	return id
+}
+
+// Repository returns the repository of the request's tenant, or fallback
+// when the request names none
+func Repository(c *gin.Context, fallback repository.UserRepository) repository.UserRepository {
+	if repo, ok := c.Get(repoKey); ok {
+		if r, ok := repo.(repository.UserRepository); ok {
+			return r
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,92 @@
+package tenant_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"userprofile-api/auth"
+	"userprofile-api/config"
+	"userprofile-api/repository"
+	"userprofile-api/tenant"
+)
+
+// TestMiddlewareRefusesOtherTenants checks that the tokens of password
+// accounts only reach the tenant they were issued for, while credentials not
+// bound to a tenant reach any
+func TestMiddlewareRefusesOtherTenants(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registry, err := tenant.OpenRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"acme", "globex"} {
+		if _, err := registry.Create(tenant.Tenant{ID: id, Name: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repos := tenant.NewRepositories(
+		func(string) (repository.UserRepository, error) { return repository.NewInMemoryUserRepository(nil), nil },
+		func(_ string, repo repository.UserRepository) repository.UserRepository { return repo })
+
+	cfg := config.AuthConfig{
+		JWT:     config.JWTConfig{Secret: "test-secret-test-secret-test-secret"},
+		APIKeys: []config.APIKey{{Name: "ops", Key: "ops-key", Scopes: []string{"read"}}},
+	}
+	guard := auth.NewGuard(cfg)
+	scope := tenant.Middleware(config.TenancyConfig{Mode: config.TenancyOptional}, registry, repos)
+	router := gin.New()
+	ok := func(c *gin.Context) { c.String(http.StatusOK, tenant.ID(c)) }
+	router.GET("/users", guard.Authenticate(), scope, ok)
+	router.GET("/tenants/:"+tenant.Param+"/users", guard.Authenticate(), scope, ok)
+
+	tokens := auth.NewJWTAuthenticator(cfg.JWT)
+	acmeToken, _, err := tokens.Issue("user-1", "acme", "session-1", []string{config.RoleAdmin}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultToken, _, err := tokens.Issue("user-2", "", "session-2", []string{config.RoleAdmin}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		want   int
+	}{
+		{"own tenant by path", "/tenants/acme/users", bearer(acmeToken), http.StatusOK},
+		{"own tenant by header", "/users", with(bearer(acmeToken), tenant.Header, "acme"), http.StatusOK},
+		{"other tenant by path", "/tenants/globex/users", bearer(acmeToken), http.StatusForbidden},
+		{"other tenant by header", "/users", with(bearer(acmeToken), tenant.Header, "globex"), http.StatusForbidden},
+		{"unregistered tenant", "/tenants/initech/users", bearer(acmeToken), http.StatusForbidden},
+		{"default storage", "/users", bearer(acmeToken), http.StatusForbidden},
+		{"default user in default storage", "/users", bearer(defaultToken), http.StatusOK},
+		{"default user in a tenant", "/tenants/acme/users", bearer(defaultToken), http.StatusForbidden},
+		{"unbound API key in a tenant", "/tenants/globex/users", with(http.Header{}, auth.APIKeyHeader, "ops-key"), http.StatusOK},
+		{"unbound API key in default storage", "/users", with(http.Header{}, auth.APIKeyHeader, "ops-key"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header = tt.header
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("GET %s: status %d, want %d: %s", tt.path, rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func with(header http.Header, name, value string) http.Header {
+	header.Set(name, value)
+	return header
+}
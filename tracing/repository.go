@@ -0,0 +1,158 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"userprofile-api/models"
+	"userprofile-api/repository"
+)
+
+// tracedRepository records each repository call as a child span of the
+// context it is made with
+type tracedRepository struct {
+	next repository.UserRepository
+}
+
+// Repository wraps a repository so its calls produce spans under the
+// contexts they are made with
+func Repository(next repository.UserRepository) repository.UserRepository {
+	return &tracedRepository{next: next}
+}
+
+// start begins the span of a call, returning the context the wrapped
+// repository is called with so that its own spans nest under it
+func (r *tracedRepository) start(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "UserRepository."+operation,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// end finishes the span. Not-found, conflict, version mismatch and read-only
+// errors are expected outcomes and are recorded as attributes rather than
+// failing the span.
+func end(span trace.Span, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, repository.ErrNotFound), errors.Is(err, repository.ErrConflict),
+		errors.Is(err, repository.ErrVersionMismatch), errors.Is(err, repository.ErrReadOnly):
+		span.SetAttributes(attribute.String("repository.outcome", err.Error()))
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (r *tracedRepository) List(ctx context.Context, opts repository.ListOptions) (users []models.UserProfile, total int, err error) {
+	ctx, span := r.start(ctx, "List", attribute.Int("list.offset", opts.Offset), attribute.Int("list.limit", opts.Limit))
+	defer func() {
+		span.SetAttributes(attribute.Int("list.total", total))
+		end(span, err)
+	}()
+	return r.next.List(ctx, opts)
+}
+
+func (r *tracedRepository) Stream(ctx context.Context, opts repository.ListOptions, yield func(user models.UserProfile) error) (err error) {
+	ctx, span := r.start(ctx, "Stream", attribute.Int("list.offset", opts.Offset), attribute.Int("list.limit", opts.Limit))
+	streamed := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("list.streamed", streamed))
+		end(span, err)
+	}()
+	return repository.Stream(ctx, r.next, opts, func(user models.UserProfile) error {
+		streamed++
+		return yield(user)
+	})
+}
+
+func (r *tracedRepository) Get(ctx context.Context, id string) (user models.UserProfile, err error) {
+	ctx, span := r.start(ctx, "Get", attribute.String("user.id", id))
+	defer func() { end(span, err) }()
+	return r.next.Get(ctx, id)
+}
+
+func (r *tracedRepository) GetByEmail(ctx context.Context, email string) (user models.UserProfile, err error) {
+	ctx, span := r.start(ctx, "GetByEmail")
+	defer func() { end(span, err) }()
+	return r.next.GetByEmail(ctx, email)
+}
+
+func (r *tracedRepository) Create(ctx context.Context, user models.UserProfile) (created models.UserProfile, err error) {
+	ctx, span := r.start(ctx, "Create", attribute.String("user.id", user.ID))
+	defer func() { end(span, err) }()
+	return r.next.Create(ctx, user)
+}
+
+func (r *tracedRepository) Update(ctx context.Context, id string, user models.UserProfile) (updated models.UserProfile, err error) {
+	ctx, span := r.start(ctx, "Update", attribute.String("user.id", id))
+	defer func() { end(span, err) }()
+	return r.next.Update(ctx, id, user)
+}
+
+func (r *tracedRepository) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := r.start(ctx, "Delete", attribute.String("user.id", id))
+	defer func() { end(span, err) }()
+	return r.next.Delete(ctx, id)
+}
+
+func (r *tracedRepository) SetAvatarURL(ctx context.Context, id string, avatarURL string) (updated models.UserProfile, err error) {
+	ctx, span := r.start(ctx, "SetAvatarURL", attribute.String("user.id", id))
+	defer func() { end(span, err) }()
+	return r.next.SetAvatarURL(ctx, id, avatarURL)
+}
+
+func (r *tracedRepository) Restore(ctx context.Context, id string) (restored models.UserProfile, err error) {
+	ctx, span := r.start(ctx, "Restore", attribute.String("user.id", id))
+	defer func() { end(span, err) }()
+	return r.next.Restore(ctx, id)
+}
+
+func (r *tracedRepository) Stats(ctx context.Context) (stats repository.UserStats, err error) {
+	ctx, span := r.start(ctx, "Stats")
+	defer func() {
+		span.SetAttributes(attribute.Int("stats.total", stats.Total))
+		end(span, err)
+	}()
+	return r.next.Stats(ctx)
+}
+
+func (r *tracedRepository) Search(ctx context.Context, opts repository.SearchOptions) (results []repository.SearchResult, err error) {
+	ctx, span := r.start(ctx, "Search", attribute.String("search.query", opts.Query), attribute.Int("search.fuzziness", opts.Fuzziness))
+	defer func() {
+		span.SetAttributes(attribute.Int("search.results", len(results)))
+		end(span, err)
+	}()
+	return r.next.Search(ctx, opts)
+}
+
+func (r *tracedRepository) Transaction(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	ctx, span := r.start(ctx, "Transaction")
+	defer func() { end(span, err) }()
+	return repository.Transaction(ctx, r.next, fn)
+}
+
+func (r *tracedRepository) RecordAudit(ctx context.Context, record repository.AuditRecord) (err error) {
+	ctx, span := r.start(ctx, "RecordAudit", attribute.String("user.id", record.UserID), attribute.String("audit.action", record.Action))
+	defer func() { end(span, err) }()
+	return repository.RecordAudit(ctx, r.next, record)
+}
+
+func (r *tracedRepository) MoveAudit(ctx context.Context, fromID, toID string) (err error) {
+	ctx, span := r.start(ctx, "MoveAudit", attribute.String("user.id", toID), attribute.String("audit.from", fromID))
+	defer func() { end(span, err) }()
+	return repository.MoveAudit(ctx, r.next, fromID, toID)
+}
+
+func (r *tracedRepository) Trail(ctx context.Context, userID string) (records []repository.AuditRecord, err error) {
+	ctx, span := r.start(ctx, "Trail", attribute.String("user.id", userID))
+	defer func() {
+		span.SetAttributes(attribute.Int("audit.records", len(records)))
+		end(span, err)
+	}()
+	return repository.Trail(ctx, r.next, userID)
+}
@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"userprofile-api/config"
+)
+
+// ServiceName is the default service.name resource attribute, overridable
+// with OTEL_SERVICE_NAME
+const ServiceName = "userprofile-api"
+
+// Setup installs the global tracer provider and W3C trace context
+// propagation. When tracing is disabled the global no-op provider is kept,
+// so instrumented code pays almost nothing. The returned function flushes
+// and stops the exporter.
+func Setup(ctx context.Context, cfg config.TracingConfig) (shutdown func(context.Context) error, err error) {
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer for application spans
+func Tracer() trace.Tracer {
+	return otel.Tracer(ServiceName)
+}
@@ -0,0 +1,6 @@
+// Package userspb holds the protobuf messages and gRPC stubs generated from
+// users.proto. Regenerate them with go generate after editing the .proto
+// file; protoc, protoc-gen-go and protoc-gen-go-grpc must be installed.
+package userspb
+
+//go:generate protoc -I .. --go_out=.. --go_opt=paths=source_relative --go-grpc_out=.. --go-grpc_opt=paths=source_relative userspb/users.proto
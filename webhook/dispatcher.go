@@ -0,0 +1,142 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"userprofile-api/config"
+	"userprofile-api/events"
+	"userprofile-api/jobs"
+	"userprofile-api/models"
+)
+
+// Delivery headers sent with every webhook request
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// JobKind is the kind of the jobs delivering an event to an endpoint. Their
+// payload holds the endpoint's ID and URL and the event.
+const JobKind = "webhook.delivery"
+
+// Dispatcher delivers events to the registry's endpoints as background jobs,
+// which are retried with exponential backoff when they fail
+type Dispatcher struct {
+	registry *Registry
+	client   *http.Client
+	runner   *jobs.Runner
+	logger   *slog.Logger
+}
+
+// NewDispatcher registers the delivery jobs with runner
+func NewDispatcher(cfg config.WebhookConfig, registry *Registry, runner *jobs.Runner, logger *slog.Logger) *Dispatcher {
+	d := &Dispatcher{
+		registry: registry,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		runner:   runner,
+		logger:   logger,
+	}
+	runner.Register(JobKind, cfg.MaxAttempts, d.deliver)
+	return d
+}
+
+// FromConfig creates a registry holding the endpoints configured through
+// WEBHOOK_URLS, subscribed to every event
+func FromConfig(cfg config.WebhookConfig) *Registry {
+	registry := NewRegistry()
+	for _, url := range cfg.URLs {
+		registry.Add(Endpoint{URL: url, Secret: cfg.Secret})
+	}
+	return registry
+}
+
+// Handle enqueues a delivery job for every subscribed endpoint. It is an
+// events.Handler; deliveries that cannot be enqueued are logged and dropped.
+func (d *Dispatcher) Handle(e events.Event) {
+	body, err := json.Marshal(e)
+	var event models.Metadata
+	if err == nil {
+		err = json.Unmarshal(body, &event)
+	}
+	if err != nil {
+		d.logger.Error("webhook payload encoding failed", "event", e.Type, "error", err)
+		return
+	}
+	for _, endpoint := range d.registry.Subscribers(e.Type) {
+		payload := models.Metadata{"endpoint": endpoint.ID, "url": endpoint.URL, "event": event}
+		if _, err := d.runner.Enqueue(context.Background(), JobKind, payload); err != nil {
+			d.logger.Error("webhook delivery could not be enqueued; dropping it",
+				"endpoint", endpoint.ID, "event", e.Type, "delivery", e.ID, "error", err)
+		}
+	}
+}
+
+// deliver sends one attempt of a delivery job. Deliveries to endpoints that
+// have since been deleted are dropped.
+func (d *Dispatcher) deliver(ctx context.Context, job models.Job) error {
+	id, _ := job.Payload["endpoint"].(string)
+	url, _ := job.Payload["url"].(string)
+	event, _ := job.Payload["event"].(map[string]any)
+	endpoint, err := d.registry.Endpoint(id, url)
+	if errors.Is(err, ErrNotFound) {
+		d.logger.Warn("webhook endpoint no longer exists; dropping delivery", "endpoint", id, "url", url)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	eventType, _ := event["type"].(string)
+	deliveryID, _ := event["id"].(string)
+	return d.send(ctx, endpoint, eventType, deliveryID, body)
+}
+
+// send POSTs an event to an endpoint
+func (d *Dispatcher) send(ctx context.Context, endpoint Endpoint, eventType, deliveryID string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, eventType)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(endpoint.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign computes the X-Webhook-Signature value: an HMAC-SHA256 of the
+// timestamp and body, joined by a dot
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,146 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"userprofile-api/events"
+)
+
+// ErrNotFound is returned when no endpoint has the requested ID
+var ErrNotFound = errors.New("webhook endpoint not found")
+
+// Endpoint is a URL subscribed to user change events
+type Endpoint struct {
+	XMLName xml.Name `json:"-" yaml:"-" xml:"webhook"`
+	ID      string   `json:"id" xml:"id" yaml:"id"`
+	URL     string   `json:"url" xml:"url" yaml:"url"`
+	// Events lists the event types delivered to the endpoint; empty means all
+	Events []string `json:"events" xml:"events>event" yaml:"events"`
+	// Secret signs every delivery. It is only returned when the endpoint is
+	// registered.
+	Secret    string    `json:"secret,omitempty" xml:"secret,omitempty" yaml:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt" xml:"createdAt" yaml:"createdAt"`
+}
+
+// Wants reports whether the endpoint subscribes to the event type
+func (e Endpoint) Wants(eventType string) bool {
+	return len(e.Events) == 0 || slices.Contains(e.Events, eventType)
+}
+
+// Validate checks the URL and event types of an endpoint being registered
+func (e Endpoint) Validate() error {
+	u, err := url.Parse(e.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	for _, eventType := range e.Events {
+		if !slices.Contains(events.Types, eventType) {
+			return fmt.Errorf("unknown event type %q", eventType)
+		}
+	}
+	return nil
+}
+
+// Registry holds the subscribed endpoints in memory
+type Registry struct {
+	mu        sync.RWMutex
+	endpoints []Endpoint
+}
+
+// NewRegistry creates a registry holding the given endpoints
+func NewRegistry(endpoints ...Endpoint) *Registry {
+	return &Registry{endpoints: endpoints}
+}
+
+// Add registers an endpoint, assigning its ID and generating a secret when
+// none is given
+func (r *Registry) Add(e Endpoint) (Endpoint, error) {
+	if err := e.Validate(); err != nil {
+		return Endpoint{}, err
+	}
+	e.ID = uuid.NewString()
+	e.CreatedAt = time.Now().UTC()
+	if e.Events == nil {
+		e.Events = []string{}
+	}
+	if e.Secret == "" {
+		e.Secret = newSecret()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endpoints = append(r.endpoints, e)
+	return e, nil
+}
+
+// List returns the registered endpoints without their secrets
+func (r *Registry) List() []Endpoint {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]Endpoint, len(r.endpoints))
+	for i, e := range r.endpoints {
+		e.Secret = ""
+		list[i] = e
+	}
+	return list
+}
+
+// Subscribers returns the endpoints, secrets included, that want the event
+func (r *Registry) Subscribers(eventType string) []Endpoint {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var subscribers []Endpoint
+	for _, e := range r.endpoints {
+		if e.Wants(eventType) {
+			subscribers = append(subscribers, e)
+		}
+	}
+	return subscribers
+}
+
+// Endpoint returns the endpoint, secret included, with the given ID, or else
+// the one with the given URL, since the endpoints configured through
+// WEBHOOK_URLS are given new IDs on every start
+func (r *Registry) Endpoint(id, url string) (Endpoint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := slices.IndexFunc(r.endpoints, func(e Endpoint) bool { return e.ID == id })
+	if i < 0 {
+		i = slices.IndexFunc(r.endpoints, func(e Endpoint) bool { return e.URL == url })
+	}
+	if i < 0 {
+		return Endpoint{}, ErrNotFound
+	}
+	return r.endpoints[i], nil
+}
+
+// Delete unregisters the endpoint with the given ID
+func (r *Registry) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := slices.IndexFunc(r.endpoints, func(e Endpoint) bool { return e.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.endpoints = slices.Delete(r.endpoints, i, i+1)
+	return nil
+}
+
+func newSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
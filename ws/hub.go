@@ -0,0 +1,198 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"userprofile-api/cors"
+	"userprofile-api/events"
+	"userprofile-api/tenant"
+)
+
+const (
+	// writeWait bounds how long a single write to a client may take
+	writeWait = 10 * time.Second
+	// pongWait is how long a client may stay silent before it is dropped
+	pongWait = 60 * time.Second
+	// pingPeriod must be shorter than pongWait so pongs arrive in time
+	pingPeriod = pongWait * 9 / 10
+	// sendQueueSize is how many events may wait for a slow client before
+	// it is disconnected
+	sendQueueSize = 64
+	// maxMessageSize limits what clients may send; the stream is one-way
+	maxMessageSize = 512
+)
+
+// Hub broadcasts user change events to the connected WebSocket clients
+type Hub struct {
+	upgrader websocket.Upgrader
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	clients map[*client]struct{}
+	closed  bool
+}
+
+// client is one connection and its queue of outgoing messages
+type client struct {
+	conn *websocket.Conn
+	send chan []byte
+	once sync.Once
+	// tenant is the tenant whose events the client receives
+	tenant string
+}
+
+// NewHub creates a hub accepting connections from the same origin and from
+// the origins allowed by the CORS policy
+func NewHub(policy *cors.Policy, logger *slog.Logger) *Hub {
+	h := &Hub{logger: logger, clients: make(map[*client]struct{})}
+	h.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     checkOrigin(policy),
+	}
+	return h
+}
+
+func checkOrigin(policy *cors.Policy) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || policy.AllowsOrigin(origin) {
+			return true
+		}
+		// Same-origin requests, as gorilla/websocket allows by default
+		return origin == "http://"+r.Host || origin == "https://"+r.Host
+	}
+}
+
+// Handle queues the event for every client of the event's tenant. It is an
+// events.Handler and never blocks: clients whose queue is full are
+// disconnected.
+func (h *Hub) Handle(e events.Event) {
+	msg, err := json.Marshal(e)
+	if err != nil {
+		h.logger.Error("websocket event encoding failed", "event", e.Type, "error", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		if c.tenant != e.Tenant {
+			continue
+		}
+		select {
+		case c.send <- msg:
+		default:
+			h.logger.Warn("websocket client too slow; disconnecting", "remoteAddr", c.conn.RemoteAddr().String())
+			h.removeLocked(c)
+		}
+	}
+}
+
+// ServeWS upgrades the request to a WebSocket and streams the events of the
+// request's tenant to it
+func (h *Hub) ServeWS(c *gin.Context) {
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already written an error response
+		return
+	}
+
+	cl := &client{conn: conn, send: make(chan []byte, sendQueueSize), tenant: tenant.ID(c)}
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(writeWait))
+		conn.Close()
+		return
+	}
+	h.clients[cl] = struct{}{}
+	h.mu.Unlock()
+
+	go h.writePump(cl)
+	go h.readPump(cl)
+}
+
+// remove disconnects a client; it is safe to call more than once
+func (h *Hub) remove(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(c)
+}
+
+func (h *Hub) removeLocked(c *client) {
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	delete(h.clients, c)
+	// Closing the queue tells the write pump to send a close frame
+	c.once.Do(func() { close(c.send) })
+}
+
+// readPump discards client messages but must run to process pongs and
+// notice disconnects
+func (h *Hub) readPump(c *client) {
+	defer h.remove(c)
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// writePump is the only goroutine writing to the connection. It sends
+// queued events and periodic pings.
+func (h *Hub) writePump(c *client) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				h.remove(c)
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				h.remove(c)
+				return
+			}
+		}
+	}
+}
+
+// Close disconnects every client and refuses new connections. It is meant
+// for shutting down, since http.Server.Shutdown does not wait for upgraded
+// connections.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for c := range h.clients {
+		h.removeLocked(c)
+	}
+}